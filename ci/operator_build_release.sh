@@ -81,7 +81,8 @@ faq -f yaml -o yaml --slurp '
   .[0].spec.install = {strategy: "deployment", spec:{
   deployments: [{name: .[1].metadata.name, spec: .[1].spec }],
   permissions: [{serviceAccountName: .[3].subjects[0].name, rules: .[2].rules }]}} |
-  .[0].spec.install.spec.deployments[0].spec.template.spec.containers[0].image = $image
+  .[0].spec.install.spec.deployments[0].spec.template.spec.containers[0].image = $image |
+  .[0].spec.relatedImages = [{name: "operator", image: $image}, {name: "vizier-deleter", image: $deleterImage}]
   | .[0]' \
   "$(pwd)/k8s/operator/bundle/csv.yaml" \
   "${kustomize_dir}/apps_v1_deployment_vizier-operator.yaml" \
@@ -89,15 +90,15 @@ faq -f yaml -o yaml --slurp '
   "${kustomize_dir}/rbac.authorization.k8s.io_v1_clusterrolebinding_pixie-operator-cluster-binding.yaml" \
   --kwargs version="${release_tag}" --kwargs name="pixie-operator.v${bundle_version}" \
   --kwargs previousName="pixie-operator.v${previous_version}" \
-  --kwargs image="${image_path}" > "${tmp_dir}/manifests/csv.yaml"
+  --kwargs image="${image_path}" --kwargs deleterImage="${deleter_image_path}" > "${tmp_dir}/manifests/csv.yaml"
 faq -f yaml -o yaml --slurp '.[0]' "${kustomize_dir}/crd.yaml" > "${tmp_dir}/manifests/crd.yaml"
 
-# Update deleter template image tag.
-#shellcheck disable=SC2016
-faq -f yaml -o yaml --slurp '.[0].spec.template.spec.containers[0].image = $imagePath | .[0]' \
-  "$(pwd)/k8s/operator/helm/templates/deleter.yaml" \
-  --kwargs imagePath="${deleter_image_path}" > "$(pwd)/k8s/operator/helm/templates/deleter_tmp.yaml"
-mv "$(pwd)/k8s/operator/helm/templates/deleter_tmp.yaml" "$(pwd)/k8s/operator/helm/templates/deleter.yaml"
+# Update deleter and operator template image tags. The images are templated to support registries, so they can't be
+# updated with faq.
+sed -i "s|gcr.io/pixie-oss/pixie-dev/operator/vizier_deleter:latest|${deleter_image_path}|" \
+  "$(pwd)/k8s/operator/helm/templates/deleter.yaml"
+sed -i "s|gcr.io/pixie-oss/pixie-dev/operator/operator_image:latest|${image_path}|" \
+  "$(pwd)/k8s/operator/helm/templates/05_operator.yaml"
 
 # Build and push bundle.
 cd "${tmp_dir}"
@@ -61,7 +61,8 @@ type Client struct {
 
 	cloudAddr string
 
-	useEncryption bool
+	useEncryption       bool
+	allowPartialResults bool
 
 	grpcConn *grpc.ClientConn
 	cmClient cloudpb.VizierClusterInfoClient
@@ -48,6 +48,8 @@ type VizierInfo struct {
 	Status VizierStatus
 	// Version of the installed vizier.
 	Version string
+	// Labels attached to the Vizier's cluster.
+	Labels map[string]string
 }
 
 func clusterStatusToVizierStatus(status cloudpb.ClusterStatus) VizierStatus {
@@ -67,7 +69,15 @@ func clusterStatusToVizierStatus(status cloudpb.ClusterStatus) VizierStatus {
 
 // ListViziers gets a list of Viziers registered with Pixie.
 func (c *Client) ListViziers(ctx context.Context) ([]*VizierInfo, error) {
-	req := &cloudpb.GetClusterInfoRequest{}
+	return c.ListViziersWithSelector(ctx, "")
+}
+
+// ListViziersWithSelector gets a list of Viziers registered with Pixie whose labels match the
+// given label selector, such as "env=prod,region in (eu, us)".
+func (c *Client) ListViziersWithSelector(ctx context.Context, selector string) ([]*VizierInfo, error) {
+	req := &cloudpb.GetClusterInfoRequest{
+		Selector: selector,
+	}
 	res, err := c.cmClient.GetClusterInfo(c.cloudCtxWithMD(ctx), req)
 	if err != nil {
 		return nil, err
@@ -80,6 +90,7 @@ func (c *Client) ListViziers(ctx context.Context) ([]*VizierInfo, error) {
 			ID:      utils.ProtoToUUIDStr(v.ID),
 			Version: v.VizierVersion,
 			Status:  clusterStatusToVizierStatus(v.Status),
+			Labels:  v.Labels,
 		})
 	}
 
@@ -107,6 +118,7 @@ func (c *Client) GetVizierInfo(ctx context.Context, clusterID string) (*VizierIn
 		ID:      utils.ProtoToUUIDStr(v.ID),
 		Version: v.VizierVersion,
 		Status:  clusterStatusToVizierStatus(v.Status),
+		Labels:  v.Labels,
 	}, nil
 }
 
@@ -106,4 +106,8 @@ func main() {
 	stats := resultSet.Stats()
 	fmt.Printf("Execution Time: %v\n", stats.ExecutionTime)
 	fmt.Printf("Bytes received: %v\n", stats.TotalBytes)
+	// Only set when the client is created with pxapi.WithPartialResults(true).
+	for _, agent := range stats.MissingAgents {
+		fmt.Printf("Warning: results from agent %s are missing: %s\n", agent.AgentID, agent.Reason)
+	}
 }
@@ -42,6 +42,14 @@ func WithAPIKey(auth string) ClientOption {
 	}
 }
 
+// WithPartialResults is the option to let scripts complete with the results that were received when some
+// agents fail or time out, instead of failing. The missing agents are reported in the stats of the results.
+func WithPartialResults(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.allowPartialResults = enabled
+	}
+}
+
 // WithE2EEncryption is the option to enable E2E ecnryption for table data.
 func WithE2EEncryption(enabled bool) ClientOption {
 	return func(c *Client) {
@@ -45,6 +45,22 @@ type ResultsStats struct {
 	CompilationTime  time.Duration
 	BytesProcessed   int64
 	RecordsProcessed int64
+
+	// The agents that failed or timed out before sending all of their results, when partial results are enabled.
+	MissingAgents []*MissingAgent
+	// The tables that did not receive all of their results, when partial results are enabled.
+	IncompleteTables []string
+}
+
+// MissingAgent is an agent whose results are missing from the results of a script.
+type MissingAgent struct {
+	AgentID string
+	Reason  string
+}
+
+// Partial returns whether some of the results of the script are missing.
+func (s *ResultsStats) Partial() bool {
+	return len(s.MissingAgents) > 0 || len(s.IncompleteTables) > 0
 }
 
 // ScriptResults tracks the results of a script, and provides mechanisms to cancel, etc.
@@ -331,6 +347,13 @@ func (s *ScriptResults) handleStats(ctx context.Context, qes *vizierpb.QueryExec
 	s.stats.RecordsProcessed += qes.RecordsProcessed
 	s.stats.CompilationTime = time.Duration(qes.Timing.CompilationTimeNs) * time.Nanosecond
 	s.stats.ExecutionTime = time.Duration(qes.Timing.ExecutionTimeNs) * time.Nanosecond
+	for _, agent := range qes.MissingAgents {
+		s.stats.MissingAgents = append(s.stats.MissingAgents, &MissingAgent{
+			AgentID: agent.AgentID,
+			Reason:  agent.Reason,
+		})
+	}
+	s.stats.IncompleteTables = append(s.stats.IncompleteTables, qes.IncompleteTables...)
 	return nil
 }
 
@@ -20,6 +20,7 @@ package pxapi
 
 import (
 	"context"
+	"io"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
 )
@@ -36,9 +37,10 @@ type VizierClient struct {
 // ExecuteScript runs the script on vizier.
 func (v *VizierClient) ExecuteScript(ctx context.Context, pxl string, mux TableMuxer) (*ScriptResults, error) {
 	req := &vizierpb.ExecuteScriptRequest{
-		ClusterID:         v.vizierID,
-		QueryStr:          pxl,
-		EncryptionOptions: v.encOpts,
+		ClusterID:           v.vizierID,
+		QueryStr:            pxl,
+		EncryptionOptions:   v.encOpts,
+		AllowPartialResults: v.cloud.allowPartialResults,
 	}
 	ctx, cancel := context.WithCancel(ctx)
 	res, err := v.vzClient.ExecuteScript(v.cloud.cloudCtxWithMD(ctx), req)
@@ -55,3 +57,41 @@ func (v *VizierClient) ExecuteScript(ctx context.Context, pxl string, mux TableM
 
 	return sr, nil
 }
+
+// AgentEventHandler is called with each agent lifecycle event. Returning an error stops watching the events.
+type AgentEventHandler func(event *vizierpb.AgentEvent) error
+
+// WatchAgentEvents streams the lifecycle events of the agents on vizier, such as an agent registering or expiring,
+// to the handler. Only events of the given types are streamed, or all events if none are given. It blocks until the
+// context is cancelled, the stream ends or the handler returns an error.
+func (v *VizierClient) WatchAgentEvents(ctx context.Context, handler AgentEventHandler, eventTypes ...vizierpb.AgentEventType) error {
+	req := &vizierpb.GetAgentEventsRequest{
+		ClusterID: v.vizierID,
+		Types:     eventTypes,
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := v.vzClient.GetAgentEvents(v.cloud.cloudCtxWithMD(ctx), req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				// Stream has terminated.
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, event := range resp.Events {
+			if err := handler(event); err != nil {
+				return err
+			}
+		}
+	}
+}
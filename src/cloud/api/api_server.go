@@ -125,6 +125,11 @@ func main() {
 		log.WithError(err).Fatal("Failed to connect to plugin service")
 	}
 
+	ns, err := apienv.NewNotificationServiceClient()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to init notification service client")
+	}
+
 	env, err := apienv.New(ac, pc, oc, vk, ak, vc, at, oa, cm, ps, drps)
 	if err != nil {
 		log.WithError(err).Fatal("Failed to create api environment")
@@ -158,6 +163,9 @@ func main() {
 		fmt.Fprintf(w, "OK")
 	})))
 
+	// The SCIM endpoint authenticates requests using the org's SCIM token rather than user credentials.
+	mux.Handle(controllers.SCIMPathPrefix+"/", handler.New(env, controllers.SCIMHandler))
+
 	if viper.GetString("auth_connector_name") != "" {
 		mux.Handle(fmt.Sprintf("/api/auth/%s", viper.GetString("auth_connector_name")), handler.New(env, controllers.AuthConnectorHandler))
 	}
@@ -276,6 +284,9 @@ func main() {
 	pss := &controllers.PluginServiceServer{PluginServiceClient: ps, DataRetentionPluginServiceClient: drps}
 	cloudpb.RegisterPluginServiceServer(s.GRPCServer(), pss)
 
+	nss := &controllers.NotificationServiceServer{NotificationServiceClient: ns}
+	cloudpb.RegisterNotificationServiceServer(s.GRPCServer(), nss)
+
 	gqlEnv := controllers.GraphQLEnv{
 		ArtifactTrackerServer: artifactTrackerServer,
 		VizierClusterInfo:     cis,
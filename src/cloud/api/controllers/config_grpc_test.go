@@ -71,6 +71,7 @@ func TestConfigForVizier(t *testing.T) {
 				Patches: map[string]string{
 					"vizier-pem": `{ "spec": { "template": {"spec": { "tolerations": [{"key": "test", "operator": "Equals", "effect": "NoExecute" }]} }}  }`,
 				},
+				Registry: "registry.internal:5000/px",
 			}
 
 			mockReq := &configmanagerpb.ConfigForVizierRequest{
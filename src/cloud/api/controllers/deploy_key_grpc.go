@@ -38,24 +38,52 @@ type VizierDeploymentKeyServer struct {
 	VzDeploymentKey vzmgrpb.VZDeploymentKeyServiceClient
 }
 
+func deployKeyRestrictionsToCloudAPI(r *vzmgrpb.DeploymentKeyRestrictions) *cloudpb.DeploymentKeyRestrictions {
+	if r == nil {
+		return nil
+	}
+	return &cloudpb.DeploymentKeyRestrictions{
+		ExpiresAt:          r.ExpiresAt,
+		MaxClusters:        r.MaxClusters,
+		ClusterNamePattern: r.ClusterNamePattern,
+		DefaultLabels:      r.DefaultLabels,
+	}
+}
+
+func deployKeyRestrictionsToVZMgr(r *cloudpb.DeploymentKeyRestrictions) *vzmgrpb.DeploymentKeyRestrictions {
+	if r == nil {
+		return nil
+	}
+	return &vzmgrpb.DeploymentKeyRestrictions{
+		ExpiresAt:          r.ExpiresAt,
+		MaxClusters:        r.MaxClusters,
+		ClusterNamePattern: r.ClusterNamePattern,
+		DefaultLabels:      r.DefaultLabels,
+	}
+}
+
 func deployKeyToCloudAPI(key *vzmgrpb.DeploymentKey) *cloudpb.DeploymentKey {
 	return &cloudpb.DeploymentKey{
-		ID:        key.ID,
-		OrgID:     key.OrgID,
-		UserID:    key.UserID,
-		Key:       key.Key,
-		CreatedAt: key.CreatedAt,
-		Desc:      key.Desc,
+		ID:           key.ID,
+		OrgID:        key.OrgID,
+		UserID:       key.UserID,
+		Key:          key.Key,
+		CreatedAt:    key.CreatedAt,
+		Desc:         key.Desc,
+		Restrictions: deployKeyRestrictionsToCloudAPI(key.Restrictions),
+		NumClusters:  key.NumClusters,
 	}
 }
 
 func deployKeyMetadataToCloudAPI(key *vzmgrpb.DeploymentKeyMetadata) *cloudpb.DeploymentKeyMetadata {
 	return &cloudpb.DeploymentKeyMetadata{
-		ID:        key.ID,
-		OrgID:     key.OrgID,
-		UserID:    key.UserID,
-		CreatedAt: key.CreatedAt,
-		Desc:      key.Desc,
+		ID:           key.ID,
+		OrgID:        key.OrgID,
+		UserID:       key.UserID,
+		CreatedAt:    key.CreatedAt,
+		Desc:         key.Desc,
+		Restrictions: deployKeyRestrictionsToCloudAPI(key.Restrictions),
+		NumClusters:  key.NumClusters,
 	}
 }
 
@@ -78,9 +106,10 @@ func (v *VizierDeploymentKeyServer) Create(ctx context.Context, req *cloudpb.Cre
 		return nil, status.Error(codes.Internal, "error parsing user ID as UUID")
 	}
 	resp, err := v.VzDeploymentKey.Create(ctx, &vzmgrpb.CreateDeploymentKeyRequest{
-		Desc:   req.Desc,
-		OrgID:  orgID,
-		UserID: userID,
+		Desc:         req.Desc,
+		OrgID:        orgID,
+		UserID:       userID,
+		Restrictions: deployKeyRestrictionsToVZMgr(req.Restrictions),
 	})
 	if err != nil {
 		return nil, err
@@ -190,3 +219,38 @@ func (v *VizierDeploymentKeyServer) LookupDeploymentKey(ctx context.Context, req
 
 	return &cloudpb.LookupDeploymentKeyResponse{Key: deployKeyToCloudAPI(resp.Key)}, nil
 }
+
+// ListClusters lists the clusters that were registered with a specific deploy key in vzmgr.
+func (v *VizierDeploymentKeyServer) ListClusters(ctx context.Context, req *cloudpb.ListDeploymentKeyClustersRequest) (*cloudpb.ListDeploymentKeyClustersResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	aCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgID := apiUtils.ProtoFromUUIDStrOrNil(aCtx.Claims.GetUserClaims().OrgID)
+	if orgID == nil {
+		return nil, status.Error(codes.Internal, "error parsing org ID as UUID")
+	}
+
+	resp, err := v.VzDeploymentKey.ListClusters(ctx, &vzmgrpb.ListDeploymentKeyClustersRequest{
+		ID:    req.ID,
+		OrgID: orgID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clusters := make([]*cloudpb.DeploymentKeyCluster, len(resp.Clusters))
+	for i, c := range resp.Clusters {
+		clusters[i] = &cloudpb.DeploymentKeyCluster{
+			VizierID:    c.VizierID,
+			ClusterName: c.ClusterName,
+			CreatedAt:   c.CreatedAt,
+		}
+	}
+	return &cloudpb.ListDeploymentKeyClustersResponse{
+		Clusters: clusters,
+	}, nil
+}
@@ -88,6 +88,96 @@ func TestVizierDeploymentKeyServer_Create(t *testing.T) {
 	}
 }
 
+func TestVizierDeploymentKeyServer_CreateWithRestrictions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	expiresAt := types.TimestampNow()
+	vzreq := &vzmgrpb.CreateDeploymentKeyRequest{
+		OrgID:  utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		UserID: utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c9"),
+		Desc:   "test key",
+		Restrictions: &vzmgrpb.DeploymentKeyRestrictions{
+			ExpiresAt:          expiresAt,
+			MaxClusters:        2,
+			ClusterNamePattern: "prod-.*",
+			DefaultLabels:      map[string]string{"env": "prod"},
+		},
+	}
+	vzresp := &vzmgrpb.DeploymentKey{
+		ID:           utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		OrgID:        utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c9"),
+		Key:          "foobar",
+		CreatedAt:    types.TimestampNow(),
+		Restrictions: vzreq.Restrictions,
+	}
+	mockClients.MockVzDeployKey.EXPECT().
+		Create(gomock.Any(), vzreq).Return(vzresp, nil)
+
+	vzDeployKeyServer := &controllers.VizierDeploymentKeyServer{
+		VzDeploymentKey: mockClients.MockVzDeployKey,
+	}
+
+	restrictions := &cloudpb.DeploymentKeyRestrictions{
+		ExpiresAt:          expiresAt,
+		MaxClusters:        2,
+		ClusterNamePattern: "prod-.*",
+		DefaultLabels:      map[string]string{"env": "prod"},
+	}
+	resp, err := vzDeployKeyServer.Create(ctx, &cloudpb.CreateDeploymentKeyRequest{
+		Desc:         "test key",
+		Restrictions: restrictions,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, restrictions, resp.Restrictions)
+}
+
+func TestVizierDeploymentKeyServer_ListClusters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	ctx := CreateTestContext()
+
+	keyID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430d3")
+	createdAt := types.TimestampNow()
+	mockClients.MockVzDeployKey.EXPECT().
+		ListClusters(gomock.Any(), &vzmgrpb.ListDeploymentKeyClustersRequest{
+			ID:    keyID,
+			OrgID: utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		}).
+		Return(&vzmgrpb.ListDeploymentKeyClustersResponse{
+			Clusters: []*vzmgrpb.DeploymentKeyCluster{
+				{
+					VizierID:    utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+					ClusterName: "prod-cluster",
+					CreatedAt:   createdAt,
+				},
+			},
+		}, nil)
+
+	vzDeployKeyServer := &controllers.VizierDeploymentKeyServer{
+		VzDeploymentKey: mockClients.MockVzDeployKey,
+	}
+
+	resp, err := vzDeployKeyServer.ListClusters(ctx, &cloudpb.ListDeploymentKeyClustersRequest{ID: keyID})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.ListDeploymentKeyClustersResponse{
+		Clusters: []*cloudpb.DeploymentKeyCluster{
+			{
+				VizierID:    utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+				ClusterName: "prod-cluster",
+				CreatedAt:   createdAt,
+			},
+		},
+	}, resp)
+}
+
 func TestVizierDeploymentKeyServer_List(t *testing.T) {
 	tests := []struct {
 		name string
@@ -0,0 +1,232 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers
+
+import (
+	"context"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/cloud/notification/notificationpb"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+)
+
+// NotificationServiceServer is used to manage the webhooks that an org's notifications are delivered to.
+type NotificationServiceServer struct {
+	NotificationServiceClient notificationpb.NotificationServiceClient
+}
+
+func eventTypeCloudProtoToNotificationProto(t cloudpb.NotificationEventType) messagespb.NotificationEventType {
+	switch t {
+	case cloudpb.NET_CLUSTER_STATUS_CHANGED:
+		return messagespb.NE_VIZIER_STATUS_CHANGED
+	case cloudpb.NET_CLUSTER_UPDATE_FAILED:
+		return messagespb.NE_VIZIER_UPDATE_FAILED
+	case cloudpb.NET_CRON_SCRIPT_FAILED:
+		return messagespb.NE_CRON_SCRIPT_FAILED
+	default:
+		return messagespb.NE_UNKNOWN
+	}
+}
+
+func eventTypeNotificationProtoToCloudProto(t messagespb.NotificationEventType) cloudpb.NotificationEventType {
+	switch t {
+	case messagespb.NE_VIZIER_STATUS_CHANGED:
+		return cloudpb.NET_CLUSTER_STATUS_CHANGED
+	case messagespb.NE_VIZIER_UPDATE_FAILED:
+		return cloudpb.NET_CLUSTER_UPDATE_FAILED
+	case messagespb.NE_CRON_SCRIPT_FAILED:
+		return cloudpb.NET_CRON_SCRIPT_FAILED
+	default:
+		return cloudpb.NET_UNKNOWN
+	}
+}
+
+func eventTypesCloudProtoToNotificationProto(types []cloudpb.NotificationEventType) []messagespb.NotificationEventType {
+	res := make([]messagespb.NotificationEventType, len(types))
+	for i, t := range types {
+		res[i] = eventTypeCloudProtoToNotificationProto(t)
+	}
+	return res
+}
+
+func formatCloudProtoToNotificationProto(f cloudpb.WebhookFormat) notificationpb.WebhookFormat {
+	switch f {
+	case cloudpb.WF_JSON:
+		return notificationpb.WEBHOOK_FORMAT_JSON
+	case cloudpb.WF_SLACK:
+		return notificationpb.WEBHOOK_FORMAT_SLACK
+	default:
+		return notificationpb.WEBHOOK_FORMAT_UNKNOWN
+	}
+}
+
+func formatNotificationProtoToCloudProto(f notificationpb.WebhookFormat) cloudpb.WebhookFormat {
+	switch f {
+	case notificationpb.WEBHOOK_FORMAT_JSON:
+		return cloudpb.WF_JSON
+	case notificationpb.WEBHOOK_FORMAT_SLACK:
+		return cloudpb.WF_SLACK
+	default:
+		return cloudpb.WF_UNKNOWN
+	}
+}
+
+// CreateWebhook registers a new webhook for the org.
+func (n *NotificationServiceServer) CreateWebhook(ctx context.Context, req *cloudpb.CreateWebhookRequest) (*cloudpb.CreateWebhookResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := n.NotificationServiceClient.CreateWebhook(ctx, &notificationpb.CreateWebhookRequest{
+		Name:       req.Name,
+		URL:        req.URL,
+		Format:     formatCloudProtoToNotificationProto(req.Format),
+		EventTypes: eventTypesCloudProtoToNotificationProto(req.EventTypes),
+		ClusterIDs: req.ClusterIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cloudpb.CreateWebhookResponse{
+		ID:            resp.ID,
+		SigningSecret: resp.SigningSecret,
+	}, nil
+}
+
+// GetWebhooks gets all webhooks registered for the org.
+func (n *NotificationServiceServer) GetWebhooks(ctx context.Context, req *cloudpb.GetWebhooksRequest) (*cloudpb.GetWebhooksResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := n.NotificationServiceClient.GetWebhooks(ctx, &notificationpb.GetWebhooksRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*cloudpb.Webhook, len(resp.Webhooks))
+	for i, w := range resp.Webhooks {
+		eventTypes := make([]cloudpb.NotificationEventType, len(w.EventTypes))
+		for j, t := range w.EventTypes {
+			eventTypes[j] = eventTypeNotificationProtoToCloudProto(t)
+		}
+		webhooks[i] = &cloudpb.Webhook{
+			ID:         w.ID,
+			Name:       w.Name,
+			URL:        w.URL,
+			Format:     formatNotificationProtoToCloudProto(w.Format),
+			EventTypes: eventTypes,
+			ClusterIDs: w.ClusterIDs,
+			Enabled:    w.Enabled,
+			CreatedAt:  w.CreatedAt,
+		}
+	}
+
+	return &cloudpb.GetWebhooksResponse{
+		Webhooks: webhooks,
+	}, nil
+}
+
+// UpdateWebhook updates an existing webhook.
+func (n *NotificationServiceServer) UpdateWebhook(ctx context.Context, req *cloudpb.UpdateWebhookRequest) (*cloudpb.UpdateWebhookResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updateReq := &notificationpb.UpdateWebhookRequest{
+		ID:                  req.ID,
+		Name:                req.Name,
+		URL:                 req.URL,
+		Enabled:             req.Enabled,
+		RotateSigningSecret: req.RotateSigningSecret,
+	}
+	if req.EventTypes != nil {
+		updateReq.EventTypes = &notificationpb.EventTypes{
+			Value: eventTypesCloudProtoToNotificationProto(req.EventTypes.Value),
+		}
+	}
+	if req.ClusterIDs != nil {
+		updateReq.ClusterIDs = &notificationpb.WebhookClusterIDs{
+			Value: req.ClusterIDs.Value,
+		}
+	}
+
+	resp, err := n.NotificationServiceClient.UpdateWebhook(ctx, updateReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cloudpb.UpdateWebhookResponse{
+		SigningSecret: resp.SigningSecret,
+	}, nil
+}
+
+// DeleteWebhook deletes a webhook.
+func (n *NotificationServiceServer) DeleteWebhook(ctx context.Context, req *cloudpb.DeleteWebhookRequest) (*cloudpb.DeleteWebhookResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = n.NotificationServiceClient.DeleteWebhook(ctx, &notificationpb.DeleteWebhookRequest{
+		ID: req.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cloudpb.DeleteWebhookResponse{}, nil
+}
+
+// GetWebhookDeliveries gets the most recent delivery attempts for a webhook.
+func (n *NotificationServiceServer) GetWebhookDeliveries(ctx context.Context, req *cloudpb.GetWebhookDeliveriesRequest) (*cloudpb.GetWebhookDeliveriesResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := n.NotificationServiceClient.GetWebhookDeliveries(ctx, &notificationpb.GetWebhookDeliveriesRequest{
+		WebhookID: req.WebhookID,
+		Limit:     req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*cloudpb.WebhookDelivery, len(resp.Deliveries))
+	for i, d := range resp.Deliveries {
+		deliveries[i] = &cloudpb.WebhookDelivery{
+			ID:           d.ID,
+			EventID:      d.EventID,
+			EventType:    eventTypeNotificationProtoToCloudProto(d.EventType),
+			Time:         d.Time,
+			Attempts:     d.Attempts,
+			ResponseCode: d.ResponseCode,
+			Error:        d.Error,
+			Success:      d.Success,
+		}
+	}
+
+	return &cloudpb.GetWebhookDeliveriesResponse{
+		Deliveries: deliveries,
+	}, nil
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/cloudpb"
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/api/controllers"
+	"px.dev/pixie/src/cloud/notification/notificationpb"
+	mock_notificationpb "px.dev/pixie/src/cloud/notification/notificationpb/mock"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+func TestNotificationServiceServer_CreateWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_notificationpb.NewMockNotificationServiceClient(ctrl)
+	webhookID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+	clusterID := utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440000")
+
+	mockClient.EXPECT().CreateWebhook(gomock.Any(), &notificationpb.CreateWebhookRequest{
+		Name:       "test hook",
+		URL:        "https://example.com/hook",
+		Format:     notificationpb.WEBHOOK_FORMAT_SLACK,
+		EventTypes: []messagespb.NotificationEventType{messagespb.NE_VIZIER_STATUS_CHANGED, messagespb.NE_CRON_SCRIPT_FAILED},
+		ClusterIDs: []*uuidpb.UUID{clusterID},
+	}).Return(&notificationpb.CreateWebhookResponse{
+		ID:            webhookID,
+		SigningSecret: "secret",
+	}, nil)
+
+	n := &controllers.NotificationServiceServer{NotificationServiceClient: mockClient}
+	resp, err := n.CreateWebhook(CreateTestContext(), &cloudpb.CreateWebhookRequest{
+		Name:       "test hook",
+		URL:        "https://example.com/hook",
+		Format:     cloudpb.WF_SLACK,
+		EventTypes: []cloudpb.NotificationEventType{cloudpb.NET_CLUSTER_STATUS_CHANGED, cloudpb.NET_CRON_SCRIPT_FAILED},
+		ClusterIDs: []*uuidpb.UUID{clusterID},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.CreateWebhookResponse{
+		ID:            webhookID,
+		SigningSecret: "secret",
+	}, resp)
+}
+
+func TestNotificationServiceServer_GetWebhooks(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{
+			name: "regular user",
+			ctx:  CreateTestContext(),
+		},
+		{
+			name: "api user",
+			ctx:  CreateAPIUserTestContext(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockClient := mock_notificationpb.NewMockNotificationServiceClient(ctrl)
+			webhookID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+			clusterID := utils.ProtoFromUUIDStrOrNil("323e4567-e89b-12d3-a456-426655440000")
+
+			mockClient.EXPECT().GetWebhooks(gomock.Any(), &notificationpb.GetWebhooksRequest{}).
+				Return(&notificationpb.GetWebhooksResponse{
+					Webhooks: []*notificationpb.Webhook{
+						{
+							ID:         webhookID,
+							OrgID:      utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+							Name:       "test hook",
+							URL:        "https://example.com/hook",
+							Format:     notificationpb.WEBHOOK_FORMAT_JSON,
+							EventTypes: []messagespb.NotificationEventType{messagespb.NE_VIZIER_UPDATE_FAILED},
+							ClusterIDs: []*uuidpb.UUID{clusterID},
+							Enabled:    true,
+							CreatedAt:  &types.Timestamp{Seconds: 1621352198},
+						},
+					},
+				}, nil)
+
+			n := &controllers.NotificationServiceServer{NotificationServiceClient: mockClient}
+			resp, err := n.GetWebhooks(test.ctx, &cloudpb.GetWebhooksRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, &cloudpb.GetWebhooksResponse{
+				Webhooks: []*cloudpb.Webhook{
+					{
+						ID:         webhookID,
+						Name:       "test hook",
+						URL:        "https://example.com/hook",
+						Format:     cloudpb.WF_JSON,
+						EventTypes: []cloudpb.NotificationEventType{cloudpb.NET_CLUSTER_UPDATE_FAILED},
+						ClusterIDs: []*uuidpb.UUID{clusterID},
+						Enabled:    true,
+						CreatedAt:  &types.Timestamp{Seconds: 1621352198},
+					},
+				},
+			}, resp)
+		})
+	}
+}
+
+func TestNotificationServiceServer_UpdateWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_notificationpb.NewMockNotificationServiceClient(ctrl)
+	webhookID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+	mockClient.EXPECT().UpdateWebhook(gomock.Any(), &notificationpb.UpdateWebhookRequest{
+		ID:      webhookID,
+		Enabled: &types.BoolValue{Value: false},
+		EventTypes: &notificationpb.EventTypes{
+			Value: []messagespb.NotificationEventType{messagespb.NE_CRON_SCRIPT_FAILED},
+		},
+		RotateSigningSecret: true,
+	}).Return(&notificationpb.UpdateWebhookResponse{
+		SigningSecret: "new-secret",
+	}, nil)
+
+	n := &controllers.NotificationServiceServer{NotificationServiceClient: mockClient}
+	resp, err := n.UpdateWebhook(CreateTestContext(), &cloudpb.UpdateWebhookRequest{
+		ID:      webhookID,
+		Enabled: &types.BoolValue{Value: false},
+		EventTypes: &cloudpb.NotificationEventTypes{
+			Value: []cloudpb.NotificationEventType{cloudpb.NET_CRON_SCRIPT_FAILED},
+		},
+		RotateSigningSecret: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new-secret", resp.SigningSecret)
+}
+
+func TestNotificationServiceServer_DeleteWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_notificationpb.NewMockNotificationServiceClient(ctrl)
+	webhookID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+	mockClient.EXPECT().DeleteWebhook(gomock.Any(), &notificationpb.DeleteWebhookRequest{
+		ID: webhookID,
+	}).Return(&notificationpb.DeleteWebhookResponse{}, nil)
+
+	n := &controllers.NotificationServiceServer{NotificationServiceClient: mockClient}
+	_, err := n.DeleteWebhook(CreateTestContext(), &cloudpb.DeleteWebhookRequest{
+		ID: webhookID,
+	})
+	require.NoError(t, err)
+}
+
+func TestNotificationServiceServer_GetWebhookDeliveries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := mock_notificationpb.NewMockNotificationServiceClient(ctrl)
+	webhookID := utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000")
+	deliveryID := utils.ProtoFromUUIDStrOrNil("423e4567-e89b-12d3-a456-426655440000")
+	eventID := utils.ProtoFromUUIDStrOrNil("523e4567-e89b-12d3-a456-426655440000")
+
+	mockClient.EXPECT().GetWebhookDeliveries(gomock.Any(), &notificationpb.GetWebhookDeliveriesRequest{
+		WebhookID: webhookID,
+		Limit:     10,
+	}).Return(&notificationpb.GetWebhookDeliveriesResponse{
+		Deliveries: []*notificationpb.WebhookDelivery{
+			{
+				ID:           deliveryID,
+				WebhookID:    webhookID,
+				EventID:      eventID,
+				EventType:    messagespb.NE_VIZIER_STATUS_CHANGED,
+				Time:         &types.Timestamp{Seconds: 1621352198},
+				Attempts:     3,
+				ResponseCode: 503,
+				Error:        "webhook responded with status 503",
+			},
+		},
+	}, nil)
+
+	n := &controllers.NotificationServiceServer{NotificationServiceClient: mockClient}
+	resp, err := n.GetWebhookDeliveries(CreateTestContext(), &cloudpb.GetWebhookDeliveriesRequest{
+		WebhookID: webhookID,
+		Limit:     10,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &cloudpb.GetWebhookDeliveriesResponse{
+		Deliveries: []*cloudpb.WebhookDelivery{
+			{
+				ID:           deliveryID,
+				EventID:      eventID,
+				EventType:    cloudpb.NET_CLUSTER_STATUS_CHANGED,
+				Time:         &types.Timestamp{Seconds: 1621352198},
+				Attempts:     3,
+				ResponseCode: 503,
+				Error:        "webhook responded with status 503",
+			},
+		},
+	}, resp)
+}
@@ -33,6 +33,7 @@ import (
 	"px.dev/pixie/src/cloud/profile/profilepb"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/shared/services/events"
+	claimsutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
 )
 
@@ -131,6 +132,7 @@ func (o *OrganizationServiceServer) CreateOrg(ctx context.Context, req *cloudpb.
 	orgID, err := o.OrgServiceClient.CreateOrg(ctx, &profilepb.CreateOrgRequest{
 		OrgName:    req.OrgName,
 		DomainName: &types.StringValue{Value: ""},
+		OwnerID:    utils.ProtoFromUUIDStrOrNil(sCtx.Claims.GetUserClaims().UserID),
 	})
 	if err != nil {
 		return nil, err
@@ -396,6 +398,73 @@ func (o *OrganizationServiceServer) RevokeAllInviteTokens(ctx context.Context, r
 	return o.OrgServiceClient.RevokeAllInviteTokens(ctx, req)
 }
 
+// checkOrgOwner checks that the caller owns the given org. Pixie has no separate admin role, so org-wide
+// settings that control who can access the org are restricted to the owner. API keys may not be used.
+func (o *OrganizationServiceServer) checkOrgOwner(ctx context.Context, orgID uuid.UUID) error {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if claimsutils.GetClaimsType(sCtx.Claims) != claimsutils.UserClaimType || sCtx.Claims.GetUserClaims().IsAPIUser {
+		return status.Error(codes.PermissionDenied, "must be the org owner")
+	}
+	claims := sCtx.Claims.GetUserClaims()
+	if uuid.FromStringOrNil(claims.OrgID) != orgID {
+		return status.Error(codes.PermissionDenied, "must be the org owner")
+	}
+
+	orgInfo, err := o.OrgServiceClient.GetOrg(ctx, utils.ProtoFromUUID(orgID))
+	if err != nil {
+		return err
+	}
+	userID := uuid.FromStringOrNil(claims.UserID)
+	if userID == uuid.Nil || utils.UUIDFromProtoOrNil(orgInfo.OwnerID) != userID {
+		return status.Error(codes.PermissionDenied, "must be the org owner")
+	}
+
+	// The owner may have since left the org.
+	userInfo, err := o.ProfileServiceClient.GetUser(ctx, utils.ProtoFromUUID(userID))
+	if err != nil {
+		return err
+	}
+	if utils.UUIDFromProtoOrNil(userInfo.OrgID) != orgID || !userInfo.IsApproved {
+		return status.Error(codes.PermissionDenied, "must be the org owner")
+	}
+	return nil
+}
+
+// CreateSCIMToken creates the token used to authenticate SCIM provisioning requests for the given org.
+func (o *OrganizationServiceServer) CreateSCIMToken(ctx context.Context, req *uuidpb.UUID) (*cloudpb.SCIMToken, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.checkOrgOwner(ctx, utils.UUIDFromProtoOrNil(req)); err != nil {
+		return nil, err
+	}
+
+	resp, err := o.OrgServiceClient.CreateSCIMToken(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudpb.SCIMToken{Token: resp.Token}, nil
+}
+
+// RevokeSCIMToken revokes the SCIM provisioning token for the given org.
+func (o *OrganizationServiceServer) RevokeSCIMToken(ctx context.Context, req *uuidpb.UUID) (*types.Empty, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.checkOrgOwner(ctx, utils.UUIDFromProtoOrNil(req)); err != nil {
+		return nil, err
+	}
+
+	return o.OrgServiceClient.RevokeSCIMToken(ctx, req)
+}
+
 // VerifyInviteToken verifies that the given invite JWT is still valid by performing expiration and
 // signing key checks.
 func (o *OrganizationServiceServer) VerifyInviteToken(ctx context.Context, req *cloudpb.InviteToken) (*cloudpb.VerifyInviteTokenResponse, error) {
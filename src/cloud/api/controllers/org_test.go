@@ -119,6 +119,7 @@ func TestOrganizationServiceServer_CreateOrg_UserWithNoOrg(t *testing.T) {
 	mockClients.MockOrg.EXPECT().CreateOrg(gomock.Any(), &profilepb.CreateOrgRequest{
 		OrgName:    "new_org_name",
 		DomainName: &types.StringValue{Value: ""},
+		OwnerID:    utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c9"),
 	}).Return(orgID, nil)
 
 	mockClients.MockProfile.EXPECT().UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
@@ -334,6 +335,18 @@ func (*fakeOrg) VerifyInviteToken(ctx context.Context, _ *profilepb.InviteToken,
 	return &profilepb.VerifyInviteTokenResponse{}, nil
 }
 
+func (*fakeOrg) CreateSCIMToken(ctx context.Context, _ *uuidpb.UUID, _ ...grpc.CallOption) (*profilepb.SCIMToken, error) {
+	return &profilepb.SCIMToken{}, nil
+}
+
+func (*fakeOrg) RevokeSCIMToken(ctx context.Context, _ *uuidpb.UUID, _ ...grpc.CallOption) (*types.Empty, error) {
+	return &types.Empty{}, nil
+}
+
+func (*fakeOrg) GetOrgBySCIMToken(ctx context.Context, _ *profilepb.GetOrgBySCIMTokenRequest, _ ...grpc.CallOption) (*profilepb.OrgInfo, error) {
+	return &profilepb.OrgInfo{}, nil
+}
+
 func TestOrganizationServiceServer_CorrectOrgPermissions(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -430,6 +443,102 @@ func TestOrganizationServiceServer_CorrectOrgPermissions(t *testing.T) {
 	}
 }
 
+func TestOrganizationServiceServer_SCIMTokenRequiresOrgOwner(t *testing.T) {
+	orgID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	userID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c9")
+	otherUserID := utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c9")
+
+	calls := []struct {
+		name     string
+		funcCall func(ctx context.Context, os *controllers.OrganizationServiceServer) error
+	}{
+		{
+			name: "CreateSCIMToken",
+			funcCall: func(ctx context.Context, os *controllers.OrganizationServiceServer) error {
+				_, err := os.CreateSCIMToken(ctx, orgID)
+				return err
+			},
+		},
+		{
+			name: "RevokeSCIMToken",
+			funcCall: func(ctx context.Context, os *controllers.OrganizationServiceServer) error {
+				_, err := os.RevokeSCIMToken(ctx, orgID)
+				return err
+			},
+		},
+	}
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		org          *profilepb.OrgInfo
+		user         *profilepb.UserInfo
+		expectedCode codes.Code
+	}{
+		{
+			name:         "owner",
+			ctx:          CreateTestContext(),
+			org:          &profilepb.OrgInfo{ID: orgID, OwnerID: userID},
+			user:         &profilepb.UserInfo{ID: userID, OrgID: orgID, IsApproved: true},
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "approved user who isn't the owner",
+			ctx:          CreateTestContext(),
+			org:          &profilepb.OrgInfo{ID: orgID, OwnerID: otherUserID},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "org without an owner",
+			ctx:          CreateTestContext(),
+			org:          &profilepb.OrgInfo{ID: orgID},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "unapproved owner",
+			ctx:          CreateTestContext(),
+			org:          &profilepb.OrgInfo{ID: orgID, OwnerID: userID},
+			user:         &profilepb.UserInfo{ID: userID, OrgID: orgID, IsApproved: false},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "owner no longer in org",
+			ctx:          CreateTestContext(),
+			org:          &profilepb.OrgInfo{ID: orgID, OwnerID: userID},
+			user:         &profilepb.UserInfo{ID: userID, IsApproved: true},
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "api user",
+			ctx:          CreateAPIUserTestContext(),
+			expectedCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, call := range calls {
+		for _, test := range tests {
+			t.Run(call.name+"/"+test.name, func(t *testing.T) {
+				_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+				defer cleanup()
+
+				if test.org != nil {
+					mockClients.MockOrg.EXPECT().GetOrg(gomock.Any(), orgID).Return(test.org, nil)
+				}
+				if test.user != nil {
+					mockClients.MockProfile.EXPECT().GetUser(gomock.Any(), userID).Return(test.user, nil)
+				}
+				if test.expectedCode == codes.OK {
+					mockClients.MockOrg.EXPECT().CreateSCIMToken(gomock.Any(), orgID).Return(&profilepb.SCIMToken{}, nil).AnyTimes()
+					mockClients.MockOrg.EXPECT().RevokeSCIMToken(gomock.Any(), orgID).Return(&types.Empty{}, nil).AnyTimes()
+				}
+
+				os := &controllers.OrganizationServiceServer{mockClients.MockProfile, mockClients.MockAuth, mockClients.MockOrg}
+				err := call.funcCall(test.ctx, os)
+				assert.Equal(t, test.expectedCode, status.Code(err))
+			})
+		}
+	}
+}
+
 func TestOrganizationServiceServer_GetOrgIDEConfigs(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,877 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/api/apienv"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	commonenv "px.dev/pixie/src/shared/services/env"
+	"px.dev/pixie/src/shared/services/httpmiddleware"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+// SCIMPathPrefix is the path that the SCIM 2.0 API is served under.
+const SCIMPathPrefix = "/api/scim/v2"
+
+const (
+	scimUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSPConfigSchema     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimContentType     = "application/scim+json"
+	scimMaxResults      = 200
+	scimDefaultPageSize = 100
+	scimTokenValidity   = 10 * time.Minute
+)
+
+// scimFilterRegex matches the simple `attr eq "value"` filters that identity providers use to look up resources.
+var scimFilterRegex = regexp.MustCompile(`^\s*(\S+)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimError) Error() string {
+	return e.detail
+}
+
+func newSCIMError(code int, scimType string, format string, args ...interface{}) *scimError {
+	return &scimError{status: code, scimType: scimType, detail: fmt.Sprintf(format, args...)}
+}
+
+// scimErrorFromGRPC converts errors returned by the internal services into SCIM errors.
+func scimErrorFromGRPC(err error) *scimError {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return newSCIMError(http.StatusNotFound, "", "resource not found")
+	case codes.InvalidArgument:
+		return newSCIMError(http.StatusBadRequest, "invalidValue", "%s", status.Convert(err).Message())
+	case codes.AlreadyExists:
+		return newSCIMError(http.StatusConflict, "uniqueness", "%s", status.Convert(err).Message())
+	case codes.PermissionDenied:
+		return newSCIMError(http.StatusForbidden, "", "permission denied")
+	}
+	log.WithError(err).Error("Failed to handle SCIM request")
+	return newSCIMError(http.StatusInternalServerError, "", "internal error")
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+type scimName struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	Formatted  string `json:"formatted,omitempty"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimUser struct {
+	Schemas    []string    `json:"schemas"`
+	ID         string      `json:"id,omitempty"`
+	ExternalID string      `json:"externalId,omitempty"`
+	UserName   string      `json:"userName"`
+	Name       *scimName   `json:"name,omitempty"`
+	Emails     []scimEmail `json:"emails,omitempty"`
+	Active     *bool       `json:"active,omitempty"`
+	Meta       *scimMeta   `json:"meta,omitempty"`
+}
+
+// email returns the address that the user is identified by in Pixie.
+func (u *scimUser) email() string {
+	if u.UserName != "" {
+		return u.UserName
+	}
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+type scimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members,omitempty"`
+	Meta        *scimMeta    `json:"meta,omitempty"`
+}
+
+type scimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+type scimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []scimPatchOperation `json:"Operations"`
+}
+
+// scimRequest holds the state for a single authenticated SCIM request.
+type scimRequest struct {
+	env   apienv.APIEnv
+	ctx   context.Context
+	org   *profilepb.OrgInfo
+	orgID uuid.UUID
+}
+
+// SCIMHandler serves the SCIM 2.0 Users and Groups resources for an org. Requests are authenticated
+// with the org's SCIM token, which can be created with OrganizationService.CreateSCIMToken.
+// Each org is exposed as a single group, whose members are the users in the org.
+func SCIMHandler(env commonenv.Env, w http.ResponseWriter, r *http.Request) error {
+	apiEnv, ok := env.(apienv.APIEnv)
+	if !ok {
+		writeSCIMError(w, newSCIMError(http.StatusInternalServerError, "", "failed to get environment"))
+		return nil
+	}
+
+	req, err := newSCIMRequest(r.Context(), apiEnv, r)
+	if err != nil {
+		writeSCIMError(w, err)
+		return nil
+	}
+
+	var resp interface{}
+	respStatus := http.StatusOK
+	var handlerErr *scimError
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, SCIMPathPrefix), "/")
+	parts := strings.Split(path, "/")
+	resource, id := parts[0], ""
+	if len(parts) == 2 {
+		id = parts[1]
+	} else if len(parts) > 2 {
+		writeSCIMError(w, newSCIMError(http.StatusNotFound, "", "no such resource"))
+		return nil
+	}
+
+	switch {
+	case resource == "ServiceProviderConfig" && id == "" && r.Method == http.MethodGet:
+		resp = scimServiceProviderConfig()
+	case resource == "Users" && id == "" && r.Method == http.MethodGet:
+		resp, handlerErr = req.listUsers(r)
+	case resource == "Users" && id == "" && r.Method == http.MethodPost:
+		resp, handlerErr = req.createUser(r)
+		respStatus = http.StatusCreated
+	case resource == "Users" && id != "" && r.Method == http.MethodGet:
+		resp, handlerErr = req.getUser(id)
+	case resource == "Users" && id != "" && r.Method == http.MethodPut:
+		resp, handlerErr = req.replaceUser(id, r)
+	case resource == "Users" && id != "" && r.Method == http.MethodPatch:
+		resp, handlerErr = req.patchUser(id, r)
+	case resource == "Users" && id != "" && r.Method == http.MethodDelete:
+		handlerErr = req.deleteUser(id)
+		respStatus = http.StatusNoContent
+	case resource == "Groups" && id == "" && r.Method == http.MethodGet:
+		resp, handlerErr = req.listGroups(r)
+	case resource == "Groups" && id != "" && r.Method == http.MethodGet:
+		resp, handlerErr = req.getGroup(id)
+	case resource == "Groups" && id != "" && r.Method == http.MethodPatch:
+		resp, handlerErr = req.patchGroup(id, r)
+	case resource == "Groups":
+		// Groups map directly onto orgs, which can't be created, renamed or deleted through SCIM.
+		handlerErr = newSCIMError(http.StatusNotImplemented, "", "groups may only be read or have their members patched")
+	case resource == "Users" || resource == "ServiceProviderConfig":
+		handlerErr = newSCIMError(http.StatusMethodNotAllowed, "", "method not allowed")
+	default:
+		handlerErr = newSCIMError(http.StatusNotFound, "", "no such resource")
+	}
+
+	if handlerErr != nil {
+		writeSCIMError(w, handlerErr)
+		return nil
+	}
+	writeSCIMResponse(w, respStatus, resp)
+	return nil
+}
+
+func writeSCIMResponse(w http.ResponseWriter, code int, resp interface{}) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(code)
+	if resp == nil {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.WithError(err).Error("Failed to write SCIM response")
+	}
+}
+
+func writeSCIMError(w http.ResponseWriter, err *scimError) {
+	writeSCIMResponse(w, err.status, struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail"`
+	}{
+		Schemas:  []string{scimErrorSchema},
+		Status:   strconv.Itoa(err.status),
+		ScimType: err.scimType,
+		Detail:   err.detail,
+	})
+}
+
+// newSCIMRequest authenticates the request using the org's SCIM token and builds a context
+// that can be used to make requests to the profile and auth services on behalf of the org.
+func newSCIMRequest(ctx context.Context, env apienv.APIEnv, r *http.Request) (*scimRequest, *scimError) {
+	token, ok := httpmiddleware.GetTokenFromBearer(r)
+	if !ok || token == "" {
+		return nil, newSCIMError(http.StatusUnauthorized, "", "a SCIM bearer token is required")
+	}
+
+	svcClaims := srvutils.GenerateJWTForService("APIService", viper.GetString("domain_name"))
+	svcToken, err := srvutils.SignJWTClaims(svcClaims, env.JWTSigningKey())
+	if err != nil {
+		return nil, newSCIMError(http.StatusInternalServerError, "", "failed to generate auth token")
+	}
+	svcCtx := metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("bearer %s", svcToken))
+
+	org, err := env.OrgClient().GetOrgBySCIMToken(svcCtx, &profilepb.GetOrgBySCIMTokenRequest{Token: token})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, newSCIMError(http.StatusUnauthorized, "", "invalid SCIM bearer token")
+		}
+		return nil, scimErrorFromGRPC(err)
+	}
+	orgID := utils.UUIDFromProtoOrNil(org.ID)
+
+	// SCIM requests are made on behalf of the org rather than any user in it, so they
+	// are made as an API user without a backing user.
+	orgClaims := srvutils.GenerateJWTForAPIUser(uuid.Nil.String(), orgID.String(), time.Now().Add(scimTokenValidity), viper.GetString("domain_name"))
+	orgToken, err := srvutils.SignJWTClaims(orgClaims, env.JWTSigningKey())
+	if err != nil {
+		return nil, newSCIMError(http.StatusInternalServerError, "", "failed to generate auth token")
+	}
+
+	return &scimRequest{
+		env:   env,
+		ctx:   metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("bearer %s", orgToken)),
+		org:   org,
+		orgID: orgID,
+	}, nil
+}
+
+func scimServiceProviderConfig() interface{} {
+	supported := func(s bool) map[string]interface{} {
+		return map[string]interface{}{"supported": s}
+	}
+	return map[string]interface{}{
+		"schemas":        []string{scimSPConfigSchema},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]interface{}{
+			{
+				"type":        "oauthbearertoken",
+				"name":        "OAuth Bearer Token",
+				"description": "Authentication using the org's SCIM token.",
+				"primary":     true,
+			},
+		},
+	}
+}
+
+func scimLocation(resource string, id string) string {
+	return fmt.Sprintf("https://%s%s/%s/%s", viper.GetString("domain_name"), SCIMPathPrefix, resource, id)
+}
+
+func userInfoToSCIM(u *profilepb.UserInfo) *scimUser {
+	id := utils.ProtoToUUIDStr(u.ID)
+	active := u.IsApproved
+	return &scimUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       id,
+		UserName: u.Email,
+		Name: &scimName{
+			GivenName:  u.FirstName,
+			FamilyName: u.LastName,
+		},
+		Emails: []scimEmail{{Value: u.Email, Type: "work", Primary: true}},
+		Active: &active,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Location:     scimLocation("Users", id),
+		},
+	}
+}
+
+// parseSCIMFilter parses the filter query param into an attribute and value. Only simple
+// equality filters are supported.
+func parseSCIMFilter(r *http.Request) (string, string, *scimError) {
+	filter := r.URL.Query().Get("filter")
+	if filter == "" {
+		return "", "", nil
+	}
+	matches := scimFilterRegex.FindStringSubmatch(filter)
+	if matches == nil {
+		return "", "", newSCIMError(http.StatusBadRequest, "invalidFilter", "unsupported filter: %s", filter)
+	}
+	value := strings.ReplaceAll(matches[2], `\"`, `"`)
+	return matches[1], value, nil
+}
+
+// paginate applies the SCIM startIndex and count query params to the given resources.
+func paginate(r *http.Request, resources []interface{}) (*scimListResponse, *scimError) {
+	startIndex := 1
+	count := scimDefaultPageSize
+	if s := r.URL.Query().Get("startIndex"); s != "" {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, newSCIMError(http.StatusBadRequest, "invalidValue", "invalid startIndex")
+		}
+		// Per RFC 7644, values less than 1 are interpreted as 1.
+		if i > 1 {
+			startIndex = i
+		}
+	}
+	if c := r.URL.Query().Get("count"); c != "" {
+		i, err := strconv.Atoi(c)
+		if err != nil {
+			return nil, newSCIMError(http.StatusBadRequest, "invalidValue", "invalid count")
+		}
+		count = i
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxResults {
+		count = scimMaxResults
+	}
+
+	page := []interface{}{}
+	if startIndex-1 < len(resources) {
+		end := startIndex - 1 + count
+		if end > len(resources) {
+			end = len(resources)
+		}
+		page = resources[startIndex-1 : end]
+	}
+	return &scimListResponse{
+		Schemas:      []string{scimListResponseSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}, nil
+}
+
+func (s *scimRequest) usersInOrg() ([]*profilepb.UserInfo, *scimError) {
+	resp, err := s.env.OrgClient().GetUsersInOrg(s.ctx, &profilepb.GetUsersInOrgRequest{
+		OrgID: utils.ProtoFromUUID(s.orgID),
+	})
+	if err != nil {
+		return nil, scimErrorFromGRPC(err)
+	}
+	return resp.Users, nil
+}
+
+// getOrgUser fetches the user with the given ID, making sure that they belong to the org.
+func (s *scimRequest) getOrgUser(id string) (*profilepb.UserInfo, *scimError) {
+	userID := uuid.FromStringOrNil(id)
+	if userID == uuid.Nil {
+		return nil, newSCIMError(http.StatusNotFound, "", "no such user")
+	}
+	userInfo, err := s.env.ProfileClient().GetUser(s.ctx, utils.ProtoFromUUID(userID))
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, newSCIMError(http.StatusNotFound, "", "no such user")
+		}
+		return nil, scimErrorFromGRPC(err)
+	}
+	if userInfo == nil || utils.UUIDFromProtoOrNil(userInfo.OrgID) != s.orgID {
+		return nil, newSCIMError(http.StatusNotFound, "", "no such user")
+	}
+	return userInfo, nil
+}
+
+// checkCanDeactivate checks that users in the org can be deactivated. A user's approval is only checked when the
+// org requires approvals, so deactivating a user in any other org would leave them with access to the org.
+func (s *scimRequest) checkCanDeactivate() *scimError {
+	if !s.org.EnableApprovals {
+		return newSCIMError(http.StatusBadRequest, "invalidValue", "users can only be deactivated in orgs which require user approvals")
+	}
+	return nil
+}
+
+func (s *scimRequest) updateUser(req *profilepb.UpdateUserRequest) (*profilepb.UserInfo, *scimError) {
+	if req.IsApproved != nil && !req.IsApproved.Value {
+		if serr := s.checkCanDeactivate(); serr != nil {
+			return nil, serr
+		}
+	}
+	userInfo, err := s.env.ProfileClient().UpdateUser(s.ctx, req)
+	if err != nil {
+		return nil, scimErrorFromGRPC(err)
+	}
+	return userInfo, nil
+}
+
+func (s *scimRequest) listUsers(r *http.Request) (interface{}, *scimError) {
+	attr, value, serr := parseSCIMFilter(r)
+	if serr != nil {
+		return nil, serr
+	}
+	if attr != "" && attr != "userName" && attr != "emails.value" && attr != "id" {
+		return nil, newSCIMError(http.StatusBadRequest, "invalidFilter", "unsupported filter attribute: %s", attr)
+	}
+
+	users, serr := s.usersInOrg()
+	if serr != nil {
+		return nil, serr
+	}
+
+	resources := []interface{}{}
+	for _, u := range users {
+		switch attr {
+		case "userName", "emails.value":
+			if !strings.EqualFold(u.Email, value) {
+				continue
+			}
+		case "id":
+			if utils.ProtoToUUIDStr(u.ID) != value {
+				continue
+			}
+		}
+		resources = append(resources, userInfoToSCIM(u))
+	}
+	return paginate(r, resources)
+}
+
+func (s *scimRequest) getUser(id string) (interface{}, *scimError) {
+	userInfo, serr := s.getOrgUser(id)
+	if serr != nil {
+		return nil, serr
+	}
+	return userInfoToSCIM(userInfo), nil
+}
+
+func decodeSCIMBody(r *http.Request, v interface{}) *scimError {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return newSCIMError(http.StatusBadRequest, "invalidSyntax", "failed to parse request body")
+	}
+	return nil
+}
+
+func (s *scimRequest) createUser(r *http.Request) (interface{}, *scimError) {
+	var user scimUser
+	if serr := decodeSCIMBody(r, &user); serr != nil {
+		return nil, serr
+	}
+	email := strings.ToLower(user.email())
+	if email == "" {
+		return nil, newSCIMError(http.StatusBadRequest, "invalidValue", "userName must be specified")
+	}
+	if user.Active != nil && !*user.Active {
+		if serr := s.checkCanDeactivate(); serr != nil {
+			return nil, serr
+		}
+	}
+	var firstName, lastName string
+	if user.Name != nil {
+		firstName, lastName = user.Name.GivenName, user.Name.FamilyName
+	}
+
+	existing, err := s.env.ProfileClient().GetUserByEmail(s.ctx, &profilepb.GetUserByEmailRequest{Email: email})
+	switch {
+	case err == nil && utils.UUIDFromProtoOrNil(existing.OrgID) == s.orgID:
+		return nil, newSCIMError(http.StatusConflict, "uniqueness", "user %s already exists", email)
+	case err == nil:
+		// The user already has a Pixie account. It isn't adopted into the org, since the account's owner never
+		// agreed to join the org and the identity provider can't prove that it owns the account.
+		return nil, newSCIMError(http.StatusConflict, "uniqueness", "user %s already has an account", email)
+	case status.Code(err) == codes.NotFound:
+		_, err = s.env.AuthClient().InviteUser(s.ctx, &authpb.InviteUserRequest{
+			OrgID:     utils.ProtoFromUUID(s.orgID),
+			Email:     email,
+			FirstName: firstName,
+			LastName:  lastName,
+		})
+		if err != nil {
+			return nil, scimErrorFromGRPC(err)
+		}
+		existing, err = s.env.ProfileClient().GetUserByEmail(s.ctx, &profilepb.GetUserByEmailRequest{Email: email})
+		if err != nil {
+			return nil, scimErrorFromGRPC(err)
+		}
+	default:
+		return nil, scimErrorFromGRPC(err)
+	}
+
+	active := true
+	if user.Active != nil {
+		active = *user.Active
+	}
+	userInfo, serr := s.updateUser(&profilepb.UpdateUserRequest{
+		ID:         existing.ID,
+		FirstName:  &types.StringValue{Value: firstName},
+		LastName:   &types.StringValue{Value: lastName},
+		IsApproved: &types.BoolValue{Value: active},
+	})
+	if serr != nil {
+		return nil, serr
+	}
+	return userInfoToSCIM(userInfo), nil
+}
+
+func (s *scimRequest) replaceUser(id string, r *http.Request) (interface{}, *scimError) {
+	userInfo, serr := s.getOrgUser(id)
+	if serr != nil {
+		return nil, serr
+	}
+	var user scimUser
+	if serr := decodeSCIMBody(r, &user); serr != nil {
+		return nil, serr
+	}
+	if email := user.email(); email != "" && !strings.EqualFold(email, userInfo.Email) {
+		return nil, newSCIMError(http.StatusBadRequest, "mutability", "userName may not be changed")
+	}
+
+	req := &profilepb.UpdateUserRequest{
+		ID:        userInfo.ID,
+		FirstName: &types.StringValue{},
+		LastName:  &types.StringValue{},
+		// Per RFC 7643, an omitted active attribute is treated as true.
+		IsApproved: &types.BoolValue{Value: true},
+	}
+	if user.Name != nil {
+		req.FirstName.Value = user.Name.GivenName
+		req.LastName.Value = user.Name.FamilyName
+	}
+	if user.Active != nil {
+		req.IsApproved.Value = *user.Active
+	}
+	userInfo, serr = s.updateUser(req)
+	if serr != nil {
+		return nil, serr
+	}
+	return userInfoToSCIM(userInfo), nil
+}
+
+// parseSCIMBool parses a boolean patch value. Some identity providers send booleans as strings.
+func parseSCIMBool(raw json.RawMessage) (bool, *scimError) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, newSCIMError(http.StatusBadRequest, "invalidValue", "expected a boolean value")
+}
+
+func parseSCIMString(raw json.RawMessage) (string, *scimError) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", newSCIMError(http.StatusBadRequest, "invalidValue", "expected a string value")
+	}
+	return s, nil
+}
+
+// applyUserPatchValue applies a single attribute from a patch operation to the update request.
+func applyUserPatchValue(req *profilepb.UpdateUserRequest, path string, raw json.RawMessage) *scimError {
+	switch strings.ToLower(path) {
+	case "active":
+		b, serr := parseSCIMBool(raw)
+		if serr != nil {
+			return serr
+		}
+		req.IsApproved = &types.BoolValue{Value: b}
+	case "name.givenname":
+		v, serr := parseSCIMString(raw)
+		if serr != nil {
+			return serr
+		}
+		req.FirstName = &types.StringValue{Value: v}
+	case "name.familyname":
+		v, serr := parseSCIMString(raw)
+		if serr != nil {
+			return serr
+		}
+		req.LastName = &types.StringValue{Value: v}
+	case "name":
+		var name scimName
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return newSCIMError(http.StatusBadRequest, "invalidValue", "invalid name")
+		}
+		req.FirstName = &types.StringValue{Value: name.GivenName}
+		req.LastName = &types.StringValue{Value: name.FamilyName}
+	case "":
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &attrs); err != nil {
+			return newSCIMError(http.StatusBadRequest, "invalidValue", "expected an object value")
+		}
+		for k, v := range attrs {
+			if serr := applyUserPatchValue(req, k, v); serr != nil {
+				return serr
+			}
+		}
+	default:
+		// Attributes which Pixie doesn't track, such as externalId or title, are ignored.
+	}
+	return nil
+}
+
+func (s *scimRequest) patchUser(id string, r *http.Request) (interface{}, *scimError) {
+	userInfo, serr := s.getOrgUser(id)
+	if serr != nil {
+		return nil, serr
+	}
+	var patch scimPatchRequest
+	if serr := decodeSCIMBody(r, &patch); serr != nil {
+		return nil, serr
+	}
+
+	req := &profilepb.UpdateUserRequest{ID: userInfo.ID}
+	for _, op := range patch.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if serr := applyUserPatchValue(req, op.Path, op.Value); serr != nil {
+				return nil, serr
+			}
+		default:
+			return nil, newSCIMError(http.StatusBadRequest, "invalidValue", "unsupported patch operation: %s", op.Op)
+		}
+	}
+	userInfo, serr = s.updateUser(req)
+	if serr != nil {
+		return nil, serr
+	}
+	return userInfoToSCIM(userInfo), nil
+}
+
+// removeUserFromOrg removes the user from the org, which immediately revokes their access to it.
+func (s *scimRequest) removeUserFromOrg(userInfo *profilepb.UserInfo) *scimError {
+	_, serr := s.updateUser(&profilepb.UpdateUserRequest{
+		ID:    userInfo.ID,
+		OrgID: &uuidpb.UUID{},
+	})
+	return serr
+}
+
+func (s *scimRequest) deleteUser(id string) *scimError {
+	userInfo, serr := s.getOrgUser(id)
+	if serr != nil {
+		return serr
+	}
+	return s.removeUserFromOrg(userInfo)
+}
+
+func (s *scimRequest) orgGroup(includeMembers bool) (*scimGroup, *scimError) {
+	id := s.orgID.String()
+	group := &scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          id,
+		DisplayName: s.org.OrgName,
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Location:     scimLocation("Groups", id),
+		},
+	}
+	if !includeMembers {
+		return group, nil
+	}
+	users, serr := s.usersInOrg()
+	if serr != nil {
+		return nil, serr
+	}
+	for _, u := range users {
+		userID := utils.ProtoToUUIDStr(u.ID)
+		group.Members = append(group.Members, scimMember{
+			Value:   userID,
+			Display: u.Email,
+			Ref:     scimLocation("Users", userID),
+		})
+	}
+	return group, nil
+}
+
+func excludesMembers(r *http.Request) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.TrimSpace(attr) == "members" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scimRequest) listGroups(r *http.Request) (interface{}, *scimError) {
+	attr, value, serr := parseSCIMFilter(r)
+	if serr != nil {
+		return nil, serr
+	}
+	resources := []interface{}{}
+	switch attr {
+	case "":
+	case "displayName":
+		if value != s.org.OrgName {
+			return paginate(r, resources)
+		}
+	case "id":
+		if value != s.orgID.String() {
+			return paginate(r, resources)
+		}
+	default:
+		return nil, newSCIMError(http.StatusBadRequest, "invalidFilter", "unsupported filter attribute: %s", attr)
+	}
+
+	group, serr := s.orgGroup(!excludesMembers(r))
+	if serr != nil {
+		return nil, serr
+	}
+	resources = append(resources, group)
+	return paginate(r, resources)
+}
+
+func (s *scimRequest) getGroup(id string) (interface{}, *scimError) {
+	if uuid.FromStringOrNil(id) != s.orgID {
+		return nil, newSCIMError(http.StatusNotFound, "", "no such group")
+	}
+	return s.orgGroup(true)
+}
+
+// scimMemberPathRegex matches patch paths which remove a single member, such as `members[value eq "<id>"]`.
+var scimMemberPathRegex = regexp.MustCompile(`^members\[\s*value\s+(?i:eq)\s+"([^"]+)"\s*\]$`)
+
+func (s *scimRequest) addMember(userID string) *scimError {
+	userInfo, err := s.env.ProfileClient().GetUser(s.ctx, utils.ProtoFromUUIDStrOrNil(userID))
+	if err != nil {
+		return scimErrorFromGRPC(err)
+	}
+	switch utils.UUIDFromProtoOrNil(userInfo.OrgID) {
+	case s.orgID:
+		return nil
+	case uuid.Nil:
+		// As in createUser, existing accounts aren't adopted into the org.
+		return newSCIMError(http.StatusConflict, "uniqueness", "user %s already has an account", userID)
+	default:
+		return newSCIMError(http.StatusConflict, "uniqueness", "user %s belongs to another org", userID)
+	}
+}
+
+func (s *scimRequest) removeMember(userID string) *scimError {
+	userInfo, serr := s.getOrgUser(userID)
+	if serr != nil {
+		// Removing a user that isn't a member is a no-op.
+		if serr.status == http.StatusNotFound {
+			return nil
+		}
+		return serr
+	}
+	return s.removeUserFromOrg(userInfo)
+}
+
+func (s *scimRequest) patchGroup(id string, r *http.Request) (interface{}, *scimError) {
+	if uuid.FromStringOrNil(id) != s.orgID {
+		return nil, newSCIMError(http.StatusNotFound, "", "no such group")
+	}
+	var patch scimPatchRequest
+	if serr := decodeSCIMBody(r, &patch); serr != nil {
+		return nil, serr
+	}
+
+	for _, op := range patch.Operations {
+		opName := strings.ToLower(op.Op)
+		if opName == "remove" {
+			if m := scimMemberPathRegex.FindStringSubmatch(op.Path); m != nil {
+				if serr := s.removeMember(m[1]); serr != nil {
+					return nil, serr
+				}
+				continue
+			}
+		}
+		if !strings.EqualFold(op.Path, "members") {
+			return nil, newSCIMError(http.StatusBadRequest, "invalidPath", "only group members may be modified")
+		}
+		var members []scimMember
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return nil, newSCIMError(http.StatusBadRequest, "invalidValue", "invalid members")
+			}
+		}
+		for _, m := range members {
+			var serr *scimError
+			switch opName {
+			case "add":
+				serr = s.addMember(m.Value)
+			case "remove":
+				serr = s.removeMember(m.Value)
+			default:
+				serr = newSCIMError(http.StatusBadRequest, "invalidValue", "unsupported patch operation: %s", op.Op)
+			}
+			if serr != nil {
+				return nil, serr
+			}
+		}
+	}
+	return s.orgGroup(true)
+}
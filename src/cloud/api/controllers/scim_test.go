@@ -0,0 +1,361 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/api/controllers"
+	"px.dev/pixie/src/cloud/api/controllers/testutils"
+	"px.dev/pixie/src/cloud/auth/authpb"
+	"px.dev/pixie/src/cloud/profile/profilepb"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	scimTestOrgID  = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	scimTestUserID = "7ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	scimTestToken  = "scim-token"
+)
+
+func expectSCIMOrgLookup(mockClients *testutils.MockAPIClients) {
+	expectSCIMOrgLookupWithApprovals(mockClients, true)
+}
+
+func expectSCIMOrgLookupWithApprovals(mockClients *testutils.MockAPIClients, enableApprovals bool) {
+	mockClients.MockOrg.EXPECT().
+		GetOrgBySCIMToken(gomock.Any(), &profilepb.GetOrgBySCIMTokenRequest{Token: scimTestToken}).
+		Return(&profilepb.OrgInfo{
+			ID:              utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+			OrgName:         "my-org",
+			EnableApprovals: enableApprovals,
+		}, nil)
+}
+
+func serveSCIM(t *testing.T, method, path, body string, setup func(*testutils.MockAPIClients)) (int, map[string]interface{}) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+	setup(mockClients)
+
+	req, err := http.NewRequest(method, "https://withpixie.ai"+controllers.SCIMPathPrefix+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+scimTestToken)
+
+	rr := httptest.NewRecorder()
+	err = controllers.SCIMHandler(env, rr, req)
+	require.NoError(t, err)
+
+	var resp map[string]interface{}
+	if rr.Body.Len() > 0 {
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	}
+	return rr.Code, resp
+}
+
+func TestSCIMHandler_Unauthenticated(t *testing.T) {
+	env, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+	defer cleanup()
+
+	// No bearer token.
+	req, err := http.NewRequest("GET", "https://withpixie.ai/api/scim/v2/Users", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	require.NoError(t, controllers.SCIMHandler(env, rr, req))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// Unknown token.
+	mockClients.MockOrg.EXPECT().
+		GetOrgBySCIMToken(gomock.Any(), &profilepb.GetOrgBySCIMTokenRequest{Token: "bad-token"}).
+		Return(nil, status.Error(codes.NotFound, "no such SCIM token"))
+	req.Header.Set("Authorization", "Bearer bad-token")
+	rr = httptest.NewRecorder()
+	require.NoError(t, controllers.SCIMHandler(env, rr, req))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestSCIMHandler_ListUsersWithFilter(t *testing.T) {
+	code, resp := serveSCIM(t, "GET", `/Users?filter=userName+eq+%22b%40my-org.com%22`, "", func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookup(mockClients)
+		mockClients.MockOrg.EXPECT().
+			GetUsersInOrg(gomock.Any(), &profilepb.GetUsersInOrgRequest{
+				OrgID: utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+			}).
+			Return(&profilepb.GetUsersInOrgResponse{
+				Users: []*profilepb.UserInfo{
+					{
+						ID:         utils.ProtoFromUUIDStrOrNil("8ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+						OrgID:      utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+						Email:      "a@my-org.com",
+						IsApproved: true,
+					},
+					{
+						ID:         utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+						OrgID:      utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+						FirstName:  "first",
+						LastName:   "last",
+						Email:      "b@my-org.com",
+						IsApproved: true,
+					},
+				},
+			}, nil)
+	})
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, float64(1), resp["totalResults"])
+	resources := resp["Resources"].([]interface{})
+	require.Len(t, resources, 1)
+	user := resources[0].(map[string]interface{})
+	assert.Equal(t, scimTestUserID, user["id"])
+	assert.Equal(t, "b@my-org.com", user["userName"])
+	assert.Equal(t, true, user["active"])
+	assert.Equal(t, map[string]interface{}{"givenName": "first", "familyName": "last"}, user["name"])
+}
+
+func TestSCIMHandler_CreateUser(t *testing.T) {
+	body := `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "New@my-org.com",
+		"name": {"givenName": "new", "familyName": "user"},
+		"active": true
+	}`
+	code, resp := serveSCIM(t, "POST", "/Users", body, func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookup(mockClients)
+		gomock.InOrder(
+			mockClients.MockProfile.EXPECT().
+				GetUserByEmail(gomock.Any(), &profilepb.GetUserByEmailRequest{Email: "new@my-org.com"}).
+				Return(nil, status.Error(codes.NotFound, "no such user")),
+			mockClients.MockAuth.EXPECT().
+				InviteUser(gomock.Any(), &authpb.InviteUserRequest{
+					OrgID:     utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+					Email:     "new@my-org.com",
+					FirstName: "new",
+					LastName:  "user",
+				}).
+				Return(&authpb.InviteUserResponse{InviteLink: "link"}, nil),
+			mockClients.MockProfile.EXPECT().
+				GetUserByEmail(gomock.Any(), &profilepb.GetUserByEmailRequest{Email: "new@my-org.com"}).
+				Return(&profilepb.UserInfo{
+					ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+					OrgID: utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+					Email: "new@my-org.com",
+				}, nil),
+			mockClients.MockProfile.EXPECT().
+				UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
+					ID:         utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+					FirstName:  &types.StringValue{Value: "new"},
+					LastName:   &types.StringValue{Value: "user"},
+					IsApproved: &types.BoolValue{Value: true},
+				}).
+				Return(&profilepb.UserInfo{
+					ID:         utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+					OrgID:      utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+					FirstName:  "new",
+					LastName:   "user",
+					Email:      "new@my-org.com",
+					IsApproved: true,
+				}, nil),
+		)
+	})
+
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, scimTestUserID, resp["id"])
+	assert.Equal(t, "new@my-org.com", resp["userName"])
+}
+
+func TestSCIMHandler_CreateUserInOtherOrg(t *testing.T) {
+	code, resp := serveSCIM(t, "POST", "/Users", `{"userName": "taken@other-org.com"}`, func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookup(mockClients)
+		mockClients.MockProfile.EXPECT().
+			GetUserByEmail(gomock.Any(), &profilepb.GetUserByEmailRequest{Email: "taken@other-org.com"}).
+			Return(&profilepb.UserInfo{
+				ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				OrgID: utils.ProtoFromUUIDStrOrNil("9ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+				Email: "taken@other-org.com",
+			}, nil)
+	})
+
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "uniqueness", resp["scimType"])
+}
+
+func TestSCIMHandler_CreateUserWithExistingAccount(t *testing.T) {
+	code, resp := serveSCIM(t, "POST", "/Users", `{"userName": "existing@my-org.com"}`, func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookup(mockClients)
+		// The user has an account which doesn't belong to any org.
+		mockClients.MockProfile.EXPECT().
+			GetUserByEmail(gomock.Any(), &profilepb.GetUserByEmailRequest{Email: "existing@my-org.com"}).
+			Return(&profilepb.UserInfo{
+				ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				Email: "existing@my-org.com",
+			}, nil)
+	})
+
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "uniqueness", resp["scimType"])
+}
+
+func TestSCIMHandler_DeactivateUserWithoutApprovals(t *testing.T) {
+	body := `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "Replace", "path": "active", "value": false}]
+	}`
+	code, resp := serveSCIM(t, "PATCH", "/Users/"+scimTestUserID, body, func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookupWithApprovals(mockClients, false)
+		mockClients.MockProfile.EXPECT().
+			GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(scimTestUserID)).
+			Return(&profilepb.UserInfo{
+				ID:         utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				OrgID:      utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+				Email:      "user@my-org.com",
+				IsApproved: true,
+			}, nil)
+	})
+
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "invalidValue", resp["scimType"])
+}
+
+func TestSCIMHandler_DeactivateUser(t *testing.T) {
+	body := `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "Replace", "path": "active", "value": "False"}]
+	}`
+	code, resp := serveSCIM(t, "PATCH", "/Users/"+scimTestUserID, body, func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookup(mockClients)
+		mockClients.MockProfile.EXPECT().
+			GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(scimTestUserID)).
+			Return(&profilepb.UserInfo{
+				ID:         utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				OrgID:      utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+				Email:      "user@my-org.com",
+				IsApproved: true,
+			}, nil)
+		mockClients.MockProfile.EXPECT().
+			UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
+				ID:         utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				IsApproved: &types.BoolValue{Value: false},
+			}).
+			Return(&profilepb.UserInfo{
+				ID:         utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				OrgID:      utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+				Email:      "user@my-org.com",
+				IsApproved: false,
+			}, nil)
+	})
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, false, resp["active"])
+}
+
+func TestSCIMHandler_DeleteUser(t *testing.T) {
+	code, _ := serveSCIM(t, "DELETE", "/Users/"+scimTestUserID, "", func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookup(mockClients)
+		mockClients.MockProfile.EXPECT().
+			GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(scimTestUserID)).
+			Return(&profilepb.UserInfo{
+				ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				OrgID: utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+			}, nil)
+		mockClients.MockProfile.EXPECT().
+			UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
+				ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				OrgID: &uuidpb.UUID{},
+			}).
+			Return(&profilepb.UserInfo{ID: utils.ProtoFromUUIDStrOrNil(scimTestUserID)}, nil)
+	})
+
+	assert.Equal(t, http.StatusNoContent, code)
+}
+
+func TestSCIMHandler_GetUserInOtherOrg(t *testing.T) {
+	code, _ := serveSCIM(t, "GET", "/Users/"+scimTestUserID, "", func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookup(mockClients)
+		mockClients.MockProfile.EXPECT().
+			GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(scimTestUserID)).
+			Return(&profilepb.UserInfo{
+				ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				OrgID: utils.ProtoFromUUIDStrOrNil("9ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+			}, nil)
+	})
+
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestSCIMHandler_RemoveGroupMember(t *testing.T) {
+	body := `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "remove", "path": "members[value eq \"` + scimTestUserID + `\"]"}]
+	}`
+	code, resp := serveSCIM(t, "PATCH", "/Groups/"+scimTestOrgID, body, func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookup(mockClients)
+		mockClients.MockProfile.EXPECT().
+			GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(scimTestUserID)).
+			Return(&profilepb.UserInfo{
+				ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				OrgID: utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+			}, nil)
+		mockClients.MockProfile.EXPECT().
+			UpdateUser(gomock.Any(), &profilepb.UpdateUserRequest{
+				ID:    utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+				OrgID: &uuidpb.UUID{},
+			}).
+			Return(&profilepb.UserInfo{ID: utils.ProtoFromUUIDStrOrNil(scimTestUserID)}, nil)
+		mockClients.MockOrg.EXPECT().
+			GetUsersInOrg(gomock.Any(), &profilepb.GetUsersInOrgRequest{
+				OrgID: utils.ProtoFromUUIDStrOrNil(scimTestOrgID),
+			}).
+			Return(&profilepb.GetUsersInOrgResponse{}, nil)
+	})
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, scimTestOrgID, resp["id"])
+	assert.Equal(t, "my-org", resp["displayName"])
+	assert.Nil(t, resp["members"])
+}
+
+func TestSCIMHandler_AddGroupMemberWithExistingAccount(t *testing.T) {
+	body := `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "add", "path": "members", "value": [{"value": "` + scimTestUserID + `"}]}]
+	}`
+	code, resp := serveSCIM(t, "PATCH", "/Groups/"+scimTestOrgID, body, func(mockClients *testutils.MockAPIClients) {
+		expectSCIMOrgLookup(mockClients)
+		// The user has an account which doesn't belong to any org, so it must not be moved into the org.
+		mockClients.MockProfile.EXPECT().
+			GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(scimTestUserID)).
+			Return(&profilepb.UserInfo{
+				ID: utils.ProtoFromUUIDStrOrNil(scimTestUserID),
+			}, nil)
+	})
+
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "uniqueness", resp["scimType"])
+}
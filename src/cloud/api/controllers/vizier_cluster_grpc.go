@@ -26,6 +26,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/api/proto/uuidpb"
@@ -70,6 +71,14 @@ func (v *VizierClusterInfo) GetClusterInfo(ctx context.Context, request *cloudpb
 		return nil, err
 	}
 
+	selector := labels.Everything()
+	if request.Selector != "" {
+		selector, err = labels.Parse(request.Selector)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid label selector: %s", err.Error())
+		}
+	}
+
 	ctx, err = contextWithAuthToken(ctx)
 	if err != nil {
 		return nil, err
@@ -86,7 +95,7 @@ func (v *VizierClusterInfo) GetClusterInfo(ctx context.Context, request *cloudpb
 		vzIDs = viziers.VizierIDs
 	}
 
-	return v.getClusterInfoForViziers(ctx, vzIDs)
+	return v.getClusterInfoForViziers(ctx, vzIDs, selector)
 }
 
 func convertContainerState(cs metadatapb.ContainerState) cloudpb.ContainerState {
@@ -161,7 +170,7 @@ func convertPodStatuses(vzMgrStatuses map[string]*cvmsgspb.PodStatus) map[string
 	return podStatuses
 }
 
-func (v *VizierClusterInfo) getClusterInfoForViziers(ctx context.Context, ids []*uuidpb.UUID) (*cloudpb.GetClusterInfoResponse, error) {
+func (v *VizierClusterInfo) getClusterInfoForViziers(ctx context.Context, ids []*uuidpb.UUID, selector labels.Selector) (*cloudpb.GetClusterInfoResponse, error) {
 	resp := &cloudpb.GetClusterInfoResponse{}
 
 	cNames := make(map[string]int)
@@ -177,6 +186,9 @@ func (v *VizierClusterInfo) getClusterInfoForViziers(ctx context.Context, ids []
 		if vzInfo == nil || vzInfo.VizierID == nil {
 			continue
 		}
+		if !selector.Matches(labels.Set(vzInfo.Labels)) {
+			continue
+		}
 
 		s := vzStatusToClusterStatus(vzInfo.Status)
 		prevS := vzStatusToClusterStatus(vzInfo.PreviousStatus)
@@ -207,6 +219,7 @@ func (v *VizierClusterInfo) getClusterInfoForViziers(ctx context.Context, ids []
 			NumInstrumentedNodes:          vzInfo.NumInstrumentedNodes,
 			PreviousStatus:                prevS,
 			PreviousStatusTime:            vzInfo.PreviousStatusTime,
+			Labels:                        vzInfo.Labels,
 		})
 	}
 
@@ -280,6 +293,39 @@ func (v *VizierClusterInfo) UpdateOrInstallCluster(ctx context.Context, req *clo
 	}, nil
 }
 
+// GetClusterStatusHistory returns the status transitions of the given cluster.
+func (v *VizierClusterInfo) GetClusterStatusHistory(ctx context.Context, req *cloudpb.GetClusterStatusHistoryRequest) (*cloudpb.GetClusterStatusHistoryResponse, error) {
+	ctx, err := contextWithAuthToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.VzMgr.GetVizierStatusHistory(ctx, &vzmgrpb.GetVizierStatusHistoryRequest{
+		VizierID:  req.ID,
+		StartTime: req.StartTime,
+		Limit:     req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	transitions := make([]*cloudpb.ClusterStatusTransition, len(resp.Transitions))
+	for i, t := range resp.Transitions {
+		transitions[i] = &cloudpb.ClusterStatusTransition{
+			Time:                          t.Time,
+			Status:                        vzStatusToClusterStatus(t.Status),
+			PreviousStatus:                vzStatusToClusterStatus(t.PrevStatus),
+			StatusMessage:                 t.StatusMessage,
+			ControlPlanePodStatuses:       convertPodStatuses(t.ControlPlanePodStatuses),
+			UnhealthyDataPlanePodStatuses: convertPodStatuses(t.UnhealthyDataPlanePodStatuses),
+		}
+	}
+
+	return &cloudpb.GetClusterStatusHistoryResponse{
+		Transitions: transitions,
+	}, nil
+}
+
 func vzStatusToClusterStatus(s cvmsgspb.VizierStatus) cloudpb.ClusterStatus {
 	switch s {
 	case cvmsgspb.VZ_ST_HEALTHY:
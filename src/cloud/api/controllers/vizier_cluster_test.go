@@ -26,6 +26,8 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/api/proto/uuidpb"
@@ -353,6 +355,98 @@ func TestVizierClusterInfo_GetClusterInfoWithID(t *testing.T) {
 	}
 }
 
+func TestVizierClusterInfo_GetClusterInfoWithSelector(t *testing.T) {
+	orgID := utils.ProtoFromUUIDStrOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	clusterID := utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	clusterID2 := utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c9")
+
+	tests := []struct {
+		name        string
+		selector    string
+		expectedIDs []*uuidpb.UUID
+		expectErr   bool
+	}{
+		{
+			name:        "equality",
+			selector:    "env=prod",
+			expectedIDs: []*uuidpb.UUID{clusterID},
+		},
+		{
+			name:        "set",
+			selector:    "region in (eu, us)",
+			expectedIDs: []*uuidpb.UUID{clusterID, clusterID2},
+		},
+		{
+			name:        "no match",
+			selector:    "env=dev",
+			expectedIDs: nil,
+		},
+		{
+			name:      "invalid selector",
+			selector:  "env in (prod",
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+			defer cleanup()
+			ctx := CreateTestContext()
+
+			vzClusterInfoServer := &controllers.VizierClusterInfo{
+				VzMgr: mockClients.MockVzMgr,
+			}
+
+			if test.expectErr {
+				_, err := vzClusterInfoServer.GetClusterInfo(ctx, &cloudpb.GetClusterInfoRequest{
+					Selector: test.selector,
+				})
+				require.Error(t, err)
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+				return
+			}
+
+			mockClients.MockVzMgr.EXPECT().GetViziersByOrg(gomock.Any(), orgID).Return(&vzmgrpb.GetViziersByOrgResponse{
+				VizierIDs: []*uuidpb.UUID{clusterID, clusterID2},
+			}, nil)
+
+			mockClients.MockVzMgr.EXPECT().GetVizierInfos(gomock.Any(), &vzmgrpb.GetVizierInfosRequest{
+				VizierIDs: []*uuidpb.UUID{clusterID, clusterID2},
+			}).Return(&vzmgrpb.GetVizierInfosResponse{
+				VizierInfos: []*cvmsgspb.VizierInfo{
+					{
+						VizierID:    clusterID,
+						Status:      cvmsgspb.VZ_ST_HEALTHY,
+						ClusterName: "prod-cluster",
+						Labels:      map[string]string{"env": "prod", "region": "eu"},
+					},
+					{
+						VizierID:    clusterID2,
+						Status:      cvmsgspb.VZ_ST_HEALTHY,
+						ClusterName: "staging-cluster",
+						Labels:      map[string]string{"env": "staging", "region": "us"},
+					},
+				},
+			}, nil)
+
+			resp, err := vzClusterInfoServer.GetClusterInfo(ctx, &cloudpb.GetClusterInfoRequest{
+				Selector: test.selector,
+			})
+			require.NoError(t, err)
+
+			var ids []*uuidpb.UUID
+			for _, c := range resp.Clusters {
+				ids = append(ids, c.ID)
+			}
+			assert.Equal(t, test.expectedIDs, ids)
+		})
+	}
+}
+
 func TestVizierClusterInfo_UpdateClusterVizierConfig(t *testing.T) {
 	tests := []struct {
 		name string
@@ -452,3 +546,72 @@ func TestVizierClusterInfo_UpdateOrInstallCluster(t *testing.T) {
 		})
 	}
 }
+
+func TestVizierClusterInfo_GetClusterStatusHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{
+			name: "regular user",
+			ctx:  CreateTestContext(),
+		},
+		{
+			name: "api user",
+			ctx:  CreateAPIUserTestContext(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clusterID := utils.ProtoFromUUIDStrOrNil("7ba7b810-9dad-11d1-80b4-00c04fd430c8")
+			assert.NotNil(t, clusterID)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			_, mockClients, cleanup := testutils.CreateTestAPIEnv(t)
+			defer cleanup()
+			ctx := test.ctx
+
+			transitionTime := types.TimestampNow()
+			mockClients.MockVzMgr.EXPECT().GetVizierStatusHistory(gomock.Any(), &vzmgrpb.GetVizierStatusHistoryRequest{
+				VizierID: clusterID,
+				Limit:    10,
+			}).Return(&vzmgrpb.GetVizierStatusHistoryResponse{
+				Transitions: []*vzmgrpb.VizierStatusTransition{
+					{
+						Time:          transitionTime,
+						Status:        cvmsgspb.VZ_ST_DEGRADED,
+						PrevStatus:    cvmsgspb.VZ_ST_HEALTHY,
+						StatusMessage: "PEMs are failing",
+						UnhealthyDataPlanePodStatuses: map[string]*cvmsgspb.PodStatus{
+							"vizier-pem-abcd": {
+								Name:   "vizier-pem-abcd",
+								Status: metadatapb.FAILED,
+							},
+						},
+					},
+				},
+			}, nil)
+
+			vzClusterInfoServer := &controllers.VizierClusterInfo{
+				VzMgr: mockClients.MockVzMgr,
+			}
+
+			resp, err := vzClusterInfoServer.GetClusterStatusHistory(ctx, &cloudpb.GetClusterStatusHistoryRequest{
+				ID:    clusterID,
+				Limit: 10,
+			})
+			require.NoError(t, err)
+			require.Equal(t, 1, len(resp.Transitions))
+			transition := resp.Transitions[0]
+			assert.Equal(t, transitionTime, transition.Time)
+			assert.Equal(t, cloudpb.CS_DEGRADED, transition.Status)
+			assert.Equal(t, cloudpb.CS_HEALTHY, transition.PreviousStatus)
+			assert.Equal(t, "PEMs are failing", transition.StatusMessage)
+			assert.Equal(t, 0, len(transition.ControlPlanePodStatuses))
+			assert.Equal(t, cloudpb.FAILED, transition.UnhealthyDataPlanePodStatuses["vizier-pem-abcd"].Status)
+		})
+	}
+}
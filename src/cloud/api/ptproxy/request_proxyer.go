@@ -300,6 +300,66 @@ func (p *requestProxyer) processNatsMsg(msg *nats.Msg) error {
 			log.WithError(err).Error("Failed to send message")
 			return err
 		}
+	case *cvmsgspb.V2CAPIStreamResponse_ListQueriesResp:
+		err = p.srv.SendMsg(parsed.ListQueriesResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
+	case *cvmsgspb.V2CAPIStreamResponse_CancelQueryResp:
+		err = p.srv.SendMsg(parsed.CancelQueryResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
+	case *cvmsgspb.V2CAPIStreamResponse_QueryLogResp:
+		err = p.srv.SendMsg(parsed.QueryLogResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
+	case *cvmsgspb.V2CAPIStreamResponse_ListTracepointsResp:
+		err = p.srv.SendMsg(parsed.ListTracepointsResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
+	case *cvmsgspb.V2CAPIStreamResponse_DeleteTracepointResp:
+		err = p.srv.SendMsg(parsed.DeleteTracepointResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
+	case *cvmsgspb.V2CAPIStreamResponse_SetTracepointTTLResp:
+		err = p.srv.SendMsg(parsed.SetTracepointTTLResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
+	case *cvmsgspb.V2CAPIStreamResponse_UpdateAgentsConfigResp:
+		err = p.srv.SendMsg(parsed.UpdateAgentsConfigResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
+	case *cvmsgspb.V2CAPIStreamResponse_ListAgentConfigsResp:
+		err = p.srv.SendMsg(parsed.ListAgentConfigsResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
+	case *cvmsgspb.V2CAPIStreamResponse_DeleteAgentConfigResp:
+		err = p.srv.SendMsg(parsed.DeleteAgentConfigResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
+	case *cvmsgspb.V2CAPIStreamResponse_AgentEventsResp:
+		err = p.srv.SendMsg(parsed.AgentEventsResp)
+		if err != nil {
+			log.WithError(err).Error("Failed to send message")
+			return err
+		}
 	case *cvmsgspb.V2CAPIStreamResponse_Status:
 		// Status message come when the stream is closed.
 		if codes.Code(parsed.Status.Code) == codes.OK {
@@ -81,6 +81,176 @@ func (v *VizierPassThroughProxy) HealthCheck(req *vizierpb.HealthCheckRequest, s
 	return rp.Run()
 }
 
+// ListQueries is the GRPC stream method to list the queries running on vizier.
+func (v *VizierPassThroughProxy) ListQueries(req *vizierpb.ListQueriesRequest, srv vizierpb.VizierService_ListQueriesServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_ListQueriesReq{ListQueriesReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
+// CancelQuery is the GRPC stream method to cancel a query running on vizier.
+func (v *VizierPassThroughProxy) CancelQuery(req *vizierpb.CancelQueryRequest, srv vizierpb.VizierService_CancelQueryServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_CancelQueryReq{CancelQueryReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
+// GetQueryLog is the GRPC stream method to fetch the query log of vizier.
+func (v *VizierPassThroughProxy) GetQueryLog(req *vizierpb.GetQueryLogRequest, srv vizierpb.VizierService_GetQueryLogServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_QueryLogReq{QueryLogReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
+// ListTracepoints is the GRPC stream method to list the tracepoints deployed on vizier.
+func (v *VizierPassThroughProxy) ListTracepoints(req *vizierpb.ListTracepointsRequest, srv vizierpb.VizierService_ListTracepointsServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_ListTracepointsReq{ListTracepointsReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
+// DeleteTracepoint is the GRPC stream method to delete tracepoints from vizier.
+func (v *VizierPassThroughProxy) DeleteTracepoint(req *vizierpb.DeleteTracepointRequest, srv vizierpb.VizierService_DeleteTracepointServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_DeleteTracepointReq{DeleteTracepointReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
+// SetTracepointTTL is the GRPC stream method to extend the TTL of a tracepoint on vizier.
+func (v *VizierPassThroughProxy) SetTracepointTTL(req *vizierpb.SetTracepointTTLRequest, srv vizierpb.VizierService_SetTracepointTTLServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_SetTracepointTTLReq{SetTracepointTTLReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
+// UpdateAgentsConfig is the GRPC stream method to roll out a config update to the agents on vizier.
+func (v *VizierPassThroughProxy) UpdateAgentsConfig(req *vizierpb.UpdateAgentsConfigRequest, srv vizierpb.VizierService_UpdateAgentsConfigServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_UpdateAgentsConfigReq{UpdateAgentsConfigReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
+// ListAgentConfigs is the GRPC stream method to list the config settings persisted for the agents on vizier.
+func (v *VizierPassThroughProxy) ListAgentConfigs(req *vizierpb.ListAgentConfigsRequest, srv vizierpb.VizierService_ListAgentConfigsServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_ListAgentConfigsReq{ListAgentConfigsReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
+// DeleteAgentConfig is the GRPC stream method to remove a persisted config setting for the agents on vizier.
+func (v *VizierPassThroughProxy) DeleteAgentConfig(req *vizierpb.DeleteAgentConfigRequest, srv vizierpb.VizierService_DeleteAgentConfigServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_DeleteAgentConfigReq{DeleteAgentConfigReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
+// GetAgentEvents is the GRPC stream method to watch the lifecycle events of the agents on vizier.
+func (v *VizierPassThroughProxy) GetAgentEvents(req *vizierpb.GetAgentEventsRequest, srv vizierpb.VizierService_GetAgentEventsServer) error {
+	rp, err := newRequestProxyer(v.vc, v.nc, false, req, srv)
+	if err != nil {
+		return err
+	}
+	defer rp.Finish()
+
+	vizReq := rp.prepareVizierRequest()
+	vizReq.Msg = &cvmsgspb.C2VAPIStreamRequest_AgentEventsReq{AgentEventsReq: req}
+	if err := rp.sendMessageToVizier(vizReq); err != nil {
+		return err
+	}
+
+	return rp.Run()
+}
+
 // DebugLog is the GRPC stream method to fetch debug logs from vizier.
 func (v *VizierPassThroughProxy) DebugLog(req *vizierpb.DebugLogRequest, srv vizierpb.VizierDebugService_DebugLogServer) error {
 	rp, err := newRequestProxyer(v.vc, v.nc, true, req, srv)
@@ -575,11 +575,21 @@ func (s *Server) GetAugmentedTokenForAPIKey(ctx context.Context, in *authpb.GetA
 		fmt.Sprintf("bearer %s", svcClaims))
 
 	// Fetch org to validate it exists.
-	_, err = s.env.OrgClient().GetOrg(ctxWithSvcCreds, utils.ProtoFromUUID(orgID))
+	orgInfo, err := s.env.OrgClient().GetOrg(ctxWithSvcCreds, utils.ProtoFromUUID(orgID))
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to generate auth token")
 	}
 
+	// API keys belong to a user, so they should stop working as soon as the user is removed from
+	// the org, or deactivated in an org which requires approvals.
+	userInfo, err := s.env.ProfileClient().GetUser(ctxWithSvcCreds, utils.ProtoFromUUID(userID))
+	if err != nil || userInfo == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid API key")
+	}
+	if utils.UUIDFromProtoOrNil(userInfo.OrgID) != orgID || (orgInfo.EnableApprovals && !userInfo.IsApproved) {
+		return nil, status.Errorf(codes.Unauthenticated, "Invalid API key")
+	}
+
 	// Create JWT for user/org.
 	claims := srvutils.GenerateJWTForAPIUser(userID.String(), orgID.String(), time.Now().Add(AugmentedTokenValidDuration), viper.GetString("domain_name"))
 	token, err := srvutils.SignJWTClaims(claims, s.env.JWTSigningKey())
@@ -620,8 +630,10 @@ func (s *Server) GetAugmentedToken(
 		// If the OrgID is empty, we will approve the user but they will have low
 		// functionality in Pixie.
 		orgIDstr := aCtx.Claims.GetUserClaims().OrgID
+		var orgInfo *profilepb.OrgInfo
 		if uuid.FromStringOrNil(orgIDstr) != uuid.Nil {
-			_, err := s.env.OrgClient().GetOrg(ctx, utils.ProtoFromUUIDStrOrNil(orgIDstr))
+			var err error
+			orgInfo, err = s.env.OrgClient().GetOrg(ctx, utils.ProtoFromUUIDStrOrNil(orgIDstr))
 			if err != nil {
 				return nil, status.Error(codes.Unauthenticated, "Invalid auth/org")
 			}
@@ -637,6 +649,12 @@ func (s *Server) GetAugmentedToken(
 			if uuid.FromStringOrNil(orgIDstr) != utils.UUIDFromProtoOrNil(userInfo.OrgID) {
 				return nil, status.Error(codes.Unauthenticated, "Mismatched org")
 			}
+
+			// Approvals only apply if the org requires them, as in Login. In such orgs, users who are deactivated
+			// (for example, through SCIM provisioning) lose access to the org immediately.
+			if orgInfo != nil && orgInfo.EnableApprovals && !userInfo.IsApproved {
+				return nil, status.Error(codes.Unauthenticated, "User is not approved")
+			}
 		}
 	}
 
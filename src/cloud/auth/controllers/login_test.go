@@ -965,8 +965,9 @@ func TestServer_GetAugmentedToken(t *testing.T) {
 	mockProfile := mock_profile.NewMockProfileServiceClient(ctrl)
 	mockOrg := mock_profile.NewMockOrgServiceClient(ctrl)
 	mockUserInfo := &profilepb.UserInfo{
-		ID:    utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID),
-		OrgID: utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		ID:         utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID),
+		OrgID:      utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		IsApproved: true,
 	}
 	mockOrgInfo := &profilepb.OrgInfo{
 		ID: utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
@@ -1203,6 +1204,68 @@ func TestServer_GetAugmentedToken_MismatchedOrg(t *testing.T) {
 	assert.Equal(t, e.Code(), codes.Unauthenticated)
 }
 
+func TestServer_GetAugmentedToken_UnapprovedUser(t *testing.T) {
+	tests := []struct {
+		name            string
+		enableApprovals bool
+		expectedCode    codes.Code
+	}{
+		{
+			name:            "approvals enabled",
+			enableApprovals: true,
+			expectedCode:    codes.Unauthenticated,
+		},
+		{
+			// Approvals aren't checked for orgs that don't require them, as in Login.
+			name:            "approvals disabled",
+			enableApprovals: false,
+			expectedCode:    codes.OK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			a := mock_controllers.NewMockAuthProvider(ctrl)
+
+			mockProfile := mock_profile.NewMockProfileServiceClient(ctrl)
+			mockOrg := mock_profile.NewMockOrgServiceClient(ctrl)
+
+			mockUserInfo := &profilepb.UserInfo{
+				ID:         utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID),
+				OrgID:      utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+				IsApproved: false,
+			}
+			mockOrgInfo := &profilepb.OrgInfo{
+				ID:              utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+				EnableApprovals: test.enableApprovals,
+			}
+			mockProfile.EXPECT().
+				GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)).
+				Return(mockUserInfo, nil)
+			mockOrg.EXPECT().
+				GetOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID)).
+				Return(mockOrgInfo, nil)
+
+			viper.Set("jwt_signing_key", "jwtkey")
+			viper.Set("domain_name", "withpixie.ai")
+
+			env, err := authenv.New(mockProfile, mockOrg)
+			require.NoError(t, err)
+			s, err := controllers.NewServer(env, a, nil)
+			require.NoError(t, err)
+
+			claims := testingutils.GenerateTestClaims(t)
+			token := testingutils.SignPBClaims(t, claims, "jwtkey")
+			req := &authpb.GetAugmentedAuthTokenRequest{
+				Token: token,
+			}
+			_, err = s.GetAugmentedToken(context.Background(), req)
+			assert.Equal(t, test.expectedCode, status.Code(err))
+		})
+	}
+}
+
 func TestServer_GetAugmentedTokenBadSigningKey(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	a := mock_controllers.NewMockAuthProvider(ctrl)
@@ -1324,6 +1387,13 @@ func TestServer_GetAugmentedTokenFromAPIKey(t *testing.T) {
 	mockOrg.EXPECT().
 		GetOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID)).
 		Return(mockOrgInfo, nil)
+	mockProfile.EXPECT().
+		GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)).
+		Return(&profilepb.UserInfo{
+			ID:         utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID),
+			OrgID:      utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+			IsApproved: true,
+		}, nil)
 
 	viper.Set("jwt_signing_key", "jwtkey")
 	viper.Set("domain_name", "withpixie.ai")
@@ -1355,6 +1425,42 @@ func TestServer_GetAugmentedTokenFromAPIKey(t *testing.T) {
 	assert.True(t, srvutils.GetIsAPIUser(parsed))
 }
 
+func TestServer_GetAugmentedTokenFromAPIKey_RemovedUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	a := mock_controllers.NewMockAuthProvider(ctrl)
+	apiKeyServer := mock_controllers.NewMockAPIKeyMgr(ctrl)
+	apiKeyServer.EXPECT().FetchOrgUserIDUsingAPIKey(gomock.Any(), "test_api").Return(uuid.FromStringOrNil(testingutils.TestOrgID), uuid.FromStringOrNil(testingutils.TestUserID), nil)
+
+	mockProfile := mock_profile.NewMockProfileServiceClient(ctrl)
+	mockOrg := mock_profile.NewMockOrgServiceClient(ctrl)
+	mockOrg.EXPECT().
+		GetOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID)).
+		Return(&profilepb.OrgInfo{
+			ID: utils.ProtoFromUUIDStrOrNil(testingutils.TestOrgID),
+		}, nil)
+	// The user has been removed from the org since the API key was created.
+	mockProfile.EXPECT().
+		GetUser(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID)).
+		Return(&profilepb.UserInfo{
+			ID:         utils.ProtoFromUUIDStrOrNil(testingutils.TestUserID),
+			IsApproved: true,
+		}, nil)
+
+	viper.Set("jwt_signing_key", "jwtkey")
+	viper.Set("domain_name", "withpixie.ai")
+
+	env, err := authenv.New(mockProfile, mockOrg)
+	require.NoError(t, err)
+	s, err := controllers.NewServer(env, a, apiKeyServer)
+	require.NoError(t, err)
+
+	resp, err := s.GetAugmentedTokenForAPIKey(context.Background(), &authpb.GetAugmentedTokenForAPIKeyRequest{
+		APIKey: "test_api",
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
 func TestServer_Signup_LookupHostedDomain(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
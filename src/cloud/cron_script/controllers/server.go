@@ -36,9 +36,12 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/cron_script/cronscriptpb"
+	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/messagespb"
 	"px.dev/pixie/src/cloud/shared/vzshard"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	"px.dev/pixie/src/shared/cvmsgs"
@@ -93,19 +96,30 @@ func (s *Server) Stop() {
 
 // CronScript contains metadata about a regularly scheduled script.
 type CronScript struct {
-	ID         uuid.UUID  `db:"id"`
-	OrgID      uuid.UUID  `db:"org_id"`
-	Script     string     `db:"script"`
-	ClusterIDs ClusterIDs `db:"cluster_ids"`
-	ConfigStr  string     `db:"configs"`
-	Enabled    bool       `db:"enabled"`
-	FrequencyS int64      `db:"frequency_s"`
+	ID              uuid.UUID  `db:"id"`
+	OrgID           uuid.UUID  `db:"org_id"`
+	Script          string     `db:"script"`
+	ClusterIDs      ClusterIDs `db:"cluster_ids"`
+	ClusterSelector string     `db:"cluster_selector"`
+	ConfigStr       string     `db:"configs"`
+	Enabled         bool       `db:"enabled"`
+	FrequencyS      int64      `db:"frequency_s"`
+}
+
+// parseClusterSelector parses the label selector that restricts which clusters a script runs on.
+// An empty selector matches all clusters.
+func parseClusterSelector(selector string) (labels.Selector, error) {
+	if selector == "" {
+		return labels.Everything(), nil
+	}
+	return labels.Parse(selector)
 }
 
 func (s *Server) handleRequests() {
 	for _, shard := range vzshard.GenerateShardRange() {
 		s.startShardedHandler(shard, cvmsgs.CronScriptChecksumRequestChannel, s.HandleChecksumRequest)
 		s.startShardedHandler(shard, cvmsgs.GetCronScriptsRequestChannel, s.HandleScriptsRequest)
+		s.startShardedHandler(shard, cvmsgs.CronScriptExecutionErrorChannel, s.HandleExecutionError)
 	}
 }
 
@@ -185,10 +199,8 @@ func (s *Server) HandleChecksumRequest(msg *cvmsgspb.V2CMessage) {
 	}
 }
 
-func (s *Server) fetchScriptsForVizier(vizierID *uuidpb.UUID) (map[string]*cvmsgspb.CronScript, error) {
-	vizierUUID := utils.UUIDFromProtoOrNil(vizierID)
-
-	// Find org associated with this Vizier.
+// getOrgForVizier finds the org associated with the given Vizier.
+func (s *Server) getOrgForVizier(vizierID *uuidpb.UUID) (*uuidpb.UUID, error) {
 	claims := jwtutils.GenerateJWTForService("vzmgr Service", viper.GetString("domain_name"))
 	token, err := jwtutils.SignJWTClaims(claims, viper.GetString("jwt_signing_key"))
 	if err != nil {
@@ -202,28 +214,42 @@ func (s *Server) fetchScriptsForVizier(vizierID *uuidpb.UUID) (map[string]*cvmsg
 		log.WithError(err).Error("Could not find Vizier for org")
 		return nil, err
 	}
+	return resp.OrgID, nil
+}
+
+func (s *Server) fetchScriptsForVizier(vizierID *uuidpb.UUID) (map[string]*cvmsgspb.CronScript, error) {
+	vizierUUID := utils.UUIDFromProtoOrNil(vizierID)
+
+	// Find org associated with this Vizier.
+	orgID, err := s.getOrgForVizier(vizierID)
+	if err != nil {
+		return nil, err
+	}
+	orgUUID := utils.UUIDFromProtoOrNil(orgID)
 
 	// Fetch all scripts registered to this Vizier.
-	query := `SELECT id, script, cluster_ids, PGP_SYM_DECRYPT(configs, $1::text) as configs, frequency_s FROM cron_scripts WHERE org_id=$2 AND enabled=true`
-	rows, err := s.db.Queryx(query, s.dbKey, utils.UUIDFromProtoOrNil(resp.OrgID))
+	query := `SELECT id, script, cluster_ids, cluster_selector, PGP_SYM_DECRYPT(configs, $1::text) as configs, frequency_s FROM cron_scripts WHERE org_id=$2 AND enabled=true`
+	rows, err := s.db.Queryx(query, s.dbKey, orgUUID)
 	if err != nil {
 		log.WithError(err).Error("Could not fetch scripts for org")
 		return nil, err
 	}
 	defer rows.Close()
 
+	// The Vizier's labels are only fetched if one of the scripts specifies a cluster selector.
+	var vzLabels labels.Set
 	scriptsMap := make(map[string]*cvmsgspb.CronScript)
 	for rows.Next() {
-		var s CronScript
-		err = rows.StructScan(&s)
+		var script CronScript
+		err = rows.StructScan(&script)
 		if err != nil {
 			continue
 		}
 		// If no cluster IDs are specified, script is registered to all orgs.
 		// Otherwise, we should check if this cluster is in the list of clusters.
-		if len(s.ClusterIDs) != 0 {
+		if len(script.ClusterIDs) != 0 {
 			found := false
-			for _, c := range s.ClusterIDs {
+			for _, c := range script.ClusterIDs {
 				if c == vizierUUID {
 					found = true
 				}
@@ -232,16 +258,57 @@ func (s *Server) fetchScriptsForVizier(vizierID *uuidpb.UUID) (map[string]*cvmsg
 				continue
 			}
 		}
-		scriptsMap[s.ID.String()] = &cvmsgspb.CronScript{
-			ID:         utils.ProtoFromUUID(s.ID),
-			Script:     s.Script,
-			Configs:    s.ConfigStr,
-			FrequencyS: s.FrequencyS,
+		// If a cluster selector is specified, the cluster's labels must also match the selector.
+		if script.ClusterSelector != "" {
+			selector, err := parseClusterSelector(script.ClusterSelector)
+			if err != nil {
+				log.WithError(err).WithField("scriptID", script.ID).Error("Invalid cluster selector for cron script")
+				continue
+			}
+			if vzLabels == nil {
+				vzLabels, err = s.getVizierLabels(orgUUID, vizierID)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if !selector.Matches(vzLabels) {
+				continue
+			}
+		}
+		scriptsMap[script.ID.String()] = &cvmsgspb.CronScript{
+			ID:         utils.ProtoFromUUID(script.ID),
+			Script:     script.Script,
+			Configs:    script.ConfigStr,
+			FrequencyS: script.FrequencyS,
 		}
 	}
 	return scriptsMap, nil
 }
 
+// getVizierLabels fetches the labels attached to the given Vizier's cluster.
+func (s *Server) getVizierLabels(orgID uuid.UUID, vizierID *uuidpb.UUID) (labels.Set, error) {
+	ctx, err := orgContext(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.vzmgrClient.GetVizierInfos(ctx, &vzmgrpb.GetVizierInfosRequest{
+		VizierIDs: []*uuidpb.UUID{vizierID},
+	})
+	if err != nil {
+		log.WithError(err).Error("Could not fetch info for Vizier")
+		return nil, err
+	}
+
+	vzLabels := labels.Set{}
+	if len(resp.VizierInfos) > 0 && resp.VizierInfos[0] != nil {
+		for k, v := range resp.VizierInfos[0].Labels {
+			vzLabels[k] = v
+		}
+	}
+	return vzLabels, nil
+}
+
 // HandleScriptsRequest handles incoming requests for cron scripts registered to the given vizier.
 func (s *Server) HandleScriptsRequest(msg *cvmsgspb.V2CMessage) {
 	anyMsg := msg.Msg
@@ -283,6 +350,51 @@ func (s *Server) HandleScriptsRequest(msg *cvmsgspb.V2CMessage) {
 	}
 }
 
+// HandleExecutionError handles cron script execution errors reported by a Vizier, and forwards them to
+// the notification service so that the org can be notified.
+func (s *Server) HandleExecutionError(msg *cvmsgspb.V2CMessage) {
+	req := &cvmsgspb.CronScriptExecutionError{}
+	err := types.UnmarshalAny(msg.Msg, req)
+	if err != nil {
+		log.WithError(err).Error("Could not unmarshal NATS message")
+		return
+	}
+
+	vizierID := utils.ProtoFromUUIDStrOrNil(msg.VizierID)
+	orgID, err := s.getOrgForVizier(vizierID)
+	if err != nil {
+		log.WithError(err).Error("Failed to fetch org for Vizier")
+		return
+	}
+
+	scriptID := utils.UUIDFromProtoOrNil(req.ScriptID)
+	ev := &messagespb.NotificationEvent{
+		ID:       utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+		OrgID:    orgID,
+		VizierID: vizierID,
+		Type:     messagespb.NE_CRON_SCRIPT_FAILED,
+		Time:     types.TimestampNow(),
+		Message:  fmt.Sprintf("Cron script %s failed to execute: %s", scriptID.String(), req.ErrorMessage),
+		Details: map[string]string{
+			"script_id": scriptID.String(),
+			"error":     req.ErrorMessage,
+		},
+	}
+	if req.Timestamp != nil {
+		ev.Time = req.Timestamp
+	}
+
+	b, err := ev.Marshal()
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal notification event")
+		return
+	}
+	err = s.nc.Publish(messages.NotificationEventChannel, b)
+	if err != nil {
+		log.WithError(err).Error("Failed to publish notification event")
+	}
+}
+
 // GetScript gets a script stored in the cron script service.
 func (s *Server) GetScript(ctx context.Context, req *cronscriptpb.GetScriptRequest) (*cronscriptpb.GetScriptResponse, error) {
 	sCtx, err := authcontext.FromContext(ctx)
@@ -292,7 +404,7 @@ func (s *Server) GetScript(ctx context.Context, req *cronscriptpb.GetScriptReque
 	claimsOrgID := uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID)
 	scriptID := utils.UUIDFromProtoOrNil(req.ID)
 
-	query := `SELECT id, org_id, script, cluster_ids, PGP_SYM_DECRYPT(configs, $1::text) as configs, enabled, frequency_s FROM cron_scripts WHERE org_id=$2 AND id=$3`
+	query := `SELECT id, org_id, script, cluster_ids, cluster_selector, PGP_SYM_DECRYPT(configs, $1::text) as configs, enabled, frequency_s FROM cron_scripts WHERE org_id=$2 AND id=$3`
 	rows, err := s.db.Queryx(query, s.dbKey, claimsOrgID, scriptID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to fetch cron script")
@@ -315,13 +427,14 @@ func (s *Server) GetScript(ctx context.Context, req *cronscriptpb.GetScriptReque
 
 	return &cronscriptpb.GetScriptResponse{
 		Script: &cronscriptpb.CronScript{
-			ID:         req.ID,
-			OrgID:      utils.ProtoFromUUID(claimsOrgID),
-			Script:     script.Script,
-			ClusterIDs: clusterIDs,
-			Configs:    script.ConfigStr,
-			Enabled:    script.Enabled,
-			FrequencyS: script.FrequencyS,
+			ID:              req.ID,
+			OrgID:           utils.ProtoFromUUID(claimsOrgID),
+			Script:          script.Script,
+			ClusterIDs:      clusterIDs,
+			ClusterSelector: script.ClusterSelector,
+			Configs:         script.ConfigStr,
+			Enabled:         script.Enabled,
+			FrequencyS:      script.FrequencyS,
 		},
 	}, nil
 }
@@ -338,7 +451,7 @@ func (s *Server) GetScripts(ctx context.Context, req *cronscriptpb.GetScriptsReq
 		ids[i] = utils.UUIDFromProtoOrNil(id)
 	}
 
-	strQuery := `SELECT id, org_id, script, cluster_ids, PGP_SYM_DECRYPT(configs, '%s'::text) as configs, enabled, frequency_s FROM cron_scripts WHERE org_id='%s' AND id IN (?)`
+	strQuery := `SELECT id, org_id, script, cluster_ids, cluster_selector, PGP_SYM_DECRYPT(configs, '%s'::text) as configs, enabled, frequency_s FROM cron_scripts WHERE org_id='%s' AND id IN (?)`
 	strQuery = fmt.Sprintf(strQuery, s.dbKey, sCtx.Claims.GetUserClaims().OrgID)
 
 	query, args, err := sqlx.In(strQuery, ids)
@@ -367,13 +480,14 @@ func (s *Server) GetScripts(ctx context.Context, req *cronscriptpb.GetScriptsReq
 		}
 
 		cpb := &cronscriptpb.CronScript{
-			ID:         utils.ProtoFromUUID(p.ID),
-			OrgID:      utils.ProtoFromUUID(p.OrgID),
-			Script:     p.Script,
-			ClusterIDs: clusterIDs,
-			Configs:    p.ConfigStr,
-			Enabled:    p.Enabled,
-			FrequencyS: p.FrequencyS,
+			ID:              utils.ProtoFromUUID(p.ID),
+			OrgID:           utils.ProtoFromUUID(p.OrgID),
+			Script:          p.Script,
+			ClusterIDs:      clusterIDs,
+			ClusterSelector: p.ClusterSelector,
+			Configs:         p.ConfigStr,
+			Enabled:         p.Enabled,
+			FrequencyS:      p.FrequencyS,
 		}
 		scripts = append(scripts, cpb)
 	}
@@ -390,13 +504,18 @@ func (s *Server) CreateScript(ctx context.Context, req *cronscriptpb.CreateScrip
 	}
 	claimsOrgID := uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID)
 
+	selector, err := parseClusterSelector(req.ClusterSelector)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid cluster selector: %s", err.Error())
+	}
+
 	clusterIDs := make([]uuid.UUID, len(req.ClusterIDs))
 	for i, c := range req.ClusterIDs {
 		clusterIDs[i] = utils.UUIDFromProtoOrNil(c)
 	}
 
-	query := `INSERT INTO cron_scripts(org_id, script, cluster_ids, configs, enabled, frequency_s) VALUES ($1, $2, $3, PGP_SYM_ENCRYPT($4, $5), $6, $7) RETURNING id`
-	rows, err := s.db.Queryx(query, claimsOrgID, req.Script, ClusterIDs(clusterIDs), req.Configs, s.dbKey, !req.Disabled, req.FrequencyS)
+	query := `INSERT INTO cron_scripts(org_id, script, cluster_ids, cluster_selector, configs, enabled, frequency_s) VALUES ($1, $2, $3, $4, PGP_SYM_ENCRYPT($5, $6), $7, $8) RETURNING id`
+	rows, err := s.db.Queryx(query, claimsOrgID, req.Script, ClusterIDs(clusterIDs), req.ClusterSelector, req.Configs, s.dbKey, !req.Disabled, req.FrequencyS)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to create cron script")
 	}
@@ -425,7 +544,7 @@ func (s *Server) CreateScript(ctx context.Context, req *cronscriptpb.CreateScrip
 					},
 				},
 			},
-		}, claimsOrgID, req.ClusterIDs)
+		}, claimsOrgID, req.ClusterIDs, selector)
 	}
 
 	return &cronscriptpb.CreateScriptResponse{ID: idPb}, nil
@@ -440,7 +559,7 @@ func (s *Server) UpdateScript(ctx context.Context, req *cronscriptpb.UpdateScrip
 	claimsOrgID := uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID)
 	scriptID := utils.UUIDFromProtoOrNil(req.ScriptId)
 
-	query := `SELECT id, org_id, script, cluster_ids, PGP_SYM_DECRYPT(configs, $1::text) as configs, enabled, frequency_s FROM cron_scripts WHERE org_id=$2 AND id=$3`
+	query := `SELECT id, org_id, script, cluster_ids, cluster_selector, PGP_SYM_DECRYPT(configs, $1::text) as configs, enabled, frequency_s FROM cron_scripts WHERE org_id=$2 AND id=$3`
 	rows, err := s.db.Queryx(query, s.dbKey, claimsOrgID, scriptID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to fetch cron script")
@@ -484,8 +603,17 @@ func (s *Server) UpdateScript(ctx context.Context, req *cronscriptpb.UpdateScrip
 		}
 	}
 
-	query = `UPDATE cron_scripts SET script = $1, configs = PGP_SYM_ENCRYPT($2, $3), enabled = $4, frequency_s = $5, cluster_ids=$6 WHERE id = $7`
-	_, err = s.db.Exec(query, contents, configs, s.dbKey, enabled, freq, ClusterIDs(clusterIDs), scriptID)
+	clusterSelector := script.ClusterSelector
+	if req.ClusterSelector != nil {
+		clusterSelector = req.ClusterSelector.Value
+	}
+	selector, err := parseClusterSelector(clusterSelector)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid cluster selector: %s", err.Error())
+	}
+
+	query = `UPDATE cron_scripts SET script = $1, configs = PGP_SYM_ENCRYPT($2, $3), enabled = $4, frequency_s = $5, cluster_ids=$6, cluster_selector=$7 WHERE id = $8`
+	_, err = s.db.Exec(query, contents, configs, s.dbKey, enabled, freq, ClusterIDs(clusterIDs), clusterSelector, scriptID)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "Failed to update cron script")
 	}
@@ -500,14 +628,15 @@ func (s *Server) UpdateScript(ctx context.Context, req *cronscriptpb.UpdateScrip
 		newClusterIDs[i] = utils.ProtoFromUUID(c)
 	}
 
-	// Delete from previous viziers.
+	// Delete from previous viziers. The selector isn't applied, since the viziers' labels may have changed since
+	// the script was registered.
 	s.sendCronScriptUpdateToViziers(&cvmsgspb.CronScriptUpdate{
 		Msg: &cvmsgspb.CronScriptUpdate_DeleteReq{
 			DeleteReq: &cvmsgspb.DeleteCronScriptRequest{
 				ScriptID: req.ScriptId,
 			},
 		},
-	}, claimsOrgID, prevClusterIDs)
+	}, claimsOrgID, prevClusterIDs, labels.Everything())
 
 	if enabled {
 		s.sendCronScriptUpdateToViziers(&cvmsgspb.CronScriptUpdate{
@@ -521,7 +650,7 @@ func (s *Server) UpdateScript(ctx context.Context, req *cronscriptpb.UpdateScrip
 					},
 				},
 			},
-		}, claimsOrgID, newClusterIDs)
+		}, claimsOrgID, newClusterIDs, selector)
 	}
 
 	return &cronscriptpb.UpdateScriptResponse{}, nil
@@ -567,12 +696,25 @@ func (s *Server) DeleteScript(ctx context.Context, req *cronscriptpb.DeleteScrip
 				ScriptID: req.ID,
 			},
 		},
-	}, claimsOrgID, clusterIDProtos)
+	}, claimsOrgID, clusterIDProtos, labels.Everything())
 
 	return &cronscriptpb.DeleteScriptResponse{}, nil
 }
 
-func (s *Server) sendCronScriptUpdateToViziers(msg *cvmsgspb.CronScriptUpdate, orgID uuid.UUID, clusterIDs []*uuidpb.UUID) {
+// orgContext returns a context which is authorized to make requests on behalf of the given org.
+func orgContext(orgID uuid.UUID) (context.Context, error) {
+	svcJWT := jwtutils.GenerateJWTForAPIUser("", orgID.String(), time.Now().Add(time.Minute*10), viper.GetString("domain_name"))
+	svcClaims, err := jwtutils.SignJWTClaims(svcJWT, viper.GetString("jwt_signing_key"))
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization",
+		fmt.Sprintf("bearer %s", svcClaims)), nil
+}
+
+// sendCronScriptUpdateToViziers sends the update to the given Viziers, or all Viziers in the org if no clusterIDs are
+// specified. If a selector is specified, the update is only sent to Viziers whose labels match the selector.
+func (s *Server) sendCronScriptUpdateToViziers(msg *cvmsgspb.CronScriptUpdate, orgID uuid.UUID, clusterIDs []*uuidpb.UUID, selector labels.Selector) {
 	msg.RequestID = uuid.Must(uuid.NewV4()).String()
 	msg.Timestamp = time.Now().UnixNano()
 
@@ -586,14 +728,11 @@ func (s *Server) sendCronScriptUpdateToViziers(msg *cvmsgspb.CronScriptUpdate, o
 	}
 
 	// Get healthy viziers for org.
-	svcJWT := jwtutils.GenerateJWTForAPIUser("", orgID.String(), time.Now().Add(time.Minute*10), viper.GetString("domain_name"))
-	svcClaims, err := jwtutils.SignJWTClaims(svcJWT, viper.GetString("jwt_signing_key"))
+	ctx, err := orgContext(orgID)
 	if err != nil {
 		log.WithError(err).Error("Failed to sign claims")
 		return
 	}
-	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization",
-		fmt.Sprintf("bearer %s", svcClaims))
 
 	if len(clusterIDs) == 0 { // If no clusterIDs specified, this message should be sent to all Viziers in the org.
 		viziers, err := s.vzmgrClient.GetViziersByOrg(ctx, utils.ProtoFromUUID(orgID))
@@ -613,6 +752,9 @@ func (s *Server) sendCronScriptUpdateToViziers(msg *cvmsgspb.CronScriptUpdate, o
 	}
 
 	for _, v := range vzInfoResp.VizierInfos {
+		if !selector.Matches(labels.Set(v.Labels)) {
+			continue
+		}
 		vzUUID := utils.UUIDFromProtoOrNil(v.VizierID)
 		if v.Status != cvmsgspb.VZ_ST_DISCONNECTED && v.Status != cvmsgspb.VZ_ST_UNKNOWN {
 			go s.retryMessageUntilResponse(c2vMsg, vzshard.C2VTopic(cvmsgs.CronScriptUpdatesChannel, vzUUID), vzshard.V2CTopic(fmt.Sprintf("%s:%s", cvmsgs.CronScriptUpdatesResponseChannel, msg.RequestID), vzUUID))
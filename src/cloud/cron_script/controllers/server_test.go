@@ -36,11 +36,15 @@ import (
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/cloud/cron_script/controllers"
 	"px.dev/pixie/src/cloud/cron_script/cronscriptpb"
 	"px.dev/pixie/src/cloud/cron_script/schema"
+	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/messagespb"
 	"px.dev/pixie/src/cloud/shared/vzshard"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
 	mock_vzmgrpb "px.dev/pixie/src/cloud/vzmgr/vzmgrpb/mock"
@@ -674,3 +678,149 @@ func TestServer_HandleGetScriptsRequest(t *testing.T) {
 	s.HandleScriptsRequest(v2cMsg)
 	wg.Wait()
 }
+
+func TestServer_HandleGetScriptsRequestWithSelector(t *testing.T) {
+	mustLoadTestData(db)
+	insertScript := `INSERT INTO cron_scripts(id, org_id, script, cluster_ids, cluster_selector, configs, enabled, frequency_s) VALUES ($1, $2, $3, $4, $5, PGP_SYM_ENCRYPT($6, $7), $8, $9)`
+	db.MustExec(insertScript, "123e4567-e89b-12d3-a456-426655440004", "223e4567-e89b-12d3-a456-426655440001", "px.prod()", controllers.ClusterIDs([]uuid.UUID{}), "env=prod", "testConfigYaml3: ijkl", "test", true, 20)
+	db.MustExec(insertScript, "123e4567-e89b-12d3-a456-426655440005", "223e4567-e89b-12d3-a456-426655440001", "px.staging()", controllers.ClusterIDs([]uuid.UUID{}), "env=staging", "testConfigYaml4: mnop", "test", true, 20)
+
+	ctrl := gomock.NewController(t)
+	mockVZMgr := mock_vzmgrpb.NewMockVZMgrServiceClient(ctrl)
+
+	vzID := "423e4567-e89b-12d3-a456-426655440001"
+	orgID := "223e4567-e89b-12d3-a456-426655440001"
+
+	mockVZMgr.EXPECT().GetOrgFromVizier(gomock.Any(), utils.ProtoFromUUIDStrOrNil(vzID)).Return(&vzmgrpb.GetOrgFromVizierResponse{
+		OrgID: utils.ProtoFromUUIDStrOrNil(orgID)}, nil)
+	mockVZMgr.EXPECT().GetVizierInfos(gomock.Any(), &vzmgrpb.GetVizierInfosRequest{
+		VizierIDs: []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil(vzID)},
+	}).Return(&vzmgrpb.GetVizierInfosResponse{
+		VizierInfos: []*cvmsgspb.VizierInfo{
+			&cvmsgspb.VizierInfo{
+				VizierID: utils.ProtoFromUUIDStrOrNil(vzID),
+				Status:   cvmsgspb.VZ_ST_HEALTHY,
+				Labels:   map[string]string{"env": "prod"},
+			},
+		},
+	}, nil)
+
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	defer natsCleanup()
+
+	s := controllers.New(db, "test", nc, mockVZMgr)
+
+	req := &cvmsgspb.GetCronScriptsRequest{
+		Topic: "test",
+	}
+	anyMsg, err := types.MarshalAny(req)
+	require.NoError(t, err)
+	v2cMsg := &cvmsgspb.V2CMessage{
+		Msg:      anyMsg,
+		VizierID: vzID,
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	csMap := map[string]*cvmsgspb.CronScript{
+		"123e4567-e89b-12d3-a456-426655440001": &cvmsgspb.CronScript{
+			ID:         utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+			Script:     "px.stream()",
+			FrequencyS: 10,
+			Configs:    "testConfigYaml2: efgh",
+		},
+		"123e4567-e89b-12d3-a456-426655440004": &cvmsgspb.CronScript{
+			ID:         utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440004"),
+			Script:     "px.prod()",
+			FrequencyS: 20,
+			Configs:    "testConfigYaml3: ijkl",
+		},
+	}
+	mdSub, err := nc.Subscribe(vzshard.C2VTopic(fmt.Sprintf("%s:%s", cvmsgs.GetCronScriptsResponseChannel, "test"), uuid.FromStringOrNil(vzID)), func(msg *nats.Msg) {
+		c2vMsg := &cvmsgspb.C2VMessage{}
+		err := proto.Unmarshal(msg.Data, c2vMsg)
+		require.NoError(t, err)
+		req := &cvmsgspb.GetCronScriptsResponse{}
+		err = types.UnmarshalAny(c2vMsg.Msg, req)
+		require.NoError(t, err)
+		require.NotNil(t, req.Scripts)
+		assert.Equal(t, csMap, req.Scripts)
+		wg.Done()
+	})
+	defer func() {
+		err = mdSub.Unsubscribe()
+		require.NoError(t, err)
+	}()
+
+	s.HandleScriptsRequest(v2cMsg)
+	wg.Wait()
+}
+
+func TestServer_CreateScriptInvalidSelector(t *testing.T) {
+	mustLoadTestData(db)
+
+	s := controllers.New(db, "test", nil, nil)
+	_, err := s.CreateScript(createTestContext(), &cronscriptpb.CreateScriptRequest{
+		Script:          "px.display()",
+		Configs:         "testYAML",
+		FrequencyS:      11,
+		ClusterSelector: "env in (prod",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_HandleExecutionError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockVZMgr := mock_vzmgrpb.NewMockVZMgrServiceClient(ctrl)
+
+	vzID := "423e4567-e89b-12d3-a456-426655440001"
+	orgID := "223e4567-e89b-12d3-a456-426655440001"
+	scriptID := "123e4567-e89b-12d3-a456-426655440001"
+
+	mockVZMgr.EXPECT().GetOrgFromVizier(gomock.Any(), utils.ProtoFromUUIDStrOrNil(vzID)).Return(&vzmgrpb.GetOrgFromVizierResponse{
+		OrgID: utils.ProtoFromUUIDStrOrNil(orgID)}, nil)
+
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	defer natsCleanup()
+
+	s := controllers.New(db, "test", nc, mockVZMgr)
+
+	ts := &types.Timestamp{Seconds: 100}
+	req := &cvmsgspb.CronScriptExecutionError{
+		ScriptID:     utils.ProtoFromUUIDStrOrNil(scriptID),
+		Timestamp:    ts,
+		ErrorMessage: "Table not found",
+	}
+	anyMsg, err := types.MarshalAny(req)
+	require.NoError(t, err)
+	v2cMsg := &cvmsgspb.V2CMessage{
+		Msg:      anyMsg,
+		VizierID: vzID,
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	sub, err := nc.Subscribe(messages.NotificationEventChannel, func(msg *nats.Msg) {
+		ev := &messagespb.NotificationEvent{}
+		err := proto.Unmarshal(msg.Data, ev)
+		require.NoError(t, err)
+		assert.Equal(t, utils.ProtoFromUUIDStrOrNil(orgID), ev.OrgID)
+		assert.Equal(t, utils.ProtoFromUUIDStrOrNil(vzID), ev.VizierID)
+		assert.Equal(t, messagespb.NE_CRON_SCRIPT_FAILED, ev.Type)
+		assert.Equal(t, ts, ev.Time)
+		assert.Equal(t, scriptID, ev.Details["script_id"])
+		assert.Equal(t, "Table not found", ev.Details["error"])
+		wg.Done()
+	})
+	require.NoError(t, err)
+	defer func() {
+		err = sub.Unsubscribe()
+		require.NoError(t, err)
+	}()
+
+	s.HandleExecutionError(v2cMsg)
+	wg.Wait()
+}
@@ -0,0 +1,2 @@
+ALTER TABLE cron_scripts
+  ADD COLUMN cluster_selector varchar(1024) NOT NULL DEFAULT '';
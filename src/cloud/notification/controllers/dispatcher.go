@@ -0,0 +1,355 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/cloud/notification/notificationpb"
+	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	// SignatureHeader is the header containing the HMAC-SHA256 signature of a webhook payload.
+	SignatureHeader = "X-Pixie-Signature"
+	// TimestampHeader is the header containing the unix timestamp at which the payload was signed.
+	TimestampHeader = "X-Pixie-Timestamp"
+	// EventIDHeader is the header containing the ID of the delivered event.
+	EventIDHeader = "X-Pixie-Event-ID"
+
+	// All replicas of the notification service share a queue group, so that each event is only delivered once.
+	dispatcherQueueGroup = "notification-service"
+	deliveryTimeout      = 10 * time.Second
+	// How long the delivery log is kept.
+	deliveryRetention = 30 * 24 * time.Hour
+	// How often to prune expired deliveries from the database.
+	pruneInterval = 1 * time.Hour
+	// The maximum number of deliveries in flight at once. Events wait for a free slot before being delivered.
+	maxConcurrentDeliveries = 64
+)
+
+// Dispatcher delivers the notification events published on NATS to the webhooks registered by each org.
+type Dispatcher struct {
+	db     *sqlx.DB
+	dbKey  string
+	nc     *nats.Conn
+	client *http.Client
+
+	// Retry configuration for deliveries.
+	InitialInterval time.Duration
+	MaxElapsedTime  time.Duration
+	// AllowPrivateAddresses allows deliveries to private and internal addresses. This should only be set
+	// in tests, which deliver to local receivers.
+	AllowPrivateAddresses bool
+
+	deliverySem chan struct{}
+	wg          sync.WaitGroup
+	quitCh      chan struct{}
+	once        sync.Once
+}
+
+// NewDispatcher creates a new dispatcher and starts listening for notification events.
+func NewDispatcher(db *sqlx.DB, dbKey string, nc *nats.Conn) (*Dispatcher, error) {
+	d := &Dispatcher{
+		db:              db,
+		dbKey:           dbKey,
+		nc:              nc,
+		InitialInterval: 1 * time.Second,
+		MaxElapsedTime:  2 * time.Minute,
+		deliverySem:     make(chan struct{}, maxConcurrentDeliveries),
+		quitCh:          make(chan struct{}),
+	}
+	d.client = newDeliveryClient(func() bool { return d.AllowPrivateAddresses })
+
+	natsCh := make(chan *nats.Msg, 4096)
+	sub, err := nc.ChanQueueSubscribe(messages.NotificationEventChannel, dispatcherQueueGroup, natsCh)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		pruneTick := time.NewTicker(pruneInterval)
+		defer pruneTick.Stop()
+		for {
+			select {
+			case <-d.quitCh:
+				err := sub.Unsubscribe()
+				if err != nil {
+					log.WithError(err).Error("Failed to unsubscribe from notification events")
+				}
+				return
+			case msg := <-natsCh:
+				ev := &messagespb.NotificationEvent{}
+				err := proto.Unmarshal(msg.Data, ev)
+				if err != nil {
+					log.WithError(err).Error("Could not unmarshal notification event")
+					continue
+				}
+				d.HandleEvent(ev)
+			case <-pruneTick.C:
+				d.PruneDeliveries()
+			}
+		}
+	}()
+	return d, nil
+}
+
+// Stop stops listening for events, and waits for any in-flight deliveries to complete.
+func (d *Dispatcher) Stop() {
+	d.once.Do(func() {
+		close(d.quitCh)
+	})
+	d.wg.Wait()
+}
+
+type webhookTarget struct {
+	ID            uuid.UUID     `db:"id"`
+	URL           string        `db:"url"`
+	Format        webhookFormat `db:"format"`
+	EventTypes    EventTypes    `db:"event_types"`
+	ClusterIDs    ClusterIDs    `db:"cluster_ids"`
+	SigningSecret string        `db:"signing_secret"`
+}
+
+func (w *webhookTarget) matches(ev *messagespb.NotificationEvent) bool {
+	if len(w.EventTypes) > 0 {
+		found := false
+		for _, t := range w.EventTypes {
+			if t == ev.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(w.ClusterIDs) > 0 {
+		vizierID := utils.UUIDFromProtoOrNil(ev.VizierID)
+		found := false
+		for _, c := range w.ClusterIDs {
+			if c == vizierID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// HandleEvent delivers the event to all of the org's enabled webhooks whose filters match the event.
+// Deliveries are performed asynchronously, but HandleEvent blocks while the maximum number of deliveries
+// are in flight.
+func (d *Dispatcher) HandleEvent(ev *messagespb.NotificationEvent) {
+	query := `SELECT id, url, format, event_types, cluster_ids, PGP_SYM_DECRYPT(signing_secret, $1::text) as signing_secret
+		FROM webhooks WHERE org_id=$2 AND enabled=true`
+	var webhooks []webhookTarget
+	err := d.db.Select(&webhooks, query, d.dbKey, utils.UUIDFromProtoOrNil(ev.OrgID))
+	if err != nil {
+		log.WithError(err).Error("Failed to fetch webhooks for org")
+		return
+	}
+
+	for i := range webhooks {
+		w := webhooks[i]
+		if !w.matches(ev) {
+			continue
+		}
+		select {
+		case d.deliverySem <- struct{}{}:
+		case <-d.quitCh:
+			return
+		}
+		d.wg.Add(1)
+		go func() {
+			defer func() {
+				<-d.deliverySem
+				d.wg.Done()
+			}()
+			d.deliver(&w, ev)
+		}()
+	}
+}
+
+// deliver posts the event to the webhook, retrying with an exponential backoff, and records the result
+// in the delivery log.
+func (d *Dispatcher) deliver(w *webhookTarget, ev *messagespb.NotificationEvent) {
+	body, err := FormatPayload(notificationpb.WebhookFormat(w.Format), ev)
+	if err != nil {
+		log.WithError(err).Error("Failed to format notification payload")
+		return
+	}
+	eventID := utils.UUIDFromProtoOrNil(ev.ID)
+
+	attempts := 0
+	responseCode := 0
+	post := func() error {
+		attempts++
+		ts := time.Now().Unix()
+		req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(SignatureHeader, SignPayload(w.SigningSecret, ts, body))
+		req.Header.Set(EventIDHeader, eventID.String())
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			responseCode = 0
+			return err
+		}
+		resp.Body.Close()
+		responseCode = resp.StatusCode
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+		// Only server errors and rate limiting are worth retrying.
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return err
+		}
+		return backoff.Permanent(err)
+	}
+
+	backOffOpts := backoff.NewExponentialBackOff()
+	backOffOpts.InitialInterval = d.InitialInterval
+	backOffOpts.MaxElapsedTime = d.MaxElapsedTime
+	err = backoff.Retry(post, backOffOpts)
+
+	var errMsg *string
+	if err != nil {
+		msg := err.Error()
+		errMsg = &msg
+		log.WithError(err).WithField("webhook_id", w.ID).Info("Failed to deliver notification")
+	}
+
+	query := `INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, attempts, response_code, error, success)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, dbErr := d.db.Exec(query, w.ID, eventID, ev.Type.String(), attempts, responseCode, errMsg, err == nil)
+	if dbErr != nil {
+		log.WithError(dbErr).Error("Failed to record webhook delivery")
+	}
+}
+
+// PruneDeliveries deletes deliveries which are older than the retention period.
+func (d *Dispatcher) PruneDeliveries() {
+	query := `DELETE FROM webhook_deliveries WHERE time < NOW() - INTERVAL '%f seconds'`
+	query = fmt.Sprintf(query, deliveryRetention.Seconds())
+	res, err := d.db.Exec(query)
+	if err != nil {
+		log.WithError(err).Error("Failed to prune webhook deliveries, ignoring (will retry in next tick)")
+		return
+	}
+	count, _ := res.RowsAffected()
+	log.WithField("entries_pruned", count).Info("Webhook Delivery Prune Complete")
+}
+
+// SignPayload computes the signature sent in the SignatureHeader. Receivers can verify a payload by computing
+// the HMAC-SHA256 of "<timestamp>.<body>" with their signing secret.
+func SignPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// jsonPayload is the payload posted to webhooks with the JSON format.
+type jsonPayload struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	OrgID     string            `json:"orgID"`
+	ClusterID string            `json:"clusterID,omitempty"`
+	Time      string            `json:"time"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// slackPayload is the payload posted to webhooks with the Slack format.
+type slackPayload struct {
+	Text string `json:"text"`
+}
+
+var eventTitles = map[messagespb.NotificationEventType]string{
+	messagespb.NE_VIZIER_STATUS_CHANGED: "Cluster status changed",
+	messagespb.NE_VIZIER_UPDATE_FAILED:  "Cluster update failed",
+	messagespb.NE_CRON_SCRIPT_FAILED:    "Cron script failed",
+}
+
+// FormatPayload formats the event as the body of a webhook request.
+func FormatPayload(format notificationpb.WebhookFormat, ev *messagespb.NotificationEvent) ([]byte, error) {
+	evTime := time.Now()
+	if ev.Time != nil {
+		t, err := types.TimestampFromProto(ev.Time)
+		if err != nil {
+			return nil, err
+		}
+		evTime = t
+	}
+
+	switch format {
+	case notificationpb.WEBHOOK_FORMAT_JSON:
+		p := &jsonPayload{
+			ID:      utils.UUIDFromProtoOrNil(ev.ID).String(),
+			Type:    strings.TrimPrefix(ev.Type.String(), "NE_"),
+			OrgID:   utils.UUIDFromProtoOrNil(ev.OrgID).String(),
+			Time:    evTime.UTC().Format(time.RFC3339),
+			Message: ev.Message,
+			Details: ev.Details,
+		}
+		if ev.VizierID != nil {
+			p.ClusterID = utils.UUIDFromProtoOrNil(ev.VizierID).String()
+		}
+		return json.Marshal(p)
+	case notificationpb.WEBHOOK_FORMAT_SLACK:
+		title, ok := eventTitles[ev.Type]
+		if !ok {
+			title = "Notification"
+		}
+		return json.Marshal(&slackPayload{
+			Text: fmt.Sprintf("*Pixie: %s*\n%s", title, ev.Message),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported webhook format: %s", format.String())
+	}
+}
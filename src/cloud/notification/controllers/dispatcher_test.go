@@ -0,0 +1,272 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/cloud/notification/controllers"
+	"px.dev/pixie/src/cloud/notification/notificationpb"
+	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+)
+
+const testEventID = "523e4567-e89b-12d3-a456-426655440000"
+
+func testEvent() *messagespb.NotificationEvent {
+	return &messagespb.NotificationEvent{
+		ID:       utils.ProtoFromUUIDStrOrNil(testEventID),
+		OrgID:    utils.ProtoFromUUIDStrOrNil(testOrgID),
+		VizierID: utils.ProtoFromUUIDStrOrNil(testClusterID),
+		Type:     messagespb.NE_VIZIER_STATUS_CHANGED,
+		Time:     &types.Timestamp{Seconds: 1621352198},
+		Message:  "Cluster status changed from HEALTHY to UNHEALTHY",
+		Details:  map[string]string{"status": "UNHEALTHY"},
+	}
+}
+
+func TestFormatPayload_JSON(t *testing.T) {
+	body, err := controllers.FormatPayload(notificationpb.WEBHOOK_FORMAT_JSON, testEvent())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id": "523e4567-e89b-12d3-a456-426655440000",
+		"type": "VIZIER_STATUS_CHANGED",
+		"orgID": "223e4567-e89b-12d3-a456-426655440000",
+		"clusterID": "323e4567-e89b-12d3-a456-426655440000",
+		"time": "2021-05-18T15:36:38Z",
+		"message": "Cluster status changed from HEALTHY to UNHEALTHY",
+		"details": {"status": "UNHEALTHY"}
+	}`, string(body))
+}
+
+func TestFormatPayload_Slack(t *testing.T) {
+	body, err := controllers.FormatPayload(notificationpb.WEBHOOK_FORMAT_SLACK, testEvent())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text": "*Pixie: Cluster status changed*\nCluster status changed from HEALTHY to UNHEALTHY"}`, string(body))
+}
+
+func TestSignPayload(t *testing.T) {
+	// Expected value computed with: echo -n '1621352198.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=2f0f5f215dfba971d49a14913c1665902022e161e83e13726ddecc65bdf10030",
+		controllers.SignPayload("secret", 1621352198, []byte("{}")))
+}
+
+type receivedRequest struct {
+	body      []byte
+	signature string
+	timestamp string
+	eventID   string
+}
+
+// startTestReceiver starts an HTTP server which responds with the given status codes, in order. Once the
+// status codes are exhausted, the last one is repeated.
+func startTestReceiver(t *testing.T, codes ...int) (*httptest.Server, func() []receivedRequest) {
+	var mu sync.Mutex
+	var reqs []receivedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		reqs = append(reqs, receivedRequest{
+			body:      body,
+			signature: r.Header.Get(controllers.SignatureHeader),
+			timestamp: r.Header.Get(controllers.TimestampHeader),
+			eventID:   r.Header.Get(controllers.EventIDHeader),
+		})
+		code := codes[len(codes)-1]
+		if len(reqs) <= len(codes) {
+			code = codes[len(reqs)-1]
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []receivedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return reqs
+	}
+}
+
+func mustLoadDeliveryTestData(url string) {
+	db.MustExec(`DELETE FROM webhook_deliveries`)
+	db.MustExec(`DELETE FROM webhooks`)
+
+	insertWebhook := `INSERT INTO webhooks(id, org_id, name, url, format, event_types, cluster_ids, signing_secret, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, PGP_SYM_ENCRYPT($8, $9), $10)`
+	db.MustExec(insertWebhook, testWebhookID1, testOrgID, "matching", url, "JSON",
+		`["NE_VIZIER_STATUS_CHANGED"]`, `[]`, "secret1", "test", true)
+	// Filtered out by event type.
+	db.MustExec(insertWebhook, testWebhookID2, testOrgID, "other events", url, "JSON",
+		`["NE_CRON_SCRIPT_FAILED"]`, `[]`, "secret2", "test", true)
+	// Belongs to another org.
+	db.MustExec(insertWebhook, testWebhookID3, testOtherOrgID, "other org", url, "JSON",
+		`[]`, `[]`, "secret3", "test", true)
+}
+
+type deliveryRow struct {
+	WebhookID    string  `db:"webhook_id"`
+	Attempts     int     `db:"attempts"`
+	ResponseCode int     `db:"response_code"`
+	Error        *string `db:"error"`
+	Success      bool    `db:"success"`
+}
+
+func newTestDispatcher(t *testing.T) *controllers.Dispatcher {
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	t.Cleanup(natsCleanup)
+
+	d, err := controllers.NewDispatcher(db, "test", nc)
+	require.NoError(t, err)
+	d.InitialInterval = 10 * time.Millisecond
+	d.MaxElapsedTime = 2 * time.Second
+	// The test receivers listen on loopback.
+	d.AllowPrivateAddresses = true
+	return d
+}
+
+func TestDispatcher_HandleEvent(t *testing.T) {
+	srv, getReqs := startTestReceiver(t, http.StatusOK)
+	mustLoadDeliveryTestData(srv.URL)
+
+	d := newTestDispatcher(t)
+	d.HandleEvent(testEvent())
+	d.Stop()
+
+	reqs := getReqs()
+	require.Len(t, reqs, 1)
+	expectedBody, err := controllers.FormatPayload(notificationpb.WEBHOOK_FORMAT_JSON, testEvent())
+	require.NoError(t, err)
+	assert.Equal(t, expectedBody, reqs[0].body)
+	assert.Equal(t, testEventID, reqs[0].eventID)
+	ts, err := strconv.ParseInt(reqs[0].timestamp, 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, controllers.SignPayload("secret1", ts, reqs[0].body), reqs[0].signature)
+
+	var deliveries []deliveryRow
+	err = db.Select(&deliveries, `SELECT webhook_id, attempts, response_code, error, success FROM webhook_deliveries`)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, testWebhookID1, deliveries[0].WebhookID)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusOK, deliveries[0].ResponseCode)
+	assert.Nil(t, deliveries[0].Error)
+	assert.True(t, deliveries[0].Success)
+}
+
+func TestDispatcher_HandleEvent_RetriesServerErrors(t *testing.T) {
+	srv, getReqs := startTestReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK)
+	mustLoadDeliveryTestData(srv.URL)
+
+	d := newTestDispatcher(t)
+	d.HandleEvent(testEvent())
+	d.Stop()
+
+	assert.Len(t, getReqs(), 3)
+
+	var delivery deliveryRow
+	err := db.Get(&delivery, `SELECT webhook_id, attempts, response_code, error, success FROM webhook_deliveries`)
+	require.NoError(t, err)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, http.StatusOK, delivery.ResponseCode)
+	assert.True(t, delivery.Success)
+}
+
+func TestDispatcher_HandleEvent_ClientErrorNotRetried(t *testing.T) {
+	srv, getReqs := startTestReceiver(t, http.StatusBadRequest)
+	mustLoadDeliveryTestData(srv.URL)
+
+	d := newTestDispatcher(t)
+	d.HandleEvent(testEvent())
+	d.Stop()
+
+	assert.Len(t, getReqs(), 1)
+
+	var delivery deliveryRow
+	err := db.Get(&delivery, `SELECT webhook_id, attempts, response_code, error, success FROM webhook_deliveries`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusBadRequest, delivery.ResponseCode)
+	require.NotNil(t, delivery.Error)
+	assert.Equal(t, "webhook responded with status 400", *delivery.Error)
+	assert.False(t, delivery.Success)
+}
+
+func TestDispatcher_HandleEvent_RefusesPrivateAddresses(t *testing.T) {
+	srv, getReqs := startTestReceiver(t, http.StatusOK)
+	mustLoadDeliveryTestData(srv.URL)
+
+	d := newTestDispatcher(t)
+	d.AllowPrivateAddresses = false
+	d.MaxElapsedTime = 100 * time.Millisecond
+	d.HandleEvent(testEvent())
+	d.Stop()
+
+	assert.Len(t, getReqs(), 0)
+
+	var delivery deliveryRow
+	err := db.Get(&delivery, `SELECT webhook_id, attempts, response_code, error, success FROM webhook_deliveries`)
+	require.NoError(t, err)
+	require.NotNil(t, delivery.Error)
+	assert.Contains(t, *delivery.Error, "refusing to connect to non-public address")
+	assert.False(t, delivery.Success)
+}
+
+func TestDispatcher_ReceivesEventsFromNATS(t *testing.T) {
+	srv, getReqs := startTestReceiver(t, http.StatusOK)
+	mustLoadDeliveryTestData(srv.URL)
+
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	defer natsCleanup()
+
+	d, err := controllers.NewDispatcher(db, "test", nc)
+	require.NoError(t, err)
+	d.AllowPrivateAddresses = true
+
+	b, err := proto.Marshal(testEvent())
+	require.NoError(t, err)
+	err = nc.Publish(messages.NotificationEventChannel, b)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(getReqs()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	d.Stop()
+
+	var payload map[string]interface{}
+	err = json.Unmarshal(getReqs()[0].body, &payload)
+	require.NoError(t, err)
+	assert.Equal(t, testEventID, payload["id"])
+}
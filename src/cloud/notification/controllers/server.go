@@ -0,0 +1,366 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/notification/notificationpb"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/shared/services/authcontext"
+	jwtutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	// The number of random bytes in a webhook's signing secret.
+	signingSecretLength = 32
+	// The number of deliveries returned if no limit is specified.
+	defaultDeliveriesLimit = 50
+)
+
+// Server is an implementation of the NotificationService.
+type Server struct {
+	db          *sqlx.DB
+	dbKey       string
+	vzmgrClient vzmgrpb.VZMgrServiceClient
+	resolver    Resolver
+}
+
+// New creates a new server.
+func New(db *sqlx.DB, dbKey string, vzmgrClient vzmgrpb.VZMgrServiceClient, resolver Resolver) *Server {
+	return &Server{
+		db:          db,
+		dbKey:       dbKey,
+		vzmgrClient: vzmgrClient,
+		resolver:    resolver,
+	}
+}
+
+// Webhook contains the stored configuration of a webhook.
+type Webhook struct {
+	ID         uuid.UUID     `db:"id"`
+	OrgID      uuid.UUID     `db:"org_id"`
+	Name       string        `db:"name"`
+	URL        string        `db:"url"`
+	Format     webhookFormat `db:"format"`
+	EventTypes EventTypes    `db:"event_types"`
+	ClusterIDs ClusterIDs    `db:"cluster_ids"`
+	Enabled    bool          `db:"enabled"`
+	CreatedAt  time.Time     `db:"created_at"`
+}
+
+func orgIDFromContext(ctx context.Context) (uuid.UUID, error) {
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.Unauthenticated, "Unauthenticated")
+	}
+	return uuid.FromStringOrNil(sCtx.Claims.GetUserClaims().OrgID), nil
+}
+
+func generateSigningSecret() (string, error) {
+	b := make([]byte, signingSecretLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// orgContext returns a context which is authorized to make requests on behalf of the given org.
+func orgContext(orgID uuid.UUID) (context.Context, error) {
+	svcJWT := jwtutils.GenerateJWTForAPIUser("", orgID.String(), time.Now().Add(time.Minute*10), viper.GetString("domain_name"))
+	svcClaims, err := jwtutils.SignJWTClaims(svcJWT, viper.GetString("jwt_signing_key"))
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization",
+		fmt.Sprintf("bearer %s", svcClaims)), nil
+}
+
+// validateClusterIDs checks that all of the given clusters belong to the org.
+func (s *Server) validateClusterIDs(orgID uuid.UUID, ids []*uuidpb.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, err := orgContext(orgID)
+	if err != nil {
+		return status.Error(codes.Internal, "Failed to sign claims")
+	}
+	viziers, err := s.vzmgrClient.GetViziersByOrg(ctx, utils.ProtoFromUUID(orgID))
+	if err != nil {
+		log.WithError(err).Error("Could not get viziers for org")
+		return status.Error(codes.Internal, "Failed to fetch clusters for org")
+	}
+	orgClusters := make(map[uuid.UUID]bool, len(viziers.VizierIDs))
+	for _, id := range viziers.VizierIDs {
+		orgClusters[utils.UUIDFromProtoOrNil(id)] = true
+	}
+	for _, id := range ids {
+		if !orgClusters[utils.UUIDFromProtoOrNil(id)] {
+			return status.Errorf(codes.InvalidArgument, "cluster %s does not belong to the org", utils.UUIDFromProtoOrNil(id))
+		}
+	}
+	return nil
+}
+
+// CreateWebhook registers a new webhook for the org.
+func (s *Server) CreateWebhook(ctx context.Context, req *notificationpb.CreateWebhookRequest) (*notificationpb.CreateWebhookResponse, error) {
+	orgID, err := orgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWebhookURL(ctx, s.resolver, req.URL); err != nil {
+		return nil, err
+	}
+	if req.Format == notificationpb.WEBHOOK_FORMAT_UNKNOWN {
+		return nil, status.Error(codes.InvalidArgument, "webhook format must be specified")
+	}
+	if err := s.validateClusterIDs(orgID, req.ClusterIDs); err != nil {
+		return nil, err
+	}
+
+	secret, err := generateSigningSecret()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to generate signing secret")
+	}
+
+	query := `INSERT INTO webhooks(org_id, name, url, format, event_types, cluster_ids, signing_secret)
+		VALUES ($1, $2, $3, $4, $5, $6, PGP_SYM_ENCRYPT($7, $8)) RETURNING id`
+	var id uuid.UUID
+	err = s.db.Get(&id, query, orgID, req.Name, req.URL, webhookFormat(req.Format), EventTypes(req.EventTypes),
+		ClusterIDsFromProto(req.ClusterIDs), secret, s.dbKey)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to create webhook")
+	}
+
+	return &notificationpb.CreateWebhookResponse{
+		ID:            utils.ProtoFromUUID(id),
+		SigningSecret: secret,
+	}, nil
+}
+
+// GetWebhooks gets all webhooks registered for the org.
+func (s *Server) GetWebhooks(ctx context.Context, req *notificationpb.GetWebhooksRequest) (*notificationpb.GetWebhooksResponse, error) {
+	orgID, err := orgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, org_id, name, url, format, event_types, cluster_ids, enabled, created_at
+		FROM webhooks WHERE org_id=$1 ORDER BY created_at`
+	rows, err := s.db.Queryx(query, orgID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to get webhooks")
+	}
+	defer rows.Close()
+
+	webhooks := []*notificationpb.Webhook{}
+	for rows.Next() {
+		var w Webhook
+		err = rows.StructScan(&w)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to read webhooks")
+		}
+		createdAt, err := types.TimestampProto(w.CreatedAt)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to read webhooks")
+		}
+		webhooks = append(webhooks, &notificationpb.Webhook{
+			ID:         utils.ProtoFromUUID(w.ID),
+			OrgID:      utils.ProtoFromUUID(w.OrgID),
+			Name:       w.Name,
+			URL:        w.URL,
+			Format:     notificationpb.WebhookFormat(w.Format),
+			EventTypes: w.EventTypes,
+			ClusterIDs: w.ClusterIDs.ToProto(),
+			Enabled:    w.Enabled,
+			CreatedAt:  createdAt,
+		})
+	}
+
+	return &notificationpb.GetWebhooksResponse{
+		Webhooks: webhooks,
+	}, nil
+}
+
+// UpdateWebhook updates an existing webhook.
+func (s *Server) UpdateWebhook(ctx context.Context, req *notificationpb.UpdateWebhookRequest) (*notificationpb.UpdateWebhookResponse, error) {
+	orgID, err := orgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	webhookID := utils.UUIDFromProtoOrNil(req.ID)
+
+	query := `SELECT id, org_id, name, url, format, event_types, cluster_ids, enabled, created_at
+		FROM webhooks WHERE org_id=$1 AND id=$2`
+	rows, err := s.db.Queryx(query, orgID, webhookID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to fetch webhook")
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, status.Error(codes.NotFound, "webhook not found")
+	}
+	var w Webhook
+	err = rows.StructScan(&w)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to read webhook")
+	}
+	// Release the DB connection early.
+	rows.Close()
+
+	if req.Name != nil {
+		w.Name = req.Name.Value
+	}
+	if req.URL != nil {
+		if err := validateWebhookURL(ctx, s.resolver, req.URL.Value); err != nil {
+			return nil, err
+		}
+		w.URL = req.URL.Value
+	}
+	if req.EventTypes != nil {
+		w.EventTypes = req.EventTypes.Value
+	}
+	if req.ClusterIDs != nil {
+		if err := s.validateClusterIDs(orgID, req.ClusterIDs.Value); err != nil {
+			return nil, err
+		}
+		w.ClusterIDs = ClusterIDsFromProto(req.ClusterIDs.Value)
+	}
+	if req.Enabled != nil {
+		w.Enabled = req.Enabled.Value
+	}
+
+	query = `UPDATE webhooks SET name=$1, url=$2, event_types=$3, cluster_ids=$4, enabled=$5 WHERE id=$6`
+	_, err = s.db.Exec(query, w.Name, w.URL, w.EventTypes, w.ClusterIDs, w.Enabled, webhookID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to update webhook")
+	}
+
+	resp := &notificationpb.UpdateWebhookResponse{}
+	if req.RotateSigningSecret {
+		secret, err := generateSigningSecret()
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to generate signing secret")
+		}
+		query = `UPDATE webhooks SET signing_secret=PGP_SYM_ENCRYPT($1, $2) WHERE id=$3`
+		_, err = s.db.Exec(query, secret, s.dbKey, webhookID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to rotate signing secret")
+		}
+		resp.SigningSecret = secret
+	}
+	return resp, nil
+}
+
+// DeleteWebhook deletes a webhook, along with its delivery log.
+func (s *Server) DeleteWebhook(ctx context.Context, req *notificationpb.DeleteWebhookRequest) (*notificationpb.DeleteWebhookResponse, error) {
+	orgID, err := orgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `DELETE FROM webhooks WHERE org_id=$1 AND id=$2`
+	res, err := s.db.Exec(query, orgID, utils.UUIDFromProtoOrNil(req.ID))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to delete webhook")
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return nil, status.Error(codes.NotFound, "webhook not found")
+	}
+	return &notificationpb.DeleteWebhookResponse{}, nil
+}
+
+// GetWebhookDeliveries gets the most recent delivery attempts for a webhook.
+func (s *Server) GetWebhookDeliveries(ctx context.Context, req *notificationpb.GetWebhookDeliveriesRequest) (*notificationpb.GetWebhookDeliveriesResponse, error) {
+	orgID, err := orgIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	webhookID := utils.UUIDFromProtoOrNil(req.WebhookID)
+
+	var exists bool
+	err = s.db.Get(&exists, `SELECT EXISTS(SELECT 1 FROM webhooks WHERE org_id=$1 AND id=$2)`, orgID, webhookID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to fetch webhook")
+	}
+	if !exists {
+		return nil, status.Error(codes.NotFound, "webhook not found")
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultDeliveriesLimit
+	}
+
+	query := `SELECT id, event_id, event_type, time, attempts, response_code, COALESCE(error, '') as error, success
+		FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY time DESC LIMIT $2`
+	var deliveries []struct {
+		ID           uuid.UUID `db:"id"`
+		EventID      uuid.UUID `db:"event_id"`
+		EventType    string    `db:"event_type"`
+		Time         time.Time `db:"time"`
+		Attempts     int64     `db:"attempts"`
+		ResponseCode int64     `db:"response_code"`
+		Error        string    `db:"error"`
+		Success      bool      `db:"success"`
+	}
+	err = s.db.Select(&deliveries, query, webhookID, limit)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to get webhook deliveries")
+	}
+
+	resp := &notificationpb.GetWebhookDeliveriesResponse{
+		Deliveries: make([]*notificationpb.WebhookDelivery, len(deliveries)),
+	}
+	for i, d := range deliveries {
+		ts, err := types.TimestampProto(d.Time)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "Failed to read webhook deliveries")
+		}
+		resp.Deliveries[i] = &notificationpb.WebhookDelivery{
+			ID:           utils.ProtoFromUUID(d.ID),
+			WebhookID:    req.WebhookID,
+			EventID:      utils.ProtoFromUUID(d.EventID),
+			EventType:    messagespb.NotificationEventType(messagespb.NotificationEventType_value[d.EventType]),
+			Time:         ts,
+			Attempts:     d.Attempts,
+			ResponseCode: d.ResponseCode,
+			Error:        d.Error,
+			Success:      d.Success,
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,366 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/golang/mock/gomock"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/notification/controllers"
+	"px.dev/pixie/src/cloud/notification/notificationpb"
+	"px.dev/pixie/src/cloud/notification/schema"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	mock_vzmgrpb "px.dev/pixie/src/cloud/vzmgr/vzmgrpb/mock"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/shared/services/pgtest"
+	srvutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+)
+
+const (
+	testOrgID      = "223e4567-e89b-12d3-a456-426655440000"
+	testOtherOrgID = "223e4567-e89b-12d3-a456-426655440001"
+	testWebhookID1 = "123e4567-e89b-12d3-a456-426655440000"
+	testWebhookID2 = "123e4567-e89b-12d3-a456-426655440001"
+	testWebhookID3 = "123e4567-e89b-12d3-a456-426655440002"
+	testClusterID  = "323e4567-e89b-12d3-a456-426655440000"
+)
+
+// fakeResolver resolves hostnames using a static map.
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.IPAddr{IP: net.ParseIP(ip)}
+	}
+	return addrs, nil
+}
+
+var testResolver = fakeResolver{
+	"example.com":     {"93.184.216.34"},
+	"hooks.slack.com": {"2600:1f18:24e6:b900::1", "54.89.3.12"},
+	"rebind.test.com": {"93.184.216.35", "10.0.0.12"},
+}
+
+func newTestServer(t *testing.T) (*controllers.Server, *mock_vzmgrpb.MockVZMgrServiceClient) {
+	viper.Set("jwt_signing_key", "key0")
+	ctrl := gomock.NewController(t)
+	mockVZMgr := mock_vzmgrpb.NewMockVZMgrServiceClient(ctrl)
+	return controllers.New(db, "test", mockVZMgr, testResolver), mockVZMgr
+}
+
+var db *sqlx.DB
+
+func TestMain(m *testing.M) {
+	err := testMain(m)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Got error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func testMain(m *testing.M) error {
+	s := bindata.Resource(schema.AssetNames(), schema.Asset)
+	testDB, teardown, err := pgtest.SetupTestDB(s)
+	if err != nil {
+		return fmt.Errorf("failed to start test database: %w", err)
+	}
+
+	defer teardown()
+	db = testDB
+
+	if c := m.Run(); c != 0 {
+		return fmt.Errorf("some tests failed with code: %d", c)
+	}
+	return nil
+}
+
+func createTestContext() context.Context {
+	sCtx := authcontext.New()
+	sCtx.Claims = srvutils.GenerateJWTForUser("abcdef", testOrgID, "test@test.com", time.Now(), "pixie")
+	return authcontext.NewContext(context.Background(), sCtx)
+}
+
+func mustLoadTestData(db *sqlx.DB) {
+	db.MustExec(`DELETE FROM webhook_deliveries`)
+	db.MustExec(`DELETE FROM webhooks`)
+
+	insertWebhook := `INSERT INTO webhooks(id, org_id, name, url, format, event_types, cluster_ids, signing_secret, enabled, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, PGP_SYM_ENCRYPT($8, $9), $10, $11)`
+	db.MustExec(insertWebhook, testWebhookID1, testOrgID, "all events", "https://example.com/hook", "JSON", `[]`, `[]`,
+		"secret1", "test", true, "2021-05-18 15:36:38")
+	db.MustExec(insertWebhook, testWebhookID2, testOrgID, "cluster health", "https://hooks.slack.com/services/abc", "SLACK",
+		`["NE_VIZIER_STATUS_CHANGED"]`, fmt.Sprintf(`["%s"]`, testClusterID), "secret2", "test", true, "2021-05-19 15:36:38")
+	db.MustExec(insertWebhook, testWebhookID3, testOtherOrgID, "other org", "https://example.com/other", "JSON", `[]`, `[]`,
+		"secret3", "test", true, "2021-05-20 15:36:38")
+
+	insertDelivery := `INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, time, attempts, response_code, error, success)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	db.MustExec(insertDelivery, testWebhookID1, "423e4567-e89b-12d3-a456-426655440000", "NE_CRON_SCRIPT_FAILED",
+		"2021-05-21 15:36:38", 1, 200, nil, true)
+	db.MustExec(insertDelivery, testWebhookID1, "423e4567-e89b-12d3-a456-426655440001", "NE_VIZIER_UPDATE_FAILED",
+		"2021-05-22 15:36:38", 3, 503, "webhook responded with status 503", false)
+}
+
+func TestServer_CreateWebhook(t *testing.T) {
+	mustLoadTestData(db)
+
+	s, mockVZMgr := newTestServer(t)
+	mockVZMgr.EXPECT().GetViziersByOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testOrgID)).
+		Return(&vzmgrpb.GetViziersByOrgResponse{
+			VizierIDs: []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil(testClusterID)},
+		}, nil)
+	resp, err := s.CreateWebhook(createTestContext(), &notificationpb.CreateWebhookRequest{
+		Name:       "new hook",
+		URL:        "https://example.com/new",
+		Format:     notificationpb.WEBHOOK_FORMAT_JSON,
+		EventTypes: []messagespb.NotificationEventType{messagespb.NE_CRON_SCRIPT_FAILED},
+		ClusterIDs: []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil(testClusterID)},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.NotEmpty(t, resp.SigningSecret)
+
+	var webhook struct {
+		OrgID         uuid.UUID              `db:"org_id"`
+		URL           string                 `db:"url"`
+		Format        string                 `db:"format"`
+		EventTypes    controllers.EventTypes `db:"event_types"`
+		ClusterIDs    controllers.ClusterIDs `db:"cluster_ids"`
+		SigningSecret string                 `db:"signing_secret"`
+		Enabled       bool                   `db:"enabled"`
+	}
+	query := `SELECT org_id, url, format, event_types, cluster_ids, PGP_SYM_DECRYPT(signing_secret, 'test') as signing_secret, enabled
+		FROM webhooks WHERE id=$1`
+	err = db.Get(&webhook, query, utils.UUIDFromProtoOrNil(resp.ID))
+	require.NoError(t, err)
+	assert.Equal(t, testOrgID, webhook.OrgID.String())
+	assert.Equal(t, "https://example.com/new", webhook.URL)
+	assert.Equal(t, "JSON", webhook.Format)
+	assert.Equal(t, controllers.EventTypes{messagespb.NE_CRON_SCRIPT_FAILED}, webhook.EventTypes)
+	assert.Equal(t, controllers.ClusterIDs{uuid.FromStringOrNil(testClusterID)}, webhook.ClusterIDs)
+	assert.Equal(t, resp.SigningSecret, webhook.SigningSecret)
+	assert.True(t, webhook.Enabled)
+}
+
+func TestServer_CreateWebhook_InvalidURL(t *testing.T) {
+	mustLoadTestData(db)
+
+	s, _ := newTestServer(t)
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"not a url", "not a url"},
+		{"http", "http://example.com/hook"},
+		{"loopback", "https://127.0.0.1/hook"},
+		{"metadata service", "https://169.254.169.254/latest/meta-data"},
+		{"ipv6 loopback", "https://[::1]:8443/hook"},
+		{"cluster service", "https://vzmgr-service.plc.svc.cluster.local/hook"},
+		{"single label", "https://vzmgr-service/hook"},
+		{"resolves to private address", "https://rebind.test.com/hook"},
+		{"unresolvable", "https://unknown.test.com/hook"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.CreateWebhook(createTestContext(), &notificationpb.CreateWebhookRequest{
+				URL:    test.url,
+				Format: notificationpb.WEBHOOK_FORMAT_JSON,
+			})
+			require.Nil(t, resp)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestServer_CreateWebhook_ClusterInOtherOrg(t *testing.T) {
+	mustLoadTestData(db)
+
+	s, mockVZMgr := newTestServer(t)
+	mockVZMgr.EXPECT().GetViziersByOrg(gomock.Any(), utils.ProtoFromUUIDStrOrNil(testOrgID)).
+		Return(&vzmgrpb.GetViziersByOrgResponse{}, nil)
+	resp, err := s.CreateWebhook(createTestContext(), &notificationpb.CreateWebhookRequest{
+		URL:        "https://example.com/new",
+		Format:     notificationpb.WEBHOOK_FORMAT_JSON,
+		ClusterIDs: []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil(testClusterID)},
+	})
+	require.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_GetWebhooks(t *testing.T) {
+	mustLoadTestData(db)
+
+	s, _ := newTestServer(t)
+	resp, err := s.GetWebhooks(createTestContext(), &notificationpb.GetWebhooksRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.Webhooks, 2)
+
+	assert.Equal(t, &notificationpb.Webhook{
+		ID:         utils.ProtoFromUUIDStrOrNil(testWebhookID1),
+		OrgID:      utils.ProtoFromUUIDStrOrNil(testOrgID),
+		Name:       "all events",
+		URL:        "https://example.com/hook",
+		Format:     notificationpb.WEBHOOK_FORMAT_JSON,
+		EventTypes: []messagespb.NotificationEventType{},
+		ClusterIDs: []*uuidpb.UUID{},
+		Enabled:    true,
+		CreatedAt:  &types.Timestamp{Seconds: 1621352198},
+	}, resp.Webhooks[0])
+	assert.Equal(t, &notificationpb.Webhook{
+		ID:         utils.ProtoFromUUIDStrOrNil(testWebhookID2),
+		OrgID:      utils.ProtoFromUUIDStrOrNil(testOrgID),
+		Name:       "cluster health",
+		URL:        "https://hooks.slack.com/services/abc",
+		Format:     notificationpb.WEBHOOK_FORMAT_SLACK,
+		EventTypes: []messagespb.NotificationEventType{messagespb.NE_VIZIER_STATUS_CHANGED},
+		ClusterIDs: []*uuidpb.UUID{utils.ProtoFromUUIDStrOrNil(testClusterID)},
+		Enabled:    true,
+		CreatedAt:  &types.Timestamp{Seconds: 1621438598},
+	}, resp.Webhooks[1])
+}
+
+func TestServer_UpdateWebhook(t *testing.T) {
+	mustLoadTestData(db)
+
+	s, _ := newTestServer(t)
+	resp, err := s.UpdateWebhook(createTestContext(), &notificationpb.UpdateWebhookRequest{
+		ID:      utils.ProtoFromUUIDStrOrNil(testWebhookID1),
+		URL:     &types.StringValue{Value: "https://example.com/updated"},
+		Enabled: &types.BoolValue{Value: false},
+		EventTypes: &notificationpb.EventTypes{
+			Value: []messagespb.NotificationEventType{messagespb.NE_VIZIER_UPDATE_FAILED},
+		},
+		RotateSigningSecret: true,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.SigningSecret)
+
+	var webhook struct {
+		Name          string                 `db:"name"`
+		URL           string                 `db:"url"`
+		EventTypes    controllers.EventTypes `db:"event_types"`
+		SigningSecret string                 `db:"signing_secret"`
+		Enabled       bool                   `db:"enabled"`
+	}
+	query := `SELECT name, url, event_types, PGP_SYM_DECRYPT(signing_secret, 'test') as signing_secret, enabled
+		FROM webhooks WHERE id=$1`
+	err = db.Get(&webhook, query, testWebhookID1)
+	require.NoError(t, err)
+	assert.Equal(t, "all events", webhook.Name)
+	assert.Equal(t, "https://example.com/updated", webhook.URL)
+	assert.Equal(t, controllers.EventTypes{messagespb.NE_VIZIER_UPDATE_FAILED}, webhook.EventTypes)
+	assert.Equal(t, resp.SigningSecret, webhook.SigningSecret)
+	assert.False(t, webhook.Enabled)
+}
+
+func TestServer_UpdateWebhook_OtherOrg(t *testing.T) {
+	mustLoadTestData(db)
+
+	s, _ := newTestServer(t)
+	resp, err := s.UpdateWebhook(createTestContext(), &notificationpb.UpdateWebhookRequest{
+		ID:      utils.ProtoFromUUIDStrOrNil(testWebhookID3),
+		Enabled: &types.BoolValue{Value: false},
+	})
+	require.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_DeleteWebhook(t *testing.T) {
+	mustLoadTestData(db)
+
+	s, _ := newTestServer(t)
+	_, err := s.DeleteWebhook(createTestContext(), &notificationpb.DeleteWebhookRequest{
+		ID: utils.ProtoFromUUIDStrOrNil(testWebhookID1),
+	})
+	require.NoError(t, err)
+
+	var count int
+	err = db.Get(&count, `SELECT COUNT(*) FROM webhooks WHERE id=$1`, testWebhookID1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	err = db.Get(&count, `SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id=$1`, testWebhookID1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// Webhooks belonging to other orgs cannot be deleted.
+	_, err = s.DeleteWebhook(createTestContext(), &notificationpb.DeleteWebhookRequest{
+		ID: utils.ProtoFromUUIDStrOrNil(testWebhookID3),
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_GetWebhookDeliveries(t *testing.T) {
+	mustLoadTestData(db)
+
+	s, _ := newTestServer(t)
+	resp, err := s.GetWebhookDeliveries(createTestContext(), &notificationpb.GetWebhookDeliveriesRequest{
+		WebhookID: utils.ProtoFromUUIDStrOrNil(testWebhookID1),
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Deliveries, 2)
+
+	// Most recent delivery first.
+	assert.Equal(t, utils.ProtoFromUUIDStrOrNil("423e4567-e89b-12d3-a456-426655440001"), resp.Deliveries[0].EventID)
+	assert.Equal(t, messagespb.NE_VIZIER_UPDATE_FAILED, resp.Deliveries[0].EventType)
+	assert.Equal(t, int64(3), resp.Deliveries[0].Attempts)
+	assert.Equal(t, int64(503), resp.Deliveries[0].ResponseCode)
+	assert.Equal(t, "webhook responded with status 503", resp.Deliveries[0].Error)
+	assert.False(t, resp.Deliveries[0].Success)
+
+	assert.Equal(t, utils.ProtoFromUUIDStrOrNil("423e4567-e89b-12d3-a456-426655440000"), resp.Deliveries[1].EventID)
+	assert.Equal(t, int64(200), resp.Deliveries[1].ResponseCode)
+	assert.Equal(t, "", resp.Deliveries[1].Error)
+	assert.True(t, resp.Deliveries[1].Success)
+
+	resp, err = s.GetWebhookDeliveries(createTestContext(), &notificationpb.GetWebhookDeliveriesRequest{
+		WebhookID: utils.ProtoFromUUIDStrOrNil(testWebhookID1),
+		Limit:     1,
+	})
+	require.NoError(t, err)
+	assert.Len(t, resp.Deliveries, 1)
+
+	_, err = s.GetWebhookDeliveries(createTestContext(), &notificationpb.GetWebhookDeliveriesRequest{
+		WebhookID: utils.ProtoFromUUIDStrOrNil(testWebhookID3),
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gofrs/uuid"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/notification/notificationpb"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/utils"
+)
+
+// ClusterIDs represents an array of cluster IDs.
+type ClusterIDs []uuid.UUID
+
+// Value Returns a golang database/sql driver value for ClusterIDs.
+func (p ClusterIDs) Value() (driver.Value, error) {
+	if p == nil {
+		p = ClusterIDs{}
+	}
+	return json.Marshal(p)
+}
+
+// Scan Scans the sqlx database type ([]bytes) into the ClusterIDs type.
+func (p *ClusterIDs) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return nil
+	}
+	return json.Unmarshal(data, p)
+}
+
+// ToProto converts the cluster IDs to their proto representation.
+func (p ClusterIDs) ToProto() []*uuidpb.UUID {
+	ids := make([]*uuidpb.UUID, len(p))
+	for i, id := range p {
+		ids[i] = utils.ProtoFromUUID(id)
+	}
+	return ids
+}
+
+// ClusterIDsFromProto converts the cluster ID protos to ClusterIDs.
+func ClusterIDsFromProto(ids []*uuidpb.UUID) ClusterIDs {
+	p := make(ClusterIDs, len(ids))
+	for i, id := range ids {
+		p[i] = utils.UUIDFromProtoOrNil(id)
+	}
+	return p
+}
+
+// EventTypes represents an array of notification event types. They are stored by name so that the
+// stored values do not depend on the enum's numbering.
+type EventTypes []messagespb.NotificationEventType
+
+// Value Returns a golang database/sql driver value for EventTypes.
+func (e EventTypes) Value() (driver.Value, error) {
+	names := make([]string, len(e))
+	for i, t := range e {
+		names[i] = t.String()
+	}
+	return json.Marshal(names)
+}
+
+// Scan Scans the sqlx database type ([]bytes) into the EventTypes type.
+func (e *EventTypes) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return nil
+	}
+	var names []string
+	err := json.Unmarshal(data, &names)
+	if err != nil {
+		return err
+	}
+	types := make(EventTypes, len(names))
+	for i, n := range names {
+		t, ok := messagespb.NotificationEventType_value[n]
+		if !ok {
+			return fmt.Errorf("invalid event type: %s", n)
+		}
+		types[i] = messagespb.NotificationEventType(t)
+	}
+	*e = types
+	return nil
+}
+
+// webhookFormat is the format of a webhook, stored by name.
+type webhookFormat notificationpb.WebhookFormat
+
+func (f webhookFormat) Stringify() string {
+	return strings.TrimPrefix(notificationpb.WebhookFormat(f).String(), "WEBHOOK_FORMAT_")
+}
+
+func (f webhookFormat) Value() (driver.Value, error) {
+	return f.Stringify(), nil
+}
+
+func (f *webhookFormat) Scan(value interface{}) error {
+	sv, err := driver.String.ConvertValue(value)
+	if err != nil {
+		return fmt.Errorf("failed to scan webhook format: %w", err)
+	}
+	v, ok := notificationpb.WebhookFormat_value[fmt.Sprintf("WEBHOOK_FORMAT_%s", sv)]
+	if !ok {
+		return fmt.Errorf("invalid webhook format: %s", sv)
+	}
+	*f = webhookFormat(v)
+	return nil
+}
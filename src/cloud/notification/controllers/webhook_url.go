@@ -0,0 +1,177 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Resolver looks up the IP addresses of a host.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// internalHostSuffixes are the suffixes of hostnames which only resolve within private networks, such as the
+// services of the K8s cluster that Pixie Cloud runs in.
+var internalHostSuffixes = []string{
+	".localhost",
+	".local",
+	".localdomain",
+	".internal",
+	".svc",
+	".home.arpa",
+}
+
+// nonPublicNetworks are the ranges of special-purpose addresses that are not covered by the net.IP predicates.
+var nonPublicNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+	"64:ff9b:1::/48",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// isPublicIP returns whether the IP is a publicly routable address.
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, n := range nonPublicNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// isInternalHostname returns whether the hostname can only be resolved within a private network.
+func isInternalHostname(host string) bool {
+	// Single label names are resolved using the search domains of the cluster.
+	if host == "localhost" || !strings.Contains(host, ".") {
+		return true
+	}
+	for _, suffix := range internalHostSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWebhookURL checks that the URL is an https URL of a host on the public internet, so that webhooks
+// can't be used to send requests to services within Pixie Cloud's network.
+func validateWebhookURL(ctx context.Context, resolver Resolver, u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Hostname() == "" || parsed.Scheme != "https" {
+		return status.Error(codes.InvalidArgument, "webhook URL must be a valid https URL")
+	}
+	errInternal := status.Error(codes.InvalidArgument, "webhook URL must not point to a private or internal address")
+
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return errInternal
+		}
+		return nil
+	}
+	if isInternalHostname(host) {
+		return errInternal
+	}
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return status.Errorf(codes.InvalidArgument, "failed to resolve webhook host %s", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return errInternal
+		}
+	}
+	return nil
+}
+
+// publicOnlyDialControl refuses connections to non-public addresses. As it checks the resolved address that is
+// being dialed, DNS rebinding can't bypass the check made when the webhook was registered.
+func publicOnlyDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
+
+// newDeliveryClient creates the HTTP client used to deliver webhooks, which only connects to public addresses
+// unless allowPrivateAddresses returns true.
+func newDeliveryClient(allowPrivateAddresses func() bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			if allowPrivateAddresses() {
+				return nil
+			}
+			return publicOnlyDialControl(network, address, c)
+		},
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	// Deliveries must not go through a proxy, which would dial the webhook's address on our behalf.
+	tr.Proxy = nil
+	tr.DialContext = dialer.DialContext
+	tr.TLSHandshakeTimeout = 5 * time.Second
+
+	return &http.Client{
+		Transport: tr,
+		Timeout:   deliveryTimeout,
+		// Redirects aren't followed, since they could point the delivery at a different host.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"net"
+	"net/http"
+	_ "net/http/pprof"
+
+	bindata "github.com/golang-migrate/migrate/source/go_bindata"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+
+	"px.dev/pixie/src/cloud/notification/controllers"
+	"px.dev/pixie/src/cloud/notification/notificationpb"
+	"px.dev/pixie/src/cloud/notification/schema"
+	"px.dev/pixie/src/cloud/shared/pgmigrate"
+	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
+	"px.dev/pixie/src/shared/services"
+	"px.dev/pixie/src/shared/services/env"
+	"px.dev/pixie/src/shared/services/healthz"
+	"px.dev/pixie/src/shared/services/msgbus"
+	"px.dev/pixie/src/shared/services/pg"
+	"px.dev/pixie/src/shared/services/server"
+)
+
+func init() {
+	pflag.String("vzmgr_service", "kubernetes:///vzmgr-service.plc:51800", "The vzmgr service url (load balancer/list is ok)")
+}
+
+func newVZMgrClient() (vzmgrpb.VZMgrServiceClient, error) {
+	dialOpts, err := services.GetGRPCClientDialOpts()
+	if err != nil {
+		return nil, err
+	}
+
+	vzmgrChannel, err := grpc.Dial(viper.GetString("vzmgr_service"), dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return vzmgrpb.NewVZMgrServiceClient(vzmgrChannel), nil
+}
+
+func mustSetupNATS() *nats.Conn {
+	nc := msgbus.MustConnectNATS()
+
+	nc.SetErrorHandler(func(conn *nats.Conn, subscription *nats.Subscription, err error) {
+		if err != nil {
+			log.WithError(err).
+				WithField("Subject", subscription.Subject).
+				Error("Got NATS error")
+		}
+	})
+	return nc
+}
+
+func main() {
+	services.SetupService("notification-service", 50900)
+	services.PostFlagSetupAndParse()
+	services.CheckServiceFlags()
+	services.SetupServiceLogging()
+
+	mux := http.NewServeMux()
+	// This handles all the pprof endpoints.
+	mux.Handle("/debug/", http.DefaultServeMux)
+	healthz.RegisterDefaultChecks(mux)
+
+	db := pg.MustConnectDefaultPostgresDB()
+	err := pgmigrate.PerformMigrationsUsingBindata(db, "notification_service_migrations",
+		bindata.Resource(schema.AssetNames(), schema.Asset))
+	if err != nil {
+		log.WithError(err).Fatal("Failed to apply migrations")
+	}
+
+	dbKey := viper.GetString("database_key")
+	if dbKey == "" {
+		log.Fatal("Database encryption key is required")
+	}
+
+	nc := mustSetupNATS()
+	defer nc.Close()
+
+	d, err := controllers.NewDispatcher(db, dbKey, nc)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to start notification dispatcher")
+	}
+	defer d.Stop()
+
+	s := server.NewPLServer(env.New(viper.GetString("domain_name")), mux)
+
+	vzmgrClient, err := newVZMgrClient()
+	if err != nil {
+		log.WithError(err).Fatal("Failed to initialize vzmgr client")
+	}
+
+	c := controllers.New(db, dbKey, vzmgrClient, net.DefaultResolver)
+	notificationpb.RegisterNotificationServiceServer(s.GRPCServer(), c)
+
+	s.Start()
+	s.StopOnInterrupt()
+}
@@ -0,0 +1,29 @@
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+CREATE EXTENSION IF NOT EXISTS "pgcrypto";
+
+CREATE TABLE webhooks (
+  -- The ID of the webhook.
+  id UUID UNIQUE DEFAULT uuid_generate_v4(),
+  -- org_id is the org which registered the webhook.
+  org_id UUID NOT NULL,
+  -- name is a human readable name for the webhook.
+  name varchar(1024),
+  -- url is the endpoint that notification events are posted to.
+  url varchar(65536) NOT NULL,
+  -- format is the format of the payload that is posted to the url, such as JSON or SLACK.
+  format varchar(64) NOT NULL,
+  -- event_types is the list of event types which should be delivered. If empty, all events are delivered.
+  event_types json NOT NULL DEFAULT '[]',
+  -- cluster_ids is the list of clusters whose events should be delivered. If empty, assumes all clusters in the org.
+  cluster_ids json NOT NULL DEFAULT '[]',
+  -- signing_secret is the encrypted secret used to compute the HMAC signature of each payload.
+  signing_secret bytea NOT NULL,
+  -- enabled is whether events should be delivered to the webhook.
+  enabled boolean NOT NULL DEFAULT true,
+  -- created_at is the time the webhook was registered.
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX idx_webhooks_org_id ON webhooks(org_id);
@@ -0,0 +1,25 @@
+CREATE TABLE webhook_deliveries (
+  -- The ID of the delivery.
+  id UUID UNIQUE DEFAULT uuid_generate_v4(),
+  -- webhook_id is the webhook that the event was delivered to.
+  webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  -- event_id is the ID of the delivered notification event.
+  event_id UUID NOT NULL,
+  -- event_type is the type of the delivered notification event.
+  event_type varchar(64) NOT NULL,
+  -- time is the time the delivery completed, successfully or not.
+  time TIMESTAMP NOT NULL DEFAULT NOW(),
+  -- attempts is the number of attempts made to deliver the event.
+  attempts int NOT NULL,
+  -- response_code is the HTTP status code of the last attempt, or 0 if no response was received.
+  response_code int NOT NULL DEFAULT 0,
+  -- error is the error from the last attempt, if the delivery failed.
+  error varchar,
+  -- success is whether the event was successfully delivered.
+  success boolean NOT NULL,
+
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook_id_time ON webhook_deliveries(webhook_id, time DESC);
+CREATE INDEX idx_webhook_deliveries_time ON webhook_deliveries(time);
@@ -94,6 +94,12 @@ type OrgDatastore interface {
 	GetInviteSigningKey(uuid.UUID) (string, error)
 	// CreateInviteSigningKey creates an invite signing key for the given orgID.
 	CreateInviteSigningKey(uuid.UUID) (string, error)
+	// CreateSCIMToken creates a SCIM provisioning token for the given orgID, replacing any existing token.
+	CreateSCIMToken(uuid.UUID) (string, error)
+	// DeleteSCIMToken deletes the SCIM provisioning token for the given orgID.
+	DeleteSCIMToken(uuid.UUID) error
+	// GetOrgIDBySCIMToken gets the ID of the org that owns the given SCIM provisioning token.
+	GetOrgIDBySCIMToken(string) (uuid.UUID, error)
 }
 
 // UserSettingsDatastore is the interface used to the backing store for user settings.
@@ -162,11 +168,16 @@ func orgInfoToProto(o *datastore.OrgInfo) *profilepb.OrgInfo {
 	if o.DomainName != nil {
 		domainName = &types.StringValue{Value: o.GetDomainName()}
 	}
+	var ownerID *uuidpb.UUID
+	if o.OwnerID != nil {
+		ownerID = utils.ProtoFromUUID(*o.OwnerID)
+	}
 	return &profilepb.OrgInfo{
 		ID:              utils.ProtoFromUUID(o.ID),
 		OrgName:         o.OrgName,
 		DomainName:      domainName,
 		EnableApprovals: o.EnableApprovals,
+		OwnerID:         ownerID,
 	}
 }
 
@@ -325,6 +336,9 @@ func (s *Server) CreateOrg(ctx context.Context, req *profilepb.CreateOrgRequest)
 	if req.DomainName != nil {
 		orgInfo.DomainName = &req.DomainName.Value
 	}
+	if ownerID := utils.UUIDFromProtoOrNil(req.OwnerID); ownerID != uuid.Nil {
+		orgInfo.OwnerID = &ownerID
+	}
 
 	if len(orgInfo.OrgName) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "invalid org name")
@@ -421,6 +435,14 @@ func (s *Server) UpdateUser(ctx context.Context, req *profilepb.UpdateUserReques
 		userInfo.IsApproved = req.IsApproved.Value
 	}
 
+	if req.FirstName != nil {
+		userInfo.FirstName = req.FirstName.Value
+	}
+
+	if req.LastName != nil {
+		userInfo.LastName = req.LastName.Value
+	}
+
 	err = s.uds.UpdateUser(userInfo)
 	if err != nil {
 		return nil, toExternalError(err)
@@ -720,3 +742,48 @@ func (s *Server) VerifyInviteToken(ctx context.Context, req *profilepb.InviteTok
 
 	return &profilepb.VerifyInviteTokenResponse{Valid: true, OrgID: utils.ProtoFromUUID(orgID)}, nil
 }
+
+// CreateSCIMToken creates the token used to authenticate SCIM provisioning requests for the given org.
+func (s *Server) CreateSCIMToken(ctx context.Context, req *uuidpb.UUID) (*profilepb.SCIMToken, error) {
+	orgID := utils.UUIDFromProtoOrNil(req)
+	if orgID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "org ID improperly formatted")
+	}
+	token, err := s.ods.CreateSCIMToken(orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &profilepb.SCIMToken{Token: token}, nil
+}
+
+// RevokeSCIMToken revokes the SCIM provisioning token for the given org.
+func (s *Server) RevokeSCIMToken(ctx context.Context, req *uuidpb.UUID) (*types.Empty, error) {
+	orgID := utils.UUIDFromProtoOrNil(req)
+	if orgID == uuid.Nil {
+		return nil, status.Error(codes.InvalidArgument, "org ID improperly formatted")
+	}
+	err := s.ods.DeleteSCIMToken(orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Empty{}, nil
+}
+
+// GetOrgBySCIMToken gets the org that owns the given SCIM provisioning token.
+func (s *Server) GetOrgBySCIMToken(ctx context.Context, req *profilepb.GetOrgBySCIMTokenRequest) (*profilepb.OrgInfo, error) {
+	if req.Token == "" {
+		return nil, status.Error(codes.InvalidArgument, "token must not be empty")
+	}
+	orgID, err := s.ods.GetOrgIDBySCIMToken(req.Token)
+	if err == datastore.ErrSCIMTokenNotFound {
+		return nil, status.Error(codes.NotFound, "no such SCIM token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	orgInfo, err := s.ods.GetOrg(orgID)
+	if err != nil {
+		return nil, toExternalError(err)
+	}
+	return orgInfoToProto(orgInfo), nil
+}
@@ -272,11 +272,13 @@ func TestServer_CreateOrg(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	testOrgUUID := uuid.Must(uuid.NewV4())
+	testOwnerUUID := uuid.Must(uuid.NewV4())
 	s := controllers.NewServer(nil, nil, nil, ods, osds)
 	domain := "pixielabs.ai"
 	req := &datastore.OrgInfo{
 		OrgName:    "pixie",
 		DomainName: &domain,
+		OwnerID:    &testOwnerUUID,
 	}
 	ods.EXPECT().
 		CreateOrg(req).
@@ -284,6 +286,7 @@ func TestServer_CreateOrg(t *testing.T) {
 	resp, err := s.CreateOrg(context.Background(), &profilepb.CreateOrgRequest{
 		OrgName:    "pixie",
 		DomainName: &types.StringValue{Value: "pixielabs.ai"},
+		OwnerID:    utils.ProtoFromUUID(testOwnerUUID),
 	})
 
 	assert.Nil(t, err)
@@ -716,6 +719,7 @@ func TestServer_GetOrg(t *testing.T) {
 	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
 
 	orgUUID := uuid.Must(uuid.NewV4())
+	ownerUUID := uuid.Must(uuid.NewV4())
 	s := controllers.NewServer(nil, uds, usds, ods, osds)
 
 	orgDomain := "my-org.com"
@@ -723,6 +727,7 @@ func TestServer_GetOrg(t *testing.T) {
 		ID:         orgUUID,
 		DomainName: &orgDomain,
 		OrgName:    "my-org",
+		OwnerID:    &ownerUUID,
 	}
 
 	ods.EXPECT().
@@ -735,6 +740,7 @@ func TestServer_GetOrg(t *testing.T) {
 	assert.Equal(t, utils.ProtoFromUUID(orgUUID), resp.ID)
 	assert.Equal(t, "my-org.com", resp.DomainName.GetValue())
 	assert.Equal(t, "my-org", resp.OrgName)
+	assert.Equal(t, utils.ProtoFromUUID(ownerUUID), resp.OwnerID)
 }
 
 func TestServer_GetOrg_NilDomain(t *testing.T) {
@@ -2015,3 +2021,73 @@ func TestServer_VerifyInvites_BadOrg(t *testing.T) {
 	_, err = s.VerifyInviteToken(ctx, &profilepb.InviteToken{SignedClaims: string(signedClaims)})
 	require.Error(t, err)
 }
+
+func TestServer_CreateSCIMToken(t *testing.T) {
+	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	ctx := CreateTestContext()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+
+	s := controllers.NewServer(nil, uds, usds, ods, osds)
+
+	ods.EXPECT().
+		CreateSCIMToken(orgID).
+		Return("scim_token", nil)
+
+	resp, err := s.CreateSCIMToken(ctx, utils.ProtoFromUUID(orgID))
+	require.NoError(t, err)
+	assert.Equal(t, "scim_token", resp.Token)
+}
+
+func TestServer_GetOrgBySCIMToken(t *testing.T) {
+	orgID := uuid.FromStringOrNil("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	ctx := CreateTestContext()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+
+	s := controllers.NewServer(nil, uds, usds, ods, osds)
+
+	ods.EXPECT().
+		GetOrgIDBySCIMToken("scim_token").
+		Return(orgID, nil)
+	ods.EXPECT().
+		GetOrg(orgID).
+		Return(&datastore.OrgInfo{ID: orgID, OrgName: "my-org"}, nil)
+
+	resp, err := s.GetOrgBySCIMToken(ctx, &profilepb.GetOrgBySCIMTokenRequest{Token: "scim_token"})
+	require.NoError(t, err)
+	assert.Equal(t, utils.ProtoFromUUID(orgID), resp.ID)
+	assert.Equal(t, "my-org", resp.OrgName)
+}
+
+func TestServer_GetOrgBySCIMToken_NotFound(t *testing.T) {
+	ctx := CreateTestContext()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uds := mock_controllers.NewMockUserDatastore(ctrl)
+	ods := mock_controllers.NewMockOrgDatastore(ctrl)
+	usds := mock_controllers.NewMockUserSettingsDatastore(ctrl)
+	osds := mock_controllers.NewMockOrgSettingsDatastore(ctrl)
+
+	s := controllers.NewServer(nil, uds, usds, ods, osds)
+
+	ods.EXPECT().
+		GetOrgIDBySCIMToken("bad_token").
+		Return(uuid.Nil, datastore.ErrSCIMTokenNotFound)
+
+	_, err := s.GetOrgBySCIMToken(ctx, &profilepb.GetOrgBySCIMTokenRequest{Token: "bad_token"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -55,10 +55,11 @@ type UserInfo struct {
 
 // OrgInfo tracks information about an organization.
 type OrgInfo struct {
-	ID              uuid.UUID `db:"id"`
-	OrgName         string    `db:"org_name"`
-	DomainName      *string   `db:"domain_name"`
-	EnableApprovals bool      `db:"enable_approvals"`
+	ID              uuid.UUID  `db:"id"`
+	OrgName         string     `db:"org_name"`
+	DomainName      *string    `db:"domain_name"`
+	EnableApprovals bool       `db:"enable_approvals"`
+	OwnerID         *uuid.UUID `db:"owner_id"`
 }
 
 // GetDomainName is a helper to nil check the DomainName column value and convert
@@ -96,6 +97,8 @@ var (
 	ErrDuplicateOrgName = errors.New("cannot create org (name already in use)")
 	// ErrDuplicateUser is used when the user creation violates unique constraints for auth_provider_id or email.
 	ErrDuplicateUser = errors.New("cannot create duplicate user")
+	// ErrSCIMTokenNotFound is used when no org has the given SCIM token.
+	ErrSCIMTokenNotFound = errors.New("SCIM token not found")
 )
 
 // CreateUser creates a new user.
@@ -185,7 +188,14 @@ func (d *Datastore) CreateUserAndOrg(orgInfo *OrgInfo, userInfo *UserInfo) (uuid
 		return uuid.Nil, uuid.Nil, err
 	}
 
+	// The user who creates the org owns it.
+	_, err = txn.Exec(`UPDATE orgs SET owner_id = $1 WHERE id = $2`, userID, orgID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
 	orgInfo.ID = orgID
+	orgInfo.OwnerID = &userID
 	userInfo.ID = userID
 	userInfo.OrgID = &orgID
 
@@ -194,7 +204,7 @@ func (d *Datastore) CreateUserAndOrg(orgInfo *OrgInfo, userInfo *UserInfo) (uuid
 
 // GetOrg gets org information by ID.
 func (d *Datastore) GetOrg(id uuid.UUID) (*OrgInfo, error) {
-	query := `SELECT id, org_name, domain_name, enable_approvals FROM orgs WHERE id=$1`
+	query := `SELECT id, org_name, domain_name, enable_approvals, owner_id FROM orgs WHERE id=$1`
 	rows, err := d.db.Queryx(query, id)
 	if err != nil {
 		return nil, err
@@ -211,7 +221,7 @@ func (d *Datastore) GetOrg(id uuid.UUID) (*OrgInfo, error) {
 
 // GetOrgs gets all orgs.
 func (d *Datastore) GetOrgs() ([]*OrgInfo, error) {
-	query := `SELECT id, org_name, domain_name, enable_approvals FROM orgs`
+	query := `SELECT id, org_name, domain_name, enable_approvals, owner_id FROM orgs`
 	rows, err := d.db.Queryx(query)
 	if err != nil {
 		return nil, err
@@ -232,7 +242,7 @@ func (d *Datastore) GetOrgs() ([]*OrgInfo, error) {
 
 // GetOrgByName gets org information by domain.
 func (d *Datastore) GetOrgByName(name string) (*OrgInfo, error) {
-	query := `SELECT id, org_name, domain_name, enable_approvals FROM orgs WHERE org_name=$1`
+	query := `SELECT id, org_name, domain_name, enable_approvals, owner_id FROM orgs WHERE org_name=$1`
 	rows, err := d.db.Queryx(query, name)
 	if err != nil {
 		return nil, err
@@ -249,7 +259,7 @@ func (d *Datastore) GetOrgByName(name string) (*OrgInfo, error) {
 
 // GetOrgByDomain gets org information by domain.
 func (d *Datastore) GetOrgByDomain(domainName string) (*OrgInfo, error) {
-	query := `SELECT id, org_name, domain_name, enable_approvals FROM orgs WHERE domain_name=$1`
+	query := `SELECT id, org_name, domain_name, enable_approvals, owner_id FROM orgs WHERE domain_name=$1`
 	rows, err := d.db.Queryx(query, domainName)
 	if err != nil {
 		return nil, err
@@ -313,6 +323,48 @@ func (d *Datastore) CreateInviteSigningKey(id uuid.UUID) (string, error) {
 	return fmt.Sprintf("%x", inviteKey), nil
 }
 
+// CreateSCIMToken creates a SCIM provisioning token for the given orgID, replacing any existing token.
+func (d *Datastore) CreateSCIMToken(orgID uuid.UUID) (string, error) {
+	tokenBytes := make([]byte, 32)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return "", errors.New("could not generate SCIM token")
+	}
+	token := fmt.Sprintf("%x", tokenBytes)
+
+	query := `INSERT INTO org_scim_tokens (org_id, hashed_token) VALUES ($1, sha256($2::bytea))
+		ON CONFLICT (org_id) DO UPDATE SET hashed_token = EXCLUDED.hashed_token, created_at = NOW()`
+	_, err = d.db.Exec(query, orgID, token)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// DeleteSCIMToken deletes the SCIM provisioning token for the given orgID, if any.
+func (d *Datastore) DeleteSCIMToken(orgID uuid.UUID) error {
+	query := `DELETE FROM org_scim_tokens WHERE org_id = $1`
+	_, err := d.db.Exec(query, orgID)
+	return err
+}
+
+// GetOrgIDBySCIMToken gets the ID of the org that owns the given SCIM provisioning token.
+func (d *Datastore) GetOrgIDBySCIMToken(token string) (uuid.UUID, error) {
+	query := `SELECT org_id FROM org_scim_tokens WHERE hashed_token = sha256($1::bytea)`
+	rows, err := d.db.Queryx(query, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var orgID uuid.UUID
+		err := rows.Scan(&orgID)
+		return orgID, err
+	}
+	return uuid.Nil, ErrSCIMTokenNotFound
+}
+
 // GetUserByEmail gets user info by email.
 func (d *Datastore) GetUserByEmail(email string) (*UserInfo, error) {
 	query := `SELECT id, org_id, first_name, last_name, email, profile_picture, is_approved, identity_provider, auth_provider_id FROM users WHERE email=$1`
@@ -394,7 +446,7 @@ func (d *Datastore) createUserUsingTxn(txn *sqlx.Tx, userInfo *UserInfo) (uuid.U
 }
 
 func (d *Datastore) createOrgUsingTxn(txn *sqlx.Tx, orgInfo *OrgInfo) (uuid.UUID, error) {
-	query := `INSERT INTO orgs (org_name, domain_name) VALUES (:org_name, :domain_name) RETURNING id`
+	query := `INSERT INTO orgs (org_name, domain_name, owner_id) VALUES (:org_name, :domain_name, :owner_id) RETURNING id`
 	rows, err := txn.NamedQuery(query, orgInfo)
 	if err != nil {
 		return uuid.Nil, err
@@ -461,7 +513,7 @@ func (d *Datastore) NumUsersInOrg(orgID uuid.UUID) (int, error) {
 
 // UpdateUser updates the user in the database.
 func (d *Datastore) UpdateUser(userInfo *UserInfo) error {
-	query := `UPDATE users SET profile_picture = :profile_picture, is_approved = :is_approved, org_id = :org_id WHERE id = :id`
+	query := `UPDATE users SET first_name = :first_name, last_name = :last_name, profile_picture = :profile_picture, is_approved = :is_approved, org_id = :org_id WHERE id = :id`
 	_, err := d.db.NamedExec(query, userInfo)
 	return err
 }
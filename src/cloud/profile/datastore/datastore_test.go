@@ -63,6 +63,7 @@ func testMain(m *testing.M) error {
 
 func mustLoadTestData(db *sqlx.DB) {
 	// Cleanup.
+	db.MustExec(`DELETE FROM org_scim_tokens`)
 	db.MustExec(`DELETE FROM org_ide_configs`)
 	db.MustExec(`DELETE FROM user_attributes`)
 	db.MustExec(`DELETE FROM user_settings`)
@@ -260,6 +261,12 @@ func TestDatastore(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, userInfo.AuthProviderID, userInfoFetched.AuthProviderID)
 
+		// The user who created the org owns it.
+		orgInfoFetched, err := d.GetOrg(orgID)
+		require.NoError(t, err)
+		require.NotNil(t, orgInfoFetched.OwnerID)
+		assert.Equal(t, userID, *orgInfoFetched.OwnerID)
+
 		// Check value in DB.
 		query := `SELECT * from user_attributes WHERE user_id=$1`
 		rows, err := db.Queryx(query, userID)
@@ -712,4 +719,44 @@ func TestDatastore(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, 2, len(ideConfigs))
 	})
+
+	t.Run("create and rotate SCIM token", func(t *testing.T) {
+		mustLoadTestData(db)
+		d := datastore.NewDatastore(db, "test_key")
+		orgID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+		token, err := d.CreateSCIMToken(orgID)
+		require.NoError(t, err)
+		assert.NotEmpty(t, token)
+
+		fetchedOrgID, err := d.GetOrgIDBySCIMToken(token)
+		require.NoError(t, err)
+		assert.Equal(t, orgID, fetchedOrgID)
+
+		// Creating a new token should invalidate the old one.
+		newToken, err := d.CreateSCIMToken(orgID)
+		require.NoError(t, err)
+		assert.NotEqual(t, token, newToken)
+
+		_, err = d.GetOrgIDBySCIMToken(token)
+		assert.Equal(t, datastore.ErrSCIMTokenNotFound, err)
+		fetchedOrgID, err = d.GetOrgIDBySCIMToken(newToken)
+		require.NoError(t, err)
+		assert.Equal(t, orgID, fetchedOrgID)
+	})
+
+	t.Run("delete SCIM token", func(t *testing.T) {
+		mustLoadTestData(db)
+		d := datastore.NewDatastore(db, "test_key")
+		orgID := uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440000")
+
+		token, err := d.CreateSCIMToken(orgID)
+		require.NoError(t, err)
+
+		err = d.DeleteSCIMToken(orgID)
+		require.NoError(t, err)
+
+		_, err = d.GetOrgIDBySCIMToken(token)
+		assert.Equal(t, datastore.ErrSCIMTokenNotFound, err)
+	})
 }
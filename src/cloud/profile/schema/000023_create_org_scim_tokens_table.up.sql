@@ -0,0 +1,12 @@
+CREATE TABLE org_scim_tokens (
+  org_id UUID,
+  -- The token is a random secret, so it's stored hashed and can be looked up directly by its hash.
+  hashed_token bytea NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY(org_id),
+  FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_org_scim_tokens_hashed_token
+  ON org_scim_tokens(hashed_token);
@@ -0,0 +1 @@
+ALTER TABLE orgs DROP COLUMN owner_id;
@@ -0,0 +1,10 @@
+ALTER TABLE orgs ADD COLUMN owner_id UUID;
+ALTER TABLE orgs ADD FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- Existing orgs are owned by their longest standing approved user.
+UPDATE orgs SET owner_id = (
+  SELECT id FROM users
+  WHERE users.org_id = orgs.id AND users.is_approved
+  ORDER BY users.created_at ASC NULLS LAST
+  LIMIT 1
+);
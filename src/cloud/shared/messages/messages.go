@@ -23,3 +23,8 @@ package messages
 // VizierConnectedChannel is the channel to listen to be notified of Viziers connecting.
 // The message passed along this channel is of type px.cloud.messages.VizierConnected.
 const VizierConnectedChannel = "VizierConnected"
+
+// NotificationEventChannel is the channel that events which should be delivered to an org's
+// notification webhooks are published to.
+// The message passed along this channel is of type px.cloud.messages.NotificationEvent.
+const NotificationEventChannel = "NotificationEvent"
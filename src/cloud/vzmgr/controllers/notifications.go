@@ -0,0 +1,82 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/cloud/shared/messages"
+	"px.dev/pixie/src/cloud/shared/messagespb"
+	"px.dev/pixie/src/utils"
+)
+
+// publishNotificationEvent publishes an event which should be delivered to the webhooks of the org that
+// owns the given Vizier. Failures are logged, since notifications are best effort.
+func publishNotificationEvent(db *sqlx.DB, nc *nats.Conn, vizierID uuid.UUID, eventType messagespb.NotificationEventType,
+	message string, details map[string]string) {
+	if nc == nil {
+		return
+	}
+
+	var orgID uuid.UUID
+	err := db.Get(&orgID, `SELECT org_id FROM vizier_cluster WHERE id=$1`, vizierID)
+	if err != nil {
+		log.WithError(err).WithField("vizier_id", vizierID).Error("Failed to find org for notification event")
+		return
+	}
+
+	ev := &messagespb.NotificationEvent{
+		ID:       utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+		OrgID:    utils.ProtoFromUUID(orgID),
+		VizierID: utils.ProtoFromUUID(vizierID),
+		Type:     eventType,
+		Time:     types.TimestampNow(),
+		Message:  message,
+		Details:  details,
+	}
+	b, err := ev.Marshal()
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal notification event")
+		return
+	}
+	err = nc.Publish(messages.NotificationEventChannel, b)
+	if err != nil {
+		log.WithError(err).Error("Failed to publish notification event")
+	}
+}
+
+// publishStatusChangeEvent publishes a notification for a Vizier transitioning between the given statuses.
+func publishStatusChangeEvent(db *sqlx.DB, nc *nats.Conn, vizierID uuid.UUID, prevStatus vizierStatus, status vizierStatus,
+	statusMessage string) {
+	message := fmt.Sprintf("Vizier %s changed status from %s to %s", vizierID.String(), prevStatus.Stringify(), status.Stringify())
+	if statusMessage != "" {
+		message = fmt.Sprintf("%s: %s", message, statusMessage)
+	}
+	publishNotificationEvent(db, nc, vizierID, messagespb.NE_VIZIER_STATUS_CHANGED, message, map[string]string{
+		"prev_status":    prevStatus.Stringify(),
+		"status":         status.Stringify(),
+		"status_message": statusMessage,
+	})
+}
@@ -26,6 +26,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -262,6 +263,7 @@ type VizierInfo struct {
 	OrgID                         uuid.UUID     `db:"org_id"`
 	PrevStatus                    *vizierStatus `db:"prev_status"`
 	PrevStatusTime                *time.Time    `db:"prev_status_time"`
+	Labels                        ClusterLabels `db:"labels"`
 }
 
 func vizierInfoToProto(vzInfo VizierInfo) *cvmsgspb.VizierInfo {
@@ -316,6 +318,7 @@ func vizierInfoToProto(vzInfo VizierInfo) *cvmsgspb.VizierInfo {
 		NumInstrumentedNodes:          vzInfo.NumInstrumentedNodes,
 		PreviousStatus:                prevStatus,
 		PreviousStatusTime:            prevStatusTime,
+		Labels:                        vzInfo.Labels,
 	}
 }
 
@@ -339,7 +342,7 @@ func (s *Server) GetVizierInfos(ctx context.Context, req *vzmgrpb.GetVizierInfos
 	strQuery := `SELECT i.vizier_cluster_id, c.cluster_uid, c.cluster_name, i.cluster_version, i.vizier_version, c.org_id,
 			  i.status, (EXTRACT(EPOCH FROM age(now(), i.last_heartbeat))*1E9)::bigint as last_heartbeat,
               i.control_plane_pod_statuses, i.unhealthy_data_plane_pod_statuses,
-							i.num_nodes, i.num_instrumented_nodes, i.status_message, i.prev_status, i.prev_status_time
+							i.num_nodes, i.num_instrumented_nodes, i.status_message, i.prev_status, i.prev_status_time, c.labels
               FROM vizier_cluster_info as i, vizier_cluster as c
               WHERE i.vizier_cluster_id=c.id AND i.vizier_cluster_id IN (?) AND c.org_id='%s'`
 	strQuery = fmt.Sprintf(strQuery, orgIDstr)
@@ -392,7 +395,7 @@ func (s *Server) GetVizierInfo(ctx context.Context, req *uuidpb.UUID) (*cvmsgspb
 	query := `SELECT i.vizier_cluster_id, c.cluster_uid, c.cluster_name, i.cluster_version, i.vizier_version,
 			  i.status, (EXTRACT(EPOCH FROM age(now(), i.last_heartbeat))*1E9)::bigint as last_heartbeat,
               i.control_plane_pod_statuses, i.unhealthy_data_plane_pod_statuses,
-							i.num_nodes, i.num_instrumented_nodes, i.status_message, i.prev_status, i.prev_status_time
+							i.num_nodes, i.num_instrumented_nodes, i.status_message, i.prev_status, i.prev_status_time, c.labels
               from vizier_cluster_info as i, vizier_cluster as c
               WHERE i.vizier_cluster_id=$1 AND i.vizier_cluster_id=c.id`
 	vzInfo := VizierInfo{}
@@ -457,6 +460,18 @@ func (s *Server) GetVizierConnectionInfo(ctx context.Context, req *uuidpb.UUID)
 	// Generate a signed token for this cluster.
 	jwtKey := info.JWTSigningKey[SaltLength:]
 	claims := jwtutils.GenerateJWTForCluster("vizier_cluster", "vizier")
+	// Sign the token with the user that requested it, so that Vizier can attribute and authorize the user's
+	// requests without trusting anything the user sends alongside the token.
+	sCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if userClaims := sCtx.Claims.GetUserClaims(); userClaims != nil {
+		claims.GetClusterClaims().User = userClaims.Email
+		if userClaims.Email == "" {
+			claims.GetClusterClaims().User = userClaims.UserID
+		}
+	}
 	tokenString, err := jwtutils.SignJWTClaims(claims, jwtKey)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to sign token: %s", err.Error())
@@ -527,11 +542,15 @@ func (s *Server) VizierConnected(ctx context.Context, req *cvmsgspb.RegisterVizi
 	vzVersion := ""
 	clusterUID := ""
 	clusterName := ""
+	var labels ClusterLabels
+	labelsKnown := false
 
 	if req.ClusterInfo != nil {
 		vzVersion = req.ClusterInfo.VizierVersion
 		clusterUID = req.ClusterInfo.ClusterUID
 		clusterName = req.ClusterInfo.ClusterName
+		labels = req.ClusterInfo.Labels
+		labelsKnown = req.ClusterInfo.LabelsKnown
 	}
 
 	loggerWithCtx := log.WithContext(ctx).
@@ -567,6 +586,20 @@ func (s *Server) VizierConnected(ctx context.Context, req *cvmsgspb.RegisterVizi
 		return nil, status.Error(codes.NotFound, "no such cluster")
 	}
 
+	// The labels are specified in the Vizier CRD, so the Vizier's labels always take precedence over the default
+	// labels of the deployment key that the cluster was registered with. If the Vizier couldn't read its labels,
+	// the stored labels are left untouched.
+	if labelsKnown {
+		query = `UPDATE vizier_cluster SET labels=(
+                   COALESCE((SELECT k.default_labels::jsonb FROM vizier_deployment_keys AS k WHERE k.id=deployment_key_id), '{}'::jsonb)
+                   || $1::jsonb)::json
+                 WHERE id=$2`
+		_, err = s.db.Exec(query, labels, vizierID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Send a message over NATS to signal that a Vizier has connected.
 	query = `SELECT org_id, cluster_name from vizier_cluster WHERE id=$1`
 	var val struct {
@@ -631,11 +664,13 @@ func (s *Server) HandleVizierHeartbeat(v2cMsg *cvmsgspb.V2CMessage) {
 		  OR ((x.num_instrumented_nodes is not NULL) AND (x.num_instrumented_nodes != y.num_instrumented_nodes))
 		  OR ((x.auto_update_enabled IS NOT NULL) AND (x.auto_update_enabled != y.auto_update_enabled))
 		  OR ((x.cluster_version IS NOT NULL) AND (x.cluster_version != y.cluster_version))
-		  OR ((x.status_message is not NULL) AND (x.status_message != y.status_message))) as changed, x.vizier_version`
+		  OR ((x.status_message is not NULL) AND (x.status_message != y.status_message))) as changed, x.vizier_version,
+		  y.status as prev_status`
 
 	var info struct {
-		Changed bool   `db:"changed"`
-		Version string `db:"vizier_version"`
+		Changed    bool         `db:"changed"`
+		Version    string       `db:"vizier_version"`
+		PrevStatus vizierStatus `db:"prev_status"`
 	}
 
 	rows, err := s.db.Queryx(query, time.Now(), vizierStatus(req.Status), PodStatuses(req.PodStatuses), req.NumNodes,
@@ -676,6 +711,10 @@ func (s *Server) HandleVizierHeartbeat(v2cMsg *cvmsgspb.V2CMessage) {
 		})
 	}
 
+	if info.PrevStatus != vizierStatus(req.Status) {
+		publishStatusChangeEvent(s.db, s.nc, vizierID, info.PrevStatus, vizierStatus(req.Status), req.StatusMessage)
+	}
+
 	if req.Status == cvmsgspb.VZ_ST_UPDATING {
 		return
 	}
@@ -789,8 +828,25 @@ func setClusterName(ctx context.Context, tx *sqlx.Tx, clusterID uuid.UUID, gener
 	return finalName, err
 }
 
+// checkClusterNamePattern checks that the cluster name matches the pattern required by the deployment key, if any.
+func checkClusterNamePattern(deployKey *vzmgrpb.DeploymentKey, name string) error {
+	if deployKey == nil || deployKey.Restrictions == nil || deployKey.Restrictions.ClusterNamePattern == "" {
+		return nil
+	}
+	pattern := deployKey.Restrictions.ClusterNamePattern
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid cluster name pattern for deployment key: %w", err)
+	}
+	if !re.MatchString(name) {
+		return fmt.Errorf("%w: cluster name '%s' does not match '%s'", vzerrors.ErrClusterNamePatternMismatch, name, pattern)
+	}
+	return nil
+}
+
 // ProvisionOrClaimVizier provisions a given cluster or returns the ID if it already exists,
-func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, clusterUID string, clusterName string) (uuid.UUID, string, error) {
+// If a deployment key is specified, the cluster is associated with the key and the key's cluster limit is enforced.
+func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, clusterUID string, clusterName string, deployKey *vzmgrpb.DeploymentKey) (uuid.UUID, string, error) {
 	// TODO(zasgar): This duplicates some functionality in the Create function. Will deprecate that Create function soon.
 	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
@@ -814,20 +870,73 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 		return name
 	}
 
-	assignNameAndCommit := func() (uuid.UUID, string, error) {
+	deployKeyID := uuid.Nil
+	if deployKey != nil {
+		deployKeyID = utils.UUIDFromProtoOrNil(deployKey.ID)
+	}
+
+	checkClusterLimit := func() error {
+		if deployKeyID == uuid.Nil {
+			return nil
+		}
+		// Lock the key, so that concurrent registrations using the same key can't exceed the limit.
+		var maxClusters int64
+		query := `SELECT max_clusters FROM vizier_deployment_keys WHERE id=$1 FOR UPDATE`
+		err := tx.QueryRowxContext(ctx, query, deployKeyID).Scan(&maxClusters)
+		if err == sql.ErrNoRows {
+			return vzerrors.ErrDeploymentKeyNotFound
+		}
+		if err != nil {
+			return vzerrors.ErrInternalDB
+		}
+		if maxClusters == 0 {
+			return nil
+		}
+
+		var numClusters int64
+		query = `SELECT COUNT(*) FROM vizier_cluster WHERE deployment_key_id=$1`
+		err = tx.QueryRowxContext(ctx, query, deployKeyID).Scan(&numClusters)
+		if err != nil {
+			return vzerrors.ErrInternalDB
+		}
+		if numClusters >= maxClusters {
+			return vzerrors.ErrDeploymentKeyClusterLimitReached
+		}
+		return nil
+	}
+
+	assignDeploymentKey := func() error {
+		if deployKeyID == uuid.Nil {
+			return nil
+		}
+		var defaultLabels ClusterLabels
+		if deployKey.Restrictions != nil {
+			defaultLabels = deployKey.Restrictions.DefaultLabels
+		}
+		query := `UPDATE vizier_cluster SET deployment_key_id=$1, labels=$2 WHERE id=$3`
+		_, err := tx.ExecContext(ctx, query, deployKeyID, defaultLabels, clusterID)
+		if err != nil {
+			return vzerrors.ErrInternalDB
+		}
+		return nil
+	}
+
+	// assignName assigns a name to the cluster, if needed. Returns the cluster's final name, and whether a new name
+	// was assigned.
+	assignName := func() (string, bool, error) {
 		// Check if cluster already has a name.
 		var existingName *string
 
 		query := `SELECT cluster_name from vizier_cluster WHERE id=$1`
 		err := tx.QueryRowxContext(ctx, query, clusterID).Scan(&existingName)
 		if err != nil {
-			return uuid.Nil, "", vzerrors.ErrInternalDB
+			return "", false, vzerrors.ErrInternalDB
 		}
 
 		if existingName != nil {
 			// No input name specified, so no need to change cluster name.
 			if inputName == "" {
-				return clusterID, *existingName, nil
+				return *existingName, false, nil
 			}
 
 			// The existing name is already the same as the input name, or a derivation
@@ -838,14 +947,14 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 			// cannot distinguish between randomly generated names and actual-unaltered names.
 			dbName := *existingName
 			if inputName == dbName {
-				return clusterID, *existingName, nil
+				return *existingName, false, nil
 			}
 			prefixIndex := strings.LastIndex(dbName, "_")
 			if prefixIndex != -1 {
 				dbName = dbName[:prefixIndex]
 			}
 			if inputName == dbName {
-				return clusterID, *existingName, nil
+				return *existingName, false, nil
 			}
 		}
 
@@ -856,7 +965,24 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 
 		finalName, err := setClusterName(ctx, tx, clusterID, generateNameFunc)
 		if err != nil {
-			return uuid.Nil, "", vzerrors.ErrInternalDB
+			return "", false, vzerrors.ErrInternalDB
+		}
+		return finalName, true, nil
+	}
+
+	assignNameAndCommit := func() (uuid.UUID, string, error) {
+		if err := assignDeploymentKey(); err != nil {
+			return uuid.Nil, "", err
+		}
+
+		finalName, named, err := assignName()
+		if err != nil {
+			return uuid.Nil, "", err
+		}
+		// The name pattern is checked against the final name, which may differ from the requested name if the
+		// cluster already had a name, the requested name was taken, or no name was requested.
+		if err := checkClusterNamePattern(deployKey, finalName); err != nil {
+			return uuid.Nil, "", err
 		}
 
 		if err := tx.Commit(); err != nil {
@@ -864,6 +990,9 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 			return uuid.Nil, "", vzerrors.ErrInternalDB
 		}
 
+		if !named {
+			return clusterID, finalName, nil
+		}
 		events.Client().Enqueue(&analytics.Track{
 			UserId: clusterID.String(),
 			Event:  events.VizierCreated,
@@ -882,9 +1011,25 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 		if status != vizierStatus(cvmsgspb.VZ_ST_DISCONNECTED) {
 			return uuid.Nil, "", vzerrors.ErrProvisionFailedVizierIsActive
 		}
+		// A cluster which was previously registered with the same key doesn't count against the key's limit again.
+		var existingKeyID *uuid.UUID
+		query := `SELECT deployment_key_id FROM vizier_cluster WHERE id=$1`
+		err := tx.QueryRowxContext(ctx, query, clusterID).Scan(&existingKeyID)
+		if err != nil {
+			return uuid.Nil, "", vzerrors.ErrInternalDB
+		}
+		if existingKeyID == nil || *existingKeyID != deployKeyID {
+			if err := checkClusterLimit(); err != nil {
+				return uuid.Nil, "", err
+			}
+		}
 		return assignNameAndCommit()
 	}
 
+	if err := checkClusterLimit(); err != nil {
+		return uuid.Nil, "", err
+	}
+
 	clusterID, _, err = findVizierWithEmptyUID(ctx, tx, orgID)
 	if err != nil {
 		return uuid.Nil, "", err
@@ -913,6 +1058,74 @@ func (s *Server) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, us
 	return assignNameAndCommit()
 }
 
+const defaultStatusHistoryLimit = 100
+
+// GetVizierStatusHistory returns the status transitions of the specified Vizier, ordered from newest to oldest.
+func (s *Server) GetVizierStatusHistory(ctx context.Context, req *vzmgrpb.GetVizierStatusHistoryRequest) (*vzmgrpb.GetVizierStatusHistoryResponse, error) {
+	if err := s.validateOrgOwnsCluster(ctx, req.VizierID); err != nil {
+		return nil, err
+	}
+	vizierID := utils.UUIDFromProtoOrNil(req.VizierID)
+
+	startTime := time.Unix(0, 0)
+	if req.StartTime != nil {
+		t, err := types.TimestampFromProto(req.StartTime)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid start time")
+		}
+		startTime = t
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultStatusHistoryLimit
+	}
+
+	query := `SELECT time, status, prev_status, status_message, control_plane_pod_statuses, unhealthy_data_plane_pod_statuses
+              FROM vizier_status_history
+              WHERE vizier_cluster_id=$1 AND time >= $2
+              ORDER BY time DESC LIMIT $3`
+	rows, err := s.db.QueryxContext(ctx, query, vizierID, startTime, limit)
+	if err != nil {
+		log.WithError(err).Error("Could not query Vizier status history")
+		return nil, status.Error(codes.Internal, "could not query for status history")
+	}
+	defer rows.Close()
+
+	transitions := make([]*vzmgrpb.VizierStatusTransition, 0)
+	for rows.Next() {
+		var t struct {
+			Time                          time.Time     `db:"time"`
+			Status                        vizierStatus  `db:"status"`
+			PrevStatus                    *vizierStatus `db:"prev_status"`
+			StatusMessage                 *string       `db:"status_message"`
+			ControlPlanePodStatuses       PodStatuses   `db:"control_plane_pod_statuses"`
+			UnhealthyDataPlanePodStatuses PodStatuses   `db:"unhealthy_data_plane_pod_statuses"`
+		}
+		err := rows.StructScan(&t)
+		if err != nil {
+			log.WithError(err).Error("Could not read Vizier status history")
+			return nil, status.Error(codes.Internal, "could not query for status history")
+		}
+
+		ts, _ := types.TimestampProto(t.Time)
+		transition := &vzmgrpb.VizierStatusTransition{
+			Time:                          ts,
+			Status:                        t.Status.ToProto(),
+			ControlPlanePodStatuses:       t.ControlPlanePodStatuses,
+			UnhealthyDataPlanePodStatuses: t.UnhealthyDataPlanePodStatuses,
+		}
+		if t.PrevStatus != nil {
+			transition.PrevStatus = t.PrevStatus.ToProto()
+		}
+		if t.StatusMessage != nil {
+			transition.StatusMessage = *t.StatusMessage
+		}
+		transitions = append(transitions, transition)
+	}
+
+	return &vzmgrpb.GetVizierStatusHistoryResponse{Transitions: transitions}, nil
+}
+
 // GetOrgFromVizier fetches the org to which a Vizier belongs. This is intended to be for internal use only.
 func (s *Server) GetOrgFromVizier(ctx context.Context, id *uuidpb.UUID) (*vzmgrpb.GetOrgFromVizierResponse, error) {
 	query := `SELECT org_id FROM vizier_cluster where id=$1`
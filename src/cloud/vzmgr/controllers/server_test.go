@@ -41,6 +41,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/cloud/shared/messages"
 	"px.dev/pixie/src/cloud/shared/messagespb"
 	"px.dev/pixie/src/cloud/vzmgr/controllers"
 	mock_controllers "px.dev/pixie/src/cloud/vzmgr/controllers/mock"
@@ -129,6 +130,7 @@ func mustLoadTestData(db *sqlx.DB) {
 	db.MustExec(insertCluster, testAuthOrgID, testExistingClusterActive, testProjectName, "my_other_cluster", "existing_cluster")
 	db.MustExec(insertCluster, testNonAuthOrgID, "223e4567-e89b-12d3-a456-426655440003", testProjectName, "k8s5", "non_auth_1")
 	db.MustExec(insertCluster, testNonAuthOrgID, "323e4567-e89b-12d3-a456-426655440003", testProjectName, "k8s6", "non_auth_2")
+	db.MustExec(`UPDATE vizier_cluster SET labels=$1 WHERE id=$2`, `{"env": "prod", "region": "eu"}`, "123e4567-e89b-12d3-a456-426655440001")
 
 	testPastStatus := "UNHEALTHY"
 
@@ -251,6 +253,7 @@ func TestServer_GetVizierInfo(t *testing.T) {
 	assert.Equal(t, "This is a test", resp.StatusMessage)
 	assert.Equal(t, cvmsgspb.VZ_ST_UNHEALTHY, resp.PreviousStatus)
 	assert.NotNil(t, resp.PreviousStatusTime)
+	assert.Equal(t, map[string]string{"env": "prod", "region": "eu"}, resp.Labels)
 
 	// Test that the empty pods list case works.
 	assert.Equal(t, make(controllers.PodStatuses), controllers.PodStatuses(resp.ControlPlanePodStatuses))
@@ -288,8 +291,10 @@ func TestServer_GetVizierInfos(t *testing.T) {
 	assert.Equal(t, "This is a test", resp.VizierInfos[0].StatusMessage)
 	assert.Equal(t, &cvmsgspb.VizierInfo{}, resp.VizierInfos[1])
 	assert.Equal(t, &cvmsgspb.VizierInfo{}, resp.VizierInfos[2])
+	assert.Equal(t, map[string]string{"env": "prod", "region": "eu"}, resp.VizierInfos[0].Labels)
 	assert.Equal(t, utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440000"), resp.VizierInfos[3].VizierID)
 	assert.Equal(t, "k8sID", resp.VizierInfos[3].ClusterUID)
+	assert.Equal(t, map[string]string{}, resp.VizierInfos[3].Labels)
 }
 
 func TestServer_GetVizierConnectionInfo(t *testing.T) {
@@ -310,6 +315,7 @@ func TestServer_GetVizierConnectionInfo(t *testing.T) {
 	require.NoError(t, err)
 
 	assert.Equal(t, []string{"cluster"}, srvutils.GetScopes(token))
+	assert.Equal(t, "test@test.com", srvutils.GetClusterUser(token))
 }
 
 func TestServer_VizierConnectedHealthy(t *testing.T) {
@@ -336,6 +342,8 @@ func TestServer_VizierConnectedHealthy(t *testing.T) {
 		ClusterInfo: &cvmsgspb.VizierClusterInfo{
 			ClusterUID:    "cUID",
 			VizierVersion: "some version",
+			Labels:        map[string]string{"env": "staging"},
+			LabelsKnown:   true,
 		},
 	}
 
@@ -361,6 +369,11 @@ func TestServer_VizierConnectedHealthy(t *testing.T) {
 	assert.Equal(t, "CONNECTED", clusterInfo.Status)
 	assert.Equal(t, "some version", clusterInfo.VizierVersion)
 
+	var labels controllers.ClusterLabels
+	err = db.Get(&labels, `SELECT labels from vizier_cluster WHERE id=$1`, clusterID)
+	require.NoError(t, err)
+	assert.Equal(t, controllers.ClusterLabels{"env": "staging"}, labels)
+
 	select {
 	case msg := <-subCh:
 		req := &messagespb.VizierConnected{}
@@ -377,6 +390,33 @@ func TestServer_VizierConnectedHealthy(t *testing.T) {
 	// TODO(zasgar): write more tests here.
 }
 
+func TestServer_VizierConnected_UnknownLabels(t *testing.T) {
+	mustLoadTestData(db)
+
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	s := controllers.New(db, "test", nc, nil)
+	req := &cvmsgspb.RegisterVizierRequest{
+		VizierID: utils.ProtoFromUUIDStrOrNil("123e4567-e89b-12d3-a456-426655440001"),
+		JwtKey:   "the-token",
+		ClusterInfo: &cvmsgspb.VizierClusterInfo{
+			ClusterUID:    "cUID",
+			VizierVersion: "some version",
+		},
+	}
+
+	resp, err := s.VizierConnected(context.Background(), req)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	// The Vizier couldn't read its labels, so the stored labels should be kept.
+	var labels controllers.ClusterLabels
+	err = db.Get(&labels, `SELECT labels from vizier_cluster WHERE id=$1`, "123e4567-e89b-12d3-a456-426655440001")
+	require.NoError(t, err)
+	assert.Equal(t, controllers.ClusterLabels{"env": "prod", "region": "eu"}, labels)
+}
+
 func TestServer_HandleVizierHeartbeat(t *testing.T) {
 	mustLoadTestData(db)
 
@@ -574,6 +614,54 @@ func TestServer_HandleVizierHeartbeat(t *testing.T) {
 	}
 }
 
+func TestServer_HandleVizierHeartbeat_StatusChangeNotification(t *testing.T) {
+	mustLoadTestData(db)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	vizierID := "223e4567-e89b-12d3-a456-426655440003"
+	updater := mock_controllers.NewMockVzUpdater(ctrl)
+	updater.EXPECT().VersionUpToDate(gomock.Any()).Return(true)
+	s := controllers.New(db, "test", nc, updater)
+
+	evCh := make(chan *nats.Msg, 1)
+	sub, err := nc.ChanSubscribe(messages.NotificationEventChannel, evCh)
+	require.NoError(t, err)
+	defer func() {
+		err := sub.Unsubscribe()
+		require.NoError(t, err)
+	}()
+
+	nestedAny, err := types.MarshalAny(&cvmsgspb.VizierHeartbeat{
+		VizierID:      utils.ProtoFromUUIDStrOrNil(vizierID),
+		Status:        cvmsgspb.VZ_ST_UNHEALTHY,
+		StatusMessage: "pods failing",
+	})
+	require.NoError(t, err)
+	s.HandleVizierHeartbeat(&cvmsgspb.V2CMessage{Msg: nestedAny})
+
+	select {
+	case msg := <-evCh:
+		ev := &messagespb.NotificationEvent{}
+		err := proto.Unmarshal(msg.Data, ev)
+		require.NoError(t, err)
+		assert.Equal(t, messagespb.NE_VIZIER_STATUS_CHANGED, ev.Type)
+		assert.Equal(t, utils.ProtoFromUUIDStrOrNil(testNonAuthOrgID), ev.OrgID)
+		assert.Equal(t, utils.ProtoFromUUIDStrOrNil(vizierID), ev.VizierID)
+		assert.Equal(t, map[string]string{
+			"prev_status":    "HEALTHY",
+			"status":         "UNHEALTHY",
+			"status_message": "pods failing",
+		}, ev.Details)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for notification event")
+	}
+}
+
 func TestServer_UpdateOrInstallVizier(t *testing.T) {
 	mustLoadTestData(db)
 
@@ -746,7 +834,7 @@ func TestServer_ProvisionOrClaimVizier(t *testing.T) {
 	userID := uuid.Must(uuid.NewV4())
 
 	// This should select the first cluster with an empty UID that is disconnected.
-	clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "my cluster", "")
+	clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "my cluster", "", nil)
 	require.NoError(t, err)
 	// Should select the disconnected cluster.
 	assert.Equal(t, testDisconnectedClusterEmptyUID, clusterID.String())
@@ -795,7 +883,7 @@ func TestServer_ProvisionOrClaimVizierWIthExistingUID(t *testing.T) {
 			userID := uuid.Must(uuid.NewV4())
 
 			// This should select the existing cluster with the same UID.
-			clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "existing_cluster", test.inputName)
+			clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "existing_cluster", test.inputName, nil)
 			require.NoError(t, err)
 			// Should select the disconnected cluster.
 			assert.Equal(t, testExistingCluster, clusterID.String())
@@ -810,7 +898,7 @@ func TestServer_ProvisionOrClaimVizier_WithExistingActiveUID(t *testing.T) {
 	s := controllers.New(db, "test", nil, nil)
 	userID := uuid.Must(uuid.NewV4())
 	// This should select cause an error b/c we are trying to provision a cluster that is not disconnected.
-	clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "my_other_cluster", "")
+	clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "my_other_cluster", "", nil)
 	assert.NotNil(t, err)
 	assert.Equal(t, vzerrors.ErrProvisionFailedVizierIsActive, err)
 	assert.Equal(t, uuid.Nil, clusterID)
@@ -823,7 +911,7 @@ func TestServer_ProvisionOrClaimVizier_WithNewCluster(t *testing.T) {
 	s := controllers.New(db, "test", nil, nil)
 	userID := uuid.Must(uuid.NewV4())
 	// This should select cause an error b/c we are trying to provision a cluster that is not disconnected.
-	clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testNonAuthOrgID), userID, "my_other_cluster", "")
+	clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testNonAuthOrgID), userID, "my_other_cluster", "", nil)
 	require.NoError(t, err)
 	assert.NotEqual(t, uuid.Nil, clusterID)
 	// Some random name should get assigned by the nameGenerator.
@@ -837,13 +925,108 @@ func TestServer_ProvisionOrClaimVizier_WithExistingName(t *testing.T) {
 	userID := uuid.Must(uuid.NewV4())
 
 	// This should select the existing cluster with the same UID.
-	clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "some_cluster", "test_cluster_1234\n")
+	clusterID, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, "some_cluster", "test_cluster_1234\n", nil)
 	require.NoError(t, err)
 	// Should select the disconnected cluster.
 	assert.Equal(t, testDisconnectedClusterEmptyUID, clusterID.String())
 	assert.True(t, strings.HasPrefix(clusterName, "test_cluster_1234_"))
 }
 
+func TestServer_ProvisionOrClaimVizier_WithDeploymentKeyLimit(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`DELETE FROM vizier_deployment_keys`)
+
+	keyID := uuid.Must(uuid.NewV4())
+	insertKey := `INSERT INTO vizier_deployment_keys(id, org_id, user_id, max_clusters, default_labels) VALUES ($1, $2, $3, $4, $5)`
+	db.MustExec(insertKey, keyID, testNonAuthOrgID, uuid.Must(uuid.NewV4()), 1, `{"team": "infra"}`)
+
+	deployKey := &vzmgrpb.DeploymentKey{
+		ID: utils.ProtoFromUUID(keyID),
+		Restrictions: &vzmgrpb.DeploymentKeyRestrictions{
+			MaxClusters:   1,
+			DefaultLabels: map[string]string{"team": "infra"},
+		},
+	}
+
+	s := controllers.New(db, "test", nil, nil)
+	userID := uuid.Must(uuid.NewV4())
+
+	clusterID, _, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testNonAuthOrgID), userID, "new_cluster_1", "", deployKey)
+	require.NoError(t, err)
+
+	var labels controllers.ClusterLabels
+	var storedKeyID uuid.UUID
+	err = db.QueryRow(`SELECT labels, deployment_key_id FROM vizier_cluster WHERE id=$1`, clusterID).Scan(&labels, &storedKeyID)
+	require.NoError(t, err)
+	assert.Equal(t, controllers.ClusterLabels{"team": "infra"}, labels)
+	assert.Equal(t, keyID, storedKeyID)
+
+	// Re-registering the same cluster shouldn't count against the limit.
+	sameClusterID, _, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testNonAuthOrgID), userID, "new_cluster_1", "", deployKey)
+	require.NoError(t, err)
+	assert.Equal(t, clusterID, sameClusterID)
+
+	// Registering a new cluster should exceed the limit.
+	_, _, err = s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testNonAuthOrgID), userID, "new_cluster_2", "", deployKey)
+	assert.Equal(t, vzerrors.ErrDeploymentKeyClusterLimitReached, err)
+}
+
+func TestServer_ProvisionOrClaimVizier_WithClusterNamePattern(t *testing.T) {
+	tests := []struct {
+		name        string
+		clusterUID  string
+		inputName   string
+		expectedErr error
+	}{
+		{
+			name:       "matching name",
+			clusterUID: "new_cluster",
+			inputName:  "test_cluster",
+		},
+		{
+			name:        "partially matching name",
+			clusterUID:  "new_cluster",
+			inputName:   "test_cluster_2",
+			expectedErr: vzerrors.ErrClusterNamePatternMismatch,
+		},
+		{
+			name:        "generated name",
+			clusterUID:  "new_cluster",
+			inputName:   "",
+			expectedErr: vzerrors.ErrClusterNamePatternMismatch,
+		},
+		{
+			// The requested name matches, but the existing cluster keeps its deduplicated name.
+			name:        "existing name",
+			clusterUID:  "existing_cluster",
+			inputName:   "test_cluster",
+			expectedErr: vzerrors.ErrClusterNamePatternMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			deployKey := &vzmgrpb.DeploymentKey{
+				Restrictions: &vzmgrpb.DeploymentKeyRestrictions{
+					ClusterNamePattern: "test_[a-z]+",
+				},
+			}
+			s := controllers.New(db, "test", nil, nil)
+			userID := uuid.Must(uuid.NewV4())
+
+			_, clusterName, err := s.ProvisionOrClaimVizier(context.Background(), uuid.FromStringOrNil(testAuthOrgID), userID, test.clusterUID, test.inputName, deployKey)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.inputName, clusterName)
+		})
+	}
+}
+
 func TestServer_GetOrgFromVizier(t *testing.T) {
 	mustLoadTestData(db)
 
@@ -853,3 +1036,60 @@ func TestServer_GetOrgFromVizier(t *testing.T) {
 	require.NotNil(t, resp)
 	assert.Equal(t, &vzmgrpb.GetOrgFromVizierResponse{OrgID: utils.ProtoFromUUIDStrOrNil(testAuthOrgID)}, resp)
 }
+
+func TestServer_GetVizierStatusHistory(t *testing.T) {
+	mustLoadTestData(db)
+
+	vizierID := "123e4567-e89b-12d3-a456-426655440001"
+	updateStatus := `UPDATE vizier_cluster_info SET status=$1, status_message=$2 WHERE vizier_cluster_id=$3`
+	db.MustExec(updateStatus, "DEGRADED", "PEMs are crashing", vizierID)
+	db.MustExec(updateStatus, "DISCONNECTED", "lost connection", vizierID)
+	// Updates which don't change the status should not be recorded.
+	db.MustExec(updateStatus, "DISCONNECTED", "still disconnected", vizierID)
+
+	s := controllers.New(db, "test", nil, nil)
+
+	t.Run("all", func(t *testing.T) {
+		resp, err := s.GetVizierStatusHistory(CreateTestContext(), &vzmgrpb.GetVizierStatusHistoryRequest{
+			VizierID: utils.ProtoFromUUIDStrOrNil(vizierID),
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, len(resp.Transitions))
+
+		assert.Equal(t, cvmsgspb.VZ_ST_DISCONNECTED, resp.Transitions[0].Status)
+		assert.Equal(t, cvmsgspb.VZ_ST_DEGRADED, resp.Transitions[0].PrevStatus)
+		assert.Equal(t, "lost connection", resp.Transitions[0].StatusMessage)
+		assert.Equal(t, cvmsgspb.VZ_ST_DEGRADED, resp.Transitions[1].Status)
+		assert.Equal(t, cvmsgspb.VZ_ST_HEALTHY, resp.Transitions[1].PrevStatus)
+		assert.Equal(t, "PEMs are crashing", resp.Transitions[1].StatusMessage)
+		assert.NotNil(t, resp.Transitions[1].Time)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		resp, err := s.GetVizierStatusHistory(CreateTestContext(), &vzmgrpb.GetVizierStatusHistoryRequest{
+			VizierID: utils.ProtoFromUUIDStrOrNil(vizierID),
+			Limit:    1,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, len(resp.Transitions))
+		assert.Equal(t, cvmsgspb.VZ_ST_DISCONNECTED, resp.Transitions[0].Status)
+	})
+
+	t.Run("start time", func(t *testing.T) {
+		startTime, _ := types.TimestampProto(time.Now().Add(time.Hour))
+		resp, err := s.GetVizierStatusHistory(CreateTestContext(), &vzmgrpb.GetVizierStatusHistoryRequest{
+			VizierID:  utils.ProtoFromUUIDStrOrNil(vizierID),
+			StartTime: startTime,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(resp.Transitions))
+	})
+
+	t.Run("other org", func(t *testing.T) {
+		resp, err := s.GetVizierStatusHistory(CreateTestContext(), &vzmgrpb.GetVizierStatusHistoryRequest{
+			VizierID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440003"),
+		})
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/segmentio/analytics-go.v3"
 
@@ -40,20 +41,29 @@ const (
 	// If a cluster is an UPDATING state, the amount of time since the last heartbeat at
 	// which we can consider it disconnected.
 	durationBeforeUpdateDisconnect = 15 * time.Minute
+	// How long status transitions are kept in the status history.
+	statusHistoryRetention = 30 * 24 * time.Hour
+	// How often to prune expired status transitions from the database.
+	pruneInterval = 1 * time.Hour
+	// The status message recorded for clusters which are marked as disconnected.
+	disconnectedStatusMessage = "Vizier has stopped sending heartbeats to Pixie Cloud."
 )
 
 // StatusMonitor is responsible for maintaining status information of vizier clusters.
 // It has a routine that is periodically invoked.
 type StatusMonitor struct {
 	db     *sqlx.DB
+	nc     *nats.Conn
 	quitCh chan struct{}
 	once   sync.Once
 }
 
 // NewStatusMonitor creates a new StatusMonitor operating on the passed in DB and starts it.
-func NewStatusMonitor(db *sqlx.DB) *StatusMonitor {
+// Clusters which are marked as disconnected are published as notification events on nc, if it is non-nil.
+func NewStatusMonitor(db *sqlx.DB, nc *nats.Conn) *StatusMonitor {
 	sm := &StatusMonitor{
 		db:     db,
+		nc:     nc,
 		quitCh: make(chan struct{}),
 	}
 	sm.start()
@@ -64,6 +74,8 @@ func (s *StatusMonitor) start() {
 	go func() {
 		tick := time.NewTicker(updateInterval)
 		defer tick.Stop()
+		pruneTick := time.NewTicker(pruneInterval)
+		defer pruneTick.Stop()
 
 		for {
 			select {
@@ -71,6 +83,8 @@ func (s *StatusMonitor) start() {
 				return
 			case <-tick.C:
 				s.UpdateDBEntries()
+			case <-pruneTick.C:
+				s.PruneStatusHistory()
 			}
 		}
 	}()
@@ -90,32 +104,36 @@ func (s *StatusMonitor) UpdateDBEntries() {
        vizier_cluster_info x
      SET
        status='DISCONNECTED',
-       address=''
+       address='',
+       status_message=$1
      FROM (SELECT * from vizier_cluster_info
 		     WHERE (last_heartbeat < NOW() - INTERVAL '%f seconds' AND status != 'UPDATING' AND status != 'DISCONNECTED')
 			   OR (last_heartbeat < NOW() - INTERVAL '%f seconds' AND status = 'UPDATING')) y
      WHERE x.vizier_cluster_id = y.vizier_cluster_id
-     RETURNING y.vizier_cluster_id;`
+     RETURNING y.vizier_cluster_id, y.status;`
 	// Variable substitution does not seem to work for intervals. Since we control this entire
 	// query and input data it should be safe to add the value to the query using
 	// a format directive.
 	query = fmt.Sprintf(query, durationBeforeDisconnect.Seconds(), durationBeforeUpdateDisconnect.Seconds())
 	start := time.Now()
-	rows, err := s.db.Queryx(query)
+	rows, err := s.db.Queryx(query, disconnectedStatusMessage)
 	if err != nil {
 		log.WithError(err).Error("Failed to update database, ignoring (will retry in next tick)")
 		return
 	}
 
 	entryUpdated := 0
+	prevStatuses := make(map[uuid.UUID]vizierStatus)
 	defer rows.Close()
 	for rows.Next() {
 		entryUpdated++
 		var vizierID uuid.UUID
-		err = rows.Scan(&vizierID)
+		var prevStatus vizierStatus
+		err = rows.Scan(&vizierID, &prevStatus)
 		if err != nil {
 			log.Info("Failed to read data for updated vizier, ignoring")
 		} else {
+			prevStatuses[vizierID] = prevStatus
 			events.Client().Enqueue(&analytics.Track{
 				UserId: vizierID.String(),
 				Event:  events.VizierStatusChange,
@@ -125,7 +143,27 @@ func (s *StatusMonitor) UpdateDBEntries() {
 			})
 		}
 	}
+	// Release the DB connection before looking up the orgs for the notifications.
+	rows.Close()
+
+	for vizierID, prevStatus := range prevStatuses {
+		publishStatusChangeEvent(s.db, s.nc, vizierID, prevStatus, vizierStatus(cvmsgspb.VZ_ST_DISCONNECTED), disconnectedStatusMessage)
+	}
+
 	log.WithField("entries_update", entryUpdated).
 		WithField("update_time", time.Since(start)).
 		Info("Heartbeat Update Complete")
 }
+
+// PruneStatusHistory deletes status transitions which are older than the retention period.
+func (s *StatusMonitor) PruneStatusHistory() {
+	query := `DELETE FROM vizier_status_history WHERE time < NOW() - INTERVAL '%f seconds'`
+	query = fmt.Sprintf(query, statusHistoryRetention.Seconds())
+	res, err := s.db.Exec(query)
+	if err != nil {
+		log.WithError(err).Error("Failed to prune status history, ignoring (will retry in next tick)")
+		return
+	}
+	count, _ := res.RowsAffected()
+	log.WithField("entries_pruned", count).Info("Status History Prune Complete")
+}
@@ -68,7 +68,7 @@ func TestStatusMonitor_Start(t *testing.T) {
 	assert.Equal(t, vizInfo.Address, "addr0")
 	assert.Equal(t, vizInfo.Status, "HEALTHY")
 
-	sm := controllers.NewStatusMonitor(db)
+	sm := controllers.NewStatusMonitor(db, nil)
 	defer sm.Stop()
 
 	// For call update, just to make sure it was run and the state was updated.
@@ -87,4 +87,24 @@ func TestStatusMonitor_Start(t *testing.T) {
 	err = db.Get(&vizInfo, query, uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440002"))
 	require.NoError(t, err)
 	assert.Equal(t, vizInfo.Status, "DISCONNECTED")
+
+	// The disconnects should have been recorded in the status history.
+	historyQuery := `SELECT status, prev_status, status_message from vizier_status_history WHERE vizier_cluster_id=$1`
+	type historyEntry struct {
+		Status        string `db:"status"`
+		PrevStatus    string `db:"prev_status"`
+		StatusMessage string `db:"status_message"`
+	}
+	var history []historyEntry
+	err = db.Select(&history, historyQuery, uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440000"))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(history))
+	assert.Equal(t, "DISCONNECTED", history[0].Status)
+	assert.Equal(t, "HEALTHY", history[0].PrevStatus)
+	assert.NotEmpty(t, history[0].StatusMessage)
+
+	var updatingHistory []historyEntry
+	err = db.Select(&updatingHistory, historyQuery, uuid.FromStringOrNil("123e4567-e89b-12d3-a456-426655440001"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(updatingHistory))
 }
@@ -54,3 +54,33 @@ func (p *PodStatuses) Scan(src interface{}) error {
 
 	return nil
 }
+
+// ClusterLabels is the set of user-defined labels for a cluster.
+type ClusterLabels map[string]string
+
+// Value Returns a golang database/sql driver value for ClusterLabels.
+func (l ClusterLabels) Value() (driver.Value, error) {
+	if l == nil {
+		l = ClusterLabels{}
+	}
+	res, err := json.Marshal(l)
+	if err != nil {
+		return res, err
+	}
+	return driver.Value(res), err
+}
+
+// Scan Scans the sqlx database type ([]bytes) into the ClusterLabels type.
+func (l *ClusterLabels) Scan(src interface{}) error {
+	switch jsonText := src.(type) {
+	case []byte:
+		err := json.Unmarshal(jsonText, l)
+		if err != nil {
+			return status.Error(codes.Internal, "could not unmarshal cluster labels")
+		}
+	default:
+		return status.Error(codes.Internal, "could not unmarshal cluster labels")
+	}
+
+	return nil
+}
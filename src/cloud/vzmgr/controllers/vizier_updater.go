@@ -36,6 +36,7 @@ import (
 	"google.golang.org/grpc/metadata"
 
 	"px.dev/pixie/src/cloud/artifact_tracker/artifacttrackerpb"
+	"px.dev/pixie/src/cloud/shared/messagespb"
 	"px.dev/pixie/src/cloud/shared/vzshard"
 	"px.dev/pixie/src/shared/artifacts/versionspb"
 	"px.dev/pixie/src/shared/cvmsgspb"
@@ -132,7 +133,24 @@ func (u *Updater) getLatestVizierVersion() (string, error) {
 // UpdateOrInstallVizier immediately updates or installs the Vizier instance. This should be used in cases where
 // the user is bootstrapping Vizier for the first time, or has manually sent an update request.
 func (u *Updater) UpdateOrInstallVizier(vizierID uuid.UUID, version string, redeployEtcd bool) (*cvmsgspb.V2CMessage, error) {
-	return u.updateOrInstallVizier(vizierID, version, redeployEtcd)
+	v2cMsg, err := u.updateOrInstallVizier(vizierID, version, redeployEtcd)
+	if err != nil {
+		u.publishUpdateFailure(vizierID, version, err.Error())
+	}
+	return v2cMsg, err
+}
+
+// publishUpdateFailure notifies the org which owns the Vizier that its update has failed.
+func (u *Updater) publishUpdateFailure(vizierID uuid.UUID, version string, reason string) {
+	if version == "" {
+		version = u.latestVersion
+	}
+	publishNotificationEvent(u.db, u.nc, vizierID, messagespb.NE_VIZIER_UPDATE_FAILED,
+		fmt.Sprintf("Vizier %s failed to update to version %s: %s", vizierID.String(), version, reason),
+		map[string]string{
+			"version": version,
+			"error":   reason,
+		})
 }
 
 // Helper method for updating/installing a Vizier instance.
@@ -208,6 +226,11 @@ func (u *Updater) updateOrInstallVizier(vizierID uuid.UUID, version string, rede
 			if err != nil {
 				return nil, err
 			}
+			resp := &cvmsgspb.UpdateOrInstallVizierResponse{}
+			err = types.UnmarshalAny(v2cMsg.Msg, resp)
+			if err == nil && !resp.UpdateStarted {
+				u.publishUpdateFailure(vizierID, version, "Vizier did not start the update")
+			}
 			return v2cMsg, nil
 		case <-time.After(5 * time.Minute):
 			// Our message to the vizier either got lost, or the reply message from the vizier got lost.
@@ -294,6 +317,7 @@ func (u *Updater) ProcessUpdateQueue() {
 			_, err := u.updateOrInstallVizier(vzID, "", false)
 			if err != nil {
 				log.WithError(err).Error("Failed to send update to Vizier.")
+				u.publishUpdateFailure(vzID, "", err.Error())
 			}
 
 			u.queueMu.Lock()
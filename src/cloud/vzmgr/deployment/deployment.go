@@ -20,8 +20,10 @@ package deployment
 
 import (
 	"context"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -32,15 +34,15 @@ import (
 
 // InfoFetcher fetches information about deployments using the key.
 type InfoFetcher interface {
-	FetchOrgUserIDUsingDeploymentKey(context.Context, string) (uuid.UUID, uuid.UUID, error)
+	FetchDeploymentKeyUsingKey(context.Context, string) (*vzmgrpb.DeploymentKey, error)
 }
 
 // VizierProvisioner provisions a new Vizier.
 type VizierProvisioner interface {
 	// ProvisionVizier creates the vizier, with specified org_id, user_id, cluster_uid. Returns
 	// Cluster ID or error. If it already exists it will return the current cluster ID. Will return an error if the cluster is
-	// currently active (ie. Not disconnected).
-	ProvisionOrClaimVizier(context.Context, uuid.UUID, uuid.UUID, string, string) (uuid.UUID, string, error)
+	// currently active (ie. Not disconnected), or if the deployment key's cluster limit has been reached.
+	ProvisionOrClaimVizier(context.Context, uuid.UUID, uuid.UUID, string, string, *vzmgrpb.DeploymentKey) (uuid.UUID, string, error)
 }
 
 // Service is the deployment service.
@@ -60,16 +62,27 @@ func (s *Service) RegisterVizierDeployment(ctx context.Context, req *vzmgrpb.Reg
 		return nil, status.Error(codes.InvalidArgument, "empty cluster UID is not allowed")
 	}
 	// Fetch the orgID and userID based on the deployment key.
-	orgID, userID, err := s.deploymentInfoFetcher.FetchOrgUserIDUsingDeploymentKey(ctx, req.DeploymentKey)
+	key, err := s.deploymentInfoFetcher.FetchDeploymentKeyUsingKey(ctx, req.DeploymentKey)
 	if err != nil {
 		return nil, status.Error(codes.Unauthenticated, "invalid/unknown deployment key")
 	}
+	orgID, err := utils.UUIDFromProto(key.OrgID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "invalid org ID for deployment key")
+	}
+	userID, err := utils.UUIDFromProto(key.UserID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "invalid user ID for deployment key")
+	}
+	if err := checkRestrictions(key.Restrictions); err != nil {
+		return nil, err
+	}
 	// Now we know the org and user ID to use for deployment. The process is as follows:
 	// 1. Try to fetch a cluster with either an empty UID or one where the UID matches the one in the protobuf.
 	// 2. If the UID matches then return that cluster.
 	// 3. Otherwise, pick a cluster with no UID specified and claim it.
 	// 4. If no empty clusters exist then we create a new cluster.
-	clusterID, clusterName, err := s.vp.ProvisionOrClaimVizier(ctx, orgID, userID, req.K8sClusterUID, req.K8sClusterName)
+	clusterID, clusterName, err := s.vp.ProvisionOrClaimVizier(ctx, orgID, userID, req.K8sClusterUID, req.K8sClusterName, key)
 	if err != nil {
 		return nil, vzerrors.ToGRPCError(err)
 	}
@@ -78,3 +91,19 @@ func (s *Service) RegisterVizierDeployment(ctx context.Context, req *vzmgrpb.Reg
 		VizierName: clusterName,
 	}, nil
 }
+
+// checkRestrictions checks that a cluster may be registered with a key that has the given restrictions.
+// The cluster limit and name pattern are checked when the cluster is provisioned, since the cluster's final name
+// is only known once it has been assigned.
+func checkRestrictions(r *vzmgrpb.DeploymentKeyRestrictions) error {
+	if r == nil {
+		return nil
+	}
+	if r.ExpiresAt != nil {
+		expiresAt, err := types.TimestampFromProto(r.ExpiresAt)
+		if err == nil && time.Now().After(expiresAt) {
+			return status.Error(codes.PermissionDenied, "deployment key has expired")
+		}
+	}
+	return nil
+}
@@ -21,9 +21,12 @@ package deployment_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
@@ -41,28 +44,50 @@ var (
 
 	testValidClusterID = uuid.FromStringOrNil("553e4567-e89b-12d3-a456-426655440000")
 
-	testValidDeploymentKey = "883e4567-e89b-12d3-a456-426655440000"
+	testValidDeploymentKey      = "883e4567-e89b-12d3-a456-426655440000"
+	testExpiredDeploymentKey    = "883e4567-e89b-12d3-a456-426655440001"
+	testRestrictedDeploymentKey = "883e4567-e89b-12d3-a456-426655440002"
 )
 
 type fakeDF struct{}
 
-func (f *fakeDF) FetchOrgUserIDUsingDeploymentKey(ctx context.Context, key string) (uuid.UUID, uuid.UUID, error) {
-	if key == testValidDeploymentKey {
-		return testOrgID, testUserID, nil
+func (f *fakeDF) FetchDeploymentKeyUsingKey(ctx context.Context, key string) (*vzmgrpb.DeploymentKey, error) {
+	dk := &vzmgrpb.DeploymentKey{
+		Key:    key,
+		OrgID:  utils.ProtoFromUUID(testOrgID),
+		UserID: utils.ProtoFromUUID(testUserID),
 	}
-	return uuid.Nil, uuid.Nil, vzerrors.ErrDeploymentKeyNotFound
+	switch key {
+	case testValidDeploymentKey:
+		return dk, nil
+	case testExpiredDeploymentKey:
+		expiresAt, _ := types.TimestampProto(time.Now().Add(-1 * time.Hour))
+		dk.Restrictions = &vzmgrpb.DeploymentKeyRestrictions{ExpiresAt: expiresAt}
+		return dk, nil
+	case testRestrictedDeploymentKey:
+		expiresAt, _ := types.TimestampProto(time.Now().Add(time.Hour))
+		dk.Restrictions = &vzmgrpb.DeploymentKeyRestrictions{
+			ExpiresAt:          expiresAt,
+			ClusterNamePattern: "te.t",
+		}
+		return dk, nil
+	}
+	return nil, vzerrors.ErrDeploymentKeyNotFound
 }
 
 type fakeProvisioner struct {
 }
 
-func (f *fakeProvisioner) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, clusterUID string, clusterName string) (uuid.UUID, string, error) {
+func (f *fakeProvisioner) ProvisionOrClaimVizier(ctx context.Context, orgID uuid.UUID, userID uuid.UUID, clusterUID string, clusterName string, deployKey *vzmgrpb.DeploymentKey) (uuid.UUID, string, error) {
 	if testOrgID == orgID && testUserID == userID && clusterUID == "cluster1" && clusterName == "test" {
 		return testValidClusterID, clusterName, nil
 	}
 	if testOrgID == orgID && testUserID == userID && clusterUID == "cluster2" {
 		return uuid.Nil, "", vzerrors.ErrProvisionFailedVizierIsActive
 	}
+	if testOrgID == orgID && testUserID == userID && clusterUID == "cluster3" {
+		return uuid.Nil, "", fmt.Errorf("%w: cluster name '%s' does not match 'te.t'", vzerrors.ErrClusterNamePatternMismatch, clusterName)
+	}
 	return uuid.Nil, "", errors.New("bad request")
 }
 
@@ -105,3 +130,29 @@ func TestService_RegisterVizierDeployment_InvalidDeployKey(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, codes.Unauthenticated, status.Code(err))
 }
+
+func TestService_RegisterVizierDeployment_ExpiredDeployKey(t *testing.T) {
+	svc := deployment.New(&fakeDF{}, &fakeProvisioner{})
+
+	ctx := context.Background()
+	resp, err := svc.RegisterVizierDeployment(ctx, &vzmgrpb.RegisterVizierDeploymentRequest{
+		K8sClusterUID:  "cluster1",
+		DeploymentKey:  testExpiredDeploymentKey,
+		K8sClusterName: "test",
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestService_RegisterVizierDeployment_ClusterNamePatternMismatch(t *testing.T) {
+	svc := deployment.New(&fakeDF{}, &fakeProvisioner{})
+
+	ctx := context.Background()
+	resp, err := svc.RegisterVizierDeployment(ctx, &vzmgrpb.RegisterVizierDeploymentRequest{
+		K8sClusterUID:  "cluster3",
+		DeploymentKey:  testRestrictedDeploymentKey,
+		K8sClusterName: "test-cluster",
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
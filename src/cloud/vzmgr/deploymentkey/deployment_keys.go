@@ -21,7 +21,9 @@ package deploymentkey
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -31,6 +33,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"px.dev/pixie/src/cloud/vzmgr/vzerrors"
 	"px.dev/pixie/src/cloud/vzmgr/vzmgrpb"
@@ -40,8 +43,72 @@ import (
 const (
 	// deployKeyPrefox is applied to all deploy keys to make them easier to identify.
 	deployKeyPrefix = "px-dep-"
+	// restrictionColumns are the columns which store the restrictions of a key, followed by the number of clusters
+	// registered with the key. These are scanned using restrictions.scanDest.
+	restrictionColumns = `expires_at, max_clusters, cluster_name_pattern, default_labels,
+                (SELECT COUNT(*) FROM vizier_cluster WHERE deployment_key_id=vizier_deployment_keys.id) AS num_clusters`
 )
 
+// restrictions holds the restriction columns of a deployment key, as they are stored in the database.
+type restrictions struct {
+	expiresAt     *time.Time
+	maxClusters   int64
+	namePattern   string
+	defaultLabels []byte
+	numClusters   int64
+}
+
+func (r *restrictions) scanDest() []interface{} {
+	return []interface{}{&r.expiresAt, &r.maxClusters, &r.namePattern, &r.defaultLabels, &r.numClusters}
+}
+
+func (r *restrictions) toProto() *vzmgrpb.DeploymentKeyRestrictions {
+	rpb := &vzmgrpb.DeploymentKeyRestrictions{
+		MaxClusters:        r.maxClusters,
+		ClusterNamePattern: r.namePattern,
+	}
+	if r.expiresAt != nil {
+		rpb.ExpiresAt, _ = types.TimestampProto(*r.expiresAt)
+	}
+	if len(r.defaultLabels) > 0 {
+		err := json.Unmarshal(r.defaultLabels, &rpb.DefaultLabels)
+		if err != nil {
+			log.WithError(err).Error("Failed to unmarshal default labels")
+		}
+	}
+	return rpb
+}
+
+// validateRestrictions checks that the given restrictions are well-formed.
+func validateRestrictions(r *vzmgrpb.DeploymentKeyRestrictions) error {
+	if r.MaxClusters < 0 {
+		return status.Error(codes.InvalidArgument, "max clusters must not be negative")
+	}
+	if r.ExpiresAt != nil {
+		expiresAt, err := types.TimestampFromProto(r.ExpiresAt)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "invalid expiry time")
+		}
+		if expiresAt.Before(time.Now()) {
+			return status.Error(codes.InvalidArgument, "expiry time must be in the future")
+		}
+	}
+	if r.ClusterNamePattern != "" {
+		if _, err := regexp.Compile(r.ClusterNamePattern); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid cluster name pattern: %s", err.Error())
+		}
+	}
+	for k, v := range r.DefaultLabels {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return status.Errorf(codes.InvalidArgument, "invalid label key '%s': %s", k, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return status.Errorf(codes.InvalidArgument, "invalid label value '%s': %s", v, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
 // Service is used to provision and manage deployment keys.
 type Service struct {
 	db    *sqlx.DB
@@ -68,17 +135,39 @@ func (s *Service) Create(ctx context.Context, req *vzmgrpb.CreateDeploymentKeyRe
 		return nil, status.Error(codes.InvalidArgument, "invalid user id format")
 	}
 
+	r := req.Restrictions
+	if r == nil {
+		r = &vzmgrpb.DeploymentKeyRestrictions{}
+	}
+	if err := validateRestrictions(r); err != nil {
+		return nil, err
+	}
+	var expiresAt *time.Time
+	if r.ExpiresAt != nil {
+		t, _ := types.TimestampFromProto(r.ExpiresAt)
+		expiresAt = &t
+	}
+	defaultLabels, err := json.Marshal(r.DefaultLabels)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid default labels")
+	}
+	if r.DefaultLabels == nil {
+		defaultLabels = []byte("{}")
+	}
+
 	var id uuid.UUID
 	var ts time.Time
-	query := `INSERT INTO vizier_deployment_keys(org_id, user_id, hashed_key, encrypted_key, description)
-                VALUES($1, $2, sha256($3), PGP_SYM_ENCRYPT($3::text, $4::text), $5)
+	query := `INSERT INTO vizier_deployment_keys(org_id, user_id, hashed_key, encrypted_key, description,
+                  expires_at, max_clusters, cluster_name_pattern, default_labels)
+                VALUES($1, $2, sha256($3), PGP_SYM_ENCRYPT($3::text, $4::text), $5, $6, $7, $8, $9)
               RETURNING id, created_at`
 	keyID, err := uuid.NewV4()
 	if err != nil {
 		return nil, err
 	}
 	key := deployKeyPrefix + keyID.String()
-	err = s.db.QueryRowxContext(ctx, query, orgID, userID, key, s.dbKey, req.Desc).
+	err = s.db.QueryRowxContext(ctx, query, orgID, userID, key, s.dbKey, req.Desc,
+		expiresAt, r.MaxClusters, r.ClusterNamePattern, defaultLabels).
 		Scan(&id, &ts)
 	if err != nil {
 		log.WithError(err).Error("Failed to insert deployment keys")
@@ -87,9 +176,10 @@ func (s *Service) Create(ctx context.Context, req *vzmgrpb.CreateDeploymentKeyRe
 
 	tp, _ := types.TimestampProto(ts)
 	return &vzmgrpb.DeploymentKey{
-		ID:        utils.ProtoFromUUID(id),
-		Key:       key,
-		CreatedAt: tp,
+		ID:           utils.ProtoFromUUID(id),
+		Key:          key,
+		CreatedAt:    tp,
+		Restrictions: r,
 	}, nil
 }
 
@@ -101,7 +191,7 @@ func (s *Service) List(ctx context.Context, req *vzmgrpb.ListDeploymentKeyReques
 	}
 
 	// Return all clusters when the OrgID matches.
-	query := `SELECT id, org_id, user_id, created_at, description
+	query := `SELECT id, org_id, user_id, created_at, description, ` + restrictionColumns + `
                 FROM vizier_deployment_keys
                 WHERE org_id=$1
                 ORDER BY created_at`
@@ -122,18 +212,21 @@ func (s *Service) List(ctx context.Context, req *vzmgrpb.ListDeploymentKeyReques
 		var userID uuid.UUID
 		var createdAt time.Time
 		var desc string
-		err = rows.Scan(&id, &orgID, &userID, &createdAt, &desc)
+		var r restrictions
+		err = rows.Scan(append([]interface{}{&id, &orgID, &userID, &createdAt, &desc}, r.scanDest()...)...)
 		if err != nil {
 			log.WithError(err).Error("Failed to read data from postgres")
 			return nil, status.Error(codes.Internal, "failed to read data")
 		}
 		tProto, _ := types.TimestampProto(createdAt)
 		keys = append(keys, &vzmgrpb.DeploymentKeyMetadata{
-			ID:        utils.ProtoFromUUIDStrOrNil(id),
-			OrgID:     utils.ProtoFromUUID(orgID),
-			UserID:    utils.ProtoFromUUID(userID),
-			CreatedAt: tProto,
-			Desc:      desc,
+			ID:           utils.ProtoFromUUIDStrOrNil(id),
+			OrgID:        utils.ProtoFromUUID(orgID),
+			UserID:       utils.ProtoFromUUID(userID),
+			CreatedAt:    tProto,
+			Desc:         desc,
+			Restrictions: r.toProto(),
+			NumClusters:  r.numClusters,
 		})
 	}
 	return &vzmgrpb.ListDeploymentKeyResponse{
@@ -156,23 +249,26 @@ func (s *Service) Get(ctx context.Context, req *vzmgrpb.GetDeploymentKeyRequest)
 	var key string
 	var createdAt time.Time
 	var desc string
-	query := `SELECT CONVERT_FROM(PGP_SYM_DECRYPT(encrypted_key, $3::text)::bytea, 'UTF8'), user_id, created_at, description
+	var r restrictions
+	query := `SELECT CONVERT_FROM(PGP_SYM_DECRYPT(encrypted_key, $3::text)::bytea, 'UTF8'), user_id, created_at, description, ` + restrictionColumns + `
                 FROM vizier_deployment_keys
                 WHERE org_id=$1 AND id=$2`
 	err = s.db.QueryRowxContext(ctx, query, orgID, tokenID, s.dbKey).
-		Scan(&key, &userID, &createdAt, &desc)
+		Scan(append([]interface{}{&key, &userID, &createdAt, &desc}, r.scanDest()...)...)
 	if err != nil {
 		return nil, status.Error(codes.NotFound, "No such deployment key")
 	}
 
 	createdAtProto, _ := types.TimestampProto(createdAt)
 	return &vzmgrpb.GetDeploymentKeyResponse{Key: &vzmgrpb.DeploymentKey{
-		ID:        req.ID,
-		OrgID:     utils.ProtoFromUUID(orgID),
-		UserID:    utils.ProtoFromUUID(userID),
-		Key:       key,
-		CreatedAt: createdAtProto,
-		Desc:      desc,
+		ID:           req.ID,
+		OrgID:        utils.ProtoFromUUID(orgID),
+		UserID:       utils.ProtoFromUUID(userID),
+		Key:          key,
+		CreatedAt:    createdAtProto,
+		Desc:         desc,
+		Restrictions: r.toProto(),
+		NumClusters:  r.numClusters,
 	}}, nil
 }
 
@@ -208,21 +304,9 @@ func (s *Service) Delete(ctx context.Context, req *vzmgrpb.DeleteDeploymentKeyRe
 	return &types.Empty{}, nil
 }
 
-// FetchOrgUserIDUsingDeploymentKey gets the org and user ID based on the deployment key.
-func (s *Service) FetchOrgUserIDUsingDeploymentKey(ctx context.Context, key string) (uuid.UUID, uuid.UUID, error) {
-	resp, err := s.fetchDeploymentKeyUsingKeyFromDB(ctx, key)
-	if err != nil {
-		return uuid.Nil, uuid.Nil, err
-	}
-	oid, err := utils.UUIDFromProto(resp.OrgID)
-	if err != nil {
-		return uuid.Nil, uuid.Nil, err
-	}
-	uid, err := utils.UUIDFromProto(resp.UserID)
-	if err != nil {
-		return uuid.Nil, uuid.Nil, err
-	}
-	return oid, uid, nil
+// FetchDeploymentKeyUsingKey gets the complete deployment key information, including its restrictions, using just the key.
+func (s *Service) FetchDeploymentKeyUsingKey(ctx context.Context, key string) (*vzmgrpb.DeploymentKey, error) {
+	return s.fetchDeploymentKeyUsingKeyFromDB(ctx, key)
 }
 
 // LookupDeploymentKey gets the complete Deployment key information using just the Key.
@@ -247,11 +331,12 @@ func (s *Service) fetchDeploymentKeyUsingKeyFromDB(ctx context.Context, key stri
 	var userID uuid.UUID
 	var createdAt time.Time
 	var desc string
-	query := `SELECT id, org_id, user_id, created_at, description
+	var r restrictions
+	query := `SELECT id, org_id, user_id, created_at, description, ` + restrictionColumns + `
                 FROM vizier_deployment_keys
                 WHERE hashed_key=sha256($1) AND PGP_SYM_DECRYPT(encrypted_key::bytea, $2::text)::bytea=$1`
 	err := s.db.QueryRowxContext(ctx, query, key, s.dbKey).
-		Scan(&id, &orgID, &userID, &createdAt, &desc)
+		Scan(append([]interface{}{&id, &orgID, &userID, &createdAt, &desc}, r.scanDest()...)...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, vzerrors.ErrDeploymentKeyNotFound
@@ -261,11 +346,59 @@ func (s *Service) fetchDeploymentKeyUsingKeyFromDB(ctx context.Context, key stri
 
 	createdAtProto, _ := types.TimestampProto(createdAt)
 	return &vzmgrpb.DeploymentKey{
-		ID:        utils.ProtoFromUUID(id),
-		OrgID:     utils.ProtoFromUUID(orgID),
-		UserID:    utils.ProtoFromUUID(userID),
-		Key:       key,
-		CreatedAt: createdAtProto,
-		Desc:      desc,
+		ID:           utils.ProtoFromUUID(id),
+		OrgID:        utils.ProtoFromUUID(orgID),
+		UserID:       utils.ProtoFromUUID(userID),
+		Key:          key,
+		CreatedAt:    createdAtProto,
+		Desc:         desc,
+		Restrictions: r.toProto(),
+		NumClusters:  r.numClusters,
+	}, nil
+}
+
+// ListClusters lists the clusters that have been registered with the given key.
+func (s *Service) ListClusters(ctx context.Context, req *vzmgrpb.ListDeploymentKeyClustersRequest) (*vzmgrpb.ListDeploymentKeyClustersResponse, error) {
+	orgID, err := utils.UUIDFromProto(req.OrgID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid org id format")
+	}
+	keyID, err := utils.UUIDFromProto(req.ID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid id format")
+	}
+
+	query := `SELECT id, cluster_name, created_at
+                FROM vizier_cluster
+                WHERE org_id=$1 AND deployment_key_id=$2
+                ORDER BY created_at`
+	rows, err := s.db.QueryxContext(ctx, query, orgID, keyID)
+	if err != nil {
+		log.WithError(err).Error("Failed to fetch clusters for deployment key")
+		return nil, status.Error(codes.Internal, "failed to fetch clusters for deployment key")
+	}
+	defer rows.Close()
+
+	clusters := make([]*vzmgrpb.DeploymentKeyCluster, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		var clusterName *string
+		var createdAt time.Time
+		err = rows.Scan(&id, &clusterName, &createdAt)
+		if err != nil {
+			log.WithError(err).Error("Failed to read data from postgres")
+			return nil, status.Error(codes.Internal, "failed to read data")
+		}
+		c := &vzmgrpb.DeploymentKeyCluster{
+			VizierID: utils.ProtoFromUUID(id),
+		}
+		if clusterName != nil {
+			c.ClusterName = *clusterName
+		}
+		c.CreatedAt, _ = types.TimestampProto(createdAt)
+		clusters = append(clusters, c)
+	}
+	return &vzmgrpb.ListDeploymentKeyClustersResponse{
+		Clusters: clusters,
 	}, nil
 }
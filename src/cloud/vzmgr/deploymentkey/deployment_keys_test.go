@@ -152,6 +152,108 @@ func TestDeploymentKeyService_CreateDeploymentKey(t *testing.T) {
 	}
 }
 
+func TestDeploymentKeyService_CreateDeploymentKeyWithRestrictions(t *testing.T) {
+	mustLoadTestData(db)
+
+	expiresAt, err := types.TimestampProto(time.Now().Add(time.Hour).Truncate(time.Second))
+	require.NoError(t, err)
+	restrictions := &vzmgrpb.DeploymentKeyRestrictions{
+		ExpiresAt:          expiresAt,
+		MaxClusters:        3,
+		ClusterNamePattern: "prod-.*",
+		DefaultLabels:      map[string]string{"env": "prod"},
+	}
+
+	svc := New(db, testDBKey)
+	resp, err := svc.Create(createTestContext(), &vzmgrpb.CreateDeploymentKeyRequest{
+		OrgID:        utils.ProtoFromUUID(testAuthOrgID),
+		UserID:       utils.ProtoFromUUID(testAuthUserID),
+		Desc:         "this is a restricted key",
+		Restrictions: restrictions,
+	})
+	require.NoError(t, err)
+
+	getResp, err := svc.Get(createTestContext(), &vzmgrpb.GetDeploymentKeyRequest{
+		ID:    resp.ID,
+		OrgID: utils.ProtoFromUUID(testAuthOrgID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, restrictions, getResp.Key.Restrictions)
+	assert.Equal(t, int64(0), getResp.Key.NumClusters)
+
+	key, err := svc.FetchDeploymentKeyUsingKey(createTestContext(), resp.Key)
+	require.NoError(t, err)
+	assert.Equal(t, restrictions, key.Restrictions)
+}
+
+func TestDeploymentKeyService_CreateDeploymentKeyInvalidRestrictions(t *testing.T) {
+	tests := []struct {
+		name         string
+		restrictions *vzmgrpb.DeploymentKeyRestrictions
+	}{
+		{
+			name:         "negative max clusters",
+			restrictions: &vzmgrpb.DeploymentKeyRestrictions{MaxClusters: -1},
+		},
+		{
+			name:         "invalid pattern",
+			restrictions: &vzmgrpb.DeploymentKeyRestrictions{ClusterNamePattern: "prod-("},
+		},
+		{
+			name:         "invalid label",
+			restrictions: &vzmgrpb.DeploymentKeyRestrictions{DefaultLabels: map[string]string{"env!": "prod"}},
+		},
+		{
+			name: "expired",
+			restrictions: &vzmgrpb.DeploymentKeyRestrictions{
+				ExpiresAt: &types.Timestamp{Seconds: 100},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mustLoadTestData(db)
+
+			svc := New(db, testDBKey)
+			resp, err := svc.Create(createTestContext(), &vzmgrpb.CreateDeploymentKeyRequest{
+				OrgID:        utils.ProtoFromUUID(testAuthOrgID),
+				UserID:       utils.ProtoFromUUID(testAuthUserID),
+				Restrictions: test.restrictions,
+			})
+			assert.Nil(t, resp)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestDeploymentKeyService_ListClusters(t *testing.T) {
+	mustLoadTestData(db)
+	db.MustExec(`DELETE FROM vizier_cluster`)
+
+	clusterID := uuid.Must(uuid.NewV4())
+	insertCluster := `INSERT INTO vizier_cluster(org_id, id, project_name, cluster_uid, cluster_name, deployment_key_id) VALUES ($1, $2, $3, $4, $5, $6)`
+	db.MustExec(insertCluster, testAuthOrgID, clusterID, "test", "k8sID", "test_cluster", testKey1ID)
+	db.MustExec(insertCluster, testAuthOrgID, uuid.Must(uuid.NewV4()), "test", "k8sID2", "other_cluster", testKey2ID)
+
+	svc := New(db, testDBKey)
+	resp, err := svc.ListClusters(createTestContext(), &vzmgrpb.ListDeploymentKeyClustersRequest{
+		ID:    utils.ProtoFromUUID(testKey1ID),
+		OrgID: utils.ProtoFromUUID(testAuthOrgID),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Clusters))
+	assert.Equal(t, clusterID, utils.UUIDFromProtoOrNil(resp.Clusters[0].VizierID))
+	assert.Equal(t, "test_cluster", resp.Clusters[0].ClusterName)
+
+	listResp, err := svc.List(createTestContext(), &vzmgrpb.ListDeploymentKeyRequest{
+		OrgID: utils.ProtoFromUUID(testAuthOrgID),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), listResp.Keys[0].NumClusters)
+	assert.Equal(t, int64(1), listResp.Keys[1].NumClusters)
+}
+
 func TestDeploymentKeyService_ListDeploymentKeys(t *testing.T) {
 	mustLoadTestData(db)
 	tests := []struct {
@@ -433,7 +535,7 @@ func TestDeploymentKeyService_Delete_NonExistentKey(t *testing.T) {
 	}
 }
 
-func TestService_FetchOrgUserIDUsingDeploymentKey(t *testing.T) {
+func TestService_FetchDeploymentKeyUsingKey(t *testing.T) {
 	mustLoadTestData(db)
 	tests := []struct {
 		name string
@@ -454,15 +556,15 @@ func TestService_FetchOrgUserIDUsingDeploymentKey(t *testing.T) {
 			ctx := test.ctx
 			svc := New(db, testDBKey)
 
-			orgID, userID, err := svc.FetchOrgUserIDUsingDeploymentKey(ctx, "px-dep-key1")
+			key, err := svc.FetchDeploymentKeyUsingKey(ctx, "px-dep-key1")
 			require.NoError(t, err)
-			assert.Equal(t, testAuthOrgID, orgID)
-			assert.Equal(t, testAuthUserID, userID)
+			assert.Equal(t, utils.ProtoFromUUID(testAuthOrgID), key.OrgID)
+			assert.Equal(t, utils.ProtoFromUUID(testAuthUserID), key.UserID)
 		})
 	}
 }
 
-func TestService_FetchOrgUserIDUsingDeploymentKey_OldKeys(t *testing.T) {
+func TestService_FetchDeploymentKeyUsingKey_OldKeys(t *testing.T) {
 	// Tests to make sure key without the prefix 'px-dep-' work.
 	mustLoadTestData(db)
 	tests := []struct {
@@ -484,15 +586,15 @@ func TestService_FetchOrgUserIDUsingDeploymentKey_OldKeys(t *testing.T) {
 			ctx := test.ctx
 			svc := New(db, testDBKey)
 
-			orgID, userID, err := svc.FetchOrgUserIDUsingDeploymentKey(ctx, "key1")
+			key, err := svc.FetchDeploymentKeyUsingKey(ctx, "key1")
 			require.NoError(t, err)
-			assert.Equal(t, testAuthOrgID, orgID)
-			assert.Equal(t, testAuthUserID, userID)
+			assert.Equal(t, utils.ProtoFromUUID(testAuthOrgID), key.OrgID)
+			assert.Equal(t, utils.ProtoFromUUID(testAuthUserID), key.UserID)
 		})
 	}
 }
 
-func TestService_FetchOrgUserIDUsingDeploymentKey_BadKey(t *testing.T) {
+func TestService_FetchDeploymentKeyUsingKey_BadKey(t *testing.T) {
 	mustLoadTestData(db)
 	tests := []struct {
 		name string
@@ -513,11 +615,10 @@ func TestService_FetchOrgUserIDUsingDeploymentKey_BadKey(t *testing.T) {
 			ctx := test.ctx
 			svc := New(db, testDBKey)
 
-			orgID, userID, err := svc.FetchOrgUserIDUsingDeploymentKey(ctx, "some rando key that does not exist")
+			key, err := svc.FetchDeploymentKeyUsingKey(ctx, "some rando key that does not exist")
 			assert.NotNil(t, err)
 			assert.Equal(t, vzerrors.ErrDeploymentKeyNotFound, err)
-			assert.Equal(t, uuid.Nil, orgID)
-			assert.Equal(t, uuid.Nil, userID)
+			assert.Nil(t, key)
 		})
 	}
 }
@@ -0,0 +1,42 @@
+-- This table contains the status transitions of each vizier.
+CREATE TABLE vizier_status_history (
+  -- The ID of the cluster.
+  vizier_cluster_id UUID NOT NULL,
+  -- The time at which the cluster transitioned into this status.
+  time TIMESTAMP NOT NULL DEFAULT NOW(),
+  -- The status that the cluster transitioned into.
+  status vizier_status NOT NULL,
+  -- The status that the cluster transitioned out of.
+  prev_status vizier_status,
+  -- The message explaining why the cluster transitioned into this status.
+  status_message TEXT,
+  -- Snapshots of the pod statuses at the time of the transition.
+  control_plane_pod_statuses json NOT NULL DEFAULT '{}',
+  unhealthy_data_plane_pod_statuses json NOT NULL DEFAULT '{}',
+
+  FOREIGN KEY(vizier_cluster_id) REFERENCES vizier_cluster(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_vizier_status_history_cluster_time
+  ON vizier_status_history(vizier_cluster_id, time DESC);
+
+CREATE INDEX idx_vizier_status_history_time
+  ON vizier_status_history(time);
+
+CREATE OR REPLACE FUNCTION record_status_history()
+  RETURNS TRIGGER AS $$
+  BEGIN
+    IF NEW.status <> OLD.status THEN
+       INSERT INTO vizier_status_history(vizier_cluster_id, status, prev_status, status_message,
+                                         control_plane_pod_statuses, unhealthy_data_plane_pod_statuses)
+       VALUES (NEW.vizier_cluster_id, NEW.status, OLD.status, NEW.status_message,
+               NEW.control_plane_pod_statuses, NEW.unhealthy_data_plane_pod_statuses);
+    END IF;
+
+    RETURN NEW;
+  END;
+  $$ language 'plpgsql';
+
+CREATE TRIGGER record_vizier_cluster_info_status_history
+  AFTER UPDATE ON vizier_cluster_info
+  FOR EACH ROW EXECUTE PROCEDURE record_status_history();
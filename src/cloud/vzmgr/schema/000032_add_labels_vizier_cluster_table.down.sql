@@ -0,0 +1,2 @@
+ALTER TABLE vizier_cluster
+  DROP COLUMN labels;
@@ -0,0 +1,3 @@
+-- User-defined key/value labels for the cluster, such as env=prod.
+ALTER TABLE vizier_cluster
+  ADD COLUMN labels json NOT NULL DEFAULT '{}';
@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS idx_vizier_cluster_deployment_key_id;
+
+ALTER TABLE vizier_cluster
+  DROP COLUMN deployment_key_id;
+
+ALTER TABLE vizier_deployment_keys
+  DROP COLUMN default_labels;
+
+ALTER TABLE vizier_deployment_keys
+  DROP COLUMN cluster_name_pattern;
+
+ALTER TABLE vizier_deployment_keys
+  DROP COLUMN max_clusters;
+
+ALTER TABLE vizier_deployment_keys
+  DROP COLUMN expires_at;
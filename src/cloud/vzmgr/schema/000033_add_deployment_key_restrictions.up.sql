@@ -0,0 +1,23 @@
+-- The time after which the key can no longer be used to register clusters. NULL if the key never expires.
+ALTER TABLE vizier_deployment_keys
+  ADD COLUMN expires_at TIMESTAMP;
+
+-- The maximum number of clusters that can be registered with the key. 0 if unlimited.
+ALTER TABLE vizier_deployment_keys
+  ADD COLUMN max_clusters bigint NOT NULL DEFAULT 0;
+
+-- A regular expression that the names of clusters registered with the key must match.
+ALTER TABLE vizier_deployment_keys
+  ADD COLUMN cluster_name_pattern varchar(1024) NOT NULL DEFAULT '';
+
+-- Labels applied to the clusters registered with the key.
+ALTER TABLE vizier_deployment_keys
+  ADD COLUMN default_labels json NOT NULL DEFAULT '{}';
+
+-- The deployment key that was used to register the cluster. This isn't a foreign key,
+-- since deployment keys may be deleted after clusters have been registered.
+ALTER TABLE vizier_cluster
+  ADD COLUMN deployment_key_id UUID;
+
+CREATE INDEX idx_vizier_cluster_deployment_key_id
+  ON vizier_cluster(deployment_key_id);
@@ -30,15 +30,26 @@ var (
 	ErrDeploymentKeyNotFound = errors.New("invalid deployment key")
 	// ErrProvisionFailedVizierIsActive errors when the specified vizier is active and not disconnected.
 	ErrProvisionFailedVizierIsActive = errors.New("provisioning failed because vizier with specified UID is already active")
+	// ErrDeploymentKeyClusterLimitReached errors when the deployment key has already been used to register the maximum
+	// number of clusters allowed by the key.
+	ErrDeploymentKeyClusterLimitReached = errors.New("provisioning failed because the deployment key has reached its cluster limit")
+	// ErrClusterNamePatternMismatch errors when the name assigned to the cluster doesn't match the cluster name pattern
+	// required by the deployment key.
+	ErrClusterNamePatternMismatch = errors.New("cluster name does not match the pattern required by the deployment key")
 	// ErrInternalDB is used for internal errors related to DB.
 	ErrInternalDB = errors.New("internal database error")
 )
 
 // ToGRPCError converts vzmgr errors to grpc errors if possible.
 func ToGRPCError(err error) error {
+	if errors.Is(err, ErrClusterNamePatternMismatch) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	switch err {
 	case ErrProvisionFailedVizierIsActive:
 		return status.Error(codes.ResourceExhausted, err.Error())
+	case ErrDeploymentKeyClusterLimitReached:
+		return status.Error(codes.ResourceExhausted, err.Error())
 	case ErrDeploymentKeyNotFound:
 		return status.Error(codes.NotFound, err.Error())
 	case ErrInternalDB:
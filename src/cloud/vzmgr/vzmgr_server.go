@@ -188,7 +188,7 @@ func main() {
 	dks := deploymentkey.New(db, dbKey)
 	ds := deployment.New(dks, c)
 
-	sm := controllers.NewStatusMonitor(db)
+	sm := controllers.NewStatusMonitor(db, nc)
 	defer sm.Stop()
 	vzmgrpb.RegisterVZMgrServiceServer(s.GRPCServer(), c)
 	vzmgrpb.RegisterVZDeploymentKeyServiceServer(s.GRPCServer(), dks)
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TracepointSpec defines the desired state of a Tracepoint.
+type TracepointSpec struct {
+	// Target is the process that the probes of the tracepoint attach to. It is required by probes, and unused by
+	// BPFTrace programs.
+	Target *TracepointTarget `json:"target,omitempty"`
+	// Programs are the programs that the tracepoint deploys. Each program writes its data to its own table.
+	Programs []TracepointProgram `json:"programs"`
+	// AgentSelector restricts the agents that the tracepoint is deployed on. If unset, it is deployed on all
+	// agents.
+	AgentSelector *TracepointAgentSelector `json:"agentSelector,omitempty"`
+}
+
+// TracepointTarget selects the process that a tracepoint attaches to.
+type TracepointTarget struct {
+	// Pod is the name of the pod running the process, in the form "<namespace>/<name>". A prefix of the name
+	// matches all pods that it prefixes, for example those of a deployment.
+	Pod string `json:"pod"`
+	// Container is the name of the container running the process. It may be omitted if the pod has a single
+	// container.
+	Container string `json:"container,omitempty"`
+	// Process is a regexp matched against the command line of the processes in the container, in case it runs
+	// several processes.
+	Process string `json:"process,omitempty"`
+}
+
+// TracepointProgram is a single program deployed by a Tracepoint. Exactly one of Probe or BPFTrace must be set.
+type TracepointProgram struct {
+	// TableName is the name of the table that the program writes its data to.
+	TableName string `json:"tableName"`
+	// Probe is a probe attached to a function of the target process.
+	Probe *TracepointProbe `json:"probe,omitempty"`
+	// BPFTrace is a bpftrace program. Its printf calls write the rows of the table.
+	BPFTrace string `json:"bpftrace,omitempty"`
+}
+
+// TracepointProbe is a probe attached to a function, which writes a row to the table each time the function is
+// called.
+type TracepointProbe struct {
+	// Symbol is the function that the probe attaches to, for example "main.(*Server).Handle".
+	Symbol string `json:"symbol"`
+	// Columns are the columns of the table, in order.
+	Columns []TracepointColumn `json:"columns"`
+}
+
+// TracepointColumn is a column of the table written by a probe. Exactly one of Arg, ReturnValue or Latency must
+// be set.
+type TracepointColumn struct {
+	// Name is the name of the column.
+	Name string `json:"name"`
+	// Arg is an expression that accesses an argument of the function, or one of its fields, for example
+	// "req.URL.Path".
+	Arg string `json:"arg,omitempty"`
+	// ReturnValue is an expression that accesses a return value of the function, or one of its fields, for
+	// example "$0" for the first return value.
+	ReturnValue string `json:"returnValue,omitempty"`
+	// Latency records the time that the function took to return.
+	Latency bool `json:"latency,omitempty"`
+}
+
+// TracepointAgentSelector selects the agents that a tracepoint is deployed on, by the nodes they run on. Every
+// criteria that is set must match for an agent to be selected.
+type TracepointAgentSelector struct {
+	// NodeNames are the names of the nodes to deploy on.
+	NodeNames []string `json:"nodeNames,omitempty"`
+	// NodeLabels are the labels that nodes must have to be deployed on.
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+	// Namespaces restricts the tracepoint to the nodes hosting pods in one of these namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// PodLabels restricts the tracepoint to the nodes hosting pods with these labels.
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+}
+
+// TracepointPhase is a high-level summary of the state of a Tracepoint.
+type TracepointPhase string
+
+const (
+	// TracepointPhaseNone indicates that the tracepoint hasn't been reconciled yet.
+	TracepointPhaseNone TracepointPhase = ""
+	// TracepointPhasePending indicates that the tracepoint is being deployed on the agents.
+	TracepointPhasePending TracepointPhase = "Pending"
+	// TracepointPhaseRunning indicates that the tracepoint is running on at least one of the agents.
+	TracepointPhaseRunning TracepointPhase = "Running"
+	// TracepointPhaseFailed indicates that the tracepoint is invalid, or failed to deploy on all agents.
+	TracepointPhaseFailed TracepointPhase = "Failed"
+)
+
+// TracepointStatus defines the observed state of a Tracepoint.
+type TracepointStatus struct {
+	// Phase is a high-level summary of the state of the tracepoint.
+	Phase TracepointPhase `json:"phase,omitempty"`
+	// Message is a human-readable message with details about why the tracepoint is in this phase.
+	Message string `json:"message,omitempty"`
+	// TracepointID is the ID of the deployed tracepoint. It changes whenever the spec changes.
+	TracepointID string `json:"tracepointID,omitempty"`
+	// ObservedGeneration is the generation of the spec that the status reflects.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Agents are the states of the tracepoint on each of the agents it is deployed on.
+	Agents []TracepointAgentStatus `json:"agents,omitempty"`
+}
+
+// TracepointAgentStatus is the state of a tracepoint on a single agent.
+type TracepointAgentStatus struct {
+	// AgentID is the ID of the agent.
+	AgentID string `json:"agentID"`
+	// State is the lifecycle state of the tracepoint on the agent, for example "RUNNING_STATE".
+	State string `json:"state"`
+	// Message describes why the tracepoint failed on the agent, if it did.
+	Message string `json:"message,omitempty"`
+}
+
+// Tracepoint is the Schema for the tracepoints API. Tracepoints deployed through this API don't expire, and are
+// removed when the resource is deleted.
+// +genclient
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type Tracepoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TracepointSpec   `json:"spec,omitempty"`
+	Status TracepointStatus `json:"status,omitempty"`
+}
+
+// TracepointList contains a list of Tracepoint
+// +kubebuilder:object:root=true
+type TracepointList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Tracepoint `json:"items"`
+}
@@ -46,6 +46,9 @@ type VizierSpec struct {
 	// ClusterName is a name for the Vizier instance, usually specifying which cluster the Vizier is
 	// deployed to. If not specified, a random name will be generated.
 	ClusterName string `json:"clusterName,omitempty"`
+	// ClusterLabels are user-defined key/value labels for the Vizier instance, such as env=prod. These are
+	// reported to Pixie Cloud, where they can be used to select clusters.
+	ClusterLabels map[string]string `json:"clusterLabels,omitempty"`
 	// CloudAddr is the address of the cloud instance that the Vizier should be pointing to.
 	CloudAddr string `json:"cloudAddr,omitempty"`
 	// DevCloudNamespace should be specified only for dev versions of Pixie cloud which have no ingress to help
@@ -69,14 +72,22 @@ type VizierSpec struct {
 	// DataAccess defines the level of data that may be accesssed when executing a script on the cluster. If none specified,
 	// assumes full data access.
 	DataAccess DataAccessLevel `json:"dataAccess,omitempty"`
+	// DataAccessPolicies override the data access level for particular users. When several policies
+	// apply to a query, the most restrictive level is used. Queries that no policy applies to use DataAccess.
+	DataAccessPolicies []DataAccessPolicy `json:"dataAccessPolicies,omitempty"`
 	// DataCollectorParams specifies the set of params for configuring the dataCollector. If no params are specified, defaults are used.
 	DataCollectorParams *DataCollectorParams `json:"dataCollectorParams,omitempty"`
 	// LeadershipElectionParams specifies configurable values for the K8s leaderships elections which Vizier uses manage pod leadership.
 	LeadershipElectionParams *LeadershipElectionParams `json:"leadershipElectionParams,omitempty"`
+	// Registry is the image registry to pull all Vizier images from, in place of their public registries. Each image
+	// is expected at <registry>/<image path with '/' replaced by '-'>, such as the images exported by `px deploy images`.
+	Registry string `json:"registry,omitempty"`
+	// CloudProxy specifies an outbound proxy and additional CAs that Vizier uses to connect to Pixie Cloud.
+	CloudProxy *CloudProxyParams `json:"cloudProxy,omitempty"`
 }
 
 // DataAccessLevel defines the levels of data access that can be used when executing a script on a cluster.
-// +kubebuilder:validation:Enum=Full;Restricted
+// +kubebuilder:validation:Enum=Full;Restricted;PIIRestricted
 type DataAccessLevel string
 
 const (
@@ -92,6 +103,22 @@ const (
 	DataAccessPIIRestricted DataAccessLevel = "PIIRestricted"
 )
 
+// DataAccessPolicy sets the data access level for queries run by particular users. Policies can't be limited to
+// namespaces: a query reads data from all namespaces unless its script filters them, so the namespaces it touches
+// can't be determined from the script, its arguments, or its compiled plan.
+type DataAccessPolicy struct {
+	// Name identifies the policy. It is reported in the metadata of queries that the policy applies to.
+	Name string `json:"name"`
+	// Users are the emails or IDs of the users the policy applies to. An entry of the form "*@example.com" matches
+	// all users with an email in that domain. If empty, the policy applies to all users.
+	Users []string `json:"users,omitempty"`
+	// APIKeyUsers restricts the policy to queries made with an API key (true), or without one (false). If unset, the
+	// policy applies to both.
+	APIKeyUsers *bool `json:"apiKeyUsers,omitempty"`
+	// DataAccess is the level of data access applied by the policy.
+	DataAccess DataAccessLevel `json:"dataAccess"`
+}
+
 // ClockConverterType defines which clock conversion routine to use for converting timestamps to a synced reference time.
 // +kubebuilder:validation:Enum=default;grpc
 type ClockConverterType string
@@ -215,6 +242,29 @@ type LeadershipElectionParams struct {
 	ElectionPeriodMs int64 `json:"electionPeriodMs,omitempty"`
 }
 
+const (
+	// CloudProxyUsernameKey is the key of the proxy's username in the secret named by CloudProxyParams.AuthSecret.
+	CloudProxyUsernameKey = "username"
+	// CloudProxyPasswordKey is the key of the proxy's password in the secret named by CloudProxyParams.AuthSecret.
+	CloudProxyPasswordKey = "password"
+)
+
+// CloudProxyParams specifies how Vizier connects to Pixie Cloud from clusters that must egress through a proxy.
+type CloudProxyParams struct {
+	// ProxyURL is the URL of the HTTP CONNECT proxy used to connect to Pixie Cloud, for example: "http://proxy.corp:3128".
+	// The URL must not contain credentials, which are read from the AuthSecret instead.
+	ProxyURL string `json:"proxyURL,omitempty"`
+	// AuthSecret is the name of a secret in the Vizier's namespace which holds the "username" and "password" that
+	// are sent to the proxy using basic auth.
+	AuthSecret string `json:"authSecret,omitempty"`
+	// NoProxy is a comma-separated list of hosts, domains and CIDRs that are connected to directly rather than through
+	// the proxy, in the format of the NO_PROXY environment variable.
+	NoProxy string `json:"noProxy,omitempty"`
+	// CABundle is a PEM-encoded bundle of CA certificates which are trusted in addition to the system CAs when
+	// connecting to Pixie Cloud, such as the CA of a proxy that intercepts TLS connections.
+	CABundle string `json:"caBundle,omitempty"`
+}
+
 // Vizier is the Schema for the viziers API
 // +genclient
 // +genclient:noStatus
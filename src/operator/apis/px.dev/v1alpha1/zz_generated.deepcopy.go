@@ -9,6 +9,21 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudProxyParams) DeepCopyInto(out *CloudProxyParams) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProxyParams.
+func (in *CloudProxyParams) DeepCopy() *CloudProxyParams {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudProxyParams)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DataCollectorParams) DeepCopyInto(out *DataCollectorParams) {
 	*out = *in
@@ -31,6 +46,31 @@ func (in *DataCollectorParams) DeepCopy() *DataCollectorParams {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataAccessPolicy) DeepCopyInto(out *DataAccessPolicy) {
+	*out = *in
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.APIKeyUsers != nil {
+		in, out := &in.APIKeyUsers, &out.APIKeyUsers
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataAccessPolicy.
+func (in *DataAccessPolicy) DeepCopy() *DataAccessPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DataAccessPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LeadershipElectionParams) DeepCopyInto(out *LeadershipElectionParams) {
 	*out = *in
@@ -103,6 +143,241 @@ func (in *PodSecurityContext) DeepCopy() *PodSecurityContext {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Tracepoint) DeepCopyInto(out *Tracepoint) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Tracepoint.
+func (in *Tracepoint) DeepCopy() *Tracepoint {
+	if in == nil {
+		return nil
+	}
+	out := new(Tracepoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Tracepoint) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracepointAgentSelector) DeepCopyInto(out *TracepointAgentSelector) {
+	*out = *in
+	if in.NodeNames != nil {
+		in, out := &in.NodeNames, &out.NodeNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeLabels != nil {
+		in, out := &in.NodeLabels, &out.NodeLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodLabels != nil {
+		in, out := &in.PodLabels, &out.PodLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracepointAgentSelector.
+func (in *TracepointAgentSelector) DeepCopy() *TracepointAgentSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(TracepointAgentSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracepointAgentStatus) DeepCopyInto(out *TracepointAgentStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracepointAgentStatus.
+func (in *TracepointAgentStatus) DeepCopy() *TracepointAgentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TracepointAgentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracepointColumn) DeepCopyInto(out *TracepointColumn) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracepointColumn.
+func (in *TracepointColumn) DeepCopy() *TracepointColumn {
+	if in == nil {
+		return nil
+	}
+	out := new(TracepointColumn)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracepointList) DeepCopyInto(out *TracepointList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Tracepoint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracepointList.
+func (in *TracepointList) DeepCopy() *TracepointList {
+	if in == nil {
+		return nil
+	}
+	out := new(TracepointList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TracepointList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracepointProbe) DeepCopyInto(out *TracepointProbe) {
+	*out = *in
+	if in.Columns != nil {
+		in, out := &in.Columns, &out.Columns
+		*out = make([]TracepointColumn, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracepointProbe.
+func (in *TracepointProbe) DeepCopy() *TracepointProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(TracepointProbe)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracepointProgram) DeepCopyInto(out *TracepointProgram) {
+	*out = *in
+	if in.Probe != nil {
+		in, out := &in.Probe, &out.Probe
+		*out = new(TracepointProbe)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracepointProgram.
+func (in *TracepointProgram) DeepCopy() *TracepointProgram {
+	if in == nil {
+		return nil
+	}
+	out := new(TracepointProgram)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracepointSpec) DeepCopyInto(out *TracepointSpec) {
+	*out = *in
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(TracepointTarget)
+		**out = **in
+	}
+	if in.Programs != nil {
+		in, out := &in.Programs, &out.Programs
+		*out = make([]TracepointProgram, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AgentSelector != nil {
+		in, out := &in.AgentSelector, &out.AgentSelector
+		*out = new(TracepointAgentSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracepointSpec.
+func (in *TracepointSpec) DeepCopy() *TracepointSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TracepointSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracepointStatus) DeepCopyInto(out *TracepointStatus) {
+	*out = *in
+	if in.Agents != nil {
+		in, out := &in.Agents, &out.Agents
+		*out = make([]TracepointAgentStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracepointStatus.
+func (in *TracepointStatus) DeepCopy() *TracepointStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TracepointStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TracepointTarget) DeepCopyInto(out *TracepointTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TracepointTarget.
+func (in *TracepointTarget) DeepCopy() *TracepointTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(TracepointTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Vizier) DeepCopyInto(out *Vizier) {
 	*out = *in
@@ -165,6 +440,13 @@ func (in *VizierList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VizierSpec) DeepCopyInto(out *VizierSpec) {
 	*out = *in
+	if in.ClusterLabels != nil {
+		in, out := &in.ClusterLabels, &out.ClusterLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.Pod != nil {
 		in, out := &in.Pod, &out.Pod
 		*out = new(PodPolicy)
@@ -177,6 +459,13 @@ func (in *VizierSpec) DeepCopyInto(out *VizierSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.DataAccessPolicies != nil {
+		in, out := &in.DataAccessPolicies, &out.DataAccessPolicies
+		*out = make([]DataAccessPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.DataCollectorParams != nil {
 		in, out := &in.DataCollectorParams, &out.DataCollectorParams
 		*out = new(DataCollectorParams)
@@ -187,6 +476,11 @@ func (in *VizierSpec) DeepCopyInto(out *VizierSpec) {
 		*out = new(LeadershipElectionParams)
 		**out = **in
 	}
+	if in.CloudProxy != nil {
+		in, out := &in.CloudProxy, &out.CloudProxy
+		*out = new(CloudProxyParams)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VizierSpec.
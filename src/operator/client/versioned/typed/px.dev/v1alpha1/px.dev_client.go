@@ -10,6 +10,7 @@ import (
 
 type PxV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	TracepointsGetter
 	ViziersGetter
 }
 
@@ -18,6 +19,10 @@ type PxV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *PxV1alpha1Client) Tracepoints(namespace string) TracepointInterface {
+	return newTracepoints(c, namespace)
+}
+
 func (c *PxV1alpha1Client) Viziers(namespace string) VizierInterface {
 	return newViziers(c, namespace)
 }
@@ -21,6 +21,7 @@ package controllers
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -43,7 +44,9 @@ import (
 
 	"px.dev/pixie/src/api/proto/cloudpb"
 	pixiev1alpha1 "px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	svcutils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/shared/status"
+	"px.dev/pixie/src/utils/shared/k8s"
 )
 
 const (
@@ -51,6 +54,8 @@ const (
 	cloudConnName = "vizier-cloud-connector"
 	// The name label for PEMs.
 	vizierPemLabel = "vizier-pem"
+	// The name label of the query broker pods.
+	queryBrokerName = "vizier-query-broker"
 	// The name label for nats pods.
 	natsLabel = "pl-nats"
 	// The name of the nats pod.
@@ -64,6 +69,7 @@ const (
 // HTTPClient is the interface for a simple HTTPClient which can execute "Get".
 type HTTPClient interface {
 	Get(string) (resp *http.Response, err error)
+	Do(*http.Request) (resp *http.Response, err error)
 }
 
 type podWrapper struct {
@@ -217,6 +223,8 @@ func (m *VizierMonitor) watchK8sPods() {
 type vizierState struct {
 	// Reason is the description of the state. Should only be set with values enumerated in `src/shared/status/vzstatus.go`
 	Reason status.VizierReason
+	// Message overrides the message of the reason, to give details about the state. Optional.
+	Message string
 }
 
 func okState() *vizierState {
@@ -295,6 +303,90 @@ func getCloudConnState(client HTTPClient, pods *concurrentPodMap) *vizierState {
 	return okState()
 }
 
+// agentsHealth is the part of the agent health reported by the query broker that is used by the monitor.
+type agentsHealth struct {
+	Agents []struct {
+		Hostname string `json:"hostname"`
+		Healthy  bool   `json:"healthy"`
+	} `json:"agents"`
+}
+
+// agentsHealthToken signs a service token with the Vizier's JWT signing key, which the query broker requires to
+// report the health of the agents.
+func (m *VizierMonitor) agentsHealthToken() (string, error) {
+	s := k8s.GetSecret(m.clientset, m.namespace, "pl-cluster-secrets")
+	if s == nil {
+		return "", errors.New("missing cluster secrets")
+	}
+	key, ok := s.Data[clusterSecretJWTKey]
+	if !ok {
+		return "", errors.New("missing JWT signing key")
+	}
+	claims := svcutils.GenerateJWTForService("vizier_operator", "vizier")
+	return svcutils.SignJWTClaims(claims, string(key))
+}
+
+// getAgentsState determines the state of the agents, as checked by the query broker. Agents that are running but don't
+// respond to queries degrade the cluster, and the message lists their nodes.
+func getAgentsState(client HTTPClient, pods *concurrentPodMap, token string) *vizierState {
+	pods.mapMu.Lock()
+	defer pods.mapMu.Unlock()
+	for _, qbPod := range pods.unsafeMap[queryBrokerName] {
+		if qbPod.pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		var port int32
+		if len(qbPod.pod.Spec.Containers) > 0 && len(qbPod.pod.Spec.Containers[0].Ports) > 0 {
+			port = qbPod.pod.Spec.Containers[0].Ports[0].ContainerPort
+		}
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s:%d/agents/health", qbPod.pod.Status.PodIP, port), nil)
+		if err != nil {
+			log.WithError(err).Error("Error creating agent health request")
+			continue
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		resp, err := client.Do(req)
+		if err != nil {
+			log.WithError(err).Error("Error making agent health call")
+			continue
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return okState()
+		case http.StatusNotFound:
+			// Older query brokers don't check the health of the agents.
+			return okState()
+		case http.StatusServiceUnavailable:
+		default:
+			log.WithField("status", resp.Status).Error("Unexpected agent health response")
+			continue
+		}
+
+		var health agentsHealth
+		if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+			log.WithError(err).Error("Error reading the agent health")
+			return okState()
+		}
+		var unhealthy []string
+		for _, agent := range health.Agents {
+			if !agent.Healthy {
+				unhealthy = append(unhealthy, agent.Hostname)
+			}
+		}
+		if len(unhealthy) == 0 {
+			return okState()
+		}
+		log.WithField("nodes", unhealthy).Info("Some agents are unhealthy")
+		return &vizierState{
+			Reason: status.AgentsUnhealthy,
+			Message: fmt.Sprintf("%s Unhealthy nodes: %s.", status.GetMessageFromReason(status.AgentsUnhealthy),
+				strings.Join(unhealthy, ", ")),
+		}
+	}
+	return okState()
+}
+
 // getControlPlanePodState determines the state of control plane pods,
 // returning a pending state if the pods are stuck
 func getControlPlanePodState(pods *concurrentPodMap) *vizierState {
@@ -472,6 +564,13 @@ func (m *VizierMonitor) getVizierState(vz *pixiev1alpha1.Vizier) *vizierState {
 		return ccState
 	}
 
+	token, err := m.agentsHealthToken()
+	if err != nil {
+		log.WithError(err).Error("Failed to sign the agent health token")
+	} else if agentsState := getAgentsState(m.httpClient, m.podStates, token); !isOk(agentsState) {
+		return agentsState
+	}
+
 	if !isOk(m.aggregatedState) {
 		return m.aggregatedState
 	}
@@ -497,6 +596,9 @@ func translateReasonToPhase(reason status.VizierReason) pixiev1alpha1.VizierPhas
 	if reason == status.PEMsHighFailureRate {
 		return pixiev1alpha1.VizierPhaseDegraded
 	}
+	if reason == status.AgentsUnhealthy {
+		return pixiev1alpha1.VizierPhaseDegraded
+	}
 	return pixiev1alpha1.VizierPhaseUnhealthy
 }
 
@@ -588,6 +690,9 @@ func (m *VizierMonitor) runReconciler() {
 			}
 
 			vz.Status.Message = status.GetMessageFromReason(vizierState.Reason)
+			if vizierState.Message != "" {
+				vz.Status.Message = vizierState.Message
+			}
 			// Default to the VizierReason if the message is empty.
 			if vz.Status.Message == "" {
 				vz.Status.Message = vz.Status.VizierReason
@@ -66,6 +66,17 @@ func (f *FakeHTTPClient) Get(url string) (*http.Response, error) {
 	}, nil
 }
 
+func (f *FakeHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if auth := req.Header.Get("Authorization"); auth == "" || auth == "Bearer " {
+		return &http.Response{
+			Status:     "401",
+			StatusCode: 401,
+			Body:       ioutil.NopCloser(bytes.NewBufferString("Must have bearer auth")),
+		}, nil
+	}
+	return f.Get(req.URL.String())
+}
+
 func TestMonitor_queryPodStatusz(t *testing.T) {
 	httpClient := &FakeHTTPClient{
 		responses: map[string]string{
@@ -1017,3 +1028,76 @@ func TestMonitor_getPEMCrashingState(t *testing.T) {
 		})
 	}
 }
+
+func TestMonitor_getAgentsState(t *testing.T) {
+	tests := []struct {
+		name            string
+		agentsStatusz   string
+		token           string
+		expectedReason  status.VizierReason
+		expectedMessage string
+	}{
+		{
+			name:           "healthy",
+			agentsStatusz:  "",
+			token:          "token",
+			expectedReason: "",
+		},
+		{
+			name:            "unhealthy agents",
+			agentsStatusz:   `{"agents":[{"hostname":"node-1","healthy":true},{"hostname":"node-2"},{"hostname":"node-3"}]}`,
+			token:           "token",
+			expectedReason:  status.AgentsUnhealthy,
+			expectedMessage: status.GetMessageFromReason(status.AgentsUnhealthy) + " Unhealthy nodes: node-2, node-3.",
+		},
+		{
+			name:           "invalid response",
+			agentsStatusz:  "not json",
+			token:          "token",
+			expectedReason: "",
+		},
+		{
+			name:           "unauthorized",
+			agentsStatusz:  `{"agents":[{"hostname":"node-1"}]}`,
+			expectedReason: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			httpClient := &FakeHTTPClient{
+				responses: map[string]string{
+					"https://127.0.0.1:50300/agents/health": test.agentsStatusz,
+				},
+			}
+
+			pods := &concurrentPodMap{unsafeMap: make(map[string]map[string]*podWrapper)}
+			pods.write(
+				"vizier-query-broker",
+				"vizier-query-broker-abcdefg",
+				&podWrapper{
+					pod: &v1.Pod{
+						Status: v1.PodStatus{
+							PodIP: "127.0.0.1",
+							Phase: v1.PodRunning,
+						},
+						Spec: v1.PodSpec{
+							Containers: []v1.Container{
+								{
+									Ports: []v1.ContainerPort{
+										{
+											ContainerPort: 50300,
+										},
+									},
+								},
+							},
+						},
+					},
+				})
+
+			state := getAgentsState(httpClient, pods, test.token)
+			assert.Equal(t, test.expectedReason, state.Reason)
+			assert.Equal(t, test.expectedMessage, state.Message)
+		})
+	}
+}
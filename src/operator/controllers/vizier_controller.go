@@ -80,15 +80,47 @@ type VizierReconciler struct {
 // +kubebuilder:rbac:groups=pixie.px.dev,resources=viziers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=pixie.px.dev,resources=viziers/status,verbs=get;update;patch
 
-func getCloudClientConnection(cloudAddr string, devCloudNS string) (*grpc.ClientConn, error) {
+// getCloudProxyConfig gets the config of the proxy used to connect to Pixie Cloud, reading the proxy's credentials
+// from its auth secret.
+func getCloudProxyConfig(ctx context.Context, clientset kubernetes.Interface, namespace string, proxy *v1alpha1.CloudProxyParams) (*services.ProxyConfig, error) {
+	if proxy == nil || proxy.ProxyURL == "" {
+		return nil, nil
+	}
+
+	proxyConfig := &services.ProxyConfig{
+		URL:     proxy.ProxyURL,
+		NoProxy: proxy.NoProxy,
+	}
+	if proxy.AuthSecret == "" {
+		return proxyConfig, nil
+	}
+	s, err := clientset.CoreV1().Secrets(namespace).Get(ctx, proxy.AuthSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cloud proxy auth secret %q: %w", proxy.AuthSecret, err)
+	}
+	proxyConfig.Username = string(s.Data[v1alpha1.CloudProxyUsernameKey])
+	proxyConfig.Password = string(s.Data[v1alpha1.CloudProxyPasswordKey])
+	return proxyConfig, nil
+}
+
+func getCloudClientConnection(ctx context.Context, clientset kubernetes.Interface, vz *v1alpha1.Vizier) (*grpc.ClientConn, error) {
+	cloudAddr := vz.Spec.CloudAddr
 	isInternal := false
 
-	if devCloudNS != "" {
-		cloudAddr = fmt.Sprintf("api-service.%s.svc.cluster.local:51200", devCloudNS)
+	if vz.Spec.DevCloudNamespace != "" {
+		cloudAddr = fmt.Sprintf("api-service.%s.svc.cluster.local:51200", vz.Spec.DevCloudNamespace)
 		isInternal = true
 	}
 
-	dialOpts, err := services.GetGRPCClientDialOptsServerSideTLS(isInternal)
+	proxyConfig, err := getCloudProxyConfig(ctx, clientset, vz.Namespace, vz.Spec.CloudProxy)
+	if err != nil {
+		return nil, err
+	}
+	var caBundle string
+	if vz.Spec.CloudProxy != nil {
+		caBundle = vz.Spec.CloudProxy.CABundle
+	}
+	dialOpts, err := services.GetGRPCClientDialOptsForCloud(isInternal, proxyConfig, caBundle)
 	if err != nil {
 		return nil, err
 	}
@@ -192,7 +224,7 @@ func (r *VizierReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			vzGet:          r.Get,
 			clientset:      r.Clientset,
 		}
-		cloudClient, err := getCloudClientConnection(vizier.Spec.CloudAddr, vizier.Spec.DevCloudNamespace)
+		cloudClient, err := getCloudClientConnection(ctx, r.Clientset, &vizier)
 		if err != nil {
 			log.WithError(err).Fatal("Failed to initialize vizier monitor")
 		}
@@ -252,7 +284,7 @@ func (r *VizierReconciler) deleteVizier(ctx context.Context, req ctrl.Request) e
 // createVizier deploys a new vizier instance in the given namespace.
 func (r *VizierReconciler) createVizier(ctx context.Context, req ctrl.Request, vz *v1alpha1.Vizier) error {
 	log.Info("Creating a new vizier instance")
-	cloudClient, err := getCloudClientConnection(vz.Spec.CloudAddr, vz.Spec.DevCloudNamespace)
+	cloudClient, err := getCloudClientConnection(ctx, r.Clientset, vz)
 	if err != nil {
 		log.WithError(err).Error("Failed to connect to cloud client")
 		return err
@@ -289,7 +321,7 @@ func setReconciliationPhase(vz *v1alpha1.Vizier, rp v1alpha1.ReconciliationPhase
 
 func (r *VizierReconciler) deployVizier(ctx context.Context, req ctrl.Request, vz *v1alpha1.Vizier, update bool) error {
 	log.Info("Starting a vizier deploy")
-	cloudClient, err := getCloudClientConnection(vz.Spec.CloudAddr, vz.Spec.DevCloudNamespace)
+	cloudClient, err := getCloudClientConnection(ctx, r.Clientset, vz)
 	if err != nil {
 		log.WithError(err).Error("Failed to connect to cloud client")
 		return err
@@ -671,7 +703,8 @@ func generateVizierYAMLsConfig(ctx context.Context, ns string, vz *v1alpha1.Vizi
 				},
 				NodeSelector: vz.Spec.Pod.NodeSelector,
 			},
-			Patches: vz.Spec.Patches,
+			Patches:  vz.Spec.Patches,
+			Registry: vz.Spec.Registry,
 		},
 	}
 
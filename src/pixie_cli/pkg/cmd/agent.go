@@ -0,0 +1,284 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/pixie_cli/pkg/components"
+	"px.dev/pixie/src/pixie_cli/pkg/utils"
+)
+
+func init() {
+	AgentCmd.AddCommand(AgentConfigCmd)
+	AgentCmd.AddCommand(AgentEventsCmd)
+	AgentCmd.PersistentFlags().StringP("cluster", "c", "", "ID of the cluster to use. Defaults to the current cluster")
+
+	AgentConfigCmd.AddCommand(SetAgentConfigCmd)
+	AgentConfigCmd.AddCommand(ListAgentConfigsCmd)
+	AgentConfigCmd.AddCommand(UnsetAgentConfigCmd)
+
+	SetAgentConfigCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
+	SetAgentConfigCmd.Flags().StringSlice("target-nodes", nil, "Only update the agents of these nodes")
+	SetAgentConfigCmd.Flags().StringToString("target-node-selector", nil, "Only update the agents of nodes with these labels, e.g. pool=a,zone=b")
+	SetAgentConfigCmd.Flags().StringSlice("target-namespaces", nil, "Only update the agents of nodes hosting pods in these namespaces")
+	SetAgentConfigCmd.Flags().StringToString("target-pod-selector", nil, "Only update the agents of nodes hosting pods with these labels, e.g. app=checkout")
+	SetAgentConfigCmd.Flags().Int32("batch-size", 0, "The number of agents to update at a time. Defaults to the Vizier's batch size")
+	SetAgentConfigCmd.Flags().Duration("verify-timeout", 30*time.Second, "How long to wait for each agent of a batch to heartbeat after the update")
+	SetAgentConfigCmd.Flags().Bool("persist", true, "Whether to also apply the setting to agents that register later")
+
+	ListAgentConfigsCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
+
+	UnsetAgentConfigCmd.Flags().StringSlice("target-nodes", nil, "The nodes of the setting to remove")
+	UnsetAgentConfigCmd.Flags().StringToString("target-node-selector", nil, "The node labels of the setting to remove")
+	UnsetAgentConfigCmd.Flags().StringSlice("target-namespaces", nil, "The namespaces of the setting to remove")
+	UnsetAgentConfigCmd.Flags().StringToString("target-pod-selector", nil, "The pod labels of the setting to remove")
+
+	AgentEventsCmd.Flags().StringP("output", "o", "json", "Output format: one of: json|csv")
+	AgentEventsCmd.Flags().StringSlice("types", nil, "Only show events of these types: one of: registered|unhealthy|expired|deleted|schema_changed")
+}
+
+// AgentCmd is the agent sub-command of the CLI.
+var AgentCmd = &cobra.Command{
+	Use:     "agent",
+	Aliases: []string{"agents"},
+	Short:   "Manage the agents of a Vizier",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Info("Nothing here... Please execute one of the subcommands")
+		cmd.Help()
+	},
+}
+
+// AgentConfigCmd is the config sub-command of agent.
+var AgentConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the runtime config of the agents of a Vizier",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Info("Nothing here... Please execute one of the subcommands")
+		cmd.Help()
+	},
+}
+
+func formatAgentConfigState(state vizierpb.AgentConfigState) string {
+	return strings.TrimPrefix(state.String(), "AGENT_CONFIG_")
+}
+
+// agentTargetFromFlags returns the agents selected by the target flags of the command, or nil if no flag restricts
+// the agents.
+func agentTargetFromFlags(cmd *cobra.Command) *vizierpb.AgentTarget {
+	nodes, _ := cmd.Flags().GetStringSlice("target-nodes")
+	nodeLabels, _ := cmd.Flags().GetStringToString("target-node-selector")
+	namespaces, _ := cmd.Flags().GetStringSlice("target-namespaces")
+	podLabels, _ := cmd.Flags().GetStringToString("target-pod-selector")
+	if len(nodes) == 0 && len(nodeLabels) == 0 && len(namespaces) == 0 && len(podLabels) == 0 {
+		return nil
+	}
+	return &vizierpb.AgentTarget{
+		NodeNames:  nodes,
+		NodeLabels: nodeLabels,
+		Namespaces: namespaces,
+		PodLabels:  podLabels,
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func formatAgentTarget(target *vizierpb.AgentTarget) string {
+	if target == nil {
+		return "all"
+	}
+	var parts []string
+	if len(target.NodeNames) > 0 {
+		parts = append(parts, "nodes="+strings.Join(target.NodeNames, ","))
+	}
+	if len(target.NodeLabels) > 0 {
+		parts = append(parts, "node-selector="+formatLabels(target.NodeLabels))
+	}
+	if len(target.Namespaces) > 0 {
+		parts = append(parts, "namespaces="+strings.Join(target.Namespaces, ","))
+	}
+	if len(target.PodLabels) > 0 {
+		parts = append(parts, "pod-selector="+formatLabels(target.PodLabels))
+	}
+	return strings.Join(parts, " ")
+}
+
+// SetAgentConfigCmd is the set sub-command of agent config.
+var SetAgentConfigCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a config key on the agents of a Vizier, rolling it out in batches",
+	Args:  cobra.ExactArgs(2),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+		batchSize, _ := cmd.Flags().GetInt32("batch-size")
+		verifyTimeout, _ := cmd.Flags().GetDuration("verify-timeout")
+		persist, _ := cmd.Flags().GetBool("persist")
+
+		req := &vizierpb.UpdateAgentsConfigRequest{
+			Key:             args[0],
+			Value:           args[1],
+			AgentTarget:     agentTargetFromFlags(cmd),
+			BatchSize:       batchSize,
+			VerifyTimeoutNS: int64(verifyTimeout),
+			Persist:         persist,
+		}
+
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+
+		w := components.CreateStreamWriter(format, os.Stdout)
+		w.SetHeader("agent_config", []string{"Hostname", "Agent ID", "State", "Message"})
+		failed, persisted := 0, false
+		err := conn.UpdateAgentsConfig(ctx, req, func(resp *vizierpb.UpdateAgentsConfigResponse) {
+			for _, a := range resp.AgentStatuses {
+				if a.State != vizierpb.AGENT_CONFIG_APPLIED {
+					failed++
+				}
+				_ = w.Write([]interface{}{a.Hostname, a.AgentID, formatAgentConfigState(a.State), a.Message})
+			}
+			persisted = persisted || resp.Persisted
+		})
+		w.Finish()
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to update agents config")
+		}
+		if failed > 0 {
+			utils.Fatalf("Rollout of %s stopped, %d agents were not updated", args[0], failed)
+		}
+		if persisted {
+			utils.Infof("Set %s=%s on all selected agents, and on agents that register later", args[0], args[1])
+			return
+		}
+		utils.Infof("Set %s=%s on all selected agents", args[0], args[1])
+	},
+}
+
+// ListAgentConfigsCmd is the list sub-command of agent config.
+var ListAgentConfigsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the config settings persisted for the agents of a Vizier",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		settings, err := conn.ListAgentConfigs(ctx)
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to list agents config")
+		}
+
+		w := components.CreateStreamWriter(format, os.Stdout)
+		defer w.Finish()
+		w.SetHeader("agent_configs", []string{"Key", "Value", "Target"})
+		for _, setting := range settings {
+			_ = w.Write([]interface{}{setting.Key, setting.Value, formatAgentTarget(setting.AgentTarget)})
+		}
+	},
+}
+
+// UnsetAgentConfigCmd is the unset sub-command of agent config.
+var UnsetAgentConfigCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a persisted config setting, so it's no longer applied to agents that register later",
+	Long: "Remove a persisted config setting, so it's no longer applied to agents that register later. " +
+		"The target flags must match the ones the setting was set with. Agents that already have the setting keep it until they restart.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		if err := conn.DeleteAgentConfig(ctx, args[0], agentTargetFromFlags(cmd)); err != nil {
+			utils.WithError(err).Fatal("Failed to unset agents config")
+		}
+		utils.Infof("Unset %s", args[0])
+	},
+}
+
+func formatAgentEventType(t vizierpb.AgentEventType) string {
+	return strings.TrimPrefix(t.String(), "AGENT_EVENT_")
+}
+
+// AgentEventsCmd is the events sub-command of agent.
+var AgentEventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Watch the lifecycle events of the agents of a Vizier, such as agents registering or expiring",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+		typeNames, _ := cmd.Flags().GetStringSlice("types")
+
+		var eventTypes []vizierpb.AgentEventType
+		for _, name := range typeNames {
+			t, ok := vizierpb.AgentEventType_value["AGENT_EVENT_"+strings.ToUpper(name)]
+			if !ok || t == int32(vizierpb.AGENT_EVENT_TYPE_UNKNOWN) {
+				utils.Fatalf("Invalid agent event type %s", name)
+			}
+			eventTypes = append(eventTypes, vizierpb.AgentEventType(t))
+		}
+
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+
+		w := components.CreateStreamWriter(format, os.Stdout)
+		w.SetHeader("agent_events", []string{"Time", "Event", "Hostname", "Pod", "Agent ID", "Tables"})
+		err := conn.GetAgentEvents(ctx, eventTypes, func(e *vizierpb.AgentEvent) {
+			_ = w.Write([]interface{}{
+				time.Unix(0, e.TimestampNS).Format(time.RFC3339),
+				formatAgentEventType(e.Type),
+				e.Hostname,
+				e.PodName,
+				e.AgentID,
+				strings.Join(e.Tables, ","),
+			})
+		})
+		w.Finish()
+		if err != nil && ctx.Err() == nil {
+			utils.WithError(err).Fatal("Failed to watch agent events")
+		}
+	},
+}
@@ -40,6 +40,7 @@ func init() {
 	DebugCmd.AddCommand(DebugLogCmd)
 	DebugCmd.AddCommand(DebugPodsCmd)
 	DebugCmd.AddCommand(DebugContainersCmd)
+	DebugCmd.AddCommand(DebugAgentsCmd)
 	DebugCmd.PersistentFlags().StringP("cluster", "c", "", "Run only on selected cluster")
 
 	DebugLogCmd.Flags().BoolP("previous", "p", false, "Show log from previous pod instead.")
@@ -47,6 +48,7 @@ func init() {
 
 	DebugPodsCmd.Flags().StringP("plane", "p", "all", "Optional filter for the plane (data, control, all)")
 	DebugContainersCmd.Flags().StringP("plane", "p", "all", "Optional filter for the plane (data, control, all)")
+	DebugAgentsCmd.Flags().Bool("unhealthy", false, "Only show the unhealthy agents")
 }
 
 // DebugCmd has internal debug functionality.
@@ -213,3 +215,55 @@ var DebugContainersCmd = &cobra.Command{
 		}
 	},
 }
+
+// DebugAgentsCmd is the agents debug command.
+var DebugAgentsCmd = &cobra.Command{
+	Use:   "agents",
+	Short: "Show the health of each vizier agent",
+	Run: func(cmd *cobra.Command, args []string) {
+		cloudAddr := viper.GetString("cloud_addr")
+		selectedCluster, _ := cmd.Flags().GetString("cluster")
+		unhealthyOnly, _ := cmd.Flags().GetBool("unhealthy")
+		clusterID := uuid.FromStringOrNil(selectedCluster)
+
+		var err error
+		if clusterID == uuid.Nil {
+			clusterID, err = getVizier(cloudAddr)
+			if err != nil {
+				utils.WithError(err).Fatal("Could not fetch healthy vizier")
+			}
+		}
+		fmt.Printf("Cluster ID : %s\n", clusterID.String())
+
+		conn, err := vizier.ConnectionToVizierByID(cloudAddr, clusterID)
+		if err != nil {
+			utils.WithError(err).Fatal("Could not connect to vizier")
+		}
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		agents, err := conn.AgentHealth(ctx)
+		if err != nil {
+			utils.WithError(err).Fatal("Could not fetch the health of the agents")
+		}
+
+		w := components.CreateStreamWriter("table", os.Stdout)
+		defer w.Finish()
+		w.SetHeader("agents", []string{"Hostname", "Pod", "ID", "State", "Last Heartbeat", "Tables", "Probe", "Probe Latency", "Healthy"})
+		for _, a := range agents {
+			if unhealthyOnly && a.Healthy {
+				continue
+			}
+			probe := "not probed"
+			if a.ProbeStatus != nil {
+				probe = "OK"
+				if a.ProbeStatus.Code != 0 {
+					probe = a.ProbeStatus.Message
+				}
+			}
+			_ = w.Write([]interface{}{
+				a.Hostname, a.PodName, a.AgentID, a.State, time.Duration(a.LastHeartbeatAgeNS).Round(time.Millisecond),
+				len(a.Tables), probe, time.Duration(a.ProbeLatencyNS).Round(time.Millisecond), a.Healthy,
+			})
+		}
+	},
+}
@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -37,6 +38,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
@@ -50,6 +52,7 @@ import (
 	"px.dev/pixie/src/pixie_cli/pkg/script"
 	"px.dev/pixie/src/pixie_cli/pkg/utils"
 	"px.dev/pixie/src/pixie_cli/pkg/vizier"
+	"px.dev/pixie/src/shared/services"
 	utils2 "px.dev/pixie/src/utils"
 	"px.dev/pixie/src/utils/shared/artifacts"
 	"px.dev/pixie/src/utils/shared/k8s"
@@ -81,10 +84,16 @@ func init() {
 	DeployCmd.Flags().StringP("labels", "l", "", "Custom labels to apply to Pixie resources")
 	DeployCmd.Flags().StringP("annotations", "t", "", "Custom annotations to apply to Pixie resources")
 	DeployCmd.Flags().StringP("cluster_name", "u", "", "The name for your cluster. Otherwise, the name will be taken from the current kubeconfig.")
+	DeployCmd.Flags().String("cluster_labels", "", "Labels for your cluster, which can be used to select clusters in Pixie Cloud. For example: env=prod,region=eu")
 	DeployCmd.Flags().StringP("pem_memory_limit", "p", "", "The memory limit to specify for the PEMs, otherwise a default is used.")
 	DeployCmd.Flags().StringP("pem_memory_request", "r", "", "The memory request to specify for the PEMs, otherwise a default is used.")
 	DeployCmd.Flags().StringArray("patches", []string{}, "Custom patches to apply to Pixie yamls, for example: 'vizier-pem:{\"spec\":{\"template\":{\"spec\":{\"nodeSelector\":{\"pixie\": \"allowed\"}}}}}'")
 	DeployCmd.Flags().String("pem_flags", "", "Flags to be set on the PEM.")
+	DeployCmd.Flags().String("cloud_proxy", "", "The URL of the HTTP CONNECT proxy that Pixie uses to connect to Pixie Cloud, for example: http://proxy.corp:3128")
+	DeployCmd.Flags().String("cloud_proxy_auth_secret", "", "The name of a secret in the Pixie namespace with the 'username' and 'password' of the --cloud_proxy")
+	DeployCmd.Flags().String("cloud_no_proxy", "", "A comma-separated list of hosts, domains and CIDRs to connect to directly rather than through the --cloud_proxy, in the format of NO_PROXY")
+	DeployCmd.Flags().String("cloud_ca_bundle", "", "Path to a PEM file of CA certificates that Pixie trusts when connecting to Pixie Cloud, such as the CA of a TLS-intercepting proxy")
+	DeployCmd.Flags().String("registry", "", "The private registry to pull Pixie images from, for example when the cluster has no internet access. Run 'px deploy images' to list the images to mirror to it.")
 	// Flags for deploying OLM.
 	DeployCmd.Flags().String("operator_version", "", "Operator version to deploy")
 	DeployCmd.Flags().Bool("deploy_olm", true, "Whether to deploy Operator Lifecycle Manager. OLM is required. This should only be false if OLM is already deployed on the cluster (either manually or through another application). Note: OLM is deployed by default on Openshift clusters.")
@@ -112,10 +121,16 @@ var DeployCmd = &cobra.Command{
 		viper.BindPFlag("labels", cmd.Flags().Lookup("labels"))
 		viper.BindPFlag("annotations", cmd.Flags().Lookup("annotations"))
 		viper.BindPFlag("cluster_name", cmd.Flags().Lookup("cluster_name"))
+		viper.BindPFlag("cluster_labels", cmd.Flags().Lookup("cluster_labels"))
 		viper.BindPFlag("pem_memory_limit", cmd.Flags().Lookup("pem_memory_limit"))
 		viper.BindPFlag("pem_memory_request", cmd.Flags().Lookup("pem_memory_request"))
 		viper.BindPFlag("patches", cmd.Flags().Lookup("patches"))
 		viper.BindPFlag("pem_flags", cmd.Flags().Lookup("pem_flags"))
+		viper.BindPFlag("cloud_proxy", cmd.Flags().Lookup("cloud_proxy"))
+		viper.BindPFlag("cloud_proxy_auth_secret", cmd.Flags().Lookup("cloud_proxy_auth_secret"))
+		viper.BindPFlag("cloud_no_proxy", cmd.Flags().Lookup("cloud_no_proxy"))
+		viper.BindPFlag("cloud_ca_bundle", cmd.Flags().Lookup("cloud_ca_bundle"))
+		viper.BindPFlag("registry", cmd.Flags().Lookup("registry"))
 		viper.BindPFlag("operator_version", cmd.Flags().Lookup("operator_version"))
 		viper.BindPFlag("deploy_olm", cmd.Flags().Lookup("deploy_olm"))
 		viper.BindPFlag("olm_namespace", cmd.Flags().Lookup("olm_namespace"))
@@ -225,6 +240,7 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 	check, _ := cmd.Flags().GetBool("check")
 	checkOnly, _ := cmd.Flags().GetBool("check_only")
 	extractPath, _ := cmd.Flags().GetString("extract_yaml")
+	namespace, _ := cmd.Flags().GetString("namespace")
 
 	// OLM flags.
 	deployOLM, _ := cmd.Flags().GetBool("deploy_olm")
@@ -235,9 +251,15 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 	useEtcdOperator, _ := cmd.Flags().GetBool("use_etcd_operator")
 	customLabels, _ := cmd.Flags().GetString("labels")
 	customAnnotations, _ := cmd.Flags().GetString("annotations")
+	clusterLabels, _ := cmd.Flags().GetString("cluster_labels")
 	pemMemoryLimit, _ := cmd.Flags().GetString("pem_memory_limit")
 	pemMemoryRequest, _ := cmd.Flags().GetString("pem_memory_request")
 	pemFlags, _ := cmd.Flags().GetString("pem_flags")
+	cloudProxy, _ := cmd.Flags().GetString("cloud_proxy")
+	cloudProxyAuthSecret, _ := cmd.Flags().GetString("cloud_proxy_auth_secret")
+	cloudNoProxy, _ := cmd.Flags().GetString("cloud_no_proxy")
+	cloudCABundlePath, _ := cmd.Flags().GetString("cloud_ca_bundle")
+	registry, _ := cmd.Flags().GetString("registry")
 	patches, _ := cmd.Flags().GetStringArray("patches")
 	dataAccess, _ := cmd.Flags().GetString("data_access")
 	datastreamBufferSize, _ := cmd.Flags().GetUint32("datastream_buffer_size")
@@ -266,6 +288,22 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 		}
 		annotationMap = am
 	}
+	clusterLabelMap := make(map[string]string)
+	if clusterLabels != "" {
+		lm, err := k8s.KeyValueStringToMap(clusterLabels)
+		if err != nil {
+			utils.WithError(err).Fatal("--cluster_labels must be specified through the following format: label1=value1,label2=value2")
+		}
+		for k, v := range lm {
+			if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+				utils.Fatalf("Invalid cluster label key %q: %s", k, strings.Join(errs, ", "))
+			}
+			if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+				utils.Fatalf("Invalid cluster label value %q: %s", v, strings.Join(errs, ", "))
+			}
+		}
+		clusterLabelMap = lm
+	}
 	patchesMap := make(map[string]string)
 	if len(patches) != 0 {
 		for _, p := range patches {
@@ -293,6 +331,29 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 		dataCollectorParams["datastreamBufferSpikeSize"] = datastreamBufferSpikeSize
 	}
 
+	var cloudCABundle string
+	if cloudCABundlePath != "" {
+		b, err := os.ReadFile(cloudCABundlePath)
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to read --cloud_ca_bundle")
+		}
+		cloudCABundle = string(b)
+	}
+	if u, err := url.Parse(cloudProxy); err != nil {
+		utils.WithError(err).Fatal("Invalid --cloud_proxy")
+	} else if u.User != nil {
+		utils.Fatal("--cloud_proxy must not contain credentials, which should be stored in the --cloud_proxy_auth_secret instead")
+	}
+	var cloudProxyMap map[string]interface{}
+	if cloudProxy != "" || cloudCABundle != "" {
+		cloudProxyMap = map[string]interface{}{
+			"proxyURL":   cloudProxy,
+			"authSecret": cloudProxyAuthSecret,
+			"noProxy":    cloudNoProxy,
+			"caBundle":   cloudCABundle,
+		}
+	}
+
 	castedDataAccess := vztypes.DataAccessLevel(dataAccess)
 	if castedDataAccess != vztypes.DataAccessFull && castedDataAccess != vztypes.DataAccessRestricted {
 		utils.Fatal("--data_access must be a valid data access level")
@@ -324,7 +385,17 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 			os.Exit(0)
 		}
 
-		err = utils.RunExtraClusterChecks()
+		extraChecks := utils.ExtraClusterChecks
+		if cloudProxy != "" {
+			proxyConfig, err := getCloudProxyConfig(namespace, cloudProxy, cloudNoProxy, cloudProxyAuthSecret)
+			if err != nil {
+				utils.WithError(err).Fatal("Failed to read --cloud_proxy_auth_secret")
+			}
+			// The proxy is checked from this machine, so a passing check doesn't guarantee that the cluster can reach it.
+			extraChecks = append(extraChecks[:len(extraChecks):len(extraChecks)],
+				utils.ClientSideCloudConnectivityCheck(viper.GetString("cloud_addr"), proxyConfig, cloudCABundle))
+		}
+		err = utils.RunClusterChecks(extraChecks)
 		if err != nil {
 			clusterOk := components.YNPrompt("Some cluster checks failed. Pixie may not work properly on your cluster. Continue with deploy?", true)
 			if !clusterOk {
@@ -334,7 +405,6 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	namespace, _ := cmd.Flags().GetString("namespace")
 	devCloudNS := viper.GetString("dev_cloud_namespace")
 	cloudAddr := viper.GetString("cloud_addr")
 
@@ -372,7 +442,7 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 	// Get deploy key, if not already specified.
 	var deployKeyID string
 	if deployKey == "" {
-		deployKeyID, deployKey, err = generateDeployKey(cloudAddr, "Auto-generated by the Pixie CLI")
+		deployKeyID, deployKey, err = generateDeployKey(cloudAddr, "Auto-generated by the Pixie CLI", nil)
 		if err != nil {
 			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
 			log.WithError(err).Fatal("Failed to generate deployment key")
@@ -421,6 +491,7 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 			"deployKey":            deployKey,
 			"cloudAddr":            cloudAddr,
 			"clusterName":          clusterName,
+			"clusterLabels":        clusterLabelMap,
 			"disableAutoUpdate":    false,
 			"useEtcdOperator":      useEtcdOperator,
 			"devCloudNamespace":    devCloudNS,
@@ -433,6 +504,8 @@ func runDeployCmd(cmd *cobra.Command, args []string) {
 			"patches":             patchesMap,
 			"dataAccess":          castedDataAccess,
 			"dataCollectorParams": dataCollectorParams,
+			"registry":            registry,
+			"cloudProxy":          cloudProxyMap,
 		},
 		Release: &map[string]interface{}{
 			"Namespace": namespace,
@@ -515,6 +588,11 @@ func deploy(cloudConn *grpc.ClientConn, clientset *kubernetes.Clientset, vzClien
 	olmSubscriptionJob := newTaskWrapper("Deploying OLM Subscription", func() error {
 		return retryDeploy(clientset, kubeConfig, yamlMap["subscription"])
 	})
+	// The operator is only deployed directly when a registry is set, in which case the catalog and subscription are
+	// empty.
+	operatorJob := newTaskWrapper("Deploying Operator", func() error {
+		return retryDeploy(clientset, kubeConfig, yamlMap["operator"])
+	})
 
 	namespaceJob := newTaskWrapper("Creating namespace", func() error {
 		// Create namespace, if needed.
@@ -568,12 +646,12 @@ func deploy(cloudConn *grpc.ClientConn, clientset *kubernetes.Clientset, vzClien
 	})
 
 	deployJobs := []utils.Task{
-		vzCRDJob, olmPxJob, olmCatalogJob, olmSubscriptionJob, namespaceJob, vzJob, waitJob,
+		vzCRDJob, olmPxJob, olmCatalogJob, olmSubscriptionJob, operatorJob, namespaceJob, vzJob, waitJob,
 	}
 
 	if deployOLM {
 		deployJobs = []utils.Task{
-			olmCRDJob, olmJob, olmPxJob, vzCRDJob, olmCatalogJob, olmSubscriptionJob, namespaceJob, vzJob, waitJob,
+			olmCRDJob, olmJob, olmPxJob, vzCRDJob, olmCatalogJob, olmSubscriptionJob, operatorJob, namespaceJob, vzJob, waitJob,
 		}
 	}
 
@@ -740,6 +818,26 @@ func initiateUpdate(ctx context.Context, conn *grpc.ClientConn, clusterID uuid.U
 	return nil
 }
 
+// getCloudProxyConfig gets the config of the proxy used to connect to Pixie Cloud, reading the proxy's credentials
+// from the auth secret in the namespace.
+func getCloudProxyConfig(namespace, proxyURL, noProxy, authSecret string) (*services.ProxyConfig, error) {
+	proxyConfig := &services.ProxyConfig{
+		URL:     proxyURL,
+		NoProxy: noProxy,
+	}
+	if authSecret == "" {
+		return proxyConfig, nil
+	}
+
+	s := k8s.GetSecret(k8s.GetClientset(k8s.GetConfig()), namespace, authSecret)
+	if s == nil {
+		return nil, fmt.Errorf("secret %s not found in namespace %s", authSecret, namespace)
+	}
+	proxyConfig.Username = string(s.Data[vztypes.CloudProxyUsernameKey])
+	proxyConfig.Password = string(s.Data[vztypes.CloudProxyPasswordKey])
+	return proxyConfig, nil
+}
+
 func retryDeploy(clientset *kubernetes.Clientset, config *rest.Config, yamlContents string) error {
 	tries := 12
 	var err error
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"px.dev/pixie/src/pixie_cli/pkg/auth"
+	"px.dev/pixie/src/pixie_cli/pkg/components"
+	"px.dev/pixie/src/pixie_cli/pkg/images"
+	"px.dev/pixie/src/pixie_cli/pkg/utils"
+	"px.dev/pixie/src/utils/shared/artifacts"
+	yamlsutils "px.dev/pixie/src/utils/shared/yamls"
+)
+
+func init() {
+	DeployCmd.AddCommand(DeployImagesCmd)
+
+	DeployImagesCmd.Flags().StringP("vizier_version", "v", "", "Pixie version to list the images of. Defaults to the latest version")
+	DeployImagesCmd.Flags().String("operator_version", "", "Operator version to list the images of. Defaults to the latest version")
+	DeployImagesCmd.Flags().String("registry", "", "The private registry the images will be mirrored to, which is passed to 'px deploy --registry'")
+	DeployImagesCmd.Flags().String("export", "", "Path of an OCI image layout tarball to export the images to")
+	DeployImagesCmd.Flags().String("platform", "linux/amd64", "The platform of the images to export")
+	DeployImagesCmd.Flags().StringP("output", "o", "", "Output format: one of: json|csv")
+}
+
+// DeployImagesCmd is the "deploy images" command, which lists the images that are needed to deploy Pixie.
+var DeployImagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "List or export the images needed to deploy Pixie",
+	Long: `List or export the images needed to deploy Pixie, so that they can be mirrored to a private registry for
+clusters without internet access. The exported tarball is an OCI image layout, where each image is annotated with
+its original name. Each image should be pushed to the name listed in the "Registry Image" column, for example with:
+
+  skopeo copy oci-archive:pixie_images.tar:<image> docker://<registry image>
+
+Pixie can then be deployed with 'px deploy --registry <registry>'. Since OLM can only pull the operator from its
+public bundle, the operator is then deployed directly rather than through OLM.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("vizier_version", cmd.Flags().Lookup("vizier_version"))
+		viper.BindPFlag("operator_version", cmd.Flags().Lookup("operator_version"))
+		viper.BindPFlag("registry", cmd.Flags().Lookup("registry"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		registry, _ := cmd.Flags().GetString("registry")
+		exportPath, _ := cmd.Flags().GetString("export")
+		platform, _ := cmd.Flags().GetString("platform")
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+
+		cloudConn, err := utils.GetCloudClientConnection(viper.GetString("cloud_addr"))
+		if err != nil {
+			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+			log.WithError(err).Fatalln("Failed to get grpc connection to cloud")
+		}
+
+		versionString := viper.GetString("vizier_version")
+		if versionString == "" {
+			versionString, err = getLatestVizierVersion(cloudConn)
+			if err != nil {
+				// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+				log.WithError(err).Fatal("Failed to fetch Vizier versions")
+			}
+		}
+		operatorVersion := viper.GetString("operator_version")
+		if operatorVersion == "" {
+			operatorVersion, err = getLatestOperatorVersion(cloudConn)
+			if err != nil {
+				// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+				log.WithError(err).Fatal("Failed to fetch Operator versions")
+			}
+		}
+
+		vizierYAMLs, err := artifacts.FetchVizierTemplates(cloudConn, auth.MustLoadDefaultCredentials().Token, versionString)
+		if err != nil {
+			log.WithError(err).Fatal("Could not fetch Vizier YAMLs")
+		}
+		operatorYAMLs, err := artifacts.FetchOperatorTemplates(cloudConn, operatorVersion)
+		if err != nil {
+			log.WithError(err).Fatal("Could not fetch operator YAMLs")
+		}
+
+		imageList := listDeployImages(append(vizierYAMLs, operatorYAMLs...))
+
+		w := components.CreateStreamWriter(format, os.Stdout)
+		w.SetHeader("images", []string{"Image", "Registry Image"})
+		for _, image := range imageList {
+			_ = w.Write([]interface{}{image, yamlsutils.RegistryImage(registry, image)})
+		}
+		w.Finish()
+
+		if exportPath == "" {
+			return
+		}
+		exporter, err := images.NewExporter(http.DefaultClient, platform)
+		if err != nil {
+			utils.WithError(err).Fatal("Invalid platform")
+		}
+		f, err := os.Create(exportPath)
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to create export file")
+		}
+		defer f.Close()
+
+		utils.Infof("Exporting %d images to %s", len(imageList), exportPath)
+		if err := exporter.Export(context.Background(), imageList, f); err != nil {
+			utils.WithError(err).Fatal("Failed to export images")
+		}
+		utils.Infof("Exported images to %s", exportPath)
+	},
+}
+
+// listDeployImages returns the sorted, unique images used by the given templates.
+func listDeployImages(templates []*yamlsutils.YAMLFile) []string {
+	imageSet := make(map[string]bool)
+	for _, t := range templates {
+		for _, image := range yamlsutils.ListImages(t.YAML) {
+			imageSet[image] = true
+		}
+	}
+
+	imageList := make([]string, 0, len(imageSet))
+	for image := range imageSet {
+		imageList = append(imageList, image)
+	}
+	sort.Strings(imageList)
+	return imageList
+}
@@ -24,8 +24,10 @@ import (
 	"os"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -36,6 +38,7 @@ import (
 	"px.dev/pixie/src/pixie_cli/pkg/components"
 	"px.dev/pixie/src/pixie_cli/pkg/utils"
 	utils2 "px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/shared/k8s"
 )
 
 func init() {
@@ -44,14 +47,21 @@ func init() {
 	DeployKeyCmd.AddCommand(ListDeployKeyCmd)
 	DeployKeyCmd.AddCommand(GetDeployKeyCmd)
 	DeployKeyCmd.AddCommand(LookupDeployKeyCmd)
+	DeployKeyCmd.AddCommand(ListDeployKeyClustersCmd)
 
 	CreateDeployKeyCmd.Flags().StringP("desc", "d", "", "A description for the deploy key")
 	CreateDeployKeyCmd.Flags().BoolP("short", "s", false, "Return only the created deploy key, for use to pipe to other tools")
+	CreateDeployKeyCmd.Flags().Duration("expires_in", 0, "Duration after which the deploy key can no longer be used to register clusters. Never expires if unset")
+	CreateDeployKeyCmd.Flags().Int64("max_clusters", 0, "The maximum number of clusters that may register with the deploy key. Unlimited if unset")
+	CreateDeployKeyCmd.Flags().String("cluster_name_pattern", "", "Regular expression that cluster names must fully match to register with the deploy key")
+	CreateDeployKeyCmd.Flags().String("default_labels", "", "Labels applied to clusters registered with the deploy key. For example, env=prod,team=infra")
 
 	DeleteDeployKeyCmd.Flags().StringP("id", "i", "", "The deploy key to delete")
 
 	ListDeployKeyCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
 
+	ListDeployKeyClustersCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
+
 	LookupDeployKeyCmd.Flags().StringP("key", "k", "", "Value of the key. Leave blank to be prompted.")
 }
 
@@ -78,7 +88,12 @@ var CreateDeployKeyCmd = &cobra.Command{
 		desc := viper.GetString("desc")
 		short, _ := cmd.Flags().GetBool("short")
 
-		keyID, key, err := generateDeployKey(cloudAddr, desc)
+		restrictions, err := deployKeyRestrictionsFromFlags(cmd)
+		if err != nil {
+			utils.WithError(err).Fatal("Invalid deploy key restrictions")
+		}
+
+		keyID, key, err := generateDeployKey(cloudAddr, desc, restrictions)
 		if err != nil {
 			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
 			log.WithError(err).Fatal("Failed to generate deployment key")
@@ -140,10 +155,10 @@ var ListDeployKeyCmd = &cobra.Command{
 		// Throw keys into table.
 		w := components.CreateStreamWriter(format, os.Stdout)
 		defer w.Finish()
-		w.SetHeader("deployment-keys", []string{"ID", "Key", "CreatedAt", "Description"})
+		w.SetHeader("deployment-keys", []string{"ID", "Key", "CreatedAt", "Description", "ExpiresAt", "Clusters"})
 		for _, k := range keys {
 			_ = w.Write([]interface{}{utils2.UUIDFromProtoOrNil(k.ID), "<hidden>", k.CreatedAt,
-				k.Desc})
+				k.Desc, formatDeployKeyExpiry(k.Restrictions), formatDeployKeyClusterUsage(k.NumClusters, k.Restrictions)})
 		}
 	},
 }
@@ -206,12 +221,95 @@ var GetDeployKeyCmd = &cobra.Command{
 		// Throw keys into table.
 		w := components.CreateStreamWriter(format, os.Stdout)
 		defer w.Finish()
-		w.SetHeader("deployment-keys", []string{"ID", "Key", "CreatedAt", "Description"})
+		w.SetHeader("deployment-keys", []string{"ID", "Key", "CreatedAt", "Description", "ExpiresAt", "Clusters"})
 		_ = w.Write([]interface{}{utils2.UUIDFromProtoOrNil(k.ID), k.Key, k.CreatedAt,
-			k.Desc})
+			k.Desc, formatDeployKeyExpiry(k.Restrictions), formatDeployKeyClusterUsage(k.NumClusters, k.Restrictions)})
 	},
 }
 
+// ListDeployKeyClustersCmd is the Clusters sub-command of DeployKey.
+var ListDeployKeyClustersCmd = &cobra.Command{
+	Use:   "clusters",
+	Short: "List the clusters registered with a deployment key",
+	Run: func(cmd *cobra.Command, args []string) {
+		cloudAddr := viper.GetString("cloud_addr")
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+
+		if len(args) != 1 {
+			utils.Fatal("Expected a single argument 'key id'.")
+		}
+
+		keyID, err := uuid.FromString(args[0])
+		if err != nil {
+			utils.Fatal("Malformed Key ID. Expected a single argument 'key id'.")
+		}
+		clusters, err := listDeployKeyClusters(cloudAddr, keyID)
+		if err != nil {
+			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+			log.WithError(err).Fatal("Failed to list deployment key clusters")
+		}
+		w := components.CreateStreamWriter(format, os.Stdout)
+		defer w.Finish()
+		w.SetHeader("deployment-key-clusters", []string{"ClusterID", "ClusterName", "CreatedAt"})
+		for _, c := range clusters {
+			_ = w.Write([]interface{}{utils2.UUIDFromProtoOrNil(c.VizierID), c.ClusterName, c.CreatedAt})
+		}
+	},
+}
+
+func deployKeyRestrictionsFromFlags(cmd *cobra.Command) (*cloudpb.DeploymentKeyRestrictions, error) {
+	expiresIn, _ := cmd.Flags().GetDuration("expires_in")
+	maxClusters, _ := cmd.Flags().GetInt64("max_clusters")
+	namePattern, _ := cmd.Flags().GetString("cluster_name_pattern")
+	defaultLabels, _ := cmd.Flags().GetString("default_labels")
+
+	if expiresIn < 0 {
+		return nil, fmt.Errorf("expires_in must be positive")
+	}
+	if maxClusters < 0 {
+		return nil, fmt.Errorf("max_clusters must be positive")
+	}
+
+	r := &cloudpb.DeploymentKeyRestrictions{
+		MaxClusters:        maxClusters,
+		ClusterNamePattern: namePattern,
+	}
+	if expiresIn > 0 {
+		expiresAt, err := types.TimestampProto(time.Now().Add(expiresIn))
+		if err != nil {
+			return nil, err
+		}
+		r.ExpiresAt = expiresAt
+	}
+	if defaultLabels != "" {
+		lm, err := k8s.KeyValueStringToMap(defaultLabels)
+		if err != nil {
+			return nil, err
+		}
+		r.DefaultLabels = lm
+	}
+	return r, nil
+}
+
+func formatDeployKeyExpiry(r *cloudpb.DeploymentKeyRestrictions) string {
+	if r == nil || r.ExpiresAt == nil {
+		return "never"
+	}
+	t, err := types.TimestampFromProto(r.ExpiresAt)
+	if err != nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatDeployKeyClusterUsage(numClusters int64, r *cloudpb.DeploymentKeyRestrictions) string {
+	if r == nil || r.MaxClusters == 0 {
+		return fmt.Sprintf("%d", numClusters)
+	}
+	return fmt.Sprintf("%d/%d", numClusters, r.MaxClusters)
+}
+
 func getClientAndContext(cloudAddr string) (cloudpb.VizierDeploymentKeyManagerClient, context.Context, error) {
 	// Get grpc connection to cloud.
 	cloudConn, err := utils.GetCloudClientConnection(cloudAddr)
@@ -227,13 +325,16 @@ func getClientAndContext(cloudAddr string) (cloudpb.VizierDeploymentKeyManagerCl
 	return deployMgrClient, ctxWithCreds, nil
 }
 
-func generateDeployKey(cloudAddr string, desc string) (string, string, error) {
+func generateDeployKey(cloudAddr string, desc string, restrictions *cloudpb.DeploymentKeyRestrictions) (string, string, error) {
 	deployMgrClient, ctxWithCreds, err := getClientAndContext(cloudAddr)
 	if err != nil {
 		return "", "", err
 	}
 
-	resp, err := deployMgrClient.Create(ctxWithCreds, &cloudpb.CreateDeploymentKeyRequest{Desc: desc})
+	resp, err := deployMgrClient.Create(ctxWithCreds, &cloudpb.CreateDeploymentKeyRequest{
+		Desc:         desc,
+		Restrictions: restrictions,
+	})
 	if err != nil {
 		return "", "", err
 	}
@@ -296,3 +397,19 @@ func getDeployKeys(cloudAddr string, keyID uuid.UUID) (*cloudpb.DeploymentKey, e
 
 	return resp.Key, nil
 }
+
+func listDeployKeyClusters(cloudAddr string, keyID uuid.UUID) ([]*cloudpb.DeploymentKeyCluster, error) {
+	deployMgrClient, ctxWithCreds, err := getClientAndContext(cloudAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := deployMgrClient.ListClusters(ctxWithCreds, &cloudpb.ListDeploymentKeyClustersRequest{
+		ID: utils2.ProtoFromUUID(keyID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Clusters, nil
+}
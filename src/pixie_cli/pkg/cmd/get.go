@@ -29,10 +29,14 @@ import (
 	"github.com/blang/semver"
 	"github.com/dustin/go-humanize"
 	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"px.dev/pixie/src/api/proto/cloudpb"
 	"px.dev/pixie/src/pixie_cli/pkg/components"
 	"px.dev/pixie/src/pixie_cli/pkg/script"
 	cliUtils "px.dev/pixie/src/pixie_cli/pkg/utils"
@@ -48,8 +52,12 @@ func init() {
 	GetPEMsCmd.Flags().StringP("cluster", "c", "", "Run only on selected cluster")
 	GetPEMsCmd.Flags().MarkHidden("all-clusters")
 
+	GetViziersCmd.Flags().StringP("selector", "l", "", "Label selector to filter on, e.g. 'env=prod,region in (eu, us)'")
+
 	GetClusterCmd.Flags().Bool("id", false, "Whether to only fetch the cluster ID from the cluster running in the current kubeconfig")
 	GetClusterCmd.Flags().Bool("cloud-addr", false, "Whether to only fetch the cloud address from the cluster running in the current kubeconfig")
+	GetClusterCmd.Flags().Bool("history", false, "Whether to fetch the status history of the cluster running in the current kubeconfig")
+	GetClusterCmd.Flags().Int64("limit", 50, "The maximum number of status transitions to fetch when --history is specified")
 
 	GetCmd.AddCommand(GetPEMsCmd)
 	GetCmd.AddCommand(GetViziersCmd)
@@ -98,14 +106,18 @@ var GetViziersCmd = &cobra.Command{
 		cloudAddr := viper.GetString("cloud_addr")
 		format, _ := cmd.Flags().GetString("output")
 		format = strings.ToLower(format)
+		selector, _ := cmd.Flags().GetString("selector")
 
 		l, err := vizier.NewLister(cloudAddr)
 		if err != nil {
 			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
 			log.WithError(err).Fatal("Failed to create Vizier lister")
 		}
-		vzs, err := l.GetViziersInfo()
+		vzs, err := l.GetViziersInfoWithSelector(selector)
 		if err != nil {
+			if status.Code(err) == codes.InvalidArgument {
+				cliUtils.WithError(err).Fatal("Invalid label selector")
+			}
 			// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
 			log.WithError(err).Fatalln("Failed to get vizier information")
 		}
@@ -114,7 +126,7 @@ var GetViziersCmd = &cobra.Command{
 
 		w := components.CreateStreamWriter(format, os.Stdout)
 		defer w.Finish()
-		w.SetHeader("viziers", []string{"ClusterName", "ID", "K8s Version", "Vizier Version", "Last Heartbeat", "Status", "Status Message"})
+		w.SetHeader("viziers", []string{"ClusterName", "ID", "K8s Version", "Vizier Version", "Last Heartbeat", "Status", "Status Message", "Labels"})
 
 		for _, vz := range vzs {
 			var lastHeartbeat interface{}
@@ -141,11 +153,21 @@ var GetViziersCmd = &cobra.Command{
 				}
 			}
 			_ = w.Write([]interface{}{vz.ClusterName, utils.UUIDFromProtoOrNil(vz.ID), vz.ClusterVersion, sb.String(),
-				lastHeartbeat, vz.Status, vz.StatusMessage})
+				lastHeartbeat, vz.Status, vz.StatusMessage, formatClusterLabels(vz.Labels)})
 		}
 	},
 }
 
+// formatClusterLabels formats the labels as a sorted, comma separated list of key=value pairs.
+func formatClusterLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
 // GetClusterCmd is the "get cluster" command to get information about the current kubeconfig cluster.
 var GetClusterCmd = &cobra.Command{
 	Use:   "cluster",
@@ -157,6 +179,7 @@ var GetClusterCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		id, _ := cmd.Flags().GetBool("id")
 		addr, _ := cmd.Flags().GetBool("cloud-addr")
+		history, _ := cmd.Flags().GetBool("history")
 
 		config := k8s.GetConfig()
 
@@ -178,10 +201,60 @@ var GetClusterCmd = &cobra.Command{
 			return
 		}
 
+		if history {
+			if clusterID == uuid.Nil {
+				cliUtils.Fatal("Cannot fetch status history without a Pixie cluster in the current kubeconfig")
+			}
+			format, _ := cmd.Flags().GetString("output")
+			format = strings.ToLower(format)
+			limit, _ := cmd.Flags().GetInt64("limit")
+			printClusterStatusHistory(viper.GetString("cloud_addr"), clusterID, limit, format)
+			return
+		}
+
 		cliUtils.Infof("Cluster ID: %s\nCloud Address: %s", clusterID, cloudAddr)
 	},
 }
 
+func printClusterStatusHistory(cloudAddr string, clusterID uuid.UUID, limit int64, format string) {
+	l, err := vizier.NewLister(cloudAddr)
+	if err != nil {
+		// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+		log.WithError(err).Fatal("Failed to create Vizier lister")
+	}
+	transitions, err := l.GetVizierStatusHistory(clusterID, limit)
+	if err != nil {
+		// Using log.Fatal rather than CLI log in order to track this unexpected error in Sentry.
+		log.WithError(err).Fatalln("Failed to get vizier status history")
+	}
+
+	w := components.CreateStreamWriter(format, os.Stdout)
+	defer w.Finish()
+	w.SetHeader("status_history", []string{"Time", "Status", "Previous Status", "Status Message", "Unhealthy Pods"})
+
+	for _, t := range transitions {
+		var transitionTime interface{}
+		transitionTime = t.Time
+		if ts, err := types.TimestampFromProto(t.Time); err == nil && (format == "" || format == "table") {
+			transitionTime = humanize.Time(ts)
+		}
+
+		var unhealthyPods []string
+		for name, pod := range t.ControlPlanePodStatuses {
+			if pod.Status != cloudpb.RUNNING && pod.Status != cloudpb.SUCCEEDED {
+				unhealthyPods = append(unhealthyPods, name)
+			}
+		}
+		for name := range t.UnhealthyDataPlanePodStatuses {
+			unhealthyPods = append(unhealthyPods, name)
+		}
+		sort.Strings(unhealthyPods)
+
+		_ = w.Write([]interface{}{transitionTime, t.Status, t.PreviousStatus, t.StatusMessage,
+			strings.Join(unhealthyPods, ", ")})
+	}
+}
+
 // GetCmd is the "get" command.
 var GetCmd = &cobra.Command{
 	Use:   "get",
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/pixie_cli/pkg/components"
+	"px.dev/pixie/src/pixie_cli/pkg/utils"
+	"px.dev/pixie/src/pixie_cli/pkg/vizier"
+)
+
+func init() {
+	QueryCmd.AddCommand(ListQueriesCmd)
+	QueryCmd.AddCommand(CancelQueryCmd)
+	QueryCmd.AddCommand(QueryLogCmd)
+	QueryCmd.PersistentFlags().StringP("cluster", "c", "", "ID of the cluster to use. Defaults to the current cluster")
+
+	ListQueriesCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
+
+	QueryLogCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
+	QueryLogCmd.Flags().Duration("since", 24*time.Hour, "Only show the queries that started within this duration")
+	QueryLogCmd.Flags().Bool("slow", false, "Only show the slow queries")
+	QueryLogCmd.Flags().Int64("limit", 100, "The maximum number of queries to show, 0 for no limit")
+	QueryLogCmd.Flags().Bool("plans", false, "Print the analyze plans of the slow queries")
+}
+
+// QueryCmd is the query sub-command of the CLI.
+var QueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Manage the queries running on a Vizier",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Info("Nothing here... Please execute one of the subcommands")
+		cmd.Help()
+	},
+}
+
+func queryConnectionFromFlags(cmd *cobra.Command) *vizier.Connector {
+	cloudAddr := viper.GetString("cloud_addr")
+	selectedCluster, _ := cmd.Flags().GetString("cluster")
+	clusterID := uuid.FromStringOrNil(selectedCluster)
+
+	var err error
+	if clusterID == uuid.Nil {
+		clusterID, err = vizier.GetCurrentOrFirstHealthyVizier(cloudAddr)
+		if err != nil {
+			utils.WithError(err).Fatal("Could not fetch healthy vizier")
+		}
+	}
+
+	conn, err := vizier.ConnectionToVizierByID(cloudAddr, clusterID)
+	if err != nil {
+		utils.WithError(err).Fatal("Could not connect to vizier")
+	}
+	return conn
+}
+
+// ListQueriesCmd is the list sub-command of query.
+var ListQueriesCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the queries running on a Vizier",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		queries, err := conn.ListQueries(ctx)
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to list queries")
+		}
+
+		w := components.CreateStreamWriter(format, os.Stdout)
+		defer w.Finish()
+		w.SetHeader("queries", []string{"ID", "Name", "User", "Running For", "Agents", "Records", "Bytes"})
+		for _, q := range queries {
+			runningFor := time.Since(time.Unix(0, q.StartTimestampNS)).Round(time.Second)
+			_ = w.Write([]interface{}{
+				q.QueryID, q.QueryName, q.User, runningFor, len(q.AgentIDs), q.RecordsProcessed, q.BytesProcessed,
+			})
+		}
+	},
+}
+
+// CancelQueryCmd is the cancel sub-command of query.
+var CancelQueryCmd = &cobra.Command{
+	Use:   "cancel <query id>",
+	Short: "Cancel a query running on a Vizier",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		queryID, err := uuid.FromString(args[0])
+		if err != nil {
+			utils.WithError(err).Fatal("Invalid query ID")
+		}
+
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		if err := conn.CancelQuery(ctx, queryID); err != nil {
+			utils.WithError(err).Fatal("Failed to cancel query")
+		}
+		utils.Infof("Cancelled query %s", queryID.String())
+	},
+}
+
+// QueryLogCmd is the log sub-command of query.
+var QueryLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the queries that you executed on a Vizier",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+		since, _ := cmd.Flags().GetDuration("since")
+		slowOnly, _ := cmd.Flags().GetBool("slow")
+		limit, _ := cmd.Flags().GetInt64("limit")
+		showPlans, _ := cmd.Flags().GetBool("plans")
+
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		entries, err := conn.GetQueryLog(ctx, &vizierpb.GetQueryLogRequest{
+			SinceTimestampNS: time.Now().Add(-since).UnixNano(),
+			SlowOnly:         slowOnly,
+			Limit:            limit,
+		})
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to get the query log")
+		}
+
+		w := components.CreateStreamWriter(format, os.Stdout)
+		w.SetHeader("query_log", []string{"Start", "ID", "Name", "User", "Duration", "Records", "Bytes", "Data Access", "Status", "Slow"})
+		for _, e := range entries {
+			queryStatus := codes.Code(e.Status.GetCode()).String()
+			if msg := e.Status.GetMessage(); msg != "" {
+				queryStatus = fmt.Sprintf("%s: %s", queryStatus, msg)
+			}
+			_ = w.Write([]interface{}{
+				time.Unix(0, e.StartTimestampNS).Format(time.RFC3339), e.QueryID, e.QueryName, e.User,
+				time.Duration(e.DurationNS).Round(time.Millisecond), e.RecordsProcessed, e.BytesProcessed,
+				e.DataAccess.GetLevel(), queryStatus, e.Slow,
+			})
+		}
+		w.Finish()
+
+		if !showPlans {
+			return
+		}
+		for _, e := range entries {
+			if e.AnalyzePlan == "" {
+				continue
+			}
+			fmt.Printf("\nPlan of query %s:\n%s\n", e.QueryID, e.AnalyzePlan)
+		}
+	},
+}
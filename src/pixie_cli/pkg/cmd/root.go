@@ -69,6 +69,9 @@ func init() {
 	RootCmd.AddCommand(DeployKeyCmd)
 	RootCmd.AddCommand(APIKeyCmd)
 	RootCmd.AddCommand(DebugCmd)
+	RootCmd.AddCommand(QueryCmd)
+	RootCmd.AddCommand(TracepointCmd)
+	RootCmd.AddCommand(AgentCmd)
 
 	RootCmd.PersistentFlags().MarkHidden("cloud_addr")
 	RootCmd.PersistentFlags().MarkHidden("dev_cloud_namespace")
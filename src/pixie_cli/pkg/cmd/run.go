@@ -50,6 +50,15 @@ func init() {
 
 	RunCmd.Flags().StringP("bundle", "b", "", "Path/URL to bundle file")
 
+	RunCmd.Flags().Bool("explain", false, "Output the query plan of the script after its results")
+	RunCmd.Flags().Bool("analyze", false, "Output the query plan of the script with execution stats for each operator")
+	RunCmd.Flags().StringSlice("plan-out", nil, "Files to write the query plan to, in a format based on the extension: dot|svg|json")
+	RunCmd.Flags().Bool("allow-partial", false, "Output the results that were received if some agents fail or time out, instead of failing")
+	RunCmd.Flags().StringSlice("target-nodes", nil, "Only run the script on the agents of these nodes")
+	RunCmd.Flags().StringToString("target-node-selector", nil, "Only run the script on the agents of nodes with these labels, e.g. pool=a,zone=b")
+	RunCmd.Flags().StringSlice("target-namespaces", nil, "Only run the script on the agents of nodes hosting pods in these namespaces")
+	RunCmd.Flags().StringToString("target-pod-selector", nil, "Only run the script on the agents of nodes hosting pods with these labels, e.g. app=checkout")
+
 	RunCmd.SetHelpFunc(func(command *cobra.Command, args []string) {
 		viper.BindPFlag("bundle", command.Flags().Lookup("bundle"))
 		br, err := createBundleReader()
@@ -185,13 +194,29 @@ func createNewCobraCommand() *cobra.Command {
 				}
 			}
 
+			execScript.AllowPartialResults, _ = cmd.Flags().GetBool("allow-partial")
+			execScript.TargetNodes, _ = cmd.Flags().GetStringSlice("target-nodes")
+			execScript.TargetNodeLabels, _ = cmd.Flags().GetStringToString("target-node-selector")
+			execScript.TargetNamespaces, _ = cmd.Flags().GetStringSlice("target-namespaces")
+			execScript.TargetPodLabels, _ = cmd.Flags().GetStringToString("target-pod-selector")
+
 			conns := vizier.MustConnectHealthyDefaultVizier(cloudAddr, allClusters, clusterID)
 			useEncryption, _ := cmd.Flags().GetBool("e2e_encryption")
 
 			// Support Ctrl+C to cancel a query.
 			ctx, cleanup := utils.WithSignalCancellable(context.Background())
 			defer cleanup()
-			err = vizier.RunScriptAndOutputResults(ctx, conns, execScript, format, useEncryption)
+			explain, _ := cmd.Flags().GetBool("explain")
+			analyze, _ := cmd.Flags().GetBool("analyze")
+			planFiles, _ := cmd.Flags().GetStringSlice("plan-out")
+			if explain || analyze || len(planFiles) > 0 {
+				err = vizier.RunScriptAndExplain(ctx, conns, execScript, format, useEncryption, &vizier.ExplainOptions{
+					Analyze:     analyze,
+					OutputFiles: planFiles,
+				})
+			} else {
+				err = vizier.RunScriptAndOutputResults(ctx, conns, execScript, format, useEncryption)
+			}
 
 			if err != nil {
 				vzErr, ok := err.(*vizier.ScriptExecutionError)
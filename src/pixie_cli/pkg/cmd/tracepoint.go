@@ -0,0 +1,199 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/pixie_cli/pkg/components"
+	"px.dev/pixie/src/pixie_cli/pkg/utils"
+)
+
+func init() {
+	TracepointCmd.AddCommand(ListTracepointsCmd)
+	TracepointCmd.AddCommand(DescribeTracepointCmd)
+	TracepointCmd.AddCommand(DeleteTracepointCmd)
+	TracepointCmd.AddCommand(RenewTracepointCmd)
+	TracepointCmd.PersistentFlags().StringP("cluster", "c", "", "ID of the cluster to use. Defaults to the current cluster")
+
+	ListTracepointsCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
+
+	DescribeTracepointCmd.Flags().StringP("output", "o", "", "Output format: one of: json|proto")
+
+	RenewTracepointCmd.Flags().Duration("ttl", 10*time.Minute, "The new TTL of the tracepoint, starting now")
+}
+
+// TracepointCmd is the tracepoint sub-command of the CLI.
+var TracepointCmd = &cobra.Command{
+	Use:     "tracepoint",
+	Aliases: []string{"tracepoints"},
+	Short:   "Manage the tracepoints deployed on a Vizier",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.Info("Nothing here... Please execute one of the subcommands")
+		cmd.Help()
+	},
+}
+
+func formatLifeCycleState(state vizierpb.LifeCycleState) string {
+	return strings.TrimSuffix(state.String(), "_STATE")
+}
+
+func formatTracepointExpiry(tp *vizierpb.TracepointInfo) string {
+	if tp.ExpiryTimestampNS == 0 {
+		return "-"
+	}
+	expiresIn := time.Until(time.Unix(0, tp.ExpiryTimestampNS)).Round(time.Second)
+	if expiresIn <= 0 {
+		return "expired"
+	}
+	return expiresIn.String()
+}
+
+// ListTracepointsCmd is the list sub-command of tracepoint.
+var ListTracepointsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the tracepoints deployed on a Vizier",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		tracepoints, err := conn.ListTracepoints(ctx, nil)
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to list tracepoints")
+		}
+
+		w := components.CreateStreamWriter(format, os.Stdout)
+		defer w.Finish()
+		w.SetHeader("tracepoints", []string{"Name", "ID", "State", "Expected State", "Tables", "Agents Running", "Agents Failed", "Expires In"})
+		for _, tp := range tracepoints {
+			running, failed := 0, 0
+			for _, a := range tp.AgentStatuses {
+				switch a.State {
+				case vizierpb.RUNNING_STATE:
+					running++
+				case vizierpb.FAILED_STATE:
+					failed++
+				}
+			}
+			_ = w.Write([]interface{}{
+				tp.Name, tp.ID, formatLifeCycleState(tp.State), formatLifeCycleState(tp.ExpectedState),
+				strings.Join(tp.SchemaNames, ","), running, failed, formatTracepointExpiry(tp),
+			})
+		}
+	},
+}
+
+// DescribeTracepointCmd is the describe sub-command of tracepoint.
+var DescribeTracepointCmd = &cobra.Command{
+	Use:   "describe <name>",
+	Short: "Show the state of a tracepoint on each agent, including any failures",
+	Args:  cobra.ExactArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("output", cmd.Flags().Lookup("output"))
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		format = strings.ToLower(format)
+
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		tracepoints, err := conn.ListTracepoints(ctx, []string{args[0]})
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to get tracepoint")
+		}
+		if len(tracepoints) != 1 {
+			utils.Fatalf("Tracepoint %s not found", args[0])
+		}
+		tp := tracepoints[0]
+
+		if format == "" || format == "table" {
+			fmt.Printf("Name           : %s\n", tp.Name)
+			fmt.Printf("ID             : %s\n", tp.ID)
+			fmt.Printf("State          : %s\n", formatLifeCycleState(tp.State))
+			fmt.Printf("Expected State : %s\n", formatLifeCycleState(tp.ExpectedState))
+			fmt.Printf("Tables         : %s\n", strings.Join(tp.SchemaNames, ", "))
+			fmt.Printf("Expires In     : %s\n\n", formatTracepointExpiry(tp))
+		}
+
+		w := components.CreateStreamWriter(format, os.Stdout)
+		defer w.Finish()
+		w.SetHeader("agent_tracepoints", []string{"Hostname", "Agent ID", "State", "Message"})
+		for _, a := range tp.AgentStatuses {
+			message := ""
+			if a.Status != nil && a.Status.Code != int32(codes.OK) {
+				message = fmt.Sprintf("%s: %s", codes.Code(a.Status.Code).String(), a.Status.Message)
+			}
+			_ = w.Write([]interface{}{a.Hostname, a.AgentID, formatLifeCycleState(a.State), message})
+		}
+	},
+}
+
+// DeleteTracepointCmd is the delete sub-command of tracepoint.
+var DeleteTracepointCmd = &cobra.Command{
+	Use:   "delete <name>...",
+	Short: "Remove tracepoints from all agents of a Vizier",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		if err := conn.DeleteTracepoints(ctx, args); err != nil {
+			utils.WithError(err).Fatal("Failed to delete tracepoints")
+		}
+		utils.Infof("Deleting tracepoints %s", strings.Join(args, ", "))
+	},
+}
+
+// RenewTracepointCmd is the renew sub-command of tracepoint.
+var RenewTracepointCmd = &cobra.Command{
+	Use:   "renew <name>",
+	Short: "Extend the TTL of a tracepoint without redeploying it",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+		if ttl <= 0 {
+			utils.Fatal("The TTL must be positive")
+		}
+
+		conn := queryConnectionFromFlags(cmd)
+		ctx, cleanup := utils.WithSignalCancellable(context.Background())
+		defer cleanup()
+		expiry, err := conn.SetTracepointTTL(ctx, args[0], ttl)
+		if err != nil {
+			utils.WithError(err).Fatal("Failed to renew tracepoint")
+		}
+		utils.Infof("Tracepoint %s now expires at %s", args[0], expiry.Format(time.RFC3339))
+	},
+}
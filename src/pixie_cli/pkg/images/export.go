@@ -0,0 +1,371 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package images
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// The media types of Docker images, which registries serve alongside the OCI media types.
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+var manifestMediaTypes = []string{
+	v1.MediaTypeImageIndex,
+	v1.MediaTypeImageManifest,
+	mediaTypeDockerManifestList,
+	mediaTypeDockerManifest,
+}
+
+var authParamRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Exporter pulls images from their registries and exports them as an OCI image layout, so that they can be mirrored
+// to a registry which is reachable from clusters without internet access.
+type Exporter struct {
+	client   *http.Client
+	platform v1.Platform
+	// The bearer tokens used to pull from each repository, keyed by the registry and repository.
+	tokens map[string]string
+}
+
+// NewExporter creates an exporter that pulls the images for the given platform, such as linux/amd64.
+func NewExporter(client *http.Client, platform string) (*Exporter, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid platform %q, expected <os>/<arch>[/<variant>]", platform)
+	}
+	p := v1.Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return &Exporter{
+		client:   client,
+		platform: p,
+		tokens:   make(map[string]string),
+	}, nil
+}
+
+// Export writes the images to w as a tarball of an OCI image layout. Each image is annotated with its reference in
+// the layout's index. Images referenced by tag are exported for the exporter's platform only, while images referenced
+// by digest are exported for all of their platforms, so that the digest stays the same once mirrored.
+func (e *Exporter) Export(ctx context.Context, images []string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	written := make(map[digest.Digest]bool)
+
+	index := v1.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: make([]v1.Descriptor, 0, len(images)),
+	}
+	for _, image := range images {
+		ref, err := ParseReference(image)
+		if err != nil {
+			return err
+		}
+		desc, err := e.exportImage(ctx, tw, ref, written)
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", image, err)
+		}
+		desc.Annotations = map[string]string{v1.AnnotationRefName: image}
+		index.Manifests = append(index.Manifests, *desc)
+	}
+
+	layout, err := json.Marshal(v1.ImageLayout{Version: v1.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, v1.ImageLayoutFile, layout); err != nil {
+		return err
+	}
+	indexJSON, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "index.json", indexJSON); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// exportImage exports the manifest of the image and the blobs it references, returning the descriptor of the manifest.
+func (e *Exporter) exportImage(ctx context.Context, tw *tar.Writer, ref *Reference, written map[digest.Digest]bool) (*v1.Descriptor, error) {
+	desc, b, err := e.fetchManifest(ctx, ref, ref.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	if desc.MediaType == v1.MediaTypeImageIndex || desc.MediaType == mediaTypeDockerManifestList {
+		var index v1.Index
+		if err := json.Unmarshal(b, &index); err != nil {
+			return nil, err
+		}
+		if _, err := digest.Parse(ref.Tag); err == nil {
+			// The whole index is needed to preserve its digest.
+			for _, m := range index.Manifests {
+				if err := e.exportManifest(ctx, tw, ref, m.Digest.String(), written); err != nil {
+					return nil, err
+				}
+			}
+			if err := writeBlob(tw, desc.Digest, b, written); err != nil {
+				return nil, err
+			}
+			return desc, nil
+		}
+
+		var platformDesc *v1.Descriptor
+		for i, m := range index.Manifests {
+			if m.Platform != nil && m.Platform.OS == e.platform.OS && m.Platform.Architecture == e.platform.Architecture &&
+				(e.platform.Variant == "" || m.Platform.Variant == e.platform.Variant) {
+				platformDesc = &index.Manifests[i]
+				break
+			}
+		}
+		if platformDesc == nil {
+			return nil, fmt.Errorf("no image found for platform %s/%s", e.platform.OS, e.platform.Architecture)
+		}
+		desc, b, err = e.fetchManifest(ctx, ref, platformDesc.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := e.exportBlobs(ctx, tw, ref, b, written); err != nil {
+		return nil, err
+	}
+	if err := writeBlob(tw, desc.Digest, b, written); err != nil {
+		return nil, err
+	}
+	return desc, nil
+}
+
+// exportManifest exports the image manifest with the given digest and the blobs it references.
+func (e *Exporter) exportManifest(ctx context.Context, tw *tar.Writer, ref *Reference, manifestDigest string, written map[digest.Digest]bool) error {
+	desc, b, err := e.fetchManifest(ctx, ref, manifestDigest)
+	if err != nil {
+		return err
+	}
+	if err := e.exportBlobs(ctx, tw, ref, b, written); err != nil {
+		return err
+	}
+	return writeBlob(tw, desc.Digest, b, written)
+}
+
+// exportBlobs exports the config and layers referenced by the image manifest.
+func (e *Exporter) exportBlobs(ctx context.Context, tw *tar.Writer, ref *Reference, manifestJSON []byte, written map[digest.Digest]bool) error {
+	var manifest v1.Manifest
+	if err := json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return err
+	}
+	for _, blob := range append([]v1.Descriptor{manifest.Config}, manifest.Layers...) {
+		if written[blob.Digest] {
+			continue
+		}
+		if err := e.exportBlob(ctx, tw, ref, blob); err != nil {
+			return err
+		}
+		written[blob.Digest] = true
+	}
+	return nil
+}
+
+// exportBlob streams the blob from the registry into the layout, verifying its digest.
+func (e *Exporter) exportBlob(ctx context.Context, tw *tar.Writer, ref *Reference, blob v1.Descriptor) error {
+	if err := blob.Digest.Validate(); err != nil {
+		return err
+	}
+	resp, err := e.get(ctx, ref, fmt.Sprintf("blobs/%s", blob.Digest), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:     blobPath(blob.Digest),
+		Mode:     0644,
+		Size:     blob.Size,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	verifier := blob.Digest.Verifier()
+	if _, err := io.CopyN(io.MultiWriter(tw, verifier), resp.Body, blob.Size); err != nil {
+		return err
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("digest mismatch for blob %s", blob.Digest)
+	}
+	return nil
+}
+
+// fetchManifest fetches the manifest with the given tag or digest, returning its descriptor and contents.
+func (e *Exporter) fetchManifest(ctx context.Context, ref *Reference, tagOrDigest string) (*v1.Descriptor, []byte, error) {
+	resp, err := e.get(ctx, ref, fmt.Sprintf("manifests/%s", tagOrDigest), manifestMediaTypes)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	desc := &v1.Descriptor{
+		MediaType: strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]),
+		Digest:    digest.FromBytes(b),
+		Size:      int64(len(b)),
+	}
+	if d, err := digest.Parse(tagOrDigest); err == nil && d != desc.Digest {
+		return nil, nil, fmt.Errorf("digest mismatch for manifest %s", d)
+	}
+	return desc, b, nil
+}
+
+// get fetches the given path of the image's repository from the registry API, authenticating if required.
+func (e *Exporter) get(ctx context.Context, ref *Reference, p string, accept []string) (*http.Response, error) {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", ref.registry(), ref.Repository, p)
+	tokenKey := path.Join(ref.registry(), ref.Repository)
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range accept {
+			req.Header.Add("Accept", a)
+		}
+		if token, ok := e.tokens[tokenKey]; ok {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+
+		resp, err := e.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return nil, fmt.Errorf("unexpected status %s fetching %s", resp.Status, u)
+		}
+
+		token, err := e.fetchToken(ctx, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return nil, err
+		}
+		e.tokens[tokenKey] = token
+	}
+}
+
+// fetchToken fetches an anonymous bearer token for the challenge returned by the registry.
+func (e *Exporter) fetchToken(ctx context.Context, challenge string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", errors.New("registry requires an unsupported authentication scheme")
+	}
+	params := make(map[string]string)
+	for _, m := range authParamRegex.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", errors.New("registry returned an invalid authentication challenge")
+	}
+	q := realm.Query()
+	if service, ok := params["service"]; ok {
+		q.Set("service", service)
+	}
+	if scope, ok := params["scope"]; ok {
+		q.Set("scope", scope)
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s fetching registry token", resp.Status)
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.Token != "" {
+		return tokenResp.Token, nil
+	}
+	return tokenResp.AccessToken, nil
+}
+
+func blobPath(d digest.Digest) string {
+	return path.Join("blobs", d.Algorithm().String(), d.Hex())
+}
+
+// writeBlob writes the contents of a blob to the layout, unless it was already written.
+func writeBlob(tw *tar.Writer, d digest.Digest, b []byte, written map[digest.Digest]bool) error {
+	if written[d] {
+		return nil
+	}
+	if err := writeTarFile(tw, blobPath(d), b); err != nil {
+		return err
+	}
+	written[d] = true
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, b []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(b)),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(b)
+	return err
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package images_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/pixie_cli/pkg/images"
+)
+
+type testBlob struct {
+	mediaType string
+	content   []byte
+}
+
+func (b *testBlob) descriptor() v1.Descriptor {
+	return v1.Descriptor{
+		MediaType: b.mediaType,
+		Digest:    digest.FromBytes(b.content),
+		Size:      int64(len(b.content)),
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
+// newTestRegistry serves a multi-platform image at test/image:1.0, which requires a bearer token to pull.
+func newTestRegistry(t *testing.T) (*httptest.Server, map[string]*testBlob) {
+	blobs := make(map[string]*testBlob)
+	manifests := make(map[string]*testBlob)
+
+	newManifest := func(platform string) v1.Descriptor {
+		config := &testBlob{mediaType: v1.MediaTypeImageConfig, content: []byte(fmt.Sprintf(`{"platform":%q}`, platform))}
+		layer := &testBlob{mediaType: v1.MediaTypeImageLayerGzip, content: []byte("layer-" + platform)}
+		blobs[config.descriptor().Digest.String()] = config
+		blobs[layer.descriptor().Digest.String()] = layer
+		manifest := &testBlob{
+			mediaType: v1.MediaTypeImageManifest,
+			content: mustMarshal(t, v1.Manifest{
+				Versioned: specs.Versioned{SchemaVersion: 2},
+				Config:    config.descriptor(),
+				Layers:    []v1.Descriptor{layer.descriptor()},
+			}),
+		}
+		desc := manifest.descriptor()
+		manifests[desc.Digest.String()] = manifest
+		blobs[desc.Digest.String()] = manifest
+		return desc
+	}
+
+	amd64 := newManifest("amd64")
+	amd64.Platform = &v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := newManifest("arm64")
+	arm64.Platform = &v1.Platform{OS: "linux", Architecture: "arm64"}
+	index := &testBlob{
+		mediaType: v1.MediaTypeImageIndex,
+		content: mustMarshal(t, v1.Index{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			Manifests: []v1.Descriptor{amd64, arm64},
+		}),
+	}
+	manifests["1.0"] = index
+	manifests[index.descriptor().Digest.String()] = index
+	blobs[index.descriptor().Digest.String()] = index
+
+	var s *httptest.Server
+	s = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "repository:test/image:pull", r.URL.Query().Get("scope"))
+			_, _ = w.Write([]byte(`{"token":"abc"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:test/image:pull"`, s.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var b *testBlob
+		if strings.HasPrefix(r.URL.Path, "/v2/test/image/manifests/") {
+			b = manifests[strings.TrimPrefix(r.URL.Path, "/v2/test/image/manifests/")]
+		} else if strings.HasPrefix(r.URL.Path, "/v2/test/image/blobs/") {
+			b = blobs[strings.TrimPrefix(r.URL.Path, "/v2/test/image/blobs/")]
+		}
+		if b == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", b.mediaType)
+		_, _ = w.Write(b.content)
+	}))
+	return s, blobs
+}
+
+func readTar(t *testing.T, r io.Reader) map[string][]byte {
+	files := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		b, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = b
+	}
+	return files
+}
+
+func TestExporter_Export(t *testing.T) {
+	s, blobs := newTestRegistry(t)
+	defer s.Close()
+
+	tests := []struct {
+		name          string
+		tag           string
+		expectedBlobs int
+	}{
+		{
+			name: "tag",
+			tag:  ":1.0",
+			// The amd64 manifest, config and layer.
+			expectedBlobs: 3,
+		},
+		{
+			name: "digest",
+			// The index, and the manifest, config and layer of each platform.
+			expectedBlobs: 7,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tag := test.tag
+			if tag == "" {
+				for d, b := range blobs {
+					if b.mediaType == v1.MediaTypeImageIndex {
+						tag = "@" + d
+					}
+				}
+			}
+			image := strings.TrimPrefix(s.URL, "https://") + "/test/image" + tag
+
+			e, err := images.NewExporter(s.Client(), "linux/amd64")
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, e.Export(context.Background(), []string{image}, &buf))
+
+			files := readTar(t, &buf)
+			assert.Contains(t, files, "oci-layout")
+
+			var index v1.Index
+			require.NoError(t, json.Unmarshal(files["index.json"], &index))
+			require.Len(t, index.Manifests, 1)
+			assert.Equal(t, image, index.Manifests[0].Annotations[v1.AnnotationRefName])
+
+			numBlobs := 0
+			for name, content := range files {
+				if !strings.HasPrefix(name, "blobs/sha256/") {
+					continue
+				}
+				numBlobs++
+				assert.Equal(t, strings.TrimPrefix(name, "blobs/sha256/"), digest.FromBytes(content).Hex())
+			}
+			assert.Equal(t, test.expectedBlobs, numBlobs)
+			assert.Contains(t, files, "blobs/sha256/"+index.Manifests[0].Digest.Hex())
+
+			var manifest v1.Manifest
+			require.NoError(t, json.Unmarshal(files["blobs/sha256/"+index.Manifests[0].Digest.Hex()], &manifest))
+			if test.tag != "" {
+				assert.Equal(t, []byte(`{"platform":"amd64"}`), files["blobs/sha256/"+manifest.Config.Digest.Hex()])
+			}
+		})
+	}
+}
+
+func TestNewExporter_InvalidPlatform(t *testing.T) {
+	_, err := images.NewExporter(http.DefaultClient, "linux")
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package images
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// Reference is a parsed image reference, such as gcr.io/pixie-oss/pixie-prod/vizier/pem_image:0.9.0.
+type Reference struct {
+	// Domain is the domain of the registry that hosts the image.
+	Domain string
+	// Repository is the path of the image within the registry.
+	Repository string
+	// Tag is the tag of the image, or the digest of the image if it is referenced by digest.
+	Tag string
+}
+
+// ParseReference parses the given image into a Reference, following the conventions of Docker: images with no
+// domain are hosted on Docker Hub, and images with no tag use the latest tag.
+func ParseReference(image string) (*Reference, error) {
+	ref := &Reference{}
+	name := image
+	if i := strings.Index(name, "@"); i != -1 {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	} else if i := strings.LastIndex(name, ":"); i != -1 && !strings.Contains(name[i+1:], "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	} else {
+		ref.Tag = "latest"
+	}
+	if name == "" || ref.Tag == "" {
+		return nil, fmt.Errorf("invalid image reference %q", image)
+	}
+
+	i := strings.Index(name, "/")
+	if i == -1 || (!strings.ContainsAny(name[:i], ".:") && name[:i] != "localhost") {
+		ref.Domain = dockerHubDomain
+		ref.Repository = name
+	} else {
+		ref.Domain = name[:i]
+		ref.Repository = name[i+1:]
+	}
+	if ref.Domain == dockerHubDomain && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	return ref, nil
+}
+
+// registry returns the host of the registry API for the reference.
+func (r *Reference) registry() string {
+	if r.Domain == dockerHubDomain {
+		return dockerHubRegistry
+	}
+	return r.Domain
+}
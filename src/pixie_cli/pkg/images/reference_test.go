@@ -0,0 +1,86 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package images_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/pixie_cli/pkg/images"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    string
+		expected *images.Reference
+	}{
+		{
+			name:  "domain and tag",
+			image: "gcr.io/pixie-oss/pixie-prod/vizier/pem_image:0.9.0",
+			expected: &images.Reference{
+				Domain:     "gcr.io",
+				Repository: "pixie-oss/pixie-prod/vizier/pem_image",
+				Tag:        "0.9.0",
+			},
+		},
+		{
+			name:  "digest",
+			image: "quay.io/operator-framework/olm@sha256:b706ee6583c4c3cf8059d44234c8a4505804adcc742bcddb3d1e2f6eff3d6519",
+			expected: &images.Reference{
+				Domain:     "quay.io",
+				Repository: "operator-framework/olm",
+				Tag:        "sha256:b706ee6583c4c3cf8059d44234c8a4505804adcc742bcddb3d1e2f6eff3d6519",
+			},
+		},
+		{
+			name:  "docker hub",
+			image: "nats:2.8.4-alpine",
+			expected: &images.Reference{
+				Domain:     "docker.io",
+				Repository: "library/nats",
+				Tag:        "2.8.4-alpine",
+			},
+		},
+		{
+			name:  "registry with port and no tag",
+			image: "localhost:5000/px/etcd",
+			expected: &images.Reference{
+				Domain:     "localhost:5000",
+				Repository: "px/etcd",
+				Tag:        "latest",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref, err := images.ParseReference(test.image)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, ref)
+		})
+	}
+}
+
+func TestParseReference_Invalid(t *testing.T) {
+	_, err := images.ParseReference("gcr.io/pixie-oss/pem_image:")
+	assert.Error(t, err)
+}
@@ -53,6 +53,15 @@ type ExecutableScript struct {
 	IsLocal bool
 	// Args contains a map from name to argument info.
 	Args map[string]Arg
+	// AllowPartialResults completes the script with the results that were received if some agents
+	// fail or time out, instead of failing.
+	AllowPartialResults bool
+	// TargetNodes, TargetNodeLabels, TargetNamespaces and TargetPodLabels restrict the script, and the
+	// tracepoints it deploys, to the agents on the matching nodes. Every one that is set must match.
+	TargetNodes      []string
+	TargetNodeLabels map[string]string
+	TargetNamespaces []string
+	TargetPodLabels  map[string]string
 }
 
 // LiveViewLink returns the fully qualified URL for the live view.
@@ -19,7 +19,12 @@
 package utils
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	"google.golang.org/grpc"
 
@@ -42,3 +47,42 @@ func GetCloudClientConnection(cloudAddr string) (*grpc.ClientConn, error) {
 
 	return c, nil
 }
+
+// ClientSideCloudConnectivityCheck checks that Pixie Cloud at cloudAddr can be reached through the HTTP CONNECT proxy,
+// and that its certificate is trusted with the CAs in caBundle. This is a client-side check: it connects from the
+// machine running the CLI, not from the cluster, so it doesn't catch network policies or routes that only apply to the
+// cluster's pods.
+func ClientSideCloudConnectivityCheck(cloudAddr string, proxy *services.ProxyConfig, caBundle string) Checker {
+	name := fmt.Sprintf("Pixie Cloud is reachable through proxy %s from this machine (client-side, not from the cluster)", proxy.URL)
+
+	return NamedCheck(name, func() error {
+		tlsConfig, err := services.CloudTLSConfig(false, caBundle)
+		if err != nil {
+			return err
+		}
+		dialer, err := services.NewProxyDialer(proxy, tlsConfig)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		conn, err := dialer(ctx, cloudAddr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		host, _, err := net.SplitHostPort(cloudAddr)
+		if err != nil {
+			return err
+		}
+		cloudTLSConfig := tlsConfig.Clone()
+		cloudTLSConfig.ServerName = host
+		cloudTLSConfig.NextProtos = []string{"h2"}
+		if err := tls.Client(conn, cloudTLSConfig).HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("failed TLS handshake with Pixie Cloud, the proxy's CA may be missing from the CA bundle: %w", err)
+		}
+		return nil
+	})
+}
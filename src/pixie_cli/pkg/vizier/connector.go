@@ -297,12 +297,22 @@ func (c *Connector) ExecuteScriptStream(ctx context.Context, script *script.Exec
 		scriptName = script.ScriptName
 	}
 	reqPB := &vizierpb.ExecuteScriptRequest{
-		QueryStr:          scriptStr,
-		ClusterID:         c.id.String(),
-		ExecFuncs:         execFuncs,
-		Mutation:          containsMutation(script),
-		EncryptionOptions: encOpts,
-		QueryName:         scriptName,
+		QueryStr:            scriptStr,
+		ClusterID:           c.id.String(),
+		ExecFuncs:           execFuncs,
+		Mutation:            containsMutation(script),
+		EncryptionOptions:   encOpts,
+		QueryName:           scriptName,
+		AllowPartialResults: script.AllowPartialResults,
+	}
+	if len(script.TargetNodes) > 0 || len(script.TargetNodeLabels) > 0 || len(script.TargetNamespaces) > 0 ||
+		len(script.TargetPodLabels) > 0 {
+		reqPB.AgentTarget = &vizierpb.AgentTarget{
+			NodeNames:  script.TargetNodes,
+			NodeLabels: script.TargetNodeLabels,
+			Namespaces: script.TargetNamespaces,
+			PodLabels:  script.TargetPodLabels,
+		}
 	}
 
 	resp, err := c.vz.ExecuteScript(auth.CtxWithCreds(ctx), reqPB)
@@ -447,3 +457,276 @@ func (c *Connector) DebugPodsRequest(ctx context.Context) (chan *DebugPodsRespon
 	}()
 	return results, nil
 }
+
+// ListQueries returns the queries that are currently running on the Vizier.
+func (c *Connector) ListQueries(ctx context.Context) ([]*vizierpb.RunningQuery, error) {
+	reqPB := &vizierpb.ListQueriesRequest{
+		ClusterID: c.id.String(),
+	}
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.ListQueries(ctx, reqPB)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []*vizierpb.RunningQuery
+	for {
+		msg, err := resp.Recv()
+		if err == io.EOF {
+			return queries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, msg.Queries...)
+	}
+}
+
+// CancelQuery cancels the query with the given ID on the Vizier.
+func (c *Connector) CancelQuery(ctx context.Context, queryID uuid.UUID) error {
+	reqPB := &vizierpb.CancelQueryRequest{
+		ClusterID: c.id.String(),
+		QueryID:   queryID.String(),
+	}
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.CancelQuery(ctx, reqPB)
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := resp.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if s := msg.Status; s != nil && s.Code != int32(codes.OK) {
+			return status.Error(codes.Code(s.Code), s.Message)
+		}
+	}
+}
+
+// GetQueryLog returns the executed queries recorded in the query log of the Vizier.
+func (c *Connector) GetQueryLog(ctx context.Context, req *vizierpb.GetQueryLogRequest) ([]*vizierpb.QueryLogEntry, error) {
+	req.ClusterID = c.id.String()
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.GetQueryLog(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*vizierpb.QueryLogEntry
+	for {
+		msg, err := resp.Recv()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, msg.Entries...)
+	}
+}
+
+// ListTracepoints returns the tracepoints with the given names deployed on the Vizier, or all of them if
+// no names are given.
+func (c *Connector) ListTracepoints(ctx context.Context, names []string) ([]*vizierpb.TracepointInfo, error) {
+	reqPB := &vizierpb.ListTracepointsRequest{
+		ClusterID: c.id.String(),
+		Names:     names,
+	}
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.ListTracepoints(ctx, reqPB)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracepoints []*vizierpb.TracepointInfo
+	for {
+		msg, err := resp.Recv()
+		if err == io.EOF {
+			return tracepoints, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		tracepoints = append(tracepoints, msg.Tracepoints...)
+	}
+}
+
+// DeleteTracepoints removes the tracepoints with the given names from the Vizier.
+func (c *Connector) DeleteTracepoints(ctx context.Context, names []string) error {
+	reqPB := &vizierpb.DeleteTracepointRequest{
+		ClusterID: c.id.String(),
+		Names:     names,
+	}
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.DeleteTracepoint(ctx, reqPB)
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := resp.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if s := msg.Status; s != nil && s.Code != int32(codes.OK) {
+			return status.Error(codes.Code(s.Code), s.Message)
+		}
+	}
+}
+
+// SetTracepointTTL replaces the TTL of the tracepoint with the given name, and returns when it now expires.
+func (c *Connector) SetTracepointTTL(ctx context.Context, name string, ttl time.Duration) (time.Time, error) {
+	reqPB := &vizierpb.SetTracepointTTLRequest{
+		ClusterID: c.id.String(),
+		Name:      name,
+		TTLNS:     int64(ttl),
+	}
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.SetTracepointTTL(ctx, reqPB)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var expiry time.Time
+	for {
+		msg, err := resp.Recv()
+		if err == io.EOF {
+			return expiry, nil
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if s := msg.Status; s != nil && s.Code != int32(codes.OK) {
+			return time.Time{}, status.Error(codes.Code(s.Code), s.Message)
+		}
+		expiry = time.Unix(0, msg.ExpiryTimestampNS)
+	}
+}
+
+// UpdateAgentsConfig rolls out a config update to the agents of the Vizier matching the request. onBatch is
+// called with the outcome on the agents of each batch as the rollout progresses.
+func (c *Connector) UpdateAgentsConfig(ctx context.Context, reqPB *vizierpb.UpdateAgentsConfigRequest,
+	onBatch func(*vizierpb.UpdateAgentsConfigResponse)) error {
+	reqPB.ClusterID = c.id.String()
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.UpdateAgentsConfig(ctx, reqPB)
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := resp.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		onBatch(msg)
+	}
+}
+
+// ListAgentConfigs returns the config settings persisted for the agents of the Vizier, which are applied to agents
+// as they register.
+func (c *Connector) ListAgentConfigs(ctx context.Context) ([]*vizierpb.AgentConfigSetting, error) {
+	reqPB := &vizierpb.ListAgentConfigsRequest{
+		ClusterID: c.id.String(),
+	}
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.ListAgentConfigs(ctx, reqPB)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings []*vizierpb.AgentConfigSetting
+	for {
+		msg, err := resp.Recv()
+		if err == io.EOF {
+			return settings, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, msg.Settings...)
+	}
+}
+
+// DeleteAgentConfig removes the persisted config setting for the key and target from the Vizier.
+func (c *Connector) DeleteAgentConfig(ctx context.Context, key string, target *vizierpb.AgentTarget) error {
+	reqPB := &vizierpb.DeleteAgentConfigRequest{
+		ClusterID:   c.id.String(),
+		Key:         key,
+		AgentTarget: target,
+	}
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.DeleteAgentConfig(ctx, reqPB)
+	if err != nil {
+		return err
+	}
+
+	for {
+		_, err := resp.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// GetAgentEvents streams the lifecycle events of the agents of the given types, or of all types if none are given,
+// until the context is cancelled.
+func (c *Connector) GetAgentEvents(ctx context.Context, eventTypes []vizierpb.AgentEventType,
+	onEvent func(*vizierpb.AgentEvent)) error {
+	reqPB := &vizierpb.GetAgentEventsRequest{
+		ClusterID: c.id.String(),
+		Types:     eventTypes,
+	}
+	ctx = auth.CtxWithCreds(ctx)
+	resp, err := c.vz.GetAgentEvents(ctx, reqPB)
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := resp.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range msg.Events {
+			onEvent(e)
+		}
+	}
+}
+
+// AgentHealth returns the health of each agent of the Vizier, as last checked by the Vizier.
+func (c *Connector) AgentHealth(ctx context.Context) ([]*vizierpb.AgentHealth, error) {
+	reqPB := &vizierpb.HealthCheckRequest{
+		ClusterID:     c.id.String(),
+		IncludeAgents: true,
+	}
+	ctx, cancel := context.WithCancel(auth.CtxWithCreds(ctx))
+	// The health check streams updates until cancelled, only the first one is needed.
+	defer cancel()
+	resp, err := c.vz.HealthCheck(ctx, reqPB)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := resp.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return msg.Agents, nil
+}
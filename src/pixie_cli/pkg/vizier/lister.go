@@ -44,9 +44,15 @@ func NewLister(cloudAddr string) (*Lister, error) {
 
 // GetViziersInfo returns information about connected viziers.
 func (l *Lister) GetViziersInfo() ([]*cloudpb.ClusterInfo, error) {
+	return l.GetViziersInfoWithSelector("")
+}
+
+// GetViziersInfoWithSelector returns information about connected viziers whose labels match the given
+// label selector. An empty selector matches all viziers.
+func (l *Lister) GetViziersInfoWithSelector(selector string) ([]*cloudpb.ClusterInfo, error) {
 	ctx := auth.CtxWithCreds(context.Background())
 
-	c, err := l.vc.GetClusterInfo(ctx, &cloudpb.GetClusterInfoRequest{})
+	c, err := l.vc.GetClusterInfo(ctx, &cloudpb.GetClusterInfoRequest{Selector: selector})
 	if err != nil {
 		return nil, err
 	}
@@ -64,3 +70,18 @@ func (l *Lister) GetVizierInfo(id uuid.UUID) ([]*cloudpb.ClusterInfo, error) {
 	}
 	return c.Clusters, nil
 }
+
+// GetVizierStatusHistory returns the status transitions of a vizier, ordered from newest to oldest.
+func (l *Lister) GetVizierStatusHistory(id uuid.UUID, limit int64) ([]*cloudpb.ClusterStatusTransition, error) {
+	ctx := auth.CtxWithCreds(context.Background())
+	clusterIDPb := utils.ProtoFromUUID(id)
+
+	resp, err := l.vc.GetClusterStatusHistory(ctx, &cloudpb.GetClusterStatusHistoryRequest{
+		ID:    clusterIDPb,
+		Limit: limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Transitions, nil
+}
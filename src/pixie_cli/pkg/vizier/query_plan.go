@@ -0,0 +1,355 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package vizier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"px.dev/pixie/src/pixie_cli/pkg/utils"
+)
+
+// QueryPlanTableName is the name of the table that holds the query plan of a script run with explain or analyze.
+const QueryPlanTableName = "__query_plan__"
+
+const agentLabelPrefix = "agent::"
+
+var operatorLabelRegex = regexp.MustCompile(`^(\w+)\[(\d+)\]$`)
+
+// QueryPlanStat is a single statistic reported for an operator when a script is run with analyze.
+type QueryPlanStat struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// QueryPlanOperator is a single operator of a plan fragment.
+type QueryPlanOperator struct {
+	// The key of the operator in the plan graph.
+	Key   string          `json:"key"`
+	Type  string          `json:"type"`
+	ID    int64           `json:"id"`
+	Stats []QueryPlanStat `json:"stats,omitempty"`
+	// The keys of the operators that consume the output of this operator.
+	Children []string `json:"children,omitempty"`
+}
+
+// QueryPlanFragment is the part of the plan executed by a single agent.
+type QueryPlanFragment struct {
+	AgentID string `json:"agentID"`
+	// The time the agent spent executing the fragment. Only set when a script is run with analyze.
+	ExecutionTime string               `json:"executionTime,omitempty"`
+	Operators     []*QueryPlanOperator `json:"operators"`
+}
+
+// QueryPlan is the distributed plan of a query, as reported by Vizier.
+type QueryPlan struct {
+	Fragments []*QueryPlanFragment `json:"fragments"`
+	// The GraphViz representation of the plan.
+	DOT string `json:"-"`
+
+	operators map[string]*QueryPlanOperator
+	fragments map[string]*QueryPlanFragment
+}
+
+// parseDOTAttrs parses a list of DOT attributes, such as `color="blue",label="x"`, into a map.
+func parseDOTAttrs(s string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ",; ") {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid attribute list: %s", s)
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for attribute %s: %w", key, err)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, err
+		}
+		attrs[key] = value
+		s = s[len(quoted):]
+	}
+	return attrs, nil
+}
+
+func (p *QueryPlan) addOperator(fragment *QueryPlanFragment, key string, attrs map[string]string) error {
+	if fragment == nil {
+		return fmt.Errorf("operator %s is not part of an agent's plan", key)
+	}
+	lines := strings.Split(attrs["label"], "\n")
+	match := operatorLabelRegex.FindStringSubmatch(lines[0])
+	if match == nil {
+		return fmt.Errorf("invalid label for operator %s: %s", key, lines[0])
+	}
+	id, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return err
+	}
+	op := &QueryPlanOperator{
+		Key:  key,
+		Type: match[1],
+		ID:   id,
+	}
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ": ", 2)
+		stat := QueryPlanStat{Name: parts[0]}
+		if len(parts) == 2 {
+			stat.Value = parts[1]
+		}
+		op.Stats = append(op.Stats, stat)
+	}
+	fragment.Operators = append(fragment.Operators, op)
+	p.operators[key] = op
+	p.fragments[key] = fragment
+	return nil
+}
+
+func (p *QueryPlan) addEdge(stmt string) error {
+	// Edges may have attributes, which aren't used for query plans.
+	if idx := strings.IndexByte(stmt, '['); idx >= 0 {
+		stmt = stmt[:idx]
+	}
+	nodes := strings.SplitN(stmt, "->", 2)
+	from, ok := p.operators[strings.TrimSpace(nodes[0])]
+	if !ok {
+		return fmt.Errorf("edge from unknown operator: %s", stmt)
+	}
+	to := strings.TrimSpace(nodes[1])
+	if _, ok := p.operators[to]; !ok {
+		return fmt.Errorf("edge to unknown operator: %s", stmt)
+	}
+	from.Children = append(from.Children, to)
+	return nil
+}
+
+// ParseQueryPlan parses the GraphViz representation of a query plan, as produced by the query broker.
+func ParseQueryPlan(dot string) (*QueryPlan, error) {
+	p := &QueryPlan{
+		DOT:       dot,
+		operators: make(map[string]*QueryPlanOperator),
+		fragments: make(map[string]*QueryPlanFragment),
+	}
+
+	var fragment *QueryPlanFragment
+	var edges []string
+	for _, line := range strings.Split(dot, "\n") {
+		stmt := strings.TrimSuffix(strings.TrimSpace(line), ";")
+		// Subgraphs may be closed on the same line that the next one is opened.
+		if strings.HasPrefix(stmt, "}") {
+			fragment = nil
+			stmt = strings.TrimSpace(stmt[1:])
+		}
+		switch {
+		case stmt == "" || strings.HasPrefix(stmt, "digraph") || strings.HasPrefix(stmt, "ID ="):
+		case strings.HasPrefix(stmt, "subgraph"):
+			fragment = &QueryPlanFragment{}
+			p.Fragments = append(p.Fragments, fragment)
+		case strings.Contains(stmt, "->"):
+			// Edges may refer to operators defined later on, so they are added once all operators are known.
+			edges = append(edges, stmt)
+		case strings.HasSuffix(stmt, "]"):
+			idx := strings.IndexByte(stmt, '[')
+			if idx < 0 {
+				return nil, fmt.Errorf("invalid operator statement: %s", stmt)
+			}
+			attrs, err := parseDOTAttrs(stmt[idx+1 : len(stmt)-1])
+			if err != nil {
+				return nil, err
+			}
+			if err := p.addOperator(fragment, stmt[:idx], attrs); err != nil {
+				return nil, err
+			}
+		default:
+			// Graph attributes. The label of an agent's subgraph holds its ID and execution time.
+			attrs, err := parseDOTAttrs(stmt)
+			if err != nil {
+				return nil, err
+			}
+			label, ok := attrs["label"]
+			if fragment == nil || !ok {
+				continue
+			}
+			lines := strings.SplitN(strings.TrimPrefix(label, agentLabelPrefix), "\n", 2)
+			fragment.AgentID = lines[0]
+			if len(lines) == 2 {
+				fragment.ExecutionTime = lines[1]
+			}
+		}
+	}
+	for _, edge := range edges {
+		if err := p.addEdge(edge); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func formatOperator(op *QueryPlanOperator) string {
+	name := color.New(color.Bold).Sprintf("%s[%d]", op.Type, op.ID)
+	if len(op.Stats) == 0 {
+		return name
+	}
+	stats := make([]string, len(op.Stats))
+	for i, stat := range op.Stats {
+		stats[i] = fmt.Sprintf("%s=%s", stat.Name, stat.Value)
+	}
+	return fmt.Sprintf("%s  %s", name, color.New(color.Faint).Sprint(strings.Join(stats, " ")))
+}
+
+func (p *QueryPlan) renderOperator(w io.Writer, fragment *QueryPlanFragment, op *QueryPlanOperator, prefix string, last bool,
+	rendered map[string]bool) {
+	connector := "├── "
+	childPrefix := prefix + "│   "
+	if last {
+		connector = "└── "
+		childPrefix = prefix + "    "
+	}
+	if rendered[op.Key] {
+		// Operators with several inputs, such as joins, are only expanded once.
+		fmt.Fprintf(w, "%s%s%s[%d] (see above)\n", prefix, connector, op.Type, op.ID)
+		return
+	}
+	rendered[op.Key] = true
+	fmt.Fprintf(w, "%s%s%s\n", prefix, connector, formatOperator(op))
+
+	var local []*QueryPlanOperator
+	for _, child := range op.Children {
+		childFragment := p.fragments[child]
+		if childFragment == fragment {
+			local = append(local, p.operators[child])
+			continue
+		}
+		// The output of this operator is sent to another agent.
+		childOp := p.operators[child]
+		fmt.Fprintf(w, "%s    %s %s[%d] on agent %s\n", childPrefix[:len(prefix)], color.CyanString("→"),
+			childOp.Type, childOp.ID, childFragment.AgentID)
+	}
+	for i, child := range local {
+		p.renderOperator(w, fragment, child, childPrefix, i == len(local)-1, rendered)
+	}
+}
+
+// Render writes the plan to w as a tree per agent.
+func (p *QueryPlan) Render(w io.Writer) {
+	for _, fragment := range p.Fragments {
+		header := fmt.Sprintf("Agent %s", fragment.AgentID)
+		if fragment.ExecutionTime != "" {
+			header += fmt.Sprintf(" (%s)", fragment.ExecutionTime)
+		}
+		fmt.Fprintln(w, color.New(color.Bold, color.FgCyan).Sprint(header))
+
+		// The roots of the fragment are the operators without an input from the same agent.
+		hasParent := make(map[string]bool)
+		for _, op := range fragment.Operators {
+			for _, child := range op.Children {
+				if p.fragments[child] == fragment {
+					hasParent[child] = true
+				}
+			}
+		}
+		var roots []*QueryPlanOperator
+		for _, op := range fragment.Operators {
+			if !hasParent[op.Key] {
+				roots = append(roots, op)
+			}
+		}
+		rendered := make(map[string]bool)
+		for i, op := range roots {
+			p.renderOperator(w, fragment, op, "", i == len(roots)-1, rendered)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// WriteFile writes the plan to a file. The format is determined by the extension of the path, one of: dot, svg or json.
+// Writing SVG requires the GraphViz dot binary.
+func (p *QueryPlan) WriteFile(path string) error {
+	var data []byte
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".dot", ".gv":
+		data = []byte(p.DOT)
+	case ".json":
+		var err error
+		data, err = json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return err
+		}
+	case ".svg":
+		dotPath, err := exec.LookPath("dot")
+		if err != nil {
+			return errors.New("writing an SVG query plan requires GraphViz, please install it or use a .dot file instead")
+		}
+		var stderr bytes.Buffer
+		cmd := exec.Command(dotPath, "-Tsvg")
+		cmd.Stdin = strings.NewReader(p.DOT)
+		cmd.Stderr = &stderr
+		data, err = cmd.Output()
+		if err != nil {
+			return fmt.Errorf("failed to render SVG: %s", strings.TrimSpace(stderr.String()))
+		}
+	default:
+		return fmt.Errorf("unsupported query plan file format '%s', expected one of: dot, svg, json", ext)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// queryPlanFilePath returns the path to write the i-th of n plans to, adding a suffix if there is more than one plan.
+func queryPlanFilePath(path string, i int, n int) string {
+	if n <= 1 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), i+1, ext)
+}
+
+// OutputQueryPlans renders the plans to w, and writes each of them to the given files.
+func OutputQueryPlans(w io.Writer, plans []string, files []string) error {
+	for i, dot := range plans {
+		plan, err := ParseQueryPlan(dot)
+		if err != nil {
+			return fmt.Errorf("failed to parse query plan: %w", err)
+		}
+		plan.Render(w)
+		for _, path := range files {
+			path = queryPlanFilePath(path, i, len(plans))
+			if err := plan.WriteFile(path); err != nil {
+				return err
+			}
+			utils.Infof("Wrote query plan to %s", path)
+		}
+	}
+	return nil
+}
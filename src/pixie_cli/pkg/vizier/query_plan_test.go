@@ -0,0 +1,133 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package vizier_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/pixie_cli/pkg/vizier"
+)
+
+const testQueryPlan = `digraph  {
+	subgraph cluster_s0 {
+		ID = "cluster_s0";
+		color="lightgrey";label="agent::pem-1\n2ms";
+		n1[color="blue",label="memory_source_operator[0]\nself_time: 70ns\ntotal_time: 1ms\nbytes: 456 B\nrecords_processed: 12",shape="rect"];
+		n2[label="map_operator[1]\nself_time: 30ns\ntotal_time: 40ns\nbytes: 120 B\nrecords_processed: 12"];
+		n3[color="yellow",label="grpc_sink_operator[2]\nself_time: 10ns\ntotal_time: 10ns\nbytes: 120 B\nrecords_processed: 12",shape="rect"];
+		n1->n2;
+		n2->n3;
+		
+	}subgraph cluster_s4 {
+		ID = "cluster_s4";
+		color="lightgrey";label="agent::kelvin\n3ms";
+		n5[color="darkorange",label="grpc_source_operator[3]\n",shape="rect"];
+		n6[color="red",label="memory_sink_operator[4]\n",shape="rect"];
+		n5->n6;
+		
+	}
+	
+	n3->n5;
+	
+}
+`
+
+func TestParseQueryPlan(t *testing.T) {
+	plan, err := vizier.ParseQueryPlan(testQueryPlan)
+	require.NoError(t, err)
+	require.Len(t, plan.Fragments, 2)
+
+	pem := plan.Fragments[0]
+	assert.Equal(t, "pem-1", pem.AgentID)
+	assert.Equal(t, "2ms", pem.ExecutionTime)
+	require.Len(t, pem.Operators, 3)
+	assert.Equal(t, "memory_source_operator", pem.Operators[0].Type)
+	assert.Equal(t, int64(0), pem.Operators[0].ID)
+	assert.Equal(t, []vizier.QueryPlanStat{
+		{Name: "self_time", Value: "70ns"},
+		{Name: "total_time", Value: "1ms"},
+		{Name: "bytes", Value: "456 B"},
+		{Name: "records_processed", Value: "12"},
+	}, pem.Operators[0].Stats)
+	assert.Equal(t, []string{"n5"}, pem.Operators[2].Children)
+
+	kelvin := plan.Fragments[1]
+	assert.Equal(t, "kelvin", kelvin.AgentID)
+	require.Len(t, kelvin.Operators, 2)
+	assert.Empty(t, kelvin.Operators[0].Stats)
+}
+
+func TestParseQueryPlan_Invalid(t *testing.T) {
+	_, err := vizier.ParseQueryPlan("digraph  {\n\tn1[label=\"not an operator\"];\n}\n")
+	assert.Error(t, err)
+	_, err = vizier.ParseQueryPlan("digraph  {\n\tsubgraph cluster_s0 {\n\t\tn1[label=\"map_operator[1]\"];\n\t}\n\tn1->n2;\n}\n")
+	assert.Error(t, err)
+	_, err = vizier.ParseQueryPlan("digraph  {\n\tn1];\n}\n")
+	assert.Error(t, err)
+}
+
+func TestQueryPlan_Render(t *testing.T) {
+	plan, err := vizier.ParseQueryPlan(testQueryPlan)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	plan.Render(&buf)
+	expected := `Agent pem-1 (2ms)
+└── memory_source_operator[0]  self_time=70ns total_time=1ms bytes=456 B records_processed=12
+    └── map_operator[1]  self_time=30ns total_time=40ns bytes=120 B records_processed=12
+        └── grpc_sink_operator[2]  self_time=10ns total_time=10ns bytes=120 B records_processed=12
+            → grpc_source_operator[3] on agent kelvin
+
+Agent kelvin (3ms)
+└── grpc_source_operator[3]
+    └── memory_sink_operator[4]
+
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestQueryPlan_WriteFile(t *testing.T) {
+	plan, err := vizier.ParseQueryPlan(testQueryPlan)
+	require.NoError(t, err)
+	dir := t.TempDir()
+
+	dotPath := filepath.Join(dir, "plan.dot")
+	require.NoError(t, plan.WriteFile(dotPath))
+	b, err := os.ReadFile(dotPath)
+	require.NoError(t, err)
+	assert.Equal(t, testQueryPlan, string(b))
+
+	jsonPath := filepath.Join(dir, "plan.json")
+	require.NoError(t, plan.WriteFile(jsonPath))
+	b, err = os.ReadFile(jsonPath)
+	require.NoError(t, err)
+	var parsed vizier.QueryPlan
+	require.NoError(t, json.Unmarshal(b, &parsed))
+	require.Len(t, parsed.Fragments, 2)
+	assert.Equal(t, "kelvin", parsed.Fragments[1].AgentID)
+
+	assert.Error(t, plan.WriteFile(filepath.Join(dir, "plan.png")))
+}
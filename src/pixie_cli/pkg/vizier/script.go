@@ -23,9 +23,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/fatih/color"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc/codes"
 	"gopkg.in/segmentio/analytics-go.v3"
@@ -72,6 +74,7 @@ func RunScriptAndOutputResults(ctx context.Context, conns []*Connector, execScri
 		if err != nil {
 			return err
 		}
+		warnPartialResults(tw)
 		return nil
 	}
 
@@ -175,6 +178,61 @@ func RunScriptAndOutputResults(ctx context.Context, conns []*Connector, execScri
 	return err
 }
 
+// ExplainOptions configures how the query plan of a script is collected and output.
+type ExplainOptions struct {
+	// Analyze runs the script with execution stats for each operator.
+	Analyze bool
+	// Files to write the query plan to. The format of each file is based on its extension: dot, svg or json.
+	OutputFiles []string
+}
+
+// RunScriptAndExplain runs the specified script on vizier with explain enabled, and outputs the results based on the
+// format string, followed by the query plan of the script. The plan is written to stderr for machine-readable formats.
+func RunScriptAndExplain(ctx context.Context, conns []*Connector, execScript *script.ExecutableScript, format string,
+	useEncryption bool, opts *ExplainOptions) error {
+	explainScript := *execScript
+	flags := "#px:set explain=true\n"
+	if opts.Analyze {
+		flags += "#px:set analyze=true\n"
+	}
+	explainScript.ScriptString = flags + execScript.ScriptString
+
+	tw, err := runScript(ctx, conns, &explainScript, format, useEncryption)
+	if err != nil {
+		return err
+	}
+	if err := tw.Finish(); err != nil {
+		return err
+	}
+	warnPartialResults(tw)
+
+	plans := tw.QueryPlans()
+	if len(plans) == 0 {
+		return errors.New("no query plan was returned, Vizier may need to be upgraded")
+	}
+	var w io.Writer = os.Stdout
+	if format == "json" || format == "csv" {
+		w = os.Stderr
+	}
+	return OutputQueryPlans(w, plans, opts.OutputFiles)
+}
+
+// warnPartialResults prints a warning if some of the results of the script are missing.
+func warnPartialResults(tw *StreamOutputAdapter) {
+	missingAgents, incompleteTables := tw.PartialResults()
+	if len(missingAgents) == 0 && len(incompleteTables) == 0 {
+		return
+	}
+	warn := utils.WithColor(color.New(color.FgYellow))
+	warn.Infof("Warning: results are incomplete, %d agent(s) failed or timed out.", len(missingAgents))
+	for _, agent := range missingAgents {
+		warn.Infof("  agent %s: %s", agent.AgentID, agent.Reason)
+	}
+	if len(incompleteTables) > 0 {
+		warn.Infof("  incomplete tables: %s", strings.Join(incompleteTables, ", "))
+	}
+}
+
 func runScript(ctx context.Context, conns []*Connector, execScript *script.ExecutableScript, format string, useEncryption bool) (*StreamOutputAdapter, error) {
 	var encOpts, decOpts *vizierpb.ExecuteScriptRequest_EncryptionOptions
 	var err error
@@ -74,6 +74,14 @@ type StreamOutputAdapter struct {
 	// This is used to track table/ID -> names across multiple clusters.
 	tabledIDToName map[string]string
 
+	// The query plans received, keyed by table ID, in the order they were received.
+	queryPlanIDs []string
+	queryPlans   map[string]*strings.Builder
+
+	// The agents and tables whose results are missing, across all clusters, for scripts that allow partial results.
+	missingAgents    []*vizierpb.MissingAgent
+	incompleteTables []string
+
 	// Captures error if any on the stream and returns it with Finish.
 	err error
 
@@ -103,6 +111,7 @@ func NewStreamOutputAdapterWithFactory(ctx context.Context, stream chan *ExecDat
 		enableFormat:        enableFormat,
 		formatters:          make(map[string]DataFormatter),
 		tabledIDToName:      make(map[string]string),
+		queryPlans:          make(map[string]*strings.Builder),
 		decOpts:             decOpts,
 	}
 
@@ -159,6 +168,22 @@ func (v *StreamOutputAdapter) MutationInfo() (*vizierpb.MutationInfo, error) {
 	return v.mutationInfo, nil
 }
 
+// PartialResults returns the agents whose results are missing and the tables with incomplete results, for scripts
+// that allow partial results. This function is only valid after Finish.
+func (v *StreamOutputAdapter) PartialResults() ([]*vizierpb.MissingAgent, []string) {
+	return v.missingAgents, v.incompleteTables
+}
+
+// QueryPlans returns the query plans received, one per cluster, in GraphViz format. Plans are only captured from the
+// stream when the format isn't inmemory, and this function is only valid after Finish.
+func (v *StreamOutputAdapter) QueryPlans() []string {
+	plans := make([]string, len(v.queryPlanIDs))
+	for i, id := range v.queryPlanIDs {
+		plans[i] = v.queryPlans[id].String()
+	}
+	return plans
+}
+
 // Views gets all the accumulated views. This function is only valid with format = inmemory and after Finish.
 func (v *StreamOutputAdapter) Views() ([]components.TableView, error) {
 	if v.err != nil {
@@ -351,6 +376,8 @@ func (v *StreamOutputAdapter) parseError(ctx context.Context, s *vizierpb.Status
 
 func (v *StreamOutputAdapter) handleExecutionStats(ctx context.Context, es *vizierpb.QueryExecutionStats) error {
 	v.execStats = es
+	v.missingAgents = append(v.missingAgents, es.MissingAgents...)
+	v.incompleteTables = append(v.incompleteTables, es.IncompleteTables...)
 	return nil
 }
 
@@ -382,6 +409,14 @@ func (v *StreamOutputAdapter) handleData(ctx context.Context, d *vizierpb.Execut
 	if d.Data.Batch == nil {
 		return nil
 	}
+	if plan, ok := v.queryPlans[d.Data.Batch.TableID]; ok {
+		for _, col := range d.Data.Batch.Cols {
+			for _, chunk := range col.GetStringData().GetData() {
+				plan.WriteString(chunk)
+			}
+		}
+		return nil
+	}
 	tableName := v.tabledIDToName[d.Data.Batch.TableID]
 	tableInfo, ok := v.tableNameToInfo[tableName]
 	if !ok {
@@ -422,11 +457,20 @@ func (v *StreamOutputAdapter) handleData(ctx context.Context, d *vizierpb.Execut
 
 func (v *StreamOutputAdapter) handleMetadata(ctx context.Context, md *vizierpb.ExecuteScriptResponse_MetaData) error {
 	tableName := md.MetaData.Name
-	newWriter := v.streamWriterFactory(md)
-
 	if _, exists := v.tabledIDToName[md.MetaData.ID]; exists {
 		return ErrDuplicateMetadata
 	}
+	if _, exists := v.queryPlans[md.MetaData.ID]; exists {
+		return ErrDuplicateMetadata
+	}
+
+	// The query plan is rendered separately from the results, except in memory where it is kept as a regular table.
+	if tableName == QueryPlanTableName && v.format != FormatInMemory {
+		v.queryPlanIDs = append(v.queryPlanIDs, md.MetaData.ID)
+		v.queryPlans[md.MetaData.ID] = &strings.Builder{}
+		return nil
+	}
+	newWriter := v.streamWriterFactory(md)
 
 	v.tabledIDToName[md.MetaData.ID] = md.MetaData.Name
 	if _, exists := v.tableNameToInfo[tableName]; exists {
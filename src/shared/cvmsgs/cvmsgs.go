@@ -31,6 +31,8 @@ var (
 	CronScriptUpdatesChannel = "CronScriptsUpdates"
 	// CronScriptUpdatesResponseChannel is the NATS channel that script updates are published to.
 	CronScriptUpdatesResponseChannel = "CronScriptsUpdatesResponse"
+	// CronScriptExecutionErrorChannel is the NATS channel that cron script execution errors are published to.
+	CronScriptExecutionErrorChannel = "CronScriptExecutionError"
 
 	// VizierMetricsChannel is the NATS channel on the cloud side that Vizier metrics are published to.
 	VizierMetricsChannel = "VZMetrics"
@@ -0,0 +1,191 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/http/httpproxy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// CloudTLSConfig gets the TLS config for connecting to Pixie Cloud, which trusts the CAs in the PEM-encoded caBundle in
+// addition to the system CAs.
+func CloudTLSConfig(isInternal bool, caBundle string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: isInternal}
+	if caBundle == "" {
+		return tlsConfig, nil
+	}
+
+	certPool, err := x509.SystemCertPool()
+	if err != nil {
+		certPool = x509.NewCertPool()
+	}
+	if ok := certPool.AppendCertsFromPEM([]byte(caBundle)); !ok {
+		return nil, errors.New("failed to append CA bundle")
+	}
+	tlsConfig.RootCAs = certPool
+	return tlsConfig, nil
+}
+
+// ProxyConfig specifies the HTTP CONNECT proxy used to connect to Pixie Cloud.
+type ProxyConfig struct {
+	// URL is the URL of the proxy, for example: "http://proxy.corp:3128". It must not contain credentials, which are
+	// given by Username and Password instead.
+	URL string
+	// Username and Password are sent to the proxy using basic auth, if Username is set.
+	Username string
+	Password string
+	// NoProxy is a comma-separated list of hosts, domains and CIDRs which are connected to directly rather than
+	// through the proxy, in the format of the NO_PROXY environment variable.
+	NoProxy string
+}
+
+// NewProxyDialer creates a dialer which connects to addresses through the HTTP CONNECT proxy in proxy, except for
+// addresses matched by its NoProxy. If the proxy's URL has the https scheme, the connection to the proxy uses
+// tlsConfig.
+func NewProxyDialer(proxy *ProxyConfig, tlsConfig *tls.Config) (func(context.Context, string) (net.Conn, error), error) {
+	u, err := url.Parse(proxy.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http or https", u.Scheme)
+	}
+	if u.User != nil {
+		return nil, errors.New("proxy URL must not contain credentials")
+	}
+	proxyAddr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(u.Hostname(), port)
+	}
+	proxyFunc := (&httpproxy.Config{HTTPSProxy: proxy.URL, NoProxy: proxy.NoProxy}).ProxyFunc()
+
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		if viaProxy, err := proxyFunc(&url.URL{Scheme: "https", Host: addr}); err == nil && viaProxy == nil {
+			return d.DialContext(ctx, "tcp", addr)
+		}
+
+		conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+		}
+		if u.Scheme == "https" {
+			proxyTLSConfig := tlsConfig.Clone()
+			proxyTLSConfig.ServerName = u.Hostname()
+			proxyTLSConfig.InsecureSkipVerify = false
+			tlsConn := tls.Client(conn, proxyTLSConfig)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("failed TLS handshake with proxy: %w", err)
+			}
+			conn = tlsConn
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: make(http.Header),
+		}
+		if proxy.Username != "" {
+			creds := base64.StdEncoding.EncodeToString([]byte(proxy.Username + ":" + proxy.Password))
+			req.Header.Set("Proxy-Authorization", "Basic "+creds)
+		}
+		if err := req.Write(conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to send CONNECT request to proxy: %w", err)
+		}
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to read CONNECT response from proxy: %w", err)
+		}
+		// The response body is not closed, since closing it would read until the connection is closed.
+		if resp.StatusCode != http.StatusOK {
+			conn.Close()
+			return nil, fmt.Errorf("proxy refused to connect to %s: %s", addr, resp.Status)
+		}
+		if br.Buffered() > 0 {
+			// The proxy must not send any data before the client does, as it would be lost.
+			conn.Close()
+			return nil, errors.New("proxy sent unexpected data after CONNECT response")
+		}
+		_ = conn.SetDeadline(time.Time{})
+		return conn, nil
+	}, nil
+}
+
+// GetGRPCClientDialOptsForCloud gets dial options for GRPC clients accessing Pixie Cloud, which connect through the
+// HTTP CONNECT proxy if it is set, and trust the CAs in caBundle in addition to the system CAs.
+func GetGRPCClientDialOptsForCloud(isInternal bool, proxy *ProxyConfig, caBundle string) ([]grpc.DialOption, error) {
+	if proxy == nil {
+		proxy = &ProxyConfig{}
+	}
+	if proxy.URL == "" && caBundle == "" {
+		return GetGRPCClientDialOptsServerSideTLS(isInternal)
+	}
+
+	dialOpts := make([]grpc.DialOption, 0)
+	dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+
+	tlsConfig, err := CloudTLSConfig(isInternal, caBundle)
+	if err != nil {
+		return nil, err
+	}
+	if viper.GetBool("disable_ssl") {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	if proxy.URL != "" {
+		dialer, err := NewProxyDialer(proxy, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		dialOpts = append(dialOpts, grpc.WithContextDialer(dialer))
+	}
+	return dialOpts, nil
+}
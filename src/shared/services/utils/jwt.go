@@ -66,6 +66,9 @@ func ProtoToToken(pb *jwtpb.JWTClaims) (jwt.Token, error) {
 		builder.Claim("ServiceID", m.ServiceClaims.ServiceID)
 	case *jwtpb.JWTClaims_ClusterClaims:
 		builder.Claim("ClusterID", m.ClusterClaims.ClusterID)
+		if m.ClusterClaims.User != "" {
+			builder.Claim("ClusterUser", m.ClusterClaims.User)
+		}
 	default:
 		log.WithField("type", m).Error("Could not find claims type")
 	}
@@ -111,6 +114,7 @@ func TokenToProto(token jwt.Token) (*jwtpb.JWTClaims, error) {
 		p.CustomClaims = &jwtpb.JWTClaims_ClusterClaims{
 			ClusterClaims: &jwtpb.ClusterJWTClaims{
 				ClusterID: GetClusterID(token),
+				User:      GetClusterUser(token),
 			},
 		}
 	}
@@ -224,6 +228,16 @@ func GetClusterID(t jwt.Token) string {
 	return clusterID.(string)
 }
 
+// GetClusterUser fetches the user that a cluster token was issued to from the custom claims.
+func GetClusterUser(t jwt.Token) string {
+	claims := t.PrivateClaims()
+	user, ok := claims["ClusterUser"]
+	if !ok {
+		return ""
+	}
+	return user.(string)
+}
+
 // HasUserClaims checks if the custom claims include UserClaims.
 func HasUserClaims(t jwt.Token) bool {
 	claims := t.PrivateClaims()
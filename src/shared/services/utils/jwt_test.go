@@ -114,6 +114,7 @@ func TestProtoToToken_Cluster(t *testing.T) {
 	// Cluster claims.
 	clusterClaims := &jwtpb.ClusterJWTClaims{
 		ClusterID: "cluster_id",
+		User:      "user@example.com",
 	}
 	p.CustomClaims = &jwtpb.JWTClaims_ClusterClaims{
 		ClusterClaims: clusterClaims,
@@ -124,6 +125,7 @@ func TestProtoToToken_Cluster(t *testing.T) {
 
 	assert.Equal(t, []string{"cluster"}, utils.GetScopes(token))
 	assert.Equal(t, "cluster_id", utils.GetClusterID(token))
+	assert.Equal(t, "user@example.com", utils.GetClusterUser(token))
 }
 
 func TestTokenToProto_Standard(t *testing.T) {
@@ -182,7 +184,8 @@ func TestTokenToProto_Service(t *testing.T) {
 func TestTokenToProto_Cluster(t *testing.T) {
 	builder := getStandardClaimsBuilder().
 		Claim("Scopes", "cluster").
-		Claim("ClusterID", "cluster_id")
+		Claim("ClusterID", "cluster_id").
+		Claim("ClusterUser", "user@example.com")
 
 	token, err := builder.Build()
 	require.NoError(t, err)
@@ -192,6 +195,7 @@ func TestTokenToProto_Cluster(t *testing.T) {
 	assert.Equal(t, []string{"cluster"}, pb.Scopes)
 	customClaims := pb.GetClusterClaims()
 	assert.Equal(t, "cluster_id", customClaims.ClusterID)
+	assert.Equal(t, "user@example.com", customClaims.User)
 }
 
 func TestTokenToProto_FailNoAudience(t *testing.T) {
@@ -54,6 +54,8 @@ var reasonToMessageMap = map[VizierReason]string{
 		"If this problem persists, clobber and re-deploy your Pixie instance",
 	PEMsHighFailureRate: "PEMs are experiencing a high crash rate. Your Pixie experience will be degraded while this occurs. If PEMs are getting OOMKilled, increase your PEM memory limits using the `pemMemoryLimit` flag.",
 	PEMsAllFailing:      "PEMs are all crashing. If PEMs are getting OOMKilled, increase your PEM memory limits using the `pemMemoryLimit` flag. Otherwise, consider filing a bug so someone can address your problem: https://github.com/pixie-io/pixie",
+	AgentsUnhealthy: "Some agents are not responding to queries, so queries may be missing the data of their nodes. " +
+		"Run `px debug agents` to see the health of each agent, and investigate the PEMs on the unhealthy nodes using `kubectl logs`.",
 }
 
 // GetMessageFromReason gets the human-readable message for a Vizier status reason.
@@ -126,4 +128,6 @@ const (
 	PEMsHighFailureRate VizierReason = "PEMsHighFailureRate"
 	// PEMsAllFailing occurs when a all PEMs are failing.
 	PEMsAllFailing VizierReason = "PEMsAllFailing"
+	// AgentsUnhealthy occurs when some agents are running but don't respond to queries.
+	AgentsUnhealthy VizierReason = "AgentsUnhealthy"
 )
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package yamls
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// imageRegex matches the image of a container in a YAML, for example: "  - image: gcr.io/pixie-oss/pem:0.1".
+var imageRegex = regexp.MustCompile(`(?m)^([ \t]*(?:-[ \t]+)?image:[ \t]*)"?([^\s"{}]+)"?[ \t]*$`)
+
+// argImageRegex matches an image passed to a container as an argument, either on its own or as the value of a flag,
+// for example: "  - -util-image=quay.io/operator-framework/olm:v0.17.0". An argument is only considered to be an image
+// if it has a registry host and a tag or digest, so that other arguments are left untouched.
+var argImageRegex = regexp.MustCompile(`(?m)^([ \t]*-[ \t]+'?(?:-{1,2}[\w-]+=)?)([a-z0-9-]+(?:\.[a-z0-9-]+)+(?::[0-9]+)?/[\w./-]+(?::[\w.-]+|@sha256:[0-9a-f]+))('?)[ \t]*$`)
+
+// templatedImageRegex matches an image which has been templated by ImageTemplate.
+var templatedImageRegex = regexp.MustCompile(`\$image := "([^"]+)"`)
+
+// RegistryImage returns the name of the image when it is mirrored to the given registry. The path of the image is
+// flattened into a single repository of the registry, for example: "gcr.io/pixie-oss/pixie-prod/vizier/pem_image:0.1"
+// becomes "<registry>/gcr.io-pixie-oss-pixie-prod-vizier-pem_image:0.1".
+func RegistryImage(registry string, image string) string {
+	if registry == "" {
+		return image
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(registry, "/"), strings.ReplaceAll(image, "/", "-"))
+}
+
+// ImageTemplate returns a template for the given image, which pulls the image from .Values.registry if it is set,
+// following the naming of RegistryImage.
+func ImageTemplate(image string) string {
+	return fmt.Sprintf(`{{ with $image := %q }}{{ if $.Values.registry }}{{ trimSuffix "/" $.Values.registry }}/{{ $image | replace "/" "-" }}{{ else }}{{ $image }}{{ end }}{{ end }}`, image)
+}
+
+// TemplatizeImages replaces the image of each container in the YAML, as well as the images passed to containers as
+// arguments, with an ImageTemplate.
+func TemplatizeImages(inputYAML string) string {
+	tmpl := imageRegex.ReplaceAllStringFunc(inputYAML, func(line string) string {
+		m := imageRegex.FindStringSubmatch(line)
+		return m[1] + ImageTemplate(m[2])
+	})
+	return argImageRegex.ReplaceAllStringFunc(tmpl, func(line string) string {
+		m := argImageRegex.FindStringSubmatch(line)
+		return m[1] + ImageTemplate(m[2]) + m[3]
+	})
+}
+
+// ListImages returns the sorted, unique images of the containers in the YAML, including images passed to the
+// containers as arguments. The YAML may either be a plain YAML
+// or a template, in which case the images are those used when no registry is set.
+func ListImages(inputYAML string) []string {
+	imageSet := make(map[string]bool)
+	for _, m := range imageRegex.FindAllStringSubmatch(inputYAML, -1) {
+		imageSet[m[2]] = true
+	}
+	for _, m := range argImageRegex.FindAllStringSubmatch(inputYAML, -1) {
+		imageSet[m[2]] = true
+	}
+	for _, m := range templatedImageRegex.FindAllStringSubmatch(inputYAML, -1) {
+		imageSet[m[1]] = true
+	}
+
+	images := make([]string, 0, len(imageSet))
+	for image := range imageSet {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
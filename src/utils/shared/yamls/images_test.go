@@ -0,0 +1,120 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package yamls_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/utils/shared/yamls"
+)
+
+const imagesYAML = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: vizier-query-broker
+spec:
+  template:
+    spec:
+      initContainers:
+      - image: gcr.io/google-containers/busybox:1.28.0-glibc
+        name: nats-wait
+      containers:
+      - name: app
+        image: gcr.io/pixie-oss/pixie-prod/vizier/query_broker_server_image:0.1.0
+        imagePullPolicy: IfNotPresent
+        args:
+        - -configmapServerImage=quay.io/operator-framework/configmap-operator-registry:latest
+        - -util-image
+        -  quay.io/operator-framework/olm@sha256:b706ee6583c4
+        - --cloud_addr=withpixie.ai:443
+        - 'gcr.io/pixie-oss/pixie-prod/vizier/cert_provisioner_image:0.1.0'
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: vizier-pem
+spec:
+  template:
+    spec:
+      containers:
+      - name: pem
+        image: "quay.io/pixie/pem@sha256:b706ee6583c4"
+`
+
+func TestRegistryImage(t *testing.T) {
+	assert.Equal(t, "gcr.io/pixie-oss/pixie-prod/vizier/pem_image:0.1.0",
+		yamls.RegistryImage("", "gcr.io/pixie-oss/pixie-prod/vizier/pem_image:0.1.0"))
+	assert.Equal(t, "registry.internal:5000/px/gcr.io-pixie-oss-pixie-prod-vizier-pem_image:0.1.0",
+		yamls.RegistryImage("registry.internal:5000/px/", "gcr.io/pixie-oss/pixie-prod/vizier/pem_image:0.1.0"))
+}
+
+func TestTemplatizeImages(t *testing.T) {
+	tmpl := yamls.TemplatizeImages(imagesYAML)
+	assert.Equal(t, yamls.ListImages(imagesYAML), yamls.ListImages(tmpl))
+
+	tests := []struct {
+		name     string
+		registry string
+	}{
+		{
+			name:     "no registry",
+			registry: "",
+		},
+		{
+			name:     "registry",
+			registry: "registry.internal:5000/px",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			executed, err := yamls.ExecuteTemplatedYAMLs([]*yamls.YAMLFile{{Name: "vizier", YAML: tmpl}}, &yamls.YAMLTmplArguments{
+				Values: &map[string]interface{}{
+					"registry": test.registry,
+				},
+			})
+			require.NoError(t, err)
+			require.Len(t, executed, 1)
+
+			expected := make([]string, 0)
+			for _, image := range yamls.ListImages(imagesYAML) {
+				expected = append(expected, yamls.RegistryImage(test.registry, image))
+			}
+			assert.ElementsMatch(t, expected, yamls.ListImages(executed[0].YAML))
+			assert.Contains(t, executed[0].YAML, "imagePullPolicy: IfNotPresent")
+			assert.Contains(t, executed[0].YAML, "- -configmapServerImage="+
+				yamls.RegistryImage(test.registry, "quay.io/operator-framework/configmap-operator-registry:latest")+"\n")
+			assert.Contains(t, executed[0].YAML, "- --cloud_addr=withpixie.ai:443\n")
+		})
+	}
+}
+
+func TestListImages(t *testing.T) {
+	assert.Equal(t, []string{
+		"gcr.io/google-containers/busybox:1.28.0-glibc",
+		"gcr.io/pixie-oss/pixie-prod/vizier/cert_provisioner_image:0.1.0",
+		"gcr.io/pixie-oss/pixie-prod/vizier/query_broker_server_image:0.1.0",
+		"quay.io/operator-framework/configmap-operator-registry:latest",
+		"quay.io/operator-framework/olm@sha256:b706ee6583c4",
+		"quay.io/pixie/pem@sha256:b706ee6583c4",
+	}, yamls.ListImages(imagesYAML))
+}
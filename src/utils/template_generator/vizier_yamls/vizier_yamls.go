@@ -63,6 +63,7 @@ type VizierTmplValues struct {
 	DatastreamBufferSpikeSize uint32
 	ElectionPeriodMs          int64
 	CustomPEMFlags            map[string]string
+	Registry                  string
 }
 
 // VizierTmplValuesToArgs converts the vizier template values to args which can be used to fill out a template.
@@ -87,6 +88,7 @@ func VizierTmplValuesToArgs(tmplValues *VizierTmplValues) *yamls.YAMLTmplArgumen
 			"datastreamBufferSpikeSize": tmplValues.DatastreamBufferSpikeSize,
 			"electionPeriodMs":          tmplValues.ElectionPeriodMs,
 			"customPEMFlags":            tmplValues.CustomPEMFlags,
+			"registry":                  tmplValues.Registry,
 		},
 		Release: &map[string]interface{}{
 			"Namespace": tmplValues.Namespace,
@@ -332,9 +334,9 @@ func generateVzDepsYAMLs(clientset *kubernetes.Clientset, yamlMap map[string]str
 		`{{if .Values.useEtcdOperator}}
 %s
 {{- end}}`,
-		etcdYAML)
+		yamls.TemplatizeImages(etcdYAML))
 
-	return natsYAML, wrappedEtcd, nil
+	return yamls.TemplatizeImages(natsYAML), wrappedEtcd, nil
 }
 
 func generateVzYAMLs(clientset *kubernetes.Clientset, yamlMap map[string]string) (string, string, error) {
@@ -457,7 +459,7 @@ func generateVzYAMLs(clientset *kubernetes.Clientset, yamlMap map[string]string)
 		`{{if not .Values.useEtcdOperator}}
 %s
 {{- end}}`,
-		persistentYAML)
+		yamls.TemplatizeImages(persistentYAML))
 
 	etcdYAML, err := yamls.TemplatizeK8sYAML(clientset, yamlMap[vizierEtcdYAMLPath], tmplOptions)
 	if err != nil {
@@ -468,7 +470,7 @@ func generateVzYAMLs(clientset *kubernetes.Clientset, yamlMap map[string]string)
 		`{{if .Values.useEtcdOperator}}
 %s
 {{- end}}`,
-		etcdYAML)
+		yamls.TemplatizeImages(etcdYAML))
 
 	return wrappedEtcd, wrappedPersistent, nil
 }
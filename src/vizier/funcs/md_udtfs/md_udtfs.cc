@@ -38,6 +38,8 @@ void RegisterFuncsOrDie(const VizierFuncFactoryContext& ctx, carnot::udf::Regist
   registry->RegisterOrDie<GetDebugMDState>("_DebugMDState");
   registry->RegisterFactoryOrDie<GetDebugMDWithPrefix, UDTFWithMDFactory<GetDebugMDWithPrefix>>(
       "_DebugMDGetWithPrefix", ctx);
+  registry->RegisterFactoryOrDie<GetK8sResourcesAsOf, UDTFWithMDFactory<GetK8sResourcesAsOf>>(
+      "GetK8sResourcesAsOf", ctx);
   registry->RegisterFactoryOrDie<GetDebugTableInfo, UDTFWithTableStoreFactory<GetDebugTableInfo>>(
       "_DebugTableInfo", ctx.table_store());
 
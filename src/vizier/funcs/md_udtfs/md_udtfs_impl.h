@@ -28,6 +28,7 @@
 #include <vector>
 
 #include <absl/numeric/int128.h>
+#include <absl/strings/str_join.h>
 #include <grpcpp/grpcpp.h>
 #include <magic_enum.hpp>
 
@@ -652,6 +653,163 @@ class GetDebugMDWithPrefix final : public carnot::udf::UDTF<GetDebugMDWithPrefix
   std::function<void(grpc::ClientContext*)> add_context_authentication_func_;
 };
 
+/**
+ * This UDTF fetches the K8s resources as they were at a past time, such as the pods backing
+ * a service or the node that a pod ran on.
+ */
+class GetK8sResourcesAsOf final : public carnot::udf::UDTF<GetK8sResourcesAsOf> {
+ public:
+  using MDSStub = vizier::services::metadata::MetadataService::Stub;
+  using K8sResource = px::vizier::services::metadata::K8sResource;
+  GetK8sResourcesAsOf() = delete;
+  GetK8sResourcesAsOf(std::shared_ptr<MDSStub> stub,
+                      std::function<void(grpc::ClientContext*)> add_context_authentication)
+      : stub_(stub), add_context_authentication_func_(add_context_authentication) {}
+
+  static constexpr auto Executor() { return carnot::udfspb::UDTFSourceExecutor::UDTF_ONE_KELVIN; }
+
+  static constexpr auto OutputRelation() {
+    return MakeArray(
+        ColInfo("kind", types::DataType::STRING, types::PatternType::GENERAL,
+                "The kind of the resource"),
+        ColInfo("namespace", types::DataType::STRING, types::PatternType::GENERAL,
+                "The namespace of the resource, empty for cluster-scoped resources"),
+        ColInfo("name", types::DataType::STRING, types::PatternType::GENERAL,
+                "The name of the resource"),
+        ColInfo("uid", types::DataType::STRING, types::PatternType::GENERAL,
+                "The UID of the resource"),
+        ColInfo("create_time", types::DataType::TIME64NS, types::PatternType::GENERAL,
+                "The time the resource was created"),
+        ColInfo("delete_time", types::DataType::TIME64NS, types::PatternType::GENERAL,
+                "The time the resource was deleted, 0 if it hasn't been deleted"),
+        ColInfo("owners", types::DataType::STRING, types::PatternType::GENERAL,
+                "The owners of the resource, as a comma-separated list of kind/name"),
+        ColInfo("node_name", types::DataType::STRING, types::PatternType::GENERAL,
+                "The node that the pod ran on, empty for other kinds"),
+        ColInfo("pod_ip", types::DataType::STRING, types::PatternType::GENERAL,
+                "The IP of the pod, empty for other kinds"),
+        ColInfo("pods", types::DataType::STRING, types::PatternType::GENERAL,
+                "The pods backing the endpoints, as a comma-separated list of namespace/name"));
+  }
+
+  static constexpr auto InitArgs() {
+    return MakeArray(
+        UDTFArg::Make<types::DataType::TIME64NS>("as_of", "The time to look up the resources at"),
+        UDTFArg::Make<types::DataType::STRING>(
+            "kind",
+            "The kind of resources to look up: pod, service, endpoints, namespace, node, "
+            "replicaset or deployment. Empty for all kinds",
+            ""),
+        UDTFArg::Make<types::DataType::STRING>(
+            "namespace", "The namespace of the resources to look up, empty for all", ""),
+        UDTFArg::Make<types::DataType::STRING>(
+            "name", "The name of the resources to look up, empty for all", ""));
+  }
+
+  Status Init(FunctionContext*, types::Time64NSValue as_of, types::StringValue kind,
+              types::StringValue ns, types::StringValue name) {
+    px::vizier::services::metadata::K8sResourcesAsOfRequest req;
+    resp_ = std::make_unique<px::vizier::services::metadata::K8sResourcesAsOfResponse>();
+    idx_ = 0;
+
+    req.mutable_as_of()->set_seconds(as_of.val / 1000000000);
+    req.mutable_as_of()->set_nanos(as_of.val % 1000000000);
+    req.set_kind(kind);
+    req.set_namespace_(ns);
+    req.set_name(name);
+
+    grpc::ClientContext ctx;
+    add_context_authentication_func_(&ctx);
+    auto s = stub_->GetK8sResourcesAsOf(&ctx, req, resp_.get());
+    if (!s.ok()) {
+      return error::Internal(s.error_message());
+    }
+    return Status::OK();
+  }
+
+  bool NextRecord(FunctionContext*, RecordWriter* rw) {
+    if (idx_ >= resp_->resources().size()) {
+      return false;
+    }
+
+    const auto& resource = resp_->resources().Get(idx_);
+    const px::shared::k8s::metadatapb::ObjectMetadata* md = nullptr;
+    std::string kind;
+    std::string node_name;
+    std::string pod_ip;
+    std::vector<std::string> pods;
+    switch (resource.resource_case()) {
+      case K8sResource::kPod:
+        kind = "pod";
+        md = &resource.pod().metadata();
+        node_name = resource.pod().spec().node_name();
+        pod_ip = resource.pod().status().pod_ip();
+        break;
+      case K8sResource::kService:
+        kind = "service";
+        md = &resource.service().metadata();
+        break;
+      case K8sResource::kEndpoints:
+        kind = "endpoints";
+        md = &resource.endpoints().metadata();
+        for (const auto& subset : resource.endpoints().subsets()) {
+          for (const auto& addr : subset.addresses()) {
+            if (addr.target_ref().kind() == "Pod") {
+              pods.push_back(absl::Substitute("$0/$1", addr.target_ref().namespace_(),
+                                              addr.target_ref().name()));
+            }
+          }
+        }
+        break;
+      case K8sResource::kNamespace:
+        kind = "namespace";
+        md = &resource.namespace_().metadata();
+        break;
+      case K8sResource::kNode:
+        kind = "node";
+        md = &resource.node().metadata();
+        break;
+      case K8sResource::kReplicaSet:
+        kind = "replicaset";
+        md = &resource.replica_set().metadata();
+        break;
+      case K8sResource::kDeployment:
+        kind = "deployment";
+        md = &resource.deployment().metadata();
+        break;
+      default:
+        md = &px::shared::k8s::metadatapb::ObjectMetadata::default_instance();
+        break;
+    }
+
+    std::vector<std::string> owners;
+    for (const auto& owner : md->owner_references()) {
+      owners.push_back(absl::Substitute("$0/$1", owner.kind(), owner.name()));
+    }
+
+    rw->Append<IndexOf("kind")>(kind);
+    rw->Append<IndexOf("namespace")>(md->namespace_());
+    rw->Append<IndexOf("name")>(md->name());
+    rw->Append<IndexOf("uid")>(md->uid());
+    rw->Append<IndexOf("create_time")>(md->creation_timestamp_ns());
+    rw->Append<IndexOf("delete_time")>(md->deletion_timestamp_ns());
+    rw->Append<IndexOf("owners")>(absl::StrJoin(owners, ","));
+    rw->Append<IndexOf("node_name")>(node_name);
+    rw->Append<IndexOf("pod_ip")>(pod_ip);
+    rw->Append<IndexOf("pods")>(absl::StrJoin(pods, ","));
+    ++idx_;
+
+    return idx_ < resp_->resources().size();
+  }
+
+ private:
+  std::unique_ptr<px::vizier::services::metadata::K8sResourcesAsOfResponse> resp_;
+  int idx_;
+
+  std::shared_ptr<MDSStub> stub_;
+  std::function<void(grpc::ClientContext*)> add_context_authentication_func_;
+};
+
 /**
  * This UDTF dumps the debug information for all registered tables.
  */
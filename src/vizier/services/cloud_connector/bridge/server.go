@@ -40,6 +40,7 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
@@ -156,10 +157,11 @@ type VizierInfo interface {
 	GetVizierPods() ([]*vizierpb.VizierPodStatus, []*vizierpb.VizierPodStatus, error)
 }
 
-// VizierOperatorInfo updates and fetches info about the Vizier CRD.
+// VizierOperatorInfo updates and fetches info about the Vizier CRD, and the secrets it references.
 type VizierOperatorInfo interface {
 	UpdateCRDVizierVersion(string) (bool, error)
 	GetVizierCRD() (*v1alpha1.Vizier, error)
+	GetSecret(string) (*corev1.Secret, error)
 }
 
 // VizierHealthChecker is the interface that gets information on health of a Vizier.
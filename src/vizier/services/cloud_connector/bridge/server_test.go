@@ -38,6 +38,7 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/test/bufconn"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
 	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
@@ -241,6 +242,10 @@ func (f *FakeVZOperatorInfo) GetVizierCRD() (*v1alpha1.Vizier, error) {
 	return nil, nil
 }
 
+func (f *FakeVZOperatorInfo) GetSecret(string) (*corev1.Secret, error) {
+	return nil, nil
+}
+
 type testState struct {
 	vzServer *FakeVZConnServer
 	vzClient vzconnpb.VZConnServiceClient
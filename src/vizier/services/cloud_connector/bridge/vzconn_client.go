@@ -20,15 +20,19 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"px.dev/pixie/src/cloud/vzconn/vzconnpb"
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
 	"px.dev/pixie/src/shared/services"
 )
 
@@ -36,12 +40,8 @@ func init() {
 	pflag.String("cloud_addr", "vzconn-service.plc.svc:51600", "The Pixie Cloud service url (load balancer/list is ok)")
 }
 
-func getCloudAddrFromCRD(vzOperator VizierOperatorInfo) (string, error) {
-	vz, err := vzOperator.GetVizierCRD()
-	if err != nil {
-		return "", err
-	}
-
+// getCloudAddrFromCRD gets the address of Pixie Cloud from the CRD.
+func getCloudAddrFromCRD(vz *v1alpha1.Vizier) string {
 	// When cloudConn connects to dev cloud, it should communicate directly with VZConn.
 	cloudAddr := vz.Spec.CloudAddr
 	devCloudNamespace := vz.Spec.DevCloudNamespace
@@ -49,24 +49,63 @@ func getCloudAddrFromCRD(vzOperator VizierOperatorInfo) (string, error) {
 		cloudAddr = fmt.Sprintf("vzconn-service.%s.svc.cluster.local:51600", devCloudNamespace)
 	}
 
-	return cloudAddr, nil
+	return cloudAddr
+}
+
+// getCloudProxyFromCRD gets the config of the proxy and the CA bundle used to connect to Pixie Cloud from the CRD, if
+// they are set. The proxy's credentials are read from its auth secret.
+func getCloudProxyFromCRD(vzOperator VizierOperatorInfo, vz *v1alpha1.Vizier) (*services.ProxyConfig, string, error) {
+	proxy := vz.Spec.CloudProxy
+	if proxy == nil {
+		return nil, "", nil
+	}
+	if proxy.ProxyURL == "" {
+		return nil, proxy.CABundle, nil
+	}
+
+	proxyConfig := &services.ProxyConfig{
+		URL:     proxy.ProxyURL,
+		NoProxy: proxy.NoProxy,
+	}
+	if proxy.AuthSecret != "" {
+		s, err := vzOperator.GetSecret(proxy.AuthSecret)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get cloud proxy auth secret %q: %w", proxy.AuthSecret, err)
+		}
+		proxyConfig.Username = string(s.Data[v1alpha1.CloudProxyUsernameKey])
+		proxyConfig.Password = string(s.Data[v1alpha1.CloudProxyPasswordKey])
+	}
+	return proxyConfig, proxy.CABundle, nil
 }
 
 // NewVZConnClient creates a new vzconn RPC client stub.
 func NewVZConnClient(vzOperator VizierOperatorInfo) (vzconnpb.VZConnServiceClient, error) {
 	ctxBg := context.Background()
 
-	// Get the cloud address - first try the CRD, if it exists.
-	// If that fails, pull it from the environment for Viziers that are not
-	// running the operator yet.
-	cloudAddr, err := getCloudAddrFromCRD(vzOperator)
-	if err != nil {
-		cloudAddr = viper.GetString("cloud_addr")
+	// Get the cloud address and proxy from the CRD. If there is no CRD, pull the address from the environment for
+	// Viziers that are not running the operator yet. Any other failure to read the CRD is returned, so that the
+	// connection is retried rather than bypassing the proxy.
+	cloudAddr := viper.GetString("cloud_addr")
+	var proxyConfig *services.ProxyConfig
+	var caBundle string
+	vz, err := vzOperator.GetVizierCRD()
+	switch {
+	case err == nil:
+		cloudAddr = getCloudAddrFromCRD(vz)
+		// Clusters without direct egress connect through a proxy, which may intercept TLS.
+		proxyConfig, caBundle, err = getCloudProxyFromCRD(vzOperator, vz)
+		if err != nil {
+			return nil, err
+		}
+	case errors.Is(err, ErrNoVizierCRD) || k8serrors.IsNotFound(err):
+		log.Info("No Vizier CRD found, connecting to Pixie Cloud using the cloud_addr flag")
+	default:
+		return nil, fmt.Errorf("failed to get Vizier CRD: %w", err)
 	}
 
 	isInternal := strings.ContainsAny(cloudAddr, ".svc.cluster.local")
 
-	dialOpts, err := services.GetGRPCClientDialOptsServerSideTLS(isInternal)
+	dialOpts, err := services.GetGRPCClientDialOptsForCloud(isInternal, proxyConfig, caBundle)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package bridge_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/vizier/services/cloud_connector/bridge"
+)
+
+// erroringVZOperatorInfo returns the given Vizier CRD, and fails to read the CRD or secrets with the given errors.
+type erroringVZOperatorInfo struct {
+	vz        *v1alpha1.Vizier
+	crdErr    error
+	secretErr error
+}
+
+func (f *erroringVZOperatorInfo) UpdateCRDVizierVersion(string) (bool, error) {
+	return false, nil
+}
+
+func (f *erroringVZOperatorInfo) GetVizierCRD() (*v1alpha1.Vizier, error) {
+	return f.vz, f.crdErr
+}
+
+func (f *erroringVZOperatorInfo) GetSecret(string) (*corev1.Secret, error) {
+	return nil, f.secretErr
+}
+
+func TestNewVZConnClient_CRDErrors(t *testing.T) {
+	proxyVZ := &v1alpha1.Vizier{
+		Spec: v1alpha1.VizierSpec{
+			CloudAddr: "withpixie.invalid:443",
+			CloudProxy: &v1alpha1.CloudProxyParams{
+				ProxyURL:   "http://proxy.invalid:3128",
+				AuthSecret: "proxy-auth",
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		vzOperator *erroringVZOperatorInfo
+	}{
+		{
+			name:       "CRD read fails",
+			vzOperator: &erroringVZOperatorInfo{crdErr: errors.New("connection refused")},
+		},
+		{
+			name:       "auth secret read fails",
+			vzOperator: &erroringVZOperatorInfo{vz: proxyVZ, secretErr: errors.New("connection refused")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The error is returned before dialing, rather than falling back to a direct connection.
+			_, err := bridge.NewVZConnClient(test.vzOperator)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "connection refused")
+		})
+	}
+}
@@ -52,6 +52,9 @@ import (
 
 const k8sStateUpdatePeriod = 10 * time.Second
 
+// ErrNoVizierCRD is returned when there is no Vizier CRD in the namespace, as Vizier is not running using an operator.
+var ErrNoVizierCRD = errors.New("No vizier CRD found")
+
 const privateImageRepo = "gcr.io/pixie-oss/pixie-dev"
 const publicImageRepo = "gcr.io/pixie-oss/pixie-prod"
 
@@ -153,11 +156,21 @@ func (v *K8sVizierInfo) GetVizierClusterInfo() (*cvmsgspb.VizierClusterInfo, err
 	if err != nil {
 		return nil, err
 	}
-	return &cvmsgspb.VizierClusterInfo{
+	info := &cvmsgspb.VizierClusterInfo{
 		ClusterUID:    clusterUID,
 		ClusterName:   v.clusterName,
 		VizierVersion: version.GetVersion().ToString(),
-	}, nil
+	}
+	// Labels are only available when Vizier is deployed through the operator. If the CRD can't be read, the labels
+	// are reported as unknown so that the cloud keeps the labels it already has.
+	vz, err := v.GetVizierCRD()
+	if err != nil {
+		log.WithError(err).Info("Could not read Vizier CRD, cluster labels are unknown")
+		return info, nil
+	}
+	info.Labels = vz.Spec.ClusterLabels
+	info.LabelsKnown = true
+	return info, nil
 }
 
 // GetClusterUID gets UID for the cluster, represented by the kube-system namespace UID.
@@ -693,7 +706,12 @@ func (v *K8sVizierInfo) GetVizierCRD() (*v1alpha1.Vizier, error) {
 	if len(viziers.Items) > 0 {
 		return &viziers.Items[0], nil
 	}
-	return nil, errors.New("No vizier CRD found")
+	return nil, ErrNoVizierCRD
+}
+
+// GetSecret gets the secret with the given name in the Vizier's namespace.
+func (v *K8sVizierInfo) GetSecret(name string) (*corev1.Secret, error) {
+	return v.clientset.CoreV1().Secrets(v.ns).Get(context.Background(), name, metav1.GetOptions{})
 }
 
 // UpdateCRDVizierVersion updates the version of the Vizier CRD in the namespace.
@@ -30,6 +30,7 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
 	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
@@ -142,6 +143,10 @@ func (f *fakeVZOperator) GetVizierCRD() (*v1alpha1.Vizier, error) {
 	return nil, errors.New("Could not get CRD")
 }
 
+func (f *fakeVZOperator) GetSecret(string) (*corev1.Secret, error) {
+	return nil, errors.New("Could not get secret")
+}
+
 // fakeVZHealthChecker always returns that the Vizier state is healthy.
 type fakeVZHealthChecker struct{}
 
@@ -49,9 +49,15 @@ const (
 	computedSchemaKey   = "/computedSchema"
 )
 
+// maxTxnAttempts is the number of times that an update is attempted, when the keys that it read are concurrently modified.
+const maxTxnAttempts = 10
+
 // ErrNoComputedSchemas is an error indicating the lack of computedSchemas.
 var ErrNoComputedSchemas = errors.New("Could not find any computed schemas")
 
+// ErrTxnConflict is an error indicating that an update kept conflicting with concurrent updates.
+var ErrTxnConflict = errors.New("Could not apply update due to concurrent updates")
+
 // HostnameIPPair is a unique identifies for a K8s node.
 type HostnameIPPair struct {
 	Hostname string
@@ -71,6 +77,22 @@ func NewDatastore(ds datastore.MultiGetterSetterDeleterCloser, expiryDuration ti
 	return &Datastore{ds: ds, expiryDuration: expiryDuration}
 }
 
+// retryTxn applies the transaction returned by txn, and retries it with a fresh read of the datastore
+// if its comparisons don't hold.
+func (a *Datastore) retryTxn(txn func() ([]datastore.Cmp, []datastore.Op, error)) error {
+	for i := 0; i < maxTxnAttempts; i++ {
+		cmps, ops, err := txn()
+		if err != nil {
+			return err
+		}
+		applied, err := a.ds.Txn(cmps, ops)
+		if err != nil || applied {
+			return err
+		}
+	}
+	return ErrTxnConflict
+}
+
 func getAgentKey(agentID uuid.UUID) string {
 	return path.Join(agentKeyPrefix, agentID.String())
 }
@@ -110,25 +132,21 @@ func (a *Datastore) CreateAgent(agentID uuid.UUID, agt *agentpb.Agent) error {
 		IP:       agt.Info.HostInfo.HostIP,
 	}
 
-	err = a.ds.Set(getHostnamePairAgentKey(hnPair), agentID.String())
-	if err != nil {
-		return err
-	}
-	err = a.ds.Set(getAgentKey(agentID), string(i))
-	if err != nil {
-		return err
-	}
-	err = a.ds.Set(getPodNameToAgentIDKey(agt.Info.HostInfo.PodName), agentID.String())
-	if err != nil {
-		return err
+	ops := []datastore.Op{
+		datastore.OpSet(getHostnamePairAgentKey(hnPair), agentID.String()),
+		datastore.OpSet(getAgentKey(agentID), string(i)),
+		datastore.OpSet(getPodNameToAgentIDKey(agt.Info.HostInfo.PodName), agentID.String()),
 	}
 
 	collectsData := agt.Info.Capabilities == nil || agt.Info.Capabilities.CollectsData
 	if !collectsData {
-		err = a.ds.Set(getKelvinAgentKey(agentID), agentID.String())
-		if err != nil {
-			return err
-		}
+		ops = append(ops, datastore.OpSet(getKelvinAgentKey(agentID), agentID.String()))
+	}
+
+	// The agent and its indexes are written together, so that the indexes never point to a missing agent.
+	_, err = a.ds.Txn(nil, ops)
+	if err != nil {
+		return err
 	}
 
 	log.WithField("hostname", hnPair.Hostname).WithField("HostIP", hnPair.IP).Info("Registering agent")
@@ -162,55 +180,58 @@ func (a *Datastore) UpdateAgent(agentID uuid.UUID, agt *agentpb.Agent) error {
 	return a.ds.Set(getAgentKey(agentID), string(i))
 }
 
-// DeleteAgent deletes the agent with the given ID.
+// DeleteAgent deletes the agent with the given ID, along with its indexes and its tables in the computed schema.
 func (a *Datastore) DeleteAgent(agentID uuid.UUID) error {
-	resp, err := a.ds.Get(getAgentKey(agentID))
-	if err != nil {
-		return err
-	}
-
-	// Agent does not exist, no need to delete.
-	if resp == nil {
-		log.Info("Tried to delete an agent that was already deleted")
-		return nil
-	}
+	return a.retryTxn(func() ([]datastore.Cmp, []datastore.Op, error) {
+		resp, err := a.ds.Get(getAgentKey(agentID))
+		if err != nil {
+			return nil, nil, err
+		}
 
-	aPb := &agentpb.Agent{}
-	err = proto.Unmarshal(resp, aPb)
-	if err != nil {
-		return err
-	}
+		// Agent does not exist, no need to delete.
+		if resp == nil {
+			log.Info("Tried to delete an agent that was already deleted")
+			return nil, nil, nil
+		}
 
-	hostname := ""
-	if !aPb.Info.Capabilities.CollectsData {
-		hostname = aPb.Info.HostInfo.Hostname
-	}
+		aPb := &agentpb.Agent{}
+		err = proto.Unmarshal(resp, aPb)
+		if err != nil {
+			return nil, nil, err
+		}
 
-	hnPair := &HostnameIPPair{
-		Hostname: hostname,
-		IP:       aPb.Info.HostInfo.HostIP,
-	}
-	delKeys := []string{getAgentKey(agentID), getHostnamePairAgentKey(hnPair), getPodNameToAgentIDKey(aPb.Info.HostInfo.PodName)}
+		hostname := ""
+		if !aPb.Info.Capabilities.CollectsData {
+			hostname = aPb.Info.HostInfo.Hostname
+		}
 
-	// Info.Capabiltiies should never be nil with our new PEMs/Kelvin. If it is nil,
-	// this means that the protobuf we retrieved from etcd belongs to an older agent.
-	collectsData := aPb.Info.Capabilities == nil || aPb.Info.Capabilities.CollectsData
-	if !collectsData {
-		delKeys = append(delKeys, getKelvinAgentKey(agentID))
-	}
+		hnPair := &HostnameIPPair{
+			Hostname: hostname,
+			IP:       aPb.Info.HostInfo.HostIP,
+		}
+		ops := []datastore.Op{
+			datastore.OpDelete(getAgentKey(agentID)),
+			datastore.OpDelete(getHostnamePairAgentKey(hnPair)),
+			datastore.OpDelete(getPodNameToAgentIDKey(aPb.Info.HostInfo.PodName)),
+			datastore.OpDeleteWithPrefix(getAgentDataInfoKey(agentID)),
+		}
 
-	err = a.ds.DeleteAll(delKeys)
-	if err != nil {
-		return err
-	}
+		// Info.Capabiltiies should never be nil with our new PEMs/Kelvin. If it is nil,
+		// this means that the protobuf we retrieved from etcd belongs to an older agent.
+		collectsData := aPb.Info.Capabilities == nil || aPb.Info.Capabilities.CollectsData
+		if !collectsData {
+			ops = append(ops, datastore.OpDelete(getKelvinAgentKey(agentID)))
+		}
 
-	// Deletes from the computedSchema
-	err = a.UpdateSchemas(agentID, []*storepb.TableInfo{})
-	if err != nil {
-		return err
-	}
+		// Deletes from the computedSchema
+		schemaCmp, schemaOp, err := a.updateSchemasOp(agentID, []*storepb.TableInfo{})
+		if err != nil {
+			return nil, nil, err
+		}
 
-	return a.ds.DeleteWithPrefix(getAgentDataInfoKey(agentID))
+		cmps := []datastore.Cmp{{Key: getAgentKey(agentID), Value: resp}, schemaCmp}
+		return cmps, append(ops, schemaOp), nil
+	})
 }
 
 // GetAgents gets all of the current active agents.
@@ -246,25 +267,30 @@ func (a *Datastore) GetAgents() ([]*agentpb.Agent, error) {
 func (a *Datastore) GetASID() (uint32, error) {
 	a.asidMu.Lock()
 	defer a.asidMu.Unlock()
-	asid := "1" // Starting ASID.
 
-	resp, err := a.ds.Get(asidKey)
-	if err != nil {
-		return 0, err
-	}
-	if resp != nil {
-		asid = string(resp)
-	}
+	var asidInt uint64
+	// Increment ASID in datastore, retrying if another replica of the metadata service assigned it first.
+	err := a.retryTxn(func() ([]datastore.Cmp, []datastore.Op, error) {
+		asid := "1" // Starting ASID.
 
-	// Convert ASID from etcd into uint32.
-	asidInt, err := strconv.ParseUint(asid, 10, 32)
-	if err != nil {
-		return 0, err
-	}
+		resp, err := a.ds.Get(asidKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp != nil {
+			asid = string(resp)
+		}
 
-	// Increment ASID in datastore.
-	updatedAsid := asidInt + 1
-	err = a.ds.Set(asidKey, fmt.Sprint(updatedAsid))
+		// Convert ASID from etcd into uint32.
+		asidInt, err = strconv.ParseUint(asid, 10, 32)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		updatedAsid := asidInt + 1
+		return []datastore.Cmp{{Key: asidKey, Value: resp}},
+			[]datastore.Op{datastore.OpSet(asidKey, fmt.Sprint(updatedAsid))}, nil
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -328,21 +354,27 @@ func (a *Datastore) UpdateAgentDataInfo(agentID uuid.UUID, dataInfo *messagespb.
 
 // GetComputedSchema returns the raw CombinedComputedSchema.
 func (a *Datastore) GetComputedSchema() (*storepb.ComputedSchema, error) {
+	_, computedSchemaPb, err := a.getComputedSchema()
+	return computedSchemaPb, err
+}
+
+// getComputedSchema returns the CombinedComputedSchema, along with its serialized value in the datastore.
+func (a *Datastore) getComputedSchema() ([]byte, *storepb.ComputedSchema, error) {
 	cSchemas, err := a.ds.Get(computedSchemaKey)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if cSchemas == nil {
-		return nil, ErrNoComputedSchemas
+		return nil, nil, ErrNoComputedSchemas
 	}
 
 	computedSchemaPb := &storepb.ComputedSchema{}
 	err = proto.Unmarshal(cSchemas, computedSchemaPb)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return computedSchemaPb, nil
+	return cSchemas, computedSchemaPb, nil
 }
 
 func deleteTableFromComputed(computedSchemaPb *storepb.ComputedSchema, tableName string) error {
@@ -399,7 +431,19 @@ func deleteAgentFromComputed(computedSchemaPb *storepb.ComputedSchema, tableName
 
 // UpdateSchemas updates the given schemas in the metadata store.
 func (a *Datastore) UpdateSchemas(agentID uuid.UUID, schemas []*storepb.TableInfo) error {
-	computedSchemaPb, err := a.GetComputedSchema()
+	return a.retryTxn(func() ([]datastore.Cmp, []datastore.Op, error) {
+		cmp, op, err := a.updateSchemasOp(agentID, schemas)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []datastore.Cmp{cmp}, []datastore.Op{op}, nil
+	})
+}
+
+// updateSchemasOp returns the op that updates the computed schema with the given schemas of the agent,
+// and the comparison which checks that the computed schema didn't change since it was read.
+func (a *Datastore) updateSchemasOp(agentID uuid.UUID, schemas []*storepb.TableInfo) (datastore.Cmp, datastore.Op, error) {
+	oldComputedSchema, computedSchemaPb, err := a.getComputedSchema()
 	// If there are no computed schemas, that means we have yet to set one.
 	if err == ErrNoComputedSchemas {
 		// Reset error as this is not actually an error.
@@ -409,7 +453,7 @@ func (a *Datastore) UpdateSchemas(agentID uuid.UUID, schemas []*storepb.TableInf
 	// Other errors are still errors.
 	if err != nil {
 		log.WithError(err).Error("Could not get old schema.")
-		return err
+		return datastore.Cmp{}, datastore.Op{}, err
 	}
 
 	// Make sure the computedSchema is non-nil and fields are non-nil.
@@ -488,17 +532,27 @@ func (a *Datastore) UpdateSchemas(agentID uuid.UUID, schemas []*storepb.TableInf
 		err := deleteAgentFromComputed(computedSchemaPb, tableName, agentIDPb)
 		if err != nil {
 			log.WithError(err).Errorf("Could not delete table to agent mapping %s -> %v", tableName, agentID)
-			return err
+			return datastore.Cmp{}, datastore.Op{}, err
 		}
 	}
 
 	computedSchema, err := computedSchemaPb.Marshal()
 	if err != nil {
 		log.WithError(err).Error("Could not marshal computed schema update message.")
-		return err
+		return datastore.Cmp{}, datastore.Op{}, err
 	}
 
-	return a.ds.Set(computedSchemaKey, string(computedSchema))
+	return datastore.Cmp{Key: computedSchemaKey, Value: oldComputedSchema}, setComputedSchemaOp(computedSchema), nil
+}
+
+// setComputedSchemaOp returns the op that stores the serialized computed schema. A computed schema without any tables
+// serializes to an empty value, which is deleted instead, since some datastores can't tell an empty value from a
+// missing key when the computed schema is next compared.
+func setComputedSchemaOp(computedSchema []byte) datastore.Op {
+	if len(computedSchema) == 0 {
+		return datastore.OpDelete(computedSchemaKey)
+	}
+	return datastore.OpSet(computedSchemaKey, string(computedSchema))
 }
 
 // PruneComputedSchema cleans any dead agents from the computed schema. This is a temporary fix, to address a larger
@@ -516,7 +570,7 @@ func (a *Datastore) PruneComputedSchema() error {
 	}
 
 	// Fetch current computed schema.
-	computedSchemaPb, err := a.GetComputedSchema()
+	oldComputedSchema, computedSchemaPb, err := a.getComputedSchema()
 	// If there are no computed schemas, that means we don't have to do anything.
 	if err == ErrNoComputedSchemas || computedSchemaPb == nil {
 		return nil
@@ -568,7 +622,11 @@ func (a *Datastore) PruneComputedSchema() error {
 		return err
 	}
 
-	return a.ds.Set(computedSchemaKey, string(computedSchema))
+	// If the computed schema was concurrently updated, the agents it refers to may have changed, so
+	// leave pruning it to the next attempt.
+	_, err = a.ds.Txn([]datastore.Cmp{{Key: computedSchemaKey, Value: oldComputedSchema}},
+		[]datastore.Op{setComputedSchemaOp(computedSchema)})
+	return err
 }
 
 // GetProcesses gets the process infos for the given process upids.
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package agent_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/utils/testingutils"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/agent"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/utils/datastore"
+	"px.dev/pixie/src/vizier/utils/datastore/etcd"
+	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
+)
+
+func TestUpdateSchemas_RemoveLastTable(t *testing.T) {
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	pebbleDB := pebbledb.New(c, 3*time.Second)
+	defer pebbleDB.Close()
+
+	et, cleanup := testingutils.SetupEtcd()
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		db   datastore.MultiGetterSetterDeleterCloser
+	}{
+		{"PebbleDB", pebbleDB},
+		{"etcd", etcd.New(et)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ads := agent.NewDatastore(test.db, 1*time.Minute)
+			agentID := uuid.Must(uuid.NewV4())
+
+			err := ads.UpdateSchemas(agentID, []*storepb.TableInfo{{Name: "table_1"}})
+			require.NoError(t, err)
+
+			// Removing the last table leaves an empty computed schema.
+			err = ads.UpdateSchemas(agentID, nil)
+			require.NoError(t, err)
+			_, err = ads.GetComputedSchema()
+			assert.Equal(t, agent.ErrNoComputedSchemas, err)
+
+			// The agent can still register its schema afterwards.
+			err = ads.UpdateSchemas(agentID, []*storepb.TableInfo{{Name: "table_2"}})
+			require.NoError(t, err)
+			computedSchema, err := ads.GetComputedSchema()
+			require.NoError(t, err)
+			require.Len(t, computedSchema.Tables, 1)
+			assert.Equal(t, "table_2", computedSchema.Tables[0].Name)
+
+			err = ads.DeleteAgent(agentID)
+			require.NoError(t, err)
+			err = ads.UpdateSchemas(agentID, []*storepb.TableInfo{{Name: "table_3"}})
+			require.NoError(t, err)
+		})
+	}
+}
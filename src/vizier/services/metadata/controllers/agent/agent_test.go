@@ -32,6 +32,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"px.dev/pixie/src/api/proto/uuidpb"
 	"px.dev/pixie/src/carnot/planner/distributedpb"
 	"px.dev/pixie/src/shared/bloomfilterpb"
 	k8s_metadatapb "px.dev/pixie/src/shared/k8s/metadatapb"
@@ -44,6 +45,7 @@ import (
 	"px.dev/pixie/src/vizier/services/metadata/controllers/testutils"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
 	"px.dev/pixie/src/vizier/services/shared/agentpb"
+	"px.dev/pixie/src/vizier/utils/datastore"
 	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
 )
 
@@ -764,3 +766,69 @@ func TestAgent_UpdateConfig(t *testing.T) {
 
 	defer wg.Wait()
 }
+
+// interleavingDatastore runs a function before the next transaction, to simulate a concurrent update.
+type interleavingDatastore struct {
+	datastore.MultiGetterSetterDeleterCloser
+	beforeTxn func()
+}
+
+func (d *interleavingDatastore) Txn(cmps []datastore.Cmp, ops []datastore.Op) (bool, error) {
+	if beforeTxn := d.beforeTxn; beforeTxn != nil {
+		d.beforeTxn = nil
+		beforeTxn()
+	}
+	return d.MultiGetterSetterDeleterCloser.Txn(cmps, ops)
+}
+
+func TestUpdateSchemas_ConcurrentUpdate(t *testing.T) {
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	db := pebbledb.New(c, 3*time.Second)
+	defer db.Close()
+
+	interleavingDB := &interleavingDatastore{MultiGetterSetterDeleterCloser: db}
+	ads := agent.NewDatastore(interleavingDB, 1*time.Minute)
+
+	agentID1 := uuid.Must(uuid.NewV4())
+	agentID2 := uuid.Must(uuid.NewV4())
+
+	// Another agent's schema is written between the read and the write of the computed schema.
+	interleavingDB.beforeTxn = func() {
+		err := agent.NewDatastore(db, 1*time.Minute).UpdateSchemas(agentID2, []*storepb.TableInfo{{Name: "table_2"}})
+		require.NoError(t, err)
+	}
+	err = ads.UpdateSchemas(agentID1, []*storepb.TableInfo{{Name: "table_1"}})
+	require.NoError(t, err)
+
+	computedSchema, err := ads.GetComputedSchema()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"table_1", "table_2"}, []string{computedSchema.Tables[0].Name, computedSchema.Tables[1].Name})
+	assert.Equal(t, []*uuidpb.UUID{utils.ProtoFromUUID(agentID1)}, computedSchema.TableNameToAgentIDs["table_1"].AgentID)
+	assert.Equal(t, []*uuidpb.UUID{utils.ProtoFromUUID(agentID2)}, computedSchema.TableNameToAgentIDs["table_2"].AgentID)
+}
+
+func TestGetASID_ConcurrentUpdate(t *testing.T) {
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	db := pebbledb.New(c, 3*time.Second)
+	defer db.Close()
+
+	interleavingDB := &interleavingDatastore{MultiGetterSetterDeleterCloser: db}
+	ads := agent.NewDatastore(interleavingDB, 1*time.Minute)
+
+	// Another replica assigns an ASID between the read and the write of the next ASID.
+	var otherASID uint32
+	interleavingDB.beforeTxn = func() {
+		otherASID, err = agent.NewDatastore(db, 1*time.Minute).GetASID()
+		require.NoError(t, err)
+	}
+	asid, err := ads.GetASID()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), otherASID)
+	assert.Equal(t, uint32(2), asid)
+}
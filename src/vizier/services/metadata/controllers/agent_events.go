@@ -0,0 +1,96 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+// agentEventsBufferSize is the number of events buffered for each subscriber. Subscribers that fall
+// further behind are unsubscribed, rather than blocking the agent handlers.
+const agentEventsBufferSize = 1024
+
+// AgentEventBroadcaster sends the lifecycle events of the agents to all of its subscribers.
+type AgentEventBroadcaster struct {
+	subscribers map[uuid.UUID]chan *metadatapb.AgentEvent
+	mu          sync.Mutex
+}
+
+// NewAgentEventBroadcaster creates a new agent event broadcaster.
+func NewAgentEventBroadcaster() *AgentEventBroadcaster {
+	return &AgentEventBroadcaster{
+		subscribers: make(map[uuid.UUID]chan *metadatapb.AgentEvent),
+	}
+}
+
+// Subscribe returns a channel receiving the events published from now on, and a function to stop receiving them.
+// The channel is closed if the subscriber falls too far behind.
+func (b *AgentEventBroadcaster) Subscribe() (<-chan *metadatapb.AgentEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := uuid.Must(uuid.NewV4())
+	ch := make(chan *metadatapb.AgentEvent, agentEventsBufferSize)
+	b.subscribers[id] = ch
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends an event about the agent to all subscribers. tables is only set for schema changes.
+func (b *AgentEventBroadcaster) Publish(eventType metadatapb.AgentEventType, agt *agentpb.Agent, tables []string) {
+	ts, err := types.TimestampProto(time.Now())
+	if err != nil {
+		log.WithError(err).Error("Failed to convert agent event time")
+		return
+	}
+	event := &metadatapb.AgentEvent{
+		Type: eventType,
+		Time: ts,
+		// The agent handlers keep updating their agent, so the subscribers get a copy.
+		Agent:  proto.Clone(agt).(*agentpb.Agent),
+		Tables: tables,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.WithField("subscriber", id.String()).Warn("Agent event subscriber fell behind, unsubscribing it")
+			delete(b.subscribers, id)
+			close(ch)
+		}
+	}
+}
@@ -32,7 +32,9 @@ import (
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/messages/messagespb"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/agent"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/agentconfig"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/services/shared/agentpb"
 	"px.dev/pixie/src/vizier/utils/messagebus"
 )
@@ -80,6 +82,8 @@ func (c *concurrentAgentMap) delete(agentID uuid.UUID) {
 type AgentTopicListener struct {
 	agtMgr      agent.Manager
 	tpMgr       *tracepoint.Manager
+	cfgMgr      *agentconfig.Manager
+	events      *AgentEventBroadcaster
 	sendMessage SendMessageFn
 
 	// Map from agent ID -> the agentHandler that's responsible for handling that particular
@@ -92,7 +96,10 @@ type AgentHandler struct {
 	id     uuid.UUID
 	agtMgr agent.Manager
 	tpMgr  *tracepoint.Manager
+	cfgMgr *agentconfig.Manager
 	atl    *AgentTopicListener
+	// The agent, as last known by the handler. nil until the agent registers, for new agents.
+	agent *agentpb.Agent
 
 	MsgChannel chan *nats.Msg
 	quitCh     chan struct{}
@@ -102,11 +109,13 @@ type AgentHandler struct {
 }
 
 // NewAgentTopicListener creates a new agent topic listener.
-func NewAgentTopicListener(agtMgr agent.Manager, tpMgr *tracepoint.Manager,
-	sendMsgFn SendMessageFn) (*AgentTopicListener, error) {
+func NewAgentTopicListener(agtMgr agent.Manager, tpMgr *tracepoint.Manager, cfgMgr *agentconfig.Manager,
+	events *AgentEventBroadcaster, sendMsgFn SendMessageFn) (*AgentTopicListener, error) {
 	atl := &AgentTopicListener{
 		agtMgr:      agtMgr,
 		tpMgr:       tpMgr,
+		cfgMgr:      cfgMgr,
+		events:      events,
 		sendMessage: sendMsgFn,
 		agentMap:    &concurrentAgentMap{unsafeMap: make(map[uuid.UUID]*AgentHandler)},
 	}
@@ -133,7 +142,7 @@ func (a *AgentTopicListener) Initialize() error {
 			return err
 		}
 
-		a.createAgentHandler(agentID)
+		a.createAgentHandler(agentID, agt)
 	}
 
 	return nil
@@ -180,7 +189,8 @@ func (a *AgentTopicListener) SendMessageToAgent(agentID uuid.UUID, msg messagesp
 }
 
 // This function should only be called when the mutex is already held. It creates a new agent handler for the given id.
-func (a *AgentTopicListener) createAgentHandler(agentID uuid.UUID) *AgentHandler {
+// agt is the existing agent, or nil if the agent is new.
+func (a *AgentTopicListener) createAgentHandler(agentID uuid.UUID, agt *agentpb.Agent) *AgentHandler {
 	if ah := a.agentMap.read(agentID); ah != nil {
 		log.WithField("agentID", agentID.String()).Info("Trying to create agent handler that already exists")
 		return ah
@@ -190,7 +200,9 @@ func (a *AgentTopicListener) createAgentHandler(agentID uuid.UUID) *AgentHandler
 		id:         agentID,
 		agtMgr:     a.agtMgr,
 		tpMgr:      a.tpMgr,
+		cfgMgr:     a.cfgMgr,
 		atl:        a,
+		agent:      agt,
 		MsgChannel: make(chan *nats.Msg, 10),
 		quitCh:     make(chan struct{}),
 	}
@@ -239,7 +251,7 @@ func (a *AgentTopicListener) forwardAgentRegisterRequest(m *messagespb.RegisterA
 
 	agentHandler := a.agentMap.read(agentID)
 	if agentHandler == nil {
-		agentHandler = a.createAgentHandler(agentID)
+		agentHandler = a.createAgentHandler(agentID, nil)
 	}
 	// Add to agent handler to process.
 	agentHandler.MsgChannel <- msg
@@ -274,6 +286,14 @@ func (a *AgentTopicListener) deleteAgent(agentID uuid.UUID) {
 	a.agentMap.delete(agentID)
 }
 
+// publishEvent sends a lifecycle event of the agent to the subscribers of agent events, if any.
+func (a *AgentTopicListener) publishEvent(eventType metadatapb.AgentEventType, agt *agentpb.Agent, tables []string) {
+	if a.events == nil || agt == nil {
+		return
+	}
+	a.events.Publish(eventType, agt, tables)
+}
+
 func (a *AgentTopicListener) onAgentTracepointMessage(pbMessage *messagespb.TracepointMessage) {
 	switch m := pbMessage.Msg.(type) {
 	case *messagespb.TracepointMessage_TracepointInfoUpdate:
@@ -306,12 +326,18 @@ func (a *AgentTopicListener) Stop() {
 func (ah *AgentHandler) processMessages() {
 	ah.wg.Add(1)
 
+	expired := false
 	defer func() {
 		err := ah.agtMgr.DeleteAgent(ah.id)
 		if err != nil {
 			log.WithError(err).Error("Failed to delete agent from agent manager")
 		}
 		ah.atl.deleteAgent(ah.id)
+		if expired {
+			ah.atl.publishEvent(metadatapb.AGENT_EVENT_EXPIRED, ah.agent, nil)
+		} else {
+			ah.atl.publishEvent(metadatapb.AGENT_EVENT_DELETED, ah.agent, nil)
+		}
 		err = ah.tpMgr.DeleteAgent(ah.id)
 		if err != nil {
 			log.WithError(err).Error("Failed to delete agent from tracepoint manager")
@@ -320,6 +346,10 @@ func (ah *AgentHandler) processMessages() {
 	}()
 
 	timer := time.NewTimer(agentExpirationTimeout)
+	unhealthyTimer := time.NewTimer(UnhealthyAgentThreshold)
+	defer unhealthyTimer.Stop()
+	// Whether the unhealthy timer fired since the last message, in which case its channel is already drained.
+	unhealthy := false
 	for {
 		select {
 		case <-ah.quitCh: // Prioritize the quitChannel.
@@ -353,7 +383,17 @@ func (ah *AgentHandler) processMessages() {
 				<-timer.C
 			}
 			timer.Reset(agentExpirationTimeout)
+			if !unhealthyTimer.Stop() && !unhealthy {
+				<-unhealthyTimer.C
+			}
+			unhealthy = false
+			unhealthyTimer.Reset(UnhealthyAgentThreshold)
+		case <-unhealthyTimer.C:
+			unhealthy = true
+			log.WithField("agentID", ah.id.String()).Info("AgentHandler hasn't received a heartbeat, agent is unhealthy")
+			ah.atl.publishEvent(metadatapb.AGENT_EVENT_UNHEALTHY, ah.agent, nil)
 		case <-timer.C:
+			expired = true
 			log.WithField("agentID", ah.id.String()).Info("AgentHandler timed out, deleting agent")
 			return
 		}
@@ -400,6 +440,9 @@ func (ah *AgentHandler) onAgentRegisterRequest(m *messagespb.RegisterAgentReques
 		log.WithError(err).Error("Could not create agent.")
 		return
 	}
+	ah.agent = proto.Clone(agentInfo).(*agentpb.Agent)
+	ah.agent.ASID = asid
+	ah.atl.publishEvent(metadatapb.AGENT_EVENT_REGISTERED, ah.agent, nil)
 	resp := messagespb.VizierMessage{
 		Msg: &messagespb.VizierMessage_RegisterAgentResponse{
 			RegisterAgentResponse: &messagespb.RegisterAgentResponse{
@@ -414,8 +457,18 @@ func (ah *AgentHandler) onAgentRegisterRequest(m *messagespb.RegisterAgentReques
 		return
 	}
 
+	if ah.cfgMgr != nil {
+		go func() {
+			// Apply the persisted config settings that select the new agent.
+			err := ah.cfgMgr.ApplyAgentConfigs(agentInfo)
+			if err != nil {
+				log.WithError(err).Error("Failed to apply config settings to agent")
+			}
+		}()
+	}
+
 	go func() {
-		// Register all tracepoints on new agent.
+		// Register all tracepoints that select the new agent on it.
 		tracepoints, err := ah.tpMgr.GetAllTracepoints()
 		if err != nil {
 			log.WithError(err).Error("Could not get all tracepoints")
@@ -426,6 +479,14 @@ func (ah *AgentHandler) onAgentRegisterRequest(m *messagespb.RegisterAgentReques
 
 		for _, tp := range tracepoints {
 			if tp.ExpectedState != statuspb.TERMINATED_STATE {
+				selected, err := ah.tpMgr.SelectAgents(tp.AgentSelector, []*agentpb.Agent{agentInfo})
+				if err != nil {
+					log.WithError(err).WithField("tracepoint", tp.Name).Error("Failed to select the agents of tracepoint")
+					continue
+				}
+				if len(selected) == 0 {
+					continue
+				}
 				err = ah.tpMgr.RegisterTracepoint(agentIDs, utils.UUIDFromProtoOrNil(tp.ID), tp.Tracepoint)
 				if err != nil {
 					log.WithError(err).Error("Failed to send RegisterTracepoint request")
@@ -455,6 +516,9 @@ func (ah *AgentHandler) onAgentHeartbeat(m *messagespb.Heartbeat) {
 		}
 		return
 	}
+	if ah.agent != nil {
+		ah.agent.LastHeartbeatNS = time.Now().UnixNano()
+	}
 
 	// Create heartbeat ACK message.
 	resp := messagespb.VizierMessage{
@@ -480,6 +544,12 @@ func (ah *AgentHandler) onAgentHeartbeat(m *messagespb.Heartbeat) {
 		err = ah.agtMgr.ApplyAgentUpdate(&agent.Update{AgentID: agentID, UpdateInfo: m.UpdateInfo})
 		if err != nil {
 			log.WithError(err).Error("Could not apply agent updates")
+		} else if m.UpdateInfo.DoesUpdateSchema {
+			tables := make([]string, len(m.UpdateInfo.Schema))
+			for i, table := range m.UpdateInfo.Schema {
+				tables[i] = table.Name
+			}
+			ah.atl.publishEvent(metadatapb.AGENT_EVENT_SCHEMA_CHANGED, ah.agent, tables)
 		}
 	}
 }
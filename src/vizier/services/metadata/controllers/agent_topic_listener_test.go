@@ -41,6 +41,7 @@ import (
 	"px.dev/pixie/src/vizier/services/metadata/controllers/testutils"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
 	mock_tracepoint "px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint/mock"
+	metadata_servicepb "px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
 	"px.dev/pixie/src/vizier/services/shared/agentpb"
 )
@@ -82,7 +83,7 @@ func setup(t *testing.T, sendMsgFn controllers.SendMessageFn) (*controllers.Agen
 		Return([]*agentpb.Agent{agentInfo}, nil)
 
 	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
-	atl, _ := controllers.NewAgentTopicListener(mockAgtMgr, tracepointMgr, sendMsgFn)
+	atl, _ := controllers.NewAgentTopicListener(mockAgtMgr, tracepointMgr, nil, nil, sendMsgFn)
 
 	cleanup := func() {
 		ctrl.Finish()
@@ -586,3 +587,116 @@ func TestAgentStop(t *testing.T) {
 
 	atl.StopAgent(u)
 }
+
+func TestAgentEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+	defer tracepointMgr.Close()
+
+	kelvinInfo := new(agentpb.Agent)
+	if err := proto.UnmarshalText(testutils.UnhealthyKelvinAgentInfo, kelvinInfo); err != nil {
+		t.Fatalf("Cannot Unmarshal protobuf for unhealthy kelvin agent")
+	}
+	kelvinID := uuid.FromStringOrNil(testutils.UnhealthyKelvinAgentUUID)
+	mockAgtMgr.
+		EXPECT().
+		GetActiveAgents().
+		Return([]*agentpb.Agent{kelvinInfo}, nil)
+
+	agentEvents := controllers.NewAgentEventBroadcaster()
+	events, unsubscribe := agentEvents.Subscribe()
+	defer unsubscribe()
+	atl, err := controllers.NewAgentTopicListener(mockAgtMgr, tracepointMgr, nil, agentEvents, func(string, []byte) error {
+		return nil
+	})
+	require.NoError(t, err)
+
+	nextEvent := func() *metadata_servicepb.AgentEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for agent event")
+			return nil
+		}
+	}
+
+	handle := func(req *messagespb.VizierMessage) {
+		b, err := req.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, atl.HandleMessage(&nats.Msg{Data: b}))
+	}
+
+	// A new agent registers.
+	req := new(messagespb.VizierMessage)
+	if err := proto.UnmarshalText(testutils.RegisterAgentRequestPB, req); err != nil {
+		t.Fatal("Cannot Unmarshal protobuf.")
+	}
+	req.GetRegisterAgentRequest().Info.Capabilities = &agentpb.AgentCapabilities{
+		CollectsData: true,
+	}
+	mockAgtMgr.
+		EXPECT().
+		GetAgentIDForHostnamePair(gomock.Any()).
+		Return("", nil)
+	mockAgtMgr.
+		EXPECT().
+		RegisterAgent(gomock.Any()).
+		Return(uint32(1), nil)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepoints().
+		DoAndReturn(func() ([]*storepb.TracepointInfo, error) {
+			wg.Done()
+			return nil, nil
+		})
+	handle(req)
+	defer wg.Wait()
+
+	event := nextEvent()
+	assert.Equal(t, metadata_servicepb.AGENT_EVENT_REGISTERED, event.Type)
+	assert.Equal(t, testutils.NewAgentUUID, utils.UUIDFromProtoOrNil(event.Agent.Info.AgentID).String())
+	assert.Equal(t, uint32(1), event.Agent.ASID)
+	assert.NotNil(t, event.Time)
+
+	// The existing agent reports a schema change in its heartbeat.
+	hb := new(messagespb.VizierMessage)
+	if err := proto.UnmarshalText(testutils.HeartbeatPB, hb); err != nil {
+		t.Fatal("Cannot Unmarshal protobuf.")
+	}
+	hb.GetHeartbeat().AgentID = utils.ProtoFromUUID(kelvinID)
+	hb.GetHeartbeat().UpdateInfo = &messagespb.AgentUpdateInfo{
+		DoesUpdateSchema: true,
+		Schema: []*storepb.TableInfo{
+			{Name: "http_events"},
+			{Name: "process_stats"},
+		},
+	}
+	mockAgtMgr.EXPECT().UpdateHeartbeat(kelvinID).Return(nil)
+	mockAgtMgr.EXPECT().GetServiceCIDR().Return("10.64.4.0/22")
+	mockAgtMgr.EXPECT().GetPodCIDRs().Return([]string{"10.64.4.0/21"})
+	mockAgtMgr.EXPECT().ApplyAgentUpdate(gomock.Any()).Return(nil)
+	handle(hb)
+
+	event = nextEvent()
+	assert.Equal(t, metadata_servicepb.AGENT_EVENT_SCHEMA_CHANGED, event.Type)
+	assert.Equal(t, kelvinID, utils.UUIDFromProtoOrNil(event.Agent.Info.AgentID))
+	assert.Equal(t, "abcd", event.Agent.Info.HostInfo.Hostname)
+	assert.Greater(t, event.Agent.LastHeartbeatNS, int64(0))
+	assert.Equal(t, []string{"http_events", "process_stats"}, event.Tables)
+
+	// The existing agent is deleted.
+	mockAgtMgr.EXPECT().DeleteAgent(kelvinID).Return(nil)
+	mockTracepointStore.EXPECT().DeleteTracepointsForAgent(kelvinID).Return(nil)
+	atl.StopAgent(kelvinID)
+
+	event = nextEvent()
+	assert.Equal(t, metadata_servicepb.AGENT_EVENT_DELETED, event.Type)
+	assert.Equal(t, kelvinID, utils.UUIDFromProtoOrNil(event.Agent.Info.AgentID))
+}
@@ -0,0 +1,376 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package agentconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/messages/messagespb"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+// DefaultVerifyTimeout is how long the agents of a batch have to heartbeat after a config update, if the rollout
+// doesn't specify it. Agents heartbeat every few seconds.
+const DefaultVerifyTimeout = 30 * time.Second
+
+var (
+	// ErrNoAgentsSelected is produced if a rollout doesn't match any agents.
+	ErrNoAgentsSelected = errors.New("No agents match the agent selector")
+	// ErrInvalidKey is produced if a config key isn't a valid flag name.
+	ErrInvalidKey = errors.New("Config keys may only contain letters, digits, '_', '.' and '-', and must not start with '.'")
+	// ErrAgentConfigNotFound is produced if no setting is stored for a key and selector.
+	ErrAgentConfigNotFound = errors.New("No config setting is stored for the key and selector")
+)
+
+// keyRegex matches the config keys, which are the names of agent flags. Keys are part of the datastore keys of the
+// stored settings, so they must not contain path separators.
+var keyRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`)
+
+// ValidateKey returns ErrInvalidKey if the config key isn't a valid flag name.
+func ValidateKey(key string) error {
+	if !keyRegex.MatchString(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// agentManager is the part of the agent manager used to roll out config updates.
+type agentManager interface {
+	MessageAgents(agentIDs []uuid.UUID, msg []byte) error
+	GetActiveAgents() ([]*agentpb.Agent, error)
+}
+
+// AgentSelector selects the agents, out of the given ones, matching an agent selector. Agents are selected the same
+// way as the agents of tracepoints, so the tracepoint manager is an AgentSelector.
+type AgentSelector interface {
+	SelectAgents(selector *storepb.TracepointAgentSelector, agents []*agentpb.Agent) ([]uuid.UUID, error)
+}
+
+// Store is a datastore which can store and retrieve the config settings applied to new agents. Settings are stored
+// per key and selector.
+type Store interface {
+	SetAgentConfig(*storepb.AgentConfigSetting) error
+	DeleteAgentConfig(key string, selector *storepb.TracepointAgentSelector) error
+	GetAgentConfigs() ([]*storepb.AgentConfigSetting, error)
+}
+
+// RolloutOptions configures how a config setting is rolled out.
+type RolloutOptions struct {
+	// The number of agents updated at once. If 0, all agents are updated in a single batch.
+	BatchSize int
+	// How long the agents of a batch have to heartbeat after the update. If 0, DefaultVerifyTimeout is used.
+	VerifyTimeout time.Duration
+	// Whether to store the setting once it's rolled out to every agent, so that it's applied to new agents.
+	Persist bool
+}
+
+// Manager rolls out config settings to the data collecting agents of the cluster.
+type Manager struct {
+	cs       Store
+	agtMgr   agentManager
+	selector AgentSelector
+	// How often the heartbeats of the agents of a batch are checked while verifying it.
+	pollInterval time.Duration
+}
+
+// NewManager creates a new agent config manager.
+func NewManager(cs Store, agtMgr agentManager, selector AgentSelector) *Manager {
+	return &Manager{
+		cs:           cs,
+		agtMgr:       agtMgr,
+		selector:     selector,
+		pollInterval: 1 * time.Second,
+	}
+}
+
+func configUpdateMessage(setting *storepb.AgentConfigSetting) ([]byte, error) {
+	updateReq := messagespb.VizierMessage{
+		Msg: &messagespb.VizierMessage_ConfigUpdateMessage{
+			ConfigUpdateMessage: &messagespb.ConfigUpdateMessage{
+				Msg: &messagespb.ConfigUpdateMessage_ConfigUpdateRequest{
+					ConfigUpdateRequest: &messagespb.ConfigUpdateRequest{
+						Key:   setting.Key,
+						Value: setting.Value,
+					},
+				},
+			},
+		},
+	}
+	return updateReq.Marshal()
+}
+
+// selectAgents returns the data collecting agents, out of the given ones, that the setting applies to.
+func (m *Manager) selectAgents(setting *storepb.AgentConfigSetting, agents []*agentpb.Agent) ([]*agentpb.Agent, error) {
+	var collectors []*agentpb.Agent
+	for _, agt := range agents {
+		// Agents that don't collect data, such as Kelvin, don't have the data collector settings.
+		if agt.Info == nil || (agt.Info.Capabilities != nil && !agt.Info.Capabilities.CollectsData) {
+			continue
+		}
+		collectors = append(collectors, agt)
+	}
+	if len(collectors) == 0 {
+		return nil, nil
+	}
+
+	agentIDs, err := m.selector.SelectAgents(setting.AgentSelector, collectors)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[uuid.UUID]bool, len(agentIDs))
+	for _, agentID := range agentIDs {
+		selected[agentID] = true
+	}
+	var matches []*agentpb.Agent
+	for _, agt := range collectors {
+		if selected[utils.UUIDFromProtoOrNil(agt.Info.AgentID)] {
+			matches = append(matches, agt)
+		}
+	}
+	return matches, nil
+}
+
+func hostname(agt *agentpb.Agent) string {
+	if agt.Info.HostInfo == nil {
+		return ""
+	}
+	return agt.Info.HostInfo.Hostname
+}
+
+// Rollout sends the setting to the data collecting agents matching its selector, opts.BatchSize agents at a time.
+// After sending the setting to a batch, it waits for every agent of the batch to heartbeat, which verifies that the
+// agent is still running with the new setting, and then calls onBatch with the outcome on each agent of the batch.
+// If any agent of a batch fails, the remaining agents are skipped. Returns whether the setting was persisted.
+func (m *Manager) Rollout(ctx context.Context, setting *storepb.AgentConfigSetting, opts *RolloutOptions,
+	onBatch func([]*metadatapb.AgentConfigStatus) error) (bool, error) {
+	if err := ValidateKey(setting.Key); err != nil {
+		return false, err
+	}
+	agents, err := m.agtMgr.GetActiveAgents()
+	if err != nil {
+		return false, err
+	}
+	agents, err = m.selectAgents(setting, agents)
+	if err != nil {
+		return false, err
+	}
+	if len(agents) == 0 {
+		return false, ErrNoAgentsSelected
+	}
+	// Update the agents in a consistent order, so that the batches of a repeated rollout are the same.
+	sort.Slice(agents, func(i, j int) bool {
+		return hostname(agents[i]) < hostname(agents[j])
+	})
+
+	msg, err := configUpdateMessage(setting)
+	if err != nil {
+		return false, err
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(agents)
+	}
+	verifyTimeout := opts.VerifyTimeout
+	if verifyTimeout <= 0 {
+		verifyTimeout = DefaultVerifyTimeout
+	}
+
+	for start := 0; start < len(agents); start += batchSize {
+		end := start + batchSize
+		if end > len(agents) {
+			end = len(agents)
+		}
+		agentIDs := make([]uuid.UUID, end-start)
+		for i, agt := range agents[start:end] {
+			agentIDs[i] = utils.UUIDFromProtoOrNil(agt.Info.AgentID)
+		}
+
+		sentAt := time.Now()
+		var failures map[uuid.UUID]string
+		if err := m.agtMgr.MessageAgents(agentIDs, msg); err != nil {
+			failures = make(map[uuid.UUID]string, len(agentIDs))
+			for _, agentID := range agentIDs {
+				failures[agentID] = fmt.Sprintf("Failed to send the config update: %s", err.Error())
+			}
+		} else {
+			failures = m.verifyBatch(ctx, agentIDs, sentAt, verifyTimeout)
+		}
+
+		statuses := make([]*metadatapb.AgentConfigStatus, len(agentIDs))
+		for i, agentID := range agentIDs {
+			statuses[i] = &metadatapb.AgentConfigStatus{
+				AgentID: utils.ProtoFromUUID(agentID),
+				State:   metadatapb.AGENT_CONFIG_APPLIED,
+			}
+			if message, ok := failures[agentID]; ok {
+				statuses[i].State = metadatapb.AGENT_CONFIG_FAILED
+				statuses[i].Message = message
+			}
+		}
+		if err := onBatch(statuses); err != nil {
+			return false, err
+		}
+
+		if len(failures) > 0 {
+			log.WithField("key", setting.Key).WithField("failed", len(failures)).Info("Stopping config rollout after agents failed")
+			skipped := make([]*metadatapb.AgentConfigStatus, len(agents)-end)
+			for i, agt := range agents[end:] {
+				skipped[i] = &metadatapb.AgentConfigStatus{
+					AgentID: agt.Info.AgentID,
+					State:   metadatapb.AGENT_CONFIG_SKIPPED,
+					Message: "The rollout stopped after agents of an earlier batch failed",
+				}
+			}
+			if len(skipped) > 0 {
+				if err := onBatch(skipped); err != nil {
+					return false, err
+				}
+			}
+			return false, nil
+		}
+	}
+
+	if !opts.Persist {
+		return false, nil
+	}
+	if err := m.cs.SetAgentConfig(setting); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// verifyBatch waits for the agents to heartbeat after sentAt, and returns why each agent that didn't failed.
+func (m *Manager) verifyBatch(ctx context.Context, agentIDs []uuid.UUID, sentAt time.Time, timeout time.Duration) map[uuid.UUID]string {
+	failures := make(map[uuid.UUID]string)
+	pending := make(map[uuid.UUID]bool, len(agentIDs))
+	for _, agentID := range agentIDs {
+		pending[agentID] = true
+	}
+
+	check := func() {
+		agents, err := m.agtMgr.GetActiveAgents()
+		if err != nil {
+			log.WithError(err).Error("Failed to get agents to verify config rollout")
+			return
+		}
+		active := make(map[uuid.UUID]*agentpb.Agent, len(agents))
+		for _, agt := range agents {
+			active[utils.UUIDFromProtoOrNil(agt.Info.AgentID)] = agt
+		}
+		for agentID := range pending {
+			agt, ok := active[agentID]
+			if !ok {
+				failures[agentID] = "The agent is no longer active"
+				delete(pending, agentID)
+			} else if agt.LastHeartbeatNS > sentAt.UnixNano() {
+				delete(pending, agentID)
+			}
+		}
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+	for len(pending) > 0 {
+		select {
+		case <-ctx.Done():
+			for agentID := range pending {
+				failures[agentID] = "The rollout was canceled before the agent heartbeated"
+			}
+			return failures
+		case <-deadline.C:
+			check()
+			for agentID := range pending {
+				failures[agentID] = fmt.Sprintf("The agent didn't heartbeat within %s of the update", timeout)
+			}
+			return failures
+		case <-ticker.C:
+			check()
+		}
+	}
+	return failures
+}
+
+// ListAgentConfigs returns the persisted settings, ordered by key.
+func (m *Manager) ListAgentConfigs() ([]*storepb.AgentConfigSetting, error) {
+	settings, err := m.cs.GetAgentConfigs()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(settings, func(i, j int) bool {
+		return settings[i].Key < settings[j].Key
+	})
+	return settings, nil
+}
+
+// DeleteAgentConfig deletes the persisted setting of the key for the selector, so that it's no longer applied to new
+// agents. The agents which already have the setting keep it.
+func (m *Manager) DeleteAgentConfig(key string, selector *storepb.TracepointAgentSelector) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	return m.cs.DeleteAgentConfig(key, selector)
+}
+
+// ApplyAgentConfigs sends the persisted settings that apply to the agent to it. It's used to configure agents
+// when they register.
+func (m *Manager) ApplyAgentConfigs(agt *agentpb.Agent) error {
+	settings, err := m.cs.GetAgentConfigs()
+	if err != nil {
+		return err
+	}
+	// If a key is set both for all agents and for agents matching a selector, the agent should end up with the more
+	// specific setting, so it's sent last.
+	sort.SliceStable(settings, func(i, j int) bool {
+		return isEmptySelector(settings[i].AgentSelector) && !isEmptySelector(settings[j].AgentSelector)
+	})
+
+	agentID := utils.UUIDFromProtoOrNil(agt.Info.AgentID)
+	for _, setting := range settings {
+		selected, err := m.selectAgents(setting, []*agentpb.Agent{agt})
+		if err != nil {
+			log.WithError(err).WithField("key", setting.Key).Error("Failed to select the agents of config setting")
+			continue
+		}
+		if len(selected) == 0 {
+			continue
+		}
+		msg, err := configUpdateMessage(setting)
+		if err != nil {
+			return err
+		}
+		err = m.agtMgr.MessageAgents([]uuid.UUID{agentID}, msg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package agentconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"sort"
+
+	"github.com/gogo/protobuf/proto"
+
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/utils/datastore"
+)
+
+const agentConfigsPrefix = "/agentConfig/"
+
+// allAgentsSelectorID identifies the settings which apply to all agents.
+const allAgentsSelectorID = "all"
+
+// Datastore implements the Store interface on a given Datastore.
+type Datastore struct {
+	ds datastore.MultiGetterSetterDeleterCloser
+}
+
+// NewDatastore wraps the datastore in an agent config store.
+func NewDatastore(ds datastore.MultiGetterSetterDeleterCloser) *Datastore {
+	return &Datastore{ds: ds}
+}
+
+// isEmptySelector returns whether the selector selects all agents.
+func isEmptySelector(selector *storepb.TracepointAgentSelector) bool {
+	return selector == nil || (len(selector.NodeNames) == 0 && len(selector.NodeLabels) == 0 &&
+		len(selector.Namespaces) == 0 && len(selector.PodLabels) == 0)
+}
+
+// selectorID returns an ID which is the same for selectors that select the same agents, regardless of the order of
+// their node names, namespaces and labels.
+func selectorID(selector *storepb.TracepointAgentSelector) (string, error) {
+	if isEmptySelector(selector) {
+		return allAgentsSelectorID, nil
+	}
+	sorted := func(vals []string) []string {
+		s := append([]string{}, vals...)
+		sort.Strings(s)
+		return s
+	}
+	// JSON encodes maps with sorted keys, so the encoding is canonical.
+	b, err := json.Marshal(struct {
+		NodeNames  []string          `json:"node_names"`
+		NodeLabels map[string]string `json:"node_labels"`
+		Namespaces []string          `json:"namespaces"`
+		PodLabels  map[string]string `json:"pod_labels"`
+	}{
+		NodeNames:  sorted(selector.NodeNames),
+		NodeLabels: selector.NodeLabels,
+		Namespaces: sorted(selector.Namespaces),
+		PodLabels:  selector.PodLabels,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// getAgentConfigKey returns the datastore key of the setting of the key for the agents matching the selector, so that
+// the same key can be set to different values for different agents.
+func getAgentConfigKey(key string, selector *storepb.TracepointAgentSelector) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	id, err := selectorID(selector)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(agentConfigsPrefix, key, id), nil
+}
+
+// SetAgentConfig stores the setting, replacing any setting with the same key and selector.
+func (a *Datastore) SetAgentConfig(setting *storepb.AgentConfigSetting) error {
+	key, err := getAgentConfigKey(setting.Key, setting.AgentSelector)
+	if err != nil {
+		return err
+	}
+	val, err := setting.Marshal()
+	if err != nil {
+		return err
+	}
+	return a.ds.Set(key, string(val))
+}
+
+// DeleteAgentConfig deletes the setting with the given key and selector. Returns ErrAgentConfigNotFound if there is
+// no such setting.
+func (a *Datastore) DeleteAgentConfig(key string, selector *storepb.TracepointAgentSelector) error {
+	dsKey, err := getAgentConfigKey(key, selector)
+	if err != nil {
+		return err
+	}
+	val, err := a.ds.Get(dsKey)
+	if err != nil {
+		return err
+	}
+	if val == nil {
+		return ErrAgentConfigNotFound
+	}
+	return a.ds.Delete(dsKey)
+}
+
+// GetAgentConfigs gets all of the stored settings.
+func (a *Datastore) GetAgentConfigs() ([]*storepb.AgentConfigSetting, error) {
+	_, vals, err := a.ds.GetWithPrefix(agentConfigsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make([]*storepb.AgentConfigSetting, 0, len(vals))
+	for _, val := range vals {
+		setting := &storepb.AgentConfigSetting{}
+		err := proto.Unmarshal(val, setting)
+		if err != nil {
+			continue
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package agentconfig
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
+)
+
+func setupTest(t *testing.T) (*pebbledb.DataStore, *Datastore, func()) {
+	memFS := vfs.NewMem()
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: memFS,
+	})
+	if err != nil {
+		t.Fatal("failed to initialize a pebbledb")
+		os.Exit(1)
+	}
+
+	db := pebbledb.New(c, 3*time.Second)
+	cs := NewDatastore(db)
+	cleanup := func() {
+		err := db.Close()
+		if err != nil {
+			t.Fatal("Failed to close db")
+		}
+	}
+
+	return db, cs, cleanup
+}
+
+func TestAgentConfigStore_SetAgentConfig(t *testing.T) {
+	_, cs, cleanup := setupTest(t)
+	defer cleanup()
+
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{
+		Key:   "datastream_buffer_size",
+		Value: "1024",
+	}))
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{
+		Key:           "stirling_sampling_period",
+		Value:         "100ms",
+		AgentSelector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-a"}},
+	}))
+	// Setting a key again replaces its setting.
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{
+		Key:   "datastream_buffer_size",
+		Value: "4096",
+	}))
+
+	settings, err := cs.GetAgentConfigs()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*storepb.AgentConfigSetting{
+		{
+			Key:   "datastream_buffer_size",
+			Value: "4096",
+		},
+		{
+			Key:           "stirling_sampling_period",
+			Value:         "100ms",
+			AgentSelector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-a"}},
+		},
+	}, settings)
+}
+
+func TestAgentConfigStore_GetAgentConfigs_Empty(t *testing.T) {
+	_, cs, cleanup := setupTest(t)
+	defer cleanup()
+
+	settings, err := cs.GetAgentConfigs()
+	require.NoError(t, err)
+	assert.Empty(t, settings)
+}
+
+func TestAgentConfigStore_SetAgentConfig_PerSelector(t *testing.T) {
+	_, cs, cleanup := setupTest(t)
+	defer cleanup()
+
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{
+		Key:   "datastream_buffer_size",
+		Value: "1024",
+	}))
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{
+		Key:   "datastream_buffer_size",
+		Value: "4096",
+		AgentSelector: &storepb.TracepointAgentSelector{
+			NodeNames:  []string{"node-a", "node-b"},
+			NodeLabels: map[string]string{"pool": "a", "zone": "b"},
+		},
+	}))
+	// The same selector with its node names in another order replaces the setting.
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{
+		Key:   "datastream_buffer_size",
+		Value: "8192",
+		AgentSelector: &storepb.TracepointAgentSelector{
+			NodeNames:  []string{"node-b", "node-a"},
+			NodeLabels: map[string]string{"zone": "b", "pool": "a"},
+		},
+	}))
+
+	settings, err := cs.GetAgentConfigs()
+	require.NoError(t, err)
+	require.Len(t, settings, 2)
+	values := []string{settings[0].Value, settings[1].Value}
+	assert.ElementsMatch(t, []string{"1024", "8192"}, values)
+}
+
+func TestAgentConfigStore_DeleteAgentConfig(t *testing.T) {
+	_, cs, cleanup := setupTest(t)
+	defer cleanup()
+
+	nodeA := &storepb.TracepointAgentSelector{NodeNames: []string{"node-a"}}
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{
+		Key:   "datastream_buffer_size",
+		Value: "1024",
+	}))
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{
+		Key:           "datastream_buffer_size",
+		Value:         "4096",
+		AgentSelector: nodeA,
+	}))
+
+	// Only the setting of the given selector is deleted.
+	require.NoError(t, cs.DeleteAgentConfig("datastream_buffer_size", nodeA))
+	settings, err := cs.GetAgentConfigs()
+	require.NoError(t, err)
+	assert.Equal(t, []*storepb.AgentConfigSetting{
+		{
+			Key:   "datastream_buffer_size",
+			Value: "1024",
+		},
+	}, settings)
+
+	assert.Equal(t, ErrAgentConfigNotFound, cs.DeleteAgentConfig("datastream_buffer_size", nodeA))
+	assert.Equal(t, ErrAgentConfigNotFound, cs.DeleteAgentConfig("stirling_sampling_period", nil))
+}
+
+func TestAgentConfigStore_InvalidKey(t *testing.T) {
+	db, cs, cleanup := setupTest(t)
+	defer cleanup()
+
+	// Keys which would escape the settings' prefix are rejected.
+	for _, key := range []string{"", "..", "../tracepoint", "a/b", ".hidden"} {
+		err := cs.SetAgentConfig(&storepb.AgentConfigSetting{Key: key, Value: "1"})
+		assert.Equal(t, ErrInvalidKey, err, key)
+		assert.Equal(t, ErrInvalidKey, cs.DeleteAgentConfig(key, nil), key)
+	}
+	keys, _, err := db.GetWithPrefix("/")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
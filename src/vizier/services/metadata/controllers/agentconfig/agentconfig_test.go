@@ -0,0 +1,284 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package agentconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/utils"
+	mock_agent "px.dev/pixie/src/vizier/services/metadata/controllers/agent/mock"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+// fakeSelector selects the agents on the nodes named by the selector, or all agents if it doesn't name any.
+type fakeSelector struct{}
+
+func (f *fakeSelector) SelectAgents(selector *storepb.TracepointAgentSelector, agents []*agentpb.Agent) ([]uuid.UUID, error) {
+	var agentIDs []uuid.UUID
+	for _, agt := range agents {
+		match := len(selector.GetNodeNames()) == 0
+		for _, node := range selector.GetNodeNames() {
+			if agt.Info.HostInfo.Hostname == node {
+				match = true
+			}
+		}
+		if match {
+			agentIDs = append(agentIDs, utils.UUIDFromProtoOrNil(agt.Info.AgentID))
+		}
+	}
+	return agentIDs, nil
+}
+
+func makeAgent(hostname string, collectsData bool) *agentpb.Agent {
+	return &agentpb.Agent{
+		Info: &agentpb.AgentInfo{
+			AgentID:      utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+			HostInfo:     &agentpb.HostInfo{Hostname: hostname},
+			Capabilities: &agentpb.AgentCapabilities{CollectsData: collectsData},
+		},
+	}
+}
+
+func agentID(agt *agentpb.Agent) uuid.UUID {
+	return utils.UUIDFromProtoOrNil(agt.Info.AgentID)
+}
+
+// heartbeating returns the agents, with the given ones having heartbeated now.
+func heartbeating(agents []*agentpb.Agent, alive ...*agentpb.Agent) []*agentpb.Agent {
+	beat := make(map[*agentpb.Agent]bool)
+	for _, agt := range alive {
+		beat[agt] = true
+	}
+	updated := make([]*agentpb.Agent, len(agents))
+	for i, agt := range agents {
+		updated[i] = &agentpb.Agent{Info: agt.Info}
+		if beat[agt] {
+			updated[i].LastHeartbeatNS = time.Now().UnixNano()
+		}
+	}
+	return updated
+}
+
+func setupManager(t *testing.T) (*Manager, *Datastore, *mock_agent.MockManager, func()) {
+	ctrl := gomock.NewController(t)
+	_, cs, cleanup := setupTest(t)
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	m := NewManager(cs, mockAgtMgr, &fakeSelector{})
+	m.pollInterval = 5 * time.Millisecond
+	return m, cs, mockAgtMgr, func() {
+		cleanup()
+		ctrl.Finish()
+	}
+}
+
+func TestManager_Rollout(t *testing.T) {
+	m, cs, mockAgtMgr, cleanup := setupManager(t)
+	defer cleanup()
+
+	pemC := makeAgent("node-c", true)
+	pemA := makeAgent("node-a", true)
+	pemB := makeAgent("node-b", true)
+	kelvin := makeAgent("node-k", false)
+	agents := []*agentpb.Agent{pemC, kelvin, pemA, pemB}
+
+	setting := &storepb.AgentConfigSetting{Key: "datastream_buffer_size", Value: "4096"}
+	msg, err := configUpdateMessage(setting)
+	require.NoError(t, err)
+
+	gomock.InOrder(
+		mockAgtMgr.EXPECT().GetActiveAgents().Return(agents, nil),
+		mockAgtMgr.EXPECT().MessageAgents([]uuid.UUID{agentID(pemA), agentID(pemB)}, msg).Return(nil),
+		mockAgtMgr.EXPECT().GetActiveAgents().DoAndReturn(func() ([]*agentpb.Agent, error) {
+			return heartbeating(agents, pemA, pemB), nil
+		}),
+		mockAgtMgr.EXPECT().MessageAgents([]uuid.UUID{agentID(pemC)}, msg).Return(nil),
+		mockAgtMgr.EXPECT().GetActiveAgents().DoAndReturn(func() ([]*agentpb.Agent, error) {
+			return heartbeating(agents, pemC), nil
+		}),
+	)
+
+	var batches [][]*metadatapb.AgentConfigStatus
+	persisted, err := m.Rollout(context.Background(), setting, &RolloutOptions{
+		BatchSize:     2,
+		VerifyTimeout: time.Second,
+		Persist:       true,
+	}, func(statuses []*metadatapb.AgentConfigStatus) error {
+		batches = append(batches, statuses)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, persisted)
+	assert.Equal(t, [][]*metadatapb.AgentConfigStatus{
+		{
+			{AgentID: pemA.Info.AgentID, State: metadatapb.AGENT_CONFIG_APPLIED},
+			{AgentID: pemB.Info.AgentID, State: metadatapb.AGENT_CONFIG_APPLIED},
+		},
+		{
+			{AgentID: pemC.Info.AgentID, State: metadatapb.AGENT_CONFIG_APPLIED},
+		},
+	}, batches)
+
+	settings, err := cs.GetAgentConfigs()
+	require.NoError(t, err)
+	assert.Equal(t, []*storepb.AgentConfigSetting{setting}, settings)
+}
+
+func TestManager_Rollout_StopsOnFailure(t *testing.T) {
+	m, cs, mockAgtMgr, cleanup := setupManager(t)
+	defer cleanup()
+
+	pemA := makeAgent("node-a", true)
+	pemB := makeAgent("node-b", true)
+	pemC := makeAgent("node-c", true)
+	agents := []*agentpb.Agent{pemA, pemB, pemC}
+
+	setting := &storepb.AgentConfigSetting{Key: "datastream_buffer_size", Value: "4096"}
+	msg, err := configUpdateMessage(setting)
+	require.NoError(t, err)
+
+	mockAgtMgr.EXPECT().GetActiveAgents().DoAndReturn(func() ([]*agentpb.Agent, error) {
+		// Agent B never heartbeats after the update.
+		return heartbeating(agents, pemA, pemC), nil
+	}).AnyTimes()
+	gomock.InOrder(
+		mockAgtMgr.EXPECT().MessageAgents([]uuid.UUID{agentID(pemA)}, msg).Return(nil),
+		mockAgtMgr.EXPECT().MessageAgents([]uuid.UUID{agentID(pemB)}, msg).Return(nil),
+	)
+
+	var statuses []*metadatapb.AgentConfigStatus
+	persisted, err := m.Rollout(context.Background(), setting, &RolloutOptions{
+		BatchSize:     1,
+		VerifyTimeout: 50 * time.Millisecond,
+		Persist:       true,
+	}, func(batch []*metadatapb.AgentConfigStatus) error {
+		statuses = append(statuses, batch...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, persisted)
+
+	require.Len(t, statuses, 3)
+	assert.Equal(t, metadatapb.AGENT_CONFIG_APPLIED, statuses[0].State)
+	assert.Equal(t, pemB.Info.AgentID, statuses[1].AgentID)
+	assert.Equal(t, metadatapb.AGENT_CONFIG_FAILED, statuses[1].State)
+	assert.Contains(t, statuses[1].Message, "didn't heartbeat")
+	assert.Equal(t, pemC.Info.AgentID, statuses[2].AgentID)
+	assert.Equal(t, metadatapb.AGENT_CONFIG_SKIPPED, statuses[2].State)
+
+	settings, err := cs.GetAgentConfigs()
+	require.NoError(t, err)
+	assert.Empty(t, settings)
+}
+
+func TestManager_Rollout_NoAgents(t *testing.T) {
+	m, _, mockAgtMgr, cleanup := setupManager(t)
+	defer cleanup()
+
+	mockAgtMgr.EXPECT().GetActiveAgents().Return([]*agentpb.Agent{makeAgent("node-k", false)}, nil)
+
+	_, err := m.Rollout(context.Background(), &storepb.AgentConfigSetting{Key: "datastream_buffer_size", Value: "4096"},
+		&RolloutOptions{}, func([]*metadatapb.AgentConfigStatus) error {
+			t.Fatal("No batch should be rolled out")
+			return nil
+		})
+	assert.Equal(t, ErrNoAgentsSelected, err)
+}
+
+func TestManager_ApplyAgentConfigs(t *testing.T) {
+	m, cs, mockAgtMgr, cleanup := setupManager(t)
+	defer cleanup()
+
+	allAgents := &storepb.AgentConfigSetting{Key: "datastream_buffer_size", Value: "4096"}
+	otherNode := &storepb.AgentConfigSetting{
+		Key:           "stirling_sampling_period",
+		Value:         "100ms",
+		AgentSelector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-b"}},
+	}
+	require.NoError(t, cs.SetAgentConfig(allAgents))
+	require.NoError(t, cs.SetAgentConfig(otherNode))
+
+	pemA := makeAgent("node-a", true)
+	msg, err := configUpdateMessage(allAgents)
+	require.NoError(t, err)
+	mockAgtMgr.EXPECT().MessageAgents([]uuid.UUID{agentID(pemA)}, msg).Return(nil)
+	require.NoError(t, m.ApplyAgentConfigs(pemA))
+
+	// Agents that don't collect data don't get any settings.
+	require.NoError(t, m.ApplyAgentConfigs(makeAgent("node-a", false)))
+}
+
+func TestManager_ApplyAgentConfigs_SelectorOverridesAllAgents(t *testing.T) {
+	m, cs, mockAgtMgr, cleanup := setupManager(t)
+	defer cleanup()
+
+	nodeA := &storepb.AgentConfigSetting{
+		Key:           "datastream_buffer_size",
+		Value:         "8192",
+		AgentSelector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-a"}},
+	}
+	allAgents := &storepb.AgentConfigSetting{Key: "datastream_buffer_size", Value: "4096"}
+	require.NoError(t, cs.SetAgentConfig(nodeA))
+	require.NoError(t, cs.SetAgentConfig(allAgents))
+
+	pemA := makeAgent("node-a", true)
+	allMsg, err := configUpdateMessage(allAgents)
+	require.NoError(t, err)
+	nodeMsg, err := configUpdateMessage(nodeA)
+	require.NoError(t, err)
+	// The setting for the agent's node is sent last, so that it takes precedence.
+	gomock.InOrder(
+		mockAgtMgr.EXPECT().MessageAgents([]uuid.UUID{agentID(pemA)}, allMsg).Return(nil),
+		mockAgtMgr.EXPECT().MessageAgents([]uuid.UUID{agentID(pemA)}, nodeMsg).Return(nil),
+	)
+	require.NoError(t, m.ApplyAgentConfigs(pemA))
+}
+
+func TestManager_DeleteAgentConfig(t *testing.T) {
+	m, cs, _, cleanup := setupManager(t)
+	defer cleanup()
+
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{Key: "stirling_sampling_period", Value: "100ms"}))
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{Key: "datastream_buffer_size", Value: "4096"}))
+
+	settings, err := m.ListAgentConfigs()
+	require.NoError(t, err)
+	assert.Equal(t, []*storepb.AgentConfigSetting{
+		{Key: "datastream_buffer_size", Value: "4096"},
+		{Key: "stirling_sampling_period", Value: "100ms"},
+	}, settings)
+
+	require.NoError(t, m.DeleteAgentConfig("datastream_buffer_size", nil))
+	settings, err = m.ListAgentConfigs()
+	require.NoError(t, err)
+	assert.Equal(t, []*storepb.AgentConfigSetting{
+		{Key: "stirling_sampling_period", Value: "100ms"},
+	}, settings)
+
+	assert.Equal(t, ErrAgentConfigNotFound, m.DeleteAgentConfig("datastream_buffer_size", nil))
+	assert.Equal(t, ErrInvalidKey, m.DeleteAgentConfig("../tracepoints", nil))
+}
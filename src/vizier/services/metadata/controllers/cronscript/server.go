@@ -23,13 +23,21 @@ import (
 	"sync"
 
 	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/types"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
 
+	"px.dev/pixie/src/shared/cvmsgs"
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/utils/messagebus"
 )
 
+// CronScriptExecutionErrorTopic is the channel that cron script execution errors are sent to the cloud on.
+var CronScriptExecutionErrorTopic = messagebus.V2CTopic(cvmsgs.CronScriptExecutionErrorChannel)
+
 // Store is a datastore which can store, update, and retrieve information about cron scripts.
 type Store interface {
 	GetCronScripts() ([]*cvmsgspb.CronScript, error)
@@ -43,15 +51,17 @@ type Store interface {
 // Server is an implementation of the cronscriptstore service.
 type Server struct {
 	ds Store
+	nc *nats.Conn
 
 	done chan struct{}
 	once sync.Once
 }
 
-// New creates a new server.
-func New(ds Store) *Server {
+// New creates a new server. If nc is non-nil, execution errors are forwarded to the cloud.
+func New(ds Store, nc *nats.Conn) *Server {
 	return &Server{
 		ds:   ds,
+		nc:   nc,
 		done: make(chan struct{}),
 	}
 }
@@ -127,9 +137,43 @@ func (s *Server) RecordExecutionResult(ctx context.Context, req *metadatapb.Reco
 	if err != nil {
 		return nil, err
 	}
+
+	if result.Error != nil {
+		s.sendExecutionErrorToCloud(result)
+	}
 	return &metadatapb.RecordExecutionResultResponse{}, nil
 }
 
+// sendExecutionErrorToCloud forwards a failed execution to the cloud. Failures to send are logged but
+// do not fail the request, since the result has already been recorded.
+func (s *Server) sendExecutionErrorToCloud(result *storepb.CronScriptResult) {
+	if s.nc == nil {
+		return
+	}
+
+	anyMsg, err := types.MarshalAny(&cvmsgspb.CronScriptExecutionError{
+		ScriptID:     result.ScriptID,
+		Timestamp:    result.Timestamp,
+		ErrorMessage: result.Error.Msg,
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal cron script execution error")
+		return
+	}
+	v2cMsg := cvmsgspb.V2CMessage{
+		Msg: anyMsg,
+	}
+	b, err := v2cMsg.Marshal()
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal cron script execution error")
+		return
+	}
+	err = s.nc.Publish(CronScriptExecutionErrorTopic, b)
+	if err != nil {
+		log.WithError(err).Error("Failed to publish cron script execution error")
+	}
+}
+
 // GetAllExecutionResults returns all of the execution results for cronscripts stored by this service.
 func (s *Server) GetAllExecutionResults(ctx context.Context, req *metadatapb.GetAllExecutionResultsRequest) (*metadatapb.GetAllExecutionResultsResponse, error) {
 	results, err := s.ds.GetAllCronScriptResults()
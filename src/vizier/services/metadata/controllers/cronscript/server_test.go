@@ -21,17 +21,24 @@ package cronscript_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
 	"github.com/golang/mock/gomock"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"px.dev/pixie/src/common/base/statuspb"
 	"px.dev/pixie/src/shared/cvmsgspb"
 	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/cronscript"
 	mock_cronscript "px.dev/pixie/src/vizier/services/metadata/controllers/cronscript/mock"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
 )
 
 func TestGetScripts(t *testing.T) {
@@ -50,7 +57,7 @@ func TestGetScripts(t *testing.T) {
 
 	mockStore.EXPECT().GetCronScripts().Return([]*cvmsgspb.CronScript{s1, s2}, nil)
 
-	s := cronscript.New(mockStore)
+	s := cronscript.New(mockStore, nil)
 
 	resp, err := s.GetScripts(context.Background(), &metadatapb.GetScriptsRequest{})
 	require.Nil(t, err)
@@ -74,7 +81,7 @@ func TestAddOrUpdateScript(t *testing.T) {
 
 	mockStore.EXPECT().UpsertCronScript(s1).Return(nil)
 
-	s := cronscript.New(mockStore)
+	s := cronscript.New(mockStore, nil)
 
 	resp, err := s.AddOrUpdateScript(context.Background(), &metadatapb.AddOrUpdateScriptRequest{
 		Script: s1,
@@ -93,7 +100,7 @@ func TestDeleteScript(t *testing.T) {
 
 	mockStore.EXPECT().DeleteCronScript(uuid.FromStringOrNil("223e4567-e89b-12d3-a456-426655440000")).Return(nil)
 
-	s := cronscript.New(mockStore)
+	s := cronscript.New(mockStore, nil)
 
 	resp, err := s.DeleteScript(context.Background(), &metadatapb.DeleteScriptRequest{
 		ScriptID: utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000"),
@@ -124,7 +131,7 @@ func TestSetScripts(t *testing.T) {
 			return nil
 		})
 
-	s := cronscript.New(mockStore)
+	s := cronscript.New(mockStore, nil)
 
 	resp, err := s.SetScripts(context.Background(), &metadatapb.SetScriptsRequest{
 		Scripts: map[string]*cvmsgspb.CronScript{
@@ -137,3 +144,63 @@ func TestSetScripts(t *testing.T) {
 
 	assert.Equal(t, &metadatapb.SetScriptsResponse{}, resp)
 }
+
+func TestRecordExecutionResult_ErrorSentToCloud(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockStore := mock_cronscript.NewMockStore(ctrl)
+
+	nc, natsCleanup := testingutils.MustStartTestNATS(t)
+	defer natsCleanup()
+
+	errCh := make(chan *nats.Msg, 1)
+	sub, err := nc.ChanSubscribe(cronscript.CronScriptExecutionErrorTopic, errCh)
+	require.NoError(t, err)
+	defer func() {
+		err := sub.Unsubscribe()
+		require.NoError(t, err)
+	}()
+
+	scriptID := utils.ProtoFromUUIDStrOrNil("223e4567-e89b-12d3-a456-426655440000")
+	ts := &types.Timestamp{Seconds: 10}
+	scriptErr := &statuspb.Status{
+		ErrCode: statuspb.INVALID_ARGUMENT,
+		Msg:     "compilation failed",
+	}
+
+	mockStore.EXPECT().RecordCronScriptResult(&storepb.CronScriptResult{
+		ScriptID:  scriptID,
+		Timestamp: ts,
+		Error:     scriptErr,
+	}).Return(nil)
+
+	s := cronscript.New(mockStore, nc)
+
+	resp, err := s.RecordExecutionResult(context.Background(), &metadatapb.RecordExecutionResultRequest{
+		ScriptID:  scriptID,
+		Timestamp: ts,
+		Result: &metadatapb.RecordExecutionResultRequest_Error{
+			Error: scriptErr,
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	select {
+	case msg := <-errCh:
+		v2cMsg := &cvmsgspb.V2CMessage{}
+		err := proto.Unmarshal(msg.Data, v2cMsg)
+		require.NoError(t, err)
+		execErr := &cvmsgspb.CronScriptExecutionError{}
+		err = types.UnmarshalAny(v2cMsg.Msg, execErr)
+		require.NoError(t, err)
+		assert.Equal(t, &cvmsgspb.CronScriptExecutionError{
+			ScriptID:     scriptID,
+			Timestamp:    ts,
+			ErrorMessage: "compilation failed",
+		}, execErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for execution error")
+	}
+}
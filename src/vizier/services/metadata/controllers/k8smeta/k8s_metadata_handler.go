@@ -97,6 +97,9 @@ type Store interface {
 	// FetchResourceUpdates gets the resource updates from the `from` update version, to the `to`
 	// update version (exclusive).
 	FetchResourceUpdates(topic string, from int64, to int64) ([]*storepb.K8SResourceUpdate, error)
+	// AddResourceHistory stores the version of the resource observed at the given time, so that it can be
+	// looked up as of a past time.
+	AddResourceHistory(observedAt time.Time, resource *storepb.K8SResource) error
 
 	// GetUpdateVersion gets the last update version sent on a topic.
 	GetUpdateVersion(topic string) (int64, error)
@@ -239,6 +242,11 @@ func (m *Handler) processUpdates() {
 				if err != nil {
 					log.WithError(err).Error("Failed to store resource update")
 				}
+
+				err = m.mds.AddResourceHistory(time.Now(), u)
+				if err != nil {
+					log.WithError(err).Error("Failed to store resource history")
+				}
 			}
 
 			// Send the update to the agents.
@@ -23,6 +23,7 @@ import (
 	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/nats-io/nats.go"
@@ -195,6 +196,10 @@ func (s *InMemoryStore) AddFullResourceUpdate(uv int64, r *storepb.K8SResource)
 	return nil
 }
 
+func (s *InMemoryStore) AddResourceHistory(observedAt time.Time, r *storepb.K8SResource) error {
+	return nil
+}
+
 func (s *InMemoryStore) FetchFullResourceUpdates(from int64, to int64) ([]*storepb.K8SResource, error) {
 	return nil, nil
 }
@@ -0,0 +1,331 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package k8smeta
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	"px.dev/pixie/src/shared/k8s/metadatapb"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/utils/datastore"
+)
+
+const (
+	resourceHistoryPrefix    = "/k8sHistory"
+	resourceHistoryCutoffKey = "/k8sHistoryCutoff"
+	resourceHistoryStartKey  = "/k8sHistoryStart"
+	// clusterScopedNamespace is used in the history keys in place of the namespace of cluster-scoped resources,
+	// such as nodes. It can't collide with a namespace, since namespace names are DNS labels.
+	clusterScopedNamespace = "_"
+)
+
+// ResourceKinds are the kinds of the resources that are tracked in the K8s metadata history.
+var ResourceKinds = []string{"pod", "service", "endpoints", "namespace", "node", "replicaset", "deployment"}
+
+// ErrHistoryUnavailable is an error indicating that the K8s metadata history doesn't go back to the requested time.
+var ErrHistoryUnavailable = errors.New("K8s metadata history is not retained for the requested time")
+
+// IsResourceKind returns whether the given kind is tracked in the K8s metadata history.
+func IsResourceKind(kind string) bool {
+	for _, k := range ResourceKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// getResourceKindAndMetadata returns the kind of the given resource along with its metadata, or an empty kind
+// if the resource isn't tracked in the history.
+func getResourceKindAndMetadata(resource *storepb.K8SResource) (string, *metadatapb.ObjectMetadata) {
+	switch r := resource.Resource.(type) {
+	case *storepb.K8SResource_Pod:
+		return "pod", r.Pod.GetMetadata()
+	case *storepb.K8SResource_Service:
+		return "service", r.Service.GetMetadata()
+	case *storepb.K8SResource_Endpoints:
+		return "endpoints", r.Endpoints.GetMetadata()
+	case *storepb.K8SResource_Namespace:
+		return "namespace", r.Namespace.GetMetadata()
+	case *storepb.K8SResource_Node:
+		return "node", r.Node.GetMetadata()
+	case *storepb.K8SResource_ReplicaSet:
+		return "replicaset", r.ReplicaSet.GetMetadata()
+	case *storepb.K8SResource_Deployment:
+		return "deployment", r.Deployment.GetMetadata()
+	default:
+		return "", nil
+	}
+}
+
+func getResourceHistoryKey(kind string, md *metadatapb.ObjectMetadata, observedAt time.Time) string {
+	namespace := md.Namespace
+	if namespace == "" {
+		namespace = clusterScopedNamespace
+	}
+	return path.Join(resourceHistoryPrefix, kind, namespace, md.Name, md.UID, fmt.Sprintf("%020d", observedAt.UnixNano()))
+}
+
+// getResourceHistoryPrefix returns the longest prefix of the history keys which matches the given filters.
+func getResourceHistoryPrefix(kind string, namespace string, name string) string {
+	if kind == "" {
+		return resourceHistoryPrefix + "/"
+	}
+	if namespace == "" {
+		if kind != "node" && kind != "namespace" {
+			return path.Join(resourceHistoryPrefix, kind) + "/"
+		}
+		namespace = clusterScopedNamespace
+	}
+	if name == "" {
+		return path.Join(resourceHistoryPrefix, kind, namespace) + "/"
+	}
+	return path.Join(resourceHistoryPrefix, kind, namespace, name) + "/"
+}
+
+// splitResourceHistoryKey splits a history key into the key of the resource, which is shared by all of its versions,
+// and the time at which the version was observed.
+func splitResourceHistoryKey(key string) (string, int64, error) {
+	idx := strings.LastIndex(key, "/")
+	if idx < 0 || len(strings.Split(key, "/")) != 7 {
+		return "", 0, errors.New("Invalid key")
+	}
+	observedAt, err := strconv.ParseInt(key[idx+1:], 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return key[:idx], observedAt, nil
+}
+
+// AddResourceHistory stores the version of the resource observed at the given time in the K8s metadata history.
+// Resources which aren't tracked in the history are ignored.
+func (m *Datastore) AddResourceHistory(observedAt time.Time, resource *storepb.K8SResource) error {
+	kind, md := getResourceKindAndMetadata(resource)
+	if kind == "" || md == nil {
+		return nil
+	}
+	val, err := resource.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := m.recordResourceHistoryStart(observedAt); err != nil {
+		return err
+	}
+	// The history is retained by CompactResourceHistory rather than TTLs, since the last version of a
+	// resource that hasn't changed in a while is still needed to look it up.
+	return m.ds.Set(getResourceHistoryKey(kind, md, observedAt), string(val))
+}
+
+// recordResourceHistoryStart records the time at which the first version in the history was observed, unless it's
+// already recorded. The resources are only known as of that time.
+func (m *Datastore) recordResourceHistoryStart(observedAt time.Time) error {
+	if atomic.LoadInt32(&m.historyStarted) == 1 {
+		return nil
+	}
+	_, err := m.ds.Txn(
+		[]datastore.Cmp{{Key: resourceHistoryStartKey}},
+		[]datastore.Op{datastore.OpSet(resourceHistoryStartKey, strconv.FormatInt(observedAt.UnixNano(), 10))},
+	)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&m.historyStarted, 1)
+	return nil
+}
+
+// resourceVersions are the versions of a resource in the history, in the order that they were observed.
+type resourceVersions struct {
+	keys       []string
+	observedAt []int64
+	vals       [][]byte
+}
+
+// scanResourceVersions calls fn with the versions of each resource with the given prefix, in key order. The history
+// is scanned a page at a time, and only the versions of one resource are held in memory at once.
+func (m *Datastore) scanResourceVersions(prefix string, fn func(r *resourceVersions) error) error {
+	var curr *resourceVersions
+	currResourceKey := ""
+	var fnErr error
+	// The prefixes end with a "/", so the range ends right after it.
+	end := prefix[:len(prefix)-1] + string(prefix[len(prefix)-1]+1)
+	err := m.ds.ScanRange(prefix, end, false, func(key string, val []byte) bool {
+		resourceKey, observedAt, err := splitResourceHistoryKey(key)
+		if err != nil { // Malformed key, skip it.
+			return true
+		}
+		// The versions of a resource have consecutive keys, which are ordered by the time that they were observed.
+		if curr != nil && resourceKey != currResourceKey {
+			if fnErr = fn(curr); fnErr != nil {
+				return false
+			}
+			curr = nil
+		}
+		if curr == nil {
+			curr = &resourceVersions{}
+			currResourceKey = resourceKey
+		}
+		curr.keys = append(curr.keys, key)
+		curr.observedAt = append(curr.observedAt, observedAt)
+		// The value may be reused by the datastore once the callback returns.
+		curr.vals = append(curr.vals, append([]byte(nil), val...))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+	if curr != nil {
+		return fn(curr)
+	}
+	return nil
+}
+
+// getResourceHistoryInt gets the time stored in the given key, or 0 if it isn't set.
+func (m *Datastore) getResourceHistoryInt(key string) (int64, error) {
+	val, err := m.ds.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if string(val) == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(val), 10, 64)
+}
+
+func (m *Datastore) getResourceHistoryCutoff() (int64, error) {
+	return m.getResourceHistoryInt(resourceHistoryCutoffKey)
+}
+
+// GetResourcesAsOf gets the resources with the given kind, namespace and name which existed at the given time,
+// in the state that they were in at that time. Empty filters match all resources. Returns ErrHistoryUnavailable
+// if the time is before the first version in the history was observed, or before the history was compacted.
+func (m *Datastore) GetResourcesAsOf(asOf time.Time, kind string, namespace string, name string) ([]*storepb.K8SResource, error) {
+	start, err := m.getResourceHistoryInt(resourceHistoryStartKey)
+	if err != nil {
+		return nil, err
+	}
+	cutoff, err := m.getResourceHistoryCutoff()
+	if err != nil {
+		return nil, err
+	}
+	asOfNS := asOf.UnixNano()
+	if start == 0 || asOfNS < start || asOfNS < cutoff {
+		return nil, ErrHistoryUnavailable
+	}
+
+	var matches []*storepb.K8SResource
+	err = m.scanResourceVersions(getResourceHistoryPrefix(kind, namespace, name), func(r *resourceVersions) error {
+		// Find the last version observed at or before the requested time.
+		idx := -1
+		for i, observedAt := range r.observedAt {
+			if observedAt > asOfNS {
+				break
+			}
+			idx = i
+		}
+		if idx < 0 {
+			return nil
+		}
+
+		resource := &storepb.K8SResource{}
+		if err := proto.Unmarshal(r.vals[idx], resource); err != nil {
+			return nil
+		}
+		_, md := getResourceKindAndMetadata(resource)
+		if md == nil || (namespace != "" && md.Namespace != namespace) || (name != "" && md.Name != name) {
+			return nil
+		}
+		if md.CreationTimestampNS > asOfNS || (md.DeletionTimestampNS != 0 && md.DeletionTimestampNS <= asOfNS) {
+			return nil
+		}
+		matches = append(matches, resource)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// CompactResourceHistory deletes the versions of resources that aren't needed to look up resources as of the
+// cutoff time or later. Resources are then no longer available as of earlier times.
+func (m *Datastore) CompactResourceHistory(cutoff time.Time) error {
+	cutoffNS := cutoff.UnixNano()
+
+	// Only the keys to delete are kept, which are deleted once the scan is done.
+	var delKeys []string
+	err := m.scanResourceVersions(resourceHistoryPrefix+"/", func(r *resourceVersions) error {
+		// Find the last version observed at or before the cutoff, which is the state of the resource at the cutoff.
+		idx := -1
+		for i, observedAt := range r.observedAt {
+			if observedAt > cutoffNS {
+				break
+			}
+			idx = i
+		}
+		if idx < 0 {
+			return nil
+		}
+		// All of the earlier versions are no longer needed.
+		delKeys = append(delKeys, r.keys[:idx]...)
+
+		// Neither is the state at the cutoff, if the resource was deleted by then.
+		resource := &storepb.K8SResource{}
+		if err := proto.Unmarshal(r.vals[idx], resource); err != nil {
+			delKeys = append(delKeys, r.keys[idx])
+			return nil
+		}
+		_, md := getResourceKindAndMetadata(resource)
+		if md == nil || (md.DeletionTimestampNS != 0 && md.DeletionTimestampNS <= cutoffNS) {
+			delKeys = append(delKeys, r.keys[idx])
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Record the cutoff first, so that lookups before it fail rather than return partial results.
+	prevCutoff, err := m.getResourceHistoryCutoff()
+	if err != nil {
+		return err
+	}
+	if cutoffNS > prevCutoff {
+		err = m.ds.Set(resourceHistoryCutoffKey, strconv.FormatInt(cutoffNS, 10))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(delKeys) == 0 {
+		return nil
+	}
+	return m.ds.DeleteAll(delKeys)
+}
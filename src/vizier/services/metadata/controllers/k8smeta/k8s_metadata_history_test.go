@@ -0,0 +1,216 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package k8smeta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/shared/k8s/metadatapb"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+)
+
+func makeHistoryPod(name string, uid string, nodeName string, createdAt int64, deletedAt int64) *storepb.K8SResource {
+	return &storepb.K8SResource{
+		Resource: &storepb.K8SResource_Pod{
+			Pod: &metadatapb.Pod{
+				Metadata: &metadatapb.ObjectMetadata{
+					Name:                name,
+					Namespace:           "ns",
+					UID:                 uid,
+					CreationTimestampNS: createdAt,
+					DeletionTimestampNS: deletedAt,
+				},
+				Spec: &metadatapb.PodSpec{
+					NodeName: nodeName,
+				},
+			},
+		},
+	}
+}
+
+func makeHistoryNode(name string, createdAt int64) *storepb.K8SResource {
+	return &storepb.K8SResource{
+		Resource: &storepb.K8SResource_Node{
+			Node: &metadatapb.Node{
+				Metadata: &metadatapb.ObjectMetadata{
+					Name:                name,
+					UID:                 name + "_uid",
+					CreationTimestampNS: createdAt,
+				},
+			},
+		},
+	}
+}
+
+func setupHistoryTest(t *testing.T, mds *Datastore) {
+	history := []struct {
+		observedAt int64
+		resource   *storepb.K8SResource
+	}{
+		{10, makeHistoryNode("node1", 5)},
+		{10, makeHistoryPod("pod1", "pod1_uid", "", 10, 0)},
+		{20, makeHistoryPod("pod1", "pod1_uid", "node1", 10, 0)},
+		{30, makeHistoryPod("pod2", "pod2_uid", "node1", 30, 0)},
+		{40, makeHistoryPod("pod1", "pod1_uid", "node1", 10, 40)},
+		// A pod recreated with the same name.
+		{50, makeHistoryPod("pod1", "pod1_uid2", "node1", 50, 0)},
+		// Containers aren't tracked in the history.
+		{50, &storepb.K8SResource{Resource: &storepb.K8SResource_Container{Container: &metadatapb.ContainerUpdate{Name: "c"}}}},
+	}
+	for _, h := range history {
+		err := mds.AddResourceHistory(time.Unix(0, h.observedAt), h.resource)
+		require.NoError(t, err)
+	}
+}
+
+func TestDatastore_GetResourcesAsOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		asOf      int64
+		kind      string
+		namespace string
+		resName   string
+		expected  []*storepb.K8SResource
+	}{
+		{
+			name:      "before creation",
+			asOf:      25,
+			kind:      "pod",
+			namespace: "ns",
+			resName:   "pod2",
+			expected:  nil,
+		},
+		{
+			name: "all kinds",
+			asOf: 15,
+			expected: []*storepb.K8SResource{
+				makeHistoryNode("node1", 5),
+				makeHistoryPod("pod1", "pod1_uid", "", 10, 0),
+			},
+		},
+		{
+			name:     "pods",
+			asOf:     35,
+			kind:     "pod",
+			expected: []*storepb.K8SResource{makeHistoryPod("pod1", "pod1_uid", "node1", 10, 0), makeHistoryPod("pod2", "pod2_uid", "node1", 30, 0)},
+		},
+		{
+			name:      "pod by name",
+			asOf:      35,
+			kind:      "pod",
+			namespace: "ns",
+			resName:   "pod1",
+			expected:  []*storepb.K8SResource{makeHistoryPod("pod1", "pod1_uid", "node1", 10, 0)},
+		},
+		{
+			name:     "pod by name without namespace",
+			asOf:     25,
+			kind:     "pod",
+			resName:  "pod1",
+			expected: []*storepb.K8SResource{makeHistoryPod("pod1", "pod1_uid", "node1", 10, 0)},
+		},
+		{
+			name:      "deleted pod",
+			asOf:      45,
+			kind:      "pod",
+			namespace: "ns",
+			resName:   "pod1",
+			expected:  nil,
+		},
+		{
+			name:      "recreated pod",
+			asOf:      55,
+			kind:      "pod",
+			namespace: "ns",
+			resName:   "pod1",
+			expected:  []*storepb.K8SResource{makeHistoryPod("pod1", "pod1_uid2", "node1", 50, 0)},
+		},
+		{
+			name:     "cluster-scoped",
+			asOf:     55,
+			kind:     "node",
+			resName:  "node1",
+			expected: []*storepb.K8SResource{makeHistoryNode("node1", 5)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, mds, cleanup := setupMDSTest(t)
+			defer cleanup()
+			setupHistoryTest(t, mds)
+
+			resources, err := mds.GetResourcesAsOf(time.Unix(0, test.asOf), test.kind, test.namespace, test.resName)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.expected, resources)
+		})
+	}
+}
+
+func TestDatastore_GetResourcesAsOfBeforeHistoryStart(t *testing.T) {
+	_, mds, cleanup := setupMDSTest(t)
+	defer cleanup()
+
+	_, err := mds.GetResourcesAsOf(time.Unix(0, 10), "", "", "")
+	assert.Equal(t, ErrHistoryUnavailable, err)
+
+	setupHistoryTest(t, mds)
+
+	// The resources are only known as of the first version in the history.
+	_, err = mds.GetResourcesAsOf(time.Unix(0, 5), "", "", "")
+	assert.Equal(t, ErrHistoryUnavailable, err)
+	resources, err := mds.GetResourcesAsOf(time.Unix(0, 10), "node", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, []*storepb.K8SResource{makeHistoryNode("node1", 5)}, resources)
+}
+
+func TestDatastore_CompactResourceHistory(t *testing.T) {
+	db, mds, cleanup := setupMDSTest(t)
+	defer cleanup()
+	setupHistoryTest(t, mds)
+
+	err := mds.CompactResourceHistory(time.Unix(0, 45))
+	require.NoError(t, err)
+
+	// Only the versions still needed as of the cutoff or later are kept.
+	keys, _, err := db.GetWithPrefix(resourceHistoryPrefix + "/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/k8sHistory/node/_/node1/node1_uid/00000000000000000010",
+		"/k8sHistory/pod/ns/pod1/pod1_uid2/00000000000000000050",
+		"/k8sHistory/pod/ns/pod2/pod2_uid/00000000000000000030",
+	}, keys)
+
+	resources, err := mds.GetResourcesAsOf(time.Unix(0, 45), "pod", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, []*storepb.K8SResource{makeHistoryPod("pod2", "pod2_uid", "node1", 30, 0)}, resources)
+
+	_, err = mds.GetResourcesAsOf(time.Unix(0, 35), "pod", "", "")
+	assert.Equal(t, ErrHistoryUnavailable, err)
+
+	// An earlier cutoff doesn't make the history available again.
+	err = mds.CompactResourceHistory(time.Unix(0, 20))
+	require.NoError(t, err)
+	_, err = mds.GetResourcesAsOf(time.Unix(0, 35), "pod", "", "")
+	assert.Equal(t, ErrHistoryUnavailable, err)
+}
@@ -42,11 +42,13 @@ const (
 // Datastore implements the Store interface on a given Datastore.
 type Datastore struct {
 	ds datastore.MultiGetterSetterDeleterCloser
+	// Set once the start of the K8s metadata history is known to be recorded.
+	historyStarted int32
 }
 
 // NewDatastore wraps the datastore in a metadata store.
 func NewDatastore(ds datastore.MultiGetterSetterDeleterCloser) *Datastore {
-	return &Datastore{ds}
+	return &Datastore{ds: ds}
 }
 
 func getFullResourceUpdateKey(version int64) string {
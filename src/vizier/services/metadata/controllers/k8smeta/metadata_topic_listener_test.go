@@ -21,6 +21,7 @@ package k8smeta
 import (
 	"math"
 	"testing"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/nats-io/nats.go"
@@ -75,6 +76,10 @@ func (s *FakeStore) SetUpdateVersion(topic string, uv int64) error {
 	return nil
 }
 
+func (s *FakeStore) AddResourceHistory(observedAt time.Time, r *storepb.K8SResource) error {
+	return nil
+}
+
 func (s *FakeStore) FetchFullResourceUpdates(from int64, to int64) ([]*storepb.K8SResource, error) {
 	return nil, nil
 }
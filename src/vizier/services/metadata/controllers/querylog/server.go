@@ -0,0 +1,78 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package querylog
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+)
+
+// Store is a datastore which can record and retrieve the queries executed in Vizier.
+type Store interface {
+	RecordQuery(entry *vizierpb.QueryLogEntry) error
+	GetQueryLog(since time.Time, filter func(*vizierpb.QueryLogEntry) bool, limit int) ([]*vizierpb.QueryLogEntry, error)
+}
+
+// Server is an implementation of the query log service.
+type Server struct {
+	ds Store
+}
+
+// New creates a new server.
+func New(ds Store) *Server {
+	return &Server{ds: ds}
+}
+
+// RecordQuery adds a query to the query log.
+func (s *Server) RecordQuery(ctx context.Context, req *metadatapb.RecordQueryRequest) (*metadatapb.RecordQueryResponse, error) {
+	if req.Entry == nil {
+		return &metadatapb.RecordQueryResponse{}, nil
+	}
+	if err := s.ds.RecordQuery(req.Entry); err != nil {
+		return nil, err
+	}
+	return &metadatapb.RecordQueryResponse{}, nil
+}
+
+// GetQueryLog returns the queries in the query log that match the request. Entries are only returned for a
+// single user, so the caller must set the user whose queries are read.
+func (s *Server) GetQueryLog(ctx context.Context, req *vizierpb.GetQueryLogRequest) (*vizierpb.GetQueryLogResponse, error) {
+	if req.User == "" {
+		return nil, status.Error(codes.InvalidArgument, "the user whose queries are read must be set")
+	}
+	var since time.Time
+	if req.SinceTimestampNS > 0 {
+		since = time.Unix(0, req.SinceTimestampNS)
+	}
+	filter := func(e *vizierpb.QueryLogEntry) bool {
+		return e.User == req.User && (!req.SlowOnly || e.Slow)
+	}
+	// The limit keeps the most recent entries.
+	entries, err := s.ds.GetQueryLog(since, filter, int(req.Limit))
+	if err != nil {
+		return nil, err
+	}
+	return &vizierpb.GetQueryLogResponse{Entries: entries}, nil
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package querylog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/querylog"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
+)
+
+func setupServer(t *testing.T) (*querylog.Server, func()) {
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+
+	db := pebbledb.New(c, 3*time.Second)
+	s := querylog.New(querylog.NewDatastore(db, time.Hour))
+	return s, func() {
+		require.NoError(t, db.Close())
+	}
+}
+
+func TestServer_GetQueryLog(t *testing.T) {
+	s, cleanup := setupServer(t)
+	defer cleanup()
+
+	entries := []*vizierpb.QueryLogEntry{
+		{
+			QueryID:          "11285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+			User:             "a@example.com",
+			StartTimestampNS: 1000,
+		},
+		{
+			QueryID:          "21285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+			User:             "b@example.com",
+			StartTimestampNS: 2000,
+			Slow:             true,
+		},
+		{
+			QueryID:          "31285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+			User:             "a@example.com",
+			StartTimestampNS: 3000,
+			Slow:             true,
+		},
+		{
+			QueryID:          "41285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+			User:             "a@example.com",
+			StartTimestampNS: 4000,
+		},
+	}
+	for _, e := range entries {
+		_, err := s.RecordQuery(context.Background(), &metadatapb.RecordQueryRequest{Entry: e})
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		req      *vizierpb.GetQueryLogRequest
+		expected []*vizierpb.QueryLogEntry
+	}{
+		{
+			name:     "user",
+			req:      &vizierpb.GetQueryLogRequest{User: "a@example.com"},
+			expected: []*vizierpb.QueryLogEntry{entries[0], entries[2], entries[3]},
+		},
+		{
+			name:     "since",
+			req:      &vizierpb.GetQueryLogRequest{User: "a@example.com", SinceTimestampNS: 2500},
+			expected: entries[2:],
+		},
+		{
+			name:     "slow only",
+			req:      &vizierpb.GetQueryLogRequest{User: "b@example.com", SlowOnly: true},
+			expected: []*vizierpb.QueryLogEntry{entries[1]},
+		},
+		{
+			name:     "limit keeps most recent",
+			req:      &vizierpb.GetQueryLogRequest{User: "a@example.com", Limit: 2},
+			expected: []*vizierpb.QueryLogEntry{entries[2], entries[3]},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := s.GetQueryLog(context.Background(), test.req)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, resp.Entries)
+		})
+	}
+}
+
+func TestServer_GetQueryLogRequiresUser(t *testing.T) {
+	s, cleanup := setupServer(t)
+	defer cleanup()
+
+	_, err := s.GetQueryLog(context.Background(), &vizierpb.GetQueryLogRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package querylog
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/vizier/utils/datastore"
+)
+
+const (
+	queryLogPrefix = "/queryLog/"
+	// Sorts after all of the zero padded start times, so it bounds the range of the query log.
+	queryLogEnd = queryLogPrefix + "~"
+)
+
+// Datastore implements the Store interface on a given Datastore.
+type Datastore struct {
+	ds        datastore.MultiGetterSetterDeleterCloser
+	retention time.Duration
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewDatastore wraps the datastore in a query log store. Entries are purged once they are older than the retention.
+func NewDatastore(ds datastore.MultiGetterSetterDeleterCloser, retention time.Duration) *Datastore {
+	return &Datastore{ds: ds, retention: retention, done: make(chan struct{})}
+}
+
+// The Schema for the query log:
+// all entries:      /queryLog/
+// specific entry:   /queryLog/<start time ns>/<query id>
+//
+// The start times are zero padded, so that the entries are sorted by the time the query started.
+func getQueryLogTimeKey(startTimestampNS int64) string {
+	return path.Join(queryLogPrefix, fmt.Sprintf("%020d", startTimestampNS))
+}
+
+func getQueryLogEntryKey(entry *vizierpb.QueryLogEntry) string {
+	return path.Join(getQueryLogTimeKey(entry.StartTimestampNS), entry.QueryID)
+}
+
+// StartPurge periodically deletes the entries that are older than the retention, while this instance is the leader.
+// Since the entries are sorted by start time, the expired entries are deleted as a single range.
+func (t *Datastore) StartPurge(interval time.Duration, isLeader *bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+				if !*isLeader {
+					continue
+				}
+				if err := t.PurgeExpired(time.Now()); err != nil {
+					log.WithError(err).Error("Failed to purge expired query log entries")
+				}
+			}
+		}
+	}()
+}
+
+// Close stops purging expired entries.
+func (t *Datastore) Close() {
+	t.once.Do(func() {
+		close(t.done)
+	})
+}
+
+// PurgeExpired deletes the entries of the queries that started before the retention, relative to now.
+func (t *Datastore) PurgeExpired(now time.Time) error {
+	return t.ds.DeleteWithRange(queryLogPrefix, getQueryLogTimeKey(now.Add(-t.retention).UnixNano()))
+}
+
+// RecordQuery adds the query to the log.
+func (t *Datastore) RecordQuery(entry *vizierpb.QueryLogEntry) error {
+	val, err := entry.Marshal()
+	if err != nil {
+		return err
+	}
+	return t.ds.Set(getQueryLogEntryKey(entry), string(val))
+}
+
+// GetQueryLog returns the most recent logged queries that started at or after the given time and match the filter,
+// ordered by start time. A limit of 0 returns all of the matching queries. The log is scanned from the most recent
+// entry, and the scan stops once the limit is reached.
+func (t *Datastore) GetQueryLog(since time.Time, filter func(*vizierpb.QueryLogEntry) bool, limit int) ([]*vizierpb.QueryLogEntry, error) {
+	from := queryLogPrefix
+	if !since.IsZero() {
+		from = getQueryLogTimeKey(since.UnixNano())
+	}
+
+	var entries []*vizierpb.QueryLogEntry
+	err := t.ds.ScanRange(from, queryLogEnd, true, func(_ string, val []byte) bool {
+		pb := &vizierpb.QueryLogEntry{}
+		if err := proto.Unmarshal(val, pb); err != nil {
+			log.WithError(err).Error("Failed to unmarshal query log entry")
+			return true
+		}
+		if filter != nil && !filter(pb) {
+			return true
+		}
+		entries = append(entries, pb)
+		return limit <= 0 || len(entries) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The entries were scanned from the most recent one.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
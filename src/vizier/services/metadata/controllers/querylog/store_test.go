@@ -0,0 +1,142 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package querylog
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
+)
+
+func setupTest(t *testing.T) (*pebbledb.DataStore, *Datastore, func()) {
+	memFS := vfs.NewMem()
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: memFS,
+	})
+	if err != nil {
+		t.Fatal("failed to initialize a pebbledb")
+		os.Exit(1)
+	}
+
+	db := pebbledb.New(c, 3*time.Second)
+	ds := NewDatastore(db, time.Hour)
+	cleanup := func() {
+		err := db.Close()
+		if err != nil {
+			t.Fatal("Failed to close db")
+		}
+	}
+
+	return db, ds, cleanup
+}
+
+func TestStore_RecordQuery(t *testing.T) {
+	db, ds, cleanup := setupTest(t)
+	defer cleanup()
+
+	entry := &vizierpb.QueryLogEntry{
+		QueryID:          "11285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+		QueryName:        "px/cluster",
+		User:             "user@example.com",
+		StartTimestampNS: 1000,
+		DurationNS:       2000,
+	}
+	err := ds.RecordQuery(entry)
+	require.NoError(t, err)
+
+	savedEntry, err := db.Get("/queryLog/00000000000000001000/11285cdd-1de9-4ab1-ae6a-0ba08c8c676c")
+	require.NoError(t, err)
+	savedEntryPb := &vizierpb.QueryLogEntry{}
+	err = proto.Unmarshal(savedEntry, savedEntryPb)
+	require.NoError(t, err)
+	assert.Equal(t, entry, savedEntryPb)
+}
+
+func TestStore_GetQueryLog(t *testing.T) {
+	_, ds, cleanup := setupTest(t)
+	defer cleanup()
+
+	entries := []*vizierpb.QueryLogEntry{
+		{
+			QueryID:          "31285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+			StartTimestampNS: 3000,
+		},
+		{
+			QueryID:          "11285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+			StartTimestampNS: 1000,
+		},
+		{
+			QueryID:          "21285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+			StartTimestampNS: 20000,
+		},
+	}
+	for _, e := range entries {
+		require.NoError(t, ds.RecordQuery(e))
+	}
+
+	all, err := ds.GetQueryLog(time.Time{}, nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []*vizierpb.QueryLogEntry{entries[1], entries[0], entries[2]}, all)
+
+	recent, err := ds.GetQueryLog(time.Unix(0, 3000), nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []*vizierpb.QueryLogEntry{entries[0], entries[2]}, recent)
+
+	// The limit keeps the most recent entries that match the filter.
+	filtered, err := ds.GetQueryLog(time.Time{}, func(e *vizierpb.QueryLogEntry) bool {
+		return e.StartTimestampNS != 20000
+	}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []*vizierpb.QueryLogEntry{entries[0]}, filtered)
+}
+
+func TestStore_PurgeExpired(t *testing.T) {
+	db, ds, cleanup := setupTest(t)
+	defer cleanup()
+
+	now := time.Unix(0, 0).Add(2 * time.Hour)
+	old := &vizierpb.QueryLogEntry{
+		QueryID:          "11285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+		StartTimestampNS: now.Add(-90 * time.Minute).UnixNano(),
+	}
+	recent := &vizierpb.QueryLogEntry{
+		QueryID:          "21285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+		StartTimestampNS: now.Add(-30 * time.Minute).UnixNano(),
+	}
+	require.NoError(t, ds.RecordQuery(old))
+	require.NoError(t, ds.RecordQuery(recent))
+	// Entries are recorded without a TTL, they are purged by start time instead.
+	ttlKeys, _, err := db.GetWithPrefix("___ttl")
+	require.NoError(t, err)
+	assert.Empty(t, ttlKeys)
+
+	require.NoError(t, ds.PurgeExpired(now))
+	entries, err := ds.GetQueryLog(time.Time{}, nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []*vizierpb.QueryLogEntry{recent}, entries)
+}
@@ -40,6 +40,8 @@ import (
 	"px.dev/pixie/src/table_store/schemapb"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/agent"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/agentconfig"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/k8smeta"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
 	"px.dev/pixie/src/vizier/services/metadata/metadataenv"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
@@ -58,6 +60,10 @@ type Server struct {
 	ds     datastore.MultiGetterSetterDeleterCloser
 	agtMgr agent.Manager
 	tpMgr  *tracepoint.Manager
+	cfgMgr *agentconfig.Manager
+	k8sMds *k8smeta.Datastore
+	// The lifecycle events of the agents, for GetAgentEvents. nil if agent events aren't available.
+	agentEvents *AgentEventBroadcaster
 	// The current cursor that is actively running the GetAgentsUpdate stream. Only one GetAgentsUpdate
 	// stream should be running at a time.
 	getAgentsCursor uuid.UUID
@@ -65,12 +71,16 @@ type Server struct {
 }
 
 // NewServer creates GRPC handlers.
-func NewServer(env metadataenv.MetadataEnv, ds datastore.MultiGetterSetterDeleterCloser, agtMgr agent.Manager, tpMgr *tracepoint.Manager) *Server {
+func NewServer(env metadataenv.MetadataEnv, ds datastore.MultiGetterSetterDeleterCloser, agtMgr agent.Manager, tpMgr *tracepoint.Manager,
+	cfgMgr *agentconfig.Manager, agentEvents *AgentEventBroadcaster) *Server {
 	return &Server{
-		env:    env,
-		ds:     ds,
-		agtMgr: agtMgr,
-		tpMgr:  tpMgr,
+		env:         env,
+		ds:          ds,
+		agtMgr:      agtMgr,
+		tpMgr:       tpMgr,
+		cfgMgr:      cfgMgr,
+		k8sMds:      k8smeta.NewDatastore(ds),
+		agentEvents: agentEvents,
 	}
 }
 
@@ -346,17 +356,103 @@ func (s *Server) GetWithPrefixKey(ctx context.Context, req *metadatapb.WithPrefi
 	return resp, nil
 }
 
-// RegisterTracepoint is a request to register the tracepoints specified in the TracepointDeployment on all agents.
+// GetK8SResourcesAsOf gets the K8s resources matching the request as they were at the requested time.
+func (s *Server) GetK8SResourcesAsOf(ctx context.Context, req *metadatapb.K8SResourcesAsOfRequest) (*metadatapb.K8SResourcesAsOfResponse, error) {
+	if req.AsOf == nil {
+		return nil, status.Error(codes.InvalidArgument, "as_of must be specified")
+	}
+	asOf, err := types.TimestampFromProto(req.AsOf)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.Kind != "" && !k8smeta.IsResourceKind(req.Kind) {
+		return nil, status.Errorf(codes.InvalidArgument, "Unknown kind %q, must be one of %s", req.Kind, strings.Join(k8smeta.ResourceKinds, ", "))
+	}
+
+	resources, err := s.k8sMds.GetResourcesAsOf(asOf, req.Kind, req.Namespace, req.Name)
+	if err == k8smeta.ErrHistoryUnavailable {
+		return nil, status.Error(codes.OutOfRange, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &metadatapb.K8SResourcesAsOfResponse{
+		Resources: resources,
+	}, nil
+}
+
+// GetAgentEvents streams the lifecycle events of the agents as they happen, until the client closes the stream.
+func (s *Server) GetAgentEvents(req *metadatapb.AgentEventsRequest, srv metadatapb.MetadataService_GetAgentEventsServer) error {
+	if s.agentEvents == nil {
+		return status.Error(codes.Unimplemented, "Agent events are not available")
+	}
+	eventTypes := make(map[metadatapb.AgentEventType]bool, len(req.Types))
+	for _, t := range req.Types {
+		eventTypes[t] = true
+	}
+
+	events, unsubscribe := s.agentEvents.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-srv.Context().Done():
+			log.Infof("Client closed context for GetAgentEvents")
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "Client fell too far behind the agent events")
+			}
+			if len(eventTypes) > 0 && !eventTypes[event.Type] {
+				continue
+			}
+			err := srv.Send(&metadatapb.AgentEventsResponse{
+				Events: []*metadatapb.AgentEvent{event},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RegisterTracepoint is a request to register the tracepoints specified in the TracepointDeployment on the agents
+// matching their agent selector, or on all agents if they have none.
 func (s *Server) RegisterTracepoint(ctx context.Context, req *metadatapb.RegisterTracepointRequest) (*metadatapb.RegisterTracepointResponse, error) {
 	responses := make([]*metadatapb.RegisterTracepointResponse_TracepointStatus, len(req.Requests))
 
+	// The tracepoints of the custom resources are removed once their resource is deleted, so their names can't be used.
+	for _, tp := range req.Requests {
+		if strings.HasPrefix(tp.Name, tracepoint.CRDTracepointPrefix) {
+			return nil, status.Errorf(codes.InvalidArgument, "tracepoint names starting with %q are reserved for Tracepoint custom resources",
+				tracepoint.CRDTracepointPrefix)
+		}
+	}
+
+	// Get all agents currently running.
+	agents, err := s.agtMgr.GetActiveAgents()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create tracepoint.
 	for i, tp := range req.Requests {
 		ttl, err := types.DurationFromProto(tp.TTL)
 		if err != nil {
 			return nil, err
 		}
-		tracepointID, err := s.tpMgr.CreateTracepoint(tp.Name, tp.TracepointDeployment, ttl)
+		// A tracepoint without a TTL never expires. Only the Tracepoint custom resources, which remove their
+		// tracepoints once deleted, deploy those.
+		if ttl <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "TTL must be positive")
+		}
+		agentIDs, err := s.tpMgr.SelectAgents(tp.AgentSelector, agents)
+		if err == tracepoint.ErrAgentSelectorUnsupported {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if err != nil {
+			return nil, err
+		}
+		tracepointID, err := s.tpMgr.CreateTracepoint(tp.Name, tp.TracepointDeployment, tp.AgentSelector, ttl)
 		if err != nil && err != tracepoint.ErrTracepointAlreadyExists {
 			return nil, err
 		}
@@ -379,17 +475,7 @@ func (s *Server) RegisterTracepoint(ctx context.Context, req *metadatapb.Registe
 			Name: tp.Name,
 		}
 
-		// Get all agents currently running.
-		agents, err := s.agtMgr.GetActiveAgents()
-		if err != nil {
-			return nil, err
-		}
-		agentIDs := make([]uuid.UUID, len(agents))
-		for i, agt := range agents {
-			agentIDs[i] = utils.UUIDFromProtoOrNil(agt.Info.AgentID)
-		}
-
-		// Register tracepoint on all agents.
+		// Register tracepoint on the selected agents.
 		err = s.tpMgr.RegisterTracepoint(agentIDs, *tracepointID, tp.TracepointDeployment)
 		if err != nil {
 			return nil, err
@@ -519,6 +605,9 @@ func getTracepointStateFromAgentTracepointStates(agentStates []*storepb.AgentTra
 // RemoveTracepoint is a request to evict the given tracepoint on all agents.
 func (s *Server) RemoveTracepoint(ctx context.Context, req *metadatapb.RemoveTracepointRequest) (*metadatapb.RemoveTracepointResponse, error) {
 	err := s.tpMgr.RemoveTracepoints(req.Names)
+	if errors.Is(err, tracepoint.ErrTracepointNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -530,6 +619,89 @@ func (s *Server) RemoveTracepoint(ctx context.Context, req *metadatapb.RemoveTra
 	}, nil
 }
 
+// ListTracepoints lists the tracepoints with the given names, or all tracepoints if no names are given,
+// along with the state of the tracepoint on each agent.
+func (s *Server) ListTracepoints(ctx context.Context, req *metadatapb.ListTracepointsRequest) (*metadatapb.ListTracepointsResponse, error) {
+	var tracepointInfos []*storepb.TracepointInfo
+	var err error
+	if len(req.Names) > 0 {
+		tracepointInfos, err = s.tpMgr.GetTracepointsWithNames(req.Names)
+	} else {
+		tracepointInfos, err = s.tpMgr.GetAllTracepoints()
+	}
+	if errors.Is(err, tracepoint.ErrTracepointNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expiries, err := s.tpMgr.GetTracepointExpiries()
+	if err != nil {
+		return nil, err
+	}
+
+	tracepoints := make([]*metadatapb.ListTracepointsResponse_Tracepoint, 0, len(tracepointInfos))
+	for _, tp := range tracepointInfos {
+		if tp == nil {
+			continue
+		}
+		tUUID := utils.UUIDFromProtoOrNil(tp.ID)
+
+		agentStates, err := s.tpMgr.GetTracepointStates(tUUID)
+		if err != nil {
+			return nil, err
+		}
+
+		var expiresAt *types.Timestamp
+		// Tracepoints that never expire have a zero expiry.
+		if expiry, ok := expiries[tUUID]; ok && !expiry.IsZero() {
+			expiresAt, err = types.TimestampProto(expiry)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		state, _ := getTracepointStateFromAgentTracepointStates(agentStates)
+
+		tracepoints = append(tracepoints, &metadatapb.ListTracepointsResponse_Tracepoint{
+			Info:          tp,
+			AgentStatuses: agentStates,
+			ExpiresAt:     expiresAt,
+			State:         state,
+		})
+	}
+
+	return &metadatapb.ListTracepointsResponse{
+		Tracepoints: tracepoints,
+	}, nil
+}
+
+// SetTracepointTTL replaces the TTL of the given tracepoint, so that it is kept running without redeploying it.
+func (s *Server) SetTracepointTTL(ctx context.Context, req *metadatapb.SetTracepointTTLRequest) (*metadatapb.SetTracepointTTLResponse, error) {
+	ttl, err := types.DurationFromProto(req.TTL)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if ttl <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "TTL must be positive")
+	}
+
+	err = s.tpMgr.SetTracepointTTL(req.Name, ttl)
+	if errors.Is(err, tracepoint.ErrTracepointNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadatapb.SetTracepointTTLResponse{
+		Status: &statuspb.Status{
+			ErrCode: statuspb.OK,
+		},
+	}, nil
+}
+
 // UpdateConfig updates the config for the specified agent.
 func (s *Server) UpdateConfig(ctx context.Context, req *metadatapb.UpdateConfigRequest) (*metadatapb.UpdateConfigResponse, error) {
 	splitName := strings.Split(req.AgentPodName, "/")
@@ -548,3 +720,74 @@ func (s *Server) UpdateConfig(ctx context.Context, req *metadatapb.UpdateConfigR
 		},
 	}, nil
 }
+
+// UpdateAgentsConfig rolls out a config setting to the PEMs matching the selector in batches, and streams the outcome
+// on the agents of each batch.
+func (s *Server) UpdateAgentsConfig(req *metadatapb.UpdateAgentsConfigRequest, srv metadatapb.MetadataConfigService_UpdateAgentsConfigServer) error {
+	if err := agentconfig.ValidateKey(req.Key); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.BatchSize < 0 {
+		return status.Error(codes.InvalidArgument, "Batch size must not be negative")
+	}
+	opts := &agentconfig.RolloutOptions{
+		BatchSize: int(req.BatchSize),
+		Persist:   req.Persist,
+	}
+	if req.VerifyTimeout != nil {
+		verifyTimeout, err := types.DurationFromProto(req.VerifyTimeout)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		opts.VerifyTimeout = verifyTimeout
+	}
+	setting := &storepb.AgentConfigSetting{
+		Key:           req.Key,
+		Value:         req.Value,
+		AgentSelector: req.AgentSelector,
+	}
+
+	persisted, err := s.cfgMgr.Rollout(srv.Context(), setting, opts, func(statuses []*metadatapb.AgentConfigStatus) error {
+		return srv.Send(&metadatapb.UpdateAgentsConfigResponse{
+			AgentStatuses: statuses,
+		})
+	})
+	if err == agentconfig.ErrNoAgentsSelected {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if err == tracepoint.ErrAgentSelectorUnsupported {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	return srv.Send(&metadatapb.UpdateAgentsConfigResponse{
+		Persisted: persisted,
+	})
+}
+
+// ListAgentConfigs lists the config settings that are applied to PEMs when they register.
+func (s *Server) ListAgentConfigs(ctx context.Context, req *metadatapb.ListAgentConfigsRequest) (*metadatapb.ListAgentConfigsResponse, error) {
+	settings, err := s.cfgMgr.ListAgentConfigs()
+	if err != nil {
+		return nil, err
+	}
+	return &metadatapb.ListAgentConfigsResponse{
+		Settings: settings,
+	}, nil
+}
+
+// DeleteAgentConfig deletes the stored config setting with the given key and selector.
+func (s *Server) DeleteAgentConfig(ctx context.Context, req *metadatapb.DeleteAgentConfigRequest) (*metadatapb.DeleteAgentConfigResponse, error) {
+	err := s.cfgMgr.DeleteAgentConfig(req.Key, req.AgentSelector)
+	if err == agentconfig.ErrInvalidKey {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err == agentconfig.ErrAgentConfigNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &metadatapb.DeleteAgentConfigResponse{}, nil
+}
@@ -27,6 +27,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
 	"github.com/gofrs/uuid"
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/protobuf/types"
@@ -36,8 +38,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 
 	"px.dev/pixie/src/api/proto/uuidpb"
@@ -45,6 +49,7 @@ import (
 	"px.dev/pixie/src/carnot/planner/dynamic_tracing/ir/logicalpb"
 	"px.dev/pixie/src/common/base/statuspb"
 	"px.dev/pixie/src/shared/bloomfilterpb"
+	k8smetadatapb "px.dev/pixie/src/shared/k8s/metadatapb"
 	sharedmetadatapb "px.dev/pixie/src/shared/metadatapb"
 	"px.dev/pixie/src/shared/services/env"
 	"px.dev/pixie/src/shared/services/server"
@@ -54,13 +59,17 @@ import (
 	"px.dev/pixie/src/vizier/messages/messagespb"
 	"px.dev/pixie/src/vizier/services/metadata/controllers"
 	mock_agent "px.dev/pixie/src/vizier/services/metadata/controllers/agent/mock"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/agentconfig"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/k8smeta"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/testutils"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
 	mock_tracepoint "px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint/mock"
 	"px.dev/pixie/src/vizier/services/metadata/metadataenv"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	mock_metadatapb "px.dev/pixie/src/vizier/services/metadata/metadatapb/mock"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
 	"px.dev/pixie/src/vizier/services/shared/agentpb"
+	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
 )
 
 func testTableInfos() []*storepb.TableInfo {
@@ -164,7 +173,7 @@ func TestGetAgentInfo(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, mockAgtMgr, nil)
+	s := controllers.NewServer(env, nil, mockAgtMgr, nil, nil, nil)
 
 	req := metadatapb.AgentInfoRequest{}
 
@@ -210,7 +219,7 @@ func TestGetAgentInfoGetActiveAgentsFailed(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, mockAgtMgr, nil)
+	s := controllers.NewServer(env, nil, mockAgtMgr, nil, nil, nil)
 
 	req := metadatapb.AgentInfoRequest{}
 
@@ -239,7 +248,7 @@ func TestGetSchemas(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, mockAgtMgr, nil)
+	s := controllers.NewServer(env, nil, mockAgtMgr, nil, nil, nil)
 
 	req := metadatapb.SchemaRequest{}
 
@@ -320,34 +329,20 @@ func Test_Server_RegisterTracepoint(t *testing.T) {
 	var tpID uuid.UUID
 	mockTracepointStore.
 		EXPECT().
-		UpsertTracepoint(gomock.Any(), gomock.Any()).
-		DoAndReturn(func(tracepointID uuid.UUID, tracepointInfo *storepb.TracepointInfo) error {
+		CreateTracepoint("test_tracepoint", gomock.Any(), gomock.Any(), time.Second*5).
+		DoAndReturn(func(tpName string, tracepointID uuid.UUID, tracepointInfo *storepb.TracepointInfo, ttl time.Duration) error {
 			assert.Equal(t, program, tracepointInfo.Tracepoint)
 			tpID = tracepointID
 			assert.Equal(t, "test_tracepoint", tracepointInfo.Name)
 			return nil
 		})
-	mockTracepointStore.
-		EXPECT().
-		SetTracepointWithName("test_tracepoint", gomock.Any()).
-		DoAndReturn(func(tpName string, id uuid.UUID) error {
-			assert.Equal(t, tpID, id)
-			return nil
-		})
-	mockTracepointStore.
-		EXPECT().
-		SetTracepointTTL(gomock.Any(), time.Second*5).
-		DoAndReturn(func(id uuid.UUID, ttl time.Duration) error {
-			assert.Equal(t, tpID, id)
-			return nil
-		})
 	// Set up server.
 	env, err := metadataenv.New("vizier")
 	if err != nil {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr)
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
 
 	reqs := []*metadatapb.RegisterTracepointRequest_TracepointRequest{
 		{
@@ -444,27 +439,13 @@ func Test_Server_RegisterTracepoint_Exists(t *testing.T) {
 	var tpID uuid.UUID
 	mockTracepointStore.
 		EXPECT().
-		UpsertTracepoint(gomock.Any(), gomock.Any()).
-		DoAndReturn(func(tracepointID uuid.UUID, tracepointInfo *storepb.TracepointInfo) error {
+		CreateTracepoint("test_tracepoint", gomock.Any(), gomock.Any(), time.Second*5).
+		DoAndReturn(func(tpName string, tracepointID uuid.UUID, tracepointInfo *storepb.TracepointInfo, ttl time.Duration) error {
 			assert.Equal(t, program, tracepointInfo.Tracepoint)
 			tpID = tracepointID
 			assert.Equal(t, "test_tracepoint", tracepointInfo.Name)
 			return nil
 		})
-	mockTracepointStore.
-		EXPECT().
-		SetTracepointWithName("test_tracepoint", gomock.Any()).
-		DoAndReturn(func(tpName string, id uuid.UUID) error {
-			assert.Equal(t, tpID, id)
-			return nil
-		})
-	mockTracepointStore.
-		EXPECT().
-		SetTracepointTTL(gomock.Any(), time.Second*5).
-		DoAndReturn(func(id uuid.UUID, ttl time.Duration) error {
-			assert.Equal(t, tpID, id)
-			return nil
-		})
 
 	// Set up server.
 	env, err := metadataenv.New("vizier")
@@ -472,7 +453,7 @@ func Test_Server_RegisterTracepoint_Exists(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr)
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
 
 	reqs := []*metadatapb.RegisterTracepointRequest_TracepointRequest{
 		{
@@ -497,6 +478,115 @@ func Test_Server_RegisterTracepoint_Exists(t *testing.T) {
 	assert.Equal(t, statuspb.OK, resp.Tracepoints[0].Status.ErrCode)
 }
 
+func Test_Server_RegisterTracepoint_AgentSelectorUnsupported(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+
+	mockAgtMgr.
+		EXPECT().
+		GetActiveAgents().
+		Return([]*agentpb.Agent{}, nil)
+
+	// Set up server.
+	env, err := metadataenv.New("vizier")
+	if err != nil {
+		t.Fatal("Failed to create api environment.")
+	}
+
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
+
+	req := metadatapb.RegisterTracepointRequest{
+		Requests: []*metadatapb.RegisterTracepointRequest_TracepointRequest{
+			{
+				TracepointDeployment: &logicalpb.TracepointDeployment{},
+				Name:                 "test_tracepoint",
+				TTL: &types.Duration{
+					Seconds: 5,
+				},
+				AgentSelector: &storepb.TracepointAgentSelector{
+					Namespaces: []string{"default"},
+				},
+			},
+		},
+	}
+
+	// Without access to the K8s API, the manager can't resolve the agents of the tracepoint.
+	_, err = s.RegisterTracepoint(context.Background(), &req)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func Test_Server_RegisterTracepoint_ReservedName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+
+	env, err := metadataenv.New("vizier")
+	if err != nil {
+		t.Fatal("Failed to create api environment.")
+	}
+
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
+
+	req := metadatapb.RegisterTracepointRequest{
+		Requests: []*metadatapb.RegisterTracepointRequest_TracepointRequest{
+			{
+				TracepointDeployment: &logicalpb.TracepointDeployment{},
+				Name:                 "crd/http-requests",
+				TTL: &types.Duration{
+					Seconds: 5,
+				},
+			},
+		},
+	}
+
+	// Only the Tracepoint custom resources deploy tracepoints with the reserved prefix, nothing is created.
+	_, err = s.RegisterTracepoint(context.Background(), &req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_Server_RegisterTracepoint_NoTTL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+
+	env, err := metadataenv.New("vizier")
+	if err != nil {
+		t.Fatal("Failed to create api environment.")
+	}
+
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
+
+	mockAgtMgr.
+		EXPECT().
+		GetActiveAgents().
+		Return(nil, nil)
+
+	req := metadatapb.RegisterTracepointRequest{
+		Requests: []*metadatapb.RegisterTracepointRequest_TracepointRequest{
+			{
+				TracepointDeployment: &logicalpb.TracepointDeployment{},
+				Name:                 "test_tracepoint",
+				TTL:                  &types.Duration{},
+			},
+		},
+	}
+
+	// A tracepoint without a TTL would never expire, so nothing is created.
+	_, err = s.RegisterTracepoint(context.Background(), &req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
 func Test_Server_GetTracepointInfo(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -657,7 +747,7 @@ func Test_Server_GetTracepointInfo(t *testing.T) {
 				t.Fatal("Failed to create api environment.")
 			}
 
-			s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr)
+			s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
 			req := metadatapb.GetTracepointInfoRequest{
 				IDs: []*uuidpb.UUID{utils.ProtoFromUUID(tID)},
 			}
@@ -715,7 +805,7 @@ func Test_Server_RemoveTracepoint(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr)
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
 
 	req := metadatapb.RemoveTracepointRequest{
 		Names: []string{"test1", "test2"},
@@ -729,6 +819,291 @@ func Test_Server_RemoveTracepoint(t *testing.T) {
 	assert.Equal(t, statuspb.OK, resp.Status.ErrCode)
 }
 
+func Test_Server_ListTracepoints(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+
+	tpID := uuid.Must(uuid.NewV4())
+	agentID := uuid.Must(uuid.NewV4())
+	expiry := time.Unix(1700000000, 0)
+
+	tp := &storepb.TracepointInfo{
+		ID:            utils.ProtoFromUUID(tpID),
+		Name:          "test1",
+		ExpectedState: statuspb.RUNNING_STATE,
+	}
+	agentStates := []*storepb.AgentTracepointStatus{
+		{
+			ID:      utils.ProtoFromUUID(tpID),
+			AgentID: utils.ProtoFromUUID(agentID),
+			State:   statuspb.FAILED_STATE,
+			Status: &statuspb.Status{
+				ErrCode: statuspb.INTERNAL,
+				Msg:     "failed to attach uprobe",
+			},
+		},
+	}
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsWithNames([]string{"test1"}).
+		Return([]*uuid.UUID{&tpID}, nil)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsForIDs([]uuid.UUID{tpID}).
+		Return([]*storepb.TracepointInfo{tp}, nil)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointTTLs().
+		Return([]uuid.UUID{tpID}, []time.Time{expiry}, nil)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointStates(tpID).
+		Return(agentStates, nil)
+
+	// Set up server.
+	env, err := metadataenv.New("vizier")
+	if err != nil {
+		t.Fatal("Failed to create api environment.")
+	}
+
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
+
+	resp, err := s.ListTracepoints(context.Background(), &metadatapb.ListTracepointsRequest{
+		Names: []string{"test1"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Tracepoints))
+	assert.Equal(t, tp, resp.Tracepoints[0].Info)
+	assert.Equal(t, agentStates, resp.Tracepoints[0].AgentStatuses)
+	assert.Equal(t, statuspb.FAILED_STATE, resp.Tracepoints[0].State)
+	expiresAt, err := types.TimestampFromProto(resp.Tracepoints[0].ExpiresAt)
+	require.NoError(t, err)
+	assert.True(t, expiry.Equal(expiresAt))
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsWithNames([]string{"test2"}).
+		Return([]*uuid.UUID{nil}, nil)
+
+	_, err = s.ListTracepoints(context.Background(), &metadatapb.ListTracepointsRequest{
+		Names: []string{"test2"},
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func Test_Server_SetTracepointTTL(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+
+	tpID := uuid.Must(uuid.NewV4())
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsWithNames([]string{"test1"}).
+		Return([]*uuid.UUID{&tpID}, nil)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepoint(tpID).
+		Return(&storepb.TracepointInfo{
+			ID:            utils.ProtoFromUUID(tpID),
+			Name:          "test1",
+			ExpectedState: statuspb.RUNNING_STATE,
+		}, nil)
+	mockTracepointStore.
+		EXPECT().
+		SetTracepointTTL(tpID, time.Hour).
+		Return(nil)
+
+	// Set up server.
+	env, err := metadataenv.New("vizier")
+	if err != nil {
+		t.Fatal("Failed to create api environment.")
+	}
+
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
+
+	resp, err := s.SetTracepointTTL(context.Background(), &metadatapb.SetTracepointTTLRequest{
+		Name: "test1",
+		TTL:  types.DurationProto(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, statuspb.OK, resp.Status.ErrCode)
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsWithNames([]string{"test2"}).
+		Return([]*uuid.UUID{nil}, nil)
+
+	_, err = s.SetTracepointTTL(context.Background(), &metadatapb.SetTracepointTTLRequest{
+		Name: "test2",
+		TTL:  types.DurationProto(time.Hour),
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = s.SetTracepointTTL(context.Background(), &metadatapb.SetTracepointTTLRequest{
+		Name: "test1",
+		TTL:  types.DurationProto(0),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_Server_UpdateAgentsConfig(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	db := pebbledb.New(c, 3*time.Second)
+	defer db.Close()
+
+	tracepointMgr := tracepoint.NewManager(mock_tracepoint.NewMockStore(ctrl), mockAgtMgr, 5*time.Second)
+	defer tracepointMgr.Close()
+	cfgMgr := agentconfig.NewManager(agentconfig.NewDatastore(db), mockAgtMgr, tracepointMgr)
+
+	pem := &agentpb.Agent{
+		Info: &agentpb.AgentInfo{
+			AgentID:      utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+			HostInfo:     &agentpb.HostInfo{Hostname: "node-a"},
+			Capabilities: &agentpb.AgentCapabilities{CollectsData: true},
+		},
+	}
+	kelvin := &agentpb.Agent{
+		Info: &agentpb.AgentInfo{
+			AgentID:      utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+			HostInfo:     &agentpb.HostInfo{Hostname: "node-k"},
+			Capabilities: &agentpb.AgentCapabilities{CollectsData: false},
+		},
+	}
+
+	// Set up server.
+	env, err := metadataenv.New("vizier")
+	if err != nil {
+		t.Fatal("Failed to create api environment.")
+	}
+
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, cfgMgr, nil)
+	srv := mock_metadatapb.NewMockMetadataConfigService_UpdateAgentsConfigServer(ctrl)
+	srv.EXPECT().Context().Return(context.Background()).AnyTimes()
+
+	mockAgtMgr.
+		EXPECT().
+		GetActiveAgents().
+		Return([]*agentpb.Agent{kelvin}, nil)
+	err = s.UpdateAgentsConfig(&metadatapb.UpdateAgentsConfigRequest{
+		Key:   "datastream_buffer_size",
+		Value: "4096",
+	}, srv)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	mockAgtMgr.
+		EXPECT().
+		GetActiveAgents().
+		Return([]*agentpb.Agent{pem, kelvin}, nil)
+	err = s.UpdateAgentsConfig(&metadatapb.UpdateAgentsConfigRequest{
+		Key:           "datastream_buffer_size",
+		Value:         "4096",
+		AgentSelector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-a"}},
+	}, srv)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	err = s.UpdateAgentsConfig(&metadatapb.UpdateAgentsConfigRequest{
+		Value: "4096",
+	}, srv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	err = s.UpdateAgentsConfig(&metadatapb.UpdateAgentsConfigRequest{
+		Key:   "../tracepoints",
+		Value: "4096",
+	}, srv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	err = s.UpdateAgentsConfig(&metadatapb.UpdateAgentsConfigRequest{
+		Key:       "datastream_buffer_size",
+		BatchSize: -1,
+	}, srv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_Server_ListAndDeleteAgentConfigs(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	db := pebbledb.New(c, 3*time.Second)
+	defer db.Close()
+
+	tracepointMgr := tracepoint.NewManager(mock_tracepoint.NewMockStore(ctrl), mockAgtMgr, 5*time.Second)
+	defer tracepointMgr.Close()
+	cs := agentconfig.NewDatastore(db)
+	cfgMgr := agentconfig.NewManager(cs, mockAgtMgr, tracepointMgr)
+
+	nodeA := &storepb.TracepointAgentSelector{NodeNames: []string{"node-a"}}
+	require.NoError(t, cs.SetAgentConfig(&storepb.AgentConfigSetting{
+		Key:           "datastream_buffer_size",
+		Value:         "4096",
+		AgentSelector: nodeA,
+	}))
+
+	// Set up server.
+	env, err := metadataenv.New("vizier")
+	if err != nil {
+		t.Fatal("Failed to create api environment.")
+	}
+
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, cfgMgr, nil)
+
+	listResp, err := s.ListAgentConfigs(context.Background(), &metadatapb.ListAgentConfigsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []*storepb.AgentConfigSetting{
+		{
+			Key:           "datastream_buffer_size",
+			Value:         "4096",
+			AgentSelector: nodeA,
+		},
+	}, listResp.Settings)
+
+	// The setting is only stored for node-a.
+	_, err = s.DeleteAgentConfig(context.Background(), &metadatapb.DeleteAgentConfigRequest{
+		Key: "datastream_buffer_size",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = s.DeleteAgentConfig(context.Background(), &metadatapb.DeleteAgentConfigRequest{
+		Key:           "datastream_buffer_size",
+		AgentSelector: nodeA,
+	})
+	require.NoError(t, err)
+
+	listResp, err = s.ListAgentConfigs(context.Background(), &metadatapb.ListAgentConfigsRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, listResp.Settings)
+
+	_, err = s.DeleteAgentConfig(context.Background(), &metadatapb.DeleteAgentConfigRequest{
+		Key: "../tracepoints",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
 func createDialer(lis *bufconn.Listener) func(ctx context.Context, url string) (net.Conn, error) {
 	return func(ctx context.Context, url string) (net.Conn, error) {
 		return lis.Dial()
@@ -901,7 +1276,7 @@ func TestGetAgentUpdates(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	srv := controllers.NewServer(mdEnv, nil, mockAgtMgr, nil)
+	srv := controllers.NewServer(mdEnv, nil, mockAgtMgr, nil, nil, nil)
 
 	env := env.New("withpixie.ai")
 	s := server.CreateGRPCServer(env, &server.GRPCServerOptions{})
@@ -1062,7 +1437,7 @@ func Test_Server_UpdateConfig(t *testing.T) {
 		t.Fatal("Failed to create api environment.")
 	}
 
-	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr)
+	s := controllers.NewServer(env, nil, mockAgtMgr, tracepointMgr, nil, nil)
 
 	req := metadatapb.UpdateConfigRequest{
 		AgentPodName: "pl/pem-1234",
@@ -1086,3 +1461,116 @@ func Test_Server_UpdateConfig(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Nil(t, resp)
 }
+
+func Test_Server_GetK8sResourcesAsOf(t *testing.T) {
+	c, err := pebble.Open("test", &pebble.Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	db := pebbledb.New(c, 3*time.Second)
+	defer db.Close()
+
+	pod := &storepb.K8SResource{
+		Resource: &storepb.K8SResource_Pod{
+			Pod: &k8smetadatapb.Pod{
+				Metadata: &k8smetadatapb.ObjectMetadata{
+					Name:                "pod1",
+					Namespace:           "ns",
+					UID:                 "pod1_uid",
+					CreationTimestampNS: 10,
+				},
+				Spec: &k8smetadatapb.PodSpec{
+					NodeName: "node1",
+				},
+			},
+		},
+	}
+	k8sMds := k8smeta.NewDatastore(db)
+	err = k8sMds.AddResourceHistory(time.Unix(0, 10), pod)
+	require.NoError(t, err)
+	err = k8sMds.CompactResourceHistory(time.Unix(0, 5))
+	require.NoError(t, err)
+
+	env, err := metadataenv.New("vizier")
+	require.NoError(t, err)
+	s := controllers.NewServer(env, db, nil, nil, nil, nil)
+
+	resp, err := s.GetK8SResourcesAsOf(context.Background(), &metadatapb.K8SResourcesAsOfRequest{
+		AsOf: &types.Timestamp{Nanos: 20},
+		Kind: "pod",
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Resources, 1)
+	assert.Equal(t, pod, resp.Resources[0])
+
+	_, err = s.GetK8SResourcesAsOf(context.Background(), &metadatapb.K8SResourcesAsOfRequest{
+		AsOf: &types.Timestamp{Nanos: 20},
+		Kind: "cronjob",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.GetK8SResourcesAsOf(context.Background(), &metadatapb.K8SResourcesAsOfRequest{
+		Kind: "pod",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = s.GetK8SResourcesAsOf(context.Background(), &metadatapb.K8SResourcesAsOfRequest{
+		AsOf: &types.Timestamp{Nanos: 1},
+		Kind: "pod",
+	})
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+}
+
+func Test_Server_GetAgentEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	env, err := metadataenv.New("vizier")
+	if err != nil {
+		t.Fatal("Failed to create api environment.")
+	}
+
+	agentInfo := new(agentpb.Agent)
+	if err := proto.UnmarshalText(testutils.UnhealthyKelvinAgentInfo, agentInfo); err != nil {
+		t.Fatal("Cannot Unmarshal protobuf.")
+	}
+
+	agentEvents := controllers.NewAgentEventBroadcaster()
+	s := controllers.NewServer(env, nil, nil, nil, nil, agentEvents)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := mock_metadatapb.NewMockMetadataService_GetAgentEventsServer(ctrl)
+	srv.EXPECT().Context().Return(ctx).AnyTimes()
+	srv.EXPECT().
+		Send(gomock.Any()).
+		DoAndReturn(func(resp *metadatapb.AgentEventsResponse) error {
+			require.Len(t, resp.Events, 1)
+			assert.Equal(t, metadatapb.AGENT_EVENT_EXPIRED, resp.Events[0].Type)
+			assert.Equal(t, agentInfo, resp.Events[0].Agent)
+			cancel()
+			return nil
+		}).
+		MinTimes(1)
+
+	var eg errgroup.Group
+	eg.Go(func() error {
+		return s.GetAgentEvents(&metadatapb.AgentEventsRequest{
+			Types: []metadatapb.AgentEventType{metadatapb.AGENT_EVENT_EXPIRED},
+		}, srv)
+	})
+
+	// The stream only receives the events published after it subscribes, so keep publishing until it
+	// receives one.
+	for ctx.Err() == nil {
+		agentEvents.Publish(metadatapb.AGENT_EVENT_REGISTERED, agentInfo, nil)
+		agentEvents.Publish(metadatapb.AGENT_EVENT_EXPIRED, agentInfo, nil)
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, eg.Wait())
+
+	// Agent events aren't available if the server has no broadcaster.
+	s = controllers.NewServer(env, nil, nil, nil, nil, nil)
+	err = s.GetAgentEvents(&metadatapb.AgentEventsRequest{}, srv)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
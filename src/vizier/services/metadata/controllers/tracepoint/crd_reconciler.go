@@ -0,0 +1,389 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package tracepoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/carnot/planner/dynamic_tracing/ir/logicalpb"
+	"px.dev/pixie/src/common/base/statuspb"
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/operator/client/versioned"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+)
+
+// CRDTracepointPrefix prefixes the names of the tracepoints deployed by Tracepoint custom resources, so that they
+// don't collide with the tracepoints deployed by scripts. The metadata service rejects other tracepoints that use it.
+const CRDTracepointPrefix = "crd/"
+
+// crdReconcileTimeout is how long a single reconciliation of the custom resources may take.
+const crdReconcileTimeout = 30 * time.Second
+
+// CRDReconciler deploys the tracepoints declared by the Tracepoint custom resources in a namespace, and reports
+// their state on each agent back into the status of the resources. The tracepoints don't expire, and are removed
+// once their resource is deleted.
+type CRDReconciler struct {
+	tpMgr    *Manager
+	vzClient versioned.Interface
+	ns       string
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewCRDReconciler creates a reconciler for the Tracepoint custom resources in the namespace.
+func NewCRDReconciler(tpMgr *Manager, vzClient versioned.Interface, ns string) *CRDReconciler {
+	return &CRDReconciler{
+		tpMgr:    tpMgr,
+		vzClient: vzClient,
+		ns:       ns,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start reconciles the custom resources every interval, as long as this replica of the metadata service is the
+// leader.
+func (r *CRDReconciler) Start(interval time.Duration, isLeader *bool) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				if !*isLeader {
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), crdReconcileTimeout)
+				err := r.Reconcile(ctx)
+				cancel()
+				if err != nil {
+					log.WithError(err).Error("Failed to reconcile tracepoint custom resources")
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the reconciler.
+func (r *CRDReconciler) Close() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+}
+
+// Reconcile deploys the tracepoints of the custom resources that changed, updates their status, and removes the
+// tracepoints of the resources that were deleted.
+func (r *CRDReconciler) Reconcile(ctx context.Context) error {
+	crs, err := r.vzClient.PxV1alpha1().Tracepoints(r.ns).List(ctx, metav1.ListOptions{})
+	if k8serrors.IsNotFound(err) {
+		// The Tracepoint CRD isn't installed.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	declared := make(map[string]bool, len(crs.Items))
+	for i := range crs.Items {
+		cr := &crs.Items[i]
+		declared[CRDTracepointPrefix+cr.Name] = true
+		err = r.reconcileTracepoint(ctx, cr)
+		if err != nil {
+			log.WithError(err).WithField("tracepoint", cr.Name).Error("Failed to reconcile tracepoint custom resource")
+		}
+	}
+
+	tps, err := r.tpMgr.GetAllTracepoints()
+	if err != nil {
+		return err
+	}
+	var removed []string
+	for _, tp := range tps {
+		if tp == nil || tp.ExpectedState == statuspb.TERMINATED_STATE {
+			continue
+		}
+		if strings.HasPrefix(tp.Name, CRDTracepointPrefix) && !declared[tp.Name] {
+			removed = append(removed, tp.Name)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	log.WithField("tracepoints", removed).Info("Removing the tracepoints of deleted custom resources")
+	err = r.tpMgr.RemoveTracepoints(removed)
+	if errors.Is(err, ErrTracepointNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (r *CRDReconciler) reconcileTracepoint(ctx context.Context, cr *v1alpha1.Tracepoint) error {
+	name := CRDTracepointPrefix + cr.Name
+	deployment, selector, err := compileTracepoint(name, &cr.Spec)
+	if err != nil {
+		return r.updateStatus(ctx, cr, v1alpha1.TracepointStatus{
+			Phase:   v1alpha1.TracepointPhaseFailed,
+			Message: fmt.Sprintf("Invalid tracepoint: %s", err.Error()),
+		})
+	}
+
+	var tpID uuid.UUID
+	existing, err := r.tpMgr.GetTracepointsWithNames([]string{name})
+	if err != nil && !errors.Is(err, ErrTracepointNotFound) {
+		return err
+	}
+	if len(existing) == 1 && existing[0].ExpectedState != statuspb.TERMINATED_STATE &&
+		proto.Equal(existing[0].Tracepoint, deployment) && proto.Equal(existing[0].AgentSelector, selector) {
+		tpID = utils.UUIDFromProtoOrNil(existing[0].ID)
+	} else {
+		log.WithField("tracepoint", cr.Name).Info("Deploying tracepoint custom resource")
+		id, err := r.tpMgr.DeployTracepoint(name, deployment, selector, 0)
+		if err != nil && err != ErrTracepointAlreadyExists {
+			return r.updateStatus(ctx, cr, v1alpha1.TracepointStatus{
+				Phase:   v1alpha1.TracepointPhaseFailed,
+				Message: fmt.Sprintf("Failed to deploy tracepoint: %s", err.Error()),
+			})
+		}
+		tpID = *id
+	}
+
+	states, err := r.tpMgr.GetTracepointStates(tpID)
+	if err != nil {
+		return err
+	}
+	status := tracepointStatusFromStates(states)
+	status.TracepointID = tpID.String()
+	return r.updateStatus(ctx, cr, status)
+}
+
+// updateStatus sets the status of the custom resource, if it changed.
+func (r *CRDReconciler) updateStatus(ctx context.Context, cr *v1alpha1.Tracepoint, status v1alpha1.TracepointStatus) error {
+	status.ObservedGeneration = cr.Generation
+	if reflect.DeepEqual(cr.Status, status) {
+		return nil
+	}
+	cr = cr.DeepCopy()
+	cr.Status = status
+	_, err := r.vzClient.PxV1alpha1().Tracepoints(r.ns).UpdateStatus(ctx, cr, metav1.UpdateOptions{})
+	return err
+}
+
+// tracepointStatusFromStates summarizes the states of a tracepoint on each agent.
+func tracepointStatusFromStates(states []*storepb.AgentTracepointStatus) v1alpha1.TracepointStatus {
+	status := v1alpha1.TracepointStatus{}
+	running := 0
+	failed := 0
+	var failure string
+	for _, s := range states {
+		if s == nil {
+			continue
+		}
+		agentStatus := v1alpha1.TracepointAgentStatus{
+			AgentID: utils.ProtoToUUIDStr(s.AgentID),
+			State:   s.State.String(),
+		}
+		if s.Status != nil {
+			agentStatus.Message = s.Status.Msg
+		}
+		switch s.State {
+		case statuspb.RUNNING_STATE:
+			running++
+		case statuspb.FAILED_STATE:
+			failed++
+			if failure == "" {
+				failure = agentStatus.Message
+			}
+		}
+		status.Agents = append(status.Agents, agentStatus)
+	}
+	sort.Slice(status.Agents, func(i, j int) bool {
+		return status.Agents[i].AgentID < status.Agents[j].AgentID
+	})
+
+	switch {
+	case running > 0:
+		status.Phase = v1alpha1.TracepointPhaseRunning
+		status.Message = fmt.Sprintf("Running on %d of %d agents", running, len(status.Agents))
+	case failed > 0 && failed == len(status.Agents):
+		status.Phase = v1alpha1.TracepointPhaseFailed
+		status.Message = fmt.Sprintf("Failed on all agents: %s", failure)
+	default:
+		status.Phase = v1alpha1.TracepointPhasePending
+		status.Message = "Waiting for the agents to deploy the tracepoint"
+	}
+	return status
+}
+
+// compileTracepoint compiles the spec of a custom resource into the tracepoint deployment and agent selector
+// deployed by the manager.
+func compileTracepoint(name string, spec *v1alpha1.TracepointSpec) (*logicalpb.TracepointDeployment, *storepb.TracepointAgentSelector, error) {
+	if len(spec.Programs) == 0 {
+		return nil, nil, errors.New("at least one program is required")
+	}
+
+	deployment := &logicalpb.TracepointDeployment{
+		Name: name,
+	}
+	tables := make(map[string]bool)
+	hasProbes := false
+	numBPFTrace := 0
+	for i := range spec.Programs {
+		p := &spec.Programs[i]
+		if p.TableName == "" {
+			return nil, nil, fmt.Errorf("program %d has no tableName", i)
+		}
+		if tables[p.TableName] {
+			return nil, nil, fmt.Errorf("table %q is written by several programs", p.TableName)
+		}
+		tables[p.TableName] = true
+
+		program := &logicalpb.TracepointDeployment_TracepointProgram{
+			TableName: p.TableName,
+		}
+		switch {
+		case p.Probe != nil && p.BPFTrace != "":
+			return nil, nil, fmt.Errorf("program %q must have only one of probe or bpftrace", p.TableName)
+		case p.Probe != nil:
+			probe, err := compileProbe(p.TableName, p.Probe)
+			if err != nil {
+				return nil, nil, fmt.Errorf("program %q: %w", p.TableName, err)
+			}
+			program.Spec = probe
+			hasProbes = true
+		case p.BPFTrace != "":
+			program.BPFTrace = &logicalpb.BPFTrace{Program: p.BPFTrace}
+			numBPFTrace++
+		default:
+			return nil, nil, fmt.Errorf("program %q must have one of probe or bpftrace", p.TableName)
+		}
+		deployment.Programs = append(deployment.Programs, program)
+	}
+	if numBPFTrace > 1 {
+		return nil, nil, errors.New("only one bpftrace program is allowed")
+	}
+
+	if hasProbes {
+		if spec.Target == nil {
+			return nil, nil, errors.New("a target is required by probes")
+		}
+		if parts := strings.Split(spec.Target.Pod, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, nil, fmt.Errorf("target pod %q must be of the form <namespace>/<name>", spec.Target.Pod)
+		}
+		deployment.DeploymentSpec = &logicalpb.DeploymentSpec{
+			TargetOneof: &logicalpb.DeploymentSpec_PodProcess_{
+				PodProcess: &logicalpb.DeploymentSpec_PodProcess{
+					Pod:       spec.Target.Pod,
+					Container: spec.Target.Container,
+					Process:   spec.Target.Process,
+				},
+			},
+		}
+	}
+
+	var selector *storepb.TracepointAgentSelector
+	if s := spec.AgentSelector; s != nil {
+		selector = &storepb.TracepointAgentSelector{
+			NodeNames:  s.NodeNames,
+			NodeLabels: s.NodeLabels,
+			Namespaces: s.Namespaces,
+			PodLabels:  s.PodLabels,
+		}
+		if IsEmptyAgentSelector(selector) {
+			selector = nil
+		}
+	}
+	return deployment, selector, nil
+}
+
+// compileProbe compiles a probe into a tracepoint spec, which writes a row with the columns of the probe to the
+// table each time the function is called.
+func compileProbe(tableName string, p *v1alpha1.TracepointProbe) (*logicalpb.TracepointSpec, error) {
+	if p.Symbol == "" {
+		return nil, errors.New("probe has no symbol")
+	}
+	if len(p.Columns) == 0 {
+		return nil, errors.New("probe has no columns")
+	}
+
+	probe := &logicalpb.Probe{
+		Name:       fmt.Sprintf("%s_probe", tableName),
+		Tracepoint: &logicalpb.Tracepoint{Symbol: p.Symbol},
+	}
+	output := &logicalpb.Output{Name: tableName}
+	action := &logicalpb.OutputAction{OutputName: tableName}
+	columns := make(map[string]bool)
+	for i, c := range p.Columns {
+		if c.Name == "" {
+			return nil, fmt.Errorf("column %d has no name", i)
+		}
+		if columns[c.Name] {
+			return nil, fmt.Errorf("column %q is defined several times", c.Name)
+		}
+		columns[c.Name] = true
+
+		set := 0
+		for _, isSet := range []bool{c.Arg != "", c.ReturnValue != "", c.Latency} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("column %q must have exactly one of arg, returnValue or latency", c.Name)
+		}
+
+		varID := fmt.Sprintf("%s_%d", c.Name, i)
+		switch {
+		case c.Arg != "":
+			probe.Args = append(probe.Args, &logicalpb.Argument{Id: varID, Expr: c.Arg})
+		case c.ReturnValue != "":
+			probe.RetVals = append(probe.RetVals, &logicalpb.ReturnValue{Id: varID, Expr: c.ReturnValue})
+		case c.Latency:
+			if probe.FunctionLatencyOneof != nil {
+				return nil, errors.New("only one latency column is allowed")
+			}
+			probe.FunctionLatencyOneof = &logicalpb.Probe_FunctionLatency{
+				FunctionLatency: &logicalpb.FunctionLatency{Id: varID},
+			}
+		}
+		output.Fields = append(output.Fields, c.Name)
+		action.VariableNames = append(action.VariableNames, varID)
+	}
+	probe.OutputActions = []*logicalpb.OutputAction{action}
+
+	return &logicalpb.TracepointSpec{
+		Outputs: []*logicalpb.Output{output},
+		Probe:   probe,
+	}, nil
+}
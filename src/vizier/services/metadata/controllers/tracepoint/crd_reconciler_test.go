@@ -0,0 +1,287 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package tracepoint_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"px.dev/pixie/src/carnot/planner/dynamic_tracing/ir/logicalpb"
+	"px.dev/pixie/src/common/base/statuspb"
+	"px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/operator/client/versioned/fake"
+	"px.dev/pixie/src/utils"
+	mock_agent "px.dev/pixie/src/vizier/services/metadata/controllers/agent/mock"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
+	mock_tracepoint "px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint/mock"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+func TestCRDReconciler_Reconcile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, time.Hour)
+	defer tracepointMgr.Close()
+
+	cr := &v1alpha1.Tracepoint{
+		ObjectMeta: metav1.ObjectMeta{Name: "http-handler", Namespace: "pl", Generation: 2},
+		Spec: v1alpha1.TracepointSpec{
+			Target: &v1alpha1.TracepointTarget{Pod: "default/legacy-server", Container: "server"},
+			Programs: []v1alpha1.TracepointProgram{
+				{
+					TableName: "http_handler",
+					Probe: &v1alpha1.TracepointProbe{
+						Symbol: "main.handle",
+						Columns: []v1alpha1.TracepointColumn{
+							{Name: "path", Arg: "req.URL.Path"},
+							{Name: "status", ReturnValue: "$0"},
+							{Name: "latency", Latency: true},
+						},
+					},
+				},
+			},
+		},
+	}
+	vzClient := fake.NewSimpleClientset(cr)
+	reconciler := tracepoint.NewCRDReconciler(tracepointMgr, vzClient, "pl")
+
+	agentUUID := uuid.Must(uuid.NewV4())
+	oldTPID := uuid.Must(uuid.NewV4())
+	expectedDeployment := &logicalpb.TracepointDeployment{
+		Name: "crd/http-handler",
+		DeploymentSpec: &logicalpb.DeploymentSpec{
+			TargetOneof: &logicalpb.DeploymentSpec_PodProcess_{
+				PodProcess: &logicalpb.DeploymentSpec_PodProcess{
+					Pod:       "default/legacy-server",
+					Container: "server",
+				},
+			},
+		},
+		Programs: []*logicalpb.TracepointDeployment_TracepointProgram{
+			{
+				TableName: "http_handler",
+				Spec: &logicalpb.TracepointSpec{
+					Outputs: []*logicalpb.Output{
+						{Name: "http_handler", Fields: []string{"path", "status", "latency"}},
+					},
+					Probe: &logicalpb.Probe{
+						Name:       "http_handler_probe",
+						Tracepoint: &logicalpb.Tracepoint{Symbol: "main.handle"},
+						Args:       []*logicalpb.Argument{{Id: "path_0", Expr: "req.URL.Path"}},
+						RetVals:    []*logicalpb.ReturnValue{{Id: "status_1", Expr: "$0"}},
+						FunctionLatencyOneof: &logicalpb.Probe_FunctionLatency{
+							FunctionLatency: &logicalpb.FunctionLatency{Id: "latency_2"},
+						},
+						OutputActions: []*logicalpb.OutputAction{
+							{OutputName: "http_handler", VariableNames: []string{"path_0", "status_1", "latency_2"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// The tracepoint isn't deployed yet.
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsWithNames([]string{"crd/http-handler"}).
+		Return([]*uuid.UUID{nil}, nil).
+		Times(2)
+
+	mockAgtMgr.
+		EXPECT().
+		GetActiveAgents().
+		Return([]*agentpb.Agent{testAgent(agentUUID)}, nil)
+
+	var tpInfo *storepb.TracepointInfo
+	// The tracepoint never expires.
+	mockTracepointStore.
+		EXPECT().
+		CreateTracepoint("crd/http-handler", gomock.Any(), gomock.Any(), time.Duration(0)).
+		DoAndReturn(func(name string, id uuid.UUID, info *storepb.TracepointInfo, ttl time.Duration) error {
+			tpInfo = info
+			return nil
+		})
+	mockAgtMgr.
+		EXPECT().
+		MessageAgents([]uuid.UUID{agentUUID}, gomock.Any()).
+		Return(nil)
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointStates(gomock.Any()).
+		Return([]*storepb.AgentTracepointStatus{
+			{AgentID: utils.ProtoFromUUID(agentUUID), State: statuspb.RUNNING_STATE},
+		}, nil)
+
+	// The tracepoint of a deleted resource is removed, while those deployed by scripts are kept.
+	mockTracepointStore.
+		EXPECT().
+		GetTracepoints().
+		Return([]*storepb.TracepointInfo{
+			{ID: utils.ProtoFromUUID(oldTPID), Name: "crd/deleted", ExpectedState: statuspb.RUNNING_STATE},
+			{ID: utils.ProtoFromUUID(uuid.Must(uuid.NewV4())), Name: "script_tracepoint", ExpectedState: statuspb.RUNNING_STATE},
+		}, nil)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsWithNames([]string{"crd/deleted"}).
+		Return([]*uuid.UUID{&oldTPID}, nil)
+	mockTracepointStore.
+		EXPECT().
+		DeleteTracepointTTLs([]uuid.UUID{oldTPID}).
+		Return(nil)
+
+	err := reconciler.Reconcile(context.Background())
+	require.NoError(t, err)
+
+	require.NotNil(t, tpInfo)
+	assert.Equal(t, expectedDeployment, tpInfo.Tracepoint)
+	assert.Nil(t, tpInfo.AgentSelector)
+
+	updated, err := vzClient.PxV1alpha1().Tracepoints("pl").Get(context.Background(), "http-handler", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, v1alpha1.TracepointPhaseRunning, updated.Status.Phase)
+	assert.Equal(t, utils.ProtoToUUIDStr(tpInfo.ID), updated.Status.TracepointID)
+	assert.Equal(t, int64(2), updated.Status.ObservedGeneration)
+	assert.Equal(t, []v1alpha1.TracepointAgentStatus{
+		{AgentID: agentUUID.String(), State: "RUNNING_STATE"},
+	}, updated.Status.Agents)
+
+	// Once deployed, the tracepoint isn't deployed again.
+	tpID := utils.UUIDFromProtoOrNil(tpInfo.ID)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsWithNames([]string{"crd/http-handler"}).
+		Return([]*uuid.UUID{&tpID}, nil)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsForIDs([]uuid.UUID{tpID}).
+		Return([]*storepb.TracepointInfo{tpInfo}, nil)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointStates(tpID).
+		Return([]*storepb.AgentTracepointStatus{
+			{AgentID: utils.ProtoFromUUID(agentUUID), State: statuspb.RUNNING_STATE},
+		}, nil)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepoints().
+		Return([]*storepb.TracepointInfo{tpInfo}, nil)
+
+	err = reconciler.Reconcile(context.Background())
+	require.NoError(t, err)
+}
+
+func TestCRDReconciler_Reconcile_InvalidSpec(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, time.Hour)
+	defer tracepointMgr.Close()
+
+	tests := []struct {
+		name            string
+		spec            v1alpha1.TracepointSpec
+		expectedMessage string
+	}{
+		{
+			name:            "no programs",
+			spec:            v1alpha1.TracepointSpec{},
+			expectedMessage: "Invalid tracepoint: at least one program is required",
+		},
+		{
+			name: "probe without target",
+			spec: v1alpha1.TracepointSpec{
+				Programs: []v1alpha1.TracepointProgram{
+					{
+						TableName: "t",
+						Probe: &v1alpha1.TracepointProbe{
+							Symbol:  "main.f",
+							Columns: []v1alpha1.TracepointColumn{{Name: "latency", Latency: true}},
+						},
+					},
+				},
+			},
+			expectedMessage: "Invalid tracepoint: a target is required by probes",
+		},
+		{
+			name: "column with several values",
+			spec: v1alpha1.TracepointSpec{
+				Target: &v1alpha1.TracepointTarget{Pod: "default/server"},
+				Programs: []v1alpha1.TracepointProgram{
+					{
+						TableName: "t",
+						Probe: &v1alpha1.TracepointProbe{
+							Symbol:  "main.f",
+							Columns: []v1alpha1.TracepointColumn{{Name: "c", Arg: "a", Latency: true}},
+						},
+					},
+				},
+			},
+			expectedMessage: `Invalid tracepoint: program "t": column "c" must have exactly one of arg, returnValue or latency`,
+		},
+		{
+			name: "several bpftrace programs",
+			spec: v1alpha1.TracepointSpec{
+				Programs: []v1alpha1.TracepointProgram{
+					{TableName: "t1", BPFTrace: "kprobe:f { printf(\"%d\", pid); }"},
+					{TableName: "t2", BPFTrace: "kprobe:g { printf(\"%d\", pid); }"},
+				},
+			},
+			expectedMessage: "Invalid tracepoint: only one bpftrace program is allowed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cr := &v1alpha1.Tracepoint{
+				ObjectMeta: metav1.ObjectMeta{Name: "invalid", Namespace: "pl"},
+				Spec:       test.spec,
+			}
+			vzClient := fake.NewSimpleClientset(cr)
+			reconciler := tracepoint.NewCRDReconciler(tracepointMgr, vzClient, "pl")
+
+			mockTracepointStore.
+				EXPECT().
+				GetTracepoints().
+				Return(nil, nil)
+
+			err := reconciler.Reconcile(context.Background())
+			require.NoError(t, err)
+
+			updated, err := vzClient.PxV1alpha1().Tracepoints("pl").Get(context.Background(), "invalid", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, v1alpha1.TracepointPhaseFailed, updated.Status.Phase)
+			assert.Equal(t, test.expectedMessage, updated.Status.Message)
+		})
+	}
+}
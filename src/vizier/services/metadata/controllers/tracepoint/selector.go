@@ -0,0 +1,161 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package tracepoint
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+// AgentSelector resolves the agents that a tracepoint with an agent selector is deployed on.
+type AgentSelector interface {
+	// SelectAgents returns the IDs of the agents, out of the given ones, that match the selector.
+	SelectAgents(ctx context.Context, selector *storepb.TracepointAgentSelector, agents []*agentpb.Agent) (map[uuid.UUID]bool, error)
+}
+
+// IsEmptyAgentSelector returns whether the selector doesn't restrict the agents a tracepoint is deployed on.
+func IsEmptyAgentSelector(selector *storepb.TracepointAgentSelector) bool {
+	return selector == nil || (len(selector.NodeNames) == 0 && len(selector.NodeLabels) == 0 &&
+		len(selector.Namespaces) == 0 && len(selector.PodLabels) == 0)
+}
+
+// k8sAgentSelector matches agents to the K8s nodes selected by a tracepoint agent selector.
+type k8sAgentSelector struct {
+	clientset kubernetes.Interface
+}
+
+// NewK8sAgentSelector creates an AgentSelector that looks up the nodes and pods of the cluster using the clientset.
+func NewK8sAgentSelector(clientset kubernetes.Interface) AgentSelector {
+	return &k8sAgentSelector{clientset: clientset}
+}
+
+// selectNodes returns the nodes matching the names and labels of the selector.
+func (s *k8sAgentSelector) selectNodes(ctx context.Context, selector *storepb.TracepointAgentSelector) ([]v1.Node, error) {
+	opts := metav1.ListOptions{}
+	if len(selector.NodeLabels) > 0 {
+		opts.LabelSelector = labels.SelectorFromSet(selector.NodeLabels).String()
+	}
+	nodes, err := s.clientset.CoreV1().Nodes().List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(selector.NodeNames) == 0 {
+		return nodes.Items, nil
+	}
+	names := make(map[string]bool, len(selector.NodeNames))
+	for _, name := range selector.NodeNames {
+		names[name] = true
+	}
+	var selected []v1.Node
+	for _, node := range nodes.Items {
+		if names[node.Name] {
+			selected = append(selected, node)
+		}
+	}
+	return selected, nil
+}
+
+// podNodes returns the names of the nodes hosting pods with the labels in any of the namespaces.
+// If there are no namespaces, pods in all namespaces are considered.
+func (s *k8sAgentSelector) podNodes(ctx context.Context, namespaces []string, podLabels map[string]string) (map[string]bool, error) {
+	opts := metav1.ListOptions{}
+	if len(podLabels) > 0 {
+		opts.LabelSelector = labels.SelectorFromSet(podLabels).String()
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	nodeNames := make(map[string]bool)
+	for _, ns := range namespaces {
+		pods, err := s.clientset.CoreV1().Pods(ns).List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods.Items {
+			if pod.Spec.NodeName != "" && pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+				nodeNames[pod.Spec.NodeName] = true
+			}
+		}
+	}
+	return nodeNames, nil
+}
+
+// nodeMatchesHost returns whether the agent running on the host is on the node.
+func nodeMatchesHost(node *v1.Node, host *agentpb.HostInfo) bool {
+	if host.Hostname == node.Name {
+		return true
+	}
+	for _, addr := range node.Status.Addresses {
+		if host.HostIP != "" && addr.Address == host.HostIP {
+			return true
+		}
+		if addr.Type == v1.NodeHostName && addr.Address == host.Hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectAgents returns the IDs of the data collecting agents running on the nodes that match the selector.
+func (s *k8sAgentSelector) SelectAgents(ctx context.Context, selector *storepb.TracepointAgentSelector, agents []*agentpb.Agent) (map[uuid.UUID]bool, error) {
+	nodes, err := s.selectNodes(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(selector.Namespaces) > 0 || len(selector.PodLabels) > 0 {
+		podNodes, err := s.podNodes(ctx, selector.Namespaces, selector.PodLabels)
+		if err != nil {
+			return nil, err
+		}
+		var filtered []v1.Node
+		for _, node := range nodes {
+			if podNodes[node.Name] {
+				filtered = append(filtered, node)
+			}
+		}
+		nodes = filtered
+	}
+
+	selected := make(map[uuid.UUID]bool)
+	for _, agt := range agents {
+		if agt.Info == nil || agt.Info.HostInfo == nil {
+			continue
+		}
+		// Agents that don't collect data, such as Kelvin, don't run tracepoints.
+		if agt.Info.Capabilities != nil && !agt.Info.Capabilities.CollectsData {
+			continue
+		}
+		for i := range nodes {
+			if nodeMatchesHost(&nodes[i], agt.Info.HostInfo) {
+				selected[utils.UUIDFromProtoOrNil(agt.Info.AgentID)] = true
+				break
+			}
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package tracepoint_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+func testNode(name string, ip string, labels map[string]string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: ip}},
+		},
+	}
+}
+
+func testPod(namespace string, name string, nodeName string, labels map[string]string, phase v1.PodPhase) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Spec:       v1.PodSpec{NodeName: nodeName},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+}
+
+func testHostAgent(id uuid.UUID, hostname string, ip string, collectsData bool) *agentpb.Agent {
+	return &agentpb.Agent{
+		Info: &agentpb.AgentInfo{
+			AgentID:      utils.ProtoFromUUID(id),
+			HostInfo:     &agentpb.HostInfo{Hostname: hostname, HostIP: ip},
+			Capabilities: &agentpb.AgentCapabilities{CollectsData: collectsData},
+		},
+	}
+}
+
+func TestK8sAgentSelector_SelectAgents(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testNode("node-1", "10.0.0.1", map[string]string{"pool": "a"}),
+		testNode("node-2", "10.0.0.2", map[string]string{"pool": "a"}),
+		testNode("node-3", "10.0.0.3", map[string]string{"pool": "b"}),
+		testPod("payments", "checkout", "node-2", map[string]string{"app": "checkout"}, v1.PodRunning),
+		testPod("payments", "billing", "node-3", map[string]string{"app": "billing"}, v1.PodRunning),
+		testPod("staging", "checkout", "node-1", map[string]string{"app": "checkout"}, v1.PodRunning),
+		// Pods that completed no longer need to be traced.
+		testPod("payments", "migrate", "node-1", map[string]string{"app": "checkout"}, v1.PodSucceeded),
+	)
+	selector := tracepoint.NewK8sAgentSelector(clientset)
+
+	agent1 := uuid.Must(uuid.NewV4())
+	agent2 := uuid.Must(uuid.NewV4())
+	agent3 := uuid.Must(uuid.NewV4())
+	kelvin := uuid.Must(uuid.NewV4())
+	agents := []*agentpb.Agent{
+		testHostAgent(agent1, "node-1", "10.0.0.1", true),
+		// Agents are matched by IP when their hostname differs from the node name.
+		testHostAgent(agent2, "ip-10-0-0-2", "10.0.0.2", true),
+		testHostAgent(agent3, "node-3", "10.0.0.3", true),
+		// Tracepoints aren't deployed on agents that don't collect data.
+		testHostAgent(kelvin, "node-2", "10.0.0.2", false),
+	}
+
+	tests := []struct {
+		name     string
+		selector *storepb.TracepointAgentSelector
+		expected map[uuid.UUID]bool
+	}{
+		{
+			name:     "node names",
+			selector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-1", "node-2"}},
+			expected: map[uuid.UUID]bool{agent1: true, agent2: true},
+		},
+		{
+			name:     "node labels",
+			selector: &storepb.TracepointAgentSelector{NodeLabels: map[string]string{"pool": "b"}},
+			expected: map[uuid.UUID]bool{agent3: true},
+		},
+		{
+			name:     "namespaces",
+			selector: &storepb.TracepointAgentSelector{Namespaces: []string{"payments"}},
+			expected: map[uuid.UUID]bool{agent2: true, agent3: true},
+		},
+		{
+			name:     "pod labels",
+			selector: &storepb.TracepointAgentSelector{PodLabels: map[string]string{"app": "checkout"}},
+			expected: map[uuid.UUID]bool{agent1: true, agent2: true},
+		},
+		{
+			name: "pod labels in namespaces",
+			selector: &storepb.TracepointAgentSelector{
+				Namespaces: []string{"payments"},
+				PodLabels:  map[string]string{"app": "checkout"},
+			},
+			expected: map[uuid.UUID]bool{agent2: true},
+		},
+		{
+			name:     "no match",
+			selector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-4"}},
+			expected: map[uuid.UUID]bool{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := selector.SelectAgents(context.Background(), test.selector, agents)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, selected)
+		})
+	}
+}
+
+func TestIsEmptyAgentSelector(t *testing.T) {
+	assert.True(t, tracepoint.IsEmptyAgentSelector(nil))
+	assert.True(t, tracepoint.IsEmptyAgentSelector(&storepb.TracepointAgentSelector{}))
+	assert.False(t, tracepoint.IsEmptyAgentSelector(&storepb.TracepointAgentSelector{Namespaces: []string{"default"}}))
+}
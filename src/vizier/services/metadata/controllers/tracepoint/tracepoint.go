@@ -19,6 +19,7 @@
 package tracepoint
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -34,26 +35,37 @@ import (
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/messages/messagespb"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
 )
 
+// selectAgentsTimeout is how long resolving the agents of a tracepoint with an agent selector may take.
+const selectAgentsTimeout = 10 * time.Second
+
 var (
 	// ErrTracepointAlreadyExists is produced if a tracepoint already exists with the given name
 	// and does not have a matching schema.
 	ErrTracepointAlreadyExists = errors.New("TracepointDeployment already exists")
+	// ErrTracepointNotFound is produced if there is no running tracepoint with the given name.
+	ErrTracepointNotFound = errors.New("Tracepoint not found")
+	// ErrAgentSelectorUnsupported is produced if a tracepoint has an agent selector, but the manager can't resolve it.
+	ErrAgentSelectorUnsupported = errors.New("Tracepoint agent selectors are not supported")
 )
 
 // agentMessenger is a controller that lets us message all agents and all active agents.
 type agentMessenger interface {
 	MessageAgents(agentIDs []uuid.UUID, msg []byte) error
 	MessageActiveAgents(msg []byte) error
+	GetActiveAgents() ([]*agentpb.Agent, error)
 }
 
 // Store is a datastore which can store, update, and retrieve information about tracepoints.
 type Store interface {
+	CreateTracepoint(string, uuid.UUID, *storepb.TracepointInfo, time.Duration) error
 	UpsertTracepoint(uuid.UUID, *storepb.TracepointInfo) error
 	GetTracepoint(uuid.UUID) (*storepb.TracepointInfo, error)
 	GetTracepoints() ([]*storepb.TracepointInfo, error)
 	UpdateTracepointState(*storepb.AgentTracepointStatus) error
+	DeleteTracepointState(uuid.UUID, uuid.UUID) error
 	GetTracepointStates(uuid.UUID) ([]*storepb.AgentTracepointStatus, error)
 	SetTracepointWithName(string, uuid.UUID) error
 	GetTracepointsWithNames([]string) ([]*uuid.UUID, error)
@@ -67,8 +79,9 @@ type Store interface {
 
 // Manager manages the tracepoints deployed in the cluster.
 type Manager struct {
-	ts     Store
-	agtMgr agentMessenger
+	ts       Store
+	agtMgr   agentMessenger
+	selector AgentSelector
 
 	done chan struct{}
 	once sync.Once
@@ -99,6 +112,142 @@ func (m *Manager) watchForTracepointExpiry(ttlReaperDuration time.Duration) {
 	}
 }
 
+// SetAgentSelector enables deploying tracepoints on the agents matching their agent selector. The agents of
+// each such tracepoint are re-evaluated every reconcileInterval, as the pods and nodes of the cluster change.
+// It must be called before the manager is used.
+func (m *Manager) SetAgentSelector(selector AgentSelector, reconcileInterval time.Duration) {
+	m.selector = selector
+	go m.watchForAgentChanges(reconcileInterval)
+}
+
+func (m *Manager) watchForAgentChanges(reconcileInterval time.Duration) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.reconcileTracepointAgents()
+		}
+	}
+}
+
+// reconcileTracepointAgents deploys the tracepoints that have an agent selector on the agents that newly match it,
+// and removes them from the agents that no longer match, for example because the selected pods moved.
+func (m *Manager) reconcileTracepointAgents() {
+	tps, err := m.ts.GetTracepoints()
+	if err != nil {
+		log.WithError(err).Warn("error encountered when trying to reconcile the agents of tracepoints")
+		return
+	}
+	agents, err := m.agtMgr.GetActiveAgents()
+	if err != nil {
+		log.WithError(err).Warn("error encountered when trying to reconcile the agents of tracepoints")
+		return
+	}
+
+	for _, tp := range tps {
+		if tp == nil || tp.ExpectedState == statuspb.TERMINATED_STATE || IsEmptyAgentSelector(tp.AgentSelector) {
+			continue
+		}
+		err = m.reconcileTracepoint(tp, agents)
+		if err != nil {
+			log.WithError(err).WithField("tracepoint", tp.Name).Warn("error encountered when trying to reconcile the agents of tracepoint")
+		}
+	}
+}
+
+func (m *Manager) reconcileTracepoint(tp *storepb.TracepointInfo, agents []*agentpb.Agent) error {
+	tpID := utils.UUIDFromProtoOrNil(tp.ID)
+	selected, err := m.SelectAgents(tp.AgentSelector, agents)
+	if err != nil {
+		return err
+	}
+	states, err := m.ts.GetTracepointStates(tpID)
+	if err != nil {
+		return err
+	}
+
+	deployed := make(map[uuid.UUID]bool)
+	for _, s := range states {
+		if s != nil && s.State != statuspb.TERMINATED_STATE {
+			deployed[utils.UUIDFromProtoOrNil(s.AgentID)] = true
+		}
+	}
+	selectedSet := make(map[uuid.UUID]bool, len(selected))
+	var added []uuid.UUID
+	for _, agentID := range selected {
+		selectedSet[agentID] = true
+		if !deployed[agentID] {
+			added = append(added, agentID)
+		}
+	}
+	var removed []uuid.UUID
+	for agentID := range deployed {
+		if !selectedSet[agentID] {
+			removed = append(removed, agentID)
+		}
+	}
+
+	if len(added) > 0 {
+		log.WithField("tracepoint", tp.Name).WithField("agents", added).Info("Deploying tracepoint on newly selected agents")
+		err = m.RegisterTracepoint(added, tpID, tp.Tracepoint)
+		if err != nil {
+			return err
+		}
+		// Mark the agents as pending, so that they aren't sent the tracepoint again before they report its state.
+		for _, agentID := range added {
+			err = m.ts.UpdateTracepointState(&storepb.AgentTracepointStatus{
+				State:   statuspb.PENDING_STATE,
+				ID:      tp.ID,
+				AgentID: utils.ProtoFromUUID(agentID),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(removed) > 0 {
+		log.WithField("tracepoint", tp.Name).WithField("agents", removed).Info("Removing tracepoint from agents that are no longer selected")
+		err = m.removeTracepointFromAgents(removed, tpID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelectAgents returns the IDs of the agents, out of the given ones, that a tracepoint with the selector is deployed
+// on. Tracepoints without a selector are deployed on all agents.
+func (m *Manager) SelectAgents(selector *storepb.TracepointAgentSelector, agents []*agentpb.Agent) ([]uuid.UUID, error) {
+	if IsEmptyAgentSelector(selector) {
+		agentIDs := make([]uuid.UUID, len(agents))
+		for i, agt := range agents {
+			agentIDs[i] = utils.UUIDFromProtoOrNil(agt.Info.AgentID)
+		}
+		return agentIDs, nil
+	}
+	if m.selector == nil {
+		return nil, ErrAgentSelectorUnsupported
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), selectAgentsTimeout)
+	defer cancel()
+	selected, err := m.selector.SelectAgents(ctx, selector, agents)
+	if err != nil {
+		return nil, err
+	}
+	var agentIDs []uuid.UUID
+	for _, agt := range agents {
+		agentID := utils.UUIDFromProtoOrNil(agt.Info.AgentID)
+		if selected[agentID] {
+			agentIDs = append(agentIDs, agentID)
+		}
+	}
+	return agentIDs, nil
+}
+
 func (m *Manager) terminateExpiredTracepoints() {
 	tps, err := m.ts.GetTracepoints()
 	if err != nil {
@@ -117,7 +266,8 @@ func (m *Manager) terminateExpiredTracepoints() {
 	// Lookup for tracepoints that still have an active ttl
 	tpActive := make(map[uuid.UUID]bool)
 	for i, tp := range ttlKeys {
-		tpActive[tp] = ttlVals[i].After(now)
+		// Tracepoints with a zero expiry never expire.
+		tpActive[tp] = ttlVals[i].IsZero() || ttlVals[i].After(now)
 	}
 
 	for _, tp := range tps {
@@ -155,6 +305,25 @@ func (m *Manager) terminateTracepoint(id uuid.UUID) error {
 	}
 
 	// Send termination messages to PEMs.
+	msg, err := removeTracepointMessage(id)
+	if err != nil {
+		return err
+	}
+
+	return m.agtMgr.MessageActiveAgents(msg)
+}
+
+// removeTracepointFromAgents removes the tracepoint from the given agents only, while it keeps running on the others.
+func (m *Manager) removeTracepointFromAgents(agentIDs []uuid.UUID, id uuid.UUID) error {
+	msg, err := removeTracepointMessage(id)
+	if err != nil {
+		return err
+	}
+
+	return m.agtMgr.MessageAgents(agentIDs, msg)
+}
+
+func removeTracepointMessage(id uuid.UUID) ([]byte, error) {
 	tracepointReq := messagespb.VizierMessage{
 		Msg: &messagespb.VizierMessage_TracepointMessage{
 			TracepointMessage: &messagespb.TracepointMessage{
@@ -166,20 +335,21 @@ func (m *Manager) terminateTracepoint(id uuid.UUID) error {
 			},
 		},
 	}
-	msg, err := tracepointReq.Marshal()
-	if err != nil {
-		return err
-	}
-
-	return m.agtMgr.MessageActiveAgents(msg)
+	return tracepointReq.Marshal()
 }
 
 func (m *Manager) deleteTracepoint(id uuid.UUID) error {
 	return m.ts.DeleteTracepoint(id)
 }
 
-// CreateTracepoint creates and stores info about the given tracepoint.
-func (m *Manager) CreateTracepoint(tracepointName string, tracepointDeployment *logicalpb.TracepointDeployment, ttl time.Duration) (*uuid.UUID, error) {
+// CreateTracepoint creates and stores info about the given tracepoint. The selector restricts the agents the
+// tracepoint is deployed on, and may be nil to deploy it on all agents. A ttl of 0 keeps the tracepoint
+// running until it is removed.
+func (m *Manager) CreateTracepoint(tracepointName string, tracepointDeployment *logicalpb.TracepointDeployment, selector *storepb.TracepointAgentSelector, ttl time.Duration) (*uuid.UUID, error) {
+	if IsEmptyAgentSelector(selector) {
+		selector = nil
+	}
+
 	// Check to see if a tracepoint with the matching name already exists.
 	resp, err := m.ts.GetTracepointsWithNames([]string{tracepointName})
 	if err != nil {
@@ -217,6 +387,14 @@ func (m *Manager) CreateTracepoint(tracepointName string, tracepointDeployment *
 			} else {
 				allTpsSame = false
 			}
+			// Attaching to other processes requires a new tracepoint as well.
+			if !proto.Equal(prevTracepoint.Tracepoint.DeploymentSpec, tracepointDeployment.DeploymentSpec) {
+				allTpsSame = false
+			}
+			// Deploying on other agents requires a new tracepoint, since the old one must be removed from agents.
+			if !proto.Equal(prevTracepoint.AgentSelector, selector) {
+				allTpsSame = false
+			}
 
 			if allTpsSame {
 				err = m.ts.SetTracepointTTL(*prevTracepointID, ttl)
@@ -243,16 +421,9 @@ func (m *Manager) CreateTracepoint(tracepointName string, tracepointDeployment *
 		Tracepoint:    tracepointDeployment,
 		Name:          tracepointName,
 		ExpectedState: statuspb.RUNNING_STATE,
+		AgentSelector: selector,
 	}
-	err = m.ts.UpsertTracepoint(tpID, newTracepoint)
-	if err != nil {
-		return nil, err
-	}
-	err = m.ts.SetTracepointTTL(tpID, ttl)
-	if err != nil {
-		return nil, err
-	}
-	err = m.ts.SetTracepointWithName(tracepointName, tpID)
+	err = m.ts.CreateTracepoint(tracepointName, tpID, newTracepoint, ttl)
 	if err != nil {
 		return nil, err
 	}
@@ -268,6 +439,16 @@ func (m *Manager) GetAllTracepoints() ([]*storepb.TracepointInfo, error) {
 func (m *Manager) UpdateAgentTracepointStatus(tracepointID *uuidpb.UUID, agentID *uuidpb.UUID, state statuspb.LifeCycleState, status *statuspb.Status) error {
 	if state == statuspb.TERMINATED_STATE { // If all agent tracepoint statuses are now terminated, we can finally delete the tracepoint from the datastore.
 		tID := utils.UUIDFromProtoOrNil(tracepointID)
+		tp, err := m.ts.GetTracepoint(tID)
+		if err != nil {
+			return err
+		}
+		if tp != nil && tp.ExpectedState != statuspb.TERMINATED_STATE {
+			// The tracepoint was removed from an agent that no longer matches its selector, while it keeps
+			// running on the others.
+			return m.ts.DeleteTracepointState(tID, utils.UUIDFromProtoOrNil(agentID))
+		}
+
 		states, err := m.GetTracepointStates(tID)
 		if err != nil {
 			return err
@@ -295,6 +476,28 @@ func (m *Manager) UpdateAgentTracepointStatus(tracepointID *uuidpb.UUID, agentID
 	return m.ts.UpdateTracepointState(tracepointState)
 }
 
+// DeployTracepoint creates the given tracepoint and registers it on the active agents that match its selector.
+// If an identical tracepoint is already running, its TTL is renewed and ErrTracepointAlreadyExists is returned.
+func (m *Manager) DeployTracepoint(tracepointName string, tracepointDeployment *logicalpb.TracepointDeployment, selector *storepb.TracepointAgentSelector, ttl time.Duration) (*uuid.UUID, error) {
+	agents, err := m.agtMgr.GetActiveAgents()
+	if err != nil {
+		return nil, err
+	}
+	agentIDs, err := m.SelectAgents(selector, agents)
+	if err != nil {
+		return nil, err
+	}
+	tracepointID, err := m.CreateTracepoint(tracepointName, tracepointDeployment, selector, ttl)
+	if err != nil {
+		return tracepointID, err
+	}
+	err = m.RegisterTracepoint(agentIDs, *tracepointID, tracepointDeployment)
+	if err != nil {
+		return nil, err
+	}
+	return tracepointID, nil
+}
+
 // RegisterTracepoint sends requests to the given agents to register the specified tracepoint.
 func (m *Manager) RegisterTracepoint(agentIDs []uuid.UUID, tracepointID uuid.UUID, tracepointDeployment *logicalpb.TracepointDeployment) error {
 	tracepointReq := messagespb.VizierMessage{
@@ -343,7 +546,7 @@ func (m *Manager) RemoveTracepoints(names []string) error {
 
 	for i, id := range tpIDs {
 		if id == nil {
-			return fmt.Errorf("Could not find tracepoint for given name: %s", names[i])
+			return fmt.Errorf("%w: %s", ErrTracepointNotFound, names[i])
 		}
 		ids[i] = *id
 	}
@@ -351,6 +554,71 @@ func (m *Manager) RemoveTracepoints(names []string) error {
 	return m.ts.DeleteTracepointTTLs(ids)
 }
 
+// GetTracepointsWithNames gets the tracepoint infos for the given names, in the same order.
+func (m *Manager) GetTracepointsWithNames(names []string) ([]*storepb.TracepointInfo, error) {
+	tpIDs, err := m.ts.GetTracepointsWithNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(tpIDs))
+	for i, id := range tpIDs {
+		if id == nil {
+			return nil, fmt.Errorf("%w: %s", ErrTracepointNotFound, names[i])
+		}
+		ids[i] = *id
+	}
+
+	tps, err := m.ts.GetTracepointsForIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, tp := range tps {
+		if tp == nil {
+			return nil, fmt.Errorf("%w: %s", ErrTracepointNotFound, names[i])
+		}
+	}
+	return tps, nil
+}
+
+// GetTracepointExpiries gets the time at which the TTL of each tracepoint expires. Tracepoints
+// which are terminating have no TTL, and tracepoints which never expire have a zero time.
+func (m *Manager) GetTracepointExpiries() (map[uuid.UUID]time.Time, error) {
+	ttlKeys, ttlVals, err := m.ts.GetTracepointTTLs()
+	if err != nil {
+		return nil, err
+	}
+
+	expiries := make(map[uuid.UUID]time.Time, len(ttlKeys))
+	for i, id := range ttlKeys {
+		expiries[id] = ttlVals[i]
+	}
+	return expiries, nil
+}
+
+// SetTracepointTTL replaces the TTL of the running tracepoint with the given name, so that it
+// expires after ttl from now.
+func (m *Manager) SetTracepointTTL(name string, ttl time.Duration) error {
+	tpIDs, err := m.ts.GetTracepointsWithNames([]string{name})
+	if err != nil {
+		return err
+	}
+	if len(tpIDs) != 1 || tpIDs[0] == nil {
+		return fmt.Errorf("%w: %s", ErrTracepointNotFound, name)
+	}
+
+	tp, err := m.ts.GetTracepoint(*tpIDs[0])
+	if err != nil {
+		return err
+	}
+	// A tracepoint that is being terminated can't be brought back, it must be deployed again.
+	if tp == nil || tp.ExpectedState == statuspb.TERMINATED_STATE {
+		return fmt.Errorf("%w: %s", ErrTracepointNotFound, name)
+	}
+
+	return m.ts.SetTracepointTTL(*tpIDs[0], ttl)
+}
+
 // DeleteAgent deletes tracepoints on the given agent.
 func (m *Manager) DeleteAgent(agentID uuid.UUID) error {
 	return m.ts.DeleteTracepointsForAgent(agentID)
@@ -123,14 +123,37 @@ func (t *Datastore) UpsertTracepoint(tracepointID uuid.UUID, tracepointInfo *sto
 	return t.ds.Set(getTracepointKey(tracepointID), string(val))
 }
 
-// DeleteTracepoint deletes the tracepoint from the store.
-func (t *Datastore) DeleteTracepoint(tracepointID uuid.UUID) error {
-	err := t.ds.DeleteAll([]string{getTracepointKey(tracepointID)})
+// CreateTracepoint creates a new tracepoint entry in the store, along with its TTL and its name, in a single
+// transaction. A TTL of 0 persists the tracepoint until its TTL is deleted.
+func (t *Datastore) CreateTracepoint(tracepointName string, tracepointID uuid.UUID, tracepointInfo *storepb.TracepointInfo, ttl time.Duration) error {
+	val, err := tracepointInfo.Marshal()
+	if err != nil {
+		return err
+	}
+	ttlOp, err := setTracepointTTLOp(tracepointID, ttl)
+	if err != nil {
+		return err
+	}
+	name, err := utils.ProtoFromUUID(tracepointID).Marshal()
 	if err != nil {
 		return err
 	}
 
-	return t.ds.DeleteWithPrefix(getTracepointStatesKey(tracepointID))
+	_, err = t.ds.Txn(nil, []datastore.Op{
+		datastore.OpSet(getTracepointKey(tracepointID), string(val)),
+		ttlOp,
+		datastore.OpSet(getTracepointWithNameKey(tracepointName), string(name)),
+	})
+	return err
+}
+
+// DeleteTracepoint deletes the tracepoint and its states from the store.
+func (t *Datastore) DeleteTracepoint(tracepointID uuid.UUID) error {
+	_, err := t.ds.Txn(nil, []datastore.Op{
+		datastore.OpDelete(getTracepointKey(tracepointID)),
+		datastore.OpDeleteWithPrefix(getTracepointStatesKey(tracepointID)),
+	})
+	return err
 }
 
 // GetTracepoint gets the tracepoint info from the store, if it exists.
@@ -214,6 +237,11 @@ func (t *Datastore) UpdateTracepointState(state *storepb.AgentTracepointStatus)
 	return t.ds.Set(getTracepointStateKey(tpID, utils.UUIDFromProtoOrNil(state.AgentID)), string(val))
 }
 
+// DeleteTracepointState deletes the state of the tracepoint on the given agent.
+func (t *Datastore) DeleteTracepointState(tracepointID uuid.UUID, agentID uuid.UUID) error {
+	return t.ds.Delete(getTracepointStateKey(tracepointID, agentID))
+}
+
 // GetTracepointStates gets all the agentTracepoint states for the given tracepoint.
 func (t *Datastore) GetTracepointStates(tracepointID uuid.UUID) ([]*storepb.AgentTracepointStatus, error) {
 	_, vals, err := t.ds.GetWithPrefix(getTracepointStatesKey(tracepointID))
@@ -234,14 +262,32 @@ func (t *Datastore) GetTracepointStates(tracepointID uuid.UUID) ([]*storepb.Agen
 }
 
 // SetTracepointTTL creates a key in the datastore with the given TTL. This represents the amount of time
-// that the given tracepoint should be persisted before terminating.
+// that the given tracepoint should be persisted before terminating. A TTL of 0 persists the tracepoint until
+// its TTL is deleted, and is stored with a zero expiry time.
 func (t *Datastore) SetTracepointTTL(tracepointID uuid.UUID, ttl time.Duration) error {
+	op, err := setTracepointTTLOp(tracepointID, ttl)
+	if err != nil {
+		return err
+	}
+	_, err = t.ds.Txn(nil, []datastore.Op{op})
+	return err
+}
+
+func setTracepointTTLOp(tracepointID uuid.UUID, ttl time.Duration) (datastore.Op, error) {
+	if ttl <= 0 {
+		encodedExpiry, err := time.Time{}.MarshalBinary()
+		if err != nil {
+			return datastore.Op{}, err
+		}
+		return datastore.OpSet(getTracepointTTLKey(tracepointID), string(encodedExpiry)), nil
+	}
+
 	expiresAt := time.Now().Add(ttl)
 	encodedExpiry, err := expiresAt.MarshalBinary()
 	if err != nil {
-		return err
+		return datastore.Op{}, err
 	}
-	return t.ds.SetWithTTL(getTracepointTTLKey(tracepointID), string(encodedExpiry), ttl)
+	return datastore.OpSetWithTTL(getTracepointTTLKey(tracepointID), string(encodedExpiry), ttl), nil
 }
 
 // DeleteTracepointTTLs deletes the key in the datastore for the given tracepoint TTLs.
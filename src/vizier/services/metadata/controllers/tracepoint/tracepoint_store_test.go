@@ -80,6 +80,37 @@ func TestTracepointStore_UpsertTracepoint(t *testing.T) {
 	assert.Equal(t, s1, savedTracepointPb)
 }
 
+func TestTracepointStore_CreateTracepoint(t *testing.T) {
+	db, ts, cleanup := setupTest(t)
+	defer cleanup()
+
+	tpID := uuid.Must(uuid.NewV4())
+	s1 := &storepb.TracepointInfo{
+		ID:   utils.ProtoFromUUID(tpID),
+		Name: "test",
+	}
+
+	err := ts.CreateTracepoint("test", tpID, s1, time.Hour)
+	require.NoError(t, err)
+
+	savedTracepoint, err := ts.GetTracepoint(tpID)
+	require.NoError(t, err)
+	assert.Equal(t, s1, savedTracepoint)
+
+	savedTracepointName, err := db.Get("/tracepointName/test")
+	require.NoError(t, err)
+	savedTracepointNamePb := &uuidpb.UUID{}
+	err = proto.Unmarshal(savedTracepointName, savedTracepointNamePb)
+	require.NoError(t, err)
+	assert.Equal(t, tpID, utils.UUIDFromProtoOrNil(savedTracepointNamePb))
+
+	ids, expirations, err := ts.GetTracepointTTLs()
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{tpID}, ids)
+	require.Len(t, expirations, 1)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expirations[0], time.Minute)
+}
+
 func TestTracepointStore_GetTracepoint(t *testing.T) {
 	db, ts, cleanup := setupTest(t)
 	defer cleanup()
@@ -263,6 +294,36 @@ func TestTracepointStore_GetTracepointStates(t *testing.T) {
 	assert.Contains(t, agentIDs, utils.ProtoToUUIDStr(s2.AgentID))
 }
 
+func TestTracepointStore_DeleteTracepointState(t *testing.T) {
+	db, ts, cleanup := setupTest(t)
+	defer cleanup()
+
+	tpID := uuid.Must(uuid.NewV4())
+	agentID1 := uuid.Must(uuid.NewV4())
+	agentID2 := uuid.Must(uuid.NewV4())
+
+	for _, agentID := range []uuid.UUID{agentID1, agentID2} {
+		err := ts.UpdateTracepointState(&storepb.AgentTracepointStatus{
+			ID:      utils.ProtoFromUUID(tpID),
+			AgentID: utils.ProtoFromUUID(agentID),
+			State:   statuspb.RUNNING_STATE,
+		})
+		require.NoError(t, err)
+	}
+
+	err := ts.DeleteTracepointState(tpID, agentID1)
+	require.NoError(t, err)
+
+	val, err := db.Get("/tracepointStates/" + tpID.String() + "/" + agentID1.String())
+	require.NoError(t, err)
+	assert.Nil(t, val)
+
+	states, err := ts.GetTracepointStates(tpID)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(states))
+	assert.Equal(t, agentID2, utils.UUIDFromProtoOrNil(states[0].AgentID))
+}
+
 func TestTracepointStore_SetTracepointWithName(t *testing.T) {
 	db, ts, cleanup := setupTest(t)
 	defer cleanup()
@@ -362,3 +423,27 @@ func TestTracepointStore_GetTracepointTTLs(t *testing.T) {
 	assert.Contains(t, tracepoints, s1ID)
 	assert.Contains(t, tracepoints, s2ID)
 }
+
+func TestTracepointStore_SetTracepointTTL_NeverExpires(t *testing.T) {
+	_, ts, cleanup := setupTest(t)
+	defer cleanup()
+
+	expiringID := uuid.Must(uuid.NewV4())
+	persistentID := uuid.Must(uuid.NewV4())
+
+	err := ts.SetTracepointTTL(expiringID, time.Hour)
+	require.NoError(t, err)
+	err = ts.SetTracepointTTL(persistentID, 0)
+	require.NoError(t, err)
+
+	ids, expiries, err := ts.GetTracepointTTLs()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(ids))
+	for i, id := range ids {
+		if id == persistentID {
+			assert.True(t, expiries[i].IsZero())
+		} else {
+			assert.True(t, expiries[i].After(time.Now()))
+		}
+	}
+}
@@ -19,6 +19,8 @@
 package tracepoint_test
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -37,6 +39,7 @@ import (
 	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
 	mock_tracepoint "px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint/mock"
 	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
 )
 
 func TestCreateTracepoint(t *testing.T) {
@@ -263,8 +266,8 @@ func TestCreateTracepoint(t *testing.T) {
 			if !test.expectError && !test.expectTTLUpdateOnly {
 				mockTracepointStore.
 					EXPECT().
-					UpsertTracepoint(gomock.Any(), gomock.Any()).
-					DoAndReturn(func(id uuid.UUID, tpInfo *storepb.TracepointInfo) error {
+					CreateTracepoint("test_tracepoint", gomock.Any(), gomock.Any(), time.Second*5).
+					DoAndReturn(func(name string, id uuid.UUID, tpInfo *storepb.TracepointInfo, ttl time.Duration) error {
 						newID = id
 						assert.Equal(t, &storepb.TracepointInfo{
 							Tracepoint:    test.newTracepoint,
@@ -274,29 +277,13 @@ func TestCreateTracepoint(t *testing.T) {
 						}, tpInfo)
 						return nil
 					})
-
-				mockTracepointStore.
-					EXPECT().
-					SetTracepointWithName("test_tracepoint", gomock.Any()).
-					DoAndReturn(func(name string, id uuid.UUID) error {
-						assert.Equal(t, newID, id)
-						return nil
-					})
-
-				mockTracepointStore.
-					EXPECT().
-					SetTracepointTTL(gomock.Any(), time.Second*5).
-					DoAndReturn(func(id uuid.UUID, ttl time.Duration) error {
-						assert.Equal(t, newID, id)
-						return nil
-					})
 			}
 
 			mockAgtMgr := mock_agent.NewMockManager(ctrl)
 			tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
 			defer tracepointMgr.Close()
 
-			actualTpID, err := tracepointMgr.CreateTracepoint("test_tracepoint", test.newTracepoint, time.Second*5)
+			actualTpID, err := tracepointMgr.CreateTracepoint("test_tracepoint", test.newTracepoint, nil, time.Second*5)
 			if test.expectError || test.expectTTLUpdateOnly {
 				assert.Equal(t, tracepoint.ErrTracepointAlreadyExists, err)
 			} else {
@@ -490,6 +477,11 @@ func TestUpdateAgentTracepointStatus_Terminated(t *testing.T) {
 	tpID := uuid.Must(uuid.NewV4())
 	agentUUID2 := uuid.Must(uuid.NewV4())
 
+	mockTracepointStore.
+		EXPECT().
+		GetTracepoint(tpID).
+		Return(&storepb.TracepointInfo{ExpectedState: statuspb.TERMINATED_STATE}, nil)
+
 	mockTracepointStore.
 		EXPECT().
 		GetTracepointStates(tpID).
@@ -633,3 +625,325 @@ func TestUpdateAgentTracepointStatus_RemoveTracepoints(t *testing.T) {
 	err := tracepointMgr.RemoveTracepoints([]string{"test1", "test2"})
 	require.NoError(t, err)
 }
+
+func TestSetTracepointTTL(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       statuspb.LifeCycleState
+		exists      bool
+		expectError bool
+	}{
+		{
+			name:   "running",
+			state:  statuspb.RUNNING_STATE,
+			exists: true,
+		},
+		{
+			name:        "terminated",
+			state:       statuspb.TERMINATED_STATE,
+			exists:      true,
+			expectError: true,
+		},
+		{
+			name:        "missing",
+			exists:      false,
+			expectError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Set up mock.
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockAgtMgr := mock_agent.NewMockManager(ctrl)
+			mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+			tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+			defer tracepointMgr.Close()
+
+			tpID := uuid.Must(uuid.NewV4())
+
+			if !test.exists {
+				mockTracepointStore.
+					EXPECT().
+					GetTracepointsWithNames([]string{"test1"}).
+					Return([]*uuid.UUID{nil}, nil)
+			} else {
+				mockTracepointStore.
+					EXPECT().
+					GetTracepointsWithNames([]string{"test1"}).
+					Return([]*uuid.UUID{&tpID}, nil)
+				mockTracepointStore.
+					EXPECT().
+					GetTracepoint(tpID).
+					Return(&storepb.TracepointInfo{
+						ID:            utils.ProtoFromUUID(tpID),
+						Name:          "test1",
+						ExpectedState: test.state,
+					}, nil)
+			}
+
+			if !test.expectError {
+				mockTracepointStore.
+					EXPECT().
+					SetTracepointTTL(tpID, 10*time.Minute).
+					Return(nil)
+			}
+
+			err := tracepointMgr.SetTracepointTTL("test1", 10*time.Minute)
+			if test.expectError {
+				assert.True(t, errors.Is(err, tracepoint.ErrTracepointNotFound))
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGetTracepointsWithNames(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+	defer tracepointMgr.Close()
+
+	tpID1 := uuid.Must(uuid.NewV4())
+	tpID2 := uuid.Must(uuid.NewV4())
+	expectedTracepoints := []*storepb.TracepointInfo{
+		{ID: utils.ProtoFromUUID(tpID1), Name: "test1"},
+		{ID: utils.ProtoFromUUID(tpID2), Name: "test2"},
+	}
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsWithNames([]string{"test1", "test2"}).
+		Return([]*uuid.UUID{&tpID1, &tpID2}, nil)
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsForIDs([]uuid.UUID{tpID1, tpID2}).
+		Return(expectedTracepoints, nil)
+
+	tps, err := tracepointMgr.GetTracepointsWithNames([]string{"test1", "test2"})
+	require.NoError(t, err)
+	assert.Equal(t, expectedTracepoints, tps)
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointsWithNames([]string{"test1", "test3"}).
+		Return([]*uuid.UUID{&tpID1, nil}, nil)
+
+	_, err = tracepointMgr.GetTracepointsWithNames([]string{"test1", "test3"})
+	assert.True(t, errors.Is(err, tracepoint.ErrTracepointNotFound))
+}
+
+func TestGetTracepointExpiries(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+	defer tracepointMgr.Close()
+
+	tpID1 := uuid.Must(uuid.NewV4())
+	tpID2 := uuid.Must(uuid.NewV4())
+	expiry1 := time.Unix(1000, 0)
+	expiry2 := time.Unix(2000, 0)
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointTTLs().
+		Return([]uuid.UUID{tpID1, tpID2}, []time.Time{expiry1, expiry2}, nil)
+
+	expiries, err := tracepointMgr.GetTracepointExpiries()
+	require.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID]time.Time{tpID1: expiry1, tpID2: expiry2}, expiries)
+}
+
+func TestUpdateAgentTracepointStatus_TerminatedOnDescopedAgent(t *testing.T) {
+	// Set up mock.
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+	defer tracepointMgr.Close()
+
+	agentUUID := uuid.Must(uuid.NewV4())
+	tpID := uuid.Must(uuid.NewV4())
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepoint(tpID).
+		Return(&storepb.TracepointInfo{ExpectedState: statuspb.RUNNING_STATE}, nil)
+
+	mockTracepointStore.
+		EXPECT().
+		DeleteTracepointState(tpID, agentUUID).
+		Return(nil)
+
+	err := tracepointMgr.UpdateAgentTracepointStatus(utils.ProtoFromUUID(tpID), utils.ProtoFromUUID(agentUUID), statuspb.TERMINATED_STATE, nil)
+	require.NoError(t, err)
+}
+
+// fakeAgentSelector selects a fixed set of agents for every selector.
+type fakeAgentSelector struct {
+	selected map[uuid.UUID]bool
+}
+
+func (f *fakeAgentSelector) SelectAgents(ctx context.Context, selector *storepb.TracepointAgentSelector, agents []*agentpb.Agent) (map[uuid.UUID]bool, error) {
+	return f.selected, nil
+}
+
+func testAgent(id uuid.UUID) *agentpb.Agent {
+	return &agentpb.Agent{
+		Info: &agentpb.AgentInfo{
+			AgentID: utils.ProtoFromUUID(id),
+		},
+	}
+}
+
+func TestSelectAgents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, 5*time.Second)
+	defer tracepointMgr.Close()
+
+	agentUUID1 := uuid.Must(uuid.NewV4())
+	agentUUID2 := uuid.Must(uuid.NewV4())
+	agents := []*agentpb.Agent{testAgent(agentUUID1), testAgent(agentUUID2)}
+	selector := &storepb.TracepointAgentSelector{NodeNames: []string{"node-1"}}
+
+	agentIDs, err := tracepointMgr.SelectAgents(nil, agents)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{agentUUID1, agentUUID2}, agentIDs)
+
+	_, err = tracepointMgr.SelectAgents(selector, agents)
+	assert.Equal(t, tracepoint.ErrAgentSelectorUnsupported, err)
+
+	tracepointMgr.SetAgentSelector(&fakeAgentSelector{selected: map[uuid.UUID]bool{agentUUID2: true}}, time.Hour)
+	agentIDs, err = tracepointMgr.SelectAgents(selector, agents)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{agentUUID2}, agentIDs)
+}
+
+func TestReconcileTracepointAgents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAgtMgr := mock_agent.NewMockManager(ctrl)
+	mockTracepointStore := mock_tracepoint.NewMockStore(ctrl)
+
+	tpID := uuid.Must(uuid.NewV4())
+	agentUUID1 := uuid.Must(uuid.NewV4())
+	agentUUID2 := uuid.Must(uuid.NewV4())
+	agentUUID3 := uuid.Must(uuid.NewV4())
+	program := &logicalpb.TracepointDeployment{
+		Programs: []*logicalpb.TracepointDeployment_TracepointProgram{
+			{
+				TableName: "test",
+			},
+		},
+	}
+
+	mockTracepointStore.
+		EXPECT().
+		GetTracepoints().
+		Return([]*storepb.TracepointInfo{
+			{
+				ID:            utils.ProtoFromUUID(tpID),
+				Tracepoint:    program,
+				ExpectedState: statuspb.RUNNING_STATE,
+				AgentSelector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-1"}},
+			},
+			{
+				ID:            utils.ProtoFromUUID(uuid.Must(uuid.NewV4())),
+				ExpectedState: statuspb.RUNNING_STATE,
+			},
+		}, nil).
+		AnyTimes()
+
+	mockAgtMgr.
+		EXPECT().
+		GetActiveAgents().
+		Return([]*agentpb.Agent{testAgent(agentUUID1), testAgent(agentUUID2), testAgent(agentUUID3)}, nil).
+		AnyTimes()
+
+	// The tracepoint runs on agent 2, which is still selected, and on agent 3, which no longer is.
+	mockTracepointStore.
+		EXPECT().
+		GetTracepointStates(tpID).
+		Return([]*storepb.AgentTracepointStatus{
+			{ID: utils.ProtoFromUUID(tpID), AgentID: utils.ProtoFromUUID(agentUUID2), State: statuspb.RUNNING_STATE},
+			{ID: utils.ProtoFromUUID(tpID), AgentID: utils.ProtoFromUUID(agentUUID3), State: statuspb.RUNNING_STATE},
+		}, nil).
+		AnyTimes()
+
+	mockTracepointStore.
+		EXPECT().
+		UpdateTracepointState(&storepb.AgentTracepointStatus{
+			ID:      utils.ProtoFromUUID(tpID),
+			AgentID: utils.ProtoFromUUID(agentUUID1),
+			State:   statuspb.PENDING_STATE,
+		}).
+		Return(nil).
+		AnyTimes()
+
+	var mu sync.Mutex
+	registered := make(map[uuid.UUID]bool)
+	removed := make(map[uuid.UUID]bool)
+	done := make(chan struct{})
+	var doneOnce sync.Once
+
+	mockAgtMgr.
+		EXPECT().
+		MessageAgents(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(agentIDs []uuid.UUID, msg []byte) error {
+			vzMsg := &messagespb.VizierMessage{}
+			err := proto.Unmarshal(msg, vzMsg)
+			require.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, agentID := range agentIDs {
+				if req := vzMsg.GetTracepointMessage().GetRegisterTracepointRequest(); req != nil {
+					assert.Equal(t, program, req.TracepointDeployment)
+					registered[agentID] = true
+				}
+				if req := vzMsg.GetTracepointMessage().GetRemoveTracepointRequest(); req != nil {
+					assert.Equal(t, tpID, utils.UUIDFromProtoOrNil(req.ID))
+					removed[agentID] = true
+				}
+			}
+			if len(registered) > 0 && len(removed) > 0 {
+				doneOnce.Do(func() { close(done) })
+			}
+			return nil
+		}).
+		AnyTimes()
+
+	tracepointMgr := tracepoint.NewManager(mockTracepointStore, mockAgtMgr, time.Hour)
+	defer tracepointMgr.Close()
+	tracepointMgr.SetAgentSelector(&fakeAgentSelector{
+		selected: map[uuid.UUID]bool{agentUUID1: true, agentUUID2: true},
+	}, 10*time.Millisecond)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the tracepoint agents to be reconciled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[uuid.UUID]bool{agentUUID1: true}, registered)
+	assert.Equal(t, map[uuid.UUID]bool{agentUUID3: true}, removed)
+}
@@ -21,6 +21,8 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -34,7 +36,10 @@ import (
 	"go.etcd.io/etcd/client/pkg/v3/transport"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
+	"px.dev/pixie/src/operator/client/versioned"
 	version "px.dev/pixie/src/shared/goversion"
 	"px.dev/pixie/src/shared/services"
 	"px.dev/pixie/src/shared/services/election"
@@ -44,12 +49,15 @@ import (
 	"px.dev/pixie/src/shared/services/server"
 	"px.dev/pixie/src/vizier/services/metadata/controllers"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/agent"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/agentconfig"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/cronscript"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/k8smeta"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/querylog"
 	"px.dev/pixie/src/vizier/services/metadata/controllers/tracepoint"
 	"px.dev/pixie/src/vizier/services/metadata/metadataenv"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/utils/datastore"
+	"px.dev/pixie/src/vizier/utils/datastore/backup"
 	"px.dev/pixie/src/vizier/utils/datastore/etcd"
 	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
 )
@@ -61,6 +69,10 @@ const (
 	pebbleOpenDir = "/metadata/pebble_20220209"
 	// metadataBaseMount is the base volume mount if we are running a PVC backed metadata.
 	metadataBaseMount = "/metadata"
+	// etcdMigrateTimeout is how long to wait for etcd to respond before skipping the migration from it.
+	etcdMigrateTimeout = 10 * time.Second
+	// queryLogPurgeInterval is how often the query log entries older than the retention are deleted.
+	queryLogPurgeInterval = 10 * time.Minute
 )
 
 func init() {
@@ -71,6 +83,11 @@ func init() {
 	pflag.String("pod_namespace", "pl", "The namespace this pod runs in. Used for leader elections")
 	pflag.String("nats_url", "pl-nats", "The URL of NATS")
 	pflag.Bool("use_etcd_operator", false, "Whether the etcd operator should be used instead of the persistent version.")
+	pflag.Duration("query_log_retention", 7*24*time.Hour, "How long the executed queries are kept in the query log.")
+	pflag.Duration("k8s_metadata_history_retention", 7*24*time.Hour, "How long past K8s metadata is kept for looking up resources as of a past time.")
+	pflag.Duration("tracepoint_reconcile_interval", 30*time.Second, "How often the agents of tracepoints with an agent selector, and the tracepoint custom resources, are reconciled.")
+	pflag.String("datastore_restore_path", "", "The path of a datastore backup to restore on startup, if the metadata datastore is empty.")
+	pflag.Bool("datastore_migrate", false, "Whether to copy the metadata from the other datastore backend (etcd or pebble) on startup, if the metadata datastore is empty.")
 
 	// Metadata flags are set using the env vars in pl-cluster-config.
 	// We historically set PL_ETCD_OPERATOR_ENABLED but not PL_USE_ETCD_OPERATOR in the configmap.
@@ -80,23 +97,28 @@ func init() {
 	viper.BindEnv("use_etcd_operator", "PL_ETCD_OPERATOR_ENABLED")
 }
 
-func mustInitEtcdDatastore() (*etcd.DataStore, func()) {
-	log.Infof("Using etcd: %s for metadata", viper.GetString("md_etcd_server"))
+// newEtcdClient creates a client for the metadata etcd server.
+func newEtcdClient() (*clientv3.Client, error) {
 	var tlsConfig *tls.Config
 	if !viper.GetBool("disable_ssl") {
 		var err error
 		tlsConfig, err = etcdTLSConfig()
 		if err != nil {
-			log.WithError(err).Fatal("Failed to load SSL for ETCD")
+			return nil, fmt.Errorf("failed to load SSL for etcd: %w", err)
 		}
 	}
 
-	// Connect to etcd.
-	etcdClient, err := clientv3.New(clientv3.Config{
+	return clientv3.New(clientv3.Config{
 		Endpoints:   []string{viper.GetString("md_etcd_server")},
 		DialTimeout: 5 * time.Second,
 		TLS:         tlsConfig,
 	})
+}
+
+func mustInitEtcdDatastore() (*etcd.DataStore, func()) {
+	log.Infof("Using etcd: %s for metadata", viper.GetString("md_etcd_server"))
+	// Connect to etcd.
+	etcdClient, err := newEtcdClient()
 	if err != nil {
 		log.WithError(err).Fatalf("Failed to connect to etcd at %s. Please check status and logs for `pl-etcd` pods in the cluster.", viper.GetString("md_etcd_server"))
 	}
@@ -140,6 +162,109 @@ func mustInitPebbleDatastore() *pebbledb.DataStore {
 	return pebbledb.New(pebbleDb, pebbledbTTLDuration)
 }
 
+// errDatastoreNotEmpty stops the scan of the datastore at its first key.
+var errDatastoreNotEmpty = errors.New("datastore is not empty")
+
+func isDatastoreEmpty(ds datastore.Snapshotter) bool {
+	err := ds.Snapshot(func(datastore.KeyValue) error {
+		return errDatastoreNotEmpty
+	})
+	if err == errDatastoreNotEmpty {
+		return false
+	}
+	if err != nil {
+		log.WithError(err).Fatal("Failed to read the metadata datastore")
+	}
+	return true
+}
+
+// mustRestoreDatastore restores the backup at the given path into the datastore, unless the datastore already
+// has data, so that the backup is only restored once.
+func mustRestoreDatastore(ds datastore.MultiGetterSetterDeleterCloser, path string) {
+	if !isDatastoreEmpty(ds.(datastore.Snapshotter)) {
+		log.Infof("Metadata datastore is not empty, skipping the restore of %s", path)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.WithError(err).Fatalf("Failed to open datastore backup %s", path)
+	}
+	defer f.Close()
+
+	n, err := backup.Import(ds, f)
+	if err != nil {
+		log.WithError(err).Fatalf("Failed to restore datastore backup %s", path)
+	}
+	log.Infof("Restored %d keys from datastore backup %s", n, path)
+}
+
+// mustMigrateDatastore copies the metadata from the datastore backend that isn't in use into the datastore,
+// unless the datastore already has data.
+func mustMigrateDatastore(ds datastore.MultiGetterSetterDeleterCloser) {
+	if !isDatastoreEmpty(ds.(datastore.Snapshotter)) {
+		log.Info("Metadata datastore is not empty, skipping the datastore migration")
+		return
+	}
+
+	var from datastore.Snapshotter
+	if viper.GetBool("use_etcd_operator") {
+		if _, err := os.Stat(pebbleOpenDir); err != nil {
+			log.WithError(err).Info("No pebble datastore to migrate from")
+			return
+		}
+		pebbleDb, err := pebble.Open(pebbleOpenDir, &pebble.Options{})
+		if err != nil {
+			log.WithError(err).Fatal("Failed to open pebble database to migrate from")
+		}
+		pebbleDs := pebbledb.New(pebbleDb, pebbledbTTLDuration)
+		defer pebbleDs.Close()
+		from = pebbleDs
+	} else {
+		// etcd may have been removed along with the operator that managed it, in which case there is nothing to
+		// migrate.
+		etcdClient, err := newEtcdClient()
+		if err != nil {
+			log.WithError(err).Warn("Failed to connect to etcd, skipping the datastore migration")
+			return
+		}
+		defer etcdClient.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), etcdMigrateTimeout)
+		_, err = etcdClient.Get(ctx, "\x00", clientv3.WithFromKey(), clientv3.WithCountOnly())
+		cancel()
+		if err != nil {
+			log.WithError(err).Warnf("etcd at %s is unavailable, skipping the datastore migration", viper.GetString("md_etcd_server"))
+			return
+		}
+		from = etcd.New(etcdClient)
+	}
+
+	n, err := backup.Migrate(from, ds)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to migrate the metadata datastore")
+	}
+	log.Infof("Migrated %d keys into the metadata datastore", n)
+}
+
+// datastoreBackupHandler streams a backup of the datastore as it is read, which can be restored with the
+// datastore_restore_path flag.
+func datastoreBackupHandler(ds datastore.Snapshotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="metadata_backup.jsonl"`)
+		n, err := backup.Export(ds, w)
+		if err != nil {
+			// The response has likely been partially written, so the error can't be reported in its status.
+			log.WithError(err).Error("Failed to export the metadata datastore")
+			return
+		}
+		log.Infof("Exported %d keys from the metadata datastore", n)
+	}
+}
+
 func etcdTLSConfig() (*tls.Config, error) {
 	tlsCert := viper.GetString("client_tls_cert")
 	tlsKey := viper.GetString("client_tls_key")
@@ -227,6 +352,13 @@ func main() {
 	}
 	defer dataStore.Close()
 
+	if viper.GetBool("datastore_migrate") {
+		mustMigrateDatastore(dataStore)
+	}
+	if path := viper.GetString("datastore_restore_path"); path != "" {
+		mustRestoreDatastore(dataStore, path)
+	}
+
 	k8sMds := k8smeta.NewDatastore(dataStore)
 	// Listen for K8s metadata updates.
 	updateCh := make(chan *k8smeta.K8sResourceMessage)
@@ -235,6 +367,28 @@ func main() {
 	k8sMc, err := k8smeta.NewController(updateCh)
 	defer k8sMc.Stop()
 
+	historyQuitCh := make(chan struct{})
+	defer close(historyQuitCh)
+	go func() {
+		historyTimer := time.NewTicker(1 * time.Hour)
+		defer historyTimer.Stop()
+		for {
+			select {
+			case <-historyQuitCh:
+				return
+			case <-historyTimer.C:
+				// Only the leader writes to the metadata store.
+				if !isLeader {
+					continue
+				}
+				historyErr := k8sMds.CompactResourceHistory(time.Now().Add(-viper.GetDuration("k8s_metadata_history_retention")))
+				if historyErr != nil {
+					log.WithError(historyErr).Info("Failed to compact K8s metadata history")
+				}
+			}
+		}
+	}()
+
 	ads := agent.NewDatastore(dataStore, 24*time.Hour)
 	agtMgr := agent.NewManager(ads, mdh, nc)
 
@@ -261,7 +415,33 @@ func main() {
 	tracepointMgr := tracepoint.NewManager(tds, agtMgr, 30*time.Second)
 	defer tracepointMgr.Close()
 
-	mc, err := controllers.NewMessageBusController(nc, agtMgr, tracepointMgr,
+	// Deploying tracepoints on a subset of the cluster requires looking up its nodes and pods, and tracepoints are
+	// declared by the custom resources in the Vizier namespace.
+	if kubeConfig, err := rest.InClusterConfig(); err != nil {
+		log.WithError(err).Info("Not running in a K8s cluster, tracepoint agent selectors and custom resources are disabled")
+	} else {
+		clientset, err := kubernetes.NewForConfig(kubeConfig)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to create K8s client.")
+		}
+		tracepointMgr.SetAgentSelector(tracepoint.NewK8sAgentSelector(clientset), viper.GetDuration("tracepoint_reconcile_interval"))
+
+		vzClient, err := versioned.NewForConfig(kubeConfig)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to create Vizier CRD client.")
+		}
+		tpReconciler := tracepoint.NewCRDReconciler(tracepointMgr, vzClient, viper.GetString("pod_namespace"))
+		tpReconciler.Start(viper.GetDuration("tracepoint_reconcile_interval"), &isLeader)
+		defer tpReconciler.Close()
+	}
+
+	// Config settings are rolled out to the agents selected the same way as the agents of tracepoints.
+	cfgMgr := agentconfig.NewManager(agentconfig.NewDatastore(dataStore), agtMgr, tracepointMgr)
+
+	// The agent handlers publish the lifecycle events of the agents, which the server streams to clients.
+	agentEvents := controllers.NewAgentEventBroadcaster()
+
+	mc, err := controllers.NewMessageBusController(nc, agtMgr, tracepointMgr, cfgMgr, agentEvents,
 		mdh, &isLeader)
 
 	if err != nil {
@@ -277,11 +457,17 @@ func main() {
 	mux := http.NewServeMux()
 	healthz.RegisterDefaultChecks(mux)
 	metrics.MustRegisterMetricsHandlerNoDefaultMetrics(mux)
+	mux.Handle("/datastore/backup", datastoreBackupHandler(dataStore.(datastore.Snapshotter)))
 
-	svr := controllers.NewServer(env, dataStore, agtMgr, tracepointMgr)
+	svr := controllers.NewServer(env, dataStore, agtMgr, tracepointMgr, cfgMgr, agentEvents)
 
 	csDs := cronscript.NewDatastore(dataStore)
-	cronScriptSvr := cronscript.New(csDs)
+	cronScriptSvr := cronscript.New(csDs, nc)
+
+	qlDs := querylog.NewDatastore(dataStore, viper.GetDuration("query_log_retention"))
+	qlDs.StartPurge(queryLogPurgeInterval, &isLeader)
+	defer qlDs.Close()
+	queryLogSvr := querylog.New(qlDs)
 
 	log.Infof("Metadata Server: %s", version.GetVersion().ToString())
 
@@ -295,6 +481,7 @@ func main() {
 	metadatapb.RegisterMetadataTracepointServiceServer(s.GRPCServer(), svr)
 	metadatapb.RegisterMetadataConfigServiceServer(s.GRPCServer(), svr)
 	metadatapb.RegisterCronScriptStoreServiceServer(s.GRPCServer(), cronScriptSvr)
+	metadatapb.RegisterMetadataQueryLogServiceServer(s.GRPCServer(), queryLogSvr)
 
 	s.Start()
 	s.StopOnInterrupt()
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	admissionRunningGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "query_admission_running",
+		Help: "The number of queries that have been admitted and are currently executing.",
+	})
+	admissionQueuedGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "query_admission_queued",
+		Help: "The number of queries waiting to be admitted, by priority.",
+	}, []string{"priority"})
+	admissionRejectedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "query_admission_rejected_total",
+		Help: "The number of queries rejected by admission control, by priority and reason.",
+	}, []string{"priority", "reason"})
+	admissionWaitSummary = promauto.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "query_admission_wait_time_ms",
+		Help: "A summary of the time in milliseconds that admitted queries spent waiting in the queue.",
+	}, []string{"priority"})
+)
+
+func init() {
+	pflag.Int("max_concurrent_queries", 64, "The maximum number of queries that can execute at once across all query broker replicas. 0 means no limit.")
+	pflag.Int("max_concurrent_queries_per_user", 0, "The maximum number of queries a single user can execute at once across all query broker replicas. 0 means no limit.")
+	pflag.Int("max_queued_queries", 256, "The maximum number of queries that can wait for admission across all query broker replicas. Queries beyond this are rejected.")
+	pflag.Duration("query_queue_timeout", 30*time.Second, "How long a query can wait for admission before it is rejected.")
+}
+
+// QueryPriority determines the order in which queued queries are admitted.
+type QueryPriority int
+
+const (
+	// QueryPriorityBackground is the priority of queries run by background jobs, such as cron scripts.
+	QueryPriorityBackground QueryPriority = iota
+	// QueryPriorityInteractive is the priority of queries run by users.
+	QueryPriorityInteractive
+)
+
+func (p QueryPriority) String() string {
+	if p == QueryPriorityBackground {
+		return "background"
+	}
+	return "interactive"
+}
+
+// queryPriorityFromName returns the priority of a query based on the name of the script that launched it.
+func queryPriorityFromName(queryName string) QueryPriority {
+	if strings.HasPrefix(queryName, "cron_") {
+		return QueryPriorityBackground
+	}
+	return QueryPriorityInteractive
+}
+
+// AdmissionControllerOpts configures the limits enforced by an AdmissionController. The limits apply to the
+// query broker as a whole, each replica enforces its share of them (see SetReplicas).
+type AdmissionControllerOpts struct {
+	// The maximum number of queries that can execute at once. 0 means no limit.
+	MaxConcurrent int
+	// The maximum number of queries a single user can execute at once. 0 means no limit.
+	MaxConcurrentPerUser int
+	// The maximum number of queries that can wait for admission.
+	MaxQueued int
+	// How long a query can wait for admission before it is rejected.
+	QueueTimeout time.Duration
+}
+
+type admissionWaiter struct {
+	user       string
+	priority   QueryPriority
+	admittedCh chan struct{}
+	admitted   bool
+}
+
+// AdmissionController limits the number of queries that execute concurrently. Queries that can't run
+// immediately wait in a bounded queue, and are admitted in priority order as running queries finish.
+type AdmissionController struct {
+	opts AdmissionControllerOpts
+
+	mu sync.Mutex
+	// The share of the limits enforced by this replica.
+	limits AdmissionControllerOpts
+
+	running       int
+	runningByUser map[string]int
+	// Waiting queries, ordered by descending priority and then by arrival.
+	queue []*admissionWaiter
+}
+
+// NewAdmissionController creates a new AdmissionController.
+func NewAdmissionController(opts AdmissionControllerOpts) *AdmissionController {
+	return &AdmissionController{
+		opts:          opts,
+		limits:        opts,
+		runningByUser: make(map[string]int),
+	}
+}
+
+// NewAdmissionControllerFromFlags creates a new AdmissionController using the limits configured by flags.
+func NewAdmissionControllerFromFlags() *AdmissionController {
+	return NewAdmissionController(AdmissionControllerOpts{
+		MaxConcurrent:        viper.GetInt("max_concurrent_queries"),
+		MaxConcurrentPerUser: viper.GetInt("max_concurrent_queries_per_user"),
+		MaxQueued:            viper.GetInt("max_queued_queries"),
+		QueueTimeout:         viper.GetDuration("query_queue_timeout"),
+	})
+}
+
+// replicaShare returns the part of a limit enforced by one of the given number of replicas. The share is
+// rounded up, so a limit lower than the number of replicas may be exceeded by up to one query per replica.
+func replicaShare(limit, replicas int) int {
+	if limit <= 0 || replicas <= 1 {
+		return limit
+	}
+	return (limit + replicas - 1) / replicas
+}
+
+// SetReplicas sets the number of query broker replicas that share the limits. Running queries count
+// against the new limits, and queued queries are admitted if the limits were raised.
+func (a *AdmissionController) SetReplicas(replicas int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.limits = AdmissionControllerOpts{
+		MaxConcurrent:        replicaShare(a.opts.MaxConcurrent, replicas),
+		MaxConcurrentPerUser: replicaShare(a.opts.MaxConcurrentPerUser, replicas),
+		MaxQueued:            replicaShare(a.opts.MaxQueued, replicas),
+		QueueTimeout:         a.opts.QueueTimeout,
+	}
+	a.dispatchLocked()
+}
+
+// canRunLocked returns whether a query for the given user fits within the limits. Must hold the lock.
+func (a *AdmissionController) canRunLocked(user string) bool {
+	if a.limits.MaxConcurrent > 0 && a.running >= a.limits.MaxConcurrent {
+		return false
+	}
+	if a.limits.MaxConcurrentPerUser > 0 && a.runningByUser[user] >= a.limits.MaxConcurrentPerUser {
+		return false
+	}
+	return true
+}
+
+func (a *AdmissionController) startLocked(user string) {
+	a.running++
+	a.runningByUser[user]++
+	admissionRunningGauge.Inc()
+}
+
+func (a *AdmissionController) release(user string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.running--
+	a.runningByUser[user]--
+	if a.runningByUser[user] <= 0 {
+		delete(a.runningByUser, user)
+	}
+	admissionRunningGauge.Dec()
+	a.dispatchLocked()
+}
+
+// dispatchLocked admits waiting queries, in queue order, until no more fit within the limits.
+func (a *AdmissionController) dispatchLocked() {
+	remaining := a.queue[:0]
+	for _, w := range a.queue {
+		if !a.canRunLocked(w.user) {
+			remaining = append(remaining, w)
+			continue
+		}
+		a.startLocked(w.user)
+		w.admitted = true
+		admissionQueuedGauge.WithLabelValues(w.priority.String()).Dec()
+		close(w.admittedCh)
+	}
+	a.queue = remaining
+}
+
+func (a *AdmissionController) enqueueLocked(w *admissionWaiter) {
+	i := len(a.queue)
+	for i > 0 && a.queue[i-1].priority < w.priority {
+		i--
+	}
+	a.queue = append(a.queue, nil)
+	copy(a.queue[i+1:], a.queue[i:])
+	a.queue[i] = w
+	admissionQueuedGauge.WithLabelValues(w.priority.String()).Inc()
+}
+
+func (a *AdmissionController) removeLocked(w *admissionWaiter) {
+	for i, queued := range a.queue {
+		if queued == w {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			admissionQueuedGauge.WithLabelValues(w.priority.String()).Dec()
+			return
+		}
+	}
+}
+
+func (a *AdmissionController) releaseFunc(user string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() { a.release(user) })
+	}
+}
+
+// Admit blocks until a query for the given user may run, and returns a func that must be called once the
+// query completes. A ResourceExhausted error is returned if the queue is full or the query waited too long.
+func (a *AdmissionController) Admit(ctx context.Context, user string, priority QueryPriority) (func(), error) {
+	a.mu.Lock()
+	if a.canRunLocked(user) {
+		a.startLocked(user)
+		a.mu.Unlock()
+		return a.releaseFunc(user), nil
+	}
+	if len(a.queue) >= a.limits.MaxQueued {
+		a.mu.Unlock()
+		admissionRejectedCounter.WithLabelValues(priority.String(), "queue_full").Inc()
+		return nil, status.Error(codes.ResourceExhausted,
+			"too many queries are running on this cluster and the queue is full, please retry later")
+	}
+	w := &admissionWaiter{
+		user:       user,
+		priority:   priority,
+		admittedCh: make(chan struct{}),
+	}
+	a.enqueueLocked(w)
+	a.mu.Unlock()
+
+	start := time.Now()
+	t := time.NewTimer(a.opts.QueueTimeout)
+	defer t.Stop()
+
+	var err error
+	select {
+	case <-w.admittedCh:
+		admissionWaitSummary.WithLabelValues(priority.String()).Observe(float64(time.Since(start).Milliseconds()))
+		return a.releaseFunc(user), nil
+	case <-t.C:
+		err = status.Errorf(codes.ResourceExhausted,
+			"query was not admitted after waiting %s because too many queries are running on this cluster, please retry later",
+			a.opts.QueueTimeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	a.mu.Lock()
+	admitted := w.admitted
+	if !admitted {
+		a.removeLocked(w)
+	}
+	a.mu.Unlock()
+	// The query may have been admitted after we stopped waiting, in which case we give back its slot.
+	if admitted {
+		a.release(user)
+	}
+	if status.Code(err) == codes.ResourceExhausted {
+		admissionRejectedCounter.WithLabelValues(priority.String(), "queue_timeout").Inc()
+	}
+	return nil, err
+}
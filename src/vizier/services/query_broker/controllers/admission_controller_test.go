@@ -0,0 +1,209 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+)
+
+type admitResult struct {
+	release func()
+	err     error
+}
+
+func admitAsync(ctx context.Context, a *controllers.AdmissionController, user string, priority controllers.QueryPriority) chan admitResult {
+	ch := make(chan admitResult, 1)
+	go func() {
+		release, err := a.Admit(ctx, user, priority)
+		ch <- admitResult{release, err}
+	}()
+	return ch
+}
+
+func requireNotAdmitted(t *testing.T, ch chan admitResult) {
+	select {
+	case <-ch:
+		t.Fatal("Query was admitted unexpectedly")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func requireAdmitted(t *testing.T, ch chan admitResult) func() {
+	select {
+	case res := <-ch:
+		require.NoError(t, res.err)
+		return res.release
+	case <-time.After(time.Second):
+		t.Fatal("Query was not admitted")
+	}
+	return nil
+}
+
+func TestAdmissionController_GlobalLimitAndQueueFull(t *testing.T) {
+	a := controllers.NewAdmissionController(controllers.AdmissionControllerOpts{
+		MaxConcurrent: 2,
+		MaxQueued:     1,
+		QueueTimeout:  time.Minute,
+	})
+	ctx := context.Background()
+
+	release1, err := a.Admit(ctx, "a", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+	_, err = a.Admit(ctx, "b", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+
+	queued := admitAsync(ctx, a, "c", controllers.QueryPriorityInteractive)
+	requireNotAdmitted(t, queued)
+
+	// The queue only holds one query.
+	_, err = a.Admit(ctx, "d", controllers.QueryPriorityInteractive)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	release1()
+	// Releasing more than once is a no-op.
+	release1()
+	requireAdmitted(t, queued)
+}
+
+func TestAdmissionController_PerUserLimit(t *testing.T) {
+	a := controllers.NewAdmissionController(controllers.AdmissionControllerOpts{
+		MaxConcurrentPerUser: 1,
+		MaxQueued:            10,
+		QueueTimeout:         time.Minute,
+	})
+	ctx := context.Background()
+
+	release, err := a.Admit(ctx, "a", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+
+	queued := admitAsync(ctx, a, "a", controllers.QueryPriorityInteractive)
+	requireNotAdmitted(t, queued)
+
+	// Other users are not affected by the first user's limit.
+	_, err = a.Admit(ctx, "b", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+
+	release()
+	requireAdmitted(t, queued)
+}
+
+func TestAdmissionController_Priority(t *testing.T) {
+	a := controllers.NewAdmissionController(controllers.AdmissionControllerOpts{
+		MaxConcurrent: 1,
+		MaxQueued:     10,
+		QueueTimeout:  time.Minute,
+	})
+	ctx := context.Background()
+
+	release, err := a.Admit(ctx, "a", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+
+	background := admitAsync(ctx, a, "cron", controllers.QueryPriorityBackground)
+	requireNotAdmitted(t, background)
+	interactive := admitAsync(ctx, a, "b", controllers.QueryPriorityInteractive)
+	requireNotAdmitted(t, interactive)
+
+	// The interactive query is admitted first, even though it arrived later.
+	release()
+	release = requireAdmitted(t, interactive)
+	requireNotAdmitted(t, background)
+
+	release()
+	requireAdmitted(t, background)
+}
+
+func TestAdmissionController_QueueTimeout(t *testing.T) {
+	a := controllers.NewAdmissionController(controllers.AdmissionControllerOpts{
+		MaxConcurrent: 1,
+		MaxQueued:     1,
+		QueueTimeout:  50 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	release, err := a.Admit(ctx, "a", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+
+	_, err = a.Admit(ctx, "b", controllers.QueryPriorityInteractive)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// The timed out query was removed from the queue, so it doesn't take the slot once it frees up.
+	release()
+	_, err = a.Admit(ctx, "c", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+}
+
+func TestAdmissionController_ContextCancelled(t *testing.T) {
+	a := controllers.NewAdmissionController(controllers.AdmissionControllerOpts{
+		MaxConcurrent: 1,
+		MaxQueued:     1,
+		QueueTimeout:  time.Minute,
+	})
+
+	release, err := a.Admit(context.Background(), "a", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := admitAsync(ctx, a, "b", controllers.QueryPriorityInteractive)
+	requireNotAdmitted(t, queued)
+	cancel()
+
+	select {
+	case res := <-queued:
+		assert.Equal(t, context.Canceled, res.err)
+	case <-time.After(time.Second):
+		t.Fatal("Query was not cancelled")
+	}
+
+	// The cancelled query doesn't hold a slot once the running query finishes.
+	release()
+	_, err = a.Admit(context.Background(), "c", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+}
+
+func TestAdmissionController_SetReplicas(t *testing.T) {
+	a := controllers.NewAdmissionController(controllers.AdmissionControllerOpts{
+		MaxConcurrent: 4,
+		MaxQueued:     4,
+		QueueTimeout:  time.Minute,
+	})
+	ctx := context.Background()
+
+	// With two replicas, this replica may only run half of the queries.
+	a.SetReplicas(2)
+	_, err := a.Admit(ctx, "a", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+	_, err = a.Admit(ctx, "b", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+
+	queued := admitAsync(ctx, a, "c", controllers.QueryPriorityInteractive)
+	requireNotAdmitted(t, queued)
+
+	// The queued query is admitted once the other replica goes away.
+	a.SetReplicas(1)
+	requireAdmitted(t, queued)
+}
@@ -0,0 +1,346 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	svcutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+func init() {
+	pflag.Duration("agent_health_check_interval", 30*time.Second, "How often the health of each agent is checked")
+	pflag.Duration("agent_probe_timeout", 10*time.Second, "The timeout of the probe query sent to each agent")
+}
+
+const (
+	// AgentHealthChannel is the NATS subject on which the replica of the query broker that checks the health of
+	// the agents publishes the results, so that every replica can serve them.
+	AgentHealthChannel = "QueryBroker.AgentHealth"
+
+	agentProbeQueryName = "agent_probe"
+	// The timeout of the request listing the agents, which is separate from the timeout of each probe.
+	agentInfoRequestTimeout = 10 * time.Second
+	// The table preferred for probing the data of an agent, since every PEM collects it.
+	agentProbeTable = "process_stats"
+	// The maximum number of agents probed at the same time.
+	maxConcurrentAgentProbes = 16
+)
+
+// isHealthCheckQuery returns whether the query was launched by the query broker to check the health of Vizier.
+func isHealthCheckQuery(queryName string) bool {
+	return queryName == healthCheckQueryName || queryName == agentProbeQueryName
+}
+
+// AgentProber runs a probe query on a single agent.
+type AgentProber interface {
+	// ProbeAgent runs a query reading the table on the agent. If the table is empty, the query doesn't read any data.
+	ProbeAgent(ctx context.Context, agentID uuid.UUID, table string) error
+}
+
+// AgentHealthChecker periodically checks the health of each agent: its registration state, heartbeats, the tables
+// it has data for and whether it accepts queries. Only the leader replica of the query broker runs the checks, and
+// shares their results with the other replicas.
+type AgentHealthChecker struct {
+	mds           metadatapb.MetadataServiceClient
+	signingKey    string
+	agentsTracker AgentsTracker
+	prober        AgentProber
+
+	interval     time.Duration
+	probeTimeout time.Duration
+
+	agentsMu sync.Mutex
+	agents   []*vizierpb.AgentHealth
+
+	nc  *nats.Conn
+	sub *nats.Subscription
+
+	quitCh   chan struct{}
+	quitOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewAgentHealthCheckerFromFlags creates a new AgentHealthChecker with the intervals configured by flags.
+func NewAgentHealthCheckerFromFlags(mds metadatapb.MetadataServiceClient, signingKey string, agentsTracker AgentsTracker,
+	prober AgentProber) *AgentHealthChecker {
+	return NewAgentHealthChecker(mds, signingKey, agentsTracker, prober,
+		viper.GetDuration("agent_health_check_interval"), viper.GetDuration("agent_probe_timeout"))
+}
+
+// NewAgentHealthChecker creates a new AgentHealthChecker.
+func NewAgentHealthChecker(mds metadatapb.MetadataServiceClient, signingKey string, agentsTracker AgentsTracker,
+	prober AgentProber, interval time.Duration, probeTimeout time.Duration) *AgentHealthChecker {
+	return &AgentHealthChecker{
+		mds:           mds,
+		signingKey:    signingKey,
+		agentsTracker: agentsTracker,
+		prober:        prober,
+		interval:      interval,
+		probeTimeout:  probeTimeout,
+		quitCh:        make(chan struct{}),
+	}
+}
+
+// Share publishes the results of the checks run by this replica to the other replicas, and keeps the results
+// published by the replica that runs the checks. It must be called before Start.
+func (c *AgentHealthChecker) Share(nc *nats.Conn) error {
+	sub, err := nc.Subscribe(AgentHealthChannel, c.handleAgentHealth)
+	if err != nil {
+		return err
+	}
+	c.nc = nc
+	c.sub = sub
+	return nil
+}
+
+func (c *AgentHealthChecker) handleAgentHealth(msg *nats.Msg) {
+	resp := &vizierpb.HealthCheckResponse{}
+	if err := resp.Unmarshal(msg.Data); err != nil {
+		log.WithError(err).Error("Failed to unmarshal agent health")
+		return
+	}
+	c.setAgents(resp.Agents)
+}
+
+func (c *AgentHealthChecker) setAgents(agents []*vizierpb.AgentHealth) {
+	c.agentsMu.Lock()
+	defer c.agentsMu.Unlock()
+	c.agents = agents
+}
+
+func (c *AgentHealthChecker) publish(agents []*vizierpb.AgentHealth) {
+	if c.nc == nil {
+		return
+	}
+	data, err := (&vizierpb.HealthCheckResponse{Agents: agents}).Marshal()
+	if err == nil {
+		err = c.nc.Publish(AgentHealthChannel, data)
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to publish agent health")
+	}
+}
+
+// Start starts checking the health of the agents in the background. It should only be called on the leader.
+func (c *AgentHealthChecker) Start() {
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Stop stops checking the health of the agents, and receiving the results of the other replicas.
+func (c *AgentHealthChecker) Stop() {
+	c.quitOnce.Do(func() { close(c.quitCh) })
+	c.wg.Wait()
+	if c.sub != nil {
+		_ = c.sub.Unsubscribe()
+	}
+}
+
+func (c *AgentHealthChecker) run() {
+	defer c.wg.Done()
+
+	// A check isn't bounded by the interval, each probe has its own timeout instead. Checks are only cancelled
+	// when the checker stops.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.quitCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		agents, err := c.Check(ctx)
+		if err != nil {
+			log.WithError(err).Error("Failed to check the health of the agents")
+		} else {
+			c.setAgents(agents)
+			c.publish(agents)
+		}
+
+		select {
+		case <-c.quitCh:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Agents returns the health of each agent as of the last check. The returned slice must not be modified.
+func (c *AgentHealthChecker) Agents() []*vizierpb.AgentHealth {
+	c.agentsMu.Lock()
+	defer c.agentsMu.Unlock()
+	return c.agents
+}
+
+// Check checks the health of each agent registered with the metadata service.
+func (c *AgentHealthChecker) Check(ctx context.Context) ([]*vizierpb.AgentHealth, error) {
+	claims := svcutils.GenerateJWTForService("query_broker", "vizier")
+	token, err := svcutils.SignJWTClaims(claims, c.signingKey)
+	if err != nil {
+		return nil, err
+	}
+	mdsCtx, cancel := context.WithTimeout(ctx, agentInfoRequestTimeout)
+	defer cancel()
+	mdsCtx = metadata.AppendToOutgoingContext(mdsCtx, "authorization", fmt.Sprintf("bearer %s", token))
+	resp, err := c.mds.GetAgentInfo(mdsCtx, &metadatapb.AgentInfoRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	tables := agentTables(c.agentsTracker)
+	agents := make([]*vizierpb.AgentHealth, 0, len(resp.Info))
+	for _, md := range resp.Info {
+		agentID := utils.UUIDFromProtoOrNil(md.Agent.GetInfo().GetAgentID())
+		agents = append(agents, &vizierpb.AgentHealth{
+			AgentID:            agentID.String(),
+			Hostname:           md.Agent.GetInfo().GetHostInfo().GetHostname(),
+			PodName:            md.Agent.GetInfo().GetHostInfo().GetPodName(),
+			CollectsData:       md.Agent.GetInfo().GetCapabilities() == nil || md.Agent.GetInfo().GetCapabilities().CollectsData,
+			State:              md.Status.GetState().String(),
+			LastHeartbeatAgeNS: md.Status.GetNSSinceLastHeartbeat(),
+			Tables:             tables[agentID],
+		})
+	}
+
+	sem := make(chan struct{}, maxConcurrentAgentProbes)
+	var wg sync.WaitGroup
+	for _, agent := range agents {
+		if agent.State != agentpb.AGENT_STATE_HEALTHY.String() {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(agent *vizierpb.AgentHealth) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			c.probe(ctx, agent)
+		}(agent)
+	}
+	wg.Wait()
+
+	for _, agent := range agents {
+		agent.Healthy = agent.State == agentpb.AGENT_STATE_HEALTHY.String() &&
+			agent.ProbeStatus.GetCode() == int32(codes.OK)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		if agents[i].Hostname != agents[j].Hostname {
+			return agents[i].Hostname < agents[j].Hostname
+		}
+		return agents[i].AgentID < agents[j].AgentID
+	})
+	return agents, nil
+}
+
+// probe runs the probe query on the agent and records the result in its health.
+func (c *AgentHealthChecker) probe(ctx context.Context, agent *vizierpb.AgentHealth) {
+	table := ""
+	if agent.CollectsData && len(agent.Tables) > 0 {
+		table = agent.Tables[0]
+		for _, t := range agent.Tables {
+			if t == agentProbeTable {
+				table = t
+				break
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.probeTimeout)
+	defer cancel()
+	start := time.Now()
+	err := c.prober.ProbeAgent(ctx, uuid.FromStringOrNil(agent.AgentID), table)
+	agent.ProbeLatencyNS = time.Since(start).Nanoseconds()
+	if err != nil {
+		log.WithError(err).WithField("agent_id", agent.AgentID).WithField("hostname", agent.Hostname).
+			Info("Agent failed the probe query")
+		agent.ProbeStatus = ErrToVizierStatus(err)
+		return
+	}
+	agent.ProbeStatus = &vizierpb.Status{Code: int32(codes.OK)}
+}
+
+// agentTables returns the sorted names of the tables that each agent has data for.
+func agentTables(agentsTracker AgentsTracker) map[uuid.UUID][]string {
+	tables := make(map[uuid.UUID][]string)
+	info := agentsTracker.GetAgentInfo()
+	if info == nil {
+		return tables
+	}
+	for _, schema := range info.DistributedState().SchemaInfo {
+		for _, agentID := range schema.AgentList {
+			id := utils.UUIDFromProtoOrNil(agentID)
+			tables[id] = append(tables[id], schema.Name)
+		}
+	}
+	for _, names := range tables {
+		sort.Strings(names)
+	}
+	return tables
+}
+
+// ServeHTTP responds with the health of each agent encoded as a JSON HealthCheckResponse. The status code is
+// 503 ServiceUnavailable if any agent is unhealthy, so that the operator can use the response as a health check.
+func (c *AgentHealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	agents := c.Agents()
+	resp := &vizierpb.HealthCheckResponse{
+		Status: &vizierpb.Status{Code: int32(codes.OK)},
+		Agents: agents,
+	}
+	for _, agent := range agents {
+		if !agent.Healthy {
+			resp.Status = &vizierpb.Status{Code: int32(codes.Unavailable), Message: "some agents are unhealthy"}
+			break
+		}
+	}
+
+	m := jsonpb.Marshaler{}
+	body, err := m.MarshalToString(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status.Code != int32(codes.OK) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write([]byte(body))
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/carnot/planner/distributedpb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/utils/testingutils"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	mock_metadatapb "px.dev/pixie/src/vizier/services/metadata/metadatapb/mock"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+	"px.dev/pixie/src/vizier/services/query_broker/tracker"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+var (
+	healthyPEMID      = uuid.FromStringOrNil("11285cdd-1de9-4ab1-ae6a-0ba08c8c676c")
+	failingPEMID      = uuid.FromStringOrNil("21285cdd-1de9-4ab1-ae6a-0ba08c8c676c")
+	unresponsivePEMID = uuid.FromStringOrNil("31285cdd-1de9-4ab1-ae6a-0ba08c8c676c")
+	kelvinID          = uuid.FromStringOrNil("41285cdd-1de9-4ab1-ae6a-0ba08c8c676c")
+)
+
+type fakeAgentProber struct {
+	mu        sync.Mutex
+	probed    map[uuid.UUID]string
+	deadlines map[uuid.UUID]time.Time
+	errs      map[uuid.UUID]error
+}
+
+func (f *fakeAgentProber) ProbeAgent(ctx context.Context, agentID uuid.UUID, table string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.probed[agentID] = table
+	f.deadlines[agentID], _ = ctx.Deadline()
+	return f.errs[agentID]
+}
+
+func agentMetadata(agentID uuid.UUID, hostname string, collectsData bool, state agentpb.AgentState) *metadatapb.AgentMetadata {
+	return &metadatapb.AgentMetadata{
+		Agent: &agentpb.Agent{
+			Info: &agentpb.AgentInfo{
+				AgentID:      utils.ProtoFromUUID(agentID),
+				HostInfo:     &agentpb.HostInfo{Hostname: hostname, PodName: hostname + "-pod"},
+				Capabilities: &agentpb.AgentCapabilities{CollectsData: collectsData},
+			},
+		},
+		Status: &agentpb.AgentStatus{
+			State:                state,
+			NSSinceLastHeartbeat: 1000,
+		},
+	}
+}
+
+func setupAgentHealthChecker(ctrl *gomock.Controller) (*controllers.AgentHealthChecker, *fakeAgentProber) {
+	mds := mock_metadatapb.NewMockMetadataServiceClient(ctrl)
+	mds.EXPECT().
+		GetAgentInfo(gomock.Any(), &metadatapb.AgentInfoRequest{}).
+		Return(&metadatapb.AgentInfoResponse{
+			Info: []*metadatapb.AgentMetadata{
+				agentMetadata(unresponsivePEMID, "node-3", true, agentpb.AGENT_STATE_UNRESPONSIVE),
+				agentMetadata(failingPEMID, "node-2", true, agentpb.AGENT_STATE_HEALTHY),
+				agentMetadata(healthyPEMID, "node-1", true, agentpb.AGENT_STATE_HEALTHY),
+				agentMetadata(kelvinID, "kelvin", false, agentpb.AGENT_STATE_HEALTHY),
+			},
+		}, nil).
+		AnyTimes()
+
+	agentsInfo := tracker.NewTestAgentsInfo(&distributedpb.DistributedState{
+		SchemaInfo: []*distributedpb.SchemaInfo{
+			{
+				Name:      "process_stats",
+				AgentList: []*uuidpb.UUID{utils.ProtoFromUUID(healthyPEMID), utils.ProtoFromUUID(unresponsivePEMID)},
+			},
+			{
+				Name:      "http_events",
+				AgentList: []*uuidpb.UUID{utils.ProtoFromUUID(healthyPEMID), utils.ProtoFromUUID(failingPEMID)},
+			},
+		},
+	})
+
+	prober := &fakeAgentProber{
+		probed:    make(map[uuid.UUID]string),
+		deadlines: make(map[uuid.UUID]time.Time),
+		errs: map[uuid.UUID]error{
+			failingPEMID: errors.New("failed to initialize all result tables"),
+		},
+	}
+	c := controllers.NewAgentHealthChecker(mds, "jwt-key", &fakeAgentsTracker{agentsInfo: agentsInfo}, prober,
+		time.Minute, time.Second)
+	return c, prober
+}
+
+func TestAgentHealthChecker_Check(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c, prober := setupAgentHealthChecker(ctrl)
+	start := time.Now()
+	agents, err := c.Check(context.Background())
+	require.NoError(t, err)
+
+	// Unresponsive agents aren't probed, the others are probed with their preferred table.
+	assert.Equal(t, map[uuid.UUID]string{
+		healthyPEMID: "process_stats",
+		failingPEMID: "http_events",
+		kelvinID:     "",
+	}, prober.probed)
+	// Each probe has its own deadline.
+	for _, deadline := range prober.deadlines {
+		assert.WithinDuration(t, start.Add(time.Second), deadline, 500*time.Millisecond)
+	}
+
+	require.Len(t, agents, 4)
+	// The agents are sorted by hostname.
+	assert.Equal(t, kelvinID.String(), agents[0].AgentID)
+	assert.True(t, agents[0].Healthy)
+	assert.False(t, agents[0].CollectsData)
+	assert.Empty(t, agents[0].Tables)
+
+	assert.Equal(t, healthyPEMID.String(), agents[1].AgentID)
+	assert.Equal(t, "node-1", agents[1].Hostname)
+	assert.Equal(t, "node-1-pod", agents[1].PodName)
+	assert.Equal(t, "AGENT_STATE_HEALTHY", agents[1].State)
+	assert.Equal(t, int64(1000), agents[1].LastHeartbeatAgeNS)
+	assert.Equal(t, []string{"http_events", "process_stats"}, agents[1].Tables)
+	assert.Equal(t, int32(codes.OK), agents[1].ProbeStatus.Code)
+	assert.True(t, agents[1].Healthy)
+
+	assert.Equal(t, failingPEMID.String(), agents[2].AgentID)
+	assert.Equal(t, int32(codes.Unknown), agents[2].ProbeStatus.Code)
+	assert.Equal(t, "failed to initialize all result tables", agents[2].ProbeStatus.Message)
+	assert.False(t, agents[2].Healthy)
+
+	assert.Equal(t, unresponsivePEMID.String(), agents[3].AgentID)
+	assert.Equal(t, "AGENT_STATE_UNRESPONSIVE", agents[3].State)
+	assert.Nil(t, agents[3].ProbeStatus)
+	assert.False(t, agents[3].Healthy)
+}
+
+func TestAgentHealthChecker_ServeHTTP(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	c, _ := setupAgentHealthChecker(ctrl)
+	c.Start()
+	defer c.Stop()
+	require.Eventually(t, func() bool { return len(c.Agents()) == 4 }, 5*time.Second, 10*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/agents/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"hostname":"node-2"`)
+	assert.Contains(t, w.Body.String(), "some agents are unhealthy")
+}
+
+func TestAgentHealthChecker_Share(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	leader, _ := setupAgentHealthChecker(ctrl)
+	require.NoError(t, leader.Share(nc))
+	follower, _ := setupAgentHealthChecker(ctrl)
+	require.NoError(t, follower.Share(nc))
+	defer follower.Stop()
+
+	// Only the leader runs the checks, the follower serves the results that the leader publishes.
+	leader.Start()
+	defer leader.Stop()
+	require.Eventually(t, func() bool { return len(follower.Agents()) == 4 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, leader.Agents(), follower.Agents())
+}
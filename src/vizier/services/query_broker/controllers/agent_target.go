@@ -0,0 +1,257 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"px.dev/pixie/src/api/proto/uuidpb"
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/carnot/planner/distributedpb"
+	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+// AgentSelector selects the agents that a query targeting a subset of the cluster runs on.
+type AgentSelector interface {
+	// SelectAgents returns the IDs of the agents, out of the given hosts, that match the target.
+	SelectAgents(ctx context.Context, target *vizierpb.AgentTarget, hosts map[uuid.UUID]*agentpb.HostInfo) (map[uuid.UUID]bool, error)
+}
+
+// isEmptyAgentTarget returns whether the target doesn't restrict the agents a query runs on.
+func isEmptyAgentTarget(target *vizierpb.AgentTarget) bool {
+	return target == nil || (len(target.NodeNames) == 0 && len(target.NodeLabels) == 0 && len(target.Namespaces) == 0 &&
+		len(target.PodLabels) == 0)
+}
+
+// agentTargetToTracepointSelector converts the target of a mutation script to the selector of the agents its
+// tracepoints are deployed on. Returns nil if the target doesn't restrict the agents.
+func agentTargetToTracepointSelector(target *vizierpb.AgentTarget) *storepb.TracepointAgentSelector {
+	if isEmptyAgentTarget(target) {
+		return nil
+	}
+	return &storepb.TracepointAgentSelector{
+		NodeNames:  target.NodeNames,
+		NodeLabels: target.NodeLabels,
+		Namespaces: target.Namespaces,
+		PodLabels:  target.PodLabels,
+	}
+}
+
+// tracepointSelectorToAgentTarget converts the selector of the agents a setting applies to back to the target it was
+// created from. Returns nil if the selector doesn't restrict the agents.
+func tracepointSelectorToAgentTarget(selector *storepb.TracepointAgentSelector) *vizierpb.AgentTarget {
+	if selector == nil {
+		return nil
+	}
+	target := &vizierpb.AgentTarget{
+		NodeNames:  selector.NodeNames,
+		NodeLabels: selector.NodeLabels,
+		Namespaces: selector.Namespaces,
+		PodLabels:  selector.PodLabels,
+	}
+	if isEmptyAgentTarget(target) {
+		return nil
+	}
+	return target
+}
+
+// k8sAgentSelector matches agents to the K8s nodes selected by a target.
+type k8sAgentSelector struct {
+	nodes  corelisters.NodeLister
+	pods   corelisters.PodLister
+	synced []cache.InformerSynced
+}
+
+// NewK8sAgentSelector creates an AgentSelector that looks up the nodes and pods of the cluster in a cache, which is
+// kept up to date by watching the K8s API until quitCh is closed.
+func NewK8sAgentSelector(clientset kubernetes.Interface, quitCh <-chan struct{}) AgentSelector {
+	factory := informers.NewSharedInformerFactory(clientset, 12*time.Hour)
+	nodeInformer := factory.Core().V1().Nodes()
+	podInformer := factory.Core().V1().Pods()
+	s := &k8sAgentSelector{
+		nodes:  nodeInformer.Lister(),
+		pods:   podInformer.Lister(),
+		synced: []cache.InformerSynced{nodeInformer.Informer().HasSynced, podInformer.Informer().HasSynced},
+	}
+	factory.Start(quitCh)
+	return s
+}
+
+// selectNodes returns the nodes matching the names and labels of the target.
+func (s *k8sAgentSelector) selectNodes(target *vizierpb.AgentTarget) ([]*v1.Node, error) {
+	nodes, err := s.nodes.List(labels.SelectorFromSet(target.NodeLabels))
+	if err != nil {
+		return nil, err
+	}
+	if len(target.NodeNames) == 0 {
+		return nodes, nil
+	}
+	names := make(map[string]bool, len(target.NodeNames))
+	for _, name := range target.NodeNames {
+		names[name] = true
+	}
+	var selected []*v1.Node
+	for _, node := range nodes {
+		if names[node.Name] {
+			selected = append(selected, node)
+		}
+	}
+	return selected, nil
+}
+
+// podNodes returns the names of the nodes hosting pods with the labels in any of the namespaces.
+// If there are no namespaces, pods in all namespaces are considered.
+func (s *k8sAgentSelector) podNodes(namespaces []string, podLabels map[string]string) (map[string]bool, error) {
+	selector := labels.SelectorFromSet(podLabels)
+	var pods []*v1.Pod
+	if len(namespaces) == 0 {
+		all, err := s.pods.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		pods = all
+	}
+	for _, ns := range namespaces {
+		nsPods, err := s.pods.Pods(ns).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, nsPods...)
+	}
+	nodeNames := make(map[string]bool)
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" {
+			nodeNames[pod.Spec.NodeName] = true
+		}
+	}
+	return nodeNames, nil
+}
+
+// nodeMatchesHost returns whether the agent running on the host is on the node.
+func nodeMatchesHost(node *v1.Node, host *agentpb.HostInfo) bool {
+	if host.Hostname == node.Name {
+		return true
+	}
+	for _, addr := range node.Status.Addresses {
+		if host.HostIP != "" && addr.Address == host.HostIP {
+			return true
+		}
+		if addr.Type == v1.NodeHostName && addr.Address == host.Hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectAgents returns the IDs of the agents running on the nodes that match the target.
+func (s *k8sAgentSelector) SelectAgents(ctx context.Context, target *vizierpb.AgentTarget, hosts map[uuid.UUID]*agentpb.HostInfo) (map[uuid.UUID]bool, error) {
+	// The cache is only empty right after startup, until the nodes and pods are first listed.
+	if !cache.WaitForCacheSync(ctx.Done(), s.synced...) {
+		return nil, errors.New("timed out waiting for the K8s nodes and pods to be cached")
+	}
+	nodes, err := s.selectNodes(target)
+	if err != nil {
+		return nil, err
+	}
+	if len(target.Namespaces) > 0 || len(target.PodLabels) > 0 {
+		nsNodes, err := s.podNodes(target.Namespaces, target.PodLabels)
+		if err != nil {
+			return nil, err
+		}
+		var filtered []*v1.Node
+		for _, node := range nodes {
+			if nsNodes[node.Name] {
+				filtered = append(filtered, node)
+			}
+		}
+		nodes = filtered
+	}
+
+	selected := make(map[uuid.UUID]bool)
+	for agentID, host := range hosts {
+		for _, node := range nodes {
+			if nodeMatchesHost(node, host) {
+				selected[agentID] = true
+				break
+			}
+		}
+	}
+	return selected, nil
+}
+
+// hasCarnot returns whether the agent is one of the Carnot instances of the state.
+func hasCarnot(state *distributedpb.DistributedState, agentID uuid.UUID) bool {
+	for _, carnot := range state.CarnotInfo {
+		if utils.UUIDFromProtoOrNil(carnot.AgentID) == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// filterDistributedState returns a copy of the state that only contains the selected data collecting agents. Agents
+// that don't collect data, such as Kelvin, are always kept since they are needed to merge the results of the others.
+// It returns the IDs of the data collecting agents that were kept.
+func filterDistributedState(state *distributedpb.DistributedState, selected map[uuid.UUID]bool) (*distributedpb.DistributedState, []uuid.UUID) {
+	filtered := &distributedpb.DistributedState{}
+	var kept []uuid.UUID
+	for _, carnot := range state.CarnotInfo {
+		if !carnot.HasDataStore || carnot.AcceptsRemoteSources {
+			filtered.CarnotInfo = append(filtered.CarnotInfo, carnot)
+			continue
+		}
+		agentID := utils.UUIDFromProtoOrNil(carnot.AgentID)
+		if selected[agentID] {
+			filtered.CarnotInfo = append(filtered.CarnotInfo, carnot)
+			kept = append(kept, agentID)
+		}
+	}
+
+	keptSet := make(map[uuid.UUID]bool, len(filtered.CarnotInfo))
+	for _, carnot := range filtered.CarnotInfo {
+		keptSet[utils.UUIDFromProtoOrNil(carnot.AgentID)] = true
+	}
+	// The schemas are shared with other queries, so the agent lists are filtered on copies.
+	for _, schema := range state.SchemaInfo {
+		agentList := make([]*uuidpb.UUID, 0, len(schema.AgentList))
+		for _, agentID := range schema.AgentList {
+			if keptSet[utils.UUIDFromProtoOrNil(agentID)] {
+				agentList = append(agentList, agentID)
+			}
+		}
+		filtered.SchemaInfo = append(filtered.SchemaInfo, &distributedpb.SchemaInfo{
+			Name:      schema.Name,
+			Relation:  schema.Relation,
+			AgentList: agentList,
+		})
+	}
+	return filtered, kept
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
+)
+
+func testNode(name string, ip string, labels map[string]string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: ip}},
+		},
+	}
+}
+
+func testPod(namespace string, name string, nodeName string, labels map[string]string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Spec:       v1.PodSpec{NodeName: nodeName},
+	}
+}
+
+func TestK8sAgentSelector_SelectAgents(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		testNode("node-1", "10.0.0.1", map[string]string{"pool": "a"}),
+		testNode("node-2", "10.0.0.2", map[string]string{"pool": "a"}),
+		testNode("node-3", "10.0.0.3", map[string]string{"pool": "b"}),
+		testPod("payments", "checkout", "node-2", map[string]string{"app": "checkout"}),
+		testPod("payments", "billing", "node-3", map[string]string{"app": "billing"}),
+		testPod("staging", "checkout", "node-1", map[string]string{"app": "checkout"}),
+	)
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	selector := controllers.NewK8sAgentSelector(clientset, quitCh)
+
+	agent1 := uuid.Must(uuid.NewV4())
+	agent2 := uuid.Must(uuid.NewV4())
+	agent3 := uuid.Must(uuid.NewV4())
+	hosts := map[uuid.UUID]*agentpb.HostInfo{
+		agent1: {Hostname: "node-1", HostIP: "10.0.0.1"},
+		// Agents are matched by IP when their hostname differs from the node name.
+		agent2: {Hostname: "ip-10-0-0-2", HostIP: "10.0.0.2"},
+		agent3: {Hostname: "node-3", HostIP: "10.0.0.3"},
+	}
+
+	tests := []struct {
+		name     string
+		target   *vizierpb.AgentTarget
+		expected map[uuid.UUID]bool
+	}{
+		{
+			name:     "node names",
+			target:   &vizierpb.AgentTarget{NodeNames: []string{"node-1", "node-2"}},
+			expected: map[uuid.UUID]bool{agent1: true, agent2: true},
+		},
+		{
+			name:     "node labels",
+			target:   &vizierpb.AgentTarget{NodeLabels: map[string]string{"pool": "b"}},
+			expected: map[uuid.UUID]bool{agent3: true},
+		},
+		{
+			name:     "namespaces",
+			target:   &vizierpb.AgentTarget{Namespaces: []string{"payments"}},
+			expected: map[uuid.UUID]bool{agent2: true, agent3: true},
+		},
+		{
+			name:     "pod labels",
+			target:   &vizierpb.AgentTarget{PodLabels: map[string]string{"app": "checkout"}},
+			expected: map[uuid.UUID]bool{agent1: true, agent2: true},
+		},
+		{
+			name: "pod labels in namespaces",
+			target: &vizierpb.AgentTarget{
+				Namespaces: []string{"payments"},
+				PodLabels:  map[string]string{"app": "checkout"},
+			},
+			expected: map[uuid.UUID]bool{agent2: true},
+		},
+		{
+			name: "all criteria must match",
+			target: &vizierpb.AgentTarget{
+				NodeLabels: map[string]string{"pool": "a"},
+				Namespaces: []string{"payments"},
+			},
+			expected: map[uuid.UUID]bool{agent2: true},
+		},
+		{
+			name:     "no match",
+			target:   &vizierpb.AgentTarget{NodeNames: []string{"node-4"}},
+			expected: map[uuid.UUID]bool{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := selector.SelectAgents(context.Background(), test.target, hosts)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, selected)
+		})
+	}
+}
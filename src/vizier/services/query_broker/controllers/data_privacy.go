@@ -21,42 +21,249 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
 
+	"px.dev/pixie/src/api/proto/vizierpb"
 	"px.dev/pixie/src/carnot/planner/distributedpb"
+	"px.dev/pixie/src/shared/services/authcontext"
 
 	pixie "px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/operator/client/versioned"
 )
 
+// How often the data access policies are reloaded from the Vizier CRD.
+const dataAccessPolicyRefreshPeriod = 30 * time.Second
+
 func init() {
 	pflag.String("data_access", "Full", "The data access level for queries. Options are 'Full' or 'Restricted' or 'PIIRestricted")
 }
 
+// DataAccessDecision is the data access level applied to a query, along with the policies that determined it.
+type DataAccessDecision struct {
+	Level pixie.DataAccessLevel
+	// The names of the policies that determined the level. Empty if the default level was used.
+	Policies []string
+}
+
+// RedactionOptions returns the proto message containing options for redaction at the decided level.
+func (d *DataAccessDecision) RedactionOptions() *distributedpb.RedactionOptions {
+	if d.Level == pixie.DataAccessFull {
+		return nil
+	}
+	return &distributedpb.RedactionOptions{
+		UseFullRedaction:         d.Level == pixie.DataAccessRestricted,
+		UsePxRedactPiiBestEffort: d.Level == pixie.DataAccessPIIRestricted,
+	}
+}
+
+// ToProto converts the decision to the proto reported in query metadata.
+func (d *DataAccessDecision) ToProto() *vizierpb.DataAccessInfo {
+	return &vizierpb.DataAccessInfo{
+		Level:    string(d.Level),
+		Policies: d.Policies,
+	}
+}
+
+// dataAccessRestrictiveness orders data access levels from the least to the most restrictive.
+func dataAccessRestrictiveness(level pixie.DataAccessLevel) int {
+	switch level {
+	case pixie.DataAccessRestricted:
+		return 2
+	case pixie.DataAccessPIIRestricted:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isValidDataAccessLevel(level pixie.DataAccessLevel) bool {
+	switch level {
+	case pixie.DataAccessFull, pixie.DataAccessRestricted, pixie.DataAccessPIIRestricted:
+		return true
+	default:
+		return false
+	}
+}
+
+// dataAccessCaller is the identity of the caller that a data access policy is matched against.
+type dataAccessCaller struct {
+	email     string
+	userID    string
+	isAPIUser bool
+}
+
+func dataAccessCallerFromContext(ctx context.Context) *dataAccessCaller {
+	caller := &dataAccessCaller{}
+	aCtx, err := authcontext.FromContext(ctx)
+	if err != nil || aCtx.Claims == nil {
+		return caller
+	}
+	if userClaims := aCtx.Claims.GetUserClaims(); userClaims != nil {
+		caller.email = userClaims.Email
+		caller.userID = userClaims.UserID
+		caller.isAPIUser = userClaims.IsAPIUser
+		return caller
+	}
+	// Cluster tokens issued by Pixie Cloud are signed with the email, or ID, of the cloud user.
+	if clusterClaims := aCtx.Claims.GetClusterClaims(); clusterClaims != nil {
+		if strings.Contains(clusterClaims.User, "@") {
+			caller.email = clusterClaims.User
+		} else {
+			caller.userID = clusterClaims.User
+		}
+	}
+	return caller
+}
+
+func (c *dataAccessCaller) matchesUser(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if c.userID != "" && pattern == c.userID {
+		return true
+	}
+	if c.email == "" {
+		return false
+	}
+	if strings.HasPrefix(pattern, "*@") {
+		return strings.HasSuffix(strings.ToLower(c.email), strings.ToLower(pattern[1:]))
+	}
+	return strings.EqualFold(pattern, c.email)
+}
+
+func policyAppliesToCaller(policy *pixie.DataAccessPolicy, caller *dataAccessCaller) bool {
+	if policy.APIKeyUsers != nil && *policy.APIKeyUsers != caller.isAPIUser {
+		return false
+	}
+	if len(policy.Users) == 0 {
+		return true
+	}
+	for _, user := range policy.Users {
+		if caller.matchesUser(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateDataAccessPolicies returns the most restrictive level of the policies that apply to the caller, or the
+// default level if none apply.
+func evaluateDataAccessPolicies(defaultLevel pixie.DataAccessLevel, policies []pixie.DataAccessPolicy,
+	caller *dataAccessCaller) *DataAccessDecision {
+	var decision *DataAccessDecision
+	for i := range policies {
+		policy := &policies[i]
+		if !policyAppliesToCaller(policy, caller) {
+			continue
+		}
+		if decision == nil {
+			decision = &DataAccessDecision{Level: policy.DataAccess}
+		} else if dataAccessRestrictiveness(policy.DataAccess) > dataAccessRestrictiveness(decision.Level) {
+			decision.Level = policy.DataAccess
+		}
+		decision.Policies = append(decision.Policies, policy.Name)
+	}
+	if decision == nil {
+		return &DataAccessDecision{Level: defaultLevel}
+	}
+	return decision
+}
+
 type vizierCachedDataPrivacy struct {
 	dataAccess pixie.DataAccessLevel
+
+	mu       sync.RWMutex
+	policies []pixie.DataAccessPolicy
+}
+
+// DataAccess returns the data access level for the request, based on the caller.
+func (dp *vizierCachedDataPrivacy) DataAccess(ctx context.Context, req *vizierpb.ExecuteScriptRequest) (*DataAccessDecision, error) {
+	dp.mu.RLock()
+	defer dp.mu.RUnlock()
+	return evaluateDataAccessPolicies(dp.dataAccess, dp.policies, dataAccessCallerFromContext(ctx)), nil
+}
+
+// NewPolicyDataPrivacy creates a privacy manager that applies the given data access policies, and the default level
+// to requests that none of the policies apply to.
+func NewPolicyDataPrivacy(dataAccess pixie.DataAccessLevel, policies []pixie.DataAccessPolicy) DataPrivacy {
+	dp := &vizierCachedDataPrivacy{dataAccess: dataAccess}
+	dp.setPolicies(policies)
+	return dp
 }
 
-// RedactionOptions returns the proto message containing options for redaction based on the cached data privacy level.
-func (dp *vizierCachedDataPrivacy) RedactionOptions(ctx context.Context) (*distributedpb.RedactionOptions, error) {
-	if dp.dataAccess == pixie.DataAccessFull {
-		return nil, nil
+func (dp *vizierCachedDataPrivacy) setPolicies(policies []pixie.DataAccessPolicy) {
+	var valid []pixie.DataAccessPolicy
+	for _, policy := range policies {
+		if !isValidDataAccessLevel(policy.DataAccess) {
+			log.Errorf("Ignoring data access policy '%s' with invalid DataAccess: '%s'", policy.Name, policy.DataAccess)
+			continue
+		}
+		valid = append(valid, policy)
 	}
-	return &distributedpb.RedactionOptions{
-		UseFullRedaction:         dp.dataAccess == pixie.DataAccessRestricted,
-		UsePxRedactPiiBestEffort: dp.dataAccess == pixie.DataAccessPIIRestricted,
-	}, nil
+
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	dp.policies = valid
+}
+
+func (dp *vizierCachedDataPrivacy) loadPoliciesFromCRD(vzClient *versioned.Clientset, ns string) error {
+	viziers, err := vzClient.PxV1alpha1().Viziers(ns).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	var policies []pixie.DataAccessPolicy
+	if len(viziers.Items) > 0 {
+		policies = viziers.Items[0].Spec.DataAccessPolicies
+	}
+	dp.setPolicies(policies)
+	return nil
 }
 
-// CreateDataPrivacyManager creates a privacy manager for the namespace.
+// watchPolicies keeps the data access policies in sync with the Vizier CRD in the namespace.
+func (dp *vizierCachedDataPrivacy) watchPolicies(vzClient *versioned.Clientset, ns string) {
+	t := time.NewTicker(dataAccessPolicyRefreshPeriod)
+	defer t.Stop()
+	for range t.C {
+		if err := dp.loadPoliciesFromCRD(vzClient, ns); err != nil {
+			log.WithError(err).Error("Failed to refresh data access policies")
+		}
+	}
+}
+
+// CreateDataPrivacyManager creates a privacy manager for the namespace. The default data access level is set by flag,
+// and is overridden by the data access policies in the namespace's Vizier CRD, if any.
 func CreateDataPrivacyManager(ns string) (DataPrivacy, error) {
 	dataAccessStr := viper.GetString("data_access")
 	dataAccess := pixie.DataAccessLevel(dataAccessStr)
-	switch dataAccess {
-	case pixie.DataAccessFull, pixie.DataAccessRestricted, pixie.DataAccessPIIRestricted:
-		return &vizierCachedDataPrivacy{dataAccess}, nil
-	default:
+	if !isValidDataAccessLevel(dataAccess) {
 		return nil, fmt.Errorf("Invalid DataAccess: '%s'", dataAccessStr)
 	}
+	dp := &vizierCachedDataPrivacy{dataAccess: dataAccess}
+
+	// Policies are only available when Vizier is deployed through the operator.
+	kubeConfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.WithError(err).Info("Not running in a K8s cluster, data access policies are disabled")
+		return dp, nil
+	}
+	vzClient, err := versioned.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	// Starting without the policies could give users more access than they should have, so we only continue
+	// if the Vizier CRD isn't installed at all.
+	if err := dp.loadPoliciesFromCRD(vzClient, ns); err != nil && !k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to load data access policies: %w", err)
+	}
+	go dp.watchPolicies(vzClient, ns)
+	return dp, nil
 }
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	pixie "px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/shared/services/authcontext"
+	"px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+)
+
+func namespaceScriptRequest(namespace string) *vizierpb.ExecuteScriptRequest {
+	return &vizierpb.ExecuteScriptRequest{
+		QueryStr: "import px\ndef ns(namespace: str):\n  return px.DataFrame('http_events')\n",
+		ExecFuncs: []*vizierpb.ExecuteScriptRequest_FuncToExecute{
+			{
+				FuncName: "ns",
+				ArgValues: []*vizierpb.ExecuteScriptRequest_FuncToExecute_ArgValue{
+					{Name: "namespace", Value: namespace},
+				},
+				OutputTablePrefix: "ns",
+			},
+		},
+	}
+}
+
+func userCtx(email string) context.Context {
+	aCtx := authcontext.New()
+	aCtx.Claims = utils.GenerateJWTForUser("6ba7b810-9dad-11d1-80b4-00c04fd430c8", "org", email, time.Now().Add(time.Hour), "withpixie.ai")
+	return authcontext.NewContext(context.Background(), aCtx)
+}
+
+func TestDataPrivacy_DataAccess(t *testing.T) {
+	trueVal := true
+	policies := []pixie.DataAccessPolicy{
+		{
+			Name:       "platform-team",
+			Users:      []string{"*@platform.example.com", "admin@example.com"},
+			DataAccess: pixie.DataAccessFull,
+		},
+		{
+			Name:        "api-keys",
+			APIKeyUsers: &trueVal,
+			DataAccess:  pixie.DataAccessPIIRestricted,
+		},
+		{
+			Name:       "contractors",
+			Users:      []string{"*@contractor.example.com"},
+			DataAccess: pixie.DataAccessRestricted,
+		},
+	}
+	dp := controllers.NewPolicyDataPrivacy(pixie.DataAccessPIIRestricted, policies)
+
+	apiKeyCtx := func() context.Context {
+		aCtx := authcontext.New()
+		aCtx.Claims = utils.GenerateJWTForAPIUser("6ba7b810-9dad-11d1-80b4-00c04fd430c8", "org", time.Now().Add(time.Hour), "withpixie.ai")
+		return authcontext.NewContext(context.Background(), aCtx)
+	}
+	clusterCtx := func(user string) context.Context {
+		aCtx := authcontext.New()
+		aCtx.Claims = utils.GenerateJWTForCluster("vizier_cluster", "vizier")
+		aCtx.Claims.GetClusterClaims().User = user
+		ctx := authcontext.NewContext(context.Background(), aCtx)
+		// Metadata sent alongside the token isn't signed, so it must not be trusted as the caller's identity.
+		return metadata.NewIncomingContext(ctx, metadata.Pairs("px-cloud-user", "admin@example.com"))
+	}
+
+	tests := []struct {
+		name             string
+		ctx              context.Context
+		expectedLevel    pixie.DataAccessLevel
+		expectedPolicies []string
+	}{
+		{
+			name:          "default level when no policy applies",
+			ctx:           userCtx("dev@example.com"),
+			expectedLevel: pixie.DataAccessPIIRestricted,
+		},
+		{
+			name:             "user matched by email domain",
+			ctx:              userCtx("jane@platform.example.com"),
+			expectedLevel:    pixie.DataAccessFull,
+			expectedPolicies: []string{"platform-team"},
+		},
+		{
+			name:             "user matched by email",
+			ctx:              userCtx("Admin@example.com"),
+			expectedLevel:    pixie.DataAccessFull,
+			expectedPolicies: []string{"platform-team"},
+		},
+		{
+			name:             "api key user",
+			ctx:              apiKeyCtx(),
+			expectedLevel:    pixie.DataAccessPIIRestricted,
+			expectedPolicies: []string{"api-keys"},
+		},
+		{
+			name:             "cloud user from the signed cluster token",
+			ctx:              clusterCtx("bob@contractor.example.com"),
+			expectedLevel:    pixie.DataAccessRestricted,
+			expectedPolicies: []string{"contractors"},
+		},
+		{
+			name:          "cluster token without a user",
+			ctx:           clusterCtx(""),
+			expectedLevel: pixie.DataAccessPIIRestricted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision, err := dp.DataAccess(test.ctx, namespaceScriptRequest("default"))
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedLevel, decision.Level)
+			assert.Equal(t, test.expectedPolicies, decision.Policies)
+		})
+	}
+}
+
+func TestDataPrivacy_RedactionOptions(t *testing.T) {
+	full := &controllers.DataAccessDecision{Level: pixie.DataAccessFull}
+	assert.Nil(t, full.RedactionOptions())
+
+	restricted := &controllers.DataAccessDecision{Level: pixie.DataAccessRestricted}
+	assert.True(t, restricted.RedactionOptions().UseFullRedaction)
+
+	pii := &controllers.DataAccessDecision{Level: pixie.DataAccessPIIRestricted, Policies: []string{"p"}}
+	assert.True(t, pii.RedactionOptions().UsePxRedactPiiBestEffort)
+	assert.Equal(t, &vizierpb.DataAccessInfo{Level: "PIIRestricted", Policies: []string{"p"}}, pii.ToProto())
+}
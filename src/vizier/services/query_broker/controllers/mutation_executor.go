@@ -118,6 +118,7 @@ func (m *MutationExecutorImpl) Execute(ctx context.Context, req *vizierpb.Execut
 	}
 	configmapReqs := make([]*metadatapb.UpdateConfigRequest, 0)
 
+	agentSelector := agentTargetToTracepointSelector(req.AgentTarget)
 	outputTablesMap := make(map[string]bool)
 	// TODO(zasgar): We should make sure that we don't simultaneously add and delete the tracepoint.
 	// While this will probably work, we should restrict this because it's likely not the intended behavior.
@@ -131,6 +132,7 @@ func (m *MutationExecutorImpl) Execute(ctx context.Context, req *vizierpb.Execut
 						TracepointDeployment: mut.Trace,
 						Name:                 mut.Trace.Name,
 						TTL:                  mut.Trace.TTL,
+						AgentSelector:        agentSelector,
 					})
 
 				if _, ok := m.activeTracepoints[name]; ok {
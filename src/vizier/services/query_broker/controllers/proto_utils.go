@@ -39,6 +39,8 @@ import (
 	"px.dev/pixie/src/shared/types/typespb"
 	"px.dev/pixie/src/table_store/schemapb"
 	"px.dev/pixie/src/utils"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
 )
 
 var dataTypeToVizierDataType = map[typespb.DataType]vizierpb.DataType{
@@ -113,6 +115,111 @@ func convertLifeCycleStateToVizierLifeCycleState(state statuspb.LifeCycleState)
 	return vizierpb.UNKNOWN_STATE
 }
 
+// tracepointToVizierTracepointInfo converts a tracepoint from the metadata service to an externally-facing
+// tracepoint, using hosts to find the hostname of each agent.
+func tracepointToVizierTracepointInfo(tp *metadatapb.ListTracepointsResponse_Tracepoint, hosts map[uuid.UUID]*agentpb.HostInfo) *vizierpb.TracepointInfo {
+	info := &vizierpb.TracepointInfo{
+		ID:            utils.UUIDFromProtoOrNil(tp.Info.ID).String(),
+		Name:          tp.Info.Name,
+		State:         convertLifeCycleStateToVizierLifeCycleState(tp.State),
+		ExpectedState: convertLifeCycleStateToVizierLifeCycleState(tp.Info.ExpectedState),
+		AgentStatuses: make([]*vizierpb.AgentTracepointStatus, len(tp.AgentStatuses)),
+	}
+	if tp.Info.Tracepoint != nil {
+		for _, program := range tp.Info.Tracepoint.Programs {
+			info.SchemaNames = append(info.SchemaNames, program.TableName)
+		}
+	}
+	if tp.ExpiresAt != nil {
+		if expiry, err := types.TimestampFromProto(tp.ExpiresAt); err == nil {
+			info.ExpiryTimestampNS = expiry.UnixNano()
+		}
+	}
+	for i, agentStatus := range tp.AgentStatuses {
+		agentID := utils.UUIDFromProtoOrNil(agentStatus.AgentID)
+		vzStatus := &vizierpb.AgentTracepointStatus{
+			AgentID: agentID.String(),
+			State:   convertLifeCycleStateToVizierLifeCycleState(agentStatus.State),
+		}
+		if host, ok := hosts[agentID]; ok {
+			vzStatus.Hostname = host.Hostname
+		}
+		if agentStatus.Status != nil {
+			vzStatus.Status = StatusToVizierStatus(agentStatus.Status)
+		}
+		info.AgentStatuses[i] = vzStatus
+	}
+	return info
+}
+
+var agentConfigStateToVizierAgentConfigStateMap = map[metadatapb.AgentConfigState]vizierpb.AgentConfigState{
+	metadatapb.AGENT_CONFIG_APPLIED: vizierpb.AGENT_CONFIG_APPLIED,
+	metadatapb.AGENT_CONFIG_FAILED:  vizierpb.AGENT_CONFIG_FAILED,
+	metadatapb.AGENT_CONFIG_SKIPPED: vizierpb.AGENT_CONFIG_SKIPPED,
+}
+
+// agentConfigStatusToVizierAgentConfigStatus converts the outcome of a config update on an agent to an
+// externally-facing status, using hosts to find the hostname of the agent.
+func agentConfigStatusToVizierAgentConfigStatus(s *metadatapb.AgentConfigStatus, hosts map[uuid.UUID]*agentpb.HostInfo) *vizierpb.AgentConfigStatus {
+	agentID := utils.UUIDFromProtoOrNil(s.AgentID)
+	vzStatus := &vizierpb.AgentConfigStatus{
+		AgentID: agentID.String(),
+		State:   vizierpb.AGENT_CONFIG_STATE_UNKNOWN,
+		Message: s.Message,
+	}
+	if val, ok := agentConfigStateToVizierAgentConfigStateMap[s.State]; ok {
+		vzStatus.State = val
+	}
+	if host, ok := hosts[agentID]; ok {
+		vzStatus.Hostname = host.Hostname
+	}
+	return vzStatus
+}
+
+var agentEventTypeToVizierAgentEventTypeMap = map[metadatapb.AgentEventType]vizierpb.AgentEventType{
+	metadatapb.AGENT_EVENT_REGISTERED:     vizierpb.AGENT_EVENT_REGISTERED,
+	metadatapb.AGENT_EVENT_UNHEALTHY:      vizierpb.AGENT_EVENT_UNHEALTHY,
+	metadatapb.AGENT_EVENT_EXPIRED:        vizierpb.AGENT_EVENT_EXPIRED,
+	metadatapb.AGENT_EVENT_DELETED:        vizierpb.AGENT_EVENT_DELETED,
+	metadatapb.AGENT_EVENT_SCHEMA_CHANGED: vizierpb.AGENT_EVENT_SCHEMA_CHANGED,
+}
+
+var vizierAgentEventTypeToAgentEventTypeMap = map[vizierpb.AgentEventType]metadatapb.AgentEventType{
+	vizierpb.AGENT_EVENT_REGISTERED:     metadatapb.AGENT_EVENT_REGISTERED,
+	vizierpb.AGENT_EVENT_UNHEALTHY:      metadatapb.AGENT_EVENT_UNHEALTHY,
+	vizierpb.AGENT_EVENT_EXPIRED:        metadatapb.AGENT_EVENT_EXPIRED,
+	vizierpb.AGENT_EVENT_DELETED:        metadatapb.AGENT_EVENT_DELETED,
+	vizierpb.AGENT_EVENT_SCHEMA_CHANGED: metadatapb.AGENT_EVENT_SCHEMA_CHANGED,
+}
+
+// agentEventToVizierAgentEvent converts an agent lifecycle event to an externally-facing event.
+func agentEventToVizierAgentEvent(e *metadatapb.AgentEvent) *vizierpb.AgentEvent {
+	vzEvent := &vizierpb.AgentEvent{
+		Type:   vizierpb.AGENT_EVENT_TYPE_UNKNOWN,
+		Tables: e.Tables,
+	}
+	if val, ok := agentEventTypeToVizierAgentEventTypeMap[e.Type]; ok {
+		vzEvent.Type = val
+	}
+	if ts, err := types.TimestampFromProto(e.Time); err == nil {
+		vzEvent.TimestampNS = ts.UnixNano()
+	}
+	if e.Agent == nil {
+		return vzEvent
+	}
+	vzEvent.LastHeartbeatNS = e.Agent.LastHeartbeatNS
+	if info := e.Agent.Info; info != nil {
+		vzEvent.AgentID = utils.UUIDFromProtoOrNil(info.AgentID).String()
+		vzEvent.CollectsData = info.Capabilities != nil && info.Capabilities.CollectsData
+		if info.HostInfo != nil {
+			vzEvent.Hostname = info.HostInfo.Hostname
+			vzEvent.HostIP = info.HostInfo.HostIP
+			vzEvent.PodName = info.HostInfo.PodName
+		}
+	}
+	return vzEvent
+}
+
 func convertExecFuncs(inputFuncs []*vizierpb.ExecuteScriptRequest_FuncToExecute) []*plannerpb.FuncToExecute {
 	funcs := make([]*plannerpb.FuncToExecute, len(inputFuncs))
 	for i, f := range inputFuncs {
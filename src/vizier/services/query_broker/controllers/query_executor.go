@@ -22,6 +22,7 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -40,6 +41,7 @@ import (
 	"px.dev/pixie/src/carnot/planner/distributedpb"
 	"px.dev/pixie/src/carnot/planner/plannerpb"
 	"px.dev/pixie/src/carnot/planpb"
+	"px.dev/pixie/src/carnot/queryresultspb"
 	"px.dev/pixie/src/common/base/statuspb"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
 )
@@ -81,8 +83,8 @@ type QueryExecutor interface {
 
 // DataPrivacy is an interface that manages data privacy in the query executor.
 type DataPrivacy interface {
-	// RedactionOptions returns the proto message containing options for redaction based on the cached data privacy level.
-	RedactionOptions(ctx context.Context) (*distributedpb.RedactionOptions, error)
+	// DataAccess returns the data access level for the request, based on the caller.
+	DataAccess(ctx context.Context, req *vizierpb.ExecuteScriptRequest) (*DataAccessDecision, error)
 }
 
 // MutationExecFactory is a function that creates a new MutationExecutorImpl.
@@ -102,12 +104,30 @@ type QueryExecutorImpl struct {
 	mdconf              metadatapb.MetadataConfigServiceClient
 	resultForwarder     QueryResultForwarder
 	planner             Planner
+	// Selects the agents of queries that target a subset of the cluster. nil if targeting isn't supported.
+	agentSelector AgentSelector
+	// Records the executed queries in the query log. nil if the query log is disabled.
+	queryLogger *QueryLogger
 
 	eg *errgroup.Group
 
+	req  *vizierpb.ExecuteScriptRequest
+	user string
+
 	queryID           uuid.UUID
 	startTime         time.Time
 	compilationTimeNs int64
+	dataAccess        *DataAccessDecision
+	// The data collecting agents selected by the agent target of the query, if any.
+	targetAgentIDs []uuid.UUID
+	// The compiled plan, kept to log the analyze plan of slow queries.
+	plan    *distributedpb.DistributedPlan
+	planMap map[uuid.UUID]*planpb.Plan
+
+	// The execution stats of the query, collected for the query log.
+	statsMu        sync.Mutex
+	execStats      *vizierpb.QueryExecutionStats
+	agentExecStats []*queryresultspb.AgentExecutionStats
 
 	mutationExecFactory MutationExecFactory
 
@@ -129,6 +149,8 @@ func NewQueryExecutorFromServer(s *Server, mutExecFactory MutationExecFactory) Q
 		s.mdconf,
 		s.resultForwarder,
 		s.planner,
+		s.agentSelector,
+		s.queryLogger,
 		mutExecFactory,
 	)
 }
@@ -144,6 +166,8 @@ func NewQueryExecutor(
 	mdconf metadatapb.MetadataConfigServiceClient,
 	resultForwarder QueryResultForwarder,
 	planner Planner,
+	agentSelector AgentSelector,
+	queryLogger *QueryLogger,
 	mutExecFactory MutationExecFactory,
 ) QueryExecutor {
 	return &QueryExecutorImpl{
@@ -156,6 +180,8 @@ func NewQueryExecutor(
 		mdconf:              mdconf,
 		resultForwarder:     resultForwarder,
 		planner:             planner,
+		agentSelector:       agentSelector,
+		queryLogger:         queryLogger,
 		mutationExecFactory: mutExecFactory,
 		queryName:           "",
 		numPEMsQueried:      0,
@@ -180,6 +206,8 @@ func (q *QueryExecutorImpl) Run(ctx context.Context, req *vizierpb.ExecuteScript
 		q.queryID = queryID
 	}
 
+	q.req = req
+	q.user = queryUserFromContext(ctx)
 	q.queryName = req.QueryName
 	if q.queryName == "" {
 		q.queryName = "unnamed"
@@ -198,6 +226,7 @@ func (q *QueryExecutorImpl) Run(ctx context.Context, req *vizierpb.ExecuteScript
 // Wait waits for the query to finish or error.
 func (q *QueryExecutorImpl) Wait() error {
 	err := q.eg.Wait()
+	q.recordQuery(err)
 	if err == nil {
 		d := time.Since(q.startTime)
 		queryExecTimeSummary.With(prometheus.Labels{"script_name": q.queryName}).Observe(float64(d.Milliseconds()))
@@ -221,7 +250,7 @@ func (q *QueryExecutorImpl) Wait() error {
 	if errors.Is(err, context.DeadlineExceeded) {
 		return err
 	}
-	if errors.Is(err, context.Canceled) {
+	if errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled {
 		log.WithField("query_id", q.queryID).
 			Info("Query cancelled")
 		return err
@@ -247,6 +276,11 @@ func (q *QueryExecutorImpl) runConsumer(ctx context.Context, resultCh <-chan *vi
 			if !ok {
 				return nil
 			}
+			if stats := result.GetData().GetExecutionStats(); stats != nil {
+				q.statsMu.Lock()
+				q.execStats = stats
+				q.statsMu.Unlock()
+			}
 			if err := consumer.Consume(result); err != nil {
 				return err
 			}
@@ -311,12 +345,6 @@ func (q *QueryExecutorImpl) compilePlan(ctx context.Context, resultCh chan<- *vi
 		return nil, status.Error(codes.Unavailable, "not ready yet")
 	}
 
-	redactOptions, err := q.dataPrivacy.RedactionOptions(ctx)
-	if err != nil {
-		log.WithError(err).Errorf("Failed to get the redaction options")
-		return nil, status.Errorf(codes.Internal, "error setting up the compiler")
-	}
-
 	var otelConfig *distributedpb.OTelEndpointConfig
 	if req.Configs != nil && req.Configs.OTelEndpointConfig != nil {
 		otelConfig = &distributedpb.OTelEndpointConfig{
@@ -347,7 +375,7 @@ func (q *QueryExecutorImpl) compilePlan(ctx context.Context, resultCh chan<- *vi
 		PlanOptions:         planOpts,
 		ResultAddress:       q.resultAddress,
 		ResultSSLTargetName: q.resultSSLTargetName,
-		RedactionOptions:    redactOptions,
+		RedactionOptions:    q.dataAccess.RedactionOptions(),
 		OTelEndpointConfig:  otelConfig,
 		PluginConfig:        pluginConfig,
 		DebugInfo:           debugInfo,
@@ -375,6 +403,24 @@ func (q *QueryExecutorImpl) compilePlan(ctx context.Context, resultCh chan<- *vi
 	return plannerResultPB.Plan, nil
 }
 
+// targetDistributedState restricts the state to the agents selected by the target, so that the plan only runs on them.
+func (q *QueryExecutorImpl) targetDistributedState(ctx context.Context, target *vizierpb.AgentTarget, state *distributedpb.DistributedState) (*distributedpb.DistributedState, error) {
+	if q.agentSelector == nil {
+		return nil, status.Error(codes.InvalidArgument, "agent targeting is not supported by this Vizier")
+	}
+	selected, err := q.agentSelector.SelectAgents(ctx, target, q.agentsTracker.GetAgentInfo().HostInfo())
+	if err != nil {
+		log.WithError(err).Error("Failed to select the agents of the query")
+		return nil, status.Error(codes.Internal, "failed to select the agents matching the target")
+	}
+	filtered, kept := filterDistributedState(state, selected)
+	if len(kept) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no agents match the target of the query")
+	}
+	q.targetAgentIDs = kept
+	return filtered, nil
+}
+
 func (q *QueryExecutorImpl) buildAgentPlanMap(plan *distributedpb.DistributedPlan) (map[uuid.UUID]*planpb.Plan, error) {
 	planMap := make(map[uuid.UUID]*planpb.Plan)
 
@@ -414,12 +460,65 @@ func (q *QueryExecutorImpl) buildTableMap(planMap map[uuid.UUID]*planpb.Plan) (m
 	return tableNameToIDMap, nil
 }
 
+// resultTableAgents returns the agent that sends the results of each output table to the query broker.
+func resultTableAgents(planMap map[uuid.UUID]*planpb.Plan) map[string]uuid.UUID {
+	tableAgents := make(map[string]uuid.UUID)
+	for agentID, plan := range planMap {
+		for _, fragment := range plan.Nodes {
+			for _, node := range fragment.Nodes {
+				if node.Op.OpType != planpb.GRPC_SINK_OPERATOR {
+					continue
+				}
+				if output := node.Op.GetGRPCSinkOp().GetOutputTable(); output != nil {
+					tableAgents[output.TableName] = agentID
+				}
+			}
+		}
+	}
+	return tableAgents
+}
+
+// reportStatusToBroker makes every agent report its execution stats or error to the query broker, in addition to the
+// agents it sends data to. The agents that send the results already report to the query broker, so their
+// destinations are copied to the other agents.
+func reportStatusToBroker(planMap map[uuid.UUID]*planpb.Plan, tableAgents map[string]uuid.UUID) {
+	var brokerDests []*planpb.Plan_ExecutionStatusDestination
+	seen := make(map[string]bool)
+	for _, agentID := range tableAgents {
+		plan, ok := planMap[agentID]
+		if !ok {
+			continue
+		}
+		for _, dest := range plan.ExecutionStatusDestinations {
+			if !seen[dest.GrpcAddress] {
+				seen[dest.GrpcAddress] = true
+				brokerDests = append(brokerDests, dest)
+			}
+		}
+	}
+	for _, plan := range planMap {
+		existing := make(map[string]bool)
+		for _, dest := range plan.ExecutionStatusDestinations {
+			existing[dest.GrpcAddress] = true
+		}
+		for _, dest := range brokerDests {
+			if !existing[dest.GrpcAddress] {
+				plan.ExecutionStatusDestinations = append(plan.ExecutionStatusDestinations, dest)
+			}
+		}
+	}
+}
+
 func (q *QueryExecutorImpl) sendTableRelationResponses(ctx context.Context, resultCh chan<- *vizierpb.ExecuteScriptResponse, tableNameToIDMap map[string]string, planMap map[uuid.UUID]*planpb.Plan) error {
 	tableRelationResponses, err := TableRelationResponses(q.queryID, tableNameToIDMap, planMap)
 	if err != nil {
 		return err
 	}
 	for _, resp := range tableRelationResponses {
+		resp.GetMetaData().DataAccess = q.dataAccess.ToProto()
+		for _, agentID := range q.targetAgentIDs {
+			resp.GetMetaData().TargetAgentIDs = append(resp.GetMetaData().TargetAgentIDs, agentID.String())
+		}
 		if err := q.sendResponse(ctx, resultCh, resp); err != nil {
 			return err
 		}
@@ -453,6 +552,12 @@ func (q *QueryExecutorImpl) prepareScript(ctx context.Context, resultCh chan<- *
 		return err
 	}
 
+	q.dataAccess, err = q.dataPrivacy.DataAccess(ctx, req)
+	if err != nil {
+		log.WithError(err).Errorf("Failed to get the data access level")
+		return status.Errorf(codes.Internal, "error setting up the compiler")
+	}
+
 	distributedState := q.agentsTracker.GetAgentInfo().DistributedState()
 
 	if req.Mutation {
@@ -461,6 +566,22 @@ func (q *QueryExecutorImpl) prepareScript(ctx context.Context, resultCh chan<- *
 		}
 	}
 
+	if !isEmptyAgentTarget(req.AgentTarget) {
+		targetState, err := q.targetDistributedState(ctx, req.AgentTarget, &distributedState)
+		if err != nil {
+			return err
+		}
+		distributedState = *targetState
+	}
+
+	if agentID, ok := ctx.Value(probeAgentKey).(uuid.UUID); ok {
+		if !hasCarnot(&distributedState, agentID) {
+			return status.Errorf(codes.NotFound, "agent %s is not in the distributed state", agentID.String())
+		}
+		probeState, _ := filterDistributedState(&distributedState, map[uuid.UUID]bool{agentID: true})
+		distributedState = *probeState
+	}
+
 	// Convert request to a format expected by the planner.
 	convertedReq, err := VizierQueryRequestToPlannerQueryRequest(req)
 	if err != nil {
@@ -478,6 +599,8 @@ func (q *QueryExecutorImpl) prepareScript(ctx context.Context, resultCh chan<- *
 	if err != nil {
 		return err
 	}
+	q.plan = plan
+	q.planMap = planMap
 	tableNameToIDMap, err := q.buildTableMap(planMap)
 	if err != nil {
 		return err
@@ -492,7 +615,24 @@ func (q *QueryExecutorImpl) prepareScript(ctx context.Context, resultCh chan<- *
 		return err
 	}
 
-	err = q.resultForwarder.RegisterQuery(q.queryID, tableNameToIDMap, q.compilationTimeNs, queryPlanOpts, q.queryName)
+	agentIDs := make([]uuid.UUID, 0, len(planMap))
+	for agentID := range planMap {
+		agentIDs = append(agentIDs, agentID)
+	}
+	tableAgents := resultTableAgents(planMap)
+	if req.AllowPartialResults {
+		reportStatusToBroker(planMap, tableAgents)
+	}
+	metadata := &QueryMetadata{
+		User:                queryUserFromContext(ctx),
+		StartTime:           q.startTime,
+		AgentIDs:            agentIDs,
+		TableAgents:         tableAgents,
+		AllowPartialResults: req.AllowPartialResults,
+		OnExecStats:         q.setAgentExecStats,
+	}
+
+	err = q.resultForwarder.RegisterQuery(q.queryID, tableNameToIDMap, q.compilationTimeNs, queryPlanOpts, q.queryName, metadata)
 	if err != nil {
 		return err
 	}
@@ -517,3 +657,36 @@ func (q *QueryExecutorImpl) runScript(ctx context.Context, resultCh chan<- *vizi
 
 	return q.resultForwarder.StreamResults(ctx, q.queryID, resultCh)
 }
+
+func (q *QueryExecutorImpl) setAgentExecStats(stats []*queryresultspb.AgentExecutionStats) {
+	q.statsMu.Lock()
+	defer q.statsMu.Unlock()
+	q.agentExecStats = stats
+}
+
+// recordQuery adds the query to the query log once it completed. Queries that resume an existing query aren't logged,
+// since they were logged when launched, and neither are the health checks.
+func (q *QueryExecutorImpl) recordQuery(err error) {
+	if q.queryLogger == nil || q.req == nil || q.req.QueryID != "" || isHealthCheckQuery(q.req.QueryName) {
+		return
+	}
+	d := time.Since(q.startTime)
+
+	q.statsMu.Lock()
+	execStats := q.execStats
+	agentExecStats := q.agentExecStats
+	q.statsMu.Unlock()
+
+	entry := newQueryLogEntry(q.req, q.queryID, q.user, q.startTime, d, q.dataAccess, execStats, err)
+	if q.queryLogger.IsSlow(d) {
+		entry.Slow = true
+		if q.plan != nil {
+			plan, planErr := GetQueryPlanAsDotString(q.plan, q.planMap, &agentExecStats)
+			if planErr != nil {
+				log.WithError(planErr).WithField("query_id", q.queryID).Error("Failed to render the plan of a slow query")
+			}
+			entry.AnalyzePlan = plan
+		}
+	}
+	q.queryLogger.Record(entry)
+}
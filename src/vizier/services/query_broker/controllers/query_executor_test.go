@@ -38,6 +38,7 @@ import (
 	"px.dev/pixie/src/carnot/carnotpb"
 	"px.dev/pixie/src/carnot/planner/distributedpb"
 	"px.dev/pixie/src/carnot/planpb"
+	pixie "px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
 	"px.dev/pixie/src/utils/testingutils"
 	"px.dev/pixie/src/vizier/services/query_broker/controllers"
 	mock_controllers "px.dev/pixie/src/vizier/services/query_broker/controllers/mock"
@@ -292,7 +293,7 @@ type fakeResultForwarder struct {
 // RegisterQuery registers a query.
 func (f *fakeResultForwarder) RegisterQuery(queryID uuid.UUID, tableIDMap map[string]string,
 	compilationTimeNs int64,
-	queryPlanOpts *controllers.QueryPlanOpts, queryName string) error {
+	queryPlanOpts *controllers.QueryPlanOpts, queryName string, metadata *controllers.QueryMetadata) error {
 	f.QueryRegistered = queryID
 	f.TableIDMap = tableIDMap
 	f.StreamedQueryPlanOpts = queryPlanOpts
@@ -334,6 +335,16 @@ func (f *fakeResultForwarder) ProducerCancelStream(queryID uuid.UUID, err error)
 	f.ClientStreamClosed = true
 }
 
+// ListQueries lists the registered queries.
+func (f *fakeResultForwarder) ListQueries() []*controllers.ActiveQueryInfo {
+	return nil
+}
+
+// CancelQuery cancels a registered query.
+func (f *fakeResultForwarder) CancelQuery(queryID uuid.UUID, err error) error {
+	return nil
+}
+
 type queryExecTestCase struct {
 	Name                       string
 	Req                        *vizierpb.ExecuteScriptRequest
@@ -373,13 +384,11 @@ func (c *testConsumer) Consume(result *vizierpb.ExecuteScriptResponse) error {
 	return nil
 }
 
-type fakeDataPrivacy struct {
-	Options *distributedpb.RedactionOptions
-}
+type fakeDataPrivacy struct{}
 
-// RedactionOptions returns RedactionOptions proto message that was set on the fakeDataPrivacy struct.
-func (fdp *fakeDataPrivacy) RedactionOptions(_ context.Context) (*distributedpb.RedactionOptions, error) {
-	return fdp.Options, nil
+// DataAccess returns full data access for all requests.
+func (fdp *fakeDataPrivacy) DataAccess(_ context.Context, _ *vizierpb.ExecuteScriptRequest) (*controllers.DataAccessDecision, error) {
+	return &controllers.DataAccessDecision{Level: pixie.DataAccessFull}, nil
 }
 
 func runTestCase(t *testing.T, test *queryExecTestCase) {
@@ -410,7 +419,7 @@ func runTestCase(t *testing.T, test *queryExecTestCase) {
 	}
 
 	dp := &fakeDataPrivacy{}
-	queryExec := controllers.NewQueryExecutor("qb_address", "qb_hostname", at, dp, nc, nil, nil, rf, planner, test.MutExecFactory)
+	queryExec := controllers.NewQueryExecutor("qb_address", "qb_hostname", at, dp, nc, nil, nil, rf, planner, nil, nil, test.MutExecFactory)
 	consumer := newTestConsumer(test.ConsumeErrs)
 
 	assert.Equal(t, test.QueryExecExpectedRunError, queryExec.Run(context.Background(), test.Req, consumer))
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/metadata"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	svcutils "px.dev/pixie/src/shared/services/utils"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+)
+
+var queryLogDroppedCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "query_log_dropped_entries_total",
+	Help: "The number of query log entries that could not be recorded, by reason.",
+}, []string{"reason"})
+
+func init() {
+	pflag.Duration("slow_query_threshold", 10*time.Second, "Queries that take longer than this are marked as slow in the query log, "+
+		"along with their analyze plan. 0 disables slow query logging.")
+}
+
+const (
+	// The number of entries that can wait to be recorded. Entries are dropped, and counted, if the metadata service
+	// falls behind.
+	queryLogBufferSize     = 256
+	queryLogRequestTimeout = 5 * time.Second
+	// How many times an entry is sent before it is dropped, and how long to wait before the first retry.
+	// The wait doubles with each retry.
+	queryLogMaxAttempts  = 3
+	queryLogRetryBackoff = 500 * time.Millisecond
+)
+
+// QueryLogger records the queries executed by the query broker in the query log of the metadata service.
+type QueryLogger struct {
+	mdql               metadatapb.MetadataQueryLogServiceClient
+	signingKey         string
+	slowQueryThreshold time.Duration
+
+	entryCh  chan *vizierpb.QueryLogEntry
+	dropped  int64
+	quitCh   chan struct{}
+	quitOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewQueryLoggerFromFlags creates a new QueryLogger with the slow query threshold configured by flags.
+func NewQueryLoggerFromFlags(mdql metadatapb.MetadataQueryLogServiceClient, signingKey string) *QueryLogger {
+	return NewQueryLogger(mdql, signingKey, viper.GetDuration("slow_query_threshold"))
+}
+
+// NewQueryLogger creates a new QueryLogger. A slowQueryThreshold of 0 disables slow query logging.
+func NewQueryLogger(mdql metadatapb.MetadataQueryLogServiceClient, signingKey string, slowQueryThreshold time.Duration) *QueryLogger {
+	l := &QueryLogger{
+		mdql:               mdql,
+		signingKey:         signingKey,
+		slowQueryThreshold: slowQueryThreshold,
+		entryCh:            make(chan *vizierpb.QueryLogEntry, queryLogBufferSize),
+		quitCh:             make(chan struct{}),
+	}
+	l.wg.Add(1)
+	go l.run()
+	return l
+}
+
+// Close stops recording queries. Entries that are still buffered are dropped.
+func (l *QueryLogger) Close() {
+	l.quitOnce.Do(func() { close(l.quitCh) })
+	l.wg.Wait()
+	for {
+		select {
+		case entry := <-l.entryCh:
+			l.drop(entry, "closed")
+		default:
+			return
+		}
+	}
+}
+
+// Dropped returns the number of entries that could not be recorded.
+func (l *QueryLogger) Dropped() int64 {
+	return atomic.LoadInt64(&l.dropped)
+}
+
+func (l *QueryLogger) drop(entry *vizierpb.QueryLogEntry, reason string) {
+	atomic.AddInt64(&l.dropped, 1)
+	queryLogDroppedCounter.WithLabelValues(reason).Inc()
+	log.WithField("query_id", entry.QueryID).WithField("reason", reason).Error("Dropping query log entry")
+}
+
+// IsSlow returns whether a query that took the given duration is a slow query.
+func (l *QueryLogger) IsSlow(d time.Duration) bool {
+	return l.slowQueryThreshold > 0 && d >= l.slowQueryThreshold
+}
+
+// Record queues the entry to be added to the query log. It doesn't block, so that queries aren't slowed
+// down by the metadata service.
+func (l *QueryLogger) Record(entry *vizierpb.QueryLogEntry) {
+	if entry.Slow {
+		log.WithField("query_id", entry.QueryID).
+			WithField("script_name", entry.QueryName).
+			WithField("user", entry.User).
+			WithField("duration", time.Duration(entry.DurationNS)).
+			Warn("Slow query")
+	}
+	select {
+	case l.entryCh <- entry:
+	default:
+		l.drop(entry, "buffer_full")
+	}
+}
+
+// GetQueryLog returns the queries in the query log that match the request.
+func (l *QueryLogger) GetQueryLog(ctx context.Context, req *vizierpb.GetQueryLogRequest) (*vizierpb.GetQueryLogResponse, error) {
+	ctx, err := l.serviceCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l.mdql.GetQueryLog(ctx, req)
+}
+
+func (l *QueryLogger) serviceCtx(ctx context.Context) (context.Context, error) {
+	claims := svcutils.GenerateJWTForService("query_broker", "vizier")
+	token, err := svcutils.SignJWTClaims(claims, l.signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("bearer %s", token)), nil
+}
+
+func (l *QueryLogger) run() {
+	defer l.wg.Done()
+	for {
+		select {
+		case <-l.quitCh:
+			return
+		case entry := <-l.entryCh:
+			l.send(entry)
+		}
+	}
+}
+
+// send records the entry, retrying with a backoff if the metadata service fails.
+func (l *QueryLogger) send(entry *vizierpb.QueryLogEntry) {
+	backoff := queryLogRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := l.recordQuery(entry)
+		if err == nil {
+			return
+		}
+		log.WithError(err).WithField("query_id", entry.QueryID).WithField("attempt", attempt).
+			Error("Failed to record query in the query log")
+		if attempt >= queryLogMaxAttempts {
+			l.drop(entry, "record_failed")
+			return
+		}
+
+		select {
+		case <-l.quitCh:
+			l.drop(entry, "closed")
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (l *QueryLogger) recordQuery(entry *vizierpb.QueryLogEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryLogRequestTimeout)
+	defer cancel()
+	ctx, err := l.serviceCtx(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = l.mdql.RecordQuery(ctx, &metadatapb.RecordQueryRequest{Entry: entry})
+	return err
+}
+
+// scriptHash returns the hex encoded SHA-256 hash of the script.
+func scriptHash(script string) string {
+	h := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(h[:])
+}
+
+// newQueryLogEntry builds the query log entry of a query that completed with the given error.
+func newQueryLogEntry(req *vizierpb.ExecuteScriptRequest, queryID uuid.UUID, user string, startTime time.Time,
+	duration time.Duration, dataAccess *DataAccessDecision, stats *vizierpb.QueryExecutionStats, err error) *vizierpb.QueryLogEntry {
+	entry := &vizierpb.QueryLogEntry{
+		QueryID:          queryID.String(),
+		QueryName:        req.QueryName,
+		ScriptHash:       scriptHash(req.QueryStr),
+		ExecFuncs:        req.ExecFuncs,
+		User:             user,
+		StartTimestampNS: startTime.UnixNano(),
+		DurationNS:       duration.Nanoseconds(),
+		Status:           ErrToVizierStatus(err),
+	}
+	if dataAccess != nil {
+		entry.DataAccess = dataAccess.ToProto()
+	}
+	if stats != nil {
+		entry.RecordsProcessed = stats.RecordsProcessed
+		entry.BytesProcessed = stats.BytesProcessed
+	}
+	return entry
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	mock_metadatapb "px.dev/pixie/src/vizier/services/metadata/metadatapb/mock"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+)
+
+func TestQueryLogger_Record(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mdql := mock_metadatapb.NewMockMetadataQueryLogServiceClient(ctrl)
+	l := controllers.NewQueryLogger(mdql, "jwt-key", time.Second)
+	defer l.Close()
+
+	entry := &vizierpb.QueryLogEntry{
+		QueryID:   "11285cdd-1de9-4ab1-ae6a-0ba08c8c676c",
+		QueryName: "px/cluster",
+		User:      "user@pixie.dev",
+	}
+
+	recorded := make(chan *metadatapb.RecordQueryRequest, 1)
+	mdql.EXPECT().
+		RecordQuery(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, req *metadatapb.RecordQueryRequest, opts ...interface{}) (*metadatapb.RecordQueryResponse, error) {
+			md, ok := metadata.FromOutgoingContext(ctx)
+			require.True(t, ok)
+			assert.Len(t, md.Get("authorization"), 1)
+			recorded <- req
+			return &metadatapb.RecordQueryResponse{}, nil
+		})
+
+	l.Record(entry)
+
+	select {
+	case req := <-recorded:
+		assert.Equal(t, entry, req.Entry)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Query was not recorded")
+	}
+}
+
+func TestQueryLogger_IsSlow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mdql := mock_metadatapb.NewMockMetadataQueryLogServiceClient(ctrl)
+
+	l := controllers.NewQueryLogger(mdql, "jwt-key", time.Second)
+	defer l.Close()
+	assert.False(t, l.IsSlow(500*time.Millisecond))
+	assert.True(t, l.IsSlow(time.Second))
+	assert.True(t, l.IsSlow(2*time.Second))
+
+	disabled := controllers.NewQueryLogger(mdql, "jwt-key", 0)
+	defer disabled.Close()
+	assert.False(t, disabled.IsSlow(time.Hour))
+}
+
+func TestQueryLogger_GetQueryLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mdql := mock_metadatapb.NewMockMetadataQueryLogServiceClient(ctrl)
+	l := controllers.NewQueryLogger(mdql, "jwt-key", time.Second)
+	defer l.Close()
+
+	req := &vizierpb.GetQueryLogRequest{
+		User:     "user@pixie.dev",
+		SlowOnly: true,
+	}
+	resp := &vizierpb.GetQueryLogResponse{
+		Entries: []*vizierpb.QueryLogEntry{
+			{QueryID: "11285cdd-1de9-4ab1-ae6a-0ba08c8c676c", User: "user@pixie.dev", Slow: true},
+		},
+	}
+	mdql.EXPECT().
+		GetQueryLog(gomock.Any(), req).
+		Return(resp, nil)
+
+	actual, err := l.GetQueryLog(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, resp, actual)
+}
+
+func TestQueryLogger_RecordRetries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mdql := mock_metadatapb.NewMockMetadataQueryLogServiceClient(ctrl)
+	l := controllers.NewQueryLogger(mdql, "jwt-key", time.Second)
+	defer l.Close()
+
+	entry := &vizierpb.QueryLogEntry{QueryID: "11285cdd-1de9-4ab1-ae6a-0ba08c8c676c"}
+
+	recorded := make(chan *metadatapb.RecordQueryRequest, 1)
+	gomock.InOrder(
+		mdql.EXPECT().
+			RecordQuery(gomock.Any(), gomock.Any()).
+			Return(nil, status.Error(codes.Unavailable, "metadata service is unavailable")),
+		mdql.EXPECT().
+			RecordQuery(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, req *metadatapb.RecordQueryRequest, opts ...interface{}) (*metadatapb.RecordQueryResponse, error) {
+				recorded <- req
+				return &metadatapb.RecordQueryResponse{}, nil
+			}),
+	)
+
+	l.Record(entry)
+
+	select {
+	case req := <-recorded:
+		assert.Equal(t, entry, req.Entry)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Query was not recorded")
+	}
+	assert.Equal(t, int64(0), l.Dropped())
+}
+
+func TestQueryLogger_CountsDroppedEntries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mdql := mock_metadatapb.NewMockMetadataQueryLogServiceClient(ctrl)
+	l := controllers.NewQueryLogger(mdql, "jwt-key", time.Second)
+
+	// The first entry is being sent, so the others wait in the buffer until it fills up.
+	sending := make(chan struct{})
+	unblock := make(chan struct{})
+	var recorded int64
+	mdql.EXPECT().
+		RecordQuery(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, req *metadatapb.RecordQueryRequest, opts ...interface{}) (*metadatapb.RecordQueryResponse, error) {
+			if atomic.AddInt64(&recorded, 1) == 1 {
+				close(sending)
+				<-unblock
+			}
+			return &metadatapb.RecordQueryResponse{}, nil
+		}).
+		AnyTimes()
+
+	l.Record(&vizierpb.QueryLogEntry{QueryID: "sending"})
+	<-sending
+	for i := 0; i < 256+10; i++ {
+		l.Record(&vizierpb.QueryLogEntry{QueryID: "buffered"})
+	}
+	assert.Equal(t, int64(10), l.Dropped())
+
+	// The entries that are still buffered when the logger is closed are dropped.
+	close(unblock)
+	l.Close()
+	assert.Equal(t, int64(1+256+10), atomic.LoadInt64(&recorded)+l.Dropped())
+}
@@ -20,9 +20,12 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -66,6 +69,36 @@ type QueryPlanOpts struct {
 	PlanMap map[uuid.UUID]*planpb.Plan
 }
 
+// QueryMetadata contains information about a query that is reported when listing the running queries.
+type QueryMetadata struct {
+	// The user or service that launched the query.
+	User string
+	// The time the query started executing.
+	StartTime time.Time
+	// The agents executing fragments of the query.
+	AgentIDs []uuid.UUID
+	// The agent that sends the results of each output table.
+	TableAgents map[string]uuid.UUID
+	// Whether the query completes with the results that were received when some agents fail or time out.
+	// Every agent of such queries reports its execution stats or error to the query broker, so that the
+	// agents whose results are missing can be identified.
+	AllowPartialResults bool
+	// Called with the execution stats of the agents once they are received. Optional.
+	OnExecStats func([]*queryresultspb.AgentExecutionStats)
+}
+
+// ActiveQueryInfo is a snapshot of the state of a query registered in the result forwarder.
+type ActiveQueryInfo struct {
+	QueryID   uuid.UUID
+	QueryName string
+	QueryMetadata
+	RecordsProcessed int64
+	BytesProcessed   int64
+}
+
+// ErrQueryNotFound is returned when trying to cancel a query that is not registered in the result forwarder.
+var ErrQueryNotFound = errors.New("query not found")
+
 // The deadline for all sinks in a given query to initialize.
 const defaultResultSinkInitializationTimeout = 30 * time.Second
 
@@ -144,6 +177,18 @@ type activeQuery struct {
 	// These two fields are only accessed by a single writer and reader.
 	remainingTableEos *concurrentSet
 
+	// For queries that allow partial results, the tables whose results are dropped, along with the reason.
+	// Only accessed by the consumer.
+	failedTables map[string]string
+	// For queries that allow partial results, the agents that completed their part of the query, the errors
+	// reported by agents that failed, and the number of agents that reported either. Only accessed by the consumer.
+	completedAgents map[uuid.UUID]bool
+	agentErrors     []string
+	reportedAgents  int
+	// Closed when the producers time out for queries that allow partial results, so that the consumer
+	// completes the query with the results received so far.
+	producersTimedOutCh chan struct{}
+
 	gotFinalExecStats bool
 	agentExecStats    *[]*queryresultspb.AgentExecutionStats
 
@@ -165,11 +210,17 @@ type activeQuery struct {
 
 	// Name used for labeling metrics recorded for this query.
 	queryName string
+	metadata  QueryMetadata
+
+	// The amount of data received from producers so far. These are accessed atomically, since they
+	// are read by callers listing the running queries.
+	recordsProcessed int64
+	bytesProcessed   int64
 }
 
 func newActiveQuery(producerCtx context.Context, tableIDMap map[string]string,
 	compilationTimeNs int64,
-	queryPlanOpts *QueryPlanOpts, watchdogCancel context.CancelFunc, queryName string) *activeQuery {
+	queryPlanOpts *QueryPlanOpts, watchdogCancel context.CancelFunc, queryName string, metadata *QueryMetadata) *activeQuery {
 	aq := &activeQuery{
 		queryResultCh: make(chan *carnotpb.TransferResultChunkRequest, activeQueryBufferSize),
 		tableIDMap:    tableIDMap,
@@ -179,6 +230,10 @@ func newActiveQuery(producerCtx context.Context, tableIDMap map[string]string,
 
 		allTablesConnectedCh: make(chan struct{}),
 
+		failedTables:        make(map[string]string),
+		completedAgents:     make(map[uuid.UUID]bool),
+		producersTimedOutCh: make(chan struct{}),
+
 		gotFinalExecStats: false,
 		// Store compilation time and query plan opts so that callers of ResumeQuery don't need to be aware of these.
 		compilationTimeNs: compilationTimeNs,
@@ -193,6 +248,12 @@ func newActiveQuery(producerCtx context.Context, tableIDMap map[string]string,
 
 		queryName: queryName,
 	}
+	if metadata != nil {
+		aq.metadata = *metadata
+	}
+	if aq.metadata.StartTime.IsZero() {
+		aq.metadata.StartTime = time.Now()
+	}
 
 	for tableName := range tableIDMap {
 		aq.remainingTableEos.add(tableName)
@@ -228,6 +289,9 @@ func (a *activeQuery) updateQueryState(msg *carnotpb.TransferResultChunkRequest)
 		tableName := queryResult.GetTableName()
 
 		if rb := queryResult.GetRowBatch(); rb != nil {
+			atomic.AddInt64(&a.recordsProcessed, rb.NumRows)
+			atomic.AddInt64(&a.bytesProcessed, int64(rb.Size()))
+
 			if a.uninitializedTables.exists(tableName) {
 				a.uninitializedTables.remove(tableName)
 				if a.uninitializedTables.size() == 0 {
@@ -279,6 +343,7 @@ func (a *activeQuery) watchdog(ctx context.Context, queryID uuid.UUID, consumerT
 		t.Reset(timeout)
 	}
 	cancelConsumer := func() {}
+	producersTimedOut := false
 forLoop:
 	for {
 		select {
@@ -297,6 +362,16 @@ forLoop:
 			a.cancelQueryError = fmt.Errorf("Query %s timedout waiting for consumer", queryID.String())
 			break forLoop
 		case <-producerTimer.C:
+			if a.metadata.AllowPartialResults {
+				// Let the consumer complete the query with the results it has. The watchdog keeps running in case
+				// the consumer dies before it does so.
+				if !producersTimedOut {
+					producersTimedOut = true
+					close(a.producersTimedOutCh)
+				}
+				producerTimer.Reset(producerTimeout)
+				continue
+			}
 			a.cancelQueryError = fmt.Errorf("Query %s timedout waiting for producers", queryID.String())
 			break forLoop
 
@@ -310,7 +385,139 @@ forLoop:
 	cancelConsumer()
 }
 
+// failUninitializedTables stops waiting on the tables whose result sinks haven't initialized, for queries that
+// allow partial results.
+func (a *activeQuery) failUninitializedTables() {
+	for _, tableName := range a.uninitializedTables.values() {
+		a.failedTables[tableName] = "result sink was not initialized within the deadline"
+		a.uninitializedTables.remove(tableName)
+		a.remainingTableEos.remove(tableName)
+	}
+}
+
+// isResultAgent returns whether the agent sends the results of the query to the query broker, rather than to
+// other agents.
+func (a *activeQuery) isResultAgent(agentID uuid.UUID) bool {
+	if len(a.metadata.TableAgents) == 0 {
+		return true
+	}
+	for _, id := range a.metadata.TableAgents {
+		if id == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAgentStats records the agents that completed their part of a query that allows partial results. It
+// returns whether the stats are the final stats of the query, sent by an agent that sends the query's results.
+func (a *activeQuery) recordAgentStats(execStats *carnotpb.TransferResultChunkRequest_QueryExecutionAndTimingInfo) bool {
+	agentStats := execStats.AgentExecutionStats
+	if len(agentStats) == 0 {
+		return true
+	}
+	for _, stats := range agentStats {
+		a.completedAgents[utils.UUIDFromProtoOrNil(stats.AgentID)] = true
+	}
+	a.reportedAgents++
+	// Agents add their own stats after the stats of the agents that send data to them.
+	return a.isResultAgent(utils.UUIDFromProtoOrNil(agentStats[len(agentStats)-1].AgentID))
+}
+
+// allAgentsReported returns whether every agent of a query that allows partial results reported its stats or an
+// error, so that no more results are coming.
+func (a *activeQuery) allAgentsReported() bool {
+	return len(a.metadata.AgentIDs) > 0 && a.reportedAgents >= len(a.metadata.AgentIDs)
+}
+
+// partialResults returns the agents whose results are missing and the tables that are incomplete.
+func (a *activeQuery) partialResults() ([]*vizierpb.MissingAgent, []string) {
+	var incompleteTables []string
+	tableReasons := make(map[uuid.UUID]string)
+	for tableName, reason := range a.failedTables {
+		incompleteTables = append(incompleteTables, tableName)
+		tableReasons[a.metadata.TableAgents[tableName]] = reason
+	}
+	incompleteTables = append(incompleteTables, a.remainingTableEos.values()...)
+
+	// Execution errors don't identify the agent that failed, so they are reported for every agent that didn't
+	// complete its part of the query.
+	reason := "timed out before completing its part of the query"
+	if len(a.agentErrors) > 0 {
+		reason = "failed to complete its part of the query: " + strings.Join(a.agentErrors, "; ")
+	}
+	missingAgents := make([]*vizierpb.MissingAgent, 0)
+	for _, agentID := range a.metadata.AgentIDs {
+		if a.completedAgents[agentID] {
+			continue
+		}
+		agentReason := reason
+		if tableReason, ok := tableReasons[agentID]; ok {
+			agentReason = tableReason
+		}
+		missingAgents = append(missingAgents, &vizierpb.MissingAgent{
+			AgentID: agentID.String(),
+			Reason:  agentReason,
+		})
+	}
+	sort.Slice(missingAgents, func(i, j int) bool {
+		return missingAgents[i].AgentID < missingAgents[j].AgentID
+	})
+	sort.Strings(incompleteTables)
+	return missingAgents, incompleteTables
+}
+
+// completePartially sends the final execution stats for a query that allows partial results and whose
+// producers failed or timed out, marking the agents and tables whose results are missing.
+func (a *activeQuery) completePartially(ctx context.Context, queryID uuid.UUID, resultCh chan<- *vizierpb.ExecuteScriptResponse) error {
+	stats := &vizierpb.QueryExecutionStats{
+		Timing: &vizierpb.QueryTimingInfo{
+			ExecutionTimeNs:   time.Since(a.metadata.StartTime).Nanoseconds(),
+			CompilationTimeNs: a.compilationTimeNs,
+		},
+		BytesProcessed:   atomic.LoadInt64(&a.bytesProcessed),
+		RecordsProcessed: atomic.LoadInt64(&a.recordsProcessed),
+	}
+	stats.MissingAgents, stats.IncompleteTables = a.partialResults()
+	log.Infof("Query %s did not receive all results from its producers, completing with partial results. Incomplete tables: %s",
+		queryID.String(), strings.Join(stats.IncompleteTables, ", "))
+
+	resp := &vizierpb.ExecuteScriptResponse{
+		QueryID: queryID.String(),
+		Result: &vizierpb.ExecuteScriptResponse_Data{
+			Data: &vizierpb.QueryData{
+				ExecutionStats: stats,
+			},
+		},
+	}
+	select {
+	case <-ctx.Done():
+	case resultCh <- resp:
+	}
+	return nil
+}
+
 func (a *activeQuery) handleRequest(ctx context.Context, queryID uuid.UUID, msg *carnotpb.TransferResultChunkRequest, resultCh chan<- *vizierpb.ExecuteScriptResponse) error {
+	// Results for tables that were already reported as failed are dropped.
+	if queryResult := msg.GetQueryResult(); queryResult != nil {
+		if _, failed := a.failedTables[queryResult.GetTableName()]; failed {
+			return nil
+		}
+	}
+	if a.metadata.AllowPartialResults {
+		// Errors of queries that allow partial results are reported with the missing agents once the query completes.
+		if execError := msg.GetExecutionError(); execError != nil {
+			log.Infof("Agent of query %s failed: %s", queryID.String(), execError.Msg)
+			a.agentErrors = append(a.agentErrors, execError.Msg)
+			a.reportedAgents++
+			return nil
+		}
+		// Stats of the agents that don't send results only track the progress of the query.
+		if execStats := msg.GetExecutionAndTimingInfo(); execStats != nil && !a.recordAgentStats(execStats) {
+			return nil
+		}
+	}
+
 	// Stream the agent stream result to the client stream.
 	// Check if stream is complete. If so, close client stream.
 	// If there was an error, then cancel both sides of the stream.
@@ -322,6 +529,9 @@ func (a *activeQuery) handleRequest(ctx context.Context, queryID uuid.UUID, msg
 	// Optionally send the query plan (which requires the exec stats).
 	if execStats := msg.GetExecutionAndTimingInfo(); execStats != nil {
 		a.agentExecStats = &(execStats.AgentExecutionStats)
+		if a.metadata.OnExecStats != nil {
+			a.metadata.OnExecStats(execStats.AgentExecutionStats)
+		}
 	}
 
 	// If the query is complete and we need to send the query plan, send it before the final
@@ -353,6 +563,9 @@ func (a *activeQuery) handleRequest(ctx context.Context, queryID uuid.UUID, msg
 	if resp == nil {
 		return nil
 	}
+	if stats := resp.GetData().GetExecutionStats(); stats != nil && a.metadata.AllowPartialResults {
+		stats.MissingAgents, stats.IncompleteTables = a.partialResults()
+	}
 
 	select {
 	case <-ctx.Done():
@@ -395,7 +608,7 @@ func (a *activeQuery) cancelQuery(err error) {
 type QueryResultForwarder interface {
 	RegisterQuery(queryID uuid.UUID, tableIDMap map[string]string,
 		compilationTimeNs int64,
-		queryPlanOpts *QueryPlanOpts, queryName string) error
+		queryPlanOpts *QueryPlanOpts, queryName string, metadata *QueryMetadata) error
 
 	// Streams results from the agent stream to the client stream.
 	// Blocks until the stream (& the agent stream) has completed, been cancelled, or experienced an error.
@@ -410,6 +623,12 @@ type QueryResultForwarder interface {
 	// If the producer of data (i.e. Kelvin) errors then this function can be used to shutdown the stream.
 	// The producer should not call this function if there's a retry is possible.
 	ProducerCancelStream(queryID uuid.UUID, err error)
+
+	// Returns information about all of the queries currently registered in the result forwarder.
+	ListQueries() []*ActiveQueryInfo
+	// Cancels the query with the given ID. The consumer receives the given error and all producers
+	// are cancelled. Returns ErrQueryNotFound if the query is not registered.
+	CancelQuery(queryID uuid.UUID, err error) error
 }
 
 // QueryResultForwarderImpl implements the QueryResultForwarder interface.
@@ -472,7 +691,8 @@ func NewQueryResultForwarderWithOptions(opts ...QueryResultForwarderOption) Quer
 func (f *QueryResultForwarderImpl) RegisterQuery(queryID uuid.UUID, tableIDMap map[string]string,
 	compilationTimeNs int64,
 	queryPlanOpts *QueryPlanOpts,
-	queryName string) error {
+	queryName string,
+	metadata *QueryMetadata) error {
 	f.activeQueriesMutex.Lock()
 	defer f.activeQueriesMutex.Unlock()
 
@@ -481,7 +701,7 @@ func (f *QueryResultForwarderImpl) RegisterQuery(queryID uuid.UUID, tableIDMap m
 	}
 	watchdogCtx, watchdogCancel := context.WithCancel(context.Background())
 	producerCtx, producerCancel := context.WithCancel(context.Background())
-	aq := newActiveQuery(producerCtx, tableIDMap, compilationTimeNs, queryPlanOpts, watchdogCancel, queryName)
+	aq := newActiveQuery(producerCtx, tableIDMap, compilationTimeNs, queryPlanOpts, watchdogCancel, queryName, metadata)
 	f.activeQueries[queryID] = aq
 
 	deleteQuery := func() {
@@ -517,6 +737,7 @@ func (f *QueryResultForwarderImpl) StreamResults(ctx context.Context, queryID uu
 
 	// Waits for `resultSinkInitializationTimeout` time for all of the result sinks (tables)
 	// for this query to initialize a connection to the query broker.
+	sinkInitTimedOutCh := make(chan struct{})
 	go func() {
 		for {
 			select {
@@ -525,6 +746,11 @@ func (f *QueryResultForwarderImpl) StreamResults(ctx context.Context, queryID uu
 			case <-activeQuery.allTablesConnectedCh:
 				return
 			case <-time.After(f.resultSinkInitializationTimeout):
+				// Queries that allow partial results continue without the missing tables.
+				if activeQuery.metadata.AllowPartialResults {
+					close(sinkInitTimedOutCh)
+					return
+				}
 				missingSinks := activeQuery.uninitializedTables.values()
 				err := fmt.Errorf("Query %s failed to initialize all result tables within the deadline, missing: %s",
 					queryID.String(), strings.Join(missingSinks, ", "))
@@ -550,6 +776,28 @@ func (f *QueryResultForwarderImpl) StreamResults(ctx context.Context, queryID uu
 				activeQuery.cancelQuery(nil)
 				return nil
 			}
+			// Once every agent has reported, results that are still missing will never arrive.
+			if activeQuery.metadata.AllowPartialResults && activeQuery.allAgentsReported() {
+				err := activeQuery.completePartially(ctx, queryID, resultCh)
+				activeQuery.cancelQuery(err)
+				return err
+			}
+
+		case <-sinkInitTimedOutCh:
+			log.Infof("Query %s failed to initialize all result tables within the deadline, continuing without: %s",
+				queryID.String(), strings.Join(activeQuery.uninitializedTables.values(), ", "))
+			activeQuery.failUninitializedTables()
+			// Don't select on the closed channel again.
+			sinkInitTimedOutCh = nil
+			if activeQuery.queryComplete() {
+				activeQuery.cancelQuery(nil)
+				return nil
+			}
+
+		case <-activeQuery.producersTimedOutCh:
+			err := activeQuery.completePartially(ctx, queryID, resultCh)
+			activeQuery.cancelQuery(err)
+			return err
 		}
 	}
 }
@@ -607,3 +855,35 @@ func (f *QueryResultForwarderImpl) ProducerCancelStream(queryID uuid.UUID, err e
 	// Cancel the query if it hasn't already been cancelled.
 	activeQuery.cancelQuery(err)
 }
+
+// ListQueries returns information about all of the queries currently registered in the result forwarder.
+func (f *QueryResultForwarderImpl) ListQueries() []*ActiveQueryInfo {
+	f.activeQueriesMutex.Lock()
+	defer f.activeQueriesMutex.Unlock()
+
+	queries := make([]*ActiveQueryInfo, 0, len(f.activeQueries))
+	for queryID, aq := range f.activeQueries {
+		queries = append(queries, &ActiveQueryInfo{
+			QueryID:          queryID,
+			QueryName:        aq.queryName,
+			QueryMetadata:    aq.metadata,
+			RecordsProcessed: atomic.LoadInt64(&aq.recordsProcessed),
+			BytesProcessed:   atomic.LoadInt64(&aq.bytesProcessed),
+		})
+	}
+	return queries
+}
+
+// CancelQuery cancels a registered query. Cancelling the query cancels its producer context, which
+// closes the result streams from the Carnot instances executing the query and causes them to stop.
+func (f *QueryResultForwarderImpl) CancelQuery(queryID uuid.UUID, err error) error {
+	f.activeQueriesMutex.Lock()
+	activeQuery, present := f.activeQueries[queryID]
+	f.activeQueriesMutex.Unlock()
+
+	if !present {
+		return ErrQueryNotFound
+	}
+	activeQuery.cancelQuery(err)
+	return nil
+}
@@ -21,6 +21,7 @@ package controllers_test
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -162,7 +163,7 @@ func TestStreamResultsSimple(t *testing.T) {
 	}()
 	var err error
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -229,7 +230,7 @@ func TestStreamResultsAgentCancel(t *testing.T) {
 	}()
 	var err error
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -296,7 +297,7 @@ func TestStreamResultsClientContextCancel(t *testing.T) {
 	}()
 	errCh := make(chan error)
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		err := f.StreamResults(consumerCtx, queryID, resultCh)
@@ -364,7 +365,7 @@ func TestStreamResultsQueryPlan(t *testing.T) {
 		Plan:    plan,
 		PlanMap: planMap,
 	}
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, queryPlanOpts, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, queryPlanOpts, "", nil))
 
 	go func() {
 		err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -446,7 +447,7 @@ func TestStreamResultsWrongQueryID(t *testing.T) {
 	}()
 	var err error
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -509,7 +510,7 @@ func TestStreamResultsResultsBeforeInitialization(t *testing.T) {
 	}()
 	var err error
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -558,7 +559,7 @@ func TestStreamResultsNeverInitializedTable(t *testing.T) {
 	}()
 	var err error
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -622,7 +623,7 @@ func TestStreamResultsProducerTimeout(t *testing.T) {
 	}()
 	var err error
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -641,6 +642,173 @@ func TestStreamResultsProducerTimeout(t *testing.T) {
 	assert.Equal(t, err.Error(), fmt.Sprintf("Query %s timedout waiting for producers", queryID.String()))
 }
 
+func TestStreamResultsPartialNeverInitializedTable(t *testing.T) {
+	queryID := uuid.Must(uuid.NewV4())
+	agent1 := uuid.FromStringOrNil(agent1ID)
+	agent2 := uuid.FromStringOrNil(agent2ID)
+
+	f := controllers.NewQueryResultForwarderWithOptions(controllers.WithResultSinkTimeout(100 * time.Millisecond))
+	expectedTables := map[string]string{"foo": "123", "bar": "456"}
+	metadata := &controllers.QueryMetadata{
+		AgentIDs:            []uuid.UUID{agent1, agent2},
+		TableAgents:         map[string]uuid.UUID{"foo": agent1, "bar": agent2},
+		AllowPartialResults: true,
+	}
+	require.NoError(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", metadata))
+
+	resultCh := make(chan *vizierpb.ExecuteScriptResponse, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- f.StreamResults(context.Background(), queryID, resultCh)
+	}()
+
+	ctx := context.Background()
+	expected0, in0 := makeRowBatchResult(t, queryID, "foo", "123" /*eos*/, true)
+	require.NoError(t, f.ForwardQueryResult(ctx, makeInitiateConnectionRequest(queryID)))
+	require.NoError(t, f.ForwardQueryResult(ctx, in0))
+	// Wait for the result sink of "bar" to time out.
+	time.Sleep(300 * time.Millisecond)
+
+	// Results of the failed table that arrive late are dropped.
+	_, in1 := makeRowBatchResult(t, queryID, "bar", "456" /*eos*/, true)
+	require.NoError(t, f.ForwardQueryResult(ctx, in1))
+	expectedStats, in2 := makeExecStatsResult(t, queryID)
+	in2.GetExecutionAndTimingInfo().AgentExecutionStats = []*queryresultspb.AgentExecutionStats{
+		{AgentID: utils.ProtoFromUUID(agent1)},
+	}
+	require.NoError(t, f.ForwardQueryResult(ctx, in2))
+
+	require.NoError(t, <-errCh)
+	require.Len(t, resultCh, 2)
+	assert.Equal(t, expected0, (<-resultCh).GetData().Batch)
+	expectedStats.MissingAgents = []*vizierpb.MissingAgent{
+		{AgentID: agent2ID, Reason: "result sink was not initialized within the deadline"},
+	}
+	expectedStats.IncompleteTables = []string{"bar"}
+	assert.Equal(t, expectedStats, (<-resultCh).GetData().ExecutionStats)
+}
+
+func makeAgentStatsResult(queryID uuid.UUID, agentIDs ...uuid.UUID) *carnotpb.TransferResultChunkRequest {
+	info := &carnotpb.TransferResultChunkRequest_QueryExecutionAndTimingInfo{}
+	for _, agentID := range agentIDs {
+		info.AgentExecutionStats = append(info.AgentExecutionStats, &queryresultspb.AgentExecutionStats{
+			AgentID: utils.ProtoFromUUID(agentID),
+		})
+	}
+	return &carnotpb.TransferResultChunkRequest{
+		QueryID: utils.ProtoFromUUID(queryID),
+		Result: &carnotpb.TransferResultChunkRequest_ExecutionAndTimingInfo{
+			ExecutionAndTimingInfo: info,
+		},
+	}
+}
+
+func TestStreamResultsPartialProducerTimeout(t *testing.T) {
+	queryID := uuid.Must(uuid.NewV4())
+	kelvin := uuid.FromStringOrNil(agent1ID)
+	pem1 := uuid.FromStringOrNil(agent2ID)
+	pem2 := uuid.Must(uuid.NewV4())
+
+	f := controllers.NewQueryResultForwarderWithOptions(controllers.WithProducerTimeout(100 * time.Millisecond))
+	expectedTables := map[string]string{"foo": "123", "bar": "456"}
+	metadata := &controllers.QueryMetadata{
+		AgentIDs:            []uuid.UUID{kelvin, pem1, pem2},
+		TableAgents:         map[string]uuid.UUID{"foo": kelvin, "bar": kelvin},
+		AllowPartialResults: true,
+	}
+	require.NoError(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", metadata))
+
+	resultCh := make(chan *vizierpb.ExecuteScriptResponse, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- f.StreamResults(context.Background(), queryID, resultCh)
+	}()
+
+	ctx := context.Background()
+	_, in0 := makeRowBatchResult(t, queryID, "foo", "123" /*eos*/, true)
+	_, in1 := makeRowBatchResult(t, queryID, "bar", "456" /*eos*/, false)
+	require.NoError(t, f.ForwardQueryResult(ctx, makeInitiateConnectionRequest(queryID)))
+	require.NoError(t, f.ForwardQueryResult(ctx, in0))
+	require.NoError(t, f.ForwardQueryResult(ctx, in1))
+	// The first PEM completes its part of the query, but the second never does, so the Kelvin never sends EOS
+	// for "bar" and the query completes with partial results once the producers time out.
+	require.NoError(t, f.ForwardQueryResult(ctx, makeAgentStatsResult(queryID, pem1)))
+
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Query did not complete after the producer timeout")
+	}
+	// The stats of the PEM aren't sent to the client.
+	require.Len(t, resultCh, 3)
+	<-resultCh
+	<-resultCh
+	stats := (<-resultCh).GetData().ExecutionStats
+	require.NotNil(t, stats)
+	assert.Equal(t, int64(350), stats.Timing.CompilationTimeNs)
+	expectedMissing := []*vizierpb.MissingAgent{
+		{AgentID: kelvin.String(), Reason: "timed out before completing its part of the query"},
+		{AgentID: pem2.String(), Reason: "timed out before completing its part of the query"},
+	}
+	sort.Slice(expectedMissing, func(i, j int) bool { return expectedMissing[i].AgentID < expectedMissing[j].AgentID })
+	assert.Equal(t, expectedMissing, stats.MissingAgents)
+	assert.Equal(t, []string{"bar"}, stats.IncompleteTables)
+}
+
+func TestStreamResultsPartialAgentError(t *testing.T) {
+	queryID := uuid.Must(uuid.NewV4())
+	kelvin := uuid.FromStringOrNil(agent1ID)
+	pem := uuid.FromStringOrNil(agent2ID)
+
+	// The producer timeout is long, so that the test checks that the query completes once every agent reported.
+	f := controllers.NewQueryResultForwarderWithOptions(controllers.WithProducerTimeout(time.Minute))
+	expectedTables := map[string]string{"foo": "123"}
+	metadata := &controllers.QueryMetadata{
+		AgentIDs:            []uuid.UUID{kelvin, pem},
+		TableAgents:         map[string]uuid.UUID{"foo": kelvin},
+		AllowPartialResults: true,
+	}
+	require.NoError(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", metadata))
+
+	resultCh := make(chan *vizierpb.ExecuteScriptResponse, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- f.StreamResults(context.Background(), queryID, resultCh)
+	}()
+
+	ctx := context.Background()
+	expected0, in0 := makeRowBatchResult(t, queryID, "foo", "123" /*eos*/, false)
+	require.NoError(t, f.ForwardQueryResult(ctx, makeInitiateConnectionRequest(queryID)))
+	require.NoError(t, f.ForwardQueryResult(ctx, in0))
+	// The PEM fails, and so does the Kelvin that it sends data to.
+	for _, msg := range []string{"pem failed", "kelvin failed"} {
+		require.NoError(t, f.ForwardQueryResult(ctx, &carnotpb.TransferResultChunkRequest{
+			QueryID: utils.ProtoFromUUID(queryID),
+			Result: &carnotpb.TransferResultChunkRequest_ExecutionError{
+				ExecutionError: &statuspb.Status{ErrCode: statuspb.INTERNAL, Msg: msg},
+			},
+		}))
+	}
+
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Query did not complete once every agent reported")
+	}
+	require.Len(t, resultCh, 2)
+	assert.Equal(t, expected0, (<-resultCh).GetData().Batch)
+	stats := (<-resultCh).GetData().ExecutionStats
+	require.NotNil(t, stats)
+	reason := "failed to complete its part of the query: pem failed; kelvin failed"
+	assert.Equal(t, []*vizierpb.MissingAgent{
+		{AgentID: agent1ID, Reason: reason},
+		{AgentID: agent2ID, Reason: reason},
+	}, stats.MissingAgents)
+	assert.Equal(t, []string{"foo"}, stats.IncompleteTables)
+}
+
 func TestStreamResultsNewConsumer(t *testing.T) {
 	queryID := uuid.Must(uuid.NewV4())
 
@@ -681,7 +849,7 @@ func TestStreamResultsNewConsumer(t *testing.T) {
 	}()
 	var consumer1Err error
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		consumer1Err = f.StreamResults(consumer1Ctx, queryID, resultCh1)
@@ -785,7 +953,7 @@ func TestStreamResultsMultipleProducers(t *testing.T) {
 	}()
 	var err error
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -971,7 +1139,7 @@ func TestStreamResultsReceiveExecutionError(t *testing.T) {
 			}()
 			var err error
 
-			assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+			assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 			go func() {
 				err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -1022,7 +1190,7 @@ func TestStreamErrorWithMultipleProducers(t *testing.T) {
 	}()
 	var err error
 
-	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, ""))
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "", nil))
 
 	go func() {
 		err = f.StreamResults(consumerCtx, queryID, resultCh)
@@ -1069,3 +1237,64 @@ func TestStreamErrorWithMultipleProducers(t *testing.T) {
 	assert.Equal(t, expected0, results[0].GetData().Batch)
 	assert.Equal(t, controllers.StatusToVizierStatus(errorStatus), results[1].GetStatus())
 }
+
+func TestListAndCancelQuery(t *testing.T) {
+	queryID := uuid.Must(uuid.NewV4())
+	agentID := uuid.Must(uuid.NewV4())
+	startTime := time.Now()
+
+	f := controllers.NewQueryResultForwarder()
+
+	expectedTables := make(map[string]string)
+	expectedTables["foo"] = "123"
+
+	metadata := &controllers.QueryMetadata{
+		User:      "user@pixielabs.ai",
+		StartTime: startTime,
+		AgentIDs:  []uuid.UUID{agentID},
+	}
+	assert.Nil(t, f.RegisterQuery(queryID, expectedTables, 350, nil, "my_script", metadata))
+
+	resultCh := make(chan *vizierpb.ExecuteScriptResponse)
+	errCh := make(chan error)
+	go func() {
+		errCh <- f.StreamResults(context.Background(), queryID, resultCh)
+	}()
+
+	_, foo0 := makeRowBatchResult(t, queryID, "foo", "123" /*eos*/, false)
+	assert.Nil(t, f.ForwardQueryResult(context.Background(), makeInitiateConnectionRequest(queryID)))
+	assert.Nil(t, f.ForwardQueryResult(context.Background(), foo0))
+	<-resultCh
+
+	queries := f.ListQueries()
+	require.Equal(t, 1, len(queries))
+	assert.Equal(t, queryID, queries[0].QueryID)
+	assert.Equal(t, "my_script", queries[0].QueryName)
+	assert.Equal(t, "user@pixielabs.ai", queries[0].User)
+	assert.Equal(t, startTime, queries[0].StartTime)
+	assert.Equal(t, []uuid.UUID{agentID}, queries[0].AgentIDs)
+	rb := foo0.GetQueryResult().GetRowBatch()
+	assert.Equal(t, rb.NumRows, queries[0].RecordsProcessed)
+	assert.Equal(t, int64(rb.Size()), queries[0].BytesProcessed)
+
+	producerCtx, err := f.GetProducerCtx(queryID)
+	require.NoError(t, err)
+
+	cancelErr := fmt.Errorf("query cancelled")
+	require.NoError(t, f.CancelQuery(queryID, cancelErr))
+
+	select {
+	case err := <-errCh:
+		assert.Equal(t, cancelErr, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Consumer was not cancelled.")
+	}
+	select {
+	case <-producerCtx.Done():
+	case <-time.After(time.Second):
+		assert.Fail(t, "Producer context was not cancelled.")
+	}
+
+	assert.Equal(t, 0, len(f.ListQueries()))
+	assert.Equal(t, controllers.ErrQueryNotFound, f.CancelQuery(queryID, cancelErr))
+}
@@ -0,0 +1,319 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+)
+
+const (
+	// QueryOwnerRequestChannel is the NATS subject used to find the query broker replica that runs a query.
+	// The replica that runs the query replies with its address, the others don't reply.
+	QueryOwnerRequestChannel = "QueryBroker.QueryOwner"
+	// QueryBrokerReplicasChannel is the NATS subject used to find the addresses of all query broker replicas.
+	QueryBrokerReplicasChannel = "QueryBroker.Replicas"
+
+	// Marks requests forwarded by another replica, so that they are only handled locally.
+	forwardedRequestMetadataKey = "x-pl-qb-forwarded"
+	// How long to wait for the replicas to reply to a lookup.
+	queryRouterLookupTimeout = 2 * time.Second
+	// How often the number of replicas is refreshed.
+	queryRouterReplicasPeriod = 30 * time.Second
+)
+
+// QueryRouter routes requests for queries that run on another replica of the query broker to that replica.
+// Agents already send the results of a query to the replica that launched it, since the plan contains
+// the address of that replica's pod, so only client requests need to be routed.
+//
+// A query is owned by the replica that launched it for its whole lifetime: its state is not persisted or
+// handed off. A stopping replica drains, waiting for its running queries to finish, and the queries that outlive
+// the drain fail and must be rerun by the client.
+// The result cache is also local to each replica.
+type QueryRouter struct {
+	nc              *nats.Conn
+	address         string
+	resultForwarder QueryResultForwarder
+	dialOpts        []grpc.DialOption
+	lookupTimeout   time.Duration
+
+	ownerSub    *nats.Subscription
+	replicasSub *nats.Subscription
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+	// The number of other replicas that replied to the last lookup of WatchReplicas, or -1 before the first one.
+	knownPeers int
+}
+
+// NewQueryRouterFromServer creates a new QueryRouter for the queries run by the query broker server.
+func NewQueryRouterFromServer(s *Server, dialOpts []grpc.DialOption) (*QueryRouter, error) {
+	// Replicas are dialed by pod address, so the certificate is verified against the service hostname.
+	dialOpts = append(dialOpts, grpc.WithAuthority(s.env.SSLTargetName()))
+	return NewQueryRouter(s.natsConn, s.env.Address(), s.resultForwarder, dialOpts)
+}
+
+// NewQueryRouter creates a new QueryRouter for the replica at the given address.
+func NewQueryRouter(nc *nats.Conn, address string, resultForwarder QueryResultForwarder, dialOpts []grpc.DialOption) (*QueryRouter, error) {
+	r := &QueryRouter{
+		nc:              nc,
+		address:         address,
+		resultForwarder: resultForwarder,
+		dialOpts:        dialOpts,
+		lookupTimeout:   queryRouterLookupTimeout,
+		conns:           make(map[string]*grpc.ClientConn),
+		knownPeers:      -1,
+	}
+	var err error
+	r.ownerSub, err = nc.Subscribe(QueryOwnerRequestChannel, r.handleOwnerRequest)
+	if err != nil {
+		return nil, err
+	}
+	r.replicasSub, err = nc.Subscribe(QueryBrokerReplicasChannel, r.handleReplicasRequest)
+	if err != nil {
+		_ = r.ownerSub.Unsubscribe()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Close stops replying to lookups and closes the connections to the other replicas.
+func (r *QueryRouter) Close() {
+	_ = r.ownerSub.Unsubscribe()
+	_ = r.replicasSub.Unsubscribe()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+	r.conns = make(map[string]*grpc.ClientConn)
+}
+
+func (r *QueryRouter) isLocal(queryID uuid.UUID) bool {
+	_, err := r.resultForwarder.GetProducerCtx(queryID)
+	return err == nil
+}
+
+func (r *QueryRouter) handleOwnerRequest(msg *nats.Msg) {
+	queryID, err := uuid.FromString(string(msg.Data))
+	if err != nil || !r.isLocal(queryID) {
+		return
+	}
+	if err := msg.Respond([]byte(r.address)); err != nil {
+		log.WithError(err).WithField("query_id", queryID).Error("Failed to reply to query owner request")
+	}
+}
+
+func (r *QueryRouter) handleReplicasRequest(msg *nats.Msg) {
+	if err := msg.Respond([]byte(r.address)); err != nil {
+		log.WithError(err).Error("Failed to reply to query broker replicas request")
+	}
+}
+
+// Owner returns the address of the replica running the query, or ErrQueryNotFound if no replica is running it.
+func (r *QueryRouter) Owner(ctx context.Context, queryID uuid.UUID) (string, error) {
+	if r.isLocal(queryID) {
+		return r.address, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.lookupTimeout)
+	defer cancel()
+	msg, err := r.nc.RequestWithContext(ctx, QueryOwnerRequestChannel, []byte(queryID.String()))
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) || errors.Is(err, nats.ErrNoResponders) {
+		return "", ErrQueryNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(msg.Data), nil
+}
+
+// Peers returns the addresses of the other replicas of the query broker. It returns as soon as the replicas found by
+// the last lookup of WatchReplicas have replied, so replicas started since then may be missing.
+func (r *QueryRouter) Peers(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	expected := r.knownPeers
+	r.mu.Unlock()
+	return r.lookupPeers(ctx, expected)
+}
+
+// lookupPeers returns the addresses of the other replicas that reply to a lookup, once the expected number of them
+// has replied or the lookup times out. If expected is negative, replies are collected until the timeout.
+func (r *QueryRouter) lookupPeers(ctx context.Context, expected int) ([]string, error) {
+	if expected == 0 {
+		return nil, nil
+	}
+	inbox := r.nc.NewRespInbox()
+	sub, err := r.nc.SubscribeSync(inbox)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+	if err := r.nc.PublishRequest(QueryBrokerReplicasChannel, inbox, nil); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.lookupTimeout)
+	defer cancel()
+	var peers []string
+	for expected < 0 || len(peers) < expected {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			break
+		}
+		if address := string(msg.Data); address != r.address {
+			peers = append(peers, address)
+		}
+	}
+	return peers, nil
+}
+
+// WatchReplicas calls onChange with the number of query broker replicas, including this one, whenever it
+// changes, until quitCh is closed.
+func (r *QueryRouter) WatchReplicas(quitCh <-chan struct{}, onChange func(replicas int)) {
+	t := time.NewTicker(queryRouterReplicasPeriod)
+	defer t.Stop()
+
+	replicas := 1
+	for {
+		// There is no way to know how many replicas there are, so replies are collected until the timeout.
+		peers, err := r.lookupPeers(context.Background(), -1)
+		if err != nil {
+			log.WithError(err).Error("Failed to list query broker replicas")
+		} else {
+			r.mu.Lock()
+			r.knownPeers = len(peers)
+			r.mu.Unlock()
+			if len(peers)+1 != replicas {
+				replicas = len(peers) + 1
+				log.WithField("replicas", replicas).Info("Number of query broker replicas changed")
+				onChange(replicas)
+			}
+		}
+
+		select {
+		case <-quitCh:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (r *QueryRouter) client(address string) (vizierpb.VizierServiceClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conn, ok := r.conns[address]
+	if !ok {
+		var err error
+		conn, err = grpc.Dial(address, r.dialOpts...)
+		if err != nil {
+			return nil, err
+		}
+		r.conns[address] = conn
+	}
+	return vizierpb.NewVizierServiceClient(conn), nil
+}
+
+// isForwardedRequest returns whether the request was forwarded by another replica.
+func isForwardedRequest(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(forwardedRequestMetadataKey)) > 0
+}
+
+// forwardedContext returns a context to forward the incoming request to another replica with, keeping its credentials.
+func forwardedContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	md.Set(forwardedRequestMetadataKey, "true")
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// ExecuteScript forwards the request to resume a query to the replica at the address, sending its results to the consumer.
+func (r *QueryRouter) ExecuteScript(ctx context.Context, address string, req *vizierpb.ExecuteScriptRequest, consumer QueryResultConsumer) error {
+	client, err := r.client(address)
+	if err != nil {
+		return err
+	}
+	stream, err := client.ExecuteScript(forwardedContext(ctx), req)
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := consumer.Consume(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// CancelQuery forwards the request to cancel a query to the replica at the address.
+func (r *QueryRouter) CancelQuery(ctx context.Context, address string, req *vizierpb.CancelQueryRequest) (*vizierpb.CancelQueryResponse, error) {
+	client, err := r.client(address)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.CancelQuery(forwardedContext(ctx), req)
+	if err != nil {
+		return nil, err
+	}
+	return stream.Recv()
+}
+
+// ListPeerQueries returns the queries running on the other replicas. Replicas that fail to respond are skipped.
+func (r *QueryRouter) ListPeerQueries(ctx context.Context) ([]*vizierpb.RunningQuery, error) {
+	peers, err := r.Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var queries []*vizierpb.RunningQuery
+	for _, address := range peers {
+		client, err := r.client(address)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := client.ListQueries(forwardedContext(ctx), &vizierpb.ListQueriesRequest{})
+		if err == nil {
+			var resp *vizierpb.ListQueriesResponse
+			resp, err = stream.Recv()
+			if err == nil {
+				queries = append(queries, resp.Queries...)
+				continue
+			}
+		}
+		log.WithError(err).WithField("address", address).Error("Failed to list the queries of query broker replica")
+	}
+	return queries, nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/utils/testingutils"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+)
+
+func TestQueryRouter_Owner(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	f1 := controllers.NewQueryResultForwarder()
+	r1, err := controllers.NewQueryRouter(nc, "qb-1:50300", f1, nil)
+	require.NoError(t, err)
+	defer r1.Close()
+	r2, err := controllers.NewQueryRouter(nc, "qb-2:50300", controllers.NewQueryResultForwarder(), nil)
+	require.NoError(t, err)
+	defer r2.Close()
+
+	queryID := uuid.Must(uuid.NewV4())
+	require.NoError(t, f1.RegisterQuery(queryID, map[string]string{"t1": uuid.Must(uuid.NewV4()).String()}, 0, nil, "", nil))
+	defer func() { _ = f1.CancelQuery(queryID, nil) }()
+
+	owner, err := r1.Owner(context.Background(), queryID)
+	require.NoError(t, err)
+	assert.Equal(t, "qb-1:50300", owner)
+	owner, err = r2.Owner(context.Background(), queryID)
+	require.NoError(t, err)
+	assert.Equal(t, "qb-1:50300", owner)
+
+	_, err = r2.Owner(context.Background(), uuid.Must(uuid.NewV4()))
+	assert.Equal(t, controllers.ErrQueryNotFound, err)
+
+	peers, err := r1.Peers(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"qb-2:50300"}, peers)
+}
+
+func TestQueryRouter_WatchReplicas(t *testing.T) {
+	nc, cleanup := testingutils.MustStartTestNATS(t)
+	defer cleanup()
+
+	r1, err := controllers.NewQueryRouter(nc, "qb-1:50300", controllers.NewQueryResultForwarder(), nil)
+	require.NoError(t, err)
+	defer r1.Close()
+	r2, err := controllers.NewQueryRouter(nc, "qb-2:50300", controllers.NewQueryResultForwarder(), nil)
+	require.NoError(t, err)
+	defer r2.Close()
+
+	quitCh := make(chan struct{})
+	replicasCh := make(chan int, 1)
+	go r1.WatchReplicas(quitCh, func(replicas int) { replicasCh <- replicas })
+	defer close(quitCh)
+
+	select {
+	case replicas := <-replicasCh:
+		assert.Equal(t, 2, replicas)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Number of replicas was not reported")
+	}
+
+	// Once the replicas are known, lookups return as soon as they have all replied.
+	start := time.Now()
+	peers, err := r1.Peers(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"qb-2:50300"}, peers)
+	assert.Less(t, time.Since(start), time.Second)
+}
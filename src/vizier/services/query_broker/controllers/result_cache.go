@@ -0,0 +1,438 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+)
+
+var (
+	resultCacheRequestsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "query_result_cache_requests_total",
+		Help: "The number of cacheable queries, by whether they were served from the cache, coalesced into a running query, or executed.",
+	}, []string{"result"})
+	resultCacheBytesGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "query_result_cache_bytes",
+		Help: "The size in bytes of the completed query results held in the cache.",
+	})
+)
+
+func init() {
+	pflag.Duration("query_result_cache_ttl", 0, "How long the results of a query are reused for identical queries. 0 disables the cache.")
+	pflag.Int64("query_result_cache_max_bytes", 256*1024*1024, "The maximum size in bytes of the query results held in the cache of each query broker replica.")
+}
+
+// QueryRunFunc executes a query, sending its results to the given consumer.
+type QueryRunFunc func(ctx context.Context, consumer QueryResultConsumer) error
+
+// detachedContext keeps the values of its parent context, but not its deadline or cancellation.
+// This lets a query shared by several callers outlive the caller that started it.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// resultCacheCursor is the position of a caller in the responses of an entry.
+type resultCacheCursor struct {
+	next int
+}
+
+// resultCacheEntry holds the responses of a single query execution, which can be replayed by any
+// number of callers while the query is running and after it completes. Once the responses exceed the
+// cache's memory limit, the entry stops buffering them: it no longer accepts new callers, drops the
+// responses that every caller has received, and makes the query wait for slow callers to catch up.
+type resultCacheEntry struct {
+	ctx      context.Context
+	maxBytes int64
+
+	mu        sync.Mutex
+	responses []*vizierpb.ExecuteScriptResponse
+	// The index of responses[0] among all of the responses of the query.
+	base      int
+	sizeBytes int64
+	cursors   map[*resultCacheCursor]struct{}
+	// Whether the responses exceeded the memory limit, so that the entry can no longer be cached or joined.
+	overflowed bool
+	// Closed and replaced each time a response is added or the query finishes.
+	updateCh chan struct{}
+	// Closed and replaced each time buffered responses are released, after overflowing.
+	releaseCh chan struct{}
+	done      bool
+	err       error
+
+	// The following fields are guarded by the ResultCache mutex.
+	subscribers int
+	cancel      context.CancelFunc
+	expiresAt   time.Time
+}
+
+func newResultCacheEntry(ctx context.Context, maxBytes int64) *resultCacheEntry {
+	return &resultCacheEntry{
+		ctx:       ctx,
+		maxBytes:  maxBytes,
+		cursors:   make(map[*resultCacheCursor]struct{}),
+		updateCh:  make(chan struct{}),
+		releaseCh: make(chan struct{}),
+	}
+}
+
+// Consume records a response from the running query. After overflowing, it blocks until the callers have received
+// enough of the buffered responses for the entry to fit in the memory limit again.
+func (e *resultCacheEntry) Consume(resp *vizierpb.ExecuteScriptResponse) error {
+	e.mu.Lock()
+	for e.overflowed && e.sizeBytes > e.maxBytes {
+		releaseCh := e.releaseCh
+		e.mu.Unlock()
+		select {
+		case <-e.ctx.Done():
+			return e.ctx.Err()
+		case <-releaseCh:
+		}
+		e.mu.Lock()
+	}
+	defer e.mu.Unlock()
+
+	e.responses = append(e.responses, resp)
+	e.sizeBytes += int64(resp.Size())
+	if e.sizeBytes > e.maxBytes {
+		e.overflowed = true
+		e.releaseLocked()
+	}
+	close(e.updateCh)
+	e.updateCh = make(chan struct{})
+	return nil
+}
+
+func (e *resultCacheEntry) finish(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.done = true
+	e.err = err
+	close(e.updateCh)
+}
+
+func (e *resultCacheEntry) isDone() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.done
+}
+
+func (e *resultCacheEntry) isOverflowed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.overflowed
+}
+
+func (e *resultCacheEntry) subscribe() *resultCacheCursor {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cursor := &resultCacheCursor{next: e.base}
+	e.cursors[cursor] = struct{}{}
+	return cursor
+}
+
+func (e *resultCacheEntry) unsubscribe(cursor *resultCacheCursor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.cursors, cursor)
+	e.releaseLocked()
+}
+
+// releaseLocked drops the buffered responses that every caller has received, once the entry has overflowed.
+func (e *resultCacheEntry) releaseLocked() {
+	if !e.overflowed {
+		return
+	}
+	received := e.base + len(e.responses)
+	for cursor := range e.cursors {
+		if cursor.next < received {
+			received = cursor.next
+		}
+	}
+	n := received - e.base
+	if n == 0 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		e.sizeBytes -= int64(e.responses[i].Size())
+		e.responses[i] = nil
+	}
+	e.responses = e.responses[n:]
+	e.base = received
+	close(e.releaseCh)
+	e.releaseCh = make(chan struct{})
+}
+
+// replay sends all of the responses of the query to the consumer, waiting for new responses until the query completes.
+func (e *resultCacheEntry) replay(ctx context.Context, cursor *resultCacheCursor, consumer QueryResultConsumer) error {
+	for {
+		e.mu.Lock()
+		for cursor.next < e.base+len(e.responses) {
+			resp := e.responses[cursor.next-e.base]
+			e.mu.Unlock()
+			// Consumers may modify responses (e.g. to encrypt them), so each caller gets its own copy.
+			if err := consumer.Consume(proto.Clone(resp).(*vizierpb.ExecuteScriptResponse)); err != nil {
+				return err
+			}
+			e.mu.Lock()
+			cursor.next++
+			e.releaseLocked()
+		}
+		if e.done {
+			err := e.err
+			e.mu.Unlock()
+			return err
+		}
+		updateCh := e.updateCh
+		e.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-updateCh:
+		}
+	}
+}
+
+// ResultCache reuses the results of recent queries for identical queries, and coalesces identical
+// queries that run at the same time into a single execution. Each query broker replica has its own cache,
+// so identical queries sent to different replicas are executed separately.
+type ResultCache struct {
+	ttl      time.Duration
+	maxBytes int64
+
+	mu         sync.Mutex
+	entries    map[string]*resultCacheEntry
+	totalBytes int64
+}
+
+// NewResultCache creates a new ResultCache.
+func NewResultCache(ttl time.Duration, maxBytes int64) *ResultCache {
+	return &ResultCache{
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*resultCacheEntry),
+	}
+}
+
+// NewResultCacheFromFlags creates a new ResultCache configured by flags, or nil if the cache is disabled.
+func NewResultCacheFromFlags() *ResultCache {
+	ttl := viper.GetDuration("query_result_cache_ttl")
+	if ttl <= 0 {
+		return nil
+	}
+	return NewResultCache(ttl, viper.GetInt64("query_result_cache_max_bytes"))
+}
+
+// isCacheableRequest returns whether the results of the request may be shared with other requests.
+func isCacheableRequest(req *vizierpb.ExecuteScriptRequest) bool {
+	return !req.Mutation && req.QueryID == ""
+}
+
+func normalizeScript(script string) string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resultCacheKey returns the key for the request. Requests in different time buckets never share results,
+// since scripts usually query data relative to the current time. Neither do requests with different data access,
+// since their results are redacted differently.
+func (c *ResultCache) resultCacheKey(req *vizierpb.ExecuteScriptRequest, dataAccess *DataAccessDecision, now time.Time) string {
+	h := sha256.New()
+	writeString := func(s string) {
+		_ = binary.Write(h, binary.LittleEndian, int64(len(s)))
+		h.Write([]byte(s))
+	}
+
+	writeString(normalizeScript(req.QueryStr))
+	for _, f := range req.ExecFuncs {
+		writeString(f.FuncName)
+		writeString(f.OutputTablePrefix)
+		args := make([]string, len(f.ArgValues))
+		for i, arg := range f.ArgValues {
+			args[i] = arg.Name + "=" + arg.Value
+		}
+		sort.Strings(args)
+		_ = binary.Write(h, binary.LittleEndian, int64(len(args)))
+		for _, arg := range args {
+			writeString(arg)
+		}
+	}
+	if req.Configs != nil {
+		b, _ := req.Configs.Marshal()
+		writeString(string(b))
+	}
+	_ = binary.Write(h, binary.LittleEndian, req.AllowPartialResults)
+	if target := req.AgentTarget; target != nil {
+		// Map fields aren't marshaled in a stable order, so the target is written field by field.
+		labels := make([]string, 0, len(target.NodeLabels))
+		for k, v := range target.NodeLabels {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		for _, values := range [][]string{target.NodeNames, labels, target.Namespaces} {
+			_ = binary.Write(h, binary.LittleEndian, int64(len(values)))
+			for _, v := range values {
+				writeString(v)
+			}
+		}
+	}
+	writeString(string(dataAccess.Level))
+	_ = binary.Write(h, binary.LittleEndian, int64(len(dataAccess.Policies)))
+	for _, policy := range dataAccess.Policies {
+		writeString(policy)
+	}
+	_ = binary.Write(h, binary.LittleEndian, now.UnixNano()/int64(c.ttl))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Execute sends the results of the request to the consumer. If an identical request with the same data access
+// completed recently or is currently running, its results are replayed. Otherwise, the query is executed using run.
+func (c *ResultCache) Execute(ctx context.Context, req *vizierpb.ExecuteScriptRequest, dataAccess *DataAccessDecision,
+	consumer QueryResultConsumer, run QueryRunFunc) error {
+	now := time.Now()
+	key := c.resultCacheKey(req, dataAccess, now)
+
+	c.mu.Lock()
+	c.evictExpiredLocked(now)
+	e, ok := c.entries[key]
+	// Queries whose results overflowed the cache no longer buffer them from the start, so they can't be joined.
+	miss := !ok || e.isOverflowed()
+	var execCtx context.Context
+	switch {
+	case miss:
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithCancel(detachedContext{ctx})
+		e = newResultCacheEntry(execCtx, c.maxBytes)
+		e.cancel = cancel
+		c.entries[key] = e
+		resultCacheRequestsCounter.WithLabelValues("miss").Inc()
+	case e.isDone():
+		resultCacheRequestsCounter.WithLabelValues("hit").Inc()
+	default:
+		resultCacheRequestsCounter.WithLabelValues("coalesced").Inc()
+	}
+	e.subscribers++
+	cursor := e.subscribe()
+	// The query only starts once the caller is subscribed, so that its responses aren't released before the caller
+	// receives them.
+	if miss {
+		go c.runEntry(execCtx, key, e, run)
+	}
+	c.mu.Unlock()
+
+	defer c.unsubscribe(key, e, cursor)
+	return e.replay(ctx, cursor, consumer)
+}
+
+func (c *ResultCache) runEntry(ctx context.Context, key string, e *resultCacheEntry, run QueryRunFunc) {
+	err := run(ctx, e)
+	e.finish(err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.cancel()
+	if c.entries[key] != e {
+		return
+	}
+	// Failed queries and results that are too large are not kept for later callers.
+	if err != nil || e.isOverflowed() {
+		delete(c.entries, key)
+		return
+	}
+	e.expiresAt = time.Now().Add(c.ttl)
+	c.totalBytes += e.sizeBytes
+	resultCacheBytesGauge.Set(float64(c.totalBytes))
+	c.evictToFitLocked()
+}
+
+func (c *ResultCache) unsubscribe(key string, e *resultCacheEntry, cursor *resultCacheCursor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.unsubscribe(cursor)
+	e.subscribers--
+	// Stop the query if nobody is waiting for its results anymore.
+	if e.subscribers == 0 && !e.isDone() {
+		e.cancel()
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *ResultCache) removeLocked(key string, e *resultCacheEntry) {
+	delete(c.entries, key)
+	c.totalBytes -= e.sizeBytes
+	resultCacheBytesGauge.Set(float64(c.totalBytes))
+}
+
+func (c *ResultCache) evictExpiredLocked(now time.Time) {
+	for key, e := range c.entries {
+		if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+			c.removeLocked(key, e)
+		}
+	}
+}
+
+// evictToFitLocked removes the completed entries closest to expiring until the cache fits in its memory limit.
+func (c *ResultCache) evictToFitLocked() {
+	if c.totalBytes <= c.maxBytes {
+		return
+	}
+	var keys []string
+	for key, e := range c.entries {
+		if !e.expiresAt.IsZero() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].expiresAt.Before(c.entries[keys[j]].expiresAt)
+	})
+	for _, key := range keys {
+		if c.totalBytes <= c.maxBytes {
+			return
+		}
+		c.removeLocked(key, c.entries[key])
+	}
+}
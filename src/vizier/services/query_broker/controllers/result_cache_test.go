@@ -0,0 +1,290 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"px.dev/pixie/src/api/proto/vizierpb"
+	pixie "px.dev/pixie/src/operator/apis/px.dev/v1alpha1"
+	"px.dev/pixie/src/vizier/services/query_broker/controllers"
+)
+
+var fullDataAccess = &controllers.DataAccessDecision{Level: pixie.DataAccessFull}
+
+type collectingConsumer struct {
+	mu        sync.Mutex
+	responses []*vizierpb.ExecuteScriptResponse
+}
+
+func (c *collectingConsumer) Consume(resp *vizierpb.ExecuteScriptResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Mimic the encrypt consumer, which modifies the responses it is given.
+	c.responses = append(c.responses, resp)
+	resp.QueryID = "modified"
+	return nil
+}
+
+func (c *collectingConsumer) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.responses)
+}
+
+func cacheTestResponses() []*vizierpb.ExecuteScriptResponse {
+	return []*vizierpb.ExecuteScriptResponse{
+		{QueryID: "abc", Result: &vizierpb.ExecuteScriptResponse_MetaData{MetaData: &vizierpb.QueryMetadata{Name: "t1"}}},
+		{QueryID: "abc", Result: &vizierpb.ExecuteScriptResponse_MetaData{MetaData: &vizierpb.QueryMetadata{Name: "t2"}}},
+	}
+}
+
+func countingRunFunc(runs *int32, responses []*vizierpb.ExecuteScriptResponse) controllers.QueryRunFunc {
+	return func(ctx context.Context, consumer controllers.QueryResultConsumer) error {
+		atomic.AddInt32(runs, 1)
+		for _, resp := range responses {
+			if err := consumer.Consume(resp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestResultCache_ReplaysCompletedQuery(t *testing.T) {
+	c := controllers.NewResultCache(time.Hour, 1024*1024)
+	req := &vizierpb.ExecuteScriptRequest{QueryStr: "px.display(px.DataFrame('http_events'))"}
+	var runs int32
+	run := countingRunFunc(&runs, cacheTestResponses())
+
+	first := &collectingConsumer{}
+	require.NoError(t, c.Execute(context.Background(), req, fullDataAccess, first, run))
+	require.Equal(t, 2, first.count())
+
+	// Trailing whitespace and blank lines don't change the query.
+	sameReq := &vizierpb.ExecuteScriptRequest{QueryStr: "\npx.display(px.DataFrame('http_events'))  \n\n"}
+	second := &collectingConsumer{}
+	require.NoError(t, c.Execute(context.Background(), sameReq, fullDataAccess, second, run))
+	require.Equal(t, 2, second.count())
+	assert.Equal(t, "t1", second.responses[0].GetMetaData().Name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	otherReq := &vizierpb.ExecuteScriptRequest{QueryStr: "px.display(px.DataFrame('conn_stats'))"}
+	require.NoError(t, c.Execute(context.Background(), otherReq, fullDataAccess, &collectingConsumer{}, run))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+
+	// Callers with different data access never share results.
+	restricted := &controllers.DataAccessDecision{Level: pixie.DataAccessRestricted, Policies: []string{"payments"}}
+	require.NoError(t, c.Execute(context.Background(), req, restricted, &collectingConsumer{}, run))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&runs))
+}
+
+func TestResultCache_ExecFuncArgsAreKeyed(t *testing.T) {
+	c := controllers.NewResultCache(time.Hour, 1024*1024)
+	newReq := func(value string) *vizierpb.ExecuteScriptRequest {
+		return &vizierpb.ExecuteScriptRequest{
+			QueryStr: "script",
+			ExecFuncs: []*vizierpb.ExecuteScriptRequest_FuncToExecute{
+				{
+					FuncName: "f",
+					ArgValues: []*vizierpb.ExecuteScriptRequest_FuncToExecute_ArgValue{
+						{Name: "start_time", Value: value},
+					},
+				},
+			},
+		}
+	}
+	var runs int32
+	run := countingRunFunc(&runs, cacheTestResponses())
+
+	require.NoError(t, c.Execute(context.Background(), newReq("-5m"), fullDataAccess, &collectingConsumer{}, run))
+	require.NoError(t, c.Execute(context.Background(), newReq("-5m"), fullDataAccess, &collectingConsumer{}, run))
+	require.NoError(t, c.Execute(context.Background(), newReq("-10m"), fullDataAccess, &collectingConsumer{}, run))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+}
+
+func TestResultCache_CoalescesConcurrentQueries(t *testing.T) {
+	c := controllers.NewResultCache(time.Hour, 1024*1024)
+	req := &vizierpb.ExecuteScriptRequest{QueryStr: "script"}
+	var runs int32
+	proceed := make(chan struct{})
+	run := func(ctx context.Context, consumer controllers.QueryResultConsumer) error {
+		atomic.AddInt32(&runs, 1)
+		responses := cacheTestResponses()
+		if err := consumer.Consume(responses[0]); err != nil {
+			return err
+		}
+		<-proceed
+		return consumer.Consume(responses[1])
+	}
+
+	var wg sync.WaitGroup
+	consumers := make([]*collectingConsumer, 3)
+	for i := range consumers {
+		consumers[i] = &collectingConsumer{}
+		wg.Add(1)
+		go func(consumer *collectingConsumer) {
+			defer wg.Done()
+			assert.NoError(t, c.Execute(context.Background(), req, fullDataAccess, consumer, run))
+		}(consumers[i])
+	}
+	// Wait until every caller received the first response before letting the query finish.
+	require.Eventually(t, func() bool {
+		for _, consumer := range consumers {
+			if consumer.count() != 1 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 5*time.Millisecond)
+	close(proceed)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+	for _, consumer := range consumers {
+		assert.Equal(t, 2, consumer.count())
+	}
+}
+
+func TestResultCache_ErrorsAreNotCached(t *testing.T) {
+	c := controllers.NewResultCache(time.Hour, 1024*1024)
+	req := &vizierpb.ExecuteScriptRequest{QueryStr: "script"}
+	var runs int32
+	run := func(ctx context.Context, consumer controllers.QueryResultConsumer) error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("query failed")
+	}
+
+	assert.Error(t, c.Execute(context.Background(), req, fullDataAccess, &collectingConsumer{}, run))
+	assert.Error(t, c.Execute(context.Background(), req, fullDataAccess, &collectingConsumer{}, run))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+}
+
+func TestResultCache_TTLAndMemoryLimit(t *testing.T) {
+	var runs int32
+	run := countingRunFunc(&runs, cacheTestResponses())
+	req := &vizierpb.ExecuteScriptRequest{QueryStr: "script"}
+
+	// Results are not reused once they expire.
+	c := controllers.NewResultCache(20*time.Millisecond, 1024*1024)
+	require.NoError(t, c.Execute(context.Background(), req, fullDataAccess, &collectingConsumer{}, run))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, c.Execute(context.Background(), req, fullDataAccess, &collectingConsumer{}, run))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+
+	// Results larger than the memory limit are not kept.
+	atomic.StoreInt32(&runs, 0)
+	c = controllers.NewResultCache(time.Hour, 1)
+	require.NoError(t, c.Execute(context.Background(), req, fullDataAccess, &collectingConsumer{}, run))
+	require.NoError(t, c.Execute(context.Background(), req, fullDataAccess, &collectingConsumer{}, run))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+}
+
+type blockingConsumer struct {
+	collectingConsumer
+	proceed chan struct{}
+}
+
+func (c *blockingConsumer) Consume(resp *vizierpb.ExecuteScriptResponse) error {
+	<-c.proceed
+	return c.collectingConsumer.Consume(resp)
+}
+
+func TestResultCache_StreamsResultsLargerThanMemoryLimit(t *testing.T) {
+	var responses []*vizierpb.ExecuteScriptResponse
+	for i := 0; i < 10; i++ {
+		responses = append(responses, &vizierpb.ExecuteScriptResponse{
+			QueryID: "abc",
+			Result:  &vizierpb.ExecuteScriptResponse_MetaData{MetaData: &vizierpb.QueryMetadata{Name: fmt.Sprintf("t%d", i)}},
+		})
+	}
+	var runs, produced int32
+	run := func(ctx context.Context, consumer controllers.QueryResultConsumer) error {
+		atomic.AddInt32(&runs, 1)
+		for _, resp := range responses {
+			if err := consumer.Consume(resp); err != nil {
+				return err
+			}
+			atomic.AddInt32(&produced, 1)
+		}
+		return nil
+	}
+	c := controllers.NewResultCache(time.Hour, int64(2*responses[0].Size()))
+	req := &vizierpb.ExecuteScriptRequest{QueryStr: "script"}
+
+	slow := &blockingConsumer{proceed: make(chan struct{})}
+	slowErrCh := make(chan error, 1)
+	go func() {
+		slowErrCh <- c.Execute(context.Background(), req, fullDataAccess, slow, run)
+	}()
+
+	// The query waits for the slow caller instead of buffering all of its results.
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&produced) == 3 }, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&produced))
+
+	// An identical query can't join the overflowed one, so it runs on its own.
+	other := &collectingConsumer{}
+	require.NoError(t, c.Execute(context.Background(), req, fullDataAccess, other, run))
+	assert.Equal(t, 10, other.count())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+
+	close(slow.proceed)
+	require.NoError(t, <-slowErrCh)
+	require.Equal(t, 10, slow.count())
+	assert.Equal(t, "t9", slow.responses[9].GetMetaData().Name)
+
+	// Neither result was cached.
+	require.NoError(t, c.Execute(context.Background(), req, fullDataAccess, &collectingConsumer{}, run))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&runs))
+}
+
+func TestResultCache_CancelsQueryWithoutCallers(t *testing.T) {
+	c := controllers.NewResultCache(time.Hour, 1024*1024)
+	req := &vizierpb.ExecuteScriptRequest{QueryStr: "script"}
+	stopped := make(chan struct{})
+	run := func(ctx context.Context, consumer controllers.QueryResultConsumer) error {
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Execute(ctx, req, fullDataAccess, &collectingConsumer{}, run)
+	}()
+	cancel()
+	assert.Equal(t, context.Canceled, <-errCh)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Query was not cancelled")
+	}
+}
@@ -22,17 +22,20 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwe"
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
@@ -41,20 +44,30 @@ import (
 	"px.dev/pixie/src/carnot/planner/distributedpb"
 	"px.dev/pixie/src/carnot/planner/plannerpb"
 	"px.dev/pixie/src/carnot/udfspb"
+	"px.dev/pixie/src/shared/services/authcontext"
 	serviceUtils "px.dev/pixie/src/shared/services/utils"
 	"px.dev/pixie/src/utils"
 	funcs "px.dev/pixie/src/vizier/funcs/go"
+	"px.dev/pixie/src/vizier/services/metadata/controllers/agentconfig"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	"px.dev/pixie/src/vizier/services/query_broker/querybrokerenv"
 	"px.dev/pixie/src/vizier/services/query_broker/tracker"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
 )
 
-const healthCheckInterval = 5 * time.Second
+const (
+	healthCheckInterval  = 5 * time.Second
+	healthCheckQueryName = "healthcheck"
+	// How often a draining server checks whether its queries have finished.
+	drainPollPeriod = time.Second
+)
 
 type contextKey string
 
 const (
 	execStartKey = contextKey("execStart")
+	// Restricts a query to the agent with this ID, to probe its health.
+	probeAgentKey = contextKey("probeAgent")
 )
 
 // Planner describes the interface for any planner.
@@ -87,6 +100,24 @@ type Server struct {
 	planner Planner
 
 	queryExecFactory QueryExecutorFactory
+
+	admission *AdmissionController
+	// Shares the results of identical queries. nil if the cache is disabled.
+	resultCache *ResultCache
+	// Selects the agents of queries that target a subset of the cluster. nil if targeting isn't supported.
+	agentSelector AgentSelector
+	// Routes requests for queries running on other replicas of the query broker. nil if there is a single replica.
+	router *QueryRouter
+	// Records the executed queries in the query log. nil if the query log is disabled.
+	queryLogger *QueryLogger
+	// Checks the health of each agent. nil if the agents aren't checked.
+	agentHealth *AgentHealthChecker
+	// Streams the agent lifecycle events from the metadata service. nil if the events aren't available.
+	agentEvents metadatapb.MetadataServiceClient
+
+	// Closed when the server starts draining, after which new queries are rejected.
+	drainCh   chan struct{}
+	drainOnce sync.Once
 }
 
 // QueryExecutorFactory creates a new QueryExecutor.
@@ -130,12 +161,46 @@ func NewServerWithForwarderAndPlanner(env querybrokerenv.QueryBrokerEnv,
 		planner:           planner,
 		queryExecFactory:  queryExecFactory,
 		healthcheckQuitCh: make(chan struct{}),
+		drainCh:           make(chan struct{}),
+		admission:         NewAdmissionControllerFromFlags(),
+		resultCache:       NewResultCacheFromFlags(),
 	}
 	s.hcStatus.Store(fmt.Errorf("no healthcheck has run yet"))
 	go s.runHealthcheck()
 	return s, nil
 }
 
+// Drain rejects new queries, so that clients retry them on another replica, and waits until the queries running on
+// this replica have finished or ctx is done. The running queries can still be resumed while the server drains.
+func (s *Server) Drain(ctx context.Context) {
+	s.drainOnce.Do(func() { close(s.drainCh) })
+
+	t := time.NewTicker(drainPollPeriod)
+	defer t.Stop()
+	queries := len(s.resultForwarder.ListQueries())
+	if queries > 0 {
+		log.WithField("queries", queries).Info("Waiting for the running queries to finish")
+	}
+	for queries > 0 {
+		select {
+		case <-ctx.Done():
+			log.WithField("queries", queries).Warn("Stopping with queries still running")
+			return
+		case <-t.C:
+			queries = len(s.resultForwarder.ListQueries())
+		}
+	}
+}
+
+func (s *Server) isDraining() bool {
+	select {
+	case <-s.drainCh:
+		return true
+	default:
+		return false
+	}
+}
+
 // Close frees the planner memory in the server.
 func (s *Server) Close() {
 	s.healthcheckQuitOnce.Do(func() { close(s.healthcheckQuitCh) })
@@ -172,7 +237,7 @@ func (s *Server) CheckHealth(ctx context.Context) error {
 	checkVersionScript := `import px; px.display(px.Version())`
 	req := &vizierpb.ExecuteScriptRequest{
 		QueryStr:  checkVersionScript,
-		QueryName: "healthcheck",
+		QueryName: healthCheckQueryName,
 	}
 	consumer := &healthcheckConsumer{
 		receivedRowBatches: 0,
@@ -199,6 +264,25 @@ func (s *Server) CheckHealth(ctx context.Context) error {
 	return nil
 }
 
+// ProbeAgent runs a query reading the table on the agent with the given ID, and returns an error if the agent
+// didn't accept it. If the table is empty, the query doesn't read any data.
+func (s *Server) ProbeAgent(ctx context.Context, agentID uuid.UUID, table string) error {
+	script := `import px; px.display(px.Version())`
+	if table != "" {
+		script = fmt.Sprintf("import px; px.display(px.DataFrame(%q, start_time='-30s').head(1))", table)
+	}
+	req := &vizierpb.ExecuteScriptRequest{
+		QueryStr:  script,
+		QueryName: agentProbeQueryName,
+	}
+
+	queryExec := s.queryExecFactory(s, NewMutationExecutor)
+	if err := queryExec.Run(context.WithValue(ctx, probeAgentKey, agentID), req, &healthcheckConsumer{}); err != nil {
+		return err
+	}
+	return queryExec.Wait()
+}
+
 func (s *Server) runHealthcheck() {
 	t := time.NewTicker(healthCheckInterval)
 	defer t.Stop()
@@ -227,11 +311,15 @@ func (s *Server) HealthCheck(req *vizierpb.HealthCheckRequest, srv vizierpb.Vizi
 			log.Infof("Received unhealthy heath check result: %s", hcResult.Error())
 			code = int32(codes.Unavailable)
 		}
-		err := srv.Send(&vizierpb.HealthCheckResponse{
+		resp := &vizierpb.HealthCheckResponse{
 			Status: &vizierpb.Status{
 				Code: code,
 			},
-		})
+		}
+		if req.IncludeAgents && s.agentHealth != nil {
+			resp.Agents = s.agentHealth.Agents()
+		}
+		err := srv.Send(resp)
 		if err != nil {
 			log.WithError(err).Error("Error sending on stream, ending health check")
 			return err
@@ -245,6 +333,370 @@ func (s *Server) HealthCheck(req *vizierpb.HealthCheckRequest, srv vizierpb.Vizi
 	}
 }
 
+// queryUserFromContext returns the user or service that made the request. Requests from the cloud are authenticated
+// with a cluster token, which is signed with the cloud user that it was issued to.
+func queryUserFromContext(ctx context.Context) string {
+	aCtx, err := authcontext.FromContext(ctx)
+	if err != nil || aCtx.Claims == nil {
+		return ""
+	}
+	if userClaims := aCtx.Claims.GetUserClaims(); userClaims != nil {
+		if userClaims.Email != "" {
+			return userClaims.Email
+		}
+		return userClaims.UserID
+	}
+	if serviceClaims := aCtx.Claims.GetServiceClaims(); serviceClaims != nil {
+		return serviceClaims.ServiceID
+	}
+	if clusterClaims := aCtx.Claims.GetClusterClaims(); clusterClaims != nil {
+		return clusterClaims.User
+	}
+	return ""
+}
+
+// ListQueries responds with the queries that are currently running on Vizier.
+func (s *Server) ListQueries(req *vizierpb.ListQueriesRequest, srv vizierpb.VizierService_ListQueriesServer) error {
+	queries := s.resultForwarder.ListQueries()
+	resp := &vizierpb.ListQueriesResponse{
+		Queries: make([]*vizierpb.RunningQuery, len(queries)),
+	}
+	for i, q := range queries {
+		agentIDs := make([]string, len(q.AgentIDs))
+		for j, agentID := range q.AgentIDs {
+			agentIDs[j] = agentID.String()
+		}
+		resp.Queries[i] = &vizierpb.RunningQuery{
+			QueryID:          q.QueryID.String(),
+			QueryName:        q.QueryName,
+			User:             q.User,
+			StartTimestampNS: q.StartTime.UnixNano(),
+			AgentIDs:         agentIDs,
+			RecordsProcessed: q.RecordsProcessed,
+			BytesProcessed:   q.BytesProcessed,
+		}
+	}
+	if s.router != nil && !isForwardedRequest(srv.Context()) {
+		peerQueries, err := s.router.ListPeerQueries(srv.Context())
+		if err != nil {
+			return err
+		}
+		resp.Queries = append(resp.Queries, peerQueries...)
+	}
+	sort.Slice(resp.Queries, func(i, j int) bool {
+		return resp.Queries[i].StartTimestampNS < resp.Queries[j].StartTimestampNS
+	})
+	return srv.Send(resp)
+}
+
+// localQueryUser returns the user that launched the query, if the query is running on this replica.
+func (s *Server) localQueryUser(queryID uuid.UUID) (string, bool) {
+	for _, q := range s.resultForwarder.ListQueries() {
+		if q.QueryID == queryID {
+			return q.User, true
+		}
+	}
+	return "", false
+}
+
+// CancelQuery cancels a running query, if it was launched by the caller. The client executing the query receives a
+// cancellation error.
+func (s *Server) CancelQuery(req *vizierpb.CancelQueryRequest, srv vizierpb.VizierService_CancelQueryServer) error {
+	queryID, err := uuid.FromString(req.QueryID)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid query ID")
+	}
+
+	// Queries can only be cancelled by the user that launched them.
+	user := queryUserFromContext(srv.Context())
+	if queryUser, ok := s.localQueryUser(queryID); ok && queryUser != user {
+		return status.Errorf(codes.PermissionDenied, "query %s was launched by another user", queryID.String())
+	}
+	cancelErr := status.Errorf(codes.Canceled, "query %s was cancelled", queryID.String())
+	if user != "" {
+		cancelErr = status.Errorf(codes.Canceled, "query %s was cancelled by %s", queryID.String(), user)
+	}
+	err = s.resultForwarder.CancelQuery(queryID, cancelErr)
+	if err == ErrQueryNotFound && s.router != nil && !isForwardedRequest(srv.Context()) {
+		address, err := s.router.Owner(srv.Context(), queryID)
+		if err == nil {
+			resp, err := s.router.CancelQuery(srv.Context(), address, req)
+			if err != nil {
+				return err
+			}
+			return srv.Send(resp)
+		}
+		if err != ErrQueryNotFound {
+			return err
+		}
+	}
+	if err == ErrQueryNotFound {
+		return status.Errorf(codes.NotFound, "query %s is not running", queryID.String())
+	}
+	if err != nil {
+		return err
+	}
+	log.WithField("query_id", queryID).WithField("user", user).Info("Cancelled query")
+
+	return srv.Send(&vizierpb.CancelQueryResponse{
+		Status: &vizierpb.Status{
+			Code: int32(codes.OK),
+		},
+	})
+}
+
+// GetQueryLog responds with the queries recorded in the query log that were executed by the caller.
+func (s *Server) GetQueryLog(req *vizierpb.GetQueryLogRequest, srv vizierpb.VizierService_GetQueryLogServer) error {
+	if s.queryLogger == nil {
+		return status.Error(codes.Unimplemented, "the query log is not enabled")
+	}
+	// Users can only read the entries of the queries that they launched.
+	user := queryUserFromContext(srv.Context())
+	if user == "" {
+		return status.Error(codes.PermissionDenied, "the query log can only be read by a known user")
+	}
+	if req.User != "" && req.User != user {
+		return status.Error(codes.PermissionDenied, "the query log of other users can't be read")
+	}
+	req.User = user
+	resp, err := s.queryLogger.GetQueryLog(srv.Context(), req)
+	if err != nil {
+		log.WithError(err).Error("Failed to get the query log")
+		return status.Error(codes.Internal, "failed to get the query log")
+	}
+	return srv.Send(resp)
+}
+
+// tracepointContext forwards the credentials of the request to the metadata service, which manages the tracepoints.
+func tracepointContext(ctx context.Context) (context.Context, error) {
+	aCtx, err := authcontext.FromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("bearer %s", aCtx.AuthToken)), nil
+}
+
+// ListTracepoints responds with the tracepoints deployed on Vizier and their state on each agent.
+func (s *Server) ListTracepoints(req *vizierpb.ListTracepointsRequest, srv vizierpb.VizierService_ListTracepointsServer) error {
+	ctx, err := tracepointContext(srv.Context())
+	if err != nil {
+		return err
+	}
+	resp, err := s.mdtp.ListTracepoints(ctx, &metadatapb.ListTracepointsRequest{
+		Names: req.Names,
+	})
+	if err != nil {
+		return err
+	}
+
+	var hosts map[uuid.UUID]*agentpb.HostInfo
+	if s.agentsTracker != nil {
+		hosts = s.agentsTracker.GetAgentInfo().HostInfo()
+	}
+	tracepoints := make([]*vizierpb.TracepointInfo, len(resp.Tracepoints))
+	for i, tp := range resp.Tracepoints {
+		tracepoints[i] = tracepointToVizierTracepointInfo(tp, hosts)
+	}
+	sort.Slice(tracepoints, func(i, j int) bool {
+		return tracepoints[i].Name < tracepoints[j].Name
+	})
+	return srv.Send(&vizierpb.ListTracepointsResponse{
+		Tracepoints: tracepoints,
+	})
+}
+
+// DeleteTracepoint terminates the tracepoints with the given names on all agents.
+func (s *Server) DeleteTracepoint(req *vizierpb.DeleteTracepointRequest, srv vizierpb.VizierService_DeleteTracepointServer) error {
+	if len(req.Names) == 0 {
+		return status.Error(codes.InvalidArgument, "no tracepoint names specified")
+	}
+	ctx, err := tracepointContext(srv.Context())
+	if err != nil {
+		return err
+	}
+	resp, err := s.mdtp.RemoveTracepoint(ctx, &metadatapb.RemoveTracepointRequest{
+		Names: req.Names,
+	})
+	if err != nil {
+		return err
+	}
+	log.WithField("tracepoints", req.Names).WithField("user", queryUserFromContext(srv.Context())).Info("Deleted tracepoints")
+
+	return srv.Send(&vizierpb.DeleteTracepointResponse{
+		Status: StatusToVizierStatus(resp.Status),
+	})
+}
+
+// SetTracepointTTL replaces the TTL of a running tracepoint, to extend it without redeploying it.
+func (s *Server) SetTracepointTTL(req *vizierpb.SetTracepointTTLRequest, srv vizierpb.VizierService_SetTracepointTTLServer) error {
+	if req.Name == "" {
+		return status.Error(codes.InvalidArgument, "no tracepoint name specified")
+	}
+	if req.TTLNS <= 0 {
+		return status.Error(codes.InvalidArgument, "TTL must be positive")
+	}
+	ctx, err := tracepointContext(srv.Context())
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(req.TTLNS)
+	expiry := time.Now().Add(ttl)
+	resp, err := s.mdtp.SetTracepointTTL(ctx, &metadatapb.SetTracepointTTLRequest{
+		Name: req.Name,
+		TTL:  types.DurationProto(ttl),
+	})
+	if err != nil {
+		return err
+	}
+	log.WithField("tracepoint", req.Name).WithField("ttl", ttl).WithField("user", queryUserFromContext(srv.Context())).Info("Renewed tracepoint")
+
+	return srv.Send(&vizierpb.SetTracepointTTLResponse{
+		Status:            StatusToVizierStatus(resp.Status),
+		ExpiryTimestampNS: expiry.UnixNano(),
+	})
+}
+
+// UpdateAgentsConfig sets a config key on all agents matching the target, rolling it out in batches. The outcome
+// on the agents of each batch is streamed back as the rollout progresses.
+func (s *Server) UpdateAgentsConfig(req *vizierpb.UpdateAgentsConfigRequest, srv vizierpb.VizierService_UpdateAgentsConfigServer) error {
+	if err := agentconfig.ValidateKey(req.Key); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.BatchSize < 0 {
+		return status.Error(codes.InvalidArgument, "batch size must not be negative")
+	}
+	ctx, err := tracepointContext(srv.Context())
+	if err != nil {
+		return err
+	}
+	mdReq := &metadatapb.UpdateAgentsConfigRequest{
+		Key:           req.Key,
+		Value:         req.Value,
+		AgentSelector: agentTargetToTracepointSelector(req.AgentTarget),
+		BatchSize:     req.BatchSize,
+		Persist:       req.Persist,
+	}
+	if req.VerifyTimeoutNS > 0 {
+		mdReq.VerifyTimeout = types.DurationProto(time.Duration(req.VerifyTimeoutNS))
+	}
+	stream, err := s.mdconf.UpdateAgentsConfig(ctx, mdReq)
+	if err != nil {
+		return err
+	}
+	log.WithField("key", req.Key).WithField("value", req.Value).WithField("user", queryUserFromContext(srv.Context())).Info("Updating agents config")
+
+	var hosts map[uuid.UUID]*agentpb.HostInfo
+	if s.agentsTracker != nil {
+		hosts = s.agentsTracker.GetAgentInfo().HostInfo()
+	}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		vzResp := &vizierpb.UpdateAgentsConfigResponse{
+			AgentStatuses: make([]*vizierpb.AgentConfigStatus, len(resp.AgentStatuses)),
+			Persisted:     resp.Persisted,
+		}
+		for i, agentStatus := range resp.AgentStatuses {
+			vzResp.AgentStatuses[i] = agentConfigStatusToVizierAgentConfigStatus(agentStatus, hosts)
+		}
+		if err := srv.Send(vzResp); err != nil {
+			return err
+		}
+	}
+}
+
+// ListAgentConfigs returns the config settings persisted in the metadata service, along with the target of the
+// agents each of them applies to.
+func (s *Server) ListAgentConfigs(req *vizierpb.ListAgentConfigsRequest, srv vizierpb.VizierService_ListAgentConfigsServer) error {
+	ctx, err := tracepointContext(srv.Context())
+	if err != nil {
+		return err
+	}
+	resp, err := s.mdconf.ListAgentConfigs(ctx, &metadatapb.ListAgentConfigsRequest{})
+	if err != nil {
+		return err
+	}
+	vzResp := &vizierpb.ListAgentConfigsResponse{
+		Settings: make([]*vizierpb.AgentConfigSetting, len(resp.Settings)),
+	}
+	for i, setting := range resp.Settings {
+		vzResp.Settings[i] = &vizierpb.AgentConfigSetting{
+			Key:         setting.Key,
+			Value:       setting.Value,
+			AgentTarget: tracepointSelectorToAgentTarget(setting.AgentSelector),
+		}
+	}
+	return srv.Send(vzResp)
+}
+
+// DeleteAgentConfig removes the persisted config setting for a key and target, so that it's no longer applied to
+// agents as they register. Agents that already have the setting keep it until they restart.
+func (s *Server) DeleteAgentConfig(req *vizierpb.DeleteAgentConfigRequest, srv vizierpb.VizierService_DeleteAgentConfigServer) error {
+	if err := agentconfig.ValidateKey(req.Key); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx, err := tracepointContext(srv.Context())
+	if err != nil {
+		return err
+	}
+	_, err = s.mdconf.DeleteAgentConfig(ctx, &metadatapb.DeleteAgentConfigRequest{
+		Key:           req.Key,
+		AgentSelector: agentTargetToTracepointSelector(req.AgentTarget),
+	})
+	if err != nil {
+		return err
+	}
+	log.WithField("key", req.Key).WithField("user", queryUserFromContext(srv.Context())).Info("Deleted agents config")
+	return srv.Send(&vizierpb.DeleteAgentConfigResponse{})
+}
+
+// GetAgentEvents streams the lifecycle events of the agents, such as their registration and expiry, as they happen.
+func (s *Server) GetAgentEvents(req *vizierpb.GetAgentEventsRequest, srv vizierpb.VizierService_GetAgentEventsServer) error {
+	if s.agentEvents == nil {
+		return status.Error(codes.Unimplemented, "agent events are not available")
+	}
+	ctx, err := tracepointContext(srv.Context())
+	if err != nil {
+		return err
+	}
+	mdReq := &metadatapb.AgentEventsRequest{}
+	for _, t := range req.Types {
+		val, ok := vizierAgentEventTypeToAgentEventTypeMap[t]
+		if !ok {
+			return status.Errorf(codes.InvalidArgument, "invalid agent event type %s", t)
+		}
+		mdReq.Types = append(mdReq.Types, val)
+	}
+	stream, err := s.agentEvents.GetAgentEvents(ctx, mdReq)
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		vzResp := &vizierpb.GetAgentEventsResponse{
+			Events: make([]*vizierpb.AgentEvent, len(resp.Events)),
+		}
+		for i, e := range resp.Events {
+			vzResp.Events[i] = agentEventToVizierAgentEvent(e)
+		}
+		if err := srv.Send(vzResp); err != nil {
+			return err
+		}
+	}
+}
+
 type executeServerConsumer struct {
 	srv vizierpb.VizierService_ExecuteScriptServer
 }
@@ -304,6 +756,89 @@ func (e *encryptConsumer) Consume(result *vizierpb.ExecuteScriptResponse) error
 	return e.c.Consume(result)
 }
 
+// SetAdmissionController replaces the admission controller used to limit concurrent queries.
+func (s *Server) SetAdmissionController(a *AdmissionController) {
+	s.admission = a
+}
+
+// SetResultCache replaces the cache used to share the results of identical queries. nil disables the cache.
+func (s *Server) SetResultCache(c *ResultCache) {
+	s.resultCache = c
+}
+
+// SetAgentSelector sets the selector used for queries that target a subset of the cluster.
+func (s *Server) SetAgentSelector(selector AgentSelector) {
+	s.agentSelector = selector
+}
+
+// SetAgentHealthChecker sets the checker that reports the health of each agent in the health check.
+func (s *Server) SetAgentHealthChecker(c *AgentHealthChecker) {
+	s.agentHealth = c
+}
+
+// SetQueryLogger sets the logger used to record the executed queries in the query log.
+func (s *Server) SetQueryLogger(l *QueryLogger) {
+	s.queryLogger = l
+}
+
+// SetAgentEventsClient sets the metadata client used to stream the agent lifecycle events.
+func (s *Server) SetAgentEventsClient(c metadatapb.MetadataServiceClient) {
+	s.agentEvents = c
+}
+
+// SetReplicas sets the number of query broker replicas, which share the limits on concurrent queries.
+func (s *Server) SetReplicas(replicas int) {
+	s.admission.SetReplicas(replicas)
+}
+
+// SetQueryRouter sets the router used to reach the queries running on other replicas of the query broker.
+func (s *Server) SetQueryRouter(r *QueryRouter) {
+	s.router = r
+}
+
+// remoteQueryOwner returns the address of the replica running the query that the request resumes, or "" if the query
+// should be handled by this replica.
+func (s *Server) remoteQueryOwner(ctx context.Context, req *vizierpb.ExecuteScriptRequest) (string, error) {
+	if s.router == nil || req.QueryID == "" || isForwardedRequest(ctx) {
+		return "", nil
+	}
+	queryID, err := uuid.FromString(req.QueryID)
+	if err != nil {
+		return "", nil
+	}
+	address, err := s.router.Owner(ctx, queryID)
+	if err == ErrQueryNotFound {
+		return "", nil
+	}
+	if err != nil || address == s.env.Address() {
+		return "", err
+	}
+	return address, nil
+}
+
+// runQuery admits and executes the query, sending its results to the consumer.
+func (s *Server) runQuery(ctx context.Context, req *vizierpb.ExecuteScriptRequest, consumer QueryResultConsumer) error {
+	// Resumed queries are already running, so they don't need to be admitted again.
+	if req.QueryID == "" {
+		if s.isDraining() {
+			return status.Error(codes.Unavailable, "query broker is shutting down, retry the query")
+		}
+		release, err := s.admission.Admit(ctx, queryUserFromContext(ctx), queryPriorityFromName(req.QueryName))
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	queryExec := s.queryExecFactory(s, NewMutationExecutor)
+	if err := queryExec.Run(ctx, req, consumer); err != nil {
+		return err
+	}
+	log.Infof("Launched query: %s", queryExec.QueryID())
+
+	return queryExec.Wait()
+}
+
 // ExecuteScript executes the script and sends results through the gRPC stream.
 func (s *Server) ExecuteScript(req *vizierpb.ExecuteScriptRequest, srv vizierpb.VizierService_ExecuteScriptServer) error {
 	ctx := context.WithValue(srv.Context(), execStartKey, time.Now())
@@ -312,6 +847,17 @@ func (s *Server) ExecuteScript(req *vizierpb.ExecuteScriptRequest, srv vizierpb.
 	consumer = &executeServerConsumer{
 		srv: srv,
 	}
+
+	// Queries may be resumed on any replica, so the request is forwarded to the replica running the query.
+	// The results are already encrypted by that replica.
+	owner, err := s.remoteQueryOwner(ctx, req)
+	if err != nil {
+		return err
+	}
+	if owner != "" {
+		return s.router.ExecuteScript(ctx, owner, req, consumer)
+	}
+
 	if req.EncryptionOptions != nil {
 		c, err := newEncryptConsumer(consumer, req.EncryptionOptions)
 		if err != nil {
@@ -319,13 +865,17 @@ func (s *Server) ExecuteScript(req *vizierpb.ExecuteScriptRequest, srv vizierpb.
 		}
 		consumer = c
 	}
-	queryExec := s.queryExecFactory(s, NewMutationExecutor)
-	if err := queryExec.Run(ctx, req, consumer); err != nil {
-		return err
-	}
-	log.Infof("Launched query: %s", queryExec.QueryID())
 
-	return queryExec.Wait()
+	if s.resultCache != nil && isCacheableRequest(req) {
+		dataAccess, err := s.dataPrivacy.DataAccess(ctx, req)
+		if err != nil {
+			return err
+		}
+		return s.resultCache.Execute(ctx, req, dataAccess, consumer, func(ctx context.Context, consumer QueryResultConsumer) error {
+			return s.runQuery(ctx, req, consumer)
+		})
+	}
+	return s.runQuery(ctx, req, consumer)
 }
 
 // TransferResultChunk implements the API that allows the query broker receive streamed results
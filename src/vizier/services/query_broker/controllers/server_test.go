@@ -23,12 +23,16 @@ import (
 	"fmt"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
 	mock_vizierpb "px.dev/pixie/src/api/proto/vizierpb/mock"
@@ -36,13 +40,18 @@ import (
 	mock_carnotpb "px.dev/pixie/src/carnot/carnotpb/mock"
 	"px.dev/pixie/src/carnot/planner/distributedpb"
 	"px.dev/pixie/src/carnot/queryresultspb"
+	"px.dev/pixie/src/common/base/statuspb"
 	"px.dev/pixie/src/shared/services/authcontext"
 	"px.dev/pixie/src/table_store/schemapb"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/utils/testingutils"
+	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	mock_metadatapb "px.dev/pixie/src/vizier/services/metadata/metadatapb/mock"
+	"px.dev/pixie/src/vizier/services/metadata/storepb"
 	"px.dev/pixie/src/vizier/services/query_broker/controllers"
 	"px.dev/pixie/src/vizier/services/query_broker/querybrokerenv"
 	"px.dev/pixie/src/vizier/services/query_broker/tracker"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
 )
 
 type fakeQueryExecutor struct {
@@ -754,3 +763,493 @@ func TestTransferResultChunk_ClientStreamCancelled(t *testing.T) {
 	assert.NotNil(t, rf.ClientStreamError)
 	assert.Equal(t, 0, len(rf.ReceivedAgentResults))
 }
+
+func TestListAndCancelQueries(t *testing.T) {
+	queryID := uuid.Must(uuid.NewV4())
+	agentID := uuid.Must(uuid.NewV4())
+	startTime := time.Now()
+
+	rf := controllers.NewQueryResultForwarder()
+	err := rf.RegisterQuery(queryID, map[string]string{"foo": "123"}, 0, nil, "my_script", &controllers.QueryMetadata{
+		User:      "user@pixielabs.ai",
+		StartTime: startTime,
+		AgentIDs:  []uuid.UUID{agentID},
+	})
+	require.NoError(t, err)
+
+	dp := &fakeDataPrivacy{}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, dp, rf, nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+	listSrv := mock_vizierpb.NewMockVizierService_ListQueriesServer(ctrl)
+	listSrv.EXPECT().Context().Return(ctx).AnyTimes()
+	listSrv.EXPECT().
+		Send(&vizierpb.ListQueriesResponse{
+			Queries: []*vizierpb.RunningQuery{
+				{
+					QueryID:          queryID.String(),
+					QueryName:        "my_script",
+					User:             "user@pixielabs.ai",
+					StartTimestampNS: startTime.UnixNano(),
+					AgentIDs:         []string{agentID.String()},
+				},
+			},
+		}).
+		Return(nil)
+	require.NoError(t, s.ListQueries(&vizierpb.ListQueriesRequest{}, listSrv))
+
+	// Only the user that launched the query can cancel it.
+	otherSrv := mock_vizierpb.NewMockVizierService_CancelQueryServer(ctrl)
+	otherSrv.EXPECT().Context().Return(userCtx("other@pixielabs.ai")).AnyTimes()
+	err = s.CancelQuery(&vizierpb.CancelQueryRequest{QueryID: queryID.String()}, otherSrv)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	cancelSrv := mock_vizierpb.NewMockVizierService_CancelQueryServer(ctrl)
+	cancelSrv.EXPECT().Context().Return(userCtx("user@pixielabs.ai")).AnyTimes()
+	cancelSrv.EXPECT().
+		Send(&vizierpb.CancelQueryResponse{
+			Status: &vizierpb.Status{Code: int32(codes.OK)},
+		}).
+		Return(nil)
+	producerCtx, err := rf.GetProducerCtx(queryID)
+	require.NoError(t, err)
+	require.NoError(t, s.CancelQuery(&vizierpb.CancelQueryRequest{QueryID: queryID.String()}, cancelSrv))
+
+	select {
+	case <-producerCtx.Done():
+	case <-time.After(time.Second):
+		assert.Fail(t, "Producer context was not cancelled.")
+	}
+
+	// The query was deleted, so cancelling it again fails.
+	err = s.CancelQuery(&vizierpb.CancelQueryRequest{QueryID: queryID.String()}, cancelSrv)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	err = s.CancelQuery(&vizierpb.CancelQueryRequest{QueryID: "not-a-uuid"}, cancelSrv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetQueryLog_OnlyCallerEntries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mdql := mock_metadatapb.NewMockMetadataQueryLogServiceClient(ctrl)
+	l := controllers.NewQueryLogger(mdql, "jwt-key", time.Second)
+	defer l.Close()
+
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, &fakeDataPrivacy{}, controllers.NewQueryResultForwarder(), nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	defer s.Close()
+	s.SetQueryLogger(l)
+
+	resp := &vizierpb.GetQueryLogResponse{
+		Entries: []*vizierpb.QueryLogEntry{
+			{QueryID: "11285cdd-1de9-4ab1-ae6a-0ba08c8c676c", User: "user@pixielabs.ai"},
+		},
+	}
+	mdql.EXPECT().
+		GetQueryLog(gomock.Any(), &vizierpb.GetQueryLogRequest{User: "user@pixielabs.ai", SlowOnly: true}).
+		Return(resp, nil)
+
+	srv := mock_vizierpb.NewMockVizierService_GetQueryLogServer(ctrl)
+	srv.EXPECT().Context().Return(userCtx("user@pixielabs.ai")).AnyTimes()
+	srv.EXPECT().Send(resp).Return(nil)
+	require.NoError(t, s.GetQueryLog(&vizierpb.GetQueryLogRequest{SlowOnly: true}, srv))
+
+	// The entries of other users can't be read.
+	err = s.GetQueryLog(&vizierpb.GetQueryLogRequest{User: "other@pixielabs.ai"}, srv)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestTracepointManagement(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tpID := uuid.Must(uuid.NewV4())
+	agentID := uuid.Must(uuid.NewV4())
+	expiry := time.Unix(1700000000, 0)
+	expiresAt, err := types.TimestampProto(expiry)
+	require.NoError(t, err)
+
+	mdtp := mock_metadatapb.NewMockMetadataTracepointServiceClient(ctrl)
+	dp := &fakeDataPrivacy{}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, dp, nil, mdtp, nil, nil, nil, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+
+	mdtp.EXPECT().
+		ListTracepoints(gomock.Any(), &metadatapb.ListTracepointsRequest{Names: []string{"tp1"}}).
+		Return(&metadatapb.ListTracepointsResponse{
+			Tracepoints: []*metadatapb.ListTracepointsResponse_Tracepoint{
+				{
+					Info: &storepb.TracepointInfo{
+						ID:            utils.ProtoFromUUID(tpID),
+						Name:          "tp1",
+						ExpectedState: statuspb.RUNNING_STATE,
+					},
+					AgentStatuses: []*storepb.AgentTracepointStatus{
+						{
+							ID:      utils.ProtoFromUUID(tpID),
+							AgentID: utils.ProtoFromUUID(agentID),
+							State:   statuspb.FAILED_STATE,
+							Status: &statuspb.Status{
+								ErrCode: statuspb.INTERNAL,
+								Msg:     "failed to attach uprobe",
+							},
+						},
+					},
+					ExpiresAt: expiresAt,
+					State:     statuspb.FAILED_STATE,
+				},
+			},
+		}, nil)
+	listSrv := mock_vizierpb.NewMockVizierService_ListTracepointsServer(ctrl)
+	listSrv.EXPECT().Context().Return(ctx).AnyTimes()
+	listSrv.EXPECT().
+		Send(&vizierpb.ListTracepointsResponse{
+			Tracepoints: []*vizierpb.TracepointInfo{
+				{
+					ID:                tpID.String(),
+					Name:              "tp1",
+					State:             vizierpb.FAILED_STATE,
+					ExpectedState:     vizierpb.RUNNING_STATE,
+					ExpiryTimestampNS: expiry.UnixNano(),
+					AgentStatuses: []*vizierpb.AgentTracepointStatus{
+						{
+							AgentID: agentID.String(),
+							State:   vizierpb.FAILED_STATE,
+							Status: &vizierpb.Status{
+								Code:    int32(codes.Internal),
+								Message: "failed to attach uprobe",
+							},
+						},
+					},
+				},
+			},
+		}).
+		Return(nil)
+	require.NoError(t, s.ListTracepoints(&vizierpb.ListTracepointsRequest{Names: []string{"tp1"}}, listSrv))
+
+	mdtp.EXPECT().
+		RemoveTracepoint(gomock.Any(), &metadatapb.RemoveTracepointRequest{Names: []string{"tp1"}}).
+		Return(&metadatapb.RemoveTracepointResponse{Status: &statuspb.Status{ErrCode: statuspb.OK}}, nil)
+	deleteSrv := mock_vizierpb.NewMockVizierService_DeleteTracepointServer(ctrl)
+	deleteSrv.EXPECT().Context().Return(ctx).AnyTimes()
+	deleteSrv.EXPECT().
+		Send(&vizierpb.DeleteTracepointResponse{
+			Status: &vizierpb.Status{Code: int32(codes.OK)},
+		}).
+		Return(nil)
+	require.NoError(t, s.DeleteTracepoint(&vizierpb.DeleteTracepointRequest{Names: []string{"tp1"}}, deleteSrv))
+
+	mdtp.EXPECT().
+		SetTracepointTTL(gomock.Any(), &metadatapb.SetTracepointTTLRequest{
+			Name: "tp1",
+			TTL:  types.DurationProto(time.Hour),
+		}).
+		Return(nil, status.Error(codes.NotFound, "Tracepoint not found: tp1"))
+	renewSrv := mock_vizierpb.NewMockVizierService_SetTracepointTTLServer(ctrl)
+	renewSrv.EXPECT().Context().Return(ctx).AnyTimes()
+	err = s.SetTracepointTTL(&vizierpb.SetTracepointTTLRequest{Name: "tp1", TTLNS: int64(time.Hour)}, renewSrv)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	err = s.SetTracepointTTL(&vizierpb.SetTracepointTTLRequest{Name: "tp1"}, renewSrv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUpdateAgentsConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	agentA := uuid.Must(uuid.NewV4())
+	agentB := uuid.Must(uuid.NewV4())
+
+	mdconf := mock_metadatapb.NewMockMetadataConfigServiceClient(ctrl)
+	dp := &fakeDataPrivacy{}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, dp, nil, nil, mdconf, nil, nil, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+
+	mdStream := mock_metadatapb.NewMockMetadataConfigService_UpdateAgentsConfigClient(ctrl)
+	mdconf.EXPECT().
+		UpdateAgentsConfig(gomock.Any(), &metadatapb.UpdateAgentsConfigRequest{
+			Key:   "datastream_buffer_size",
+			Value: "4096",
+			AgentSelector: &storepb.TracepointAgentSelector{
+				NodeNames: []string{"node-a", "node-b"},
+			},
+			BatchSize:     1,
+			VerifyTimeout: types.DurationProto(10 * time.Second),
+			Persist:       true,
+		}).
+		Return(mdStream, nil)
+	gomock.InOrder(
+		mdStream.EXPECT().Recv().Return(&metadatapb.UpdateAgentsConfigResponse{
+			AgentStatuses: []*metadatapb.AgentConfigStatus{
+				{AgentID: utils.ProtoFromUUID(agentA), State: metadatapb.AGENT_CONFIG_APPLIED},
+			},
+		}, nil),
+		mdStream.EXPECT().Recv().Return(&metadatapb.UpdateAgentsConfigResponse{
+			AgentStatuses: []*metadatapb.AgentConfigStatus{
+				{AgentID: utils.ProtoFromUUID(agentB), State: metadatapb.AGENT_CONFIG_FAILED, Message: "timed out"},
+			},
+		}, nil),
+		mdStream.EXPECT().Recv().Return(nil, io.EOF),
+	)
+
+	srv := mock_vizierpb.NewMockVizierService_UpdateAgentsConfigServer(ctrl)
+	srv.EXPECT().Context().Return(ctx).AnyTimes()
+	gomock.InOrder(
+		srv.EXPECT().Send(&vizierpb.UpdateAgentsConfigResponse{
+			AgentStatuses: []*vizierpb.AgentConfigStatus{
+				{AgentID: agentA.String(), State: vizierpb.AGENT_CONFIG_APPLIED},
+			},
+		}).Return(nil),
+		srv.EXPECT().Send(&vizierpb.UpdateAgentsConfigResponse{
+			AgentStatuses: []*vizierpb.AgentConfigStatus{
+				{AgentID: agentB.String(), State: vizierpb.AGENT_CONFIG_FAILED, Message: "timed out"},
+			},
+		}).Return(nil),
+	)
+	require.NoError(t, s.UpdateAgentsConfig(&vizierpb.UpdateAgentsConfigRequest{
+		Key:             "datastream_buffer_size",
+		Value:           "4096",
+		AgentTarget:     &vizierpb.AgentTarget{NodeNames: []string{"node-a", "node-b"}},
+		BatchSize:       1,
+		VerifyTimeoutNS: int64(10 * time.Second),
+		Persist:         true,
+	}, srv))
+
+	err = s.UpdateAgentsConfig(&vizierpb.UpdateAgentsConfigRequest{Value: "4096"}, srv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	err = s.UpdateAgentsConfig(&vizierpb.UpdateAgentsConfigRequest{Key: "../tracepoint/tp1", Value: "4096"}, srv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListAndDeleteAgentConfigs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mdconf := mock_metadatapb.NewMockMetadataConfigServiceClient(ctrl)
+	dp := &fakeDataPrivacy{}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, dp, nil, nil, mdconf, nil, nil, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+
+	mdconf.EXPECT().
+		ListAgentConfigs(gomock.Any(), &metadatapb.ListAgentConfigsRequest{}).
+		Return(&metadatapb.ListAgentConfigsResponse{
+			Settings: []*storepb.AgentConfigSetting{
+				{Key: "datastream_buffer_size", Value: "4096"},
+				{
+					Key:           "datastream_buffer_size",
+					Value:         "8192",
+					AgentSelector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-a"}},
+				},
+			},
+		}, nil)
+	listSrv := mock_vizierpb.NewMockVizierService_ListAgentConfigsServer(ctrl)
+	listSrv.EXPECT().Context().Return(ctx).AnyTimes()
+	listSrv.EXPECT().Send(&vizierpb.ListAgentConfigsResponse{
+		Settings: []*vizierpb.AgentConfigSetting{
+			{Key: "datastream_buffer_size", Value: "4096"},
+			{
+				Key:         "datastream_buffer_size",
+				Value:       "8192",
+				AgentTarget: &vizierpb.AgentTarget{NodeNames: []string{"node-a"}},
+			},
+		},
+	}).Return(nil)
+	require.NoError(t, s.ListAgentConfigs(&vizierpb.ListAgentConfigsRequest{}, listSrv))
+
+	mdconf.EXPECT().
+		DeleteAgentConfig(gomock.Any(), &metadatapb.DeleteAgentConfigRequest{
+			Key:           "datastream_buffer_size",
+			AgentSelector: &storepb.TracepointAgentSelector{NodeNames: []string{"node-a"}},
+		}).
+		Return(&metadatapb.DeleteAgentConfigResponse{}, nil)
+	mdconf.EXPECT().
+		DeleteAgentConfig(gomock.Any(), &metadatapb.DeleteAgentConfigRequest{Key: "datastream_buffer_size"}).
+		Return(nil, status.Error(codes.NotFound, "not found"))
+	deleteSrv := mock_vizierpb.NewMockVizierService_DeleteAgentConfigServer(ctrl)
+	deleteSrv.EXPECT().Context().Return(ctx).AnyTimes()
+	deleteSrv.EXPECT().Send(&vizierpb.DeleteAgentConfigResponse{}).Return(nil)
+	require.NoError(t, s.DeleteAgentConfig(&vizierpb.DeleteAgentConfigRequest{
+		Key:         "datastream_buffer_size",
+		AgentTarget: &vizierpb.AgentTarget{NodeNames: []string{"node-a"}},
+	}, deleteSrv))
+
+	err = s.DeleteAgentConfig(&vizierpb.DeleteAgentConfigRequest{Key: "datastream_buffer_size"}, deleteSrv)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	err = s.DeleteAgentConfig(&vizierpb.DeleteAgentConfigRequest{Key: "a/b"}, deleteSrv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetAgentEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	agentID := uuid.Must(uuid.NewV4())
+	eventTime := time.Unix(0, 1000)
+	eventTimePb, err := types.TimestampProto(eventTime)
+	require.NoError(t, err)
+
+	mds := mock_metadatapb.NewMockMetadataServiceClient(ctrl)
+	dp := &fakeDataPrivacy{}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, dp, nil, nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	defer s.Close()
+
+	srv := mock_vizierpb.NewMockVizierService_GetAgentEventsServer(ctrl)
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+	srv.EXPECT().Context().Return(ctx).AnyTimes()
+
+	err = s.GetAgentEvents(&vizierpb.GetAgentEventsRequest{}, srv)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	s.SetAgentEventsClient(mds)
+
+	mdStream := mock_metadatapb.NewMockMetadataService_GetAgentEventsClient(ctrl)
+	mds.EXPECT().
+		GetAgentEvents(gomock.Any(), &metadatapb.AgentEventsRequest{
+			Types: []metadatapb.AgentEventType{metadatapb.AGENT_EVENT_EXPIRED, metadatapb.AGENT_EVENT_DELETED},
+		}).
+		Return(mdStream, nil)
+	gomock.InOrder(
+		mdStream.EXPECT().Recv().Return(&metadatapb.AgentEventsResponse{
+			Events: []*metadatapb.AgentEvent{
+				{
+					Type: metadatapb.AGENT_EVENT_EXPIRED,
+					Time: eventTimePb,
+					Agent: &agentpb.Agent{
+						Info: &agentpb.AgentInfo{
+							AgentID: utils.ProtoFromUUID(agentID),
+							HostInfo: &agentpb.HostInfo{
+								Hostname: "node-a",
+								PodName:  "pem-abcd",
+								HostIP:   "10.0.0.1",
+							},
+							Capabilities: &agentpb.AgentCapabilities{CollectsData: true},
+						},
+						LastHeartbeatNS: 500,
+					},
+				},
+			},
+		}, nil),
+		mdStream.EXPECT().Recv().Return(nil, io.EOF),
+	)
+	srv.EXPECT().Send(&vizierpb.GetAgentEventsResponse{
+		Events: []*vizierpb.AgentEvent{
+			{
+				Type:            vizierpb.AGENT_EVENT_EXPIRED,
+				TimestampNS:     1000,
+				AgentID:         agentID.String(),
+				Hostname:        "node-a",
+				HostIP:          "10.0.0.1",
+				PodName:         "pem-abcd",
+				CollectsData:    true,
+				LastHeartbeatNS: 500,
+			},
+		},
+	}).Return(nil)
+
+	require.NoError(t, s.GetAgentEvents(&vizierpb.GetAgentEventsRequest{
+		Types: []vizierpb.AgentEventType{vizierpb.AGENT_EVENT_EXPIRED, vizierpb.AGENT_EVENT_DELETED},
+	}, srv))
+
+	err = s.GetAgentEvents(&vizierpb.GetAgentEventsRequest{
+		Types: []vizierpb.AgentEventType{vizierpb.AGENT_EVENT_TYPE_UNKNOWN},
+	}, srv)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestExecuteScript_AdmissionRejected(t *testing.T) {
+	queryExecFactory := func(*controllers.Server, controllers.MutationExecFactory) controllers.QueryExecutor {
+		t.Fatal("Query should not be executed")
+		return nil
+	}
+
+	dp := &fakeDataPrivacy{}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, dp, nil, nil, nil, nil, nil, queryExecFactory)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Fill the only slot, with no room to queue.
+	admission := controllers.NewAdmissionController(controllers.AdmissionControllerOpts{
+		MaxConcurrent: 1,
+		MaxQueued:     0,
+	})
+	release, err := admission.Admit(context.Background(), "other", controllers.QueryPriorityInteractive)
+	require.NoError(t, err)
+	defer release()
+	s.SetAdmissionController(admission)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	srv := mock_vizierpb.NewMockVizierService_ExecuteScriptServer(ctrl)
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+	srv.EXPECT().Context().Return(ctx).AnyTimes()
+
+	err = s.ExecuteScript(&vizierpb.ExecuteScriptRequest{QueryStr: "px.display()"}, srv)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestExecuteScript_Draining(t *testing.T) {
+	queryExecFactory := func(*controllers.Server, controllers.MutationExecFactory) controllers.QueryExecutor {
+		t.Fatal("Query should not be executed")
+		return nil
+	}
+
+	rf := controllers.NewQueryResultForwarder()
+	dp := &fakeDataPrivacy{}
+	s, err := controllers.NewServerWithForwarderAndPlanner(nil, nil, dp, rf, nil, nil, nil, nil, queryExecFactory)
+	require.NoError(t, err)
+	defer s.Close()
+
+	queryID := uuid.Must(uuid.NewV4())
+	require.NoError(t, rf.RegisterQuery(queryID, map[string]string{"t1": uuid.Must(uuid.NewV4()).String()}, 0, nil, "", nil))
+
+	drained := make(chan struct{})
+	go func() {
+		s.Drain(context.Background())
+		close(drained)
+	}()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	srv := mock_vizierpb.NewMockVizierService_ExecuteScriptServer(ctrl)
+	ctx := authcontext.NewContext(context.Background(), authcontext.New())
+	srv.EXPECT().Context().Return(ctx).AnyTimes()
+
+	// New queries are rejected as soon as the server starts draining.
+	require.Eventually(t, func() bool {
+		err := s.ExecuteScript(&vizierpb.ExecuteScriptRequest{QueryStr: "px.display()"}, srv)
+		return status.Code(err) == codes.Unavailable
+	}, 5*time.Second, 10*time.Millisecond)
+
+	select {
+	case <-drained:
+		t.Fatal("Drain returned while a query was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, rf.CancelQuery(queryID, nil))
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain did not return after the running query finished")
+	}
+}
@@ -42,6 +42,10 @@ import (
 // PassthroughRequestChannel is the NATS channel over which stream API requests are sent.
 const PassthroughRequestChannel = "c2v.VizierPassthroughRequest"
 
+// passthroughQueueGroup is the NATS queue group of the query broker replicas. Each request is handled by a single
+// replica of the group.
+const passthroughQueueGroup = "query-broker"
+
 // RequestState is the state information for a stream API request.
 type RequestState struct {
 	requestID string             // ID of the request
@@ -59,7 +63,9 @@ type PassThroughProxy struct {
 	mu       sync.Mutex // Mutex for requests map.
 	subCh    chan *nats.Msg
 	sub      *nats.Subscription
-	quitCh   chan bool
+	// Cancellations are sent to every replica, since the replica handling the request isn't known.
+	cancelSub *nats.Subscription
+	quitCh    chan bool
 }
 
 // Stream is a wrapper around a GRPC stream.
@@ -74,11 +80,16 @@ func NewPassThroughProxy(nc *nats.Conn, vzClient vizierpb.VizierServiceClient) (
 	quitCh := make(chan bool)
 	// Buffer channel so we don't drop passthrough requests.
 	subCh := make(chan *nats.Msg, 4096)
-	sub, err := nc.ChanSubscribe(PassthroughRequestChannel, subCh)
+	sub, err := nc.ChanQueueSubscribe(PassthroughRequestChannel, passthroughQueueGroup, subCh)
 	if err != nil {
 		return nil, err
 	}
-	return &PassThroughProxy{nc: nc, requests: requests, quitCh: quitCh, vzClient: vzClient, subCh: subCh, sub: sub}, nil
+	cancelSub, err := nc.ChanSubscribe(PassthroughRequestChannel, subCh)
+	if err != nil {
+		_ = sub.Unsubscribe()
+		return nil, err
+	}
+	return &PassThroughProxy{nc: nc, requests: requests, quitCh: quitCh, vzClient: vzClient, subCh: subCh, sub: sub, cancelSub: cancelSub}, nil
 }
 
 // Run starts the stream listener.
@@ -122,10 +133,16 @@ func (s *PassThroughProxy) handleMessage(msg *nats.Msg) error {
 		return err
 	}
 
-	if req.GetCancelReq() == nil {
-		err = s.handleRequest(req)
-	} else {
+	// Every message is received by both subscriptions: requests are only handled from the queue subscription,
+	// and cancellations from the subscription of every replica.
+	isCancel := req.GetCancelReq() != nil
+	if msg.Sub != nil && (msg.Sub == s.cancelSub) != isCancel {
+		return nil
+	}
+	if isCancel {
 		err = s.handleCancel(req)
+	} else {
+		err = s.handleRequest(req)
 	}
 
 	return err
@@ -165,7 +182,8 @@ func (s *PassThroughProxy) handleCancel(req *cvmsgspb.C2VAPIStreamRequest) error
 	if r, ok := s.requests[req.RequestID]; ok {
 		r.cancel()
 	} else {
-		log.WithField("RequestID", req.RequestID).Info("Could not find request to cancel")
+		// The request may be handled by another replica.
+		log.WithField("RequestID", req.RequestID).Debug("Could not find request to cancel")
 	}
 
 	return nil
@@ -181,6 +199,26 @@ func (s *PassThroughProxy) runRequest(reqState *RequestState, msg *cvmsgspb.C2VA
 		stream = NewExecuteScriptStream(s.vzClient)
 	case *cvmsgspb.C2VAPIStreamRequest_HcReq:
 		stream = NewHealthCheckStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_ListQueriesReq:
+		stream = NewListQueriesStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_CancelQueryReq:
+		stream = NewCancelQueryStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_QueryLogReq:
+		stream = NewGetQueryLogStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_ListTracepointsReq:
+		stream = NewListTracepointsStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_DeleteTracepointReq:
+		stream = NewDeleteTracepointStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_SetTracepointTTLReq:
+		stream = NewSetTracepointTTLStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_UpdateAgentsConfigReq:
+		stream = NewUpdateAgentsConfigStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_AgentEventsReq:
+		stream = NewGetAgentEventsStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_ListAgentConfigsReq:
+		stream = NewListAgentConfigsStream(s.vzClient)
+	case *cvmsgspb.C2VAPIStreamRequest_DeleteAgentConfigReq:
+		stream = NewDeleteAgentConfigStream(s.vzClient)
 	default:
 		log.Error("Unhandled message type")
 		return
@@ -265,9 +303,10 @@ func (s *PassThroughProxy) cleanupRequest(reqState *RequestState) {
 }
 
 func (s *PassThroughProxy) cleanup() {
-	err := s.sub.Unsubscribe()
-	if err != nil {
-		log.WithError(err).Error("Failed to unsubscribe")
+	for _, sub := range []*nats.Subscription{s.sub, s.cancelSub} {
+		if err := sub.Unsubscribe(); err != nil {
+			log.WithError(err).Error("Failed to unsubscribe")
+		}
 	}
 	close(s.subCh)
 
@@ -369,3 +408,433 @@ func (e *HealthCheckStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
 
 	return resp, nil
 }
+
+// ListQueriesStream is a wrapper around the list queries stream.
+type ListQueriesStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_ListQueriesClient
+	reqID    string
+}
+
+// NewListQueriesStream creates a new listQueriesStream.
+func NewListQueriesStream(vzClient vizierpb.VizierServiceClient) *ListQueriesStream {
+	return &ListQueriesStream{vzClient: vzClient}
+}
+
+// StartStream starts the ListQueries stream with the given request.
+func (e *ListQueriesStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetListQueriesReq()
+
+	stream, err := e.vzClient.ListQueries(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *ListQueriesStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_ListQueriesResp{
+			ListQueriesResp: msg,
+		},
+	}
+
+	return resp, nil
+}
+
+// CancelQueryStream is a wrapper around the cancel query stream.
+type CancelQueryStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_CancelQueryClient
+	reqID    string
+}
+
+// NewCancelQueryStream creates a new cancelQueryStream.
+func NewCancelQueryStream(vzClient vizierpb.VizierServiceClient) *CancelQueryStream {
+	return &CancelQueryStream{vzClient: vzClient}
+}
+
+// StartStream starts the CancelQuery stream with the given request.
+func (e *CancelQueryStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetCancelQueryReq()
+
+	stream, err := e.vzClient.CancelQuery(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *CancelQueryStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_CancelQueryResp{
+			CancelQueryResp: msg,
+		},
+	}
+
+	return resp, nil
+}
+
+// GetQueryLogStream is a wrapper around the query log stream.
+type GetQueryLogStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_GetQueryLogClient
+	reqID    string
+}
+
+// NewGetQueryLogStream creates a new getQueryLogStream.
+func NewGetQueryLogStream(vzClient vizierpb.VizierServiceClient) *GetQueryLogStream {
+	return &GetQueryLogStream{vzClient: vzClient}
+}
+
+// StartStream starts the GetQueryLog stream with the given request.
+func (e *GetQueryLogStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetQueryLogReq()
+
+	stream, err := e.vzClient.GetQueryLog(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *GetQueryLogStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_QueryLogResp{
+			QueryLogResp: msg,
+		},
+	}
+
+	return resp, nil
+}
+
+// ListTracepointsStream is a wrapper around the ListTracepoints stream.
+type ListTracepointsStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_ListTracepointsClient
+	reqID    string
+}
+
+// NewListTracepointsStream creates a new listTracepointsStream.
+func NewListTracepointsStream(vzClient vizierpb.VizierServiceClient) *ListTracepointsStream {
+	return &ListTracepointsStream{vzClient: vzClient}
+}
+
+// StartStream starts the ListTracepoints stream with the given request.
+func (e *ListTracepointsStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetListTracepointsReq()
+
+	stream, err := e.vzClient.ListTracepoints(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *ListTracepointsStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_ListTracepointsResp{
+			ListTracepointsResp: msg,
+		},
+	}
+
+	return resp, nil
+}
+
+// DeleteTracepointStream is a wrapper around the DeleteTracepoint stream.
+type DeleteTracepointStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_DeleteTracepointClient
+	reqID    string
+}
+
+// NewDeleteTracepointStream creates a new deleteTracepointStream.
+func NewDeleteTracepointStream(vzClient vizierpb.VizierServiceClient) *DeleteTracepointStream {
+	return &DeleteTracepointStream{vzClient: vzClient}
+}
+
+// StartStream starts the DeleteTracepoint stream with the given request.
+func (e *DeleteTracepointStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetDeleteTracepointReq()
+
+	stream, err := e.vzClient.DeleteTracepoint(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *DeleteTracepointStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_DeleteTracepointResp{
+			DeleteTracepointResp: msg,
+		},
+	}
+
+	return resp, nil
+}
+
+// SetTracepointTTLStream is a wrapper around the SetTracepointTTL stream.
+type SetTracepointTTLStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_SetTracepointTTLClient
+	reqID    string
+}
+
+// NewSetTracepointTTLStream creates a new setTracepointTTLStream.
+func NewSetTracepointTTLStream(vzClient vizierpb.VizierServiceClient) *SetTracepointTTLStream {
+	return &SetTracepointTTLStream{vzClient: vzClient}
+}
+
+// StartStream starts the SetTracepointTTL stream with the given request.
+func (e *SetTracepointTTLStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetSetTracepointTTLReq()
+
+	stream, err := e.vzClient.SetTracepointTTL(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *SetTracepointTTLStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_SetTracepointTTLResp{
+			SetTracepointTTLResp: msg,
+		},
+	}
+
+	return resp, nil
+}
+
+// UpdateAgentsConfigStream is a wrapper around the UpdateAgentsConfig stream.
+type UpdateAgentsConfigStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_UpdateAgentsConfigClient
+	reqID    string
+}
+
+// NewUpdateAgentsConfigStream creates a new updateAgentsConfigStream.
+func NewUpdateAgentsConfigStream(vzClient vizierpb.VizierServiceClient) *UpdateAgentsConfigStream {
+	return &UpdateAgentsConfigStream{vzClient: vzClient}
+}
+
+// StartStream starts the UpdateAgentsConfig stream with the given request.
+func (e *UpdateAgentsConfigStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetUpdateAgentsConfigReq()
+
+	stream, err := e.vzClient.UpdateAgentsConfig(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *UpdateAgentsConfigStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_UpdateAgentsConfigResp{
+			UpdateAgentsConfigResp: msg,
+		},
+	}
+
+	return resp, nil
+}
+
+// GetAgentEventsStream is a wrapper around the GetAgentEvents stream.
+type GetAgentEventsStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_GetAgentEventsClient
+	reqID    string
+}
+
+// NewGetAgentEventsStream creates a new getAgentEventsStream.
+func NewGetAgentEventsStream(vzClient vizierpb.VizierServiceClient) *GetAgentEventsStream {
+	return &GetAgentEventsStream{vzClient: vzClient}
+}
+
+// StartStream starts the GetAgentEvents stream with the given request.
+func (e *GetAgentEventsStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetAgentEventsReq()
+
+	stream, err := e.vzClient.GetAgentEvents(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *GetAgentEventsStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_AgentEventsResp{
+			AgentEventsResp: msg,
+		},
+	}
+
+	return resp, nil
+}
+
+// ListAgentConfigsStream is a wrapper around the ListAgentConfigs stream.
+type ListAgentConfigsStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_ListAgentConfigsClient
+	reqID    string
+}
+
+// NewListAgentConfigsStream creates a new listAgentConfigsStream.
+func NewListAgentConfigsStream(vzClient vizierpb.VizierServiceClient) *ListAgentConfigsStream {
+	return &ListAgentConfigsStream{vzClient: vzClient}
+}
+
+// StartStream starts the ListAgentConfigs stream with the given request.
+func (e *ListAgentConfigsStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetListAgentConfigsReq()
+
+	stream, err := e.vzClient.ListAgentConfigs(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *ListAgentConfigsStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_ListAgentConfigsResp{
+			ListAgentConfigsResp: msg,
+		},
+	}
+
+	return resp, nil
+}
+
+// DeleteAgentConfigStream is a wrapper around the DeleteAgentConfig stream.
+type DeleteAgentConfigStream struct {
+	vzClient vizierpb.VizierServiceClient
+	stream   vizierpb.VizierService_DeleteAgentConfigClient
+	reqID    string
+}
+
+// NewDeleteAgentConfigStream creates a new deleteAgentConfigStream.
+func NewDeleteAgentConfigStream(vzClient vizierpb.VizierServiceClient) *DeleteAgentConfigStream {
+	return &DeleteAgentConfigStream{vzClient: vzClient}
+}
+
+// StartStream starts the DeleteAgentConfig stream with the given request.
+func (e *DeleteAgentConfigStream) StartStream(ctx context.Context, reqID string, req *cvmsgspb.C2VAPIStreamRequest) error {
+	e.reqID = reqID
+	msg := req.GetDeleteAgentConfigReq()
+
+	stream, err := e.vzClient.DeleteAgentConfig(ctx, msg)
+	if err != nil {
+		return err
+	}
+	e.stream = stream
+	return nil
+}
+
+// Recv gets the next message on the stream.
+func (e *DeleteAgentConfigStream) Recv() (*cvmsgspb.V2CAPIStreamResponse, error) {
+	msg, err := e.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap message in V2CAPIStreamResponse.
+	resp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: e.reqID,
+		Msg: &cvmsgspb.V2CAPIStreamResponse_DeleteAgentConfigResp{
+			DeleteAgentConfigResp: msg,
+		},
+	}
+
+	return resp, nil
+}
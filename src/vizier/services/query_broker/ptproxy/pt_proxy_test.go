@@ -90,6 +90,53 @@ func (m *MockVzServer) HealthCheck(req *vizierpb.HealthCheckRequest, srv vizierp
 	return nil
 }
 
+func (m *MockVzServer) ListQueries(req *vizierpb.ListQueriesRequest, srv vizierpb.VizierService_ListQueriesServer) error {
+	return srv.Send(&vizierpb.ListQueriesResponse{
+		Queries: []*vizierpb.RunningQuery{
+			{
+				QueryID: "1",
+				User:    "user@pixielabs.ai",
+			},
+		},
+	})
+}
+
+func (m *MockVzServer) CancelQuery(req *vizierpb.CancelQueryRequest, srv vizierpb.VizierService_CancelQueryServer) error {
+	return nil
+}
+
+func (m *MockVzServer) GetQueryLog(req *vizierpb.GetQueryLogRequest, srv vizierpb.VizierService_GetQueryLogServer) error {
+	return nil
+}
+
+func (m *MockVzServer) ListTracepoints(req *vizierpb.ListTracepointsRequest, srv vizierpb.VizierService_ListTracepointsServer) error {
+	return nil
+}
+
+func (m *MockVzServer) DeleteTracepoint(req *vizierpb.DeleteTracepointRequest, srv vizierpb.VizierService_DeleteTracepointServer) error {
+	return nil
+}
+
+func (m *MockVzServer) SetTracepointTTL(req *vizierpb.SetTracepointTTLRequest, srv vizierpb.VizierService_SetTracepointTTLServer) error {
+	return nil
+}
+
+func (m *MockVzServer) GetAgentEvents(req *vizierpb.GetAgentEventsRequest, srv vizierpb.VizierService_GetAgentEventsServer) error {
+	return nil
+}
+
+func (m *MockVzServer) UpdateAgentsConfig(req *vizierpb.UpdateAgentsConfigRequest, srv vizierpb.VizierService_UpdateAgentsConfigServer) error {
+	return nil
+}
+
+func (m *MockVzServer) ListAgentConfigs(req *vizierpb.ListAgentConfigsRequest, srv vizierpb.VizierService_ListAgentConfigsServer) error {
+	return nil
+}
+
+func (m *MockVzServer) DeleteAgentConfig(req *vizierpb.DeleteAgentConfigRequest, srv vizierpb.VizierService_DeleteAgentConfigServer) error {
+	return nil
+}
+
 type testState struct {
 	t        *testing.T
 	lis      *bufconn.Listener
@@ -327,3 +374,70 @@ func TestPassThroughProxy(t *testing.T) {
 		})
 	}
 }
+
+func TestPassThroughProxy_ListQueries(t *testing.T) {
+	ts, cleanup := createTestState(t)
+	defer cleanup(t)
+
+	client := vizierpb.NewVizierServiceClient(ts.conn)
+
+	s, err := ptproxy.NewPassThroughProxy(ts.nc, client)
+	require.NoError(t, err)
+	go func() {
+		err := s.Run()
+		require.NoError(t, err)
+	}()
+
+	replyCh := make(chan *nats.Msg, 10)
+	replySub, err := ts.nc.ChanSubscribe("v2c.reply-1", replyCh)
+	require.NoError(t, err)
+	defer func() {
+		err := replySub.Unsubscribe()
+		require.NoError(t, err)
+	}()
+
+	sr := &cvmsgspb.C2VAPIStreamRequest{
+		RequestID: "1",
+		Token:     "abcd",
+		Msg: &cvmsgspb.C2VAPIStreamRequest_ListQueriesReq{
+			ListQueriesReq: &vizierpb.ListQueriesRequest{},
+		},
+	}
+	reqAnyMsg, err := types.MarshalAny(sr)
+	require.NoError(t, err)
+	c2vMsg := &cvmsgspb.C2VMessage{
+		Msg: reqAnyMsg,
+	}
+	b, err := c2vMsg.Marshal()
+	require.NoError(t, err)
+
+	err = ts.nc.Publish("c2v.VizierPassthroughRequest", b)
+	require.NoError(t, err)
+
+	expectedResp := &cvmsgspb.V2CAPIStreamResponse{
+		RequestID: "1",
+		Msg: &cvmsgspb.V2CAPIStreamResponse_ListQueriesResp{
+			ListQueriesResp: &vizierpb.ListQueriesResponse{
+				Queries: []*vizierpb.RunningQuery{
+					{
+						QueryID: "1",
+						User:    "user@pixielabs.ai",
+					},
+				},
+			},
+		},
+	}
+
+	select {
+	case msg := <-replyCh:
+		v2cMsg := &cvmsgspb.V2CMessage{}
+		err := proto.Unmarshal(msg.Data, v2cMsg)
+		require.NoError(t, err)
+		resp := &cvmsgspb.V2CAPIStreamResponse{}
+		err = types.UnmarshalAny(v2cMsg.Msg, resp)
+		require.NoError(t, err)
+		assert.Equal(t, expectedResp, resp)
+	case <-time.After(defaultTimeout):
+		t.Fatal("Timed out")
+	}
+}
@@ -23,6 +23,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff/v3"
@@ -31,10 +34,13 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
 	"px.dev/pixie/src/api/proto/vizierpb"
 	"px.dev/pixie/src/carnot/carnotpb"
 	"px.dev/pixie/src/shared/services"
+	"px.dev/pixie/src/shared/services/election"
 	"px.dev/pixie/src/shared/services/healthz"
 	"px.dev/pixie/src/shared/services/httpmiddleware"
 	"px.dev/pixie/src/shared/services/metrics"
@@ -58,6 +64,9 @@ func init() {
 	pflag.String("mds_service", "vizier-metadata-svc", "The metadata service name")
 	pflag.String("mds_port", "50400", "The querybroker service port")
 	pflag.String("pod_namespace", "pl", "The namespace this pod runs in.")
+	pflag.Duration("max_expected_clock_skew", 2000, "Duration in ms of expected maximum clock skew in a cluster")
+	pflag.Duration("renew_period", 5000, "Duration in ms of the time to wait to renew lease")
+	pflag.Duration("drain_timeout", 5*time.Minute, "How long to wait for the running queries to finish when stopping")
 }
 
 // NewVizierServiceClient creates a new vz RPC client stub.
@@ -142,6 +151,7 @@ func main() {
 	mdtpClient := metadatapb.NewMetadataTracepointServiceClient(mdsConn)
 	mdconfClient := metadatapb.NewMetadataConfigServiceClient(mdsConn)
 	csClient := metadatapb.NewCronScriptStoreServiceClient(mdsConn)
+	mdqlClient := metadatapb.NewMetadataQueryLogServiceClient(mdsConn)
 
 	// Connect to NATS.
 	var natsConn *nats.Conn
@@ -175,6 +185,52 @@ func main() {
 	}
 	defer svr.Close()
 
+	queryLogger := controllers.NewQueryLoggerFromFlags(mdqlClient, viper.GetString("jwt_signing_key"))
+	defer queryLogger.Close()
+	svr.SetQueryLogger(queryLogger)
+
+	// Check the health of each agent, for the health check and the operator. The leader runs the checks, and
+	// shares the results with the other replicas.
+	agentHealth := controllers.NewAgentHealthCheckerFromFlags(mdsClient, viper.GetString("jwt_signing_key"), agentTracker, svr)
+	if err := agentHealth.Share(natsConn); err != nil {
+		log.WithError(err).Fatal("Failed to share agent health between replicas.")
+	}
+	defer agentHealth.Stop()
+	svr.SetAgentHealthChecker(agentHealth)
+	// The health of the agents lists the nodes of the cluster, so it isn't served under the unauthenticated statusz path.
+	mux.Handle("/agents/health", agentHealth)
+	svr.SetAgentEventsClient(mdsClient)
+
+	// Targeting queries at a subset of the cluster requires looking up its nodes and pods, which are cached.
+	if kubeConfig, err := rest.InClusterConfig(); err != nil {
+		log.WithError(err).Info("Not running in a K8s cluster, agent targeting is disabled")
+	} else {
+		clientset, err := kubernetes.NewForConfig(kubeConfig)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to create K8s client.")
+		}
+		k8sQuitCh := make(chan struct{})
+		defer close(k8sQuitCh)
+		svr.SetAgentSelector(controllers.NewK8sAgentSelector(clientset, k8sQuitCh))
+	}
+
+	// Route requests for queries running on other replicas of the query broker.
+	routerDialOpts, err := services.GetGRPCClientDialOpts()
+	if err != nil {
+		log.WithError(err).Fatal("Could not get dial opts.")
+	}
+	router, err := controllers.NewQueryRouterFromServer(svr, routerDialOpts)
+	if err != nil {
+		log.WithError(err).Fatal("Failed to start query router.")
+	}
+	defer router.Close()
+	svr.SetQueryRouter(router)
+
+	// The limits on concurrent queries are split between the replicas.
+	replicasQuitCh := make(chan struct{})
+	defer close(replicasQuitCh)
+	go router.WatchReplicas(replicasQuitCh, svr.SetReplicas)
+
 	// For query broker we bump up the max message size since resuls might be larger than 4mb.
 	maxMsgSize := grpc.MaxRecvMsgSize(8 * 1024 * 1024)
 
@@ -204,17 +260,47 @@ func main() {
 	}()
 	defer ptProxy.Close()
 
-	// Start cron script runner.
-	sr, err := scriptrunner.New(natsConn, csClient, vzServiceClient, viper.GetString("jwt_signing_key"))
+	// Only one replica of the query broker runs the cron scripts and checks the health of the agents.
+	leaderMgr, err := election.NewK8sLeaderElectionMgr(
+		viper.GetString("pod_namespace"),
+		viper.GetDuration("max_expected_clock_skew"),
+		viper.GetDuration("renew_period"),
+		"query-broker-election",
+	)
 	if err != nil {
-		log.WithError(err).Fatal("Failed to start script runner")
+		log.WithError(err).Fatal("Failed to connect to leader election manager.")
 	}
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		err := leaderMgr.Campaign(leaderCtx)
+		if err != nil {
+			log.WithError(err).Fatal("Failed to become leader")
+		}
+		log.Info("Gained leadership, starting cron script runner and agent health checks")
+		agentHealth.Start()
 
-	err = sr.SyncScripts()
-	if err != nil {
-		log.WithError(err).Error("Failed to sync cron scripts")
-	}
+		// Start cron script runner.
+		sr, err := scriptrunner.New(natsConn, csClient, vzServiceClient, viper.GetString("jwt_signing_key"))
+		if err != nil {
+			log.WithError(err).Fatal("Failed to start script runner")
+		}
+
+		err = sr.SyncScripts()
+		if err != nil {
+			log.WithError(err).Error("Failed to sync cron scripts")
+		}
+	}()
 
 	s.Start()
-	s.StopOnInterrupt()
+
+	// Queries aren't handed off to other replicas, so the running queries are given time to finish before
+	// stopping. New queries are rejected meanwhile, and retried by clients on another replica.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), viper.GetDuration("drain_timeout"))
+	svr.Drain(drainCtx)
+	drainCancel()
+	s.Stop()
 }
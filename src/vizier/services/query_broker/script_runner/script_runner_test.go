@@ -799,6 +799,36 @@ func (vs *fakeVizierServiceClient) ExecuteScript(ctx context.Context, in *vizier
 func (vs *fakeVizierServiceClient) HealthCheck(ctx context.Context, in *vizierpb.HealthCheckRequest, opts ...grpc.CallOption) (vizierpb.VizierService_HealthCheckClient, error) {
 	return nil, errors.New("Not implemented")
 }
+func (vs *fakeVizierServiceClient) ListQueries(ctx context.Context, in *vizierpb.ListQueriesRequest, opts ...grpc.CallOption) (vizierpb.VizierService_ListQueriesClient, error) {
+	return nil, errors.New("Not implemented")
+}
+func (vs *fakeVizierServiceClient) CancelQuery(ctx context.Context, in *vizierpb.CancelQueryRequest, opts ...grpc.CallOption) (vizierpb.VizierService_CancelQueryClient, error) {
+	return nil, errors.New("Not implemented")
+}
+func (vs *fakeVizierServiceClient) GetQueryLog(ctx context.Context, in *vizierpb.GetQueryLogRequest, opts ...grpc.CallOption) (vizierpb.VizierService_GetQueryLogClient, error) {
+	return nil, errors.New("Not implemented")
+}
+func (vs *fakeVizierServiceClient) ListTracepoints(ctx context.Context, in *vizierpb.ListTracepointsRequest, opts ...grpc.CallOption) (vizierpb.VizierService_ListTracepointsClient, error) {
+	return nil, errors.New("Not implemented")
+}
+func (vs *fakeVizierServiceClient) DeleteTracepoint(ctx context.Context, in *vizierpb.DeleteTracepointRequest, opts ...grpc.CallOption) (vizierpb.VizierService_DeleteTracepointClient, error) {
+	return nil, errors.New("Not implemented")
+}
+func (vs *fakeVizierServiceClient) SetTracepointTTL(ctx context.Context, in *vizierpb.SetTracepointTTLRequest, opts ...grpc.CallOption) (vizierpb.VizierService_SetTracepointTTLClient, error) {
+	return nil, errors.New("Not implemented")
+}
+func (vs *fakeVizierServiceClient) GetAgentEvents(ctx context.Context, in *vizierpb.GetAgentEventsRequest, opts ...grpc.CallOption) (vizierpb.VizierService_GetAgentEventsClient, error) {
+	return nil, errors.New("Not implemented")
+}
+func (vs *fakeVizierServiceClient) UpdateAgentsConfig(ctx context.Context, in *vizierpb.UpdateAgentsConfigRequest, opts ...grpc.CallOption) (vizierpb.VizierService_UpdateAgentsConfigClient, error) {
+	return nil, errors.New("Not implemented")
+}
+func (vs *fakeVizierServiceClient) ListAgentConfigs(ctx context.Context, in *vizierpb.ListAgentConfigsRequest, opts ...grpc.CallOption) (vizierpb.VizierService_ListAgentConfigsClient, error) {
+	return nil, errors.New("Not implemented")
+}
+func (vs *fakeVizierServiceClient) DeleteAgentConfig(ctx context.Context, in *vizierpb.DeleteAgentConfigRequest, opts ...grpc.CallOption) (vizierpb.VizierService_DeleteAgentConfigClient, error) {
+	return nil, errors.New("Not implemented")
+}
 
 func TestScriptRunner_StoreResults(t *testing.T) {
 	marshalMust := func(a *types.Any, _ error) *types.Any {
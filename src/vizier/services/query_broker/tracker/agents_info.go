@@ -29,6 +29,7 @@ import (
 	"px.dev/pixie/src/carnot/planner/distributedpb"
 	"px.dev/pixie/src/utils"
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
 )
 
 // KelvinSSLTargetOverride the hostname used for SSL target override when sending data to Kelvin.
@@ -41,15 +42,19 @@ type AgentsInfo interface {
 	ClearPendingState()
 	UpdateAgentsInfo(update *metadatapb.AgentUpdatesResponse) error
 	DistributedState() distributedpb.DistributedState
+	// HostInfo returns the host of each agent in the current distributed state.
+	HostInfo() map[uuid.UUID]*agentpb.HostInfo
 }
 
 // AgentsInfoImpl implements AgentsInfo to track information about the distributed state of the system.
 type AgentsInfoImpl struct {
-	ds distributedpb.DistributedState
-	// Controls access to ds.
+	ds    distributedpb.DistributedState
+	hosts map[uuid.UUID]*agentpb.HostInfo
+	// Controls access to ds and hosts.
 	dsMutex sync.Mutex
 
-	pendingDs *distributedpb.DistributedState
+	pendingDs    *distributedpb.DistributedState
+	pendingHosts map[uuid.UUID]*agentpb.HostInfo
 }
 
 // NewAgentsInfo creates an empty agents info.
@@ -60,6 +65,7 @@ func NewAgentsInfo() AgentsInfo {
 			SchemaInfo: []*distributedpb.SchemaInfo{},
 			CarnotInfo: []*distributedpb.CarnotInfo{},
 		},
+		pendingHosts: make(map[uuid.UUID]*agentpb.HostInfo),
 	}
 }
 
@@ -78,6 +84,7 @@ func (a *AgentsInfoImpl) ClearPendingState() {
 		SchemaInfo: []*distributedpb.SchemaInfo{},
 		CarnotInfo: []*distributedpb.CarnotInfo{},
 	}
+	a.pendingHosts = make(map[uuid.UUID]*agentpb.HostInfo)
 }
 
 // UpdateAgentsInfo creates a new agent info.
@@ -117,6 +124,9 @@ func (a *AgentsInfoImpl) UpdateAgentsInfo(update *metadatapb.AgentUpdatesRespons
 			} else {
 				createdAgents++
 			}
+			if agent.Info != nil && agent.Info.HostInfo != nil {
+				a.pendingHosts[agentUUID] = agent.Info.HostInfo
+			}
 
 			if agent.Info.Capabilities == nil || agent.Info.Capabilities.CollectsData {
 				var metadataInfo *distributedpb.MetadataInfo
@@ -151,6 +161,7 @@ func (a *AgentsInfoImpl) UpdateAgentsInfo(update *metadatapb.AgentUpdatesRespons
 		if agentUpdate.GetDeleted() {
 			deletedAgents++
 			delete(carnotInfoMap, agentUUID)
+			delete(a.pendingHosts, agentUUID)
 		}
 	}
 
@@ -167,8 +178,13 @@ func (a *AgentsInfoImpl) UpdateAgentsInfo(update *metadatapb.AgentUpdatesRespons
 	// If we have reached the end of version, promote the pending DistributedState to the current external-facing
 	// distributed state accessible by clients of `Agents`.
 	if update.EndOfVersion {
+		hosts := make(map[uuid.UUID]*agentpb.HostInfo, len(a.pendingHosts))
+		for agentID, host := range a.pendingHosts {
+			hosts[agentID] = host
+		}
 		a.dsMutex.Lock()
 		a.ds = *(a.pendingDs)
+		a.hosts = hosts
 		a.dsMutex.Unlock()
 	}
 
@@ -184,6 +200,14 @@ func (a *AgentsInfoImpl) DistributedState() distributedpb.DistributedState {
 	return a.ds
 }
 
+// HostInfo returns the host of each agent in the current distributed state.
+// The returned map must not be modified, since it is shared by all callers.
+func (a *AgentsInfoImpl) HostInfo() map[uuid.UUID]*agentpb.HostInfo {
+	a.dsMutex.Lock()
+	defer a.dsMutex.Unlock()
+	return a.hosts
+}
+
 func makeAgentCarnotInfo(agentID uuid.UUID, asid uint32, agentMetadata *distributedpb.MetadataInfo) *distributedpb.CarnotInfo {
 	return &distributedpb.CarnotInfo{
 		QueryBrokerAddress:   agentID.String(),
@@ -269,6 +269,10 @@ func TestAgentsInfo_UpdateAgentsInfo(t *testing.T) {
 	assert.Equal(t, 2, len(agentsMap))
 	assert.Equal(t, expectedPEM1Info, agentsMap[uuids[0]])
 	assert.Equal(t, expectedKelvinInfo, agentsMap[uuids[1]])
+	assert.Equal(t, map[uuid.UUID]*agentpb.HostInfo{
+		uuids[0]: agents[0].Info.HostInfo,
+		uuids[1]: agents[1].Info.HostInfo,
+	}, agentsInfo.HostInfo())
 
 	// Update agent 1, and add table metadata for another agent,
 	// create an agent, and delete an agent.
@@ -339,6 +343,11 @@ func TestAgentsInfo_UpdateAgentsInfo(t *testing.T) {
 	assert.Equal(t, expectedPEM1Info, agentsMap[uuids[0]])
 	// Agent 3 should be created.
 	assert.Equal(t, expectedPEM2Info, agentsMap[uuids[2]])
+	// The host of the deleted agent should be removed.
+	assert.Equal(t, map[uuid.UUID]*agentpb.HostInfo{
+		uuids[0]: agents[0].Info.HostInfo,
+		uuids[2]: agents[2].Info.HostInfo,
+	}, agentsInfo.HostInfo())
 
 	// Test the case where the schema is updated to be fully empty.
 	err = agentsInfo.UpdateAgentsInfo(&metadatapb.AgentUpdatesResponse{
@@ -22,6 +22,7 @@ import (
 	"sync"
 	"testing"
 
+	"github.com/gofrs/uuid"
 	"github.com/golang/mock/gomock"
 
 	"px.dev/pixie/src/carnot/planner/distributedpb"
@@ -29,6 +30,7 @@ import (
 	"px.dev/pixie/src/vizier/services/metadata/metadatapb"
 	mock_metadatapb "px.dev/pixie/src/vizier/services/metadata/metadatapb/mock"
 	"px.dev/pixie/src/vizier/services/query_broker/tracker"
+	"px.dev/pixie/src/vizier/services/shared/agentpb"
 )
 
 type fakeAgentsInfo struct {
@@ -45,6 +47,11 @@ func (a *fakeAgentsInfo) DistributedState() distributedpb.DistributedState {
 	return distributedpb.DistributedState{}
 }
 
+// HostInfo implementation for fake agents info.
+func (a *fakeAgentsInfo) HostInfo() map[uuid.UUID]*agentpb.HostInfo {
+	return nil
+}
+
 func (a *fakeAgentsInfo) UpdateAgentsInfo(update *metadatapb.AgentUpdatesResponse) error {
 	if len(update.AgentUpdates) > 0 || len(update.AgentSchemas) > 0 {
 		a.wg.Done()
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package backup exports the contents of a datastore to a portable file, and restores them into any datastore.
+//
+// A backup is a stream of newline-delimited JSON objects. The first object is a header which identifies
+// the format version, and each of the following objects is a key in the datastore. Expiries are stored
+// as absolute times so that keys which were set with a TTL expire at the same time once restored.
+package backup
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"px.dev/pixie/src/vizier/utils/datastore"
+)
+
+// FormatVersion is the version of the backup format written by Export.
+const FormatVersion = 1
+
+// maxEntrySize is the largest entry that can be read from a backup.
+const maxEntrySize = 64 * 1024 * 1024
+
+type header struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type entry struct {
+	Key       string     `json:"key"`
+	Value     []byte     `json:"value"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Export writes all of the keys in the datastore to w as they are read, and returns the number of keys written.
+func Export(ds datastore.Snapshotter, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := enc.Encode(&header{Version: FormatVersion, CreatedAt: time.Now()})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err = ds.Snapshot(func(kv datastore.KeyValue) error {
+		e := &entry{Key: kv.Key, Value: kv.Value}
+		if !kv.ExpiresAt.IsZero() {
+			expiresAt := kv.ExpiresAt
+			e.ExpiresAt = &expiresAt
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// Import writes the keys of the backup read from r into the datastore, and returns the number of keys
+// written. Keys which expired since the backup was taken are skipped. Existing keys that aren't
+// part of the backup are left untouched.
+func Import(ds datastore.TTLSetter, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("backup is empty")
+	}
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		return 0, fmt.Errorf("failed to read backup header: %w", err)
+	}
+	if h.Version != FormatVersion {
+		return 0, fmt.Errorf("unsupported backup version %d", h.Version)
+	}
+
+	n := 0
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return n, fmt.Errorf("failed to read backup entry %d: %w", n+1, err)
+		}
+		kv := datastore.KeyValue{Key: e.Key, Value: e.Value}
+		if e.ExpiresAt != nil {
+			kv.ExpiresAt = *e.ExpiresAt
+		}
+		written, err := set(ds, kv)
+		if err != nil {
+			return n, err
+		}
+		if written {
+			n++
+		}
+	}
+	return n, scanner.Err()
+}
+
+// Migrate copies all of the keys in the datastore from into the datastore to, and returns the number of
+// keys copied.
+func Migrate(from datastore.Snapshotter, to datastore.TTLSetter) (int, error) {
+	n := 0
+	err := from.Snapshot(func(kv datastore.KeyValue) error {
+		written, err := set(to, kv)
+		if err != nil {
+			return err
+		}
+		if written {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// set writes the given key into the datastore, with the TTL remaining until it expires. It returns false
+// if the key has already expired.
+func set(ds datastore.TTLSetter, kv datastore.KeyValue) (bool, error) {
+	if kv.ExpiresAt.IsZero() {
+		return true, ds.Set(kv.Key, string(kv.Value))
+	}
+	ttl := time.Until(kv.ExpiresAt)
+	if ttl <= 0 {
+		return false, nil
+	}
+	return true, ds.SetWithTTL(kv.Key, string(kv.Value), ttl)
+}
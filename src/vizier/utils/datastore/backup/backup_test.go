@@ -0,0 +1,149 @@
+/*
+ * Copyright 2018- The Pixie Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package backup_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bunt "github.com/tidwall/buntdb"
+
+	"px.dev/pixie/src/vizier/utils/datastore"
+	"px.dev/pixie/src/vizier/utils/datastore/backup"
+	"px.dev/pixie/src/vizier/utils/datastore/buntdb"
+	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
+)
+
+func setupPebble(t *testing.T) *pebbledb.DataStore {
+	db, err := pebble.Open("test", &pebble.Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	ds := pebbledb.New(db, 3*time.Second)
+	t.Cleanup(func() { ds.Close() })
+	return ds
+}
+
+func setupBunt(t *testing.T) *buntdb.DataStore {
+	db, err := bunt.Open(":memory:")
+	require.NoError(t, err)
+	ds := buntdb.New(db)
+	t.Cleanup(func() { ds.Close() })
+	return ds
+}
+
+func populate(t *testing.T, ds datastore.TTLSetter) {
+	require.NoError(t, ds.Set("/agent/1", "agent1"))
+	require.NoError(t, ds.Set("/agent/2", "\x00\x01binary"))
+	require.NoError(t, ds.SetWithTTL("/tracepoint/1", "tp1", 1*time.Hour))
+}
+
+func snapshot(t *testing.T, ds datastore.Snapshotter) []datastore.KeyValue {
+	var kvs []datastore.KeyValue
+	require.NoError(t, ds.Snapshot(func(kv datastore.KeyValue) error {
+		kvs = append(kvs, kv)
+		return nil
+	}))
+	return kvs
+}
+
+func assertPopulated(t *testing.T, ds datastore.Snapshotter) {
+	kvs := snapshot(t, ds)
+	require.Len(t, kvs, 3)
+
+	assert.Equal(t, "/agent/1", kvs[0].Key)
+	assert.Equal(t, "agent1", string(kvs[0].Value))
+	assert.True(t, kvs[0].ExpiresAt.IsZero())
+
+	assert.Equal(t, "/agent/2", kvs[1].Key)
+	assert.Equal(t, "\x00\x01binary", string(kvs[1].Value))
+	assert.True(t, kvs[1].ExpiresAt.IsZero())
+
+	assert.Equal(t, "/tracepoint/1", kvs[2].Key)
+	assert.Equal(t, "tp1", string(kvs[2].Value))
+	assert.WithinDuration(t, time.Now().Add(1*time.Hour), kvs[2].ExpiresAt, 5*time.Second)
+}
+
+func TestExportImport(t *testing.T) {
+	src := setupPebble(t)
+	populate(t, src)
+
+	var buf bytes.Buffer
+	n, err := backup.Export(src, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	dst := setupBunt(t)
+	n, err = backup.Import(dst, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assertPopulated(t, dst)
+}
+
+func TestImport_SkipsExpiredKeys(t *testing.T) {
+	b := strings.Join([]string{
+		`{"version":1,"createdAt":"2022-01-01T00:00:00Z"}`,
+		`{"key":"/a","value":"YQ=="}`,
+		`{"key":"/b","value":"Yg==","expiresAt":"2022-01-01T01:00:00Z"}`,
+		``,
+	}, "\n")
+
+	dst := setupPebble(t)
+	n, err := backup.Import(dst, strings.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.Equal(t, []datastore.KeyValue{{Key: "/a", Value: []byte("a")}}, snapshot(t, dst))
+}
+
+func TestImport_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		backup string
+	}{
+		{"empty", ""},
+		{"bad header", "not json\n"},
+		{"unsupported version", `{"version":2}` + "\n"},
+		{"bad entry", `{"version":1}` + "\n" + `{"key":` + "\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := backup.Import(setupBunt(t), strings.NewReader(tc.backup))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	src := setupBunt(t)
+	populate(t, src)
+
+	dst := setupPebble(t)
+	n, err := backup.Migrate(src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assertPopulated(t, dst)
+}
@@ -20,9 +20,12 @@ package badgerdb
 
 import (
 	"bytes"
+	"fmt"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
+
+	"px.dev/pixie/src/vizier/utils/datastore"
 )
 
 // DataStore wraps a badgerdb datastore.
@@ -52,7 +55,8 @@ func (w *DataStore) Get(key string) ([]byte, error) {
 		return nil, err
 	}
 
-	return item.ValueCopy(nil)
+	// Copy into a non-nil slice, so that an empty value isn't mistaken for a missing key.
+	return item.ValueCopy([]byte{})
 }
 
 // GetWithRange gets all keys and values within the given range.
@@ -113,6 +117,72 @@ func (w *DataStore) GetWithPrefix(prefix string) ([]string, [][]byte, error) {
 	return keys, values, nil
 }
 
+// ScanRange calls fn with each key in [from, to) and its value, in order, until fn returns false.
+func (w *DataStore) ScanRange(from string, to string, reverse bool, fn func(key string, value []byte) bool) error {
+	txn := w.db.NewTransaction(false)
+	defer txn.Discard()
+
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = reverse
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	f := []byte(from)
+	t := []byte(to)
+
+	start := f
+	if reverse {
+		// In reverse, Seek finds the last key at or before the given key.
+		start = t
+	}
+	for it.Seek(start); it.Valid(); it.Next() {
+		item := it.Item()
+		if reverse {
+			if bytes.Equal(item.Key(), t) {
+				continue
+			}
+			if bytes.Compare(item.Key(), f) < 0 {
+				break
+			}
+		} else if bytes.Compare(item.Key(), t) >= 0 {
+			break
+		}
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if !fn(string(item.Key()), v) {
+			break
+		}
+	}
+	return nil
+}
+
+// Snapshot calls fn with each of the keys in the datastore, along with the time at which it expires.
+func (w *DataStore) Snapshot(fn func(kv datastore.KeyValue) error) error {
+	txn := w.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		kv := datastore.KeyValue{Key: string(item.Key()), Value: v}
+		if expiresAt := item.ExpiresAt(); expiresAt != 0 {
+			kv.ExpiresAt = time.Unix(int64(expiresAt), 0)
+		}
+		if err := fn(kv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Set puts the given key and value in the datastore.
 func (w *DataStore) Set(key string, value string) error {
 	txn := w.db.NewTransaction(true)
@@ -193,6 +263,104 @@ func (w *DataStore) DeleteWithPrefix(prefix string) error {
 	return wb.Flush()
 }
 
+// DeleteWithRange deletes all keys and values in [from, to).
+func (w *DataStore) DeleteWithRange(from string, to string) error {
+	txn := w.db.NewTransaction(false)
+	defer txn.Discard()
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	wb := w.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	t := []byte(to)
+	for it.Seek([]byte(from)); it.Valid() && bytes.Compare(it.Item().Key(), t) < 0; it.Next() {
+		err := wb.Delete(it.Item().KeyCopy(nil))
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// Txn applies all of the ops in a single badger transaction if all of the cmps hold. The transaction
+// is retried if it conflicts with a concurrent one.
+func (w *DataStore) Txn(cmps []datastore.Cmp, ops []datastore.Op) (bool, error) {
+	for {
+		applied, err := w.txn(cmps, ops)
+		if err == badger.ErrConflict {
+			continue
+		}
+		return applied, err
+	}
+}
+
+func (w *DataStore) txn(cmps []datastore.Cmp, ops []datastore.Op) (bool, error) {
+	txn := w.db.NewTransaction(true)
+	defer txn.Discard()
+
+	for _, cmp := range cmps {
+		var v []byte
+		item, err := txn.Get([]byte(cmp.Key))
+		if err != nil && err != badger.ErrKeyNotFound {
+			return false, err
+		}
+		if err == nil {
+			v, err = item.ValueCopy(nil)
+			if err != nil {
+				return false, err
+			}
+		}
+		if (cmp.Value == nil) != (item == nil) || !bytes.Equal(cmp.Value, v) {
+			return false, nil
+		}
+	}
+
+	for _, op := range ops {
+		var err error
+		switch op.Type {
+		case datastore.OpTypeSet:
+			err = txn.Set([]byte(op.Key), []byte(op.Value))
+		case datastore.OpTypeSetWithTTL:
+			err = txn.SetEntry(badger.NewEntry([]byte(op.Key), []byte(op.Value)).WithTTL(op.TTL))
+		case datastore.OpTypeDelete:
+			err = txn.Delete([]byte(op.Key))
+		case datastore.OpTypeDeleteWithPrefix:
+			err = deleteWithPrefix(txn, []byte(op.Key))
+		default:
+			err = fmt.Errorf("unknown op type %d", op.Type)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, txn.Commit()
+}
+
+func deleteWithPrefix(txn *badger.Txn, prefix []byte) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	var keys [][]byte
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+	it.Close()
+
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Close stops the TTL watcher, and closes the underlying datastore.
 // All other operations will fail after calling Close.
 func (w *DataStore) Close() error {
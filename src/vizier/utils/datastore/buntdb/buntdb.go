@@ -19,9 +19,12 @@
 package buntdb
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/tidwall/buntdb"
+
+	"px.dev/pixie/src/vizier/utils/datastore"
 )
 
 // DataStore wraps a buntdb datastore.
@@ -94,6 +97,54 @@ func (w *DataStore) GetWithPrefix(prefix string) ([]string, [][]byte, error) {
 	return keys, vals, nil
 }
 
+// ScanRange calls fn with each key in [from, to) and its value, in order, until fn returns false.
+func (w *DataStore) ScanRange(from string, to string, reverse bool, fn func(key string, value []byte) bool) error {
+	return w.db.View(func(tx *buntdb.Tx) error {
+		if !reverse {
+			return tx.AscendRange("", from, to, func(k, v string) bool {
+				return fn(k, []byte(v))
+			})
+		}
+		return tx.DescendLessOrEqual("", to, func(k, v string) bool {
+			if k == to {
+				return true
+			}
+			if k < from {
+				return false
+			}
+			return fn(k, []byte(v))
+		})
+	})
+}
+
+// Snapshot calls fn with each of the keys in the datastore, along with the time at which it expires.
+func (w *DataStore) Snapshot(fn func(kv datastore.KeyValue) error) error {
+	return w.db.View(func(tx *buntdb.Tx) error {
+		var fnErr error
+		err := tx.Ascend("", func(k, v string) bool {
+			kv := datastore.KeyValue{Key: k, Value: []byte(v)}
+			ttl, err := tx.TTL(k)
+			if err == buntdb.ErrNotFound {
+				// The key expired while iterating.
+				return true
+			}
+			if err != nil {
+				fnErr = err
+				return false
+			}
+			if ttl >= 0 {
+				kv.ExpiresAt = time.Now().Add(ttl)
+			}
+			fnErr = fn(kv)
+			return fnErr == nil
+		})
+		if err != nil {
+			return err
+		}
+		return fnErr
+	})
+}
+
 // Set puts the given key and value in the datastore.
 func (w *DataStore) Set(key string, value string) error {
 	return w.db.Update(func(tx *buntdb.Tx) error {
@@ -162,6 +213,82 @@ func (w *DataStore) DeleteWithPrefix(prefix string) error {
 	})
 }
 
+// DeleteWithRange deletes all keys and values in [from, to).
+func (w *DataStore) DeleteWithRange(from string, to string) error {
+	return w.db.Update(func(tx *buntdb.Tx) error {
+		var keys []string
+		err := tx.AscendRange("", from, to, func(k, _ string) bool {
+			keys = append(keys, k)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(keys); i++ {
+			_, err := tx.Delete(keys[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Txn applies all of the ops in a single buntdb transaction if all of the cmps hold.
+func (w *DataStore) Txn(cmps []datastore.Cmp, ops []datastore.Op) (bool, error) {
+	applied := false
+	err := w.db.Update(func(tx *buntdb.Tx) error {
+		for _, cmp := range cmps {
+			v, err := tx.Get(cmp.Key)
+			if err != nil && err != buntdb.ErrNotFound {
+				return err
+			}
+			if (cmp.Value == nil) != (err == buntdb.ErrNotFound) || v != string(cmp.Value) {
+				return nil
+			}
+		}
+
+		for _, op := range ops {
+			var err error
+			switch op.Type {
+			case datastore.OpTypeSet:
+				_, _, err = tx.Set(op.Key, op.Value, nil)
+			case datastore.OpTypeSetWithTTL:
+				_, _, err = tx.Set(op.Key, op.Value, &buntdb.SetOptions{
+					Expires: true,
+					TTL:     op.TTL,
+				})
+			case datastore.OpTypeDelete:
+				_, err = tx.Delete(op.Key)
+				if err == buntdb.ErrNotFound {
+					err = nil
+				}
+			case datastore.OpTypeDeleteWithPrefix:
+				var keys []string
+				err = tx.AscendKeys(op.Key+"*", func(k, _ string) bool {
+					keys = append(keys, k)
+					return true
+				})
+				for i := 0; err == nil && i < len(keys); i++ {
+					_, err = tx.Delete(keys[i])
+				}
+			default:
+				err = fmt.Errorf("unknown op type %d", op.Type)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		applied = true
+		return nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+	return applied, nil
+}
+
 // Close stops the TTL watcher, and closes the underlying datastore.
 // All other operations will fail after calling Close.
 func (w *DataStore) Close() error {
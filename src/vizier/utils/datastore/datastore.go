@@ -30,6 +30,9 @@ type MultiGetter interface {
 	Getter
 	GetWithRange(from string, to string) ([]string, [][]byte, error)
 	GetWithPrefix(prefix string) ([]string, [][]byte, error)
+	// ScanRange calls fn with each key in [from, to) and its value, in ascending order of the keys or in
+	// descending order if reverse is set, until fn returns false. The whole range is never held in memory.
+	ScanRange(from string, to string, reverse bool, fn func(key string, value []byte) bool) error
 }
 
 // Setter is a datastore that implements a simple way to set values.
@@ -54,6 +57,8 @@ type MultiDeleter interface {
 	Deleter
 	DeleteAll(keys []string) error
 	DeleteWithPrefix(prefix string) error
+	// DeleteWithRange deletes all keys in [from, to).
+	DeleteWithRange(from string, to string) error
 }
 
 // Closer is a datastore that can be closed commit changes and cleanup any pending resources.
@@ -61,10 +66,83 @@ type Closer interface {
 	Close() error
 }
 
-// MultiGetterSetterDeleterCloser combines MultiGetter, TTLSetter, MultiDeleter, and Closer.
+// OpType is the type of a write in a transaction.
+type OpType int
+
+const (
+	// OpTypeSet sets the value of a key.
+	OpTypeSet OpType = iota
+	// OpTypeSetWithTTL sets the value of a key with a TTL.
+	OpTypeSetWithTTL
+	// OpTypeDelete deletes a key.
+	OpTypeDelete
+	// OpTypeDeleteWithPrefix deletes all keys with the given prefix.
+	OpTypeDeleteWithPrefix
+)
+
+// Op is a write in a transaction.
+type Op struct {
+	Type  OpType
+	Key   string
+	Value string
+	TTL   time.Duration
+}
+
+// OpSet returns an Op that sets the given key to the given value.
+func OpSet(key string, value string) Op {
+	return Op{Type: OpTypeSet, Key: key, Value: value}
+}
+
+// OpSetWithTTL returns an Op that sets the given key to the given value with a TTL.
+func OpSetWithTTL(key string, value string, ttl time.Duration) Op {
+	return Op{Type: OpTypeSetWithTTL, Key: key, Value: value, TTL: ttl}
+}
+
+// OpDelete returns an Op that deletes the given key.
+func OpDelete(key string) Op {
+	return Op{Type: OpTypeDelete, Key: key}
+}
+
+// OpDeleteWithPrefix returns an Op that deletes all keys with the given prefix.
+func OpDeleteWithPrefix(prefix string) Op {
+	return Op{Type: OpTypeDeleteWithPrefix, Key: prefix}
+}
+
+// Cmp is a condition on the value of a key, which must hold for a transaction to be applied.
+type Cmp struct {
+	Key string
+	// Value is the expected value of the key. A nil value expects the key not to exist.
+	Value []byte
+}
+
+// Transactor is a datastore that can apply several writes atomically.
+type Transactor interface {
+	// Txn applies all of the ops if all of the cmps hold, and none of them otherwise.
+	// It returns whether the ops were applied.
+	Txn(cmps []Cmp, ops []Op) (bool, error)
+}
+
+// MultiGetterSetterDeleterCloser combines MultiGetter, TTLSetter, MultiDeleter, Transactor, and Closer.
 type MultiGetterSetterDeleterCloser interface {
 	MultiGetter
 	TTLSetter
 	MultiDeleter
+	Transactor
 	Closer
 }
+
+// KeyValue is a key and value stored in a datastore.
+type KeyValue struct {
+	Key   string
+	Value []byte
+	// ExpiresAt is the time at which the key expires, or the zero time if it was set without a TTL.
+	ExpiresAt time.Time
+}
+
+// Snapshotter is a datastore that can list its full key space, including the expiry of each key.
+type Snapshotter interface {
+	// Snapshot calls fn with each of the keys in the datastore, in order, until fn returns an error, which
+	// is then returned. Keys that the datastore uses internally, such as to track TTLs, are not included.
+	// The keys are read as they are visited, so the datastore is never held in memory all at once.
+	Snapshot(fn func(kv KeyValue) error) error
+}
@@ -16,9 +16,12 @@
  * SPDX-License-Identifier: Apache-2.0
  */
 
-package datastore
+package datastore_test
 
 import (
+	"errors"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -30,13 +33,14 @@ import (
 	bunt "github.com/tidwall/buntdb"
 
 	"px.dev/pixie/src/utils/testingutils"
+	"px.dev/pixie/src/vizier/utils/datastore"
 	"px.dev/pixie/src/vizier/utils/datastore/badgerdb"
 	"px.dev/pixie/src/vizier/utils/datastore/buntdb"
 	"px.dev/pixie/src/vizier/utils/datastore/etcd"
 	"px.dev/pixie/src/vizier/utils/datastore/pebbledb"
 )
 
-func setupDatastore(t *testing.T, db Setter) {
+func setupDatastore(t *testing.T, db datastore.Setter) {
 	err := db.Set("jam1", "neg")
 	require.NoError(t, err)
 	err = db.Set("key1", "val1")
@@ -74,7 +78,7 @@ func TestDatastore(t *testing.T) {
 	defer cleanup()
 
 	tests := []struct {
-		db          MultiGetterSetterDeleterCloser
+		db          datastore.MultiGetterSetterDeleterCloser
 		name        string
 		runTTLTests bool
 	}{
@@ -144,6 +148,25 @@ func TestDatastore(t *testing.T) {
 					assert.Nil(t, keys)
 					assert.Nil(t, vals)
 				})
+
+				t.Run("Scan", func(t *testing.T) {
+					scan := func(from string, to string, reverse bool, limit int) []string {
+						var keys []string
+						err := db.ScanRange(from, to, reverse, func(key string, value []byte) bool {
+							assert.Equal(t, "val"+strings.TrimPrefix(key, "key"), string(value))
+							keys = append(keys, key)
+							return len(keys) < limit
+						})
+						require.NoError(t, err)
+						return keys
+					}
+
+					assert.Equal(t, []string{"key1", "key2", "key3"}, scan("key1", "key9", false, 10))
+					assert.Equal(t, []string{"key3", "key2", "key1"}, scan("key1", "key9", true, 10))
+					assert.Equal(t, []string{"key1", "key2"}, scan("key1", "key9", false, 2))
+					assert.Equal(t, []string{"key9", "key3"}, scan("key1", "key9.1", true, 2))
+					assert.Nil(t, scan("nonexistent", "nonexistent2", true, 10))
+				})
 			})
 
 			t.Run("Delete", func(t *testing.T) {
@@ -198,6 +221,16 @@ func TestDatastore(t *testing.T) {
 				require.NoError(t, err)
 			})
 
+			t.Run("DeleteRange", func(t *testing.T) {
+				setupDatastore(t, db)
+				err := db.DeleteWithRange("key2", "key9")
+				require.NoError(t, err)
+
+				keys, _, err := db.GetWithPrefix("key")
+				require.NoError(t, err)
+				assert.Equal(t, []string{"key1", "key9"}, keys)
+			})
+
 			if tc.runTTLTests {
 				t.Run("SetWithTTL", func(t *testing.T) {
 					now := time.Now()
@@ -252,6 +285,114 @@ func TestDatastore(t *testing.T) {
 				})
 			}
 
+			t.Run("Txn", func(t *testing.T) {
+				setupDatastore(t, db)
+				applied, err := db.Txn([]datastore.Cmp{
+					{Key: "key1", Value: []byte("val1")},
+					{Key: "key4", Value: nil},
+				}, []datastore.Op{
+					datastore.OpSet("key1", "val1.2"),
+					datastore.OpDelete("key2"),
+					datastore.OpSetWithTTL("key4", "val4", 1*time.Hour),
+					datastore.OpDeleteWithPrefix("lim"),
+				})
+				require.NoError(t, err)
+				assert.True(t, applied)
+
+				v, err := db.Get("key1")
+				require.NoError(t, err)
+				assert.Equal(t, "val1.2", string(v))
+				v, err = db.Get("key2")
+				require.NoError(t, err)
+				assert.Nil(t, v)
+				v, err = db.Get("key4")
+				require.NoError(t, err)
+				assert.Equal(t, "val4", string(v))
+				v, err = db.Get("lim1")
+				require.NoError(t, err)
+				assert.Nil(t, v)
+
+				// The ops aren't applied if the value of a key changed, or if a key that should be missing exists.
+				for _, cmp := range []datastore.Cmp{{Key: "key1", Value: []byte("val1")}, {Key: "key4", Value: nil}} {
+					applied, err = db.Txn([]datastore.Cmp{cmp}, []datastore.Op{
+						datastore.OpSet("key3", "val3.2"),
+						datastore.OpDelete("key9"),
+					})
+					require.NoError(t, err)
+					assert.False(t, applied)
+
+					v, err = db.Get("key3")
+					require.NoError(t, err)
+					assert.Equal(t, "val3", string(v))
+					v, err = db.Get("key9")
+					require.NoError(t, err)
+					assert.Equal(t, "val9", string(v))
+				}
+
+				err = db.Delete("key4")
+				require.NoError(t, err)
+			})
+
+			t.Run("Txn empty value", func(t *testing.T) {
+				setupDatastore(t, db)
+				err := db.Set("empty", "")
+				require.NoError(t, err)
+
+				// An empty value is distinct from a missing key, so a transaction comparing on it can be applied.
+				v, err := db.Get("empty")
+				require.NoError(t, err)
+				require.NotNil(t, v)
+				assert.Empty(t, v)
+				applied, err := db.Txn([]datastore.Cmp{{Key: "empty", Value: v}}, []datastore.Op{datastore.OpDelete("empty")})
+				require.NoError(t, err)
+				assert.True(t, applied)
+
+				v, err = db.Get("empty")
+				require.NoError(t, err)
+				assert.Nil(t, v)
+			})
+
+			t.Run("Snapshot", func(t *testing.T) {
+				setupDatastore(t, db)
+				err := db.SetWithTTL("key5", "val5", 1*time.Hour)
+				require.NoError(t, err)
+
+				var kvs []datastore.KeyValue
+				err = db.(datastore.Snapshotter).Snapshot(func(kv datastore.KeyValue) error {
+					kvs = append(kvs, kv)
+					return nil
+				})
+				require.NoError(t, err)
+
+				byKey := make(map[string]datastore.KeyValue)
+				var keys []string
+				for _, kv := range kvs {
+					byKey[kv.Key] = kv
+					keys = append(keys, kv.Key)
+				}
+				assert.True(t, sort.StringsAreSorted(keys))
+				// Keys used internally to track TTLs aren't part of the snapshot.
+				assert.NotContains(t, keys, "___ttl___/key5")
+
+				for _, k := range []string{"jam1", "key1", "key2", "key3", "key9", "lim1"} {
+					require.Contains(t, byKey, k)
+					assert.True(t, byKey[k].ExpiresAt.IsZero())
+				}
+				require.Contains(t, byKey, "key5")
+				assert.Equal(t, "val5", string(byKey["key5"].Value))
+				assert.WithinDuration(t, time.Now().Add(1*time.Hour), byKey["key5"].ExpiresAt, 5*time.Second)
+
+				// The snapshot stops at the first error.
+				errStop := errors.New("stop")
+				visited := 0
+				err = db.(datastore.Snapshotter).Snapshot(func(kv datastore.KeyValue) error {
+					visited++
+					return errStop
+				})
+				assert.Equal(t, errStop, err)
+				assert.Equal(t, 1, visited)
+			})
+
 			err := db.Close()
 			assert.NoError(t, err)
 
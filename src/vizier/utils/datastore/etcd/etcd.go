@@ -20,13 +20,19 @@ package etcd
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"px.dev/pixie/src/vizier/utils/datastore"
 )
 
+// The number of keys read at a time when scanning a range.
+const scanPageSize = 256
+
 // DataStore wraps a clientv3 datastore.
 type DataStore struct {
 	client *clientv3.Client
@@ -66,6 +72,10 @@ func (w *DataStore) Get(key string) ([]byte, error) {
 	if len(resp.Kvs) == 0 {
 		return nil, nil
 	}
+	// An empty value is decoded as nil, which would otherwise be mistaken for a missing key.
+	if resp.Kvs[0].Value == nil {
+		return []byte{}, nil
+	}
 	return resp.Kvs[0].Value, nil
 }
 
@@ -106,6 +116,88 @@ func (w *DataStore) GetWithPrefix(prefix string) ([]string, [][]byte, error) {
 	return kvsToSlices(resp.Kvs)
 }
 
+// ScanRange calls fn with each key in [from, to) and its value, in order, until fn returns false.
+// The range is read a page at a time.
+func (w *DataStore) ScanRange(from string, to string, reverse bool, fn func(key string, value []byte) bool) error {
+	for {
+		opts := []clientv3.OpOption{clientv3.WithRange(to), clientv3.WithLimit(scanPageSize), clientv3.WithSerializable()}
+		if reverse {
+			opts = append(opts, clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend))
+		}
+		resp, err := w.client.Get(context.Background(), from, opts...)
+		if err != nil {
+			return err
+		}
+		for _, kv := range resp.Kvs {
+			if !fn(string(kv.Key), kv.Value) {
+				return nil
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return nil
+		}
+		last := string(resp.Kvs[len(resp.Kvs)-1].Key)
+		if reverse {
+			to = last
+		} else {
+			from = last + "\x00"
+		}
+	}
+}
+
+// Snapshot calls fn with each of the keys in the datastore, along with the time at which it expires.
+// Keys attached to a lease expire when the lease does. The keys are read a page at a time, all at the
+// revision of the first page.
+func (w *DataStore) Snapshot(fn func(kv datastore.KeyValue) error) error {
+	ctx := context.Background()
+	from := "\x00"
+	var rev int64
+	for {
+		opts := []clientv3.OpOption{clientv3.WithFromKey(), clientv3.WithLimit(scanPageSize)}
+		if rev != 0 {
+			opts = append(opts, clientv3.WithRev(rev))
+		}
+		resp, err := w.client.Get(ctx, from, opts...)
+		if err != nil {
+			return err
+		}
+		if rev == 0 {
+			rev = resp.Header.Revision
+		}
+
+		// Leases are looked up once per page, so that the expiries of all of the keys aren't held in memory.
+		now := time.Now()
+		expiries := make(map[clientv3.LeaseID]time.Time)
+		for _, kv := range resp.Kvs {
+			entry := datastore.KeyValue{Key: string(kv.Key), Value: kv.Value}
+			if kv.Lease != 0 {
+				leaseID := clientv3.LeaseID(kv.Lease)
+				expiresAt, ok := expiries[leaseID]
+				if !ok {
+					ttlResp, err := w.client.TimeToLive(ctx, leaseID)
+					if err != nil {
+						return err
+					}
+					if ttlResp.TTL < 0 {
+						// The lease expired after the keys were read.
+						continue
+					}
+					expiresAt = now.Add(time.Duration(ttlResp.TTL) * time.Second)
+					expiries[leaseID] = expiresAt
+				}
+				entry.ExpiresAt = expiresAt
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return nil
+		}
+		from = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
 // Delete deletes the value for the given key from the datastore.
 func (w *DataStore) Delete(key string) error {
 	_, err := w.client.Delete(context.Background(), key)
@@ -129,6 +221,65 @@ func (w *DataStore) DeleteWithPrefix(prefix string) error {
 	return err
 }
 
+// DeleteWithRange deletes all keys and values in [from, to).
+func (w *DataStore) DeleteWithRange(from string, to string) error {
+	_, err := w.client.Delete(context.Background(), from, clientv3.WithRange(to))
+	return err
+}
+
+// Txn applies all of the ops in a single etcd transaction if all of the cmps hold. The leases of the keys
+// set with a TTL are granted before the transaction, and revoked if it isn't applied.
+func (w *DataStore) Txn(cmps []datastore.Cmp, ops []datastore.Op) (applied bool, err error) {
+	ctx := context.Background()
+
+	var leases []clientv3.LeaseID
+	defer func() {
+		if applied {
+			return
+		}
+		for _, leaseID := range leases {
+			// The lease expires on its own if it can't be revoked.
+			_, _ = w.client.Revoke(ctx, leaseID)
+		}
+	}()
+
+	ifs := make([]clientv3.Cmp, len(cmps))
+	for i, cmp := range cmps {
+		if cmp.Value == nil {
+			ifs[i] = clientv3.Compare(clientv3.CreateRevision(cmp.Key), "=", 0)
+		} else {
+			ifs[i] = clientv3.Compare(clientv3.Value(cmp.Key), "=", string(cmp.Value))
+		}
+	}
+
+	thens := make([]clientv3.Op, len(ops))
+	for i, op := range ops {
+		switch op.Type {
+		case datastore.OpTypeSet:
+			thens[i] = clientv3.OpPut(op.Key, op.Value)
+		case datastore.OpTypeSetWithTTL:
+			resp, err := w.client.Grant(ctx, int64(op.TTL.Seconds()))
+			if err != nil {
+				return false, err
+			}
+			leases = append(leases, resp.ID)
+			thens[i] = clientv3.OpPut(op.Key, op.Value, clientv3.WithLease(resp.ID))
+		case datastore.OpTypeDelete:
+			thens[i] = clientv3.OpDelete(op.Key)
+		case datastore.OpTypeDeleteWithPrefix:
+			thens[i] = clientv3.OpDelete(op.Key, clientv3.WithPrefix())
+		default:
+			return false, fmt.Errorf("unknown op type %d", op.Type)
+		}
+	}
+
+	resp, err := w.client.Txn(ctx).If(ifs...).Then(thens...).Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
 // Close closes the underlying datastore.
 // All other operations will fail after calling Close.
 func (w *DataStore) Close() error {
@@ -19,12 +19,15 @@
 package pebbledb
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/cockroachdb/pebble"
+
+	"px.dev/pixie/src/vizier/utils/datastore"
 )
 
 const (
@@ -58,6 +61,8 @@ func getKeyToDeleteFromTTLByTime(ttlByTimeKey string) (string, error) {
 // DataStore wraps a pebbledb datastore.
 type DataStore struct {
 	db *pebble.DB
+	// writeMu serializes writes, so that the comparisons of a transaction hold until it is committed.
+	writeMu sync.Mutex
 
 	done chan struct{}
 	once sync.Once
@@ -144,22 +149,20 @@ func (w *DataStore) ttlWatcher(ttlReaperDuration time.Duration) {
 
 // Set puts the given key and value in the datastore.
 func (w *DataStore) Set(key string, value string) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
 	return w.db.Set([]byte(key), []byte(value), pebble.Sync)
 }
 
-// SetWithTTL puts the given key and value into the datastore with a TTL.
-// Once the TTL expires the datastore is expected to delete the given key and value.
-func (w *DataStore) SetWithTTL(key string, value string, ttl time.Duration) error {
-	batch := w.db.NewBatch()
+func setWithTTL(batch *pebble.Batch, key string, value string, ttl time.Duration) error {
 	expiresAt := time.Now().Add(ttl)
 	encodedExpiry, err := expiresAt.MarshalBinary()
 	if err != nil {
-		batch.Close()
 		return err
 	}
 	err = batch.Set([]byte(key), []byte(value), pebble.Sync)
 	if err != nil {
-		batch.Close()
 		return err
 	}
 
@@ -168,10 +171,19 @@ func (w *DataStore) SetWithTTL(key string, value string, ttl time.Duration) erro
 
 	err = batch.Set([]byte(ttlByKey), encodedExpiry, pebble.Sync)
 	if err != nil {
-		batch.Close()
 		return err
 	}
-	err = batch.Set([]byte(ttlByTime), nil, pebble.Sync)
+	return batch.Set([]byte(ttlByTime), nil, pebble.Sync)
+}
+
+// SetWithTTL puts the given key and value into the datastore with a TTL.
+// Once the TTL expires the datastore is expected to delete the given key and value.
+func (w *DataStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	batch := w.db.NewBatch()
+	err := setWithTTL(batch, key, value, ttl)
 	if err != nil {
 		batch.Close()
 		return err
@@ -220,17 +232,90 @@ func (w *DataStore) GetWithPrefix(prefix string) ([]string, [][]byte, error) {
 	return w.GetWithRange(prefix, string(keyUpperBound([]byte(prefix))))
 }
 
+// ScanRange calls fn with each key in [from, to) and its value, in order, until fn returns false.
+func (w *DataStore) ScanRange(from string, to string, reverse bool, fn func(key string, value []byte) bool) error {
+	iter := w.db.NewIter(&pebble.IterOptions{
+		LowerBound: []byte(from),
+		UpperBound: []byte(to),
+	})
+
+	valid := iter.First()
+	next := iter.Next
+	if reverse {
+		valid = iter.Last()
+		next = iter.Prev
+	}
+	for ; valid; valid = next() {
+		if err := iter.Error(); err != nil {
+			iter.Close()
+			return err
+		}
+		if !fn(string(iter.Key()), iter.Value()) {
+			break
+		}
+	}
+	return iter.Close()
+}
+
+// Snapshot calls fn with each of the keys in the datastore, along with the time at which it expires. The keys
+// are read from a consistent snapshot of the datastore.
+func (w *DataStore) Snapshot(fn func(kv datastore.KeyValue) error) error {
+	snap := w.db.NewSnapshot()
+	defer snap.Close()
+
+	iter := snap.NewIter(&pebble.IterOptions{})
+	for iter.First(); iter.Valid(); iter.Next() {
+		if err := iter.Error(); err != nil {
+			iter.Close()
+			return err
+		}
+		k := string(iter.Key())
+		if strings.HasPrefix(k, ttlByTimePrefix+"/") || strings.HasPrefix(k, ttlByKeyPrefix+"/") {
+			continue
+		}
+		v := iter.Value()
+		kv := datastore.KeyValue{Key: k, Value: make([]byte, len(v))}
+		copy(kv.Value, v)
+
+		expiry, closer, err := snap.Get([]byte(getKeyForTTLByKey(k)))
+		if err != nil && err != pebble.ErrNotFound {
+			iter.Close()
+			return err
+		}
+		if err == nil {
+			var expiresAt time.Time
+			if expiresAt.UnmarshalBinary(expiry) == nil {
+				kv.ExpiresAt = expiresAt
+			}
+			closer.Close()
+		}
+
+		if err := fn(kv); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
 // Delete deletes the value for the given key from the datastore.
 func (w *DataStore) Delete(key string) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
 	return w.db.Delete([]byte(key), pebble.Sync)
 }
 
 // DeleteAll deletes all of the given keys and corresponding values in the datastore if they exist.
 func (w *DataStore) DeleteAll(keys []string) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
 	batch := w.db.NewBatch()
 	for _, key := range keys {
 		err := batch.Delete([]byte(key), pebble.Sync)
 		if err != nil {
+			batch.Close()
 			return err
 		}
 	}
@@ -239,9 +324,58 @@ func (w *DataStore) DeleteAll(keys []string) error {
 
 // DeleteWithPrefix deletes all keys and values with the given prefix.
 func (w *DataStore) DeleteWithPrefix(prefix string) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
 	return w.db.DeleteRange([]byte(prefix), keyUpperBound([]byte(prefix)), pebble.Sync)
 }
 
+// DeleteWithRange deletes all keys and values in [from, to).
+func (w *DataStore) DeleteWithRange(from string, to string) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	return w.db.DeleteRange([]byte(from), []byte(to), pebble.Sync)
+}
+
+// Txn applies all of the ops in a single batch if all of the cmps hold.
+func (w *DataStore) Txn(cmps []datastore.Cmp, ops []datastore.Op) (bool, error) {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	for _, cmp := range cmps {
+		v, err := w.Get(cmp.Key)
+		if err != nil {
+			return false, err
+		}
+		if (cmp.Value == nil) != (v == nil) || !bytes.Equal(cmp.Value, v) {
+			return false, nil
+		}
+	}
+
+	batch := w.db.NewBatch()
+	for _, op := range ops {
+		var err error
+		switch op.Type {
+		case datastore.OpTypeSet:
+			err = batch.Set([]byte(op.Key), []byte(op.Value), pebble.Sync)
+		case datastore.OpTypeSetWithTTL:
+			err = setWithTTL(batch, op.Key, op.Value, op.TTL)
+		case datastore.OpTypeDelete:
+			err = batch.Delete([]byte(op.Key), pebble.Sync)
+		case datastore.OpTypeDeleteWithPrefix:
+			err = batch.DeleteRange([]byte(op.Key), keyUpperBound([]byte(op.Key)), pebble.Sync)
+		default:
+			err = fmt.Errorf("unknown op type %d", op.Type)
+		}
+		if err != nil {
+			batch.Close()
+			return false, err
+		}
+	}
+	return true, batch.Commit(pebble.Sync)
+}
+
 // Close stops the TTL watcher, and closes the underlying datastore.
 // All other operations will fail after calling Close.
 func (w *DataStore) Close() error {